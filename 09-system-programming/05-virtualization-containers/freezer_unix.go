@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+/*
+Unix 平台的 freezer cgroup 操作
+
+cgroup v1 通过 freezer.state 写入 FROZEN/THAWED，cgroup v2 通过 cgroup.freeze 写入 1/0。
+*/
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"go-mastery/common/security"
+)
+
+// setFrozen 冻结或解冻cgroup
+func (cm *CgroupManager) setFrozen(cgroup *Cgroup, frozen bool) error {
+	if cgroup == nil {
+		return fmt.Errorf("freezer cgroup not available")
+	}
+
+	file, value := "freezer.state", "THAWED"
+	if frozen {
+		value = "FROZEN"
+	}
+	if cm.version == 2 {
+		file, value = "cgroup.freeze", "0"
+		if frozen {
+			value = "1"
+		}
+	}
+
+	return security.SecureWriteFile(filepath.Join(cgroup.Path, file), []byte(value), &security.SecureFileOptions{
+		Mode:      security.DefaultFileMode,
+		CreateDir: false,
+	})
+}
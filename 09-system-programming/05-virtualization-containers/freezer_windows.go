@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+/*
+Windows 平台的 freezer cgroup 操作
+
+Windows 没有 freezer cgroup，暂停/恢复容器直接返回不支持。
+*/
+package main
+
+import "errors"
+
+// setFrozen Windows下不支持冻结进程
+func (cm *CgroupManager) setFrozen(cgroup *Cgroup, frozen bool) error {
+	return errors.New("container pause is not supported on Windows: freezer cgroup unavailable")
+}
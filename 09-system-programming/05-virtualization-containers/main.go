@@ -23,16 +23,32 @@
 package main
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"math/big"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -40,6 +56,9 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/net/bpf"
+
 	"go-mastery/common/security"
 )
 
@@ -84,6 +103,21 @@ func validateNetworkName(name string) error {
 	return nil
 }
 
+// maxInterfaceNameLength Linux网络接口名最大长度（IFNAMSIZ减去结尾的NUL）
+const maxInterfaceNameLength = 15
+
+func validateInterfaceName(name string) error {
+	// 接口名不能超过IFNAMSIZ限制，且不能包含空白和路径分隔符
+	if len(name) == 0 || len(name) > maxInterfaceNameLength {
+		return fmt.Errorf("接口名称长度必须在1-%d字符之间: %q", maxInterfaceNameLength, name)
+	}
+	matched, _ := regexp.MatchString("^[a-zA-Z0-9_.-]+$", name)
+	if !matched || name == "." || name == ".." {
+		return fmt.Errorf("接口名称只能包含字母、数字、点、连字符和下划线: %q", name)
+	}
+	return nil
+}
+
 func validateIPAddress(ip string) error {
 	// 验证IP地址格式
 	if net.ParseIP(ip) == nil {
@@ -152,11 +186,6 @@ func windowsUnmount(target string, flags int) error {
 	return fmt.Errorf("unmount not supported on Windows")
 }
 
-func setns(fd uintptr, nstype int) error {
-	// Placeholder implementation for Windows
-	return fmt.Errorf("setns not supported on Windows")
-}
-
 // Define syscall constants for Windows compatibility
 const (
 	SYS_SETNS = 308 // Placeholder value
@@ -177,6 +206,7 @@ type WindowsSysProcAttr struct {
 type ContainerRuntime struct {
 	containers map[string]*Container
 	images     map[string]*ContainerImage
+	buildCache map[string]string // 构建缓存键 -> 镜像ID
 	networks   map[string]*ContainerNetwork
 	volumes    map[string]*ContainerVolume
 	namespaces *NamespaceManager
@@ -188,10 +218,12 @@ type ContainerRuntime struct {
 	config     RuntimeConfig
 	statistics RuntimeStatistics
 	eventBus   *ContainerEventBus
+	eventLog   *EventLog
 	monitor    *ContainerMonitor
 	mutex      sync.RWMutex
 	running    bool
 	stopCh     chan struct{}
+	stopOnce   sync.Once
 }
 
 // RuntimeConfig 运行时配置
@@ -207,9 +239,14 @@ type RuntimeConfig struct {
 	DefaultNetworkMode string
 	StorageDriver      string
 	CgroupVersion      int
+	CgroupParent       string // 容器cgroup的父路径（相对于cgroup挂载点），如systemd slice
 	OOMKillDisable     bool
-	PidsLimit          int64
+	PidsLimit          int64 // 每个容器的默认进程数上限，0表示不限制
 	ShmSize            int64
+	Network            NetworkConfig  // 默认网络配置，子网为空时自动选择
+	EventLog           EventLogConfig // 事件审计日志的容量限制
+	EventBus           EventBusConfig // 事件订阅者的队列长度与背压策略
+	ExitedRetention    time.Duration  // 已退出容器的保留时长，超过后由cleanupLoop删除；0表示永久保留
 }
 
 // Container 容器实例
@@ -228,11 +265,52 @@ type Container struct {
 	SecurityContext *SecurityContext
 	Resources       *ResourceConstraints
 	Statistics      *ContainerStatistics
+	logs            *containerLog // 首次启动时创建，由stateMutex保护
 	CreatedAt       time.Time
 	StartedAt       time.Time
 	FinishedAt      time.Time
 	ExitCode        int
-	mutex           sync.RWMutex
+	RestartCount    int          // 按重启策略自动重启的次数，写入时同时持有mutex和stateMutex
+	oomKills        int64        // 已观察到的内存cgroup OOM kill计数，由stateMutex保护
+	stopRequested   bool         // 当前进程是否被显式停止，显式停止的容器不再重启，由mutex保护
+	chroot          string       // 非空时进程chroot到该目录运行，目前只用于构建的RUN步骤，由mutex保护
+	mutex           sync.RWMutex // 串行化启动/停止等生命周期操作
+	stateMutex      sync.RWMutex // 保护State及时间戳字段，仅作为叶子锁使用
+}
+
+// Status 返回容器当前状态
+func (c *Container) Status() ContainerStatus {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.State.Status
+}
+
+// IsRunning 判断容器是否在运行
+func (c *Container) IsRunning() bool {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.State.Running
+}
+
+// Snapshot 返回容器状态的副本，调用方可以自由读取而无需加锁
+func (c *Container) Snapshot() *ContainerState {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+
+	snapshot := *c.State
+	if c.State.Health != nil {
+		health := *c.State.Health
+		health.Log = append([]HealthcheckResult(nil), c.State.Health.Log...)
+		snapshot.Health = &health
+	}
+	return &snapshot
+}
+
+// setState 在持有stateMutex的情况下修改容器状态，所有内部状态变更都必须经过此方法
+func (c *Container) setState(update func(state *ContainerState)) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	update(c.State)
 }
 
 // ContainerConfig 容器配置
@@ -262,6 +340,12 @@ type ContainerConfig struct {
 	StopSignal      string
 	StopTimeout     *int
 	Shell           []string
+	Tmpfs           map[string]string // 容器内路径 -> 挂载选项，如"size=64m,mode=1777"
+	SecurityContext *SecurityContext  // 创建容器时复制到Container.SecurityContext
+	AutoRemove      bool              // 进程退出后自动删除容器
+	RestartPolicy   RestartPolicy     // 进程退出后的重启策略，为空等同于Never
+	MaxRetries      int               // OnFailure策略的最大重启次数，<=0时使用defaultRestartMaxRetries
+	PidsLimit       int64             // 容器的进程数上限，0时使用RuntimeConfig.PidsLimit
 }
 
 // ContainerState 容器状态
@@ -293,14 +377,31 @@ const (
 	StatusDead
 )
 
+var containerStatusNames = []string{"created", "running", "paused", "restarting", "removing", "exited", "dead"}
+
 func (cs ContainerStatus) String() string {
-	statuses := []string{"created", "running", "paused", "restarting", "removing", "exited", "dead"}
-	if int(cs) < len(statuses) {
-		return statuses[cs]
+	if int(cs) >= 0 && int(cs) < len(containerStatusNames) {
+		return containerStatusNames[cs]
 	}
 	return "unknown"
 }
 
+// MarshalText 以状态名序列化，使JSON输出可读
+func (cs ContainerStatus) MarshalText() ([]byte, error) {
+	return []byte(cs.String()), nil
+}
+
+// UnmarshalText 从状态名解析
+func (cs *ContainerStatus) UnmarshalText(text []byte) error {
+	for i, name := range containerStatusNames {
+		if name == string(text) {
+			*cs = ContainerStatus(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown container status: %s", text)
+}
+
 // ContainerProcess 容器进程
 type ContainerProcess struct {
 	Pid      int
@@ -308,30 +409,54 @@ type ContainerProcess struct {
 	Env      []string
 	Cwd      string
 	Stdin    io.WriteCloser
-	Stdout   io.ReadCloser
-	Stderr   io.ReadCloser
+	stdout   io.ReadCloser // 由日志协程独占读取，外部通过Stdout订阅
+	stderr   io.ReadCloser // 由日志协程独占读取，外部通过Stderr订阅
+	logs     *containerLog
 	Wait     chan error
+	Done     chan struct{} // 进程退出时关闭，可被多个等待者同时观察
+	Exited   chan struct{} // 容器状态更新为已退出后关闭
 	Started  time.Time
 	ExitCode int
 }
 
 func NewContainerRuntime(config RuntimeConfig) *ContainerRuntime {
-	return &ContainerRuntime{
+	storage := NewStorageManager()
+	storage.graphRoot = filepath.Join(config.RootDirectory, "storage")
+	storage.runRoot = filepath.Join(config.StateDirectory, "storage")
+
+	cgroups := NewCgroupManager()
+	if config.CgroupVersion != 0 {
+		cgroups.version = config.CgroupVersion
+	}
+	if config.CgroupParent != "" {
+		cgroups.parent = strings.Trim(config.CgroupParent, "/")
+	}
+
+	// 所有事件同步写入StateDirectory下的审计日志
+	eventBus := NewContainerEventBus(config.EventBus)
+	eventLog := NewEventLog(filepath.Join(config.StateDirectory, "events"), config.EventLog)
+	eventBus.AddSink(eventLog)
+
+	cr := &ContainerRuntime{
 		containers: make(map[string]*Container),
 		images:     make(map[string]*ContainerImage),
+		buildCache: make(map[string]string),
 		networks:   make(map[string]*ContainerNetwork),
 		volumes:    make(map[string]*ContainerVolume),
 		namespaces: NewNamespaceManager(),
-		cgroups:    NewCgroupManager(),
+		cgroups:    cgroups,
 		seccomp:    NewSeccompManager(),
 		apparmor:   NewApparmorManager(),
-		storage:    NewStorageManager(),
+		storage:    storage,
 		network:    NewNetworkManager(),
 		config:     config,
-		eventBus:   NewContainerEventBus(),
+		eventBus:   eventBus,
+		eventLog:   eventLog,
 		monitor:    NewContainerMonitor(),
 		stopCh:     make(chan struct{}),
 	}
+	cr.network.SetRuntimeLookup(cr)
+	return cr
 }
 
 func (cr *ContainerRuntime) Start() error {
@@ -341,6 +466,11 @@ func (cr *ContainerRuntime) Start() error {
 	if cr.running {
 		return fmt.Errorf("container runtime already running")
 	}
+	select {
+	case <-cr.stopCh:
+		return fmt.Errorf("container runtime already stopped")
+	default:
+	}
 
 	// 初始化存储驱动
 	if err := cr.storage.Initialize(cr.config.StorageDriver); err != nil {
@@ -348,7 +478,7 @@ func (cr *ContainerRuntime) Start() error {
 	}
 
 	// 初始化网络
-	if err := cr.network.Initialize(); err != nil {
+	if err := cr.network.Initialize(cr.config.Network); err != nil {
 		return fmt.Errorf("failed to initialize network: %v", err)
 	}
 
@@ -362,6 +492,21 @@ func (cr *ContainerRuntime) Start() error {
 	return nil
 }
 
+// Stop 停止后台循环并刷新、关闭事件审计日志。停止后的运行时不能再启动，重复调用无副作用
+func (cr *ContainerRuntime) Stop() error {
+	var err error
+	cr.stopOnce.Do(func() {
+		close(cr.stopCh)
+
+		cr.mutex.Lock()
+		cr.running = false
+		cr.mutex.Unlock()
+
+		err = cr.eventLog.Close()
+	})
+	return err
+}
+
 func (cr *ContainerRuntime) CreateContainer(config *ContainerConfig) (*Container, error) {
 	cr.mutex.Lock()
 	defer cr.mutex.Unlock()
@@ -370,24 +515,25 @@ func (cr *ContainerRuntime) CreateContainer(config *ContainerConfig) (*Container
 	containerID := generateContainerID()
 
 	// 查找镜像
-	image, exists := cr.images[config.Image]
+	image, exists := cr.lookupImageLocked(config.Image)
 	if !exists {
 		return nil, fmt.Errorf("image not found: %s", config.Image)
 	}
 
 	// 创建容器实例
 	container := &Container{
-		ID:         containerID,
-		Name:       generateContainerName(),
-		Image:      image,
-		Config:     config,
-		State:      &ContainerState{Status: StatusCreated},
-		Namespaces: make(map[string]*Namespace),
-		Cgroups:    make(map[string]*Cgroup),
-		Mounts:     make([]*Mount, 0),
-		Networks:   make([]*NetworkInterface, 0),
-		Volumes:    make([]*Volume, 0),
-		CreatedAt:  time.Now(),
+		ID:              containerID,
+		Name:            generateContainerName(),
+		Image:           image,
+		Config:          applyImageDefaults(config, image),
+		SecurityContext: config.SecurityContext,
+		State:           &ContainerState{Status: StatusCreated},
+		Namespaces:      make(map[string]*Namespace),
+		Cgroups:         make(map[string]*Cgroup),
+		Mounts:          make([]*Mount, 0),
+		Networks:        make([]*NetworkInterface, 0),
+		Volumes:         make([]*Volume, 0),
+		CreatedAt:       time.Now(),
 	}
 
 	// 创建命名空间
@@ -419,6 +565,20 @@ func (cr *ContainerRuntime) CreateContainer(config *ContainerConfig) (*Container
 }
 
 func (cr *ContainerRuntime) StartContainer(containerID string) error {
+	return cr.StartContainerContext(context.Background(), containerID)
+}
+
+// StartContainerContext 启动容器。ctx只约束启动过程，进程启动后容器的生命周期不再受ctx影响
+func (cr *ContainerRuntime) StartContainerContext(ctx context.Context, containerID string) error {
+	return cr.startContainer(ctx, containerID, false)
+}
+
+// startContainer 启动容器，bindProcess为true时容器进程随ctx取消而被终止（用于构建等一次性命令）
+func (cr *ContainerRuntime) startContainer(ctx context.Context, containerID string, bindProcess bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	cr.mutex.RLock()
 	container, exists := cr.containers[containerID]
 	cr.mutex.RUnlock()
@@ -430,21 +590,17 @@ func (cr *ContainerRuntime) StartContainer(containerID string) error {
 	container.mutex.Lock()
 	defer container.mutex.Unlock()
 
-	if container.State.Status != StatusCreated {
-		return fmt.Errorf("container not in created state: %s", container.State.Status)
+	if status := container.Status(); status != StatusCreated {
+		return fmt.Errorf("container not in created state: %s", status)
 	}
 
 	// 启动容器进程
-	process, err := cr.startContainerProcess(container)
+	process, err := cr.startContainerProcess(ctx, container, bindProcess)
 	if err != nil {
 		return fmt.Errorf("failed to start container process: %v", err)
 	}
 
-	container.Process = process
-	container.State.Status = StatusRunning
-	container.State.Running = true
-	container.State.Pid = process.Pid
-	container.StartedAt = time.Now()
+	cr.attachProcess(container, process)
 
 	fmt.Printf("启动容器: %s (PID: %d)\n", containerID[:12], process.Pid)
 
@@ -455,13 +611,45 @@ func (cr *ContainerRuntime) StartContainer(containerID string) error {
 		Timestamp: time.Now(),
 	})
 
-	// 异步等待进程结束
-	go cr.waitForProcess(container)
-
 	return nil
 }
 
+// attachProcess 记录新启动的容器进程并开始等待其退出，调用方必须持有container.mutex。
+// waitForProcess需要获取container.mutex，因此调用方在释放锁之前发布的事件都排在die事件之前
+func (cr *ContainerRuntime) attachProcess(container *Container, process *ContainerProcess) {
+	container.Process = process
+	container.stopRequested = false
+	// 命名空间指向新进程，exec据此加入容器进程所在的命名空间
+	for nsType, ns := range container.Namespaces {
+		ns.Path = fmt.Sprintf("/proc/%d/ns/%s", process.Pid, nsType)
+		ns.Pid = process.Pid
+	}
+	container.setState(func(state *ContainerState) {
+		state.Status = StatusRunning
+		state.Running = true
+		state.Restarting = false
+		state.OOMKilled = false
+		state.Pid = process.Pid
+		state.StartedAt = process.Started
+		container.StartedAt = process.Started
+		if healthcheckEnabled(container.Config.Healthcheck) {
+			state.Health = &Health{Status: HealthStarting}
+		}
+	})
+
+	// 异步等待进程结束
+	go cr.waitForProcess(container, process)
+	if healthcheckEnabled(container.Config.Healthcheck) {
+		go cr.healthcheckLoop(container, process)
+	}
+}
+
 func (cr *ContainerRuntime) StopContainer(containerID string, timeout time.Duration) error {
+	return cr.StopContainerContext(context.Background(), containerID, timeout)
+}
+
+// StopContainerContext 停止容器。ctx取消或到期时提前结束优雅退出等待，直接发送SIGKILL
+func (cr *ContainerRuntime) StopContainerContext(ctx context.Context, containerID string, timeout time.Duration) error {
 	cr.mutex.RLock()
 	container, exists := cr.containers[containerID]
 	cr.mutex.RUnlock()
@@ -473,43 +661,81 @@ func (cr *ContainerRuntime) StopContainer(containerID string, timeout time.Durat
 	container.mutex.Lock()
 	defer container.mutex.Unlock()
 
-	if !container.State.Running {
-		return fmt.Errorf("container not running: %s", containerID)
+	return cr.stopContainerLocked(ctx, container, timeout)
+}
+
+// stopContainerLocked 停止容器进程，调用方必须持有container.mutex。
+// 该方法不会获取cr.mutex，因此持有运行时锁的调用方（如RemoveContainer）可以安全调用。
+// 锁顺序约定：cr.mutex -> container.mutex，任何路径都不得反向获取。
+func (cr *ContainerRuntime) stopContainerLocked(ctx context.Context, container *Container, timeout time.Duration) error {
+	// 等待重启的容器没有进程，取消重启即可
+	if cancelRestartLocked(container) {
+		fmt.Printf("停止容器: %s\n", container.ID[:12])
+		cr.eventBus.Publish(&ContainerEvent{
+			Type:      EventContainerStop,
+			Container: container,
+			Timestamp: time.Now(),
+		})
+		return nil
+	}
+	if !container.IsRunning() {
+		return fmt.Errorf("container not running: %s", container.ID)
+	}
+	container.stopRequested = true
+
+	// 在发送任何信号之前解析停止信号和宽限期
+	stopSignal, err := parseStopSignal(container.Config.StopSignal)
+	if err != nil {
+		return err
+	}
+	if timeout == 0 {
+		timeout = defaultStopTimeout
+		if container.Config.StopTimeout != nil && *container.Config.StopTimeout >= 0 {
+			timeout = time.Duration(*container.Config.StopTimeout) * time.Second
+		}
+	}
+
+	// 冻结的进程无法处理停止信号，先解冻
+	if container.Status() == StatusPaused {
+		if err := cr.cgroups.Thaw(container.Cgroups["freezer"]); err != nil {
+			log.Printf("Warning: failed to thaw container before stop: %v", err)
+		}
 	}
 
 	// 发送终止信号
 	if container.Process != nil && container.Process.Pid > 0 {
 		process, err := os.FindProcess(container.Process.Pid)
 		if err == nil {
-			// 先发送SIGTERM
-			if err := process.Signal(syscall.SIGTERM); err != nil {
-				log.Printf("Warning: failed to send SIGTERM to process: %v", err)
-			}
-
-			// 等待超时或进程结束
-			done := make(chan bool, 1)
-			go func() {
-				select {
-				case <-container.Process.Wait:
-					done <- true
-				case <-time.After(timeout):
-					// 超时后发送SIGKILL
-					if err := process.Signal(syscall.SIGKILL); err != nil {
-						log.Printf("Warning: failed to send SIGKILL to process: %v", err)
-					}
-					done <- true
-				}
-			}()
+			// 先发送停止信号
+			if err := process.Signal(stopSignal); err != nil {
+				log.Printf("Warning: failed to send %s to process: %v", stopSignal, err)
+			}
 
-			<-done
+			// 等待超时或进程结束（Done在进程退出时关闭，不会与waitForProcess争抢Wait通道）
+			select {
+			case <-container.Process.Done:
+			case <-time.After(timeout):
+				// 超时后发送SIGKILL
+				if err := process.Signal(syscall.SIGKILL); err != nil {
+					log.Printf("Warning: failed to send SIGKILL to process: %v", err)
+				}
+			case <-ctx.Done():
+				if err := process.Signal(syscall.SIGKILL); err != nil {
+					log.Printf("Warning: failed to send SIGKILL to process: %v", err)
+				}
+			}
 		}
 	}
 
-	container.State.Status = StatusExited
-	container.State.Running = false
-	container.FinishedAt = time.Now()
+	container.setState(func(state *ContainerState) {
+		state.Status = StatusExited
+		state.Running = false
+		state.Paused = false
+		state.FinishedAt = time.Now()
+		container.FinishedAt = state.FinishedAt
+	})
 
-	fmt.Printf("停止容器: %s\n", containerID[:12])
+	fmt.Printf("停止容器: %s\n", container.ID[:12])
 
 	// 发送事件
 	cr.eventBus.Publish(&ContainerEvent{
@@ -521,6 +747,110 @@ func (cr *ContainerRuntime) StopContainer(containerID string, timeout time.Durat
 	return nil
 }
 
+// PauseContainer 通过freezer cgroup冻结容器内的全部进程
+func (cr *ContainerRuntime) PauseContainer(containerID string) error {
+	return cr.setContainerPaused(containerID, true)
+}
+
+// UnpauseContainer 解冻已暂停的容器
+func (cr *ContainerRuntime) UnpauseContainer(containerID string) error {
+	return cr.setContainerPaused(containerID, false)
+}
+
+func (cr *ContainerRuntime) setContainerPaused(containerID string, paused bool) error {
+	cr.mutex.RLock()
+	container, exists := cr.containers[containerID]
+	cr.mutex.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("container not found: %s", containerID)
+	}
+
+	container.mutex.Lock()
+	defer container.mutex.Unlock()
+
+	status := container.Status()
+	switch {
+	case paused && status == StatusPaused:
+		return fmt.Errorf("container already paused: %s", containerID)
+	case paused && status != StatusRunning:
+		return fmt.Errorf("cannot pause container %s: container is %s", containerID, status)
+	case !paused && status != StatusPaused:
+		return fmt.Errorf("cannot unpause container %s: container is %s", containerID, status)
+	}
+
+	freezer := container.Cgroups["freezer"]
+	if freezer == nil {
+		return fmt.Errorf("container %s has no freezer cgroup", containerID)
+	}
+
+	eventType := EventContainerPause
+	if paused {
+		if err := cr.cgroups.Freeze(freezer); err != nil {
+			return fmt.Errorf("failed to pause container: %w", err)
+		}
+		container.setState(func(state *ContainerState) {
+			state.Status = StatusPaused
+			state.Paused = true
+		})
+		fmt.Printf("暂停容器: %s\n", containerID[:12])
+	} else {
+		if err := cr.cgroups.Thaw(freezer); err != nil {
+			return fmt.Errorf("failed to unpause container: %w", err)
+		}
+		container.setState(func(state *ContainerState) {
+			state.Status = StatusRunning
+			state.Paused = false
+		})
+		eventType = EventContainerUnpause
+		fmt.Printf("恢复容器: %s\n", containerID[:12])
+	}
+
+	cr.eventBus.Publish(&ContainerEvent{
+		Type:      eventType,
+		Container: container,
+		Timestamp: time.Now(),
+	})
+
+	return nil
+}
+
+// defaultStopTimeout 调用方与容器配置都未指定宽限期时的默认值
+const defaultStopTimeout = 10 * time.Second
+
+// stopSignals 各平台都支持的信号名称，平台特有的信号见platformSignals
+var stopSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"ABRT": syscall.SIGABRT,
+	"KILL": syscall.SIGKILL,
+	"ALRM": syscall.SIGALRM,
+	"TERM": syscall.SIGTERM,
+}
+
+// parseStopSignal 解析"SIGINT"、"INT"或信号编号形式的停止信号，为空时返回SIGTERM
+func parseStopSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return syscall.SIGTERM, nil
+	}
+	if number, err := strconv.Atoi(name); err == nil {
+		if number <= 0 || number > 64 {
+			return 0, fmt.Errorf("invalid stop signal number: %d", number)
+		}
+		return syscall.Signal(number), nil
+	}
+
+	key := strings.TrimPrefix(strings.ToUpper(name), "SIG")
+	if signal, exists := stopSignals[key]; exists {
+		return signal, nil
+	}
+	if signal, exists := platformSignals[key]; exists {
+		return signal, nil
+	}
+	return 0, fmt.Errorf("invalid stop signal: %q", name)
+}
+
 func (cr *ContainerRuntime) RemoveContainer(containerID string, force bool) error {
 	cr.mutex.Lock()
 	defer cr.mutex.Unlock()
@@ -530,16 +860,21 @@ func (cr *ContainerRuntime) RemoveContainer(containerID string, force bool) erro
 		return fmt.Errorf("container not found: %s", containerID)
 	}
 
-	if container.State.Running && !force {
+	container.mutex.Lock()
+	cancelRestartLocked(container)
+	running := container.IsRunning()
+	if running && !force {
+		container.mutex.Unlock()
 		return fmt.Errorf("cannot remove running container without force")
 	}
 
-	// 强制停止运行中的容器
-	if container.State.Running && force {
-		if err := cr.StopContainer(containerID, 5*time.Second); err != nil {
+	// 强制停止运行中的容器（已持有cr.mutex，不能再调用会获取运行时锁的StopContainer）
+	if running && force {
+		if err := cr.stopContainerLocked(context.Background(), container, 5*time.Second); err != nil {
 			log.Printf("Warning: failed to stop container: %v", err)
 		}
 	}
+	container.mutex.Unlock()
 
 	// 清理资源
 	cr.cleanupContainer(container)
@@ -557,1749 +892,8194 @@ func (cr *ContainerRuntime) RemoveContainer(containerID string, force bool) erro
 	return nil
 }
 
-func (cr *ContainerRuntime) createNamespaces(container *Container) error {
-	// 创建各种命名空间
-	namespaces := []string{"pid", "net", "ipc", "uts", "mnt", "user"}
+// ContainerSummary 容器列表项，State为状态快照副本
+type ContainerSummary struct {
+	ID        string
+	Name      string
+	Image     string
+	State     *ContainerState
+	CreatedAt time.Time
+}
 
-	for _, nsType := range namespaces {
-		ns, err := cr.namespaces.CreateNamespace(nsType, container.ID)
-		if err != nil {
-			return fmt.Errorf("failed to create %s namespace: %v", nsType, err)
+// ListContainers 列出所有容器，返回的状态均为副本
+func (cr *ContainerRuntime) ListContainers() []*ContainerSummary {
+	cr.mutex.RLock()
+	defer cr.mutex.RUnlock()
+
+	summaries := make([]*ContainerSummary, 0, len(cr.containers))
+	for _, container := range cr.containers {
+		summary := &ContainerSummary{
+			ID:        container.ID,
+			Name:      container.Name,
+			State:     container.Snapshot(),
+			CreatedAt: container.CreatedAt,
 		}
-		container.Namespaces[nsType] = ns
+		if container.Config != nil {
+			summary.Image = container.Config.Image
+		}
+		summaries = append(summaries, summary)
 	}
 
-	return nil
+	return summaries
 }
 
-func (cr *ContainerRuntime) createCgroups(container *Container) error {
-	// 创建cgroup层次结构
-	subsystems := []string{"memory", "cpu", "cpuset", "blkio", "net_cls", "freezer"}
+// ContainerPid 返回运行中容器的进程PID，实现RuntimeLookup
+func (cr *ContainerRuntime) ContainerPid(containerID string) (int, error) {
+	cr.mutex.RLock()
+	container, exists := cr.containers[containerID]
+	cr.mutex.RUnlock()
 
-	for _, subsystem := range subsystems {
-		cgroup, err := cr.cgroups.CreateCgroup(subsystem, container.ID)
-		if err != nil {
-			return fmt.Errorf("failed to create %s cgroup: %v", subsystem, err)
-		}
-		container.Cgroups[subsystem] = cgroup
+	if !exists {
+		return 0, fmt.Errorf("container not found: %s", containerID)
 	}
-
-	return nil
+	state := container.Snapshot()
+	if !state.Running || state.Pid <= 0 {
+		return 0, fmt.Errorf("container %s is not running", containerID)
+	}
+	return state.Pid, nil
 }
 
-func (cr *ContainerRuntime) prepareFilesystem(container *Container) error {
-	// 创建容器根目录
-	containerRoot := filepath.Join(cr.config.RootDirectory, "containers", container.ID)
-	// #nosec G301 -- Linux容器标准目录权限0755，需要可执行位支持目录访问
-	if err := os.MkdirAll(containerRoot, 0755); err != nil {
-		return err
-	}
+// ContainerInspect 容器详情，可以直接序列化为JSON。所有字段都是副本，与容器内部状态不共享内存
+type ContainerInspect struct {
+	ID           string
+	Name         string
+	Image        string // 创建容器时使用的镜像引用
+	ImageID      string
+	State        *ContainerState
+	Config       ContainerConfigSummary
+	Mounts       []Mount
+	Networks     []NetworkInterface
+	Resources    *ResourceConstraints
+	CreatedAt    time.Time
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	RestartCount int
+}
+
+// ContainerConfigSummary 容器配置中对外展示的部分
+type ContainerConfigSummary struct {
+	Hostname      string
+	User          string
+	Env           []string
+	Entrypoint    []string
+	Cmd           []string
+	WorkingDir    string
+	Labels        map[string]string
+	StopSignal    string
+	Tty           bool
+	RestartPolicy RestartPolicy
+	MaxRetries    int
+}
+
+// InspectContainer 返回容器详情。配置、挂载和网络在容器锁内深拷贝，状态取自Snapshot
+func (cr *ContainerRuntime) InspectContainer(containerID string) (*ContainerInspect, error) {
+	cr.mutex.RLock()
+	container, exists := cr.containers[containerID]
+	cr.mutex.RUnlock()
 
-	// 准备镜像层
-	layerPath := filepath.Join(containerRoot, "layer")
-	if err := cr.storage.PrepareLayer(container.Image, layerPath); err != nil {
-		return err
+	if !exists {
+		return nil, fmt.Errorf("container not found: %s", containerID)
+	}
+
+	container.mutex.RLock()
+	defer container.mutex.RUnlock()
+
+	inspect := &ContainerInspect{
+		ID:        container.ID,
+		Name:      container.Name,
+		State:     container.Snapshot(),
+		Mounts:    make([]Mount, 0, len(container.Mounts)),
+		Networks:  make([]NetworkInterface, 0, len(container.Networks)),
+		CreatedAt: container.CreatedAt,
+	}
+	if container.Image != nil {
+		inspect.ImageID = container.Image.ID
+	}
+	if config := container.Config; config != nil {
+		inspect.Image = config.Image
+		inspect.Config = ContainerConfigSummary{
+			Hostname:      config.Hostname,
+			User:          config.User,
+			Env:           append([]string(nil), config.Env...),
+			Entrypoint:    append([]string(nil), config.Entrypoint...),
+			Cmd:           append([]string(nil), config.Cmd...),
+			WorkingDir:    config.WorkingDir,
+			StopSignal:    config.StopSignal,
+			Tty:           config.Tty,
+			RestartPolicy: config.RestartPolicy,
+			MaxRetries:    config.MaxRetries,
+		}
+		if config.Labels != nil {
+			inspect.Config.Labels = make(map[string]string, len(config.Labels))
+			for key, value := range config.Labels {
+				inspect.Config.Labels[key] = value
+			}
+		}
 	}
-
-	// 创建读写层
-	rwLayer := filepath.Join(containerRoot, "rw")
-	// #nosec G301 -- Linux容器文件系统层，需要0755权限支持overlay文件系统挂载
-	if err := os.MkdirAll(rwLayer, 0755); err != nil {
-		return err
+	for _, mount := range container.Mounts {
+		inspect.Mounts = append(inspect.Mounts, *mount)
 	}
-
-	// 创建合并挂载点
-	mergedPath := filepath.Join(containerRoot, "merged")
-	// #nosec G301 -- overlay文件系统挂载点，需要0755权限支持容器根文件系统访问
-	if err := os.MkdirAll(mergedPath, 0755); err != nil {
-		return err
+	for _, network := range container.Networks {
+		copied := *network
+		copied.IPAddresses = append([]string(nil), network.IPAddresses...)
+		inspect.Networks = append(inspect.Networks, copied)
 	}
-
-	// 挂载文件系统
-	mount := &Mount{
-		Source:      layerPath,
-		Target:      mergedPath,
-		Type:        "overlay",
-		Options:     fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s/work", layerPath, rwLayer, containerRoot),
-		Propagation: "private",
+	if container.Resources != nil {
+		resources := *container.Resources
+		inspect.Resources = &resources
 	}
 
-	container.Mounts = append(container.Mounts, mount)
-	return nil
-}
+	container.stateMutex.RLock()
+	inspect.StartedAt = container.StartedAt
+	inspect.FinishedAt = container.FinishedAt
+	inspect.RestartCount = container.RestartCount
+	container.stateMutex.RUnlock()
 
-func (cr *ContainerRuntime) startContainerProcess(container *Container) (*ContainerProcess, error) {
-	// 构建命令
-	var cmd *exec.Cmd
-	if len(container.Config.Entrypoint) > 0 {
-		// G204安全修复：验证可执行文件路径
-		if err := validateExecutablePath(container.Config.Entrypoint[0]); err != nil {
-			return nil, fmt.Errorf("无效的容器入口点: %v", err)
-		}
-		args := append(container.Config.Entrypoint, container.Config.Cmd...)
-		// #nosec G204 - 命令已通过validateExecutablePath白名单验证
-		cmd = exec.Command(args[0], args[1:]...)
-	} else if len(container.Config.Cmd) > 0 {
-		// G204安全修复：验证可执行文件路径
-		if err := validateExecutablePath(container.Config.Cmd[0]); err != nil {
-			return nil, fmt.Errorf("无效的容器命令: %v", err)
-		}
-		// #nosec G204 - 命令已通过validateExecutablePath白名单验证
-		cmd = exec.Command(container.Config.Cmd[0], container.Config.Cmd[1:]...)
-	} else {
-		return nil, fmt.Errorf("no command specified")
-	}
+	return inspect, nil
+}
 
-	// 设置环境变量
-	cmd.Env = container.Config.Env
+// RunContainer 创建并启动容器
+func (cr *ContainerRuntime) RunContainer(config *ContainerConfig) (*Container, error) {
+	return cr.RunContainerContext(context.Background(), config)
+}
 
-	// 设置工作目录
-	if container.Config.WorkingDir != "" {
-		cmd.Dir = container.Config.WorkingDir
+// RunContainerContext 创建并启动容器，ctx在启动完成前被取消时删除已创建的容器
+func (cr *ContainerRuntime) RunContainerContext(ctx context.Context, config *ContainerConfig) (*Container, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	// 配置命名空间 (Windows下禁用)
-	cmd.SysProcAttr = &syscall.SysProcAttr{}
-	// Cloneflags: syscallCLONE_NEWNS | syscallCLONE_NEWPID | syscallCLONE_NEWNET |
-	// 	syscallCLONE_NEWIPC | syscallCLONE_NEWUTS,
-	// Unshareflags: syscallCLONE_NEWNS,
-
-	// 设置标准输入输出
-	stdin, err := cmd.StdinPipe()
+	container, err := cr.CreateContainer(config)
 	if err != nil {
 		return nil, err
 	}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
+	if err := cr.StartContainerContext(ctx, container.ID); err != nil {
+		if removeErr := cr.RemoveContainer(container.ID, true); removeErr != nil {
+			log.Printf("Warning: failed to remove container after start failure: %v", removeErr)
+		}
 		return nil, err
 	}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, err
+	return container, nil
+}
+
+// WaitContainer 阻塞直到容器退出，返回进程退出码
+func (cr *ContainerRuntime) WaitContainer(containerID string) (int, error) {
+	return cr.WaitContainerContext(context.Background(), containerID)
+}
+
+// WaitContainerContext 阻塞直到容器退出或ctx结束
+func (cr *ContainerRuntime) WaitContainerContext(ctx context.Context, containerID string) (int, error) {
+	cr.mutex.RLock()
+	container, exists := cr.containers[containerID]
+	cr.mutex.RUnlock()
+
+	if !exists {
+		return 0, fmt.Errorf("container not found: %s", containerID)
 	}
 
-	// 启动进程
-	if err := cmd.Start(); err != nil {
-		return nil, err
+	container.mutex.Lock()
+	process := container.Process
+	container.mutex.Unlock()
+
+	if process == nil {
+		return 0, fmt.Errorf("container not started: %s", containerID)
 	}
 
-	process := &ContainerProcess{
-		Pid:     cmd.Process.Pid,
-		Args:    cmd.Args,
-		Env:     cmd.Env,
-		Cwd:     cmd.Dir,
-		Stdin:   stdin,
-		Stdout:  stdout,
-		Stderr:  stderr,
-		Wait:    make(chan error, 1),
-		Started: time.Now(),
+	select {
+	case <-process.Exited:
+		return container.Snapshot().ExitCode, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
 	}
+}
 
-	// 异步等待进程结束
-	go func() {
-		err := cmd.Wait()
-		if err != nil {
-			if exitError, ok := err.(*exec.ExitError); ok {
-				process.ExitCode = exitError.ExitCode()
-			}
-		}
-		process.Wait <- err
-	}()
+// ExecOptions 在容器中执行命令的选项
+type ExecOptions struct {
+	Tty        bool     // 为true时标准错误并入标准输出，与终端下的行为一致
+	Env        []string // 追加或覆盖容器的环境变量
+	WorkingDir string   // 为空时使用容器的工作目录
+}
 
-	return process, nil
+// ExecResult 命令执行结果
+type ExecResult struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
 }
 
-func (cr *ContainerRuntime) waitForProcess(container *Container) {
-	err := <-container.Process.Wait
+// execNamespaceOrder 进入命名空间的顺序，user必须最先进入以获得其余命名空间的权限，mnt最后进入
+var execNamespaceOrder = []string{"user", "ipc", "uts", "net", "pid", "mnt"}
 
-	container.mutex.Lock()
-	defer container.mutex.Unlock()
+// ExecContainer 在运行中的容器内执行命令并收集输出
+func (cr *ContainerRuntime) ExecContainer(containerID string, cmd []string, opts ExecOptions) (*ExecResult, error) {
+	return cr.ExecContainerContext(context.Background(), containerID, cmd, opts)
+}
 
-	container.State.Running = false
-	container.State.Status = StatusExited
-	container.FinishedAt = time.Now()
+// ExecContainerContext 在运行中的容器内执行命令，ctx取消时终止该命令
+func (cr *ContainerRuntime) ExecContainerContext(ctx context.Context, containerID string, cmd []string, opts ExecOptions) (*ExecResult, error) {
+	if len(cmd) == 0 {
+		return nil, fmt.Errorf("no command specified")
+	}
+	// G204安全修复：验证可执行文件路径
+	if err := validateExecutablePath(cmd[0]); err != nil {
+		return nil, fmt.Errorf("无效的exec命令: %v", err)
+	}
 
-	if err != nil {
-		container.State.Error = err.Error()
-		container.ExitCode = container.Process.ExitCode
+	cr.mutex.RLock()
+	container, exists := cr.containers[containerID]
+	cr.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("container not found: %s", containerID)
 	}
 
-	fmt.Printf("容器进程结束: %s (退出码: %d)\n", container.ID[:12], container.ExitCode)
+	// 只在读取配置时持锁，命令执行期间不阻塞容器的其他操作
+	container.mutex.Lock()
+	status := container.Status()
+	env := append([]string(nil), container.Config.Env...)
+	workDir := container.Config.WorkingDir
+	userSpec := container.Config.User
+	namespaces := make(map[string]*Namespace, len(container.Namespaces))
+	for nsType, ns := range container.Namespaces {
+		copied := *ns
+		namespaces[nsType] = &copied
+	}
+	container.mutex.Unlock()
 
-	// 发送事件
-	cr.eventBus.Publish(&ContainerEvent{
-		Type:      EventContainerDie,
-		Container: container,
-		Timestamp: time.Now(),
-	})
-}
+	if status != StatusRunning {
+		return nil, fmt.Errorf("cannot exec in container %s: container is %s", containerID, status)
+	}
 
-func (cr *ContainerRuntime) cleanupContainer(container *Container) {
-	// 清理命名空间
-	for _, ns := range container.Namespaces {
-		if err := cr.namespaces.DestroyNamespace(ns); err != nil {
-			log.Printf("Warning: failed to destroy namespace: %v", err)
-		}
+	for _, pair := range opts.Env {
+		env = setEnv(env, pair)
+	}
+	if opts.WorkingDir != "" {
+		workDir = opts.WorkingDir
 	}
 
-	// 清理Cgroups
-	for _, cgroup := range container.Cgroups {
-		if err := cr.cgroups.DestroyCgroup(cgroup); err != nil {
-			log.Printf("Warning: failed to destroy cgroup: %v", err)
-		}
+	// #nosec G204 - 命令已通过validateExecutablePath白名单验证
+	command := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	command.Env = env
+	command.Dir = workDir
+	command.SysProcAttr = &syscall.SysProcAttr{}
+
+	user, err := resolveContainerUser(cr.containerRootfs(container), userSpec, container.SecurityContext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve container user: %v", err)
+	}
+	if user != nil {
+		applyContainerUser(command.SysProcAttr, user)
 	}
 
-	// 清理挂载点
-	for _, mount := range container.Mounts {
-		if err := windowsUnmount(mount.Target, 0); err != nil {
-			log.Printf("Warning: failed to unmount %s: %v", mount.Target, err)
-		}
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if opts.Tty {
+		command.Stderr = &stdout
 	}
 
-	// 清理文件系统
-	containerRoot := filepath.Join(cr.config.RootDirectory, "containers", container.ID)
-	if err := os.RemoveAll(containerRoot); err != nil {
-		log.Printf("Warning: failed to remove container root directory: %v", err)
+	if err := cr.startInNamespaces(command, namespaces); err != nil {
+		return nil, fmt.Errorf("failed to start exec process: %v", err)
 	}
-}
 
-// monitorLoop 监控循环
-func (cr *ContainerRuntime) monitorLoop() {
-	for {
-		select {
-		case <-cr.stopCh:
-			return
-		default:
-			// 监控容器状态
-			cr.mutex.RLock()
-			for _, container := range cr.containers {
-				if container.State.Status == StatusRunning {
-					// 检查容器健康状态
-				}
-			}
-			cr.mutex.RUnlock()
-			time.Sleep(5 * time.Second)
+	result := &ExecResult{}
+	if err := command.Wait(); err != nil {
+		exitError, ok := err.(*exec.ExitError)
+		if !ok || ctx.Err() != nil {
+			return nil, err
 		}
+		result.ExitCode = exitError.ExitCode()
 	}
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+
+	fmt.Printf("容器内执行: %s %s (退出码: %d)\n", containerID[:12], strings.Join(cmd, " "), result.ExitCode)
+	return result, nil
 }
 
-// eventLoop 事件循环
-func (cr *ContainerRuntime) eventLoop() {
-	for {
-		select {
-		case <-cr.stopCh:
-			return
-		default:
-			// 处理容器事件
-			time.Sleep(1 * time.Second)
+// 健康状态
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// 健康检查参数的默认值，与Docker保持一致
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 30 * time.Second
+	defaultHealthRetries  = 3
+	maxHealthLogEntries   = 5
+)
+
+// healthcheckEnabled 判断是否配置了健康检查，Test为["NONE"]表示禁用
+func healthcheckEnabled(config *HealthConfig) bool {
+	return config != nil && len(config.Test) > 0 && config.Test[0] != "NONE"
+}
+
+// healthcheckCommand 将Test转换为命令：["CMD", args...]直接执行，["CMD-SHELL", cmd]经由sh执行
+func healthcheckCommand(test []string) ([]string, error) {
+	switch test[0] {
+	case "CMD":
+		if len(test) < 2 {
+			return nil, fmt.Errorf("healthcheck CMD requires a command")
 		}
+		return test[1:], nil
+	case "CMD-SHELL":
+		if len(test) != 2 {
+			return nil, fmt.Errorf("healthcheck CMD-SHELL requires exactly one command string")
+		}
+		return []string{"sh", "-c", test[1]}, nil
+	default:
+		return test, nil
 	}
 }
 
-// cleanupLoop 清理循环
-func (cr *ContainerRuntime) cleanupLoop() {
+// healthcheckLoop 按Interval周期性执行健康检查，直到容器进程退出或运行时停止
+func (cr *ContainerRuntime) healthcheckLoop(container *Container, process *ContainerProcess) {
+	interval := container.Config.Healthcheck.Interval
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
 		select {
+		case <-process.Exited:
+			return
 		case <-cr.stopCh:
 			return
-		default:
-			// 清理停止的容器
-			cr.mutex.RLock()
-			for _, container := range cr.containers {
-				if container.State.Status == StatusExited {
-					// 执行清理操作
-				}
+		case <-ticker.C:
+			// 暂停的容器无法执行命令，跳过本轮检查
+			if container.Status() == StatusRunning {
+				cr.runHealthcheck(container)
 			}
-			cr.mutex.RUnlock()
-			time.Sleep(30 * time.Second)
 		}
 	}
 }
 
-// ==================
-// 2. 命名空间管理
-// ==================
+// runHealthcheck 执行一次健康检查并更新容器的健康状态
+func (cr *ContainerRuntime) runHealthcheck(container *Container) {
+	config := container.Config.Healthcheck
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
 
-// NamespaceManager 命名空间管理器
-type NamespaceManager struct {
-	namespaces map[string]*Namespace
-	mutex      sync.RWMutex
-}
+	result := HealthcheckResult{Start: time.Now()}
+	cmd, err := healthcheckCommand(config.Test)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		var execResult *ExecResult
+		execResult, err = cr.ExecContainerContext(ctx, container.ID, cmd, ExecOptions{Tty: true})
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("health check exceeded timeout (%s)", timeout)
+		}
+		cancel()
+		if err == nil {
+			result.ExitCode = execResult.ExitCode
+			result.Output = execResult.Stdout
+		}
+	}
+	if err != nil {
+		result.ExitCode = -1
+		result.Output = err.Error()
+	}
+	result.End = time.Now()
 
-// Namespace 命名空间
-type Namespace struct {
-	Type      string
-	ID        string
-	Path      string
-	Pid       int
-	CreatedAt time.Time
-	RefCount  int32
+	cr.recordHealthcheck(container, result)
 }
 
-func NewNamespaceManager() *NamespaceManager {
-	return &NamespaceManager{
-		namespaces: make(map[string]*Namespace),
+// recordHealthcheck 记录检查结果。StartPeriod内的失败不计入连续失败次数，
+// 连续失败达到Retries时转为unhealthy并发布事件
+func (cr *ContainerRuntime) recordHealthcheck(container *Container, result HealthcheckResult) {
+	config := container.Config.Healthcheck
+	retries := config.Retries
+	if retries <= 0 {
+		retries = defaultHealthRetries
 	}
-}
-
-func (nm *NamespaceManager) CreateNamespace(nsType, containerID string) (*Namespace, error) {
-	nm.mutex.Lock()
-	defer nm.mutex.Unlock()
 
-	nsID := fmt.Sprintf("%s-%s", nsType, containerID)
-
-	ns := &Namespace{
-		Type:      nsType,
-		ID:        nsID,
-		Path:      fmt.Sprintf("/proc/self/ns/%s", nsType),
-		CreatedAt: time.Now(),
-		RefCount:  1,
-	}
+	becameUnhealthy := false
+	container.setState(func(state *ContainerState) {
+		if state.Health == nil {
+			state.Health = &Health{Status: HealthStarting}
+		}
+		health := state.Health
 
-	nm.namespaces[nsID] = ns
-	fmt.Printf("创建命名空间: %s (类型: %s)\n", nsID, nsType)
+		health.Log = append(health.Log, result)
+		if len(health.Log) > maxHealthLogEntries {
+			health.Log = health.Log[len(health.Log)-maxHealthLogEntries:]
+		}
 
-	return ns, nil
-}
+		if result.ExitCode == 0 {
+			health.Status = HealthHealthy
+			health.FailingStreak = 0
+			return
+		}
 
-func (nm *NamespaceManager) DestroyNamespace(ns *Namespace) error {
-	nm.mutex.Lock()
-	defer nm.mutex.Unlock()
+		inStartPeriod := result.Start.Sub(state.StartedAt) < config.StartPeriod
+		if inStartPeriod && health.Status == HealthStarting {
+			return
+		}
+		health.FailingStreak++
+		if health.FailingStreak >= retries && health.Status != HealthUnhealthy {
+			health.Status = HealthUnhealthy
+			becameUnhealthy = true
+		}
+	})
 
-	if atomic.AddInt32(&ns.RefCount, -1) <= 0 {
-		delete(nm.namespaces, ns.ID)
-		fmt.Printf("销毁命名空间: %s\n", ns.ID)
+	if becameUnhealthy {
+		fmt.Printf("容器健康检查失败: %s\n", container.ID[:12])
+		cr.eventBus.Publish(&ContainerEvent{
+			Type:      EventContainerUnhealthy,
+			Container: container,
+			Message:   strings.TrimSpace(result.Output),
+			Timestamp: time.Now(),
+		})
 	}
-
-	return nil
 }
 
-func (nm *NamespaceManager) EnterNamespace(ns *Namespace) error {
-	// 进入指定命名空间
-	fd, err := syscall.Open(ns.Path, syscall.O_RDONLY, 0)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err := syscall.Close(fd); err != nil {
-			log.Printf("Warning: failed to close file descriptor: %v", err)
+// startInNamespaces 在专用的OS线程上进入容器命名空间后启动进程，子进程继承该线程的命名空间。
+// 任一命名空间无法进入时返回错误且不启动进程。
+// 线程的命名空间已被修改，goroutine结束时不解除锁定，由Go运行时直接销毁该线程
+func (cr *ContainerRuntime) startInNamespaces(command *exec.Cmd, namespaces map[string]*Namespace) error {
+	started := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		for _, nsType := range execNamespaceOrder {
+			ns, exists := namespaces[nsType]
+			if !exists {
+				continue
+			}
+			// 无法进入时拒绝执行，不能让命令退回到宿主机的命名空间中运行
+			if err := cr.namespaces.EnterNamespace(ns); err != nil {
+				started <- fmt.Errorf("failed to enter %s namespace: %v", nsType, err)
+				return
+			}
 		}
+		started <- command.Start()
 	}()
-
-	return setns(uintptr(fd), 0)
+	return <-started
 }
 
-// ==================
-// 3. Cgroup资源管理
-// ==================
-
-// CgroupManager Cgroup管理器
-type CgroupManager struct {
-	cgroups     map[string]*Cgroup
-	controllers map[string]*CgroupController
-	version     int
-	mountPoint  string
-	mutex       sync.RWMutex
+// lookupImageLocked 按镜像ID或RepoTag查找镜像，调用方必须持有cr.mutex
+func (cr *ContainerRuntime) lookupImageLocked(ref string) (*ContainerImage, bool) {
+	if image, exists := cr.images[ref]; exists {
+		return image, true
+	}
+	for _, image := range cr.images {
+		for _, tag := range image.RepoTags {
+			if tag == ref {
+				return image, true
+			}
+		}
+	}
+	return nil, false
 }
 
-// Cgroup 控制组
-type Cgroup struct {
-	Subsystem   string
-	Path        string
-	Controllers []string
-	Processes   []int
-	Limits      map[string]interface{}
-	Stats       map[string]interface{}
-	CreatedAt   time.Time
-}
+// applyImageDefaults 以镜像配置补全容器配置：未指定命令时使用镜像的Entrypoint/Cmd，
+// 镜像环境变量排在容器环境变量之前，工作目录和用户缺省时沿用镜像设置
+func applyImageDefaults(config *ContainerConfig, image *ContainerImage) *ContainerConfig {
+	merged := *config
+	if image.Config == nil {
+		return &merged
+	}
 
-// CgroupController Cgroup控制器
-type CgroupController struct {
-	Name       string
-	MountPoint string
-	Hierarchy  int
-	NumCgroups int
-	Enabled    bool
-	Subsystems []string
+	if len(merged.Entrypoint) == 0 && len(merged.Cmd) == 0 {
+		merged.Entrypoint = image.Config.Entrypoint
+		merged.Cmd = image.Config.Cmd
+	}
+	merged.Env = append(imageEnv(image), config.Env...)
+	if merged.WorkingDir == "" {
+		merged.WorkingDir = image.Config.WorkingDir
+	}
+	// 只指定组（如":grp"）时沿用镜像默认的用户，而不是退回到root
+	if merged.User == "" {
+		merged.User = image.Config.User
+	} else if strings.HasPrefix(merged.User, ":") {
+		imageUser, _, _ := strings.Cut(image.Config.User, ":")
+		merged.User = imageUser + merged.User
+	}
+	return &merged
 }
 
-func NewCgroupManager() *CgroupManager {
-	return &CgroupManager{
-		cgroups:     make(map[string]*Cgroup),
-		controllers: make(map[string]*CgroupController),
-		version:     2, // 默认使用cgroup v2
-		mountPoint:  "/sys/fs/cgroup",
+// imageEnv 返回镜像环境变量的副本
+func imageEnv(image *ContainerImage) []string {
+	if image == nil || image.Config == nil {
+		return nil
 	}
+	return append([]string(nil), image.Config.Env...)
 }
 
-func (cm *CgroupManager) CreateCgroup(subsystem, containerID string) (*Cgroup, error) {
-	cm.mutex.Lock()
-	defer cm.mutex.Unlock()
-
-	cgroupPath := filepath.Join(cm.mountPoint, subsystem, "docker", containerID)
-
-	// 创建cgroup目录
-	// #nosec G301 -- Linux cgroup系统目录，需要0755权限支持内核cgroup子系统访问
-	if err := os.MkdirAll(cgroupPath, 0755); err != nil {
-		return nil, err
-	}
+func (cr *ContainerRuntime) createNamespaces(container *Container) error {
+	// 创建各种命名空间
+	namespaces := []string{"pid", "net", "ipc", "uts", "mnt", "user"}
 
-	cgroup := &Cgroup{
-		Subsystem: subsystem,
-		Path:      cgroupPath,
-		Processes: make([]int, 0),
-		Limits:    make(map[string]interface{}),
-		Stats:     make(map[string]interface{}),
-		CreatedAt: time.Now(),
+	for _, nsType := range namespaces {
+		ns, err := cr.namespaces.CreateNamespace(nsType, container.ID)
+		if err != nil {
+			return fmt.Errorf("failed to create %s namespace: %v", nsType, err)
+		}
+		container.Namespaces[nsType] = ns
 	}
 
-	cgroupID := fmt.Sprintf("%s-%s", subsystem, containerID)
-	cm.cgroups[cgroupID] = cgroup
-
-	fmt.Printf("创建Cgroup: %s (子系统: %s)\n", cgroupID, subsystem)
-	return cgroup, nil
+	return nil
 }
 
-func (cm *CgroupManager) DestroyCgroup(cgroup *Cgroup) error {
-	cm.mutex.Lock()
-	defer cm.mutex.Unlock()
+func (cr *ContainerRuntime) createCgroups(container *Container) error {
+	// 创建cgroup层次结构
+	subsystems := []string{"memory", "cpu", "cpuset", "blkio", "net_cls", "freezer", "pids"}
 
-	// 移除所有进程
-	if err := cm.removeAllProcesses(cgroup); err != nil {
-		return err
+	// 容器未指定时使用运行时的默认进程数上限
+	pidsLimit := container.Config.PidsLimit
+	if pidsLimit < 0 {
+		return fmt.Errorf("invalid pids limit: %d", pidsLimit)
 	}
-
-	// 删除cgroup目录
-	if err := os.Remove(cgroup.Path); err != nil {
-		return err
+	if pidsLimit == 0 {
+		pidsLimit = cr.config.PidsLimit
 	}
 
-	fmt.Printf("销毁Cgroup: %s\n", cgroup.Path)
+	// cgroup v2统一层级中每个容器只有一个cgroup，所有子系统共用
+	if cr.cgroups.version == 2 {
+		cgroup, err := cr.cgroups.CreateUnifiedCgroup(container.ID)
+		if err != nil {
+			return fmt.Errorf("failed to create cgroup: %v", err)
+		}
+		for _, subsystem := range subsystems {
+			container.Cgroups[subsystem] = cgroup
+		}
+	} else {
+		for _, subsystem := range subsystems {
+			cgroup, err := cr.cgroups.CreateCgroup(subsystem, container.ID)
+			if err != nil {
+				return fmt.Errorf("failed to create %s cgroup: %v", subsystem, err)
+			}
+			container.Cgroups[subsystem] = cgroup
+		}
+	}
+
+	if pidsLimit > 0 {
+		if err := cr.cgroups.SetPidsLimit(container.Cgroups["pids"], pidsLimit); err != nil {
+			return fmt.Errorf("failed to set pids limit: %v", err)
+		}
+	}
 	return nil
 }
 
-func (cm *CgroupManager) AddProcess(cgroup *Cgroup, pid int) error {
-	cgroup.Processes = append(cgroup.Processes, pid)
+func (cr *ContainerRuntime) prepareFilesystem(container *Container) (err error) {
+	// 创建容器根目录
+	containerRoot := filepath.Join(cr.config.RootDirectory, "containers", container.ID)
+	// #nosec G301 -- Linux容器标准目录权限0755，需要可执行位支持目录访问
+	if err := os.MkdirAll(containerRoot, 0755); err != nil {
+		return err
+	}
 
-	// 将进程ID写入cgroup.procs文件（cgroup系统接口）
-	procsFile := filepath.Join(cgroup.Path, "cgroup.procs")
-	return security.SecureWriteFile(procsFile, []byte(strconv.Itoa(pid)), &security.SecureFileOptions{
-		Mode:      security.DefaultFileMode,
-		CreateDir: false,
-	})
+	// 准备镜像层
+	layerPath := filepath.Join(containerRoot, "layer")
+	if err := cr.storage.PrepareLayer(container.Image, layerPath); err != nil {
+		return err
+	}
+	// 后续步骤失败时容器不会被创建，也就不会经由cleanupContainer释放层引用
+	defer func() {
+		if err == nil {
+			return
+		}
+		if releaseErr := cr.storage.ReleaseLayers(container.Image.Layers); releaseErr != nil {
+			log.Printf("Warning: failed to release layers: %v", releaseErr)
+		}
+	}()
+
+	// 创建读写层
+	rwLayer := filepath.Join(containerRoot, "rw")
+	// #nosec G301 -- Linux容器文件系统层，需要0755权限支持overlay文件系统挂载
+	if err := os.MkdirAll(rwLayer, 0755); err != nil {
+		return err
+	}
+
+	// 创建合并挂载点
+	mergedPath := filepath.Join(containerRoot, "merged")
+	// #nosec G301 -- overlay文件系统挂载点，需要0755权限支持容器根文件系统访问
+	if err := os.MkdirAll(mergedPath, 0755); err != nil {
+		return err
+	}
+
+	// 挂载文件系统。只读根文件系统把镜像层只读绑定挂载到合并挂载点，由内核拒绝写入，
+	// 挂载失败时不创建容器；需要可写的/tmp等目录时配合Tmpfs使用
+	mount := &Mount{
+		Source:      layerPath,
+		Target:      mergedPath,
+		Type:        "overlay",
+		Options:     fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s/work", layerPath, rwLayer, containerRoot),
+		Propagation: "private",
+	}
+	if readOnlyRootfs(container.SecurityContext) {
+		// 只读挂载之后无法再创建tmpfs挂载点，先在镜像层副本中创建
+		mountPoints, err := tmpfsMounts(layerPath, container.Config.Tmpfs)
+		if err != nil {
+			return err
+		}
+		// #nosec G301 -- 没有层的镜像也需要作为挂载源的根目录
+		if err := os.MkdirAll(layerPath, 0755); err != nil {
+			return err
+		}
+		for _, mountPoint := range mountPoints {
+			// #nosec G301 -- 容器内挂载点，需要0755权限
+			if err := os.MkdirAll(mountPoint.Target, 0755); err != nil {
+				return err
+			}
+		}
+
+		mount = &Mount{Source: layerPath, Target: mergedPath, Type: "bind", Options: "bind,ro", Propagation: "private"}
+		if err := mountBind(mount); err != nil {
+			return fmt.Errorf("failed to mount read-only root filesystem: %v", err)
+		}
+		defer func() {
+			if err == nil {
+				return
+			}
+			if unmountErr := unmountBind(mergedPath); unmountErr != nil {
+				log.Printf("Warning: failed to unmount %s: %v", mergedPath, unmountErr)
+			}
+		}()
+	}
+
+	container.Mounts = append(container.Mounts, mount)
+
+	// 挂载tmpfs，任一挂载失败时卸载已挂载的部分
+	tmpfs, err := tmpfsMounts(mergedPath, container.Config.Tmpfs)
+	if err != nil {
+		return err
+	}
+	for i, tmpfsMount := range tmpfs {
+		if err := mountTmpfs(tmpfsMount); err != nil {
+			for _, mounted := range tmpfs[:i] {
+				if err := unmountTmpfs(mounted.Target); err != nil {
+					log.Printf("Warning: failed to unmount %s: %v", mounted.Target, err)
+				}
+			}
+			return fmt.Errorf("failed to mount tmpfs at %s: %v", tmpfsMount.Target, err)
+		}
+	}
+	container.Mounts = append(container.Mounts, tmpfs...)
+	return nil
 }
 
-func (cm *CgroupManager) SetMemoryLimit(cgroup *Cgroup, limit int64) error {
-	cgroup.Limits["memory"] = limit
+// readOnlyRootfs 判断安全上下文是否要求只读根文件系统
+func readOnlyRootfs(sc *SecurityContext) bool {
+	return sc != nil && sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem
+}
 
-	limitFile := filepath.Join(cgroup.Path, "memory.max")
-	return security.SecureWriteFile(limitFile, []byte(strconv.FormatInt(limit, 10)), &security.SecureFileOptions{
-		Mode:      security.DefaultFileMode,
-		CreateDir: false,
-	})
+// tmpfs和绑定挂载的挂载与卸载，测试中可替换
+var (
+	mountTmpfs   = mountFilesystem
+	unmountTmpfs = unmountFilesystem
+	mountBind    = bindMountFilesystem
+	unmountBind  = unmountFilesystem
+)
+
+// tmpfs挂载标志选项及其相反选项
+var tmpfsFlagOptions = map[string]string{
+	"ro": "rw", "rw": "ro",
+	"exec": "noexec", "noexec": "exec",
+	"suid": "nosuid", "nosuid": "suid",
+	"dev": "nodev", "nodev": "dev",
+	"atime": "noatime", "noatime": "atime",
+	"sync": "async", "async": "sync",
 }
 
-func (cm *CgroupManager) SetCPUQuota(cgroup *Cgroup, quota int64, period int64) error {
-	cgroup.Limits["cpu_quota"] = quota
-	cgroup.Limits["cpu_period"] = period
+// 未显式指定时与Docker一样默认加上noexec、nosuid、nodev
+var defaultTmpfsFlags = []string{"noexec", "nosuid", "nodev"}
 
-	quotaFile := filepath.Join(cgroup.Path, "cpu.max")
-	quotaValue := fmt.Sprintf("%d %d", quota, period)
-	return security.SecureWriteFile(quotaFile, []byte(quotaValue), &security.SecureFileOptions{
-		Mode:      security.DefaultFileMode,
-		CreateDir: false,
-	})
+// tmpfsMounts 为Tmpfs配置生成挂载项，按路径排序保证父目录先于子目录挂载
+func tmpfsMounts(rootfs string, tmpfs map[string]string) ([]*Mount, error) {
+	targets := make([]string, 0, len(tmpfs))
+	for target := range tmpfs {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	mounts := make([]*Mount, 0, len(targets))
+	for _, target := range targets {
+		if !path.IsAbs(target) || path.Clean(target) == "/" {
+			return nil, fmt.Errorf("invalid tmpfs target %q: must be an absolute path below /", target)
+		}
+		for _, part := range strings.Split(target, "/") {
+			if part == ".." {
+				return nil, fmt.Errorf("invalid tmpfs target %q: must not contain ..", target)
+			}
+		}
+		// 按容器视角解析符号链接，镜像中的/tmp -> /etc不会让tmpfs挂到宿主机路径上
+		hostPath, err := resolveContainerPath(rootfs, path.Clean(target), true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tmpfs target %q: %v", target, err)
+		}
+
+		options, err := parseTmpfsOptions(tmpfs[target])
+		if err != nil {
+			return nil, fmt.Errorf("invalid tmpfs options for %s: %v", target, err)
+		}
+		mounts = append(mounts, &Mount{
+			Source:      "tmpfs",
+			Target:      hostPath,
+			Type:        "tmpfs",
+			Options:     options,
+			Propagation: "private",
+		})
+	}
+	return mounts, nil
 }
 
-func (cm *CgroupManager) GetStats(cgroup *Cgroup) (map[string]interface{}, error) {
-	stats := make(map[string]interface{})
+// parseTmpfsOptions 校验并规范化tmpfs选项，返回标志在前、键值选项在后的选项字符串
+func parseTmpfsOptions(options string) (string, error) {
+	var flags, data []string
+	seen := make(map[string]bool)
+	for _, option := range strings.Split(options, ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
 
-	// 读取内存统计
-	memStatFile := filepath.Join(cgroup.Path, "memory.stat")
-	// #nosec G304 -- cgroup.Path由CgroupManager管理，memory.stat是Linux内核标准cgroup文件，系统编程操作安全
-	if data, err := os.ReadFile(memStatFile); err == nil {
-		memStats := cm.parseMemoryStats(string(data))
-		stats["memory"] = memStats
+		if opposite, ok := tmpfsFlagOptions[option]; ok {
+			if seen[opposite] {
+				return "", fmt.Errorf("conflicting options %s and %s", option, opposite)
+			}
+			if !seen[option] {
+				flags = append(flags, option)
+				seen[option] = true
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(option, "=")
+		if !ok || value == "" {
+			return "", fmt.Errorf("unknown option %q", option)
+		}
+		if seen[key] {
+			return "", fmt.Errorf("duplicate option %q", key)
+		}
+		seen[key] = true
+		if err := validateTmpfsValue(key, value); err != nil {
+			return "", err
+		}
+		data = append(data, option)
 	}
 
-	// 读取CPU统计
-	cpuStatFile := filepath.Join(cgroup.Path, "cpu.stat")
-	// #nosec G304 -- cgroup.Path由CgroupManager管理，cpu.stat是Linux内核标准cgroup文件，系统编程操作安全
-	if data, err := os.ReadFile(cpuStatFile); err == nil {
-		cpuStats := cm.parseCPUStats(string(data))
-		stats["cpu"] = cpuStats
+	for _, flag := range defaultTmpfsFlags {
+		if !seen[flag] && !seen[tmpfsFlagOptions[flag]] {
+			flags = append(flags, flag)
+		}
 	}
+	return strings.Join(append(flags, data...), ","), nil
+}
 
-	cgroup.Stats = stats
-	return stats, nil
+// validateTmpfsValue 校验tmpfs的键值选项
+func validateTmpfsValue(key, value string) error {
+	switch key {
+	case "size", "nr_blocks", "nr_inodes":
+		number := strings.ToLower(value)
+		if key == "size" && strings.HasSuffix(number, "%") {
+			number = strings.TrimSuffix(number, "%")
+		} else if strings.HasSuffix(number, "k") || strings.HasSuffix(number, "m") || strings.HasSuffix(number, "g") {
+			number = number[:len(number)-1]
+		}
+		if _, err := strconv.ParseUint(number, 10, 64); err != nil {
+			return fmt.Errorf("invalid %s %q", key, value)
+		}
+	case "mode":
+		if mode, err := strconv.ParseUint(value, 8, 32); err != nil || mode > 07777 {
+			return fmt.Errorf("invalid mode %q: must be octal permission bits", value)
+		}
+	case "uid", "gid":
+		if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+			return fmt.Errorf("invalid %s %q", key, value)
+		}
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
 }
 
-func (cm *CgroupManager) parseMemoryStats(data string) map[string]int64 {
-	stats := make(map[string]int64)
-	lines := strings.Split(data, "\n")
+func (cr *ContainerRuntime) startContainerProcess(ctx context.Context, container *Container, bindProcess bool) (*ContainerProcess, error) {
+	// 默认情况下容器进程的生命周期独立于调用方的ctx
+	processCtx := context.WithoutCancel(ctx)
+	if bindProcess {
+		processCtx = ctx
+	}
 
-	for _, line := range lines {
-		if line == "" {
-			continue
+	// 构建命令
+	var cmd *exec.Cmd
+	if len(container.Config.Entrypoint) > 0 {
+		// G204安全修复：验证可执行文件路径
+		if err := validateExecutablePath(container.Config.Entrypoint[0]); err != nil {
+			return nil, fmt.Errorf("无效的容器入口点: %v", err)
 		}
-		parts := strings.Fields(line)
-		if len(parts) == 2 {
-			if value, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
-				stats[parts[0]] = value
+		args := append(container.Config.Entrypoint, container.Config.Cmd...)
+		// #nosec G204 - 命令已通过validateExecutablePath白名单验证
+		cmd = exec.CommandContext(processCtx, args[0], args[1:]...)
+	} else if len(container.Config.Cmd) > 0 {
+		// G204安全修复：验证可执行文件路径
+		if err := validateExecutablePath(container.Config.Cmd[0]); err != nil {
+			return nil, fmt.Errorf("无效的容器命令: %v", err)
+		}
+		// #nosec G204 - 命令已通过validateExecutablePath白名单验证
+		cmd = exec.CommandContext(processCtx, container.Config.Cmd[0], container.Config.Cmd[1:]...)
+	} else {
+		return nil, fmt.Errorf("no command specified")
+	}
+
+	// 设置环境变量
+	cmd.Env = container.Config.Env
+
+	// 设置工作目录
+	if container.Config.WorkingDir != "" {
+		cmd.Dir = container.Config.WorkingDir
+	}
+
+	// 配置命名空间 (Windows下禁用)
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+
+	// 在chroot中运行时，可执行文件按容器内的PATH在根目录下查找，而不是使用宿主机上的同名程序
+	rootfs := cr.containerRootfs(container)
+	if container.chroot != "" {
+		rootfs = container.chroot
+		program, err := lookPathInRootfs(rootfs, cmd.Args[0], cmd.Env)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Path, cmd.Err = program, nil
+		if err := applyRootfs(cmd.SysProcAttr, rootfs); err != nil {
+			return nil, err
+		}
+	}
+
+	// 解析并应用容器用户
+	user, err := resolveContainerUser(rootfs, container.Config.User, container.SecurityContext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve container user: %v", err)
+	}
+	if user != nil {
+		applyContainerUser(cmd.SysProcAttr, user)
+	}
+	// seccomp过滤器由容器init在execve之前安装，需在chroot和用户设置完成之后附加
+	if container.SecurityContext != nil {
+		if err := cr.seccomp.applyContainerProfile(container.ID, container.SecurityContext.SeccompProfile, cmd); err != nil {
+			return nil, err
+		}
+	}
+	// Cloneflags: syscallCLONE_NEWNS | syscallCLONE_NEWPID | syscallCLONE_NEWNET |
+	// 	syscallCLONE_NEWIPC | syscallCLONE_NEWUTS,
+	// Unshareflags: syscallCLONE_NEWNS,
+
+	// 设置标准输入输出
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// 标准输出和错误输出交给日志缓冲区持续读取，避免管道写满阻塞容器进程
+	logs := cr.containerLogs(container)
+	if err := logs.open(); err != nil {
+		return nil, fmt.Errorf("failed to open container log: %v", err)
+	}
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		logs.close()
+		return nil, err
+	}
+	stderr, stderrWriter, err := os.Pipe()
+	if err != nil {
+		logs.close()
+		closeAll(stdout, stdoutWriter)
+		return nil, err
+	}
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	// 启动进程，准备阶段耗时较长时在此处响应取消
+	if err := ctx.Err(); err != nil {
+		logs.close()
+		closeAll(stdout, stdoutWriter, stderr, stderrWriter)
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		logs.close()
+		closeAll(stdout, stdoutWriter, stderr, stderrWriter)
+		return nil, err
+	}
+	// 写端已由子进程继承，父进程关闭后读端才能在进程退出时读到EOF
+	closeAll(stdoutWriter, stderrWriter)
+	drained := logs.capture(stdout, stderr)
+
+	process := &ContainerProcess{
+		Pid:     cmd.Process.Pid,
+		Args:    cmd.Args,
+		Env:     cmd.Env,
+		Cwd:     cmd.Dir,
+		Stdin:   stdin,
+		stdout:  stdout,
+		stderr:  stderr,
+		logs:    logs,
+		Wait:    make(chan error, 1),
+		Done:    make(chan struct{}),
+		Exited:  make(chan struct{}),
+		Started: time.Now(),
+	}
+
+	// 异步等待进程结束
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			if exitError, ok := err.(*exec.ExitError); ok {
+				process.ExitCode = exitError.ExitCode()
 			}
 		}
+		// 等待日志读取完毕；后台子进程仍持有管道时超时强制关闭，保证读取协程随容器退出
+		select {
+		case <-drained:
+		case <-time.After(logDrainTimeout):
+			closeAll(stdout, stderr)
+			<-drained
+		}
+		process.Wait <- err
+		close(process.Done)
+	}()
+
+	return process, nil
+}
+
+// Stdout 订阅进程此后的标准输出，进程停止输出或调用方关闭读取端时结束。
+// 每次调用返回独立的读取端，互不影响，也不与运行时的日志读取竞争
+func (p *ContainerProcess) Stdout() (io.ReadCloser, error) {
+	return p.logs.subscribe("stdout")
+}
+
+// Stderr 订阅进程此后的标准错误输出，语义与Stdout相同
+func (p *ContainerProcess) Stderr() (io.ReadCloser, error) {
+	return p.logs.subscribe("stderr")
+}
+
+// closeAll 关闭一组文件，忽略已关闭等错误
+func closeAll(files ...*os.File) {
+	for _, file := range files {
+		_ = file.Close()
+	}
+}
+
+// LogOptions 读取容器日志的选项
+type LogOptions struct {
+	Follow     bool      // 持续输出新日志，直到容器退出或读取方关闭
+	Tail       int       // 只输出最后N行，0表示全部
+	Since      time.Time // 只输出该时间之后的日志
+	Timestamps bool      // 在每行前加上时间戳
+}
+
+// logEntry 日志文件中的一行，格式与Docker的json-file日志驱动一致
+type logEntry struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+const (
+	containerLogFile = "container.log"
+	logDrainTimeout  = 2 * time.Second
+)
+
+// containerLog 容器的日志缓冲区，持续读取进程输出并追加到容器根目录下的日志文件
+type containerLog struct {
+	path    string
+	mutex   sync.Mutex
+	file    *os.File      // 容器输出期间打开，输出结束后关闭
+	updated chan struct{} // 有新日志或输出结束时关闭并替换，用于唤醒Follow读取方
+}
+
+// containerLogs 返回容器的日志缓冲区，首次调用时创建
+func (cr *ContainerRuntime) containerLogs(container *Container) *containerLog {
+	container.stateMutex.Lock()
+	defer container.stateMutex.Unlock()
+	if container.logs == nil {
+		container.logs = &containerLog{
+			path:    filepath.Join(cr.config.RootDirectory, "containers", container.ID, containerLogFile),
+			updated: make(chan struct{}),
+		}
+	}
+	return container.logs
+}
+
+// open 打开日志文件准备追加，重启容器时日志接在之前的内容之后
+func (l *containerLog) open() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file != nil {
+		return nil
+	}
+	// #nosec G301 -- 容器根目录，与prepareFilesystem保持一致
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	l.file = file
+	return nil
+}
+
+// close 关闭日志文件并唤醒Follow读取方
+func (l *containerLog) close() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			log.Printf("Warning: failed to close container log: %v", err)
+		}
+		l.file = nil
+	}
+	l.notifyLocked()
+}
+
+func (l *containerLog) notifyLocked() {
+	close(l.updated)
+	l.updated = make(chan struct{})
+}
+
+// capture 为标准输出和错误输出各启动一个读取协程，两者都结束后关闭日志文件并关闭返回的通道
+func (l *containerLog) capture(stdout, stderr io.ReadCloser) <-chan struct{} {
+	var readers sync.WaitGroup
+	read := func(stream string, r io.ReadCloser) {
+		defer readers.Done()
+		defer r.Close()
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadString('\n')
+			if line != "" {
+				l.write(stream, line)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	readers.Add(2)
+	go read("stdout", stdout)
+	go read("stderr", stderr)
+
+	drained := make(chan struct{})
+	go func() {
+		readers.Wait()
+		l.close()
+		close(drained)
+	}()
+	return drained
+}
+
+// write 为一行输出加上时间戳后追加到日志文件
+func (l *containerLog) write(stream, line string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return
+	}
+	data, err := json.Marshal(logEntry{Log: line, Stream: stream, Time: time.Now().UTC()})
+	if err != nil {
+		log.Printf("Warning: failed to encode container log: %v", err)
+		return
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		log.Printf("Warning: failed to write container log: %v", err)
+	}
+	l.notifyLocked()
+}
+
+// readFrom 读取offset之后的日志，返回新的偏移量、容器是否仍在输出以及下一次更新的通知通道
+func (l *containerLog) readFrom(offset int64) ([]logEntry, int64, bool, <-chan struct{}, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	running, updated := l.file != nil, l.updated
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil, offset, running, updated, nil
+	}
+	if err != nil {
+		return nil, offset, running, updated, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, running, updated, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, offset, running, updated, err
+	}
+
+	var entries []logEntry
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry logEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, offset, running, updated, fmt.Errorf("corrupt container log: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, offset + int64(len(data)), running, updated, nil
+}
+
+// logReader Logs返回的读取端，关闭时通知写入协程退出
+type logReader struct {
+	*io.PipeReader
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (r *logReader) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return r.PipeReader.Close()
+}
+
+// Logs 返回容器日志。Follow模式下持续输出新日志，直到容器退出或调用方关闭读取端
+func (cr *ContainerRuntime) Logs(containerID string, opts LogOptions) (io.ReadCloser, error) {
+	cr.mutex.RLock()
+	container, exists := cr.containers[containerID]
+	cr.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("container not found: %s", containerID)
+	}
+	if opts.Tail < 0 {
+		return nil, fmt.Errorf("invalid tail value: %d", opts.Tail)
+	}
+
+	logs := cr.containerLogs(container)
+	entries, offset, running, updated, err := logs.readFrom(0)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.Since.IsZero() {
+		filtered := entries[:0]
+		for _, entry := range entries {
+			if entry.Time.After(opts.Since) {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+	if opts.Tail > 0 && len(entries) > opts.Tail {
+		entries = entries[len(entries)-opts.Tail:]
+	}
+
+	return logs.stream(entries, offset, running, updated, opts.Follow, func(entry logEntry) string {
+		if opts.Timestamps {
+			return entry.Time.Format(time.RFC3339Nano) + " " + entry.Log
+		}
+		return entry.Log
+	}), nil
+}
+
+// subscribe 只读订阅此后追加的某一路输出（stdout或stderr），容器停止输出或调用方关闭读取端时结束
+func (l *containerLog) subscribe(stream string) (io.ReadCloser, error) {
+	_, offset, running, updated, err := l.readFrom(0)
+	if err != nil {
+		return nil, err
+	}
+	return l.stream(nil, offset, running, updated, true, func(entry logEntry) string {
+		if entry.Stream != stream {
+			return ""
+		}
+		return entry.Log
+	}), nil
+}
+
+// stream 将entries经format转换后写入返回的读取端，format返回空串的条目被跳过。
+// follow为true时继续输出offset之后追加的日志，直到容器停止输出或调用方关闭读取端
+func (l *containerLog) stream(entries []logEntry, offset int64, running bool, updated <-chan struct{}, follow bool, format func(logEntry) string) io.ReadCloser {
+	pipeReader, pipeWriter := io.Pipe()
+	reader := &logReader{PipeReader: pipeReader, closed: make(chan struct{})}
+	go func() {
+		var err error
+		for {
+			for _, entry := range entries {
+				line := format(entry)
+				if line == "" {
+					continue
+				}
+				if _, err := io.WriteString(pipeWriter, line); err != nil {
+					return
+				}
+			}
+			if !follow || !running {
+				pipeWriter.Close()
+				return
+			}
+
+			select {
+			case <-updated:
+			case <-reader.closed:
+				return
+			}
+			if entries, offset, running, updated, err = l.readFrom(offset); err != nil {
+				pipeWriter.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return reader
+}
+
+// copyTargetRootfs 返回可供复制的容器根文件系统路径
+func (cr *ContainerRuntime) copyTargetRootfs(containerID string) (*Container, string, error) {
+	cr.mutex.RLock()
+	container, exists := cr.containers[containerID]
+	cr.mutex.RUnlock()
+
+	if !exists {
+		return nil, "", fmt.Errorf("container not found: %s", containerID)
+	}
+
+	rootfs := cr.containerRootfs(container)
+	if info, err := os.Stat(rootfs); err != nil || !info.IsDir() {
+		return nil, "", fmt.Errorf("container filesystem not available: %s", containerID)
+	}
+	return container, rootfs, nil
+}
+
+// CopyToContainer 将宿主机上的文件或目录复制到容器内destPath。
+// destPath为已存在的目录时复制到其下同名位置；目录以tar流的形式写入，保留文件权限
+func (cr *ContainerRuntime) CopyToContainer(containerID, srcPath, destPath string) error {
+	container, rootfs, err := cr.copyTargetRootfs(containerID)
+	if err != nil {
+		return err
+	}
+	if readOnlyRootfs(container.SecurityContext) {
+		return fmt.Errorf("container rootfs is read-only: %s", containerID)
+	}
+
+	srcInfo, err := os.Lstat(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat source: %v", err)
+	}
+
+	dest := filepath.ToSlash(destPath)
+	target, err := resolveContainerPath(rootfs, dest, true)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		dest = path.Join(dest, filepath.Base(srcPath))
+		if target, err = resolveContainerPath(rootfs, dest, srcInfo.Mode()&os.ModeSymlink == 0); err != nil {
+			return err
+		}
+	}
+	if info, err := os.Stat(filepath.Dir(target)); err != nil || !info.IsDir() {
+		return fmt.Errorf("destination directory does not exist: %s", path.Dir(dest))
+	}
+
+	switch {
+	case srcInfo.IsDir():
+		if err := os.MkdirAll(target, srcInfo.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chmod(target, srcInfo.Mode().Perm()); err != nil {
+			return err
+		}
+
+		pipeReader, pipeWriter := io.Pipe()
+		go func() {
+			pipeWriter.CloseWithError(writeTreeTar(pipeWriter, srcPath, ""))
+		}()
+		err := extractTar(pipeReader, func(header *tar.Header) (string, error) {
+			// 每个条目都在容器根下重新解析，防止经由容器内符号链接写到宿主机
+			return resolveContainerPath(rootfs, path.Join(dest, header.Name), header.Typeflag != tar.TypeSymlink)
+		})
+		pipeReader.CloseWithError(err)
+		if err != nil {
+			return fmt.Errorf("failed to copy directory: %v", err)
+		}
+		return os.Chtimes(target, srcInfo.ModTime(), srcInfo.ModTime())
+	case srcInfo.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(srcPath)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	case srcInfo.Mode().IsRegular():
+		return copyFileWithMode(srcPath, target, srcInfo)
+	default:
+		return fmt.Errorf("unsupported file type: %s", srcPath)
+	}
+}
+
+// CopyFromContainer 以tar流的形式返回容器内srcPath处的文件或目录，条目以其基本名为前缀
+func (cr *ContainerRuntime) CopyFromContainer(containerID, srcPath string) (io.ReadCloser, error) {
+	_, rootfs, err := cr.copyTargetRootfs(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := resolveContainerPath(rootfs, filepath.ToSlash(srcPath), false)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(source); err != nil {
+		return nil, fmt.Errorf("path not found in container: %s", srcPath)
+	}
+
+	prefix := path.Base(path.Clean("/" + filepath.ToSlash(srcPath)))
+	if prefix == "/" {
+		prefix = ""
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		pipeWriter.CloseWithError(writeTreeTar(pipeWriter, source, prefix))
+	}()
+	return pipeReader, nil
+}
+
+// resolveContainerPath 将容器内路径解析为宿主机上rootfs下的路径。
+// 路径中的..越过容器根目录时返回错误；符号链接按容器视角逐级解析，结果不会越出rootfs。
+// followFinal为false时不跟随最后一级符号链接
+func resolveContainerPath(rootfs, containerPath string, followFinal bool) (string, error) {
+	depth := 0
+	for _, part := range strings.Split(containerPath, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if depth--; depth < 0 {
+				return "", fmt.Errorf("path escapes container root: %s", containerPath)
+			}
+		default:
+			depth++
+		}
+	}
+
+	pending := strings.Split(path.Clean("/"+containerPath), "/")
+	resolved := "/"
+	links := 0
+	for len(pending) > 0 {
+		part := pending[0]
+		pending = pending[1:]
+		if part == "" {
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		if len(pending) == 0 && !followFinal {
+			resolved = next
+			break
+		}
+		hostPath := filepath.Join(rootfs, filepath.FromSlash(next))
+		info, err := os.Lstat(hostPath)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if links++; links > 40 {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", containerPath)
+		}
+		link, err := os.Readlink(hostPath)
+		if err != nil {
+			return "", err
+		}
+		if !path.IsAbs(link) {
+			link = path.Join(resolved, link)
+		}
+		// 绝对链接相对于容器根解析，Clean会把越过根目录的..截断在根上
+		pending = append(strings.Split(path.Clean("/"+link), "/"), pending...)
+		resolved = "/"
+	}
+
+	return filepath.Join(rootfs, filepath.FromSlash(resolved)), nil
+}
+
+// copyFileWithMode 复制单个文件，保留权限和修改时间
+func copyFileWithMode(src, dst string, info os.FileInfo) error {
+	if err := copyFile(src, dst, info.Mode()); err != nil {
+		return err
+	}
+	// 目标已存在时OpenFile不会修改其权限
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// ContainerUser 解析后的容器进程用户
+type ContainerUser struct {
+	Uid            uint32
+	Gid            uint32
+	AdditionalGids []uint32
+}
+
+// passwdEntry /etc/passwd中的一条记录
+type passwdEntry struct {
+	Name string
+	Uid  uint32
+	Gid  uint32
+}
+
+// groupEntry /etc/group中的一条记录
+type groupEntry struct {
+	Name    string
+	Gid     uint32
+	Members []string
+}
+
+// containerRootfs 返回容器合并后的根文件系统路径
+func (cr *ContainerRuntime) containerRootfs(container *Container) string {
+	return filepath.Join(cr.config.RootDirectory, "containers", container.ID, "merged")
+}
+
+// resolveContainerUser 解析容器用户。userSpec支持"name"、"uid"、"name:group"、"uid:gid"等形式，
+// 名称从rootfs中的/etc/passwd和/etc/group查找；SecurityContext中的RunAsUser/RunAsGroup优先级更高。
+// 未指定任何用户信息时返回nil，进程沿用运行时自身的身份。
+func resolveContainerUser(rootfs, userSpec string, sc *SecurityContext) (*ContainerUser, error) {
+	hasOverride := sc != nil && (sc.RunAsUser != nil || sc.RunAsGroup != nil || len(sc.SupplementalGroups) > 0)
+	if userSpec == "" && !hasOverride {
+		return nil, nil
+	}
+
+	const passwdPath, groupPath = "/etc/passwd", "/etc/group"
+
+	user := &ContainerUser{}
+	userName := ""
+	userPart, groupPart, _ := strings.Cut(userSpec, ":")
+
+	if userPart != "" {
+		passwd, passwdErr := readPasswdFile(rootfs, passwdPath)
+		if uid, err := strconv.ParseUint(userPart, 10, 32); err == nil {
+			user.Uid = uint32(uid)
+			for _, entry := range passwd {
+				if entry.Uid == user.Uid {
+					user.Gid = entry.Gid
+					userName = entry.Name
+					break
+				}
+			}
+		} else {
+			if passwdErr != nil {
+				return nil, fmt.Errorf("cannot resolve user %q: %v", userPart, passwdErr)
+			}
+			found := false
+			for _, entry := range passwd {
+				if entry.Name == userPart {
+					user.Uid = entry.Uid
+					user.Gid = entry.Gid
+					userName = entry.Name
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("user %q not found in %s", userPart, passwdPath)
+			}
+		}
+	}
+
+	groups, groupErr := readGroupFile(rootfs, groupPath)
+	if groupPart != "" {
+		if gid, err := strconv.ParseUint(groupPart, 10, 32); err == nil {
+			user.Gid = uint32(gid)
+		} else {
+			if groupErr != nil {
+				return nil, fmt.Errorf("cannot resolve group %q: %v", groupPart, groupErr)
+			}
+			found := false
+			for _, entry := range groups {
+				if entry.Name == groupPart {
+					user.Gid = entry.Gid
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("group %q not found in %s", groupPart, groupPath)
+			}
+		}
+	}
+
+	// 用户名出现在成员列表中的组作为附加组
+	if userName != "" {
+		for _, entry := range groups {
+			for _, member := range entry.Members {
+				if member == userName && entry.Gid != user.Gid {
+					user.AdditionalGids = appendUniqueGid(user.AdditionalGids, entry.Gid)
+				}
+			}
+		}
+	}
+
+	if sc != nil {
+		if sc.RunAsUser != nil {
+			uid, err := int64ToID(*sc.RunAsUser)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RunAsUser: %v", err)
+			}
+			user.Uid = uid
+		}
+		if sc.RunAsGroup != nil {
+			gid, err := int64ToID(*sc.RunAsGroup)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RunAsGroup: %v", err)
+			}
+			user.Gid = gid
+		}
+		for _, group := range sc.SupplementalGroups {
+			gid, err := int64ToID(group)
+			if err != nil {
+				return nil, fmt.Errorf("invalid supplemental group: %v", err)
+			}
+			user.AdditionalGids = appendUniqueGid(user.AdditionalGids, gid)
+		}
+		if sc.RunAsNonRoot != nil && *sc.RunAsNonRoot && user.Uid == 0 {
+			return nil, fmt.Errorf("container must run as non-root user but resolved uid is 0")
+		}
+	}
+
+	return user, nil
+}
+
+// readContainerFile 读取容器内的文件。路径在rootfs下按容器视角解析，打开时不跟随最后一级符号链接，
+// 镜像中指向宿主机路径的链接不会让运行时读到宿主机上的文件
+func readContainerFile(rootfs, containerPath string) ([]byte, error) {
+	hostPath, err := resolveContainerPath(rootfs, containerPath, true)
+	if err != nil {
+		return nil, err
+	}
+	// #nosec G304 -- 路径已限定在容器rootfs内
+	file, err := os.OpenFile(hostPath, os.O_RDONLY|openNoFollow, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readLimited(file, maxMetadataSize)
+}
+
+// readPasswdFile 解析容器内passwd格式的文件
+func readPasswdFile(rootfs, path string) ([]passwdEntry, error) {
+	data, err := readContainerFile(rootfs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]passwdEntry, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 4 {
+			continue
+		}
+		uid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		gid, err := strconv.ParseUint(fields[3], 10, 32)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, passwdEntry{Name: fields[0], Uid: uint32(uid), Gid: uint32(gid)})
+	}
+
+	return entries, nil
+}
+
+// readGroupFile 解析容器内group格式的文件
+func readGroupFile(rootfs, path string) ([]groupEntry, error) {
+	data, err := readContainerFile(rootfs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]groupEntry, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 {
+			continue
+		}
+		gid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		entry := groupEntry{Name: fields[0], Gid: uint32(gid)}
+		if len(fields) > 3 && fields[3] != "" {
+			entry.Members = strings.Split(fields[3], ",")
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// int64ToID 将SecurityContext中的int64 ID安全转换为uint32
+func int64ToID(value int64) (uint32, error) {
+	if value < 0 || value > int64(^uint32(0)) {
+		return 0, fmt.Errorf("id %d out of range", value)
+	}
+	return uint32(value), nil
+}
+
+func appendUniqueGid(gids []uint32, gid uint32) []uint32 {
+	for _, existing := range gids {
+		if existing == gid {
+			return gids
+		}
+	}
+	return append(gids, gid)
+}
+
+func (cr *ContainerRuntime) waitForProcess(container *Container, process *ContainerProcess) {
+	err := <-process.Wait
+
+	// 监控循环按周期轮询，进程被OOM终止时在标记退出前再检查一次
+	cr.checkOOM(container)
+
+	container.mutex.Lock()
+
+	exitCode := process.ExitCode
+	restart := !container.stopRequested && shouldRestart(container.Config, err != nil, container.RestartCount)
+	container.setState(func(state *ContainerState) {
+		state.Running = false
+		state.Status = StatusExited
+		state.FinishedAt = time.Now()
+		container.FinishedAt = state.FinishedAt
+
+		if err != nil {
+			state.Error = err.Error()
+			state.ExitCode = exitCode
+			container.ExitCode = exitCode
+		}
+		if restart {
+			state.Status = StatusRestarting
+			state.Restarting = true
+		}
+	})
+
+	close(process.Exited)
+	autoRemove := container.Config.AutoRemove
+	delay := restartBackoff(container.RestartCount)
+	container.mutex.Unlock()
+
+	fmt.Printf("容器进程结束: %s (退出码: %d)\n", container.ID[:12], exitCode)
+
+	// 发送事件
+	cr.eventBus.Publish(&ContainerEvent{
+		Type:      EventContainerDie,
+		Container: container,
+		Timestamp: time.Now(),
+	})
+
+	if restart {
+		cr.restartContainerAfter(container, delay)
+		return
+	}
+
+	// RemoveContainer先获取cr.mutex，必须在释放container.mutex之后调用
+	if autoRemove {
+		cr.autoRemoveContainer(container)
+	}
+}
+
+const defaultRestartMaxRetries = 5
+
+// 重启退避参数，测试中可替换
+var (
+	restartBackoffBase = 100 * time.Millisecond
+	restartBackoffMax  = time.Minute
+)
+
+// shouldRestart 根据重启策略判断退出的容器是否需要重启
+func shouldRestart(config *ContainerConfig, failed bool, restartCount int) bool {
+	switch config.RestartPolicy {
+	case RestartPolicyAlways:
+		return true
+	case RestartPolicyOnFailure:
+		maxRetries := config.MaxRetries
+		if maxRetries <= 0 {
+			maxRetries = defaultRestartMaxRetries
+		}
+		return failed && restartCount < maxRetries
+	default:
+		return false
+	}
+}
+
+// restartBackoff 返回第restartCount+1次重启前的等待时间，每次翻倍，不超过restartBackoffMax
+func restartBackoff(restartCount int) time.Duration {
+	delay := restartBackoffBase
+	for i := 0; i < restartCount && delay < restartBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > restartBackoffMax {
+		delay = restartBackoffMax
+	}
+	return delay
+}
+
+// cancelRestartLocked 取消等待中的重启，调用方必须持有container.mutex。容器不在等待重启时返回false
+func cancelRestartLocked(container *Container) bool {
+	if container.Status() != StatusRestarting {
+		return false
+	}
+	container.setState(func(state *ContainerState) {
+		state.Status = StatusExited
+		state.Restarting = false
+	})
+	return true
+}
+
+// restartContainerAfter 等待退避时间后重新启动容器进程。等待期间容器被停止或删除时放弃重启
+func (cr *ContainerRuntime) restartContainerAfter(container *Container, delay time.Duration) {
+	select {
+	case <-time.After(delay):
+	case <-cr.stopCh:
+		return
+	}
+
+	container.mutex.Lock()
+	defer container.mutex.Unlock()
+
+	if container.Status() != StatusRestarting {
+		return
+	}
+
+	process, err := cr.startContainerProcess(context.Background(), container, false)
+	if err != nil {
+		log.Printf("Warning: failed to restart container %s: %v", container.ID[:12], err)
+		container.setState(func(state *ContainerState) {
+			state.Status = StatusExited
+			state.Restarting = false
+			state.Error = err.Error()
+		})
+		return
+	}
+
+	container.setState(func(state *ContainerState) {
+		container.RestartCount++
+	})
+	cr.attachProcess(container, process)
+
+	fmt.Printf("重启容器: %s (PID: %d, 第%d次)\n", container.ID[:12], process.Pid, container.RestartCount)
+
+	cr.eventBus.Publish(&ContainerEvent{
+		Type:      EventContainerRestart,
+		Container: container,
+		Message:   fmt.Sprintf("restart count %d", container.RestartCount),
+		Timestamp: time.Now(),
+	})
+}
+
+// autoRemoveContainer 删除设置了AutoRemove的已退出容器。容器已被删除或正在重启时跳过
+func (cr *ContainerRuntime) autoRemoveContainer(container *Container) {
+	cr.mutex.RLock()
+	current, exists := cr.containers[container.ID]
+	cr.mutex.RUnlock()
+	if !exists || current != container {
+		return
+	}
+
+	state := container.Snapshot()
+	if state.Restarting || state.Status != StatusExited {
+		return
+	}
+	if err := cr.RemoveContainer(container.ID, false); err != nil {
+		log.Printf("Warning: failed to auto-remove container %s: %v", container.ID[:12], err)
+	}
+}
+
+// reapExitedContainers 删除退出时间早于保留时长的容器，AutoRemove容器由waitForProcess负责
+func (cr *ContainerRuntime) reapExitedContainers(now time.Time) {
+	retention := cr.config.ExitedRetention
+	if retention <= 0 {
+		return
+	}
+
+	var expired []string
+	cr.mutex.RLock()
+	for id, container := range cr.containers {
+		if container.Config != nil && container.Config.AutoRemove {
+			continue
+		}
+		state := container.Snapshot()
+		if state.Status == StatusExited && !state.Restarting && now.Sub(state.FinishedAt) >= retention {
+			expired = append(expired, id)
+		}
+	}
+	cr.mutex.RUnlock()
+
+	// RemoveContainer重新检查运行状态，期间被重新启动的容器不会被删除
+	for _, id := range expired {
+		if err := cr.RemoveContainer(id, false); err != nil {
+			log.Printf("Warning: failed to reap exited container %s: %v", id[:12], err)
+		}
+	}
+}
+
+func (cr *ContainerRuntime) cleanupContainer(container *Container) {
+	// 清理命名空间
+	for _, ns := range container.Namespaces {
+		if err := cr.namespaces.DestroyNamespace(ns); err != nil {
+			log.Printf("Warning: failed to destroy namespace: %v", err)
+		}
+	}
+
+	// 清理Cgroups（cgroup v2下多个子系统共享同一个cgroup，只销毁一次）
+	destroyed := make(map[*Cgroup]bool, len(container.Cgroups))
+	for _, cgroup := range container.Cgroups {
+		if destroyed[cgroup] {
+			continue
+		}
+		destroyed[cgroup] = true
+		if err := cr.cgroups.DestroyCgroup(cgroup); err != nil {
+			log.Printf("Warning: failed to destroy cgroup: %v", err)
+		}
+	}
+
+	// 清理挂载点，按挂载的相反顺序卸载；tmpfs必须在删除根目录前卸载
+	for i := len(container.Mounts) - 1; i >= 0; i-- {
+		mount := container.Mounts[i]
+		unmount := func(target string) error { return windowsUnmount(target, 0) }
+		switch mount.Type {
+		case "tmpfs":
+			unmount = unmountTmpfs
+		case "bind":
+			unmount = unmountBind
+		}
+		if err := unmount(mount.Target); err != nil {
+			log.Printf("Warning: failed to unmount %s: %v", mount.Target, err)
+		}
+	}
+
+	// 清理文件系统
+	containerRoot := filepath.Join(cr.config.RootDirectory, "containers", container.ID)
+	if err := os.RemoveAll(containerRoot); err != nil {
+		log.Printf("Warning: failed to remove container root directory: %v", err)
+	}
+
+	// 释放容器对镜像层的引用，不再被任何镜像或容器引用的层随之删除
+	if container.Image != nil {
+		if err := cr.storage.ReleaseLayers(container.Image.Layers); err != nil {
+			log.Printf("Warning: failed to release image layers: %v", err)
+		}
+	}
+
+	// 清理运行时状态目录（包括注入的ConfigMap/Secret文件）
+	if err := os.RemoveAll(cr.containerStateDir(container)); err != nil {
+		log.Printf("Warning: failed to remove container state directory: %v", err)
+	}
+}
+
+// monitorLoop 监控循环
+func (cr *ContainerRuntime) monitorLoop() {
+	for {
+		select {
+		case <-cr.stopCh:
+			return
+		default:
+			cr.monitorContainers()
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
+
+// monitorContainers 检查所有运行中容器的内存cgroup是否发生了OOM
+func (cr *ContainerRuntime) monitorContainers() {
+	cr.mutex.RLock()
+	running := make([]*Container, 0, len(cr.containers))
+	for _, container := range cr.containers {
+		if container.IsRunning() {
+			running = append(running, container)
+		}
+	}
+	cr.mutex.RUnlock()
+
+	for _, container := range running {
+		cr.checkOOM(container)
+	}
+}
+
+// checkOOM 读取容器内存cgroup的OOM kill计数，计数增加时标记OOMKilled并发布OOM事件
+func (cr *ContainerRuntime) checkOOM(container *Container) bool {
+	cgroup := container.Cgroups["memory"]
+	if cgroup == nil {
+		return false
+	}
+	count, err := cr.cgroups.OOMKillCount(cgroup)
+	if err != nil {
+		return false
+	}
+
+	increased := false
+	container.setState(func(state *ContainerState) {
+		if count > container.oomKills {
+			container.oomKills = count
+			state.OOMKilled = true
+			increased = true
+		}
+	})
+	if !increased {
+		return false
+	}
+
+	fmt.Printf("容器发生OOM: %s (oom_kill: %d)\n", container.ID[:12], count)
+	cr.eventBus.Publish(&ContainerEvent{
+		Type:      EventContainerOOM,
+		Container: container,
+		Message:   fmt.Sprintf("oom_kill count %d", count),
+		Timestamp: time.Now(),
+	})
+	return true
+}
+
+// eventLoop 事件循环
+func (cr *ContainerRuntime) eventLoop() {
+	for {
+		select {
+		case <-cr.stopCh:
+			return
+		default:
+			// 处理容器事件
+			time.Sleep(1 * time.Second)
+		}
+	}
+}
+
+// cleanupLoop 清理循环
+func (cr *ContainerRuntime) cleanupLoop() {
+	for {
+		select {
+		case <-cr.stopCh:
+			return
+		default:
+			// 清理超过保留时长的已退出容器
+			cr.reapExitedContainers(time.Now())
+			time.Sleep(30 * time.Second)
+		}
+	}
+}
+
+// ==================
+// 2. 命名空间管理
+// ==================
+
+// NamespaceManager 命名空间管理器
+type NamespaceManager struct {
+	namespaces map[string]*Namespace
+	mutex      sync.RWMutex
+}
+
+// Namespace 命名空间
+type Namespace struct {
+	Type      string
+	ID        string
+	Path      string
+	Pid       int
+	CreatedAt time.Time
+	RefCount  int32
+}
+
+func NewNamespaceManager() *NamespaceManager {
+	return &NamespaceManager{
+		namespaces: make(map[string]*Namespace),
+	}
+}
+
+func (nm *NamespaceManager) CreateNamespace(nsType, containerID string) (*Namespace, error) {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+
+	nsID := fmt.Sprintf("%s-%s", nsType, containerID)
+
+	ns := &Namespace{
+		Type:      nsType,
+		ID:        nsID,
+		Path:      fmt.Sprintf("/proc/self/ns/%s", nsType),
+		CreatedAt: time.Now(),
+		RefCount:  1,
+	}
+
+	nm.namespaces[nsID] = ns
+	fmt.Printf("创建命名空间: %s (类型: %s)\n", nsID, nsType)
+
+	return ns, nil
+}
+
+func (nm *NamespaceManager) DestroyNamespace(ns *Namespace) error {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+
+	if atomic.AddInt32(&ns.RefCount, -1) <= 0 {
+		delete(nm.namespaces, ns.ID)
+		fmt.Printf("销毁命名空间: %s\n", ns.ID)
+	}
+
+	return nil
+}
+
+// EnterNamespace 让当前线程进入ns，调用方需先锁定OS线程。
+// 目标就是当前线程所在的命名空间时（容器进程没有独立的该类命名空间）无需切换
+func (nm *NamespaceManager) EnterNamespace(ns *Namespace) error {
+	same, err := sameNamespace(ns.Path, ns.Type)
+	if err != nil {
+		return err
+	}
+	if same {
+		return nil
+	}
+
+	fd, err := syscall.Open(ns.Path, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := syscall.Close(fd); err != nil {
+			log.Printf("Warning: failed to close file descriptor: %v", err)
+		}
+	}()
+
+	return setns(uintptr(fd), 0)
+}
+
+// ==================
+// 3. Cgroup资源管理
+// ==================
+
+// CgroupManager Cgroup管理器
+type CgroupManager struct {
+	cgroups     map[string]*Cgroup
+	controllers map[string]*CgroupController
+	version     int
+	mountPoint  string
+	parent      string // 相对于挂载点的父cgroup路径
+	mutex       sync.RWMutex
+}
+
+// defaultCgroupParent 未配置CgroupParent时容器cgroup的父路径
+const defaultCgroupParent = "docker"
+
+// Cgroup 控制组
+type Cgroup struct {
+	Subsystem   string
+	Path        string
+	Controllers []string
+	Processes   []int
+	Limits      map[string]interface{}
+	Stats       map[string]interface{}
+	CreatedAt   time.Time
+}
+
+// CgroupController Cgroup控制器
+type CgroupController struct {
+	Name       string
+	MountPoint string
+	Hierarchy  int
+	NumCgroups int
+	Enabled    bool
+	Subsystems []string
+}
+
+// defaultCgroupMountPoint cgroup文件系统的标准挂载点
+const defaultCgroupMountPoint = "/sys/fs/cgroup"
+
+func NewCgroupManager() *CgroupManager {
+	return newCgroupManager(defaultCgroupMountPoint)
+}
+
+// newCgroupManager 创建使用指定挂载点的管理器，cgroup版本根据挂载点的布局检测
+func newCgroupManager(mountPoint string) *CgroupManager {
+	return &CgroupManager{
+		cgroups:     make(map[string]*Cgroup),
+		controllers: make(map[string]*CgroupController),
+		version:     detectCgroupVersion(mountPoint),
+		mountPoint:  mountPoint,
+		parent:      defaultCgroupParent,
+	}
+}
+
+// detectCgroupVersion 检测cgroup版本。统一层级（v2）的根目录下有cgroup.controllers，
+// 否则按v1处理（包括同时挂载了unified子目录的hybrid模式）。挂载点不存在时默认使用v2
+func detectCgroupVersion(mountPoint string) int {
+	if _, err := os.Stat(filepath.Join(mountPoint, "cgroup.controllers")); err == nil {
+		return 2
+	}
+	if info, err := os.Stat(mountPoint); err == nil && info.IsDir() {
+		return 1
+	}
+	return 2
+}
+
+func (cm *CgroupManager) CreateCgroup(subsystem, containerID string) (*Cgroup, error) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	cgroupPath := filepath.Join(cm.mountPoint, subsystem, cm.parent, containerID)
+
+	// 创建cgroup目录
+	// #nosec G301 -- Linux cgroup系统目录，需要0755权限支持内核cgroup子系统访问
+	if err := os.MkdirAll(cgroupPath, 0755); err != nil {
+		return nil, err
+	}
+
+	cgroup := &Cgroup{
+		Subsystem: subsystem,
+		Path:      cgroupPath,
+		Processes: make([]int, 0),
+		Limits:    make(map[string]interface{}),
+		Stats:     make(map[string]interface{}),
+		CreatedAt: time.Now(),
+	}
+
+	cgroupID := fmt.Sprintf("%s-%s", subsystem, containerID)
+	cm.cgroups[cgroupID] = cgroup
+
+	fmt.Printf("创建Cgroup: %s (子系统: %s)\n", cgroupID, subsystem)
+	return cgroup, nil
+}
+
+func (cm *CgroupManager) DestroyCgroup(cgroup *Cgroup) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	// 移除所有进程
+	if err := cm.removeAllProcesses(cgroup); err != nil {
+		return err
+	}
+
+	// 删除cgroup目录
+	if err := os.Remove(cgroup.Path); err != nil {
+		return err
+	}
+
+	fmt.Printf("销毁Cgroup: %s\n", cgroup.Path)
+	return nil
+}
+
+// AddProcess 将进程加入cgroup。v2写入cgroup.procs，v1写入该控制器层级下的tasks
+func (cm *CgroupManager) AddProcess(cgroup *Cgroup, pid int) error {
+	file := "cgroup.procs"
+	if cm.version == 1 {
+		file = "tasks"
+	}
+	if err := cm.writeCgroupFile(cgroup, file, strconv.Itoa(pid)); err != nil {
+		return err
+	}
+	cgroup.Processes = append(cgroup.Processes, pid)
+	return nil
+}
+
+// SetMemoryLimit 设置内存上限（字节），负数表示不限制
+func (cm *CgroupManager) SetMemoryLimit(cgroup *Cgroup, limit int64) error {
+	if err := cm.checkController(cgroup, "memory"); err != nil {
+		return err
+	}
+
+	var err error
+	if cm.version == 2 {
+		value := strconv.FormatInt(limit, 10)
+		if limit < 0 {
+			value = "max"
+		}
+		err = cm.writeCgroupFile(cgroup, "memory.max", value)
+	} else {
+		err = cm.writeCgroupFile(cgroup, "memory.limit_in_bytes", strconv.FormatInt(limit, 10))
+	}
+	if err != nil {
+		return err
+	}
+	cgroup.Limits["memory"] = limit
+	return nil
+}
+
+// SetCPUQuota 设置每个period微秒内可用的CPU时间（微秒），quota为负数表示不限制
+func (cm *CgroupManager) SetCPUQuota(cgroup *Cgroup, quota int64, period int64) error {
+	if period <= 0 {
+		return fmt.Errorf("invalid cpu period: %d", period)
+	}
+	if err := cm.checkController(cgroup, "cpu"); err != nil {
+		return err
+	}
+
+	if cm.version == 2 {
+		value := fmt.Sprintf("%d %d", quota, period)
+		if quota < 0 {
+			value = fmt.Sprintf("max %d", period)
+		}
+		if err := cm.writeCgroupFile(cgroup, "cpu.max", value); err != nil {
+			return err
+		}
+	} else {
+		// 先写period，否则新quota可能与旧period的组合被内核拒绝
+		if err := cm.writeCgroupFile(cgroup, "cpu.cfs_period_us", strconv.FormatInt(period, 10)); err != nil {
+			return err
+		}
+		if err := cm.writeCgroupFile(cgroup, "cpu.cfs_quota_us", strconv.FormatInt(quota, 10)); err != nil {
+			return err
+		}
+	}
+
+	cgroup.Limits["cpu_quota"] = quota
+	cgroup.Limits["cpu_period"] = period
+	return nil
+}
+
+// SetPidsLimit 设置cgroup内的进程数上限，两个版本都写入pids.max
+func (cm *CgroupManager) SetPidsLimit(cgroup *Cgroup, limit int64) error {
+	if limit <= 0 {
+		return fmt.Errorf("invalid pids limit: %d", limit)
+	}
+	if err := cm.checkController(cgroup, "pids"); err != nil {
+		return err
+	}
+	if err := cm.writeCgroupFile(cgroup, "pids.max", strconv.FormatInt(limit, 10)); err != nil {
+		return err
+	}
+	cgroup.Limits["pids"] = limit
+	return nil
+}
+
+// IOLimit 单个块设备的读写带宽上限（字节/秒），0表示不限制
+type IOLimit struct {
+	ReadBps  uint64
+	WriteBps uint64
+}
+
+// blkio权重范围，v1为blkio.weight，v2为io.weight
+const (
+	blkioWeightMinV1 = 10
+	blkioWeightMaxV1 = 1000
+	ioWeightMinV2    = 1
+	ioWeightMaxV2    = 10000
+)
+
+// SetBlkioWeight 设置块设备IO的相对权重。v1写入blkio.weight（10-1000），v2写入io.weight（1-10000）
+func (cm *CgroupManager) SetBlkioWeight(cgroup *Cgroup, weight uint16) error {
+	if err := cm.checkController(cgroup, "blkio"); err != nil {
+		return err
+	}
+
+	var err error
+	if cm.version == 2 {
+		if weight < ioWeightMinV2 || weight > ioWeightMaxV2 {
+			return fmt.Errorf("io weight %d out of range [%d, %d]", weight, ioWeightMinV2, ioWeightMaxV2)
+		}
+		err = cm.writeCgroupFile(cgroup, "io.weight", fmt.Sprintf("default %d", weight))
+	} else {
+		if weight < blkioWeightMinV1 || weight > blkioWeightMaxV1 {
+			return fmt.Errorf("blkio weight %d out of range [%d, %d]", weight, blkioWeightMinV1, blkioWeightMaxV1)
+		}
+		err = cm.writeCgroupFile(cgroup, "blkio.weight", strconv.Itoa(int(weight)))
+	}
+	if err != nil {
+		return err
+	}
+	cgroup.Limits["blkio_weight"] = weight
+	return nil
+}
+
+// SetIOMax 限制块设备的读写带宽。device为"major:minor"形式的设备号，rbps或wbps为0表示不限制。
+// v1写入blkio.throttle.read_bps_device和write_bps_device，v2写入io.max
+func (cm *CgroupManager) SetIOMax(cgroup *Cgroup, device string, rbps, wbps uint64) error {
+	if err := validateBlockDevice(device); err != nil {
+		return err
+	}
+	if err := cm.checkController(cgroup, "blkio"); err != nil {
+		return err
+	}
+
+	if cm.version == 2 {
+		limit := func(value uint64) string {
+			if value == 0 {
+				return "max"
+			}
+			return strconv.FormatUint(value, 10)
+		}
+		value := fmt.Sprintf("%s rbps=%s wbps=%s", device, limit(rbps), limit(wbps))
+		if err := cm.writeCgroupFile(cgroup, "io.max", value); err != nil {
+			return err
+		}
+	} else {
+		// v1中写入0即删除该设备的限制
+		if err := cm.writeCgroupFile(cgroup, "blkio.throttle.read_bps_device", fmt.Sprintf("%s %d", device, rbps)); err != nil {
+			return err
+		}
+		if err := cm.writeCgroupFile(cgroup, "blkio.throttle.write_bps_device", fmt.Sprintf("%s %d", device, wbps)); err != nil {
+			return err
+		}
+	}
+
+	limits, _ := cgroup.Limits["io_max"].(map[string]IOLimit)
+	if limits == nil {
+		limits = make(map[string]IOLimit)
+		cgroup.Limits["io_max"] = limits
+	}
+	if rbps == 0 && wbps == 0 {
+		delete(limits, device)
+	} else {
+		limits[device] = IOLimit{ReadBps: rbps, WriteBps: wbps}
+	}
+	return nil
+}
+
+// validateBlockDevice 校验"major:minor"形式的块设备号
+func validateBlockDevice(device string) error {
+	major, minor, found := strings.Cut(device, ":")
+	if !found {
+		return fmt.Errorf("invalid block device %q: expected major:minor", device)
+	}
+	for _, number := range []string{major, minor} {
+		if _, err := strconv.ParseUint(number, 10, 32); err != nil {
+			return fmt.Errorf("invalid block device %q: expected major:minor", device)
+		}
+	}
+	return nil
+}
+
+// checkController v1下每个控制器有独立的层级，确认cgroup属于该控制器；v2统一层级无需检查
+func (cm *CgroupManager) checkController(cgroup *Cgroup, controller string) error {
+	if cgroup == nil {
+		return fmt.Errorf("%s cgroup not available", controller)
+	}
+	if cm.version == 1 && cgroup.Subsystem != "" && cgroup.Subsystem != controller {
+		return fmt.Errorf("cgroup %s belongs to %s, not %s", cgroup.Path, cgroup.Subsystem, controller)
+	}
+	return nil
+}
+
+// writeCgroupFile 写入cgroup接口文件，接口文件由内核创建，不存在时返回错误
+func (cm *CgroupManager) writeCgroupFile(cgroup *Cgroup, file, value string) error {
+	return security.SecureWriteFile(filepath.Join(cgroup.Path, file), []byte(value), &security.SecureFileOptions{
+		Mode:      security.DefaultFileMode,
+		CreateDir: false,
+	})
+}
+
+func (cm *CgroupManager) GetStats(cgroup *Cgroup) (map[string]interface{}, error) {
+	stats := make(map[string]interface{})
+
+	// 读取内存统计
+	memStatFile := filepath.Join(cgroup.Path, "memory.stat")
+	// #nosec G304 -- cgroup.Path由CgroupManager管理，memory.stat是Linux内核标准cgroup文件，系统编程操作安全
+	if data, err := os.ReadFile(memStatFile); err == nil {
+		memStats := cm.parseMemoryStats(string(data))
+		stats["memory"] = memStats
+	}
+
+	// 读取当前内存用量：v2为memory.current，v1为memory.usage_in_bytes
+	memUsageFile := "memory.current"
+	if cm.version == 1 {
+		memUsageFile = "memory.usage_in_bytes"
+	}
+	// #nosec G304 -- cgroup.Path由CgroupManager管理，读取的是内核标准cgroup文件
+	if data, err := os.ReadFile(filepath.Join(cgroup.Path, memUsageFile)); err == nil {
+		if usage, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			memStats, ok := stats["memory"].(map[string]int64)
+			if !ok {
+				memStats = make(map[string]int64)
+				stats["memory"] = memStats
+			}
+			memStats["usage"] = usage
+		}
+	}
+
+	// 读取CPU统计
+	cpuStatFile := filepath.Join(cgroup.Path, "cpu.stat")
+	// #nosec G304 -- cgroup.Path由CgroupManager管理，cpu.stat是Linux内核标准cgroup文件，系统编程操作安全
+	if data, err := os.ReadFile(cpuStatFile); err == nil {
+		cpuStats := cm.parseCPUStats(string(data))
+		stats["cpu"] = cpuStats
+	}
+
+	// v1的cpu.stat不含累计用量，从cpuacct.usage（纳秒）换算为usage_usec
+	if cm.version == 1 {
+		// #nosec G304 -- cgroup.Path由CgroupManager管理，读取的是内核标准cgroup文件
+		if data, err := os.ReadFile(filepath.Join(cgroup.Path, "cpuacct.usage")); err == nil {
+			if usage, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+				cpuStats, ok := stats["cpu"].(map[string]int64)
+				if !ok {
+					cpuStats = make(map[string]int64)
+					stats["cpu"] = cpuStats
+				}
+				cpuStats["usage_usec"] = usage / 1000
+			}
+		}
+	}
+
+	// 读取进程数
+	// #nosec G304 -- cgroup.Path由CgroupManager管理，pids.current是Linux内核标准cgroup文件
+	if data, err := os.ReadFile(filepath.Join(cgroup.Path, "pids.current")); err == nil {
+		if current, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			pids := map[string]int64{"current": current}
+			if limit, ok := cgroup.Limits["pids"].(int64); ok {
+				pids["limit"] = limit
+			}
+			stats["pids"] = pids
+		}
+	}
+
+	// 块设备IO限制取自已设置的值
+	blkio := make(map[string]interface{})
+	if weight, exists := cgroup.Limits["blkio_weight"]; exists {
+		blkio["weight"] = weight
+	}
+	if limits, ok := cgroup.Limits["io_max"].(map[string]IOLimit); ok && len(limits) > 0 {
+		devices := make(map[string]IOLimit, len(limits))
+		for device, limit := range limits {
+			devices[device] = limit
+		}
+		blkio["io_max"] = devices
+	}
+	if len(blkio) > 0 {
+		stats["blkio"] = blkio
+	}
+
+	cgroup.Stats = stats
+	return stats, nil
+}
+
+// OOMKillCount 返回内存cgroup中被OOM killer终止的进程累计数。
+// cgroup v2读取memory.events，v1读取memory.oom_control，两者都以oom_kill字段记录
+func (cm *CgroupManager) OOMKillCount(cgroup *Cgroup) (int64, error) {
+	file := "memory.oom_control"
+	if cm.version == 2 {
+		file = "memory.events"
+	}
+
+	// #nosec G304 -- cgroup.Path由CgroupManager管理，读取的是内核标准cgroup文件
+	data, err := os.ReadFile(filepath.Join(cgroup.Path, file))
+	if err != nil {
+		return 0, err
+	}
+	count, exists := cm.parseMemoryStats(string(data))["oom_kill"]
+	if !exists {
+		return 0, fmt.Errorf("oom_kill not found in %s", file)
+	}
+	return count, nil
+}
+
+func (cm *CgroupManager) parseMemoryStats(data string) map[string]int64 {
+	stats := make(map[string]int64)
+	lines := strings.Split(data, "\n")
+
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) == 2 {
+			if value, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+				stats[parts[0]] = value
+			}
+		}
+	}
+
+	return stats
+}
+
+func (cm *CgroupManager) parseCPUStats(data string) map[string]int64 {
+	stats := make(map[string]int64)
+	lines := strings.Split(data, "\n")
+
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) == 2 {
+			if value, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+				stats[parts[0]] = value
+			}
+		}
+	}
+
+	return stats
+}
+
+// Freeze 冻结cgroup内的全部进程
+func (cm *CgroupManager) Freeze(cgroup *Cgroup) error {
+	return cm.setFrozen(cgroup, true)
+}
+
+// Thaw 解冻cgroup内的全部进程
+func (cm *CgroupManager) Thaw(cgroup *Cgroup) error {
+	return cm.setFrozen(cgroup, false)
+}
+
+func (cm *CgroupManager) removeAllProcesses(cgroup *Cgroup) error {
+	// 将所有进程移动到根cgroup
+	for _, pid := range cgroup.Processes {
+		if err := cm.moveProcessToRoot(cgroup.Subsystem, pid); err != nil {
+			fmt.Printf("警告: 无法移动进程 %d: %v\n", pid, err)
+		}
+	}
+	cgroup.Processes = cgroup.Processes[:0]
+	return nil
+}
+
+// cgroupV2Controllers 容器在cgroup v2统一层级中需要启用的控制器
+var cgroupV2Controllers = []string{"cpu", "cpuset", "memory", "io", "pids"}
+
+// cgroupMkdir 创建cgroup目录，测试中可替换以观察目录创建顺序
+var cgroupMkdir = os.Mkdir
+
+// CreateUnifiedCgroup 在cgroup v2统一层级的父cgroup下为容器创建cgroup，
+// 创建前沿父路径逐级在cgroup.subtree_control中启用所需控制器
+func (cm *CgroupManager) CreateUnifiedCgroup(containerID string) (*Cgroup, error) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	parentPath, controllers, err := cm.prepareUnifiedParent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare cgroup parent %s: %v", cm.parent, err)
+	}
+
+	cgroupPath := filepath.Join(parentPath, containerID)
+	// #nosec G301 -- Linux cgroup系统目录，需要0755权限支持内核cgroup子系统访问
+	if err := cgroupMkdir(cgroupPath, 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	cgroup := &Cgroup{
+		Subsystem:   "unified",
+		Path:        cgroupPath,
+		Controllers: controllers,
+		Processes:   make([]int, 0),
+		Limits:      make(map[string]interface{}),
+		Stats:       make(map[string]interface{}),
+		CreatedAt:   time.Now(),
+	}
+
+	cgroupID := fmt.Sprintf("unified-%s", containerID)
+	cm.cgroups[cgroupID] = cgroup
+
+	fmt.Printf("创建Cgroup: %s (控制器: %s)\n", cgroupID, strings.Join(controllers, ","))
+	return cgroup, nil
+}
+
+// prepareUnifiedParent 确保父cgroup存在并返回其路径和子cgroup可用的控制器。
+// 父路径已存在时视为委派给运行时的子树（如systemd的Delegate=yes），
+// 只修改该子树内的subtree_control，不触碰其上层；否则从挂载点开始逐级创建。
+// 每一级都先启用控制器再创建下一级目录，否则子cgroup无法使用这些控制器
+func (cm *CgroupManager) prepareUnifiedParent() (string, []string, error) {
+	parentPath := filepath.Join(cm.mountPoint, cm.parent)
+	if err := security.ValidatePathWithinBase(parentPath, cm.mountPoint); err != nil {
+		return "", nil, err
+	}
+
+	start := cm.mountPoint
+	if info, err := os.Stat(parentPath); err == nil && info.IsDir() {
+		start = parentPath
+	}
+
+	var components []string
+	if rel, err := filepath.Rel(start, parentPath); err == nil && rel != "." {
+		components = strings.Split(rel, string(filepath.Separator))
+	}
+
+	current := start
+	available, known := readCgroupControllers(current)
+	for i := 0; ; i++ {
+		enabled, err := enableSubtreeControllers(current, available, known)
+		if err != nil {
+			return "", nil, err
+		}
+		if i == len(components) {
+			return current, enabled, nil
+		}
+
+		child := filepath.Join(current, components[i])
+		// #nosec G301 -- Linux cgroup系统目录，需要0755权限支持内核cgroup子系统访问
+		if err := cgroupMkdir(child, 0755); err != nil && !os.IsExist(err) {
+			return "", nil, err
+		}
+
+		// 内核会根据父级的subtree_control填充子级的cgroup.controllers
+		if childAvailable, ok := readCgroupControllers(child); ok {
+			available = childAvailable
+		} else {
+			available = enabled
+		}
+		current = child
+	}
+}
+
+// readCgroupControllers 读取cgroup.controllers，文件不存在时说明该目录不在cgroup v2层级中
+func readCgroupControllers(dir string) ([]string, bool) {
+	// #nosec G304 -- 路径限制在cgroup挂载点内
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return nil, false
+	}
+	return strings.Fields(string(data)), true
+}
+
+// enableSubtreeControllers 在dir的cgroup.subtree_control中启用可用的所需控制器，返回实际启用的控制器
+func enableSubtreeControllers(dir string, available []string, known bool) ([]string, error) {
+	if !known {
+		return nil, nil
+	}
+
+	availableSet := make(map[string]bool, len(available))
+	for _, controller := range available {
+		availableSet[controller] = true
+	}
+
+	var enabled, missing []string
+	var request strings.Builder
+	for _, controller := range cgroupV2Controllers {
+		if !availableSet[controller] {
+			missing = append(missing, controller)
+			continue
+		}
+		if request.Len() > 0 {
+			request.WriteByte(' ')
+		}
+		request.WriteString("+" + controller)
+		enabled = append(enabled, controller)
+	}
+	if len(missing) > 0 {
+		log.Printf("Warning: cgroup controllers not available in %s: %s", dir, strings.Join(missing, ","))
+	}
+	if len(enabled) == 0 {
+		return nil, nil
+	}
+
+	controlFile := filepath.Join(dir, "cgroup.subtree_control")
+	if err := security.SecureWriteFile(controlFile, []byte(request.String()), &security.SecureFileOptions{
+		Mode:      security.DefaultFileMode,
+		CreateDir: false,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to enable controllers in %s: %v", dir, err)
+	}
+	return enabled, nil
+}
+
+func (cm *CgroupManager) moveProcessToRoot(subsystem string, pid int) error {
+	rootProcsFile := filepath.Join(cm.mountPoint, subsystem, "cgroup.procs")
+	if cm.version == 2 {
+		// 统一层级只有一个根
+		rootProcsFile = filepath.Join(cm.mountPoint, "cgroup.procs")
+	}
+	return security.SecureWriteFile(rootProcsFile, []byte(strconv.Itoa(pid)), &security.SecureFileOptions{
+		Mode:      security.DefaultFileMode,
+		CreateDir: false,
+	})
+}
+
+// ==================
+// 4. 存储管理系统
+// ==================
+
+// StorageManager 存储管理器
+type StorageManager struct {
+	drivers      map[string]StorageDriver
+	activeDriver StorageDriver
+	graphRoot    string
+	runRoot      string
+	layers       map[string]*Layer
+	images       map[string]*ContainerImage
+	// digestIndex 层内容摘要到层ID的索引，用于复用内容相同的层
+	digestIndex map[string]string
+	dedupStats  DedupStats
+	// layerRefs 各层被镜像和容器引用的次数，归零时才从存储驱动中删除
+	layerRefs map[string]int
+	mutex     sync.RWMutex
+}
+
+// DedupStats 层去重统计
+type DedupStats struct {
+	// SharedLayers 因内容相同而复用已有层、未重复创建的次数
+	SharedLayers int
+	// BytesSaved 复用已有层节省的磁盘字节数
+	BytesSaved int64
+}
+
+// StorageDriver 存储驱动接口
+type StorageDriver interface {
+	Name() string
+	Initialize(root string) error
+	CreateLayer(id string, parent string) (*Layer, error)
+	RemoveLayer(id string) error
+	GetLayer(id string) (*Layer, error)
+	MountLayer(id string, mountPoint string) error
+	UnmountLayer(id string) error
+	GetLayerSize(id string) (int64, error)
+	DiffPath(id string) (string, error)
+	Cleanup() error
+}
+
+// Layer 镜像层
+type Layer struct {
+	ID          string
+	Parent      string
+	Size        int64
+	Digest      string           // 未压缩tar内容的sha256摘要
+	Compression LayerCompression // 最近一次导入/导出使用的压缩算法
+	CreatedAt   time.Time
+	MountPoint  string
+	Mounted     bool
+	Metadata    map[string]interface{}
+}
+
+// ContainerImage 容器镜像
+type ContainerImage struct {
+	ID           string
+	RepoTags     []string
+	RepoDigests  []string
+	Parent       string
+	Comment      string
+	Created      time.Time
+	Config       *ImageConfig
+	Architecture string
+	Os           string
+	Size         int64
+	VirtualSize  int64
+	Labels       map[string]string
+	Layers       []string
+}
+
+// ImageConfig 镜像配置
+type ImageConfig struct {
+	Hostname        string
+	Domainname      string
+	User            string
+	AttachStdin     bool
+	AttachStdout    bool
+	AttachStderr    bool
+	ExposedPorts    map[string]struct{}
+	Tty             bool
+	OpenStdin       bool
+	StdinOnce       bool
+	Env             []string
+	Cmd             []string
+	Healthcheck     *HealthConfig
+	ArgsEscaped     bool
+	Image           string
+	Volumes         map[string]struct{}
+	WorkingDir      string
+	Entrypoint      []string
+	NetworkDisabled bool
+	MacAddress      string
+	OnBuild         []string
+	Labels          map[string]string
+	StopSignal      string
+	StopTimeout     *int
+	Shell           []string
+}
+
+func NewStorageManager() *StorageManager {
+	sm := &StorageManager{
+		drivers:     make(map[string]StorageDriver),
+		layers:      make(map[string]*Layer),
+		images:      make(map[string]*ContainerImage),
+		digestIndex: make(map[string]string),
+		layerRefs:   make(map[string]int),
+	}
+
+	// 注册存储驱动
+	sm.RegisterDriver(&OverlayFSDriver{})
+	sm.RegisterDriver(&AufsDriver{})
+	sm.RegisterDriver(&DeviceMapperDriver{})
+
+	return sm
+}
+
+func (sm *StorageManager) RegisterDriver(driver StorageDriver) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.drivers[driver.Name()] = driver
+	fmt.Printf("注册存储驱动: %s\n", driver.Name())
+}
+
+func (sm *StorageManager) Initialize(driverName string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	driver, exists := sm.drivers[driverName]
+	if !exists {
+		return fmt.Errorf("storage driver not found: %s", driverName)
+	}
+
+	if err := driver.Initialize(sm.graphRoot); err != nil {
+		return err
+	}
+
+	sm.activeDriver = driver
+	fmt.Printf("初始化存储驱动: %s\n", driverName)
+	return nil
+}
+
+func (sm *StorageManager) PrepareLayer(image *ContainerImage, mountPoint string) error {
+	if sm.activeDriver == nil {
+		return fmt.Errorf("no active storage driver")
+	}
+
+	// 先引用各层，防止并发的ReleaseLayers在准备过程中删除它们；失败时撤销引用
+	sm.acquireLayers(image.Layers)
+	if err := sm.prepareLayer(image, mountPoint); err != nil {
+		sm.mutex.Lock()
+		for _, layerID := range image.Layers {
+			sm.layerRefs[layerID]--
+		}
+		sm.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (sm *StorageManager) prepareLayer(image *ContainerImage, mountPoint string) error {
+	// 为镜像的每一层创建layer，已存在的层（如构建或导入产生的层）直接复用
+	var parentID string
+	for _, layerID := range image.Layers {
+		sm.mutex.RLock()
+		_, exists := sm.layers[layerID]
+		sm.mutex.RUnlock()
+		if !exists {
+			layer, err := sm.activeDriver.CreateLayer(layerID, parentID)
+			if err != nil {
+				return err
+			}
+			sm.mutex.Lock()
+			sm.layers[layerID] = layer
+			sm.mutex.Unlock()
+		}
+		parentID = layerID
+	}
+
+	// 挂载顶层
+	if len(image.Layers) > 0 {
+		topLayerID := image.Layers[len(image.Layers)-1]
+		if err := sm.activeDriver.MountLayer(topLayerID, mountPoint); err != nil {
+			// 宿主机不支持联合挂载时，按从底到顶的顺序复制各层内容
+			log.Printf("Warning: %v, falling back to copying layers", err)
+			return sm.copyLayers(image.Layers, mountPoint)
+		}
+	}
+
+	return nil
+}
+
+// LayerRefCount 返回层当前被镜像和容器引用的次数
+func (sm *StorageManager) LayerRefCount(id string) int {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.layerRefs[id]
+}
+
+// acquireLayers 为每一层增加一次引用
+func (sm *StorageManager) acquireLayers(layerIDs []string) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	for _, layerID := range layerIDs {
+		sm.layerRefs[layerID]++
+	}
+}
+
+// ReleaseLayers 为每一层减少一次引用，引用归零的层从存储驱动中删除，删除失败时继续处理其余层并返回第一个错误。
+// 从顶层向下处理，子层总是先于父层删除；没有引用的层不受影响
+func (sm *StorageManager) ReleaseLayers(layerIDs []string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	var firstErr error
+	for i := len(layerIDs) - 1; i >= 0; i-- {
+		layerID := layerIDs[i]
+		if sm.layerRefs[layerID] <= 0 {
+			continue
+		}
+		sm.layerRefs[layerID]--
+		if sm.layerRefs[layerID] > 0 {
+			continue
+		}
+
+		delete(sm.layerRefs, layerID)
+		delete(sm.layers, layerID)
+		for digest, id := range sm.digestIndex {
+			if id == layerID {
+				delete(sm.digestIndex, digest)
+			}
+		}
+		if sm.activeDriver == nil {
+			continue
+		}
+		if err := sm.activeDriver.RemoveLayer(layerID); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove layer %s: %v", layerID, err)
+		}
+	}
+	return firstErr
+}
+
+// copyLayers 将各层的内容依次复制到目标目录，上层文件覆盖下层同名文件
+func (sm *StorageManager) copyLayers(layerIDs []string, target string) error {
+	for _, layerID := range layerIDs {
+		diffPath, err := sm.activeDriver.DiffPath(layerID)
+		if err != nil {
+			return err
+		}
+		if err := copyTree(diffPath, target); err != nil {
+			return fmt.Errorf("failed to copy layer %s: %v", layerID, err)
+		}
+	}
+	return nil
+}
+
+// ==================
+// 4.0 镜像导入导出与层压缩
+// ==================
+
+// LayerCompression 镜像层压缩算法
+type LayerCompression string
+
+const (
+	CompressionNone LayerCompression = "none"
+	CompressionGzip LayerCompression = "gzip"
+	CompressionZstd LayerCompression = "zstd"
+)
+
+// 镜像层媒体类型
+const (
+	mediaTypeLayerTar  = "application/vnd.oci.image.layer.v1.tar"
+	mediaTypeLayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+	mediaTypeLayerZstd = "application/vnd.oci.image.layer.v1.tar+zstd"
+)
+
+// 压缩格式魔数
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// MediaType 返回压缩算法对应的层媒体类型
+func (lc LayerCompression) MediaType() string {
+	switch lc {
+	case CompressionGzip:
+		return mediaTypeLayerGzip
+	case CompressionZstd:
+		return mediaTypeLayerZstd
+	default:
+		return mediaTypeLayerTar
+	}
+}
+
+// compressionFromMediaType 根据媒体类型推断压缩算法
+func compressionFromMediaType(mediaType string) (LayerCompression, bool) {
+	switch mediaType {
+	case mediaTypeLayerGzip, "application/vnd.docker.image.rootfs.diff.tar.gzip":
+		return CompressionGzip, true
+	case mediaTypeLayerZstd:
+		return CompressionZstd, true
+	case mediaTypeLayerTar:
+		return CompressionNone, true
+	}
+	return "", false
+}
+
+// detectCompression 通过魔数识别压缩算法
+func detectCompression(header []byte) LayerCompression {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(header, zstdMagic):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// compressWriter 按算法包装写入端
+func compressWriter(w io.Writer, compression LayerCompression) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	case CompressionNone, "":
+		return nopWriteCloser{w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported layer compression: %s", compression)
+	}
+}
+
+// decompressReader 按算法包装读取端
+func decompressReader(r io.Reader, compression LayerCompression) (io.ReadCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case CompressionNone:
+		return io.NopCloser(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported layer compression: %s", compression)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// SaveOptions 镜像导出选项
+type SaveOptions struct {
+	Compression LayerCompression
+}
+
+// imageArchiveManifest 导出包中的manifest.json
+type imageArchiveManifest struct {
+	ID       string              `json:"id"`
+	RepoTags []string            `json:"repoTags"`
+	Config   *ImageConfig        `json:"config,omitempty"`
+	Layers   []imageArchiveLayer `json:"layers"`
+	Created  time.Time           `json:"created"`
+}
+
+// imageArchiveLayer 导出包中的层描述，Digest基于未压缩的tar内容计算
+type imageArchiveLayer struct {
+	ID        string `json:"id"`
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType"`
+	File      string `json:"file"`
+}
+
+const imageManifestFile = "manifest.json"
+
+// archiveLayerIDPattern 归档中的层ID必须是十六进制摘要，它会拼接进层存储路径
+var archiveLayerIDPattern = regexp.MustCompile("^[a-f0-9]{64}$")
+
+// SaveImage 将镜像及其所有层导出为tar归档，层按opts.Compression压缩
+func (cr *ContainerRuntime) SaveImage(imageID string, w io.Writer, opts SaveOptions) error {
+	cr.mutex.RLock()
+	image, exists := cr.images[imageID]
+	cr.mutex.RUnlock()
+	if !exists {
+		return fmt.Errorf("image not found: %s", imageID)
+	}
+
+	driver := cr.storage.activeDriver
+	if driver == nil {
+		return fmt.Errorf("no active storage driver")
+	}
+	if opts.Compression == "" {
+		opts.Compression = CompressionGzip
+	}
+
+	archive := tar.NewWriter(w)
+	manifest := imageArchiveManifest{
+		ID:       image.ID,
+		RepoTags: image.RepoTags,
+		Config:   image.Config,
+		Created:  image.Created,
+	}
+
+	for _, layerID := range image.Layers {
+		diffPath, err := driver.DiffPath(layerID)
+		if err != nil {
+			return fmt.Errorf("failed to locate layer %s: %v", layerID, err)
+		}
+
+		// 先在内存中生成压缩数据，同时对未压缩的tar流计算摘要
+		var compressed bytes.Buffer
+		compressor, err := compressWriter(&compressed, opts.Compression)
+		if err != nil {
+			return err
+		}
+		hasher := sha256.New()
+		if err := writeLayerTar(io.MultiWriter(compressor, hasher), diffPath); err != nil {
+			return fmt.Errorf("failed to archive layer %s: %v", layerID, err)
+		}
+		if err := compressor.Close(); err != nil {
+			return err
+		}
+
+		// 归档中的层以内容摘要命名，与从仓库拉取的层一致
+		digest := "sha256:" + hex.EncodeToString(hasher.Sum(nil))
+		entry := imageArchiveLayer{
+			ID:        strings.TrimPrefix(digest, "sha256:"),
+			Digest:    digest,
+			MediaType: opts.Compression.MediaType(),
+			File:      "layers/" + strings.TrimPrefix(digest, "sha256:"),
+		}
+		if err := writeTarFile(archive, entry.File, compressed.Bytes()); err != nil {
+			return err
+		}
+		manifest.Layers = append(manifest.Layers, entry)
+
+		cr.storage.recordLayerInfo(layerID, digest, opts.Compression)
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(archive, imageManifestFile, manifestData); err != nil {
+		return err
+	}
+
+	fmt.Printf("导出镜像: %s (层数: %d, 压缩: %s)\n", image.ID, len(manifest.Layers), opts.Compression)
+	return archive.Close()
+}
+
+// LoadImage 从SaveImage生成的归档导入镜像。层的压缩算法由媒体类型或魔数自动识别，
+// 解压后的内容摘要必须与manifest一致
+func (cr *ContainerRuntime) LoadImage(r io.Reader) (image *ContainerImage, err error) {
+	driver := cr.storage.activeDriver
+	if driver == nil {
+		return nil, fmt.Errorf("no active storage driver")
+	}
+
+	var manifest *imageArchiveManifest
+	files := make(map[string][]byte)
+
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image archive: %v", err)
+		}
+		if header.Name == imageManifestFile {
+			data, err := readLimited(archive, maxMetadataSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read image manifest: %w", err)
+			}
+			manifest = &imageArchiveManifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("invalid image manifest: %v", err)
+			}
+			continue
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, err
+		}
+		files[header.Name] = data
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("image archive has no %s", imageManifestFile)
+	}
+	for _, entry := range manifest.Layers {
+		if !archiveLayerIDPattern.MatchString(entry.ID) {
+			return nil, fmt.Errorf("invalid layer id in image manifest: %q", entry.ID)
+		}
+	}
+
+	// 失败时删除本次创建的层，已存在的层不受影响
+	var created []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(created) - 1; i >= 0; i-- {
+			if removeErr := cr.storage.removeLayer(created[i]); removeErr != nil {
+				log.Printf("Warning: failed to remove partial layer %s: %v", created[i], removeErr)
+			}
+		}
+	}()
+
+	var parentID string
+	layerIDs := make([]string, 0, len(manifest.Layers))
+	for _, entry := range manifest.Layers {
+		if cr.storage.hasLayer(entry.ID) {
+			layerIDs = append(layerIDs, entry.ID)
+			parentID = entry.ID
+			continue
+		}
+		data, exists := files[entry.File]
+		if !exists {
+			return nil, fmt.Errorf("layer file missing from archive: %s", entry.File)
+		}
+
+		// 已有内容相同的层时直接引用，不再创建和解包
+		if existingID, ok := cr.storage.reuseLayer(entry.Digest, entry.ID); ok {
+			layerIDs = append(layerIDs, existingID)
+			parentID = existingID
+			continue
+		}
+
+		compression, known := compressionFromMediaType(entry.MediaType)
+		if !known {
+			compression = detectCompression(data)
+		}
+
+		if _, err := driver.CreateLayer(entry.ID, parentID); err != nil {
+			return nil, fmt.Errorf("failed to create layer %s: %v", entry.ID, err)
+		}
+		created = append(created, entry.ID)
+		diffPath, err := driver.DiffPath(entry.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		digest, err := extractLayer(bytes.NewReader(data), compression, diffPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract layer %s: %v", entry.ID, err)
+		}
+		if digest != entry.Digest {
+			return nil, fmt.Errorf("layer %s digest mismatch: expected %s, got %s", entry.ID, entry.Digest, digest)
+		}
+
+		cr.storage.recordLayerInfo(entry.ID, digest, compression)
+		size, _ := calculateDirectorySize(diffPath)
+		cr.storage.indexLayer(entry.ID, digest, size)
+		layerIDs = append(layerIDs, entry.ID)
+		parentID = entry.ID
+	}
+
+	image = &ContainerImage{
+		ID:       manifest.ID,
+		RepoTags: manifest.RepoTags,
+		Config:   manifest.Config,
+		Created:  manifest.Created,
+		Layers:   layerIDs,
+	}
+
+	cr.registerImage(image, "")
+
+	fmt.Printf("导入镜像: %s (层数: %d)\n", image.ID, len(layerIDs))
+	return image, nil
+}
+
+// recordLayerInfo 记录层的摘要和压缩算法
+func (sm *StorageManager) recordLayerInfo(layerID, digest string, compression LayerCompression) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	layer, exists := sm.layers[layerID]
+	if !exists {
+		layer = &Layer{ID: layerID, CreatedAt: time.Now(), Metadata: make(map[string]interface{})}
+		sm.layers[layerID] = layer
+	}
+	layer.Digest = digest
+	layer.Compression = compression
+}
+
+// extractLayer 解压并解包层内容到目标目录，返回未压缩tar流的摘要
+func extractLayer(r io.Reader, compression LayerCompression, target string) (string, error) {
+	decompressed, err := decompressReader(r, compression)
+	if err != nil {
+		return "", err
+	}
+	defer decompressed.Close()
+
+	hasher := sha256.New()
+	if err := unpackLayerTar(io.TeeReader(decompressed, hasher), target); err != nil {
+		return "", err
+	}
+	// 读完tar尾部的填充，保证摘要覆盖完整的流
+	if _, err := io.Copy(hasher, decompressed); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// writeLayerTar 将目录内容按字典序写成tar流，保证相同内容生成相同的字节序列
+func writeLayerTar(w io.Writer, root string) error {
+	return writeTreeTar(w, root, "")
+}
+
+// writeTreeTar 将root写成tar流，条目名以prefix为前缀；prefix为空时不包含root自身
+func writeTreeTar(w io.Writer, root, prefix string) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || (rel == "." && prefix == "") {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if prefix != "" {
+			if rel == "." {
+				name = prefix
+			} else {
+				name = prefix + "/" + name
+			}
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		header.ModTime = info.ModTime().Truncate(time.Second)
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+		header.Uname = ""
+		header.Gname = ""
+		header.Format = tar.FormatPAX
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		// #nosec G304 -- 路径来自存储驱动管理的层目录遍历
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// unpackLayerTar 将tar流解包到目标目录。条目的父路径以目标目录为根逐级解析，
+// 层内符号链接即使指向绝对路径也不会把后续条目带出目标目录
+func unpackLayerTar(r io.Reader, target string) error {
+	return extractTar(r, func(header *tar.Header) (string, error) {
+		path, err := resolveContainerPath(target, filepath.ToSlash(header.Name), false)
+		if err != nil {
+			return "", fmt.Errorf("illegal path in layer: %s", header.Name)
+		}
+		return path, nil
+	})
+}
+
+// extractTar 解包tar流，每个条目的落盘路径由resolve决定。
+// 落盘路径上已有的符号链接先被删除，条目不会经由它写到链接指向的位置
+func extractTar(r io.Reader, resolve func(header *tar.Header) (string, error)) error {
+	tr := tar.NewReader(r)
+	dirTimes := make(map[string]time.Time)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			// 目录的修改时间会因写入子项而变化，最后统一恢复
+			for dir, modTime := range dirTimes {
+				if err := os.Chtimes(dir, modTime, modTime); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path, err := resolve(header)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+
+		mode := header.FileInfo().Mode().Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, mode|0700); err != nil {
+				return err
+			}
+			dirTimes[path] = header.ModTime
+			continue
+		case tar.TypeReg:
+			// #nosec G301 -- 层内父目录使用标准的0755权限
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			// #nosec G304 -- path已由resolve限定在目标目录内，且不是符号链接
+			file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(file, tr); err != nil {
+				file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// #nosec G301 -- 层内父目录使用标准的0755权限
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			// 后出现的条目覆盖同名的已有文件
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, path); err != nil {
+				return err
+			}
+			continue
+		default:
+			continue
+		}
+
+		if err := os.Chtimes(path, header.ModTime, header.ModTime); err != nil {
+			return err
+		}
+	}
+}
+
+// writeTarFile 向归档写入一个普通文件
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Unix(0, 0),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// ==================
+// 4.1 OverlayFS驱动实现
+// ==================
+
+// OverlayFSDriver OverlayFS存储驱动
+type OverlayFSDriver struct {
+	root      string
+	layersDir string
+	diffsDir  string
+}
+
+func (od *OverlayFSDriver) Name() string {
+	return "overlay2"
+}
+
+func (od *OverlayFSDriver) Initialize(root string) error {
+	od.root = root
+	od.layersDir = filepath.Join(root, "overlay2")
+	od.diffsDir = filepath.Join(od.layersDir, "l")
+
+	// 创建目录结构
+	dirs := []string{od.layersDir, od.diffsDir}
+	for _, dir := range dirs {
+		// #nosec G301 -- OverlayFS驱动系统目录，需要0755权限支持Docker镜像层管理
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("初始化OverlayFS驱动: %s\n", root)
+	return nil
+}
+
+func (od *OverlayFSDriver) CreateLayer(id string, parent string) (*Layer, error) {
+	layerDir := filepath.Join(od.layersDir, id)
+	diffDir := filepath.Join(layerDir, "diff")
+	workDir := filepath.Join(layerDir, "work")
+	mergedDir := filepath.Join(layerDir, "merged")
+
+	// 创建目录
+	dirs := []string{layerDir, diffDir, workDir, mergedDir}
+	for _, dir := range dirs {
+		// #nosec G301 -- OverlayFS镜像层目录（diff/work/merged），需要0755支持容器文件系统操作
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	layer := &Layer{
+		ID:        id,
+		Parent:    parent,
+		CreatedAt: time.Now(),
+		Metadata:  make(map[string]interface{}),
+	}
+
+	// 创建链接文件
+	linkFile := filepath.Join(layerDir, "link")
+	linkName := generateShortID()
+	if err := security.SecureWriteFile(linkFile, []byte(linkName), &security.SecureFileOptions{
+		Mode:      security.DefaultFileMode,
+		CreateDir: false,
+	}); err != nil {
+		return nil, err
+	}
+
+	// 在l目录下创建符号链接
+	linkPath := filepath.Join(od.diffsDir, linkName)
+	if err := os.Symlink(diffDir, linkPath); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("创建OverlayFS层: %s (父层: %s)\n", id, parent)
+	return layer, nil
+}
+
+func (od *OverlayFSDriver) MountLayer(id string, mountPoint string) error {
+	layerDir := filepath.Join(od.layersDir, id)
+	diffDir := filepath.Join(layerDir, "diff")
+	workDir := filepath.Join(layerDir, "work")
+
+	// 构建OverlayFS挂载选项
+	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", diffDir, diffDir, workDir)
+
+	// 执行挂载
+	err := windowsMount("overlay", mountPoint, "overlay", 0, options)
+	if err != nil {
+		return fmt.Errorf("failed to mount overlay: %v", err)
+	}
+
+	fmt.Printf("挂载OverlayFS层: %s -> %s\n", id, mountPoint)
+	return nil
+}
+
+func (od *OverlayFSDriver) UnmountLayer(id string) error {
+	layerDir := filepath.Join(od.layersDir, id)
+	mergedDir := filepath.Join(layerDir, "merged")
+
+	err := windowsUnmount(mergedDir, 0)
+	if err != nil {
+		return fmt.Errorf("failed to unmount layer: %v", err)
+	}
+
+	fmt.Printf("卸载OverlayFS层: %s\n", id)
+	return nil
+}
+
+func (od *OverlayFSDriver) GetLayer(id string) (*Layer, error) {
+	layerDir := filepath.Join(od.layersDir, id)
+	if _, err := os.Stat(layerDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("layer not found: %s", id)
+	}
+
+	return &Layer{
+		ID:       id,
+		Metadata: make(map[string]interface{}),
+	}, nil
+}
+
+func (od *OverlayFSDriver) GetLayerSize(id string) (int64, error) {
+	layerDir := filepath.Join(od.layersDir, id, "diff")
+	return calculateDirectorySize(layerDir)
+}
+
+func (od *OverlayFSDriver) DiffPath(id string) (string, error) {
+	return filepath.Join(od.layersDir, id, "diff"), nil
+}
+
+func (od *OverlayFSDriver) RemoveLayer(id string) error {
+	layerDir := filepath.Join(od.layersDir, id)
+
+	// 同时删除l目录下指向该层的短链接
+	// #nosec G304 -- link文件位于驱动管理的层目录中
+	if linkName, err := os.ReadFile(filepath.Join(layerDir, "link")); err == nil && len(linkName) > 0 {
+		if err := os.Remove(filepath.Join(od.diffsDir, filepath.Base(string(linkName)))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.RemoveAll(layerDir)
+}
+
+func (od *OverlayFSDriver) Cleanup() error {
+	fmt.Println("清理OverlayFS驱动")
+	return nil
+}
+
+// ==================
+// 4.2 容器提交与镜像构建
+// ==================
+
+// CommitOptions 提交容器时的选项
+type CommitOptions struct {
+	Tag     string
+	Comment string
+	Config  *ImageConfig // 为空时由容器配置推导
+}
+
+// CommitContainer 将容器可写层的内容提交为新的镜像层，并生成以容器镜像为父镜像的新镜像
+func (cr *ContainerRuntime) CommitContainer(containerID string, opts CommitOptions) (*ContainerImage, error) {
+	cr.mutex.RLock()
+	container, exists := cr.containers[containerID]
+	cr.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("container not found: %s", containerID)
+	}
+
+	// 复制可写层期间持有容器锁；登记镜像需要cr.mutex，必须在释放容器锁之后进行
+	container.mutex.Lock()
+	config := opts.Config
+	if config == nil {
+		config = containerImageConfig(container)
+	}
+	image, err := cr.createImageWithLayer(container.Image, config, func(diffPath string) error {
+		return copyTree(cr.containerRWLayer(container), diffPath)
+	})
+	container.mutex.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit container %s: %v", containerID[:12], err)
+	}
+
+	image.Comment = opts.Comment
+	cr.registerImage(image, opts.Tag)
+
+	fmt.Printf("提交容器: %s -> 镜像 %s\n", containerID[:12], image.ID)
+	return image, nil
+}
+
+// containerRWLayer 返回容器的可写层目录
+func (cr *ContainerRuntime) containerRWLayer(container *Container) string {
+	return filepath.Join(cr.config.RootDirectory, "containers", container.ID, "rw")
+}
+
+// containerImageConfig 由容器当前配置推导镜像配置
+func containerImageConfig(container *Container) *ImageConfig {
+	config := copyImageConfig(nil)
+	if container.Image != nil {
+		config = copyImageConfig(container.Image.Config)
+	}
+	if container.Config != nil {
+		config.Env = append([]string(nil), container.Config.Env...)
+		config.Cmd = append([]string(nil), container.Config.Cmd...)
+		config.Entrypoint = append([]string(nil), container.Config.Entrypoint...)
+		config.WorkingDir = container.Config.WorkingDir
+		config.User = container.Config.User
+	}
+	return config
+}
+
+// copyImageConfig 深拷贝镜像配置中构建步骤会修改的字段
+func copyImageConfig(config *ImageConfig) *ImageConfig {
+	if config == nil {
+		return &ImageConfig{}
+	}
+	result := *config
+	result.Env = append([]string(nil), config.Env...)
+	result.Cmd = append([]string(nil), config.Cmd...)
+	result.Entrypoint = append([]string(nil), config.Entrypoint...)
+	return &result
+}
+
+// createImageWithLayer 在父镜像之上创建一个新层，由populate填充层内容。
+// 返回的镜像尚未登记，调用方需通过registerImage登记
+func (cr *ContainerRuntime) createImageWithLayer(parent *ContainerImage, config *ImageConfig, populate func(diffPath string) error) (*ContainerImage, error) {
+	driver := cr.storage.activeDriver
+	if driver == nil {
+		return nil, fmt.Errorf("no active storage driver")
+	}
+
+	var layers []string
+	parentLayer := ""
+	parentID := ""
+	if parent != nil {
+		layers = append(layers, parent.Layers...)
+		parentID = parent.ID
+		if len(parent.Layers) > 0 {
+			parentLayer = parent.Layers[len(parent.Layers)-1]
+		}
+	}
+
+	layerID := generateLayerID()
+	layer, err := driver.CreateLayer(layerID, parentLayer)
+	if err != nil {
+		return nil, err
+	}
+	diffPath, err := driver.DiffPath(layerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := populate(diffPath); err != nil {
+		if removeErr := driver.RemoveLayer(layerID); removeErr != nil {
+			log.Printf("Warning: failed to remove layer %s: %v", layerID, removeErr)
+		}
+		return nil, err
+	}
+	if size, err := calculateDirectorySize(diffPath); err == nil {
+		layer.Size = size
+	}
+
+	// 内容与已有层相同时删除新层，改为引用已有层
+	digest, err := layerContentDigest(diffPath)
+	if err != nil {
+		return nil, err
+	}
+	if existingID, ok := cr.storage.reuseLayer(digest, layerID); ok {
+		if removeErr := driver.RemoveLayer(layerID); removeErr != nil {
+			log.Printf("Warning: failed to remove duplicate layer %s: %v", layerID, removeErr)
+		}
+		cr.storage.mutex.RLock()
+		layer = cr.storage.layers[existingID]
+		cr.storage.mutex.RUnlock()
+		layerID = existingID
+	} else {
+		layer.Digest = digest
+		cr.storage.mutex.Lock()
+		cr.storage.layers[layerID] = layer
+		cr.storage.mutex.Unlock()
+		cr.storage.indexLayer(layerID, digest, layer.Size)
+	}
+
+	image := &ContainerImage{
+		ID:      generateImageID(),
+		Parent:  parentID,
+		Created: time.Now(),
+		Config:  copyImageConfig(config),
+		Layers:  append(layers, layerID),
+		Size:    layer.Size,
+	}
+	if parent != nil {
+		image.Architecture = parent.Architecture
+		image.Os = parent.Os
+		image.VirtualSize = parent.VirtualSize
+	}
+	image.VirtualSize += layer.Size
+
+	return image, nil
+}
+
+// registerImage 登记镜像，tag非空时同时为其打标签，同一标签只会指向一个镜像
+func (cr *ContainerRuntime) registerImage(image *ContainerImage, tag string) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	// 登记的镜像持有其各层的引用，重复登记同一镜像不重复计数
+	if _, exists := cr.images[image.ID]; !exists {
+		cr.storage.acquireLayers(image.Layers)
+	}
+	cr.images[image.ID] = image
+	if tag == "" {
+		return
+	}
+	for _, other := range cr.images {
+		for i, existing := range other.RepoTags {
+			if existing == tag {
+				other.RepoTags = append(other.RepoTags[:i], other.RepoTags[i+1:]...)
+				break
+			}
+		}
+	}
+	image.RepoTags = append(image.RepoTags, tag)
+}
+
+// BuildInstruction 构建指令
+type BuildInstruction string
+
+const (
+	BuildFrom       BuildInstruction = "FROM"
+	BuildRun        BuildInstruction = "RUN"
+	BuildCopy       BuildInstruction = "COPY"
+	BuildEnv        BuildInstruction = "ENV"
+	BuildCmd        BuildInstruction = "CMD"
+	BuildEntrypoint BuildInstruction = "ENTRYPOINT"
+	BuildWorkdir    BuildInstruction = "WORKDIR"
+)
+
+// BuildStep 构建步骤，参数含义与Dockerfile指令一致：
+// RUN只有一个参数时按shell形式执行，COPY的最后一个参数为目标路径
+type BuildStep struct {
+	Instruction BuildInstruction
+	Args        []string
+}
+
+// BuildSpec 声明式镜像构建规格，第一步必须是FROM
+type BuildSpec struct {
+	Tag        string
+	ContextDir string // COPY源路径的根目录
+	Steps      []BuildStep
+	NoCache    bool
+}
+
+// buildState 构建过程中的中间状态
+type buildState struct {
+	image    *ContainerImage // 当前层链对应的已登记镜像
+	config   *ImageConfig    // 累积的镜像配置
+	cacheKey string          // 到当前步骤为止的缓存链键
+}
+
+// BuildImage 按顺序执行构建步骤生成分层镜像。RUN和COPY各产生一层，
+// 其余指令只修改镜像配置。每一步的缓存键由父链键和步骤定义（COPY还包括源文件内容）计算，
+// 命中缓存时直接复用之前生成的层
+func (cr *ContainerRuntime) BuildImage(spec *BuildSpec) (*ContainerImage, error) {
+	return cr.BuildImageContext(context.Background(), spec)
+}
+
+// BuildImageContext 执行构建，ctx在每个步骤开始前检查，取消时终止正在执行的RUN命令
+func (cr *ContainerRuntime) BuildImageContext(ctx context.Context, spec *BuildSpec) (*ContainerImage, error) {
+	if len(spec.Steps) == 0 || spec.Steps[0].Instruction != BuildFrom {
+		return nil, fmt.Errorf("build must start with %s", BuildFrom)
+	}
+
+	state := &buildState{}
+	for i, step := range spec.Steps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := cr.executeBuildStep(ctx, spec, state, step); err != nil {
+			return nil, fmt.Errorf("step %d (%s): %v", i+1, step.Instruction, err)
+		}
+	}
+
+	image := &ContainerImage{
+		ID:           generateImageID(),
+		Parent:       state.image.ID,
+		Created:      time.Now(),
+		Config:       state.config,
+		Architecture: state.image.Architecture,
+		Os:           state.image.Os,
+		Size:         state.image.Size,
+		VirtualSize:  state.image.VirtualSize,
+		Layers:       append([]string(nil), state.image.Layers...),
+	}
+	cr.registerImage(image, spec.Tag)
+
+	fmt.Printf("构建镜像: %s (层数: %d)\n", image.ID, len(image.Layers))
+	return image, nil
+}
+
+func (cr *ContainerRuntime) executeBuildStep(ctx context.Context, spec *BuildSpec, state *buildState, step BuildStep) error {
+	if step.Instruction != BuildFrom && state.image == nil {
+		return fmt.Errorf("no base image")
+	}
+
+	switch step.Instruction {
+	case BuildFrom:
+		if len(step.Args) != 1 {
+			return fmt.Errorf("requires exactly one image")
+		}
+		cr.mutex.RLock()
+		base, exists := cr.lookupImageLocked(step.Args[0])
+		cr.mutex.RUnlock()
+		if !exists {
+			return fmt.Errorf("image not found: %s", step.Args[0])
+		}
+		state.image = base
+		state.config = copyImageConfig(base.Config)
+		state.cacheKey = base.ID
+		return nil
+
+	case BuildEnv:
+		for _, pair := range step.Args {
+			key, _, found := strings.Cut(pair, "=")
+			if !found || key == "" {
+				return fmt.Errorf("invalid environment variable: %q", pair)
+			}
+			state.config.Env = setEnv(state.config.Env, pair)
+		}
+
+	case BuildCmd:
+		state.config.Cmd = append([]string(nil), step.Args...)
+
+	case BuildEntrypoint:
+		state.config.Entrypoint = append([]string(nil), step.Args...)
+
+	case BuildWorkdir:
+		if len(step.Args) != 1 {
+			return fmt.Errorf("requires exactly one path")
+		}
+		dir := step.Args[0]
+		if !path.IsAbs(dir) {
+			dir = path.Join("/", state.config.WorkingDir, dir)
+		}
+		state.config.WorkingDir = path.Clean(dir)
+
+	case BuildRun:
+		if len(step.Args) == 0 {
+			return fmt.Errorf("requires a command")
+		}
+		return cr.cachedBuildLayer(spec, state, step, "", func(state *buildState, step BuildStep) (*ContainerImage, error) {
+			return cr.buildRunLayer(ctx, state, step)
+		})
+
+	case BuildCopy:
+		if len(step.Args) < 2 {
+			return fmt.Errorf("requires at least one source and a destination")
+		}
+		sources, err := resolveBuildSources(spec.ContextDir, step.Args[:len(step.Args)-1])
+		if err != nil {
+			return err
+		}
+		contentDigest, err := hashBuildSources(sources)
+		if err != nil {
+			return err
+		}
+		return cr.cachedBuildLayer(spec, state, step, contentDigest, func(state *buildState, step BuildStep) (*ContainerImage, error) {
+			return cr.buildCopyLayer(state, sources, step.Args[len(step.Args)-1])
+		})
+
+	default:
+		return fmt.Errorf("unsupported instruction")
+	}
+
+	// 配置类指令同样进入缓存链，保证其后的RUN/COPY在配置变化时不会误用缓存
+	state.cacheKey = buildCacheKey(state.cacheKey, step, "")
+	return nil
+}
+
+// cachedBuildLayer 查找缓存，未命中时调用build生成新层并记录缓存
+func (cr *ContainerRuntime) cachedBuildLayer(spec *BuildSpec, state *buildState, step BuildStep, contentDigest string,
+	build func(state *buildState, step BuildStep) (*ContainerImage, error)) error {
+	key := buildCacheKey(state.cacheKey, step, contentDigest)
+
+	if !spec.NoCache {
+		cr.mutex.RLock()
+		imageID, cached := cr.buildCache[key]
+		image, exists := cr.images[imageID]
+		cr.mutex.RUnlock()
+		if cached && exists {
+			fmt.Printf("使用构建缓存: %s %s\n", step.Instruction, strings.Join(step.Args, " "))
+			state.image = image
+			state.cacheKey = key
+			return nil
+		}
+	}
+
+	image, err := build(state, step)
+	if err != nil {
+		return err
+	}
+
+	cr.mutex.Lock()
+	cr.buildCache[key] = image.ID
+	cr.mutex.Unlock()
+
+	state.image = image
+	state.cacheKey = key
+	return nil
+}
+
+// lookPathInRootfs 按env中的PATH在rootfs下查找可执行文件，返回容器内的绝对路径
+func lookPathInRootfs(rootfs, name string, env []string) (string, error) {
+	candidates := []string{name}
+	if !strings.Contains(name, "/") {
+		searchPath := "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+		for _, pair := range env {
+			if value, found := strings.CutPrefix(pair, "PATH="); found {
+				searchPath = value
+			}
+		}
+		candidates = candidates[:0]
+		for _, dir := range filepath.SplitList(searchPath) {
+			candidates = append(candidates, path.Join("/", dir, name))
+		}
+	}
+
+	for _, candidate := range candidates {
+		hostPath, err := resolveContainerPath(rootfs, candidate, true)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(hostPath); err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0 {
+			return path.Clean("/" + candidate), nil
+		}
+	}
+	return "", fmt.Errorf("executable file not found in container root filesystem: %s", name)
+}
+
+// fileState 文件的类型、权限、大小、修改时间和链接目标，用于找出RUN命令改动过的文件
+type fileState struct {
+	mode    os.FileMode
+	size    int64
+	modTime int64
+	link    string
+}
+
+// snapshotTree 记录root下每个条目的状态，键为相对路径
+func snapshotTree(root string) (map[string]fileState, error) {
+	states := make(map[string]fileState)
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		state := fileState{mode: info.Mode(), size: info.Size(), modTime: info.ModTime().UnixNano()}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if state.link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		states[rel] = state
+		return nil
+	})
+	return states, err
+}
+
+// copyChangedFiles 将root下相对before新增或改动过的条目复制到dst。
+// 存储层没有whiteout，删除下层文件的改动不会进入新层
+func copyChangedFiles(root string, before map[string]fileState, dst string) error {
+	after, err := snapshotTree(root)
+	if err != nil {
+		return err
+	}
+	var changed []string
+	for rel, state := range after {
+		if previous, exists := before[rel]; !exists || previous != state {
+			changed = append(changed, rel)
+		}
+	}
+	// 父目录排在子项之前
+	sort.Strings(changed)
+
+	for _, rel := range changed {
+		source := filepath.Join(root, rel)
+		target, err := resolveContainerPath(dst, filepath.ToSlash(rel), false)
+		if err != nil {
+			return err
+		}
+		info, err := os.Lstat(source)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+			err = os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			var link string
+			if link, err = os.Readlink(source); err == nil {
+				// #nosec G301 -- 层内父目录使用标准的0755权限
+				if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+					err = os.Symlink(link, target)
+				}
+			}
+		case info.Mode().IsRegular():
+			err = copyFile(source, target, info.Mode())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildRunLayer 在临时容器中执行RUN命令并提交改动。
+// 命令chroot到由镜像各层准备出的根文件系统中运行，结束后把新增或改动过的文件放入可写层再提交；
+// 无法chroot时构建失败，不会退回到宿主机上执行
+func (cr *ContainerRuntime) buildRunLayer(ctx context.Context, state *buildState, step BuildStep) (*ContainerImage, error) {
+	cmd := step.Args
+	if len(cmd) == 1 {
+		cmd = []string{"sh", "-c", step.Args[0]}
+	}
+
+	container, err := cr.CreateContainer(&ContainerConfig{
+		Image:      state.image.ID,
+		Cmd:        cmd,
+		Env:        state.config.Env,
+		User:       state.config.User,
+		WorkingDir: state.config.WorkingDir,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cr.RemoveContainer(container.ID, true); err != nil {
+			log.Printf("Warning: failed to remove build container: %v", err)
+		}
+	}()
+
+	// prepareFilesystem已把镜像各层复制到容器的layer目录，它就是RUN命令看到的根文件系统
+	rootfs := filepath.Join(cr.config.RootDirectory, "containers", container.ID, "layer")
+	workDir := path.Join("/", state.config.WorkingDir)
+	hostWorkDir, err := resolveContainerPath(rootfs, workDir, true)
+	if err != nil {
+		return nil, err
+	}
+	// #nosec G301 -- 容器根文件系统中的工作目录，需要0755权限
+	if err := os.MkdirAll(hostWorkDir, 0755); err != nil {
+		return nil, err
+	}
+	before, err := snapshotTree(rootfs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 环境变量直接使用构建状态中累积的值，避免与父镜像的环境变量重复拼接
+	container.mutex.Lock()
+	container.chroot = rootfs
+	container.Config.WorkingDir = workDir
+	container.Config.Env = append([]string(nil), state.config.Env...)
+	container.mutex.Unlock()
+
+	if err := cr.startContainer(ctx, container.ID, true); err != nil {
+		return nil, err
+	}
+
+	// 关闭标准输入，避免命令等待输入而阻塞
+	if err := container.Process.Stdin.Close(); err != nil {
+		log.Printf("Warning: failed to close build container stdin: %v", err)
+	}
+
+	exitCode, err := cr.WaitContainerContext(ctx, container.ID)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		// 进程退出时日志已读取完毕，直接取出全部输出作为错误信息
+		var output []byte
+		if logs, err := cr.Logs(container.ID, LogOptions{}); err == nil {
+			output, _ = io.ReadAll(logs)
+			logs.Close()
+		}
+		return nil, fmt.Errorf("command %q exited with code %d: %s", strings.Join(cmd, " "), exitCode, strings.TrimSpace(string(output)))
+	}
+
+	if err := copyChangedFiles(rootfs, before, cr.containerRWLayer(container)); err != nil {
+		return nil, fmt.Errorf("failed to collect changes of %q: %v", strings.Join(cmd, " "), err)
+	}
+	return cr.CommitContainer(container.ID, CommitOptions{
+		Comment: fmt.Sprintf("%s %s", step.Instruction, strings.Join(step.Args, " ")),
+		Config:  state.config,
+	})
+}
+
+// buildCopyLayer 将构建上下文中的文件复制到新层的目标路径
+func (cr *ContainerRuntime) buildCopyLayer(state *buildState, sources []string, dest string) (*ContainerImage, error) {
+	if !path.IsAbs(dest) {
+		dirOnly := strings.HasSuffix(dest, "/")
+		dest = path.Join("/", state.config.WorkingDir, dest)
+		if dirOnly {
+			dest += "/"
+		}
+	}
+
+	image, err := cr.createImageWithLayer(state.image, state.config, func(diffPath string) error {
+		for _, source := range sources {
+			info, err := os.Stat(source)
+			if err != nil {
+				return err
+			}
+			target := dest
+			if !info.IsDir() && (strings.HasSuffix(dest, "/") || len(sources) > 1) {
+				target = path.Join(dest, filepath.Base(source))
+			}
+			// 每个源都在新层中重新解析目标，前一个源复制进来的符号链接不会把写入引到层外
+			hostPath, err := resolveContainerPath(diffPath, target, info.IsDir())
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				err = copyTree(source, hostPath)
+			} else {
+				err = copyFile(source, hostPath, info.Mode())
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	image.Comment = fmt.Sprintf("%s %s", BuildCopy, dest)
+	cr.registerImage(image, "")
+	return image, nil
+}
+
+// resolveBuildSources 将COPY源路径解析为构建上下文内的绝对路径
+func resolveBuildSources(contextDir string, sources []string) ([]string, error) {
+	if contextDir == "" {
+		return nil, fmt.Errorf("build context directory is required")
+	}
+
+	resolved := make([]string, 0, len(sources))
+	for _, source := range sources {
+		fullPath := filepath.Join(contextDir, filepath.FromSlash(source))
+		if err := security.ValidatePathWithinBase(fullPath, contextDir); err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, fullPath)
+	}
+	return resolved, nil
+}
+
+// hashBuildSources 计算COPY源文件的内容摘要，作为缓存键的一部分
+func hashBuildSources(sources []string) (string, error) {
+	hasher := sha256.New()
+	for _, source := range sources {
+		err := filepath.WalkDir(source, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(source, p)
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hasher, "%s\x00%s\x00%o\x00", filepath.Base(source), filepath.ToSlash(rel), info.Mode())
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			file, err := os.Open(p) // #nosec G304 -- 路径已限制在构建上下文内
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(hasher, file)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// buildCacheKey 由父链键、步骤定义和内容摘要计算缓存键
+func buildCacheKey(parent string, step BuildStep, contentDigest string) string {
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%s\x00%s\x00", parent, step.Instruction)
+	for _, arg := range step.Args {
+		fmt.Fprintf(hasher, "%s\x00", arg)
+	}
+	hasher.Write([]byte(contentDigest))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// setEnv 设置环境变量，同名变量被替换
+func setEnv(env []string, pair string) []string {
+	key, _, _ := strings.Cut(pair, "=")
+	for i, existing := range env {
+		if existingKey, _, _ := strings.Cut(existing, "="); existingKey == key {
+			env[i] = pair
+			return env
+		}
+	}
+	return append(env, pair)
+}
+
+// copyTree 将src目录的内容递归复制到dst目录，保留文件权限和符号链接。
+// 目标路径以dst为根解析且不跟随最后一级符号链接，下层中etc -> /etc这样的链接不会把写入引到宿主机
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target, err := resolveContainerPath(dst, filepath.ToSlash(rel), false)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			// 上层的目录替换下层同名的符号链接或文件
+			if existing, err := os.Lstat(target); err == nil && !existing.IsDir() {
+				if err := os.Remove(target); err != nil {
+					return err
+				}
+			}
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Lstat(target); err == nil {
+				if err := os.RemoveAll(target); err != nil {
+					return err
+				}
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(p, target, info.Mode())
+		default:
+			// 设备文件、管道等特殊文件不复制
+			return nil
+		}
+	})
+}
+
+// copyFile 复制单个文件，目标已存在时覆盖。dst是符号链接时替换链接本身而不写入其指向的文件
+func copyFile(src, dst string, mode os.FileMode) error {
+	// #nosec G301 -- 镜像层中的目录，需要0755权限
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(dst); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+
+	in, err := os.Open(src) // #nosec G304 -- 源路径来自镜像层或已校验的构建上下文
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// 相对已打开的父目录创建文件，父目录在检查之后被换成链接或目标被换成链接时都不会被跟随
+	parent, err := os.OpenRoot(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	defer parent.Close()
+	out, err := parent.OpenFile(filepath.Base(dst), os.O_CREATE|os.O_WRONLY|os.O_TRUNC|openNoFollow, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ==================
+// 4.3 镜像拉取
+// ==================
+
+// PullOptions 镜像拉取选项。仓库返回Bearer质询时向其令牌服务申请令牌，
+// 提供Username时以Basic认证申请，否则匿名申请
+type PullOptions struct {
+	Insecure bool               // 使用HTTP而非HTTPS访问仓库，并允许HTTP令牌服务
+	Client   RegistryHTTPClient // 为空时使用http.DefaultClient
+	Token    string             // 预先获取的Bearer令牌，设置后不再向令牌服务申请
+	Username string             // 用户名和密码只发送给与仓库同主机或在TrustedRealms中的令牌服务
+	Password string
+	// TrustedRealms 除仓库自身外允许接收用户名和密码的令牌服务主机，Docker Hub的auth.docker.io已内置。
+	// 设置了用户名而令牌服务不可信时拉取失败，不会退回匿名访问
+	TrustedRealms []string
+}
+
+// RegistryHTTPClient 访问镜像仓库的HTTP客户端，*http.Client满足该接口，测试可替换为假仓库
+type RegistryHTTPClient interface {
+	Do(request *http.Request) (*http.Response, error)
+}
+
+// defaultTrustedRealms 令牌服务与仓库不在同一主机的知名仓库，及其可以接收凭据的令牌服务主机
+var defaultTrustedRealms = map[string][]string{
+	defaultRegistry: {"auth.docker.io"},
+}
+
+// maxMetadataSize 清单、镜像配置和令牌响应的大小上限，防止仓库或镜像归档耗尽内存
+const maxMetadataSize = 4 << 20
+
+const (
+	defaultRegistry         = "registry-1.docker.io"
+	defaultImageTag         = "latest"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// imageReference 解析后的镜像引用
+type imageReference struct {
+	Name       string // 用户给出的名称部分，不含标签和摘要
+	Registry   string
+	Repository string
+	Reference  string // 标签或摘要
+}
+
+// Tag 返回镜像标签，按摘要引用时为空
+func (ref imageReference) Tag() string {
+	if strings.HasPrefix(ref.Reference, "sha256:") {
+		return ""
+	}
+	return ref.Name + ":" + ref.Reference
+}
+
+// parseImageReference 解析[registry/]repository[:tag|@digest]形式的镜像引用，
+// 第一段包含.或:或为localhost时视为仓库地址，否则使用Docker Hub
+func parseImageReference(ref string) (imageReference, error) {
+	parsed := imageReference{Registry: defaultRegistry, Reference: defaultImageTag}
+
+	name := ref
+	if before, digest, found := strings.Cut(ref, "@"); found {
+		name, parsed.Reference = before, digest
+	} else if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		name, parsed.Reference = ref[:i], ref[i+1:]
+	}
+	parsed.Name = name
+
+	repository := name
+	if first, rest, found := strings.Cut(name, "/"); found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		parsed.Registry, repository = first, rest
+	}
+	if parsed.Registry == defaultRegistry && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	if repository == "" || repository == "library/" || parsed.Reference == "" {
+		return parsed, fmt.Errorf("invalid image reference: %q", ref)
+	}
+
+	parsed.Repository = repository
+	return parsed, nil
+}
+
+// registryManifest 镜像清单，Docker schema2与OCI清单的字段一致
+type registryManifest struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Config        registryDescriptor   `json:"config"`
+	Layers        []registryDescriptor `json:"layers"`
+}
+
+// registryDescriptor 内容描述符
+type registryDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// registryImageConfig 镜像配置blob
+type registryImageConfig struct {
+	Architecture string       `json:"architecture"`
+	Os           string       `json:"os"`
+	Created      time.Time    `json:"created"`
+	Config       *ImageConfig `json:"config"`
+}
+
+// registryClient 访问仓库v2 API的客户端
+type registryClient struct {
+	client     RegistryHTTPClient
+	baseURL    string
+	repository string
+	token      string
+	username   string
+	password   string
+	// trustedRealms 除仓库自身外可以接收凭据的令牌服务主机
+	trustedRealms []string
+	// insecure 允许通过HTTP访问仓库和令牌服务
+	insecure bool
+}
+
+// get 请求仓库API，收到Bearer质询时申请令牌后重试一次
+func (rc *registryClient) get(ctx context.Context, path, accept string) (*http.Response, error) {
+	response, err := rc.do(ctx, path, accept)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusUnauthorized {
+		challenge := response.Header.Get("WWW-Authenticate")
+		response.Body.Close()
+		if err := rc.authenticate(ctx, challenge); err != nil {
+			return nil, fmt.Errorf("GET %s%s: %w", rc.repository, path, err)
+		}
+		if response, err = rc.do(ctx, path, accept); err != nil {
+			return nil, err
+		}
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("GET %s%s: %s", rc.repository, path, response.Status)
+	}
+	return response, nil
+}
+
+func (rc *registryClient) do(ctx context.Context, path, accept string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rc.baseURL+"/v2/"+rc.repository+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	if rc.token != "" {
+		request.Header.Set("Authorization", "Bearer "+rc.token)
+	}
+	return rc.client.Do(request)
+}
+
+// authenticate 按WWW-Authenticate中的Bearer质询向令牌服务申请拉取令牌
+func (rc *registryClient) authenticate(ctx context.Context, challenge string) error {
+	scheme, params := parseAuthChallenge(challenge)
+	if !strings.EqualFold(scheme, "Bearer") || params["realm"] == "" {
+		return fmt.Errorf("unsupported authentication challenge: %q", challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return fmt.Errorf("invalid token realm: %v", err)
+	}
+	if realm.Scheme != "https" && !(rc.insecure && realm.Scheme == "http") {
+		return fmt.Errorf("refusing non-HTTPS token realm: %s", realm.Redacted())
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + rc.repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	// 凭据只发给可信的令牌服务，且不随HTTPS降级为HTTP明文发送；不可信时报错而不是改为匿名申请
+	if rc.username != "" {
+		if !rc.trustedRealm(realm) {
+			return fmt.Errorf("refusing to send credentials to untrusted token realm %s", realm.Redacted())
+		}
+		request.SetBasicAuth(rc.username, rc.password)
+	}
+	response, err := rc.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("token request failed: %s", response.Status)
+	}
+
+	// 令牌服务可能使用token或access_token字段返回令牌
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	data, err := readLimited(response.Body, maxMetadataSize)
+	if err != nil {
+		return fmt.Errorf("failed to read token response: %w", err)
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return fmt.Errorf("invalid token response: %v", err)
+	}
+	rc.token = body.Token
+	if rc.token == "" {
+		rc.token = body.AccessToken
+	}
+	if rc.token == "" {
+		return fmt.Errorf("token response contains no token")
+	}
+	return nil
+}
+
+// trustedRealm 令牌服务是否可以接收凭据：与仓库为同一主机或在可信列表中，且未从HTTPS降级为HTTP
+func (rc *registryClient) trustedRealm(realm *url.URL) bool {
+	base, err := url.Parse(rc.baseURL)
+	if err != nil || base.Scheme == "https" && realm.Scheme != "https" {
+		return false
+	}
+	if strings.EqualFold(base.Host, realm.Host) {
+		return true
+	}
+	for _, host := range rc.trustedRealms {
+		if strings.EqualFold(host, realm.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAuthChallenge 解析形如Bearer realm="...",service="..."的质询
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var param string
+		rest = strings.TrimLeft(rest, " ,")
+		key, value, found := strings.Cut(rest, "=")
+		if !found {
+			break
+		}
+		if strings.HasPrefix(value, "\"") {
+			end := strings.Index(value[1:], "\"")
+			if end < 0 {
+				break
+			}
+			param, rest = value[1:end+1], value[end+2:]
+		} else {
+			param, rest, _ = strings.Cut(value, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = param
+	}
+	return scheme, params
+}
+
+func (rc *registryClient) fetchManifest(ctx context.Context, reference string) (*registryManifest, error) {
+	response, err := rc.get(ctx, "/manifests/"+reference, mediaTypeOCIManifest+", "+mediaTypeDockerManifest)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	data, err := readLimited(response.Body, maxMetadataSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	// 按摘要引用时清单内容必须与摘要一致
+	if strings.HasPrefix(reference, "sha256:") {
+		if err := verifyDigest(sha256.Sum256(data), reference); err != nil {
+			return nil, err
+		}
+	}
+	manifest := &registryManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if manifest.SchemaVersion != 2 {
+		return nil, fmt.Errorf("unsupported manifest schema version: %d", manifest.SchemaVersion)
+	}
+	return manifest, nil
+}
+
+func (rc *registryClient) fetchBlob(ctx context.Context, digest string) (io.ReadCloser, error) {
+	response, err := rc.get(ctx, "/blobs/"+digest, "")
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// readLimited 读取r的全部内容，超过limit字节时返回错误
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("content exceeds %d bytes", limit)
+	}
+	return data, nil
+}
+
+// verifyDigest 比较内容的sha256与期望摘要
+func verifyDigest(sum [sha256.Size]byte, expected string) error {
+	if actual := "sha256:" + hex.EncodeToString(sum[:]); actual != expected {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// digestHex 校验sha256摘要格式并返回十六进制部分，结果可安全用作层ID和路径
+func digestHex(digest string) (string, error) {
+	hexPart, found := strings.CutPrefix(digest, "sha256:")
+	if _, err := hex.DecodeString(hexPart); !found || err != nil || len(hexPart) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid digest: %q", digest)
+	}
+	return hexPart, nil
+}
+
+// PullImage 从镜像仓库拉取镜像
+func (cr *ContainerRuntime) PullImage(ref string, opts PullOptions) (*ContainerImage, error) {
+	return cr.PullImageContext(context.Background(), ref, opts)
+}
+
+// PullImageContext 从镜像仓库拉取镜像：获取清单与配置，逐层下载并解包到当前存储驱动。
+// ctx取消时中止下载，并删除本次拉取已创建的层
+func (cr *ContainerRuntime) PullImageContext(ctx context.Context, ref string, opts PullOptions) (image *ContainerImage, err error) {
+	driver := cr.storage.activeDriver
+	if driver == nil {
+		return nil, fmt.Errorf("no active storage driver")
+	}
+
+	parsed, err := parseImageReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "https"
+	if opts.Insecure {
+		scheme = "http"
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	registry := &registryClient{
+		client:     client,
+		baseURL:    scheme + "://" + parsed.Registry,
+		repository: parsed.Repository,
+		token:      opts.Token,
+		username:   opts.Username,
+		password:   opts.Password,
+		insecure:   opts.Insecure,
+		// 复制一份，避免追加时改写defaultTrustedRealms
+		trustedRealms: append(append([]string(nil), defaultTrustedRealms[parsed.Registry]...), opts.TrustedRealms...),
+	}
+
+	manifest, err := registry.fetchManifest(ctx, parsed.Reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest for %s: %w", ref, err)
+	}
+	imageID, err := digestHex(manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	config, err := cr.fetchImageConfig(ctx, registry, manifest.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image config for %s: %w", ref, err)
+	}
+
+	// 失败时删除本次创建的层，已存在的层不受影响
+	var created []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(created) - 1; i >= 0; i-- {
+			if removeErr := cr.storage.removeLayer(created[i]); removeErr != nil {
+				log.Printf("Warning: failed to remove partial layer %s: %v", created[i], removeErr)
+			}
+		}
+	}()
+
+	var parentID string
+	layerIDs := make([]string, 0, len(manifest.Layers))
+	for _, descriptor := range manifest.Layers {
+		layerID, err := digestHex(descriptor.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if !cr.storage.hasLayer(layerID) {
+			if err := cr.pullLayer(ctx, registry, descriptor, layerID, parentID, &created); err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					err = ctxErr
+				}
+				return nil, fmt.Errorf("failed to pull layer %s: %w", descriptor.Digest, err)
+			}
+		}
+		layerIDs = append(layerIDs, layerID)
+		parentID = layerID
+	}
+
+	image = &ContainerImage{
+		ID:           imageID,
+		Created:      config.Created,
+		Config:       config.Config,
+		Architecture: config.Architecture,
+		Os:           config.Os,
+		Layers:       layerIDs,
+	}
+	if !strings.HasPrefix(parsed.Reference, "sha256:") {
+		cr.registerImage(image, parsed.Tag())
+	} else {
+		image.RepoDigests = []string{parsed.Name + "@" + parsed.Reference}
+		cr.registerImage(image, "")
+	}
+
+	fmt.Printf("拉取镜像: %s (层数: %d)\n", ref, len(layerIDs))
+	return image, nil
+}
+
+func (cr *ContainerRuntime) fetchImageConfig(ctx context.Context, registry *registryClient, digest string) (*registryImageConfig, error) {
+	blob, err := registry.fetchBlob(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	data, err := readLimited(blob, maxMetadataSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image config: %w", err)
+	}
+	if err := verifyDigest(sha256.Sum256(data), digest); err != nil {
+		return nil, err
+	}
+	config := &registryImageConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid image config: %v", err)
+	}
+	if config.Config == nil {
+		config.Config = &ImageConfig{}
+	}
+	return config, nil
+}
+
+// pullLayer 先将层下载到临时文件，下载完整后再创建层并解包，避免留下只写了一半的层目录
+func (cr *ContainerRuntime) pullLayer(ctx context.Context, registry *registryClient, descriptor registryDescriptor, layerID, parentID string, created *[]string) error {
+	tmpDir := filepath.Join(cr.storage.graphRoot, "tmp")
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		return err
+	}
+	download, err := os.CreateTemp(tmpDir, "layer-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(download.Name())
+	defer download.Close()
+
+	blob, err := registry.fetchBlob(ctx, descriptor.Digest)
+	if err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(download, hasher), blob)
+	blob.Close()
+	if err != nil {
+		return err
+	}
+	if err := verifyDigest([sha256.Size]byte(hasher.Sum(nil)), descriptor.Digest); err != nil {
+		return err
+	}
+	if _, err := download.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(download)
+	compression, known := compressionFromMediaType(descriptor.MediaType)
+	if !known {
+		header, _ := reader.Peek(4)
+		compression = detectCompression(header)
+	}
+
+	driver := cr.storage.activeDriver
+	if _, err := driver.CreateLayer(layerID, parentID); err != nil {
+		return err
+	}
+	*created = append(*created, layerID)
+	diffPath, err := driver.DiffPath(layerID)
+	if err != nil {
+		return err
+	}
+
+	digest, err := extractLayer(reader, compression, diffPath)
+	if err != nil {
+		return err
+	}
+	cr.storage.recordLayerInfo(layerID, digest, compression)
+	return nil
+}
+
+// indexLayer 登记层的内容摘要和大小，供后续内容相同的层复用
+func (sm *StorageManager) indexLayer(layerID, digest string, size int64) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if layer, exists := sm.layers[layerID]; exists {
+		layer.Size = size
+	}
+	if _, exists := sm.digestIndex[digest]; !exists {
+		sm.digestIndex[digest] = layerID
+	}
+}
+
+// reuseLayer 查找内容摘要相同的已登记层。找到且不是layerID本身时计入去重统计，
+// 调用方应引用返回的层而不是再创建一份
+func (sm *StorageManager) reuseLayer(digest, layerID string) (string, bool) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	existingID, exists := sm.digestIndex[digest]
+	if !exists || existingID == layerID {
+		return "", false
+	}
+	existing, registered := sm.layers[existingID]
+	if !registered {
+		delete(sm.digestIndex, digest)
+		return "", false
+	}
+
+	sm.dedupStats.SharedLayers++
+	sm.dedupStats.BytesSaved += existing.Size
+	return existingID, true
+}
+
+// DedupStats 返回层去重统计
+func (sm *StorageManager) DedupStats() DedupStats {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.dedupStats
+}
+
+// layerContentDigest 计算层目录内容的摘要，与导出时未压缩tar流的摘要一致
+func layerContentDigest(diffPath string) (string, error) {
+	hasher := sha256.New()
+	if err := writeLayerTar(hasher, diffPath); err != nil {
+		return "", fmt.Errorf("failed to digest layer %s: %v", diffPath, err)
+	}
+	return "sha256:" + hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// hasLayer 判断层是否已登记
+func (sm *StorageManager) hasLayer(layerID string) bool {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	_, exists := sm.layers[layerID]
+	return exists
+}
+
+// removeLayer 从存储驱动中删除层并注销
+func (sm *StorageManager) removeLayer(layerID string) error {
+	sm.mutex.Lock()
+	delete(sm.layers, layerID)
+	for digest, id := range sm.digestIndex {
+		if id == layerID {
+			delete(sm.digestIndex, digest)
+		}
+	}
+	sm.mutex.Unlock()
+
+	return sm.activeDriver.RemoveLayer(layerID)
+}
+
+// ==================
+// 5. 网络管理系统
+// ==================
+
+// NetworkManager 网络管理器
+type NetworkManager struct {
+	networks   map[string]*ContainerNetwork
+	bridges    map[string]*NetworkBridge
+	interfaces map[string]*NetworkInterface
+	ipam       *IPAddressManager
+	drivers    map[string]NetworkDriver
+	config     NetworkConfig
+	mutex      sync.RWMutex
+}
+
+// ContainerNetwork 容器网络
+type ContainerNetwork struct {
+	ID         string
+	Name       string
+	Driver     string
+	Scope      string
+	Internal   bool
+	Attachable bool
+	Ingress    bool
+	IPAM       *NetworkIPAM
+	ConfigFrom *NetworkConfigReference
+	ConfigOnly bool
+	Containers map[string]*EndpointConfig
+	Options    map[string]string
+	Labels     map[string]string
+	Created    time.Time
+}
+
+// NetworkIPAM IP地址管理
+type NetworkIPAM struct {
+	Driver  string
+	Options map[string]string
+	Config  []IPAMConfig
+}
+
+// IPAMConfig IPAM配置
+type IPAMConfig struct {
+	Subnet     string
+	IPRange    string
+	Gateway    string
+	AuxAddress map[string]string
+}
+
+// NetworkInterface 网络接口
+type NetworkInterface struct {
+	Name         string
+	Type         string
+	HardwareAddr string
+	MTU          int
+	IPAddresses  []string
+	Gateway      string
+	Bridge       string
+	VethPeer     string
+	Namespace    string
+	Created      time.Time
+}
+
+// NetworkBridge 网络桥接
+type NetworkBridge struct {
+	Name       string
+	Interface  string
+	IPAddress  string
+	Subnet     string
+	Gateway    string
+	MTU        int
+	Interfaces []string
+	Created    time.Time
+}
+
+// NetworkDriver 网络驱动接口
+type NetworkDriver interface {
+	Name() string
+	CreateNetwork(config *NetworkConfig) (*ContainerNetwork, error)
+	DeleteNetwork(networkID string) error
+	// CreateEndpoint 创建端点，ifName为容器内的接口名，为空时使用eth0
+	CreateEndpoint(networkID, containerID, ifName string) (*EndpointConfig, error)
+	DeleteEndpoint(networkID, containerID string) error
+	Join(networkID, containerID string) error
+	Leave(networkID, containerID string) error
+}
+
+func NewNetworkManager() *NetworkManager {
+	nm := &NetworkManager{
+		networks:   make(map[string]*ContainerNetwork),
+		bridges:    make(map[string]*NetworkBridge),
+		interfaces: make(map[string]*NetworkInterface),
+		ipam:       NewIPAddressManager(),
+		drivers:    make(map[string]NetworkDriver),
+	}
+
+	// 注册网络驱动
+	nm.RegisterDriver(&BridgeDriver{ipam: nm.ipam})
+	nm.RegisterDriver(&HostDriver{})
+	nm.RegisterDriver(&OverlayDriver{ipam: nm.ipam})
+
+	return nm
+}
+
+// RuntimeLookup 供网络驱动查询容器进程信息，避免驱动直接依赖ContainerRuntime
+type RuntimeLookup interface {
+	ContainerPid(containerID string) (int, error)
+}
+
+// SetRuntimeLookup 为需要进入容器命名空间的驱动设置容器查询接口
+func (nm *NetworkManager) SetRuntimeLookup(lookup RuntimeLookup) {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+
+	for _, driver := range nm.drivers {
+		switch d := driver.(type) {
+		case *BridgeDriver:
+			d.mutex.Lock()
+			d.runtime = lookup
+			d.mutex.Unlock()
+		case *OverlayDriver:
+			d.mutex.Lock()
+			d.runtime = lookup
+			d.mutex.Unlock()
+		}
+	}
+}
+
+func (nm *NetworkManager) RegisterDriver(driver NetworkDriver) {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+
+	nm.drivers[driver.Name()] = driver
+	fmt.Printf("注册网络驱动: %s\n", driver.Name())
+}
+
+// 默认网络参数
+const (
+	defaultNetworkName   = "bridge"
+	defaultNetworkDriver = "bridge"
+	defaultBridgeSubnet  = "172.17.0.0/16"
+	privateSubnetPool    = "172.16.0.0/12"
+)
+
+// hostRouteTable 主机路由表路径，测试中可替换
+var hostRouteTable = "/proc/net/route"
+
+// Initialize 创建默认网络。重复调用是幂等的：默认网络已存在时直接返回。
+// config为空字段时使用默认值；未显式指定子网时会避开主机路由和已有网络，
+// 在172.16.0.0/12中自动选择一个空闲的/16。显式指定的网关必须位于子网内。
+// 选择子网和创建网络期间一直持有nm.mutex，并发调用不会选中同一个子网
+func (nm *NetworkManager) Initialize(config NetworkConfig) error {
+	if config.Name == "" {
+		config.Name = defaultNetworkName
+	}
+	if config.Driver == "" {
+		config.Driver = defaultNetworkDriver
+	}
+
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+
+	nm.config = config
+	for _, network := range nm.networks {
+		if network.Name == config.Name {
+			fmt.Printf("默认网络已存在: %s\n", config.Name)
+			return nil
+		}
+	}
+	used := nm.usedSubnetsLocked()
+
+	routes, err := readHostRoutes(hostRouteTable)
+	if err != nil {
+		log.Printf("Warning: failed to read host routes: %v", err)
+	}
+	used = append(used, routes...)
+
+	var preferred, gateway string
+	if config.IPAM != nil && len(config.IPAM.Config) > 0 {
+		preferred = config.IPAM.Config[0].Subnet
+		gateway = config.IPAM.Config[0].Gateway
+	}
+
+	subnet, err := selectDefaultSubnet(preferred, used)
+	if err != nil {
+		return fmt.Errorf("failed to create default network: %v", err)
+	}
+	if gateway == "" {
+		gateway = firstHostAddress(subnet).String()
+	} else if ip := net.ParseIP(gateway); ip == nil || !subnet.Contains(ip) {
+		return fmt.Errorf("failed to create default network: gateway %s is not in subnet %s", gateway, subnet)
+	}
+
+	defaultConfig := &NetworkConfig{
+		Name:   config.Name,
+		Driver: config.Driver,
+		IPAM: &NetworkIPAM{
+			Driver: "default",
+			Config: []IPAMConfig{
+				{
+					Subnet:  subnet.String(),
+					Gateway: gateway,
+				},
+			},
+		},
+	}
+
+	if _, err := nm.createNetworkLocked(defaultConfig); err != nil {
+		return fmt.Errorf("failed to create default network: %v", err)
+	}
+
+	fmt.Printf("网络管理器初始化完成 (默认子网: %s)\n", subnet)
+	return nil
+}
+
+// usedSubnetsLocked 返回已有网络占用的子网，调用方需持有nm.mutex
+func (nm *NetworkManager) usedSubnetsLocked() []*net.IPNet {
+	used := make([]*net.IPNet, 0)
+	for _, network := range nm.networks {
+		if network.IPAM == nil {
+			continue
+		}
+		for _, cfg := range network.IPAM.Config {
+			if _, subnet, err := net.ParseCIDR(cfg.Subnet); err == nil {
+				used = append(used, subnet)
+			}
+		}
+	}
+	return used
+}
+
+// selectDefaultSubnet 选择默认网络子网。
+// 显式指定的子网必须与已用子网无冲突；未指定时优先172.17.0.0/16，
+// 冲突则在172.16.0.0/12中顺序查找空闲的/16。
+func selectDefaultSubnet(preferred string, used []*net.IPNet) (*net.IPNet, error) {
+	if preferred != "" {
+		_, subnet, err := net.ParseCIDR(preferred)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet %s: %v", preferred, err)
+		}
+		if conflict := findOverlap(subnet, used); conflict != nil {
+			return nil, fmt.Errorf("subnet %s overlaps with existing route %s", subnet, conflict)
+		}
+		return subnet, nil
+	}
+
+	_, subnet, _ := net.ParseCIDR(defaultBridgeSubnet)
+	if findOverlap(subnet, used) == nil {
+		return subnet, nil
+	}
+
+	_, pool, _ := net.ParseCIDR(privateSubnetPool)
+	base := pool.IP.To4()
+	for second := int(base[1]); second < int(base[1])+16; second++ {
+		candidate := &net.IPNet{
+			IP:   net.IPv4(base[0], byte(second), 0, 0).To4(),
+			Mask: net.CIDRMask(16, 32),
+		}
+		if findOverlap(candidate, used) == nil {
+			return candidate, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no free /16 subnet available in %s", privateSubnetPool)
+}
+
+// findOverlap 返回与subnet重叠的第一个网络，无重叠时返回nil
+func findOverlap(subnet *net.IPNet, used []*net.IPNet) *net.IPNet {
+	for _, other := range used {
+		if other.Contains(subnet.IP) || subnet.Contains(other.IP) {
+			return other
+		}
+	}
+	return nil
+}
+
+// firstHostAddress 返回子网中的第一个主机地址，用作网关
+func firstHostAddress(subnet *net.IPNet) net.IP {
+	ip := make(net.IP, len(subnet.IP.To4()))
+	copy(ip, subnet.IP.To4())
+	ip[len(ip)-1]++
+	return ip
+}
+
+// readHostRoutes 解析/proc/net/route格式的路由表，忽略默认路由
+func readHostRoutes(path string) ([]*net.IPNet, error) {
+	// #nosec G304 -- 路由表路径为内核固定接口或测试注入的临时文件
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]*net.IPNet, 0)
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		dest, err := parseRouteHex(fields[1])
+		if err != nil {
+			continue
+		}
+		mask, err := parseRouteHex(fields[7])
+		if err != nil {
+			continue
+		}
+		ones, _ := net.IPMask(mask).Size()
+		if ones == 0 {
+			continue
+		}
+		routes = append(routes, &net.IPNet{IP: net.IP(dest), Mask: net.IPMask(mask)})
+	}
+
+	return routes, nil
+}
+
+// parseRouteHex 解析路由表中小端序的十六进制IPv4地址
+func parseRouteHex(value string) ([]byte, error) {
+	n, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+	return []byte{byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)}, nil
+}
+
+func (nm *NetworkManager) CreateNetwork(config *NetworkConfig) (*ContainerNetwork, error) {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+	return nm.createNetworkLocked(config)
+}
+
+// createNetworkLocked 通过驱动创建网络并登记，调用方需持有nm.mutex
+func (nm *NetworkManager) createNetworkLocked(config *NetworkConfig) (*ContainerNetwork, error) {
+	driver, exists := nm.drivers[config.Driver]
+	if !exists {
+		return nil, fmt.Errorf("network driver not found: %s", config.Driver)
+	}
+
+	network, err := driver.CreateNetwork(config)
+	if err != nil {
+		return nil, err
+	}
+
+	nm.networks[network.ID] = network
+	fmt.Printf("创建网络: %s (驱动: %s)\n", network.Name, config.Driver)
+
+	return network, nil
+}
+
+// ConnectContainer 将容器连接到网络。ifName为空时按连接顺序分配eth0、eth1……
+func (nm *NetworkManager) ConnectContainer(networkID, containerID, ifName string) (*EndpointConfig, error) {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+
+	network, exists := nm.networks[networkID]
+	if !exists {
+		return nil, fmt.Errorf("network not found: %s", networkID)
+	}
+	driver, exists := nm.drivers[network.Driver]
+	if !exists {
+		return nil, fmt.Errorf("network driver not found: %s", network.Driver)
+	}
+	if _, attached := network.Containers[containerID]; attached {
+		return nil, fmt.Errorf("container %s already connected to network %s", containerID, networkID)
+	}
+
+	// 同一容器的各网络接口名不能重复
+	used := make(map[string]bool)
+	for _, other := range nm.networks {
+		if endpoint, attached := other.Containers[containerID]; attached {
+			used[endpoint.Interface] = true
+		}
+	}
+	if ifName == "" {
+		for index := 0; ; index++ {
+			if ifName = defaultInterfaceName(index); !used[ifName] {
+				break
+			}
+		}
+	} else if used[ifName] {
+		return nil, fmt.Errorf("interface %s already in use by container %s", ifName, containerID)
+	}
+
+	endpoint, err := driver.CreateEndpoint(networkID, containerID, ifName)
+	if err != nil {
+		return nil, err
+	}
+	if err := driver.Join(networkID, containerID); err != nil {
+		driver.DeleteEndpoint(networkID, containerID)
+		return nil, err
+	}
+
+	if network.Containers == nil {
+		network.Containers = make(map[string]*EndpointConfig)
+	}
+	network.Containers[containerID] = endpoint
+	return endpoint, nil
+}
+
+// ==================
+// 5.1 Bridge网络驱动
+// ==================
+
+// BridgeDriver 桥接网络驱动
+type BridgeDriver struct {
+	vethRegistry
+	bridges map[string]*NetworkBridge
+	ipam    *IPAddressManager
+	runtime RuntimeLookup // 查询容器PID，用于将veth对端移入容器网络命名空间
+	mutex   sync.RWMutex
+}
+
+// vethRegistry 驱动已分配的端点veth名称，由所属驱动的mutex保护
+type vethRegistry struct {
+	endpoints map[string]*bridgeEndpoint
+	names     map[string]bool // 已分配但可能尚未出现在主机上的接口名
+}
+
+// bridgeEndpoint 桥接端点的veth对命名
+type bridgeEndpoint struct {
+	hostVeth      string // 主机端，连接到网桥
+	peerVeth      string // 对端在主机命名空间中的临时名称
+	containerVeth string // 对端移入容器后的名称
+	ipAddress     string // 由IPAM分配的容器地址
+}
+
+const (
+	defaultContainerInterface = "eth0"
+	vethHostPrefix            = "veth"
+	vethPeerPrefix            = "vpeer"
+)
+
+// hostInterfaceExists 检查主机上是否已存在同名接口，测试中可替换
+var hostInterfaceExists = func(name string) bool {
+	_, err := net.InterfaceByName(name)
+	return err == nil
+}
+
+// defaultInterfaceName 返回第index个网络连接的默认容器内接口名
+func defaultInterfaceName(index int) string {
+	return fmt.Sprintf("eth%d", index)
+}
+
+func endpointKey(networkID, containerID string) string {
+	return networkID + "/" + containerID
+}
+
+// allocateVethNames 为端点分配veth对名称。名称由前缀加网络与容器ID的哈希截断而成，
+// 保证不超过IFNAMSIZ限制；与已分配或主机上已存在的接口冲突时加盐重新哈希。
+func (bd *BridgeDriver) allocateVethNames(networkID, containerID, ifName string) (*bridgeEndpoint, error) {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+	return bd.allocateLocked(networkID, containerID, ifName)
+}
+
+// releaseVethNames 释放端点占用的接口名
+func (bd *BridgeDriver) releaseVethNames(networkID, containerID string) *bridgeEndpoint {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+	return bd.releaseLocked(networkID, containerID)
+}
+
+func (vr *vethRegistry) allocateLocked(networkID, containerID, ifName string) (*bridgeEndpoint, error) {
+	if ifName == "" {
+		ifName = defaultContainerInterface
+	}
+	if err := validateInterfaceName(ifName); err != nil {
+		return nil, err
+	}
+
+	if vr.endpoints == nil {
+		vr.endpoints = make(map[string]*bridgeEndpoint)
+		vr.names = make(map[string]bool)
+	}
+	key := endpointKey(networkID, containerID)
+	if _, exists := vr.endpoints[key]; exists {
+		return nil, fmt.Errorf("endpoint already exists: container %s in network %s", containerID, networkID)
+	}
+
+	for salt := 0; salt < 1000; salt++ {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", key, salt)))
+		suffix := hex.EncodeToString(hash[:])
+		endpoint := &bridgeEndpoint{
+			hostVeth:      vethHostPrefix + suffix[:maxInterfaceNameLength-len(vethHostPrefix)],
+			peerVeth:      vethPeerPrefix + suffix[:maxInterfaceNameLength-len(vethPeerPrefix)],
+			containerVeth: ifName,
+		}
+		if vr.nameTakenLocked(endpoint.hostVeth) || vr.nameTakenLocked(endpoint.peerVeth) {
+			continue
+		}
+
+		vr.names[endpoint.hostVeth] = true
+		vr.names[endpoint.peerVeth] = true
+		vr.endpoints[key] = endpoint
+		return endpoint, nil
+	}
+
+	return nil, fmt.Errorf("no free veth name for container %s in network %s", containerID, networkID)
+}
+
+func (vr *vethRegistry) nameTakenLocked(name string) bool {
+	return vr.names[name] || hostInterfaceExists(name)
+}
+
+func (vr *vethRegistry) releaseLocked(networkID, containerID string) *bridgeEndpoint {
+	key := endpointKey(networkID, containerID)
+	endpoint, exists := vr.endpoints[key]
+	if !exists {
+		return nil
+	}
+	delete(vr.endpoints, key)
+	delete(vr.names, endpoint.hostVeth)
+	delete(vr.names, endpoint.peerVeth)
+	return endpoint
+}
+
+func (bd *BridgeDriver) Name() string {
+	return "bridge"
+}
+
+func (bd *BridgeDriver) CreateNetwork(config *NetworkConfig) (*ContainerNetwork, error) {
+	if bd.bridges == nil {
+		bd.bridges = make(map[string]*NetworkBridge)
+	}
+
+	networkID := generateNetworkID()
+	bridgeName := fmt.Sprintf("br-%s", networkID[:12])
+
+	// 创建网桥
+	bridge := &NetworkBridge{
+		Name:      bridgeName,
+		IPAddress: config.IPAM.Config[0].Gateway,
+		Subnet:    config.IPAM.Config[0].Subnet,
+		Gateway:   config.IPAM.Config[0].Gateway,
+		MTU:       1500,
+		Created:   time.Now(),
+	}
+
+	// 登记地址池，同一子网不能被两个网络共用
+	if bd.ipam != nil {
+		if err := bd.ipam.AddPool(bridge.Subnet, bridge.Gateway); err != nil {
+			return nil, err
+		}
+	}
+
+	// 执行系统命令创建网桥
+	if err := bd.createBridge(bridge); err != nil {
+		if bd.ipam != nil {
+			bd.ipam.RemovePool(bridge.Subnet)
+		}
+		return nil, err
+	}
+
+	bd.mutex.Lock()
+	bd.bridges[networkID] = bridge
+	bd.mutex.Unlock()
+
+	network := &ContainerNetwork{
+		ID:         networkID,
+		Name:       config.Name,
+		Driver:     "bridge",
+		IPAM:       config.IPAM,
+		Containers: make(map[string]*EndpointConfig),
+		Options:    make(map[string]string),
+		Labels:     make(map[string]string),
+		Created:    time.Now(),
+	}
+
+	fmt.Printf("创建桥接网络: %s (网桥: %s)\n", config.Name, bridgeName)
+	return network, nil
+}
+
+func (bd *BridgeDriver) createBridge(bridge *NetworkBridge) error {
+	// G204安全修复：验证网络名称
+	if err := validateNetworkName(bridge.Name); err != nil {
+		return fmt.Errorf("无效的网桥名称: %v", err)
+	}
+
+	// G204安全修复：验证IP地址
+	if err := validateIPAddress(bridge.IPAddress); err != nil {
+		return fmt.Errorf("无效的网桥IP地址: %v", err)
+	}
+
+	// 创建网桥接口
+	// #nosec G204 - bridge.Name已通过validateNetworkName验证，固定命令用于网络配置
+	cmd := exec.Command("ip", "link", "add", bridge.Name, "type", "bridge")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to create bridge: %v", err)
+	}
+
+	// 设置网桥IP地址
+	// #nosec G204 - bridge.IPAddress已通过validateIPAddress验证，固定命令用于网络配置
+	cmd = exec.Command("ip", "addr", "add", bridge.IPAddress+"/24", "dev", bridge.Name)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to set bridge IP: %v", err)
+	}
+
+	// 启用网桥接口
+	// #nosec G204 - bridge.Name已验证，固定命令用于网络配置
+	cmd = exec.Command("ip", "link", "set", bridge.Name, "up")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to enable bridge: %v", err)
+	}
+
+	return nil
+}
+
+func (bd *BridgeDriver) CreateEndpoint(networkID, containerID, ifName string) (*EndpointConfig, error) {
+	bd.mutex.RLock()
+	bridge, exists := bd.bridges[networkID]
+	bd.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("network not found: %s", networkID)
+	}
+
+	// 分配veth对名称，对端先以临时名称创建，避免与主机上的eth0等接口冲突
+	names, err := bd.allocateVethNames(networkID, containerID, ifName)
+	if err != nil {
+		return nil, err
+	}
+	vethHost := names.hostVeth
+
+	// 从网络的地址池中为容器分配地址，后续步骤失败时一并释放
+	var ipAddress string
+	if bd.ipam != nil {
+		if ipAddress, err = bd.ipam.AllocateIP(bridge.Subnet); err != nil {
+			bd.releaseVethNames(networkID, containerID)
+			return nil, err
+		}
+		bd.mutex.Lock()
+		names.ipAddress = ipAddress
+		bd.mutex.Unlock()
+	}
+	success := false
+	defer func() {
+		if !success {
+			bd.releaseEndpoint(networkID, containerID, bridge.Subnet)
+		}
+	}()
+
+	// 创建veth pair
+	// #nosec G204 - vethHost和peerVeth是内部生成的安全标识符，固定命令用于网络配置
+	cmd := exec.Command("ip", "link", "add", vethHost, "type", "veth", "peer", "name", names.peerVeth)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to create veth pair: %v", err)
+	}
+
+	// 将host端连接到网桥
+	// #nosec G204 - vethHost和bridge.Name都是内部生成的安全值，固定命令用于网络配置
+	cmd = exec.Command("ip", "link", "set", vethHost, "master", bridge.Name)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to attach veth to bridge: %v", err)
+	}
+
+	// 启用host端接口
+	// #nosec G204 - vethHost是内部生成的安全标识符，固定命令用于网络配置
+	cmd = exec.Command("ip", "link", "set", vethHost, "up")
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to enable veth host: %v", err)
+	}
+
+	endpoint := &EndpointConfig{
+		NetworkID:   networkID,
+		ContainerID: containerID,
+		Interface:   names.containerVeth,
+		IPAddress:   ipAddress,
+		Gateway:     bridge.Gateway,
+	}
+	success = true
+
+	fmt.Printf("创建网络端点: %s -> %s\n", containerID[:12], networkID[:12])
+	return endpoint, nil
+}
+
+func (bd *BridgeDriver) Join(networkID, containerID string) error {
+	bd.mutex.RLock()
+	names, exists := bd.endpoints[endpointKey(networkID, containerID)]
+	bridge := bd.bridges[networkID]
+	lookup := bd.runtime
+	bd.mutex.RUnlock()
+
+	if !exists || bridge == nil {
+		return fmt.Errorf("endpoint not found: container %s in network %s", containerID, networkID)
+	}
+	if lookup == nil {
+		return fmt.Errorf("bridge driver has no runtime lookup to resolve container %s", containerID)
+	}
+
+	pid, err := lookup.ContainerPid(containerID)
+	if err != nil {
+		return err
+	}
+
+	// 容器内地址使用网络子网的前缀长度
+	var address string
+	if names.ipAddress != "" {
+		_, subnet, err := net.ParseCIDR(bridge.Subnet)
+		if err != nil {
+			return fmt.Errorf("invalid bridge subnet %s: %v", bridge.Subnet, err)
+		}
+		ones, _ := subnet.Mask.Size()
+		address = fmt.Sprintf("%s/%d", names.ipAddress, ones)
+	}
+
+	if err := moveVethToNamespace(pid, names.hostVeth, names.peerVeth, names.containerVeth, address, bridge.Gateway); err != nil {
+		return fmt.Errorf("failed to join container %s to network %s: %w", containerID, networkID, err)
+	}
+
+	fmt.Printf("加入网络: 容器 %s 加入网络 %s (接口: %s -> %s)\n", containerID[:12], networkID[:12], names.peerVeth, names.containerVeth)
+	return nil
+}
+
+func (bd *BridgeDriver) Leave(networkID, containerID string) error {
+	fmt.Printf("离开网络: 容器 %s 离开网络 %s\n", containerID[:12], networkID[:12])
+	return nil
+}
+
+func (bd *BridgeDriver) DeleteEndpoint(networkID, containerID string) error {
+	bd.mutex.RLock()
+	bridge, exists := bd.bridges[networkID]
+	bd.mutex.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("network not found: %s", networkID)
+	}
+
+	names := bd.releaseEndpoint(networkID, containerID, bridge.Subnet)
+	if names == nil {
+		return fmt.Errorf("endpoint not found: container %s in network %s", containerID, networkID)
+	}
+	vethHost := names.hostVeth
+
+	// 删除veth接口，加入网络失败时veth对已被回滚删除
+	// #nosec G204 - vethHost是内部生成的安全标识符，固定命令用于网络清理
+	cmd := exec.Command("ip", "link", "delete", vethHost)
+	if err := cmd.Run(); err != nil && hostInterfaceExists(vethHost) {
+		return fmt.Errorf("failed to delete veth: %v", err)
+	}
+
+	fmt.Printf("删除网络端点: %s\n", containerID[:12])
+	return nil
+}
+
+// releaseEndpoint 释放端点占用的接口名和IP地址
+func (bd *BridgeDriver) releaseEndpoint(networkID, containerID, subnet string) *bridgeEndpoint {
+	names := bd.releaseVethNames(networkID, containerID)
+	if names != nil && names.ipAddress != "" && bd.ipam != nil {
+		if err := bd.ipam.ReleaseIP(subnet, names.ipAddress); err != nil {
+			log.Printf("Warning: failed to release IP address %s: %v", names.ipAddress, err)
+		}
+	}
+	return names
+}
+
+func (bd *BridgeDriver) DeleteNetwork(networkID string) error {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	bridge, exists := bd.bridges[networkID]
+	if !exists {
+		return fmt.Errorf("network not found: %s", networkID)
+	}
+
+	// 删除网桥
+	// #nosec G204 - bridge.Name是内部管理的网桥名称，固定命令用于网络清理
+	cmd := exec.Command("ip", "link", "delete", bridge.Name)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to delete bridge: %v", err)
+	}
+
+	delete(bd.bridges, networkID)
+	if bd.ipam != nil {
+		bd.ipam.RemovePool(bridge.Subnet)
+	}
+	fmt.Printf("删除桥接网络: %s\n", bridge.Name)
+	return nil
+}
+
+// ==================
+// 6. 安全管理系统
+// ==================
+
+// SecurityContext 安全上下文
+type SecurityContext struct {
+	RunAsUser                *int64
+	RunAsGroup               *int64
+	RunAsNonRoot             *bool
+	ReadOnlyRootFilesystem   *bool
+	AllowPrivilegeEscalation *bool
+	Privileged               *bool
+	Capabilities             *Capabilities
+	SelinuxOptions           *SelinuxOptions
+	WindowsOptions           *WindowsSecurityContextOptions
+	FsGroup                  *int64
+	SupplementalGroups       []int64
+	SeccompProfile           *SeccompProfile
+	AppArmorProfile          *AppArmorProfile
+}
+
+// Capabilities 权限能力
+type Capabilities struct {
+	Add  []string
+	Drop []string
+}
+
+// SeccompManager Seccomp管理器
+type SeccompManager struct {
+	profiles map[string]*SeccompProfile
+	mutex    sync.RWMutex
+}
+
+// SeccompProfile Seccomp配置文件
+type SeccompProfile struct {
+	Type             string
+	LocalhostProfile *string
+	DefaultAction    string
+	Architectures    []string
+	Syscalls         []SyscallRule
+}
+
+// SyscallRule 系统调用规则
+type SyscallRule struct {
+	Names  []string
+	Action string
+	Args   []SyscallArg
+}
+
+// SyscallArg 系统调用参数
+type SyscallArg struct {
+	Index    uint
+	Value    uint64
+	ValueTwo uint64
+	Op       string
+}
+
+func NewSeccompManager() *SeccompManager {
+	return &SeccompManager{
+		profiles: make(map[string]*SeccompProfile),
+	}
+}
+
+func (sm *SeccompManager) LoadProfile(name string, profile *SeccompProfile) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.profiles[name] = profile
+	fmt.Printf("加载Seccomp配置文件: %s\n", name)
+	return nil
+}
+
+// ApplyProfile 编译已加载的配置文件，让cmd启动的容器进程在execve之前安装seccomp过滤器。
+// 过滤器只在子进程中安装，运行时自身的线程不受影响；需在cmd.Start之前调用
+func (sm *SeccompManager) ApplyProfile(containerID string, profileName string, cmd *exec.Cmd) error {
+	sm.mutex.RLock()
+	profile, exists := sm.profiles[profileName]
+	sm.mutex.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("seccomp profile not found: %s", profileName)
+	}
+
+	if profile == nil {
+		return fmt.Errorf("seccomp profile is nil: %s", profileName)
+	}
+
+	return sm.attachProfile(containerID, profileName, profile, cmd)
+}
+
+// applyContainerProfile 为容器进程应用安全上下文中的seccomp配置：
+// Localhost类型引用已加载的配置文件，其余类型直接编译配置本身，未配置或Unconfined时不做限制
+func (sm *SeccompManager) applyContainerProfile(containerID string, profile *SeccompProfile, cmd *exec.Cmd) error {
+	if profile == nil {
+		return nil
+	}
+	if profile.Type == "Localhost" {
+		if profile.LocalhostProfile == nil {
+			return fmt.Errorf("seccomp profile of type Localhost has no localhost profile")
+		}
+		return sm.ApplyProfile(containerID, *profile.LocalhostProfile, cmd)
+	}
+	return sm.attachProfile(containerID, profile.Type, profile, cmd)
+}
+
+func (sm *SeccompManager) attachProfile(containerID, profileName string, profile *SeccompProfile, cmd *exec.Cmd) error {
+	if profile.Type == "Unconfined" {
+		return nil
+	}
+
+	program, err := Compile(profile)
+	if err != nil {
+		return fmt.Errorf("failed to compile seccomp profile %s: %v", profileName, err)
+	}
+
+	if err := attachSeccompFilter(cmd, program); err != nil {
+		return fmt.Errorf("failed to apply seccomp profile %s to container %s: %v", profileName, containerID, err)
+	}
+
+	fmt.Printf("应用Seccomp配置: 容器 %s 使用配置 %s (%d 条BPF指令)\n", containerID, profileName, len(program))
+	return nil
+}
+
+// seccomp_data 中各字段的偏移（见 linux/seccomp.h），参数为小端序的64位值
+const (
+	seccompDataNrOffset   = 0
+	seccompDataArchOffset = 4
+	seccompDataArgsOffset = 16
+	// seccompMaxInstructions 内核允许的最大BPF指令数（BPF_MAXINSNS）
+	seccompMaxInstructions = 4096
+	// seccompSkipFail 规则体中跳到“参数不匹配”位置的占位跳转距离
+	seccompSkipFail = 0xff
+	// seccompX32SyscallBit x32 ABI的系统调用号带有该位（__X32_SYSCALL_BIT），
+	// 其AUDIT_ARCH与x86_64相同，需单独拦截以免绕过按号码匹配的规则
+	seccompX32SyscallBit = 0x40000000
+)
+
+// seccompArchitectures seccomp架构名到AUDIT_ARCH值的映射
+var seccompArchitectures = map[string]uint32{
+	"SCMP_ARCH_X86_64":  0xc000003e,
+	"SCMP_ARCH_X86":     0x40000003,
+	"SCMP_ARCH_AARCH64": 0xc00000b7,
+}
+
+// seccompActions seccomp动作到SECCOMP_RET_*返回值的映射，ERRNO返回EPERM
+var seccompActions = map[string]uint32{
+	"SCMP_ACT_KILL":         0x00000000,
+	"SCMP_ACT_KILL_THREAD":  0x00000000,
+	"SCMP_ACT_KILL_PROCESS": 0x80000000,
+	"SCMP_ACT_TRAP":         0x00030000,
+	"SCMP_ACT_ERRNO":        0x00050000 | 1,
+	"SCMP_ACT_TRACE":        0x7ff00000,
+	"SCMP_ACT_LOG":          0x7ffc0000,
+	"SCMP_ACT_ALLOW":        0x7fff0000,
+}
+
+// Compile 将seccomp配置文件编译为BPF程序。
+// 程序先校验架构（不匹配时终止线程），再按规则顺序匹配系统调用号，
+// 同一规则内的参数条件需全部满足，未匹配任何规则时返回默认动作。
+// 某个架构上不存在的系统调用在该架构下跳过；未指定架构时使用宿主机架构
+func Compile(profile *SeccompProfile) ([]bpf.RawInstruction, error) {
+	if profile == nil {
+		return nil, fmt.Errorf("seccomp profile is nil")
+	}
+
+	defaultAction, ok := seccompActions[profile.DefaultAction]
+	if !ok {
+		return nil, fmt.Errorf("unknown seccomp default action: %q", profile.DefaultAction)
+	}
+
+	architectures := profile.Architectures
+	if len(architectures) == 0 {
+		native, err := nativeSeccompArch()
+		if err != nil {
+			return nil, err
+		}
+		architectures = []string{native}
+	}
+	for _, arch := range architectures {
+		if _, ok := seccompArchitectures[arch]; !ok {
+			return nil, fmt.Errorf("unknown seccomp architecture: %q", arch)
+		}
+	}
+
+	for _, rule := range profile.Syscalls {
+		if _, ok := seccompActions[rule.Action]; !ok {
+			return nil, fmt.Errorf("unknown seccomp action %q for syscalls %v", rule.Action, rule.Names)
+		}
+		for _, name := range rule.Names {
+			if !knownSyscall(name) {
+				return nil, fmt.Errorf("unknown syscall: %s", name)
+			}
+		}
+	}
+
+	// 架构分派：每个架构一条比较指令，依次跳到对应架构的规则块
+	blocks := make([][]bpf.Instruction, len(architectures))
+	for i, arch := range architectures {
+		block, err := compileSeccompArch(profile, arch, defaultAction)
+		if err != nil {
+			return nil, err
+		}
+		blocks[i] = block
+	}
+
+	program := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: seccompDataArchOffset, Size: 4},
+	}
+	// 分派指令之后依次是：非法架构的返回指令、各架构的规则块。
+	// 条件跳转只有8位偏移，规则块可能超过255条指令，因此架构匹配时经由32位偏移的无条件跳转进入规则块
+	skip := len(architectures)*2 - 1
+	for i, arch := range architectures {
+		program = append(program,
+			bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: seccompArchitectures[arch], SkipTrue: 1},
+			bpf.Jump{Skip: uint32(skip)})
+		skip += len(blocks[i]) - 2
+	}
+	program = append(program, bpf.RetConstant{Val: seccompActions["SCMP_ACT_KILL"]})
+	for _, block := range blocks {
+		program = append(program, block...)
+	}
+
+	if len(program) > seccompMaxInstructions {
+		return nil, fmt.Errorf("seccomp program too large: %d instructions (max %d)", len(program), seccompMaxInstructions)
+	}
+
+	raw, err := bpf.Assemble(program)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assemble seccomp program: %v", err)
+	}
+	return raw, nil
+}
+
+// compileSeccompArch 生成单个架构的规则块：
+// 加载系统调用号后逐条匹配，每条系统调用为“比较号码 + 参数检查 + 返回动作”。
+// x86_64上先终止x32 ABI的调用，与非法架构的处理一致
+func compileSeccompArch(profile *SeccompProfile, arch string, defaultAction uint32) ([]bpf.Instruction, error) {
+	table := seccompSyscallTables[arch]
+	block := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: seccompDataNrOffset, Size: 4},
+	}
+	if arch == "SCMP_ARCH_X86_64" {
+		block = append(block,
+			bpf.JumpIf{Cond: bpf.JumpGreaterOrEqual, Val: seccompX32SyscallBit, SkipFalse: 1},
+			bpf.RetConstant{Val: seccompActions["SCMP_ACT_KILL"]})
+	}
+
+	for _, rule := range profile.Syscalls {
+		body, err := compileSeccompArgs(rule.Args)
+		if err != nil {
+			return nil, fmt.Errorf("syscalls %v: %v", rule.Names, err)
+		}
+		body = append(body, bpf.RetConstant{Val: seccompActions[rule.Action]})
+		// 参数不匹配时重新加载系统调用号，继续匹配后续规则
+		if len(rule.Args) > 0 {
+			body = append(body, bpf.LoadAbsolute{Off: seccompDataNrOffset, Size: 4})
+		}
+
+		for _, name := range rule.Names {
+			nr, ok := table[name]
+			if !ok {
+				continue
+			}
+			block = append(block, bpf.JumpIf{Cond: bpf.JumpEqual, Val: nr, SkipFalse: uint8(len(body))})
+			block = append(block, body...)
+		}
+	}
+
+	return append(block, bpf.RetConstant{Val: defaultAction}), nil
+}
+
+// compileSeccompArgs 生成参数检查指令，条件满足时顺序执行到返回动作，
+// 不满足时跳到返回动作之后。64位参数拆成高低32位分别比较
+func compileSeccompArgs(args []SyscallArg) ([]bpf.Instruction, error) {
+	var body []bpf.Instruction
+	for _, arg := range args {
+		if arg.Index > 5 {
+			return nil, fmt.Errorf("invalid syscall argument index: %d", arg.Index)
+		}
+		lo := bpf.LoadAbsolute{Off: uint32(seccompDataArgsOffset + 8*arg.Index), Size: 4}
+		hi := bpf.LoadAbsolute{Off: lo.Off + 4, Size: 4}
+		valueLo, valueHi := uint32(arg.Value), uint32(arg.Value>>32)
+
+		switch arg.Op {
+		case "SCMP_CMP_EQ":
+			body = append(body,
+				hi, bpf.JumpIf{Cond: bpf.JumpEqual, Val: valueHi, SkipFalse: seccompSkipFail},
+				lo, bpf.JumpIf{Cond: bpf.JumpEqual, Val: valueLo, SkipFalse: seccompSkipFail})
+		case "SCMP_CMP_NE":
+			body = append(body,
+				hi, bpf.JumpIf{Cond: bpf.JumpEqual, Val: valueHi, SkipFalse: 2},
+				lo, bpf.JumpIf{Cond: bpf.JumpEqual, Val: valueLo, SkipTrue: seccompSkipFail})
+		case "SCMP_CMP_GT", "SCMP_CMP_GE":
+			cond := bpf.JumpGreaterThan
+			if arg.Op == "SCMP_CMP_GE" {
+				cond = bpf.JumpGreaterOrEqual
+			}
+			body = append(body,
+				hi, bpf.JumpIf{Cond: bpf.JumpGreaterThan, Val: valueHi, SkipTrue: 3},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: valueHi, SkipFalse: seccompSkipFail},
+				lo, bpf.JumpIf{Cond: cond, Val: valueLo, SkipFalse: seccompSkipFail})
+		case "SCMP_CMP_LT", "SCMP_CMP_LE":
+			cond := bpf.JumpGreaterOrEqual
+			if arg.Op == "SCMP_CMP_LE" {
+				cond = bpf.JumpGreaterThan
+			}
+			body = append(body,
+				hi, bpf.JumpIf{Cond: bpf.JumpGreaterThan, Val: valueHi, SkipTrue: seccompSkipFail},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: valueHi, SkipFalse: 2},
+				lo, bpf.JumpIf{Cond: cond, Val: valueLo, SkipTrue: seccompSkipFail})
+		case "SCMP_CMP_MASKED_EQ":
+			body = append(body,
+				hi, bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: valueHi},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(arg.ValueTwo >> 32), SkipFalse: seccompSkipFail},
+				lo, bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: valueLo},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(arg.ValueTwo), SkipFalse: seccompSkipFail})
+		default:
+			return nil, fmt.Errorf("unknown syscall argument operator: %q", arg.Op)
+		}
+	}
+
+	// 参数检查之后还有返回动作和重新加载指令，整体需在一次跳转范围内
+	if len(body)+2 > 0xff {
+		return nil, fmt.Errorf("too many argument conditions")
+	}
+
+	// 占位跳转改写为跳到返回动作之后
+	for i, ins := range body {
+		jump, ok := ins.(bpf.JumpIf)
+		if !ok {
+			continue
+		}
+		fail := uint8(len(body) - i)
+		if jump.SkipTrue == seccompSkipFail {
+			jump.SkipTrue = fail
+		}
+		if jump.SkipFalse == seccompSkipFail {
+			jump.SkipFalse = fail
+		}
+		body[i] = jump
+	}
+	return body, nil
+}
+
+// knownSyscall 系统调用名是否存在于任一架构的系统调用表中
+func knownSyscall(name string) bool {
+	for _, table := range seccompSyscallTables {
+		if _, ok := table[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// nativeSeccompArch 宿主机架构对应的seccomp架构名
+func nativeSeccompArch() (string, error) {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "SCMP_ARCH_X86_64", nil
+	case "386":
+		return "SCMP_ARCH_X86", nil
+	case "arm64":
+		return "SCMP_ARCH_AARCH64", nil
+	}
+	return "", fmt.Errorf("unsupported seccomp architecture: %s", runtime.GOARCH)
+}
+
+// ApparmorManager AppArmor管理器
+type ApparmorManager struct {
+	profiles map[string]*AppArmorProfile
+	mutex    sync.RWMutex
+}
+
+// AppArmorProfile AppArmor配置文件
+type AppArmorProfile struct {
+	Type             string
+	LocalhostProfile *string
+	Rules            []string
+}
+
+func NewApparmorManager() *ApparmorManager {
+	return &ApparmorManager{
+		profiles: make(map[string]*AppArmorProfile),
+	}
+}
+
+func (am *ApparmorManager) LoadProfile(name string, profile *AppArmorProfile) error {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	am.profiles[name] = profile
+	fmt.Printf("加载AppArmor配置文件: %s\n", name)
+	return nil
+}
+
+func (am *ApparmorManager) ApplyProfile(containerID string, profileName string) error {
+	am.mutex.RLock()
+	profile, exists := am.profiles[profileName]
+	am.mutex.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("apparmor profile not found: %s", profileName)
+	}
+
+	// 使用profile防止未使用错误
+	if profile == nil {
+		return fmt.Errorf("apparmor profile is nil: %s", profileName)
+	}
+
+	fmt.Printf("应用AppArmor配置: 容器 %s 使用配置 %s\n", containerID[:12], profileName)
+	return nil
+}
+
+// ==================
+// 7. 容器编排引擎
+// ==================
+
+// ContainerOrchestrator 容器编排器
+type ContainerOrchestrator struct {
+	runtime     *ContainerRuntime
+	scheduler   *ContainerScheduler
+	serviceMgr  *ServiceManager
+	deployments map[string]*Deployment
+	services    map[string]*Service
+	pods        map[string]*Pod
+	nodes       map[string]*Node
+	config      OrchestratorConfig
+	configMaps  map[string]*ConfigMap
+	secrets     map[string]*Secret
+	eventBus    *ContainerEventBus
+	monitor     *ClusterMonitor
+	serviceIPs  *IPAddressManager // ClusterIP地址池，首次创建服务时按config.ClusterCIDR登记
+	serviceCIDR string
+	nodePorts   map[int32]*nodePortProxy // 已分配的NodePort及其转发代理
+	mutex       sync.RWMutex
+	running     bool
+}
+
+// Pod 容器组
+type Pod struct {
+	ID               string
+	Name             string
+	Namespace        string
+	Labels           map[string]string
+	Annotations      map[string]string
+	Containers       []*Container
+	InitContainers   []*Container
+	Volumes          []*Volume
+	RestartPolicy    RestartPolicy
+	DNSPolicy        DNSPolicy
+	NodeName         string
+	Status           PodStatus
+	Spec             *PodSpec
+	Priority         int          // 优先级越高越优先调度，资源不足时可抢占更低优先级的Pod
+	ResourceRequests ResourceList // 全部容器资源请求的总和，创建时计算
+	CreatedAt        time.Time
+	StartedAt        time.Time
+	node             *Node // 为Pod预留资源的节点，由co.mutex保护
+}
+
+// Service 服务
+type Service struct {
+	ID           string
+	Name         string
+	Namespace    string
+	Type         ServiceType
+	Selector     map[string]string
+	Ports        []ServicePort
+	ClusterIP    string
+	ExternalIPs  []string
+	LoadBalancer *LoadBalancerStatus
+	CreatedAt    time.Time
+}
+
+// Deployment 部署
+type Deployment struct {
+	ID        string
+	Name      string
+	Namespace string
+	Replicas  int32
+	Selector  map[string]string
+	Template  *PodTemplate
+	Strategy  DeploymentStrategy
+	Status    DeploymentStatus
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	reconcile sync.Mutex // 串行化同一Deployment的调和，避免重复创建或删除Pod
+}
+
+// Node 节点
+type Node struct {
+	ID          string
+	Name        string
+	Address     string
+	Status      NodeStatus
+	Labels      map[string]string
+	Capacity    ResourceList
+	Allocatable ResourceList
+	Allocated   ResourceList // 已绑定Pod的资源请求总和，随绑定和解绑更新
+	Conditions  []NodeCondition
+	Info        NodeSystemInfo
+	CreatedAt   time.Time
+	pods        map[string]*Pod // 已绑定到节点的Pod，由co.mutex保护
+}
+
+// ContainerScheduler 容器调度器
+type ContainerScheduler struct {
+	algorithms map[string]SchedulingAlgorithm
+	policies   []SchedulingPolicy
+	queue      *SchedulingQueue
+	cache      *SchedulerCache
+	mutex      sync.RWMutex
+}
+
+// SchedulingAlgorithm 调度算法接口
+type SchedulingAlgorithm interface {
+	Name() string
+	Schedule(pod *Pod, nodes []*Node) (*Node, error)
+	Preempt(pod *Pod, nodes []*Node) ([]*Pod, *Node, error)
+}
+
+func NewContainerOrchestrator(runtime *ContainerRuntime) *ContainerOrchestrator {
+	return &ContainerOrchestrator{
+		runtime:     runtime,
+		scheduler:   NewContainerScheduler(),
+		serviceMgr:  NewServiceManager(),
+		deployments: make(map[string]*Deployment),
+		services:    make(map[string]*Service),
+		pods:        make(map[string]*Pod),
+		nodes:       make(map[string]*Node),
+		configMaps:  make(map[string]*ConfigMap),
+		secrets:     make(map[string]*Secret),
+		eventBus:    NewContainerEventBus(EventBusConfig{}),
+		monitor:     NewClusterMonitor(),
+		nodePorts:   make(map[int32]*nodePortProxy),
+	}
+}
+
+func (co *ContainerOrchestrator) Start() error {
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
+
+	if co.running {
+		return fmt.Errorf("orchestrator already running")
+	}
+
+	// 启动调度器
+	go co.schedulingLoop()
+
+	// 启动服务管理
+	go co.serviceLoop()
+
+	// 启动监控
+	go co.monitorLoop()
+
+	co.running = true
+	fmt.Println("容器编排器已启动")
+	return nil
+}
+
+func (co *ContainerOrchestrator) CreatePod(podSpec *PodSpec) (*Pod, error) {
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
+
+	pod := &Pod{
+		ID:         generatePodID(),
+		Name:       podSpec.Name,
+		Namespace:  podSpec.Namespace,
+		Labels:     podSpec.Labels,
+		Containers: make([]*Container, 0),
+		Status:     PodPending,
+		Spec:       podSpec,
+		Priority:   podSpec.Priority,
+		CreatedAt:  time.Now(),
+	}
+
+	if err := validateLabelRules(podSpec.Affinity); err != nil {
+		return nil, fmt.Errorf("invalid affinity: %v", err)
+	}
+	if err := validateLabelRules(podSpec.AntiAffinity); err != nil {
+		return nil, fmt.Errorf("invalid anti-affinity: %v", err)
+	}
+
+	// 校验并汇总资源请求，调度时直接使用汇总结果
+	var requests resourceAmount
+	for _, containerSpec := range podSpec.Containers {
+		amount, err := parseResourceList(containerSpec.ResourceRequests)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %v", containerSpec.Name, err)
+		}
+		requests = requests.add(amount)
+	}
+	pod.ResourceRequests = requests.resourceList()
+
+	// 创建Pod中的容器
+	for _, containerSpec := range podSpec.Containers {
+		container, err := co.runtime.CreateContainer(&ContainerConfig{
+			Image:           containerSpec.Image,
+			Cmd:             containerSpec.Command,
+			Env:             containerSpec.Env,
+			WorkingDir:      containerSpec.WorkingDir,
+			SecurityContext: containerSpec.SecurityContext,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create container: %v", err)
+		}
+		pod.Containers = append(pod.Containers, container)
+	}
+
+	co.pods[pod.ID] = pod
+	fmt.Printf("创建Pod: %s (容器数: %d)\n", pod.Name, len(pod.Containers))
+
+	// 提交给调度器
+	go co.schedulePod(pod)
+
+	return pod, nil
+}
+
+func (co *ContainerOrchestrator) schedulePod(pod *Pod) {
+	if _, err := co.bindPod(pod); err != nil {
+		fmt.Printf("Pod调度失败: %s - %v\n", pod.Name, err)
+		return
+	}
+
+	// 启动Pod中的容器
+	go co.startPodContainers(pod)
+}
+
+// bindPod 为Pod选择节点并绑定。没有节点能容纳时尝试抢占更低优先级的Pod，
+// 被抢占的Pod先停止并删除，之后才绑定新Pod
+func (co *ContainerOrchestrator) bindPod(pod *Pod) (*Node, error) {
+	// 获取可用节点
+	nodes := co.getAvailableNodes()
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no available nodes")
 	}
 
-	return stats
-}
-
-func (cm *CgroupManager) parseCPUStats(data string) map[string]int64 {
-	stats := make(map[string]int64)
-	lines := strings.Split(data, "\n")
+	// 选择调度算法
+	algorithm := co.scheduler.getDefaultAlgorithm()
 
-	for _, line := range lines {
-		if line == "" {
-			continue
+	// 选择节点与预留资源在同一临界区内完成，避免并发调度的Pod占用同一份资源
+	co.mutex.Lock()
+	// 先按节点选择器和亲和性过滤，调度算法只在剩余节点中打分
+	nodes = filterNodesByAffinity(pod, nodes)
+	if len(nodes) == 0 {
+		co.mutex.Unlock()
+		return nil, fmt.Errorf("no node satisfies affinity for pod %s", pod.Name)
+	}
+	selectedNode, err := algorithm.Schedule(pod, nodes)
+	var victims []*Pod
+	if err != nil {
+		var preemptErr error
+		victims, selectedNode, preemptErr = algorithm.Preempt(pod, nodes)
+		if preemptErr != nil {
+			co.mutex.Unlock()
+			return nil, fmt.Errorf("%v; preemption failed: %v", err, preemptErr)
 		}
-		parts := strings.Fields(line)
-		if len(parts) == 2 {
-			if value, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
-				stats[parts[0]] = value
-			}
+		for _, victim := range victims {
+			co.unbindPodLocked(victim)
 		}
 	}
+	selectedNode.bindPod(pod)
+	pod.node = selectedNode
+	co.mutex.Unlock()
 
-	return stats
-}
-
-func (cm *CgroupManager) removeAllProcesses(cgroup *Cgroup) error {
-	// 将所有进程移动到根cgroup
-	for _, pid := range cgroup.Processes {
-		if err := cm.moveProcessToRoot(cgroup.Subsystem, pid); err != nil {
-			fmt.Printf("警告: 无法移动进程 %d: %v\n", pid, err)
+	for _, victim := range victims {
+		if err := co.deletePod(victim, fmt.Sprintf("preempted by %s", pod.Name)); err != nil {
+			fmt.Printf("停止被抢占的Pod失败: %s - %v\n", victim.Name, err)
 		}
 	}
-	cgroup.Processes = cgroup.Processes[:0]
-	return nil
-}
-
-func (cm *CgroupManager) moveProcessToRoot(subsystem string, pid int) error {
-	rootProcsFile := filepath.Join(cm.mountPoint, subsystem, "cgroup.procs")
-	return security.SecureWriteFile(rootProcsFile, []byte(strconv.Itoa(pid)), &security.SecureFileOptions{
-		Mode:      security.DefaultFileMode,
-		CreateDir: false,
-	})
-}
 
-// ==================
-// 4. 存储管理系统
-// ==================
+	// 绑定到节点
+	pod.NodeName = selectedNode.Name
+	pod.Status = PodScheduled
 
-// StorageManager 存储管理器
-type StorageManager struct {
-	drivers      map[string]StorageDriver
-	activeDriver StorageDriver
-	graphRoot    string
-	runRoot      string
-	layers       map[string]*Layer
-	images       map[string]*ContainerImage
-	mutex        sync.RWMutex
+	fmt.Printf("Pod调度成功: %s -> 节点 %s\n", pod.Name, selectedNode.Name)
+	return selectedNode, nil
 }
 
-// StorageDriver 存储驱动接口
-type StorageDriver interface {
-	Name() string
-	Initialize(root string) error
-	CreateLayer(id string, parent string) (*Layer, error)
-	RemoveLayer(id string) error
-	GetLayer(id string) (*Layer, error)
-	MountLayer(id string, mountPoint string) error
-	UnmountLayer(id string) error
-	GetLayerSize(id string) (int64, error)
-	Cleanup() error
+// unbindPodLocked 释放Pod在节点上预留的资源，调用方需持有co.mutex
+func (co *ContainerOrchestrator) unbindPodLocked(pod *Pod) {
+	if pod.node != nil {
+		delete(pod.node.pods, pod.ID)
+		pod.node.Allocated = pod.node.requested().resourceList()
+		pod.node = nil
+	}
 }
 
-// Layer 镜像层
-type Layer struct {
-	ID         string
-	Parent     string
-	Size       int64
-	CreatedAt  time.Time
-	MountPoint string
-	Mounted    bool
-	Metadata   map[string]interface{}
-}
+func (co *ContainerOrchestrator) startPodContainers(pod *Pod) {
+	// 注入ConfigMap和Secret
+	if err := co.injectPodConfig(pod); err != nil {
+		fmt.Printf("Pod配置注入失败: %s - %v\n", pod.Name, err)
+		pod.Status = PodFailed
+		return
+	}
 
-// ContainerImage 容器镜像
-type ContainerImage struct {
-	ID           string
-	RepoTags     []string
-	RepoDigests  []string
-	Parent       string
-	Comment      string
-	Created      time.Time
-	Config       *ImageConfig
-	Architecture string
-	Os           string
-	Size         int64
-	VirtualSize  int64
-	Labels       map[string]string
-	Layers       []string
-}
+	pod.Status = PodRunning
+	pod.StartedAt = time.Now()
 
-// ImageConfig 镜像配置
-type ImageConfig struct {
-	Hostname        string
-	Domainname      string
-	User            string
-	AttachStdin     bool
-	AttachStdout    bool
-	AttachStderr    bool
-	ExposedPorts    map[string]struct{}
-	Tty             bool
-	OpenStdin       bool
-	StdinOnce       bool
-	Env             []string
-	Cmd             []string
-	Healthcheck     *HealthConfig
-	ArgsEscaped     bool
-	Image           string
-	Volumes         map[string]struct{}
-	WorkingDir      string
-	Entrypoint      []string
-	NetworkDisabled bool
-	MacAddress      string
-	OnBuild         []string
-	Labels          map[string]string
-	StopSignal      string
-	StopTimeout     *int
-	Shell           []string
+	for _, container := range pod.Containers {
+		if err := co.runtime.StartContainer(container.ID); err != nil {
+			fmt.Printf("启动容器失败: %s - %v\n", container.ID[:12], err)
+			pod.Status = PodFailed
+			return
+		}
+	}
+
+	fmt.Printf("Pod运行中: %s (节点: %s)\n", pod.Name, pod.NodeName)
 }
 
-func NewStorageManager() *StorageManager {
-	sm := &StorageManager{
-		drivers: make(map[string]StorageDriver),
-		layers:  make(map[string]*Layer),
-		images:  make(map[string]*ContainerImage),
-	}
+func (co *ContainerOrchestrator) CreateDeployment(deploySpec *DeploymentSpec) (*Deployment, error) {
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
 
-	// 注册存储驱动
-	sm.RegisterDriver(&OverlayFSDriver{})
-	sm.RegisterDriver(&AufsDriver{})
-	sm.RegisterDriver(&DeviceMapperDriver{})
+	deployment := &Deployment{
+		ID:        generateDeploymentID(),
+		Name:      deploySpec.Name,
+		Namespace: deploySpec.Namespace,
+		Replicas:  deploySpec.Replicas,
+		Selector:  deploySpec.Selector,
+		Template:  deploySpec.Template,
+		Strategy:  deploySpec.Strategy,
+		Status:    DeploymentProgressing,
+		CreatedAt: time.Now(),
+	}
 
-	return sm
-}
+	co.deployments[deployment.ID] = deployment
+	fmt.Printf("创建Deployment: %s (副本数: %d)\n", deployment.Name, deployment.Replicas)
 
-func (sm *StorageManager) RegisterDriver(driver StorageDriver) {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
+	// 创建副本Pod，与模板更新共用滚动更新流程
+	go co.reconcileDeployment(deployment)
 
-	sm.drivers[driver.Name()] = driver
-	fmt.Printf("注册存储驱动: %s\n", driver.Name())
+	return deployment, nil
 }
 
-func (sm *StorageManager) Initialize(driverName string) error {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
+// UpdateDeployment 更新Deployment的Pod模板，之后由reconcileDeployment按滚动更新策略替换旧Pod
+func (co *ContainerOrchestrator) UpdateDeployment(deploymentID string, template *PodTemplate) error {
+	if template == nil {
+		return fmt.Errorf("deployment template is required")
+	}
 
-	driver, exists := sm.drivers[driverName]
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
+
+	deployment, exists := co.deployments[deploymentID]
 	if !exists {
-		return fmt.Errorf("storage driver not found: %s", driverName)
+		return fmt.Errorf("deployment not found: %s", deploymentID)
 	}
-
-	if err := driver.Initialize(sm.graphRoot); err != nil {
-		return err
+	if templateHash(deployment.Template) == templateHash(template) {
+		return nil
 	}
 
-	sm.activeDriver = driver
-	fmt.Printf("初始化存储驱动: %s\n", driverName)
+	deployment.Template = template
+	deployment.Status = DeploymentProgressing
+	deployment.UpdatedAt = time.Now()
+	fmt.Printf("更新Deployment: %s (修订版本: %s)\n", deployment.Name, templateHash(template))
 	return nil
 }
 
-func (sm *StorageManager) PrepareLayer(image *ContainerImage, mountPoint string) error {
-	if sm.activeDriver == nil {
-		return fmt.Errorf("no active storage driver")
-	}
+func (co *ContainerOrchestrator) getAvailableNodes() []*Node {
+	co.mutex.RLock()
+	defer co.mutex.RUnlock()
 
-	// 为镜像的每一层创建layer
-	var parentID string
-	for _, layerID := range image.Layers {
-		layer, err := sm.activeDriver.CreateLayer(layerID, parentID)
-		if err != nil {
-			return err
+	nodes := make([]*Node, 0)
+	for _, node := range co.nodes {
+		if node.Status == NodeReady {
+			nodes = append(nodes, node)
 		}
-		sm.layers[layerID] = layer
-		parentID = layerID
-	}
-
-	// 挂载顶层
-	if len(image.Layers) > 0 {
-		topLayerID := image.Layers[len(image.Layers)-1]
-		return sm.activeDriver.MountLayer(topLayerID, mountPoint)
 	}
+	// 按名称排序，使调度结果可预测
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
 
-	return nil
+	return nodes
 }
 
-// ==================
-// 4.1 OverlayFS驱动实现
-// ==================
-
-// OverlayFSDriver OverlayFS存储驱动
-type OverlayFSDriver struct {
-	root      string
-	layersDir string
-	diffsDir  string
-}
+func (co *ContainerOrchestrator) schedulingLoop() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
 
-func (od *OverlayFSDriver) Name() string {
-	return "overlay2"
+	for co.running {
+		select {
+		case <-ticker.C:
+			co.reconcileState()
+		}
+	}
 }
 
-func (od *OverlayFSDriver) Initialize(root string) error {
-	od.root = root
-	od.layersDir = filepath.Join(root, "overlay2")
-	od.diffsDir = filepath.Join(od.layersDir, "l")
+func (co *ContainerOrchestrator) serviceLoop() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
 
-	// 创建目录结构
-	dirs := []string{od.layersDir, od.diffsDir}
-	for _, dir := range dirs {
-		// #nosec G301 -- OverlayFS驱动系统目录，需要0755权限支持Docker镜像层管理
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return err
+	for co.running {
+		select {
+		case <-ticker.C:
+			co.updateServices()
 		}
 	}
-
-	fmt.Printf("初始化OverlayFS驱动: %s\n", root)
-	return nil
 }
-
-func (od *OverlayFSDriver) CreateLayer(id string, parent string) (*Layer, error) {
-	layerDir := filepath.Join(od.layersDir, id)
-	diffDir := filepath.Join(layerDir, "diff")
-	workDir := filepath.Join(layerDir, "work")
-	mergedDir := filepath.Join(layerDir, "merged")
-
-	// 创建目录
-	dirs := []string{layerDir, diffDir, workDir, mergedDir}
-	for _, dir := range dirs {
-		// #nosec G301 -- OverlayFS镜像层目录（diff/work/merged），需要0755支持容器文件系统操作
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return nil, err
+
+func (co *ContainerOrchestrator) monitorLoop() {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for co.running {
+		select {
+		case <-ticker.C:
+			co.collectMetrics()
 		}
 	}
+}
 
-	layer := &Layer{
-		ID:        id,
-		Parent:    parent,
-		CreatedAt: time.Now(),
-		Metadata:  make(map[string]interface{}),
+// collectMetrics 在co.mutex下复制Pod列表后采样，避免采样期间持有编排器锁
+func (co *ContainerOrchestrator) collectMetrics() {
+	co.mutex.RLock()
+	pods := make([]*Pod, 0, len(co.pods))
+	for _, pod := range co.pods {
+		snapshot := *pod
+		snapshot.Containers = append([]*Container(nil), pod.Containers...)
+		pods = append(pods, &snapshot)
 	}
+	co.mutex.RUnlock()
 
-	// 创建链接文件
-	linkFile := filepath.Join(layerDir, "link")
-	linkName := generateShortID()
-	if err := security.SecureWriteFile(linkFile, []byte(linkName), &security.SecureFileOptions{
-		Mode:      security.DefaultFileMode,
-		CreateDir: false,
-	}); err != nil {
-		return nil, err
-	}
+	co.monitor.CollectMetrics(pods, co.runtime.cgroups, time.Now())
+}
 
-	// 在l目录下创建符号链接
-	linkPath := filepath.Join(od.diffsDir, linkName)
-	if err := os.Symlink(diffDir, linkPath); err != nil {
-		return nil, err
+func (co *ContainerOrchestrator) reconcileState() {
+	// 确保期望状态与实际状态一致
+	co.mutex.RLock()
+	deployments := make([]*Deployment, 0, len(co.deployments))
+	for _, deployment := range co.deployments {
+		deployments = append(deployments, deployment)
 	}
+	co.mutex.RUnlock()
 
-	fmt.Printf("创建OverlayFS层: %s (父层: %s)\n", id, parent)
-	return layer, nil
+	for _, deployment := range deployments {
+		co.reconcileDeployment(deployment)
+	}
 }
 
-func (od *OverlayFSDriver) MountLayer(id string, mountPoint string) error {
-	layerDir := filepath.Join(od.layersDir, id)
-	diffDir := filepath.Join(layerDir, "diff")
-	workDir := filepath.Join(layerDir, "work")
+func (co *ContainerOrchestrator) reconcileDeployment(deployment *Deployment) {
+	deployment.reconcile.Lock()
+	defer deployment.reconcile.Unlock()
 
-	// 构建OverlayFS挂载选项
-	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", diffDir, diffDir, workDir)
+	co.mutex.RLock()
+	template := deployment.Template
+	co.mutex.RUnlock()
 
-	// 执行挂载
-	err := windowsMount("overlay", mountPoint, "overlay", 0, options)
-	if err != nil {
-		return fmt.Errorf("failed to mount overlay: %v", err)
+	hash := templateHash(template)
+	newPods, oldPods := co.deploymentPods(deployment, hash)
+
+	if len(oldPods) > 0 || int32(len(newPods)) < deployment.Replicas {
+		// 模板变更或副本不足时按滚动更新策略推进一步
+		co.rolloutStep(deployment, template, hash, newPods, oldPods)
+	} else if excess := int32(len(newPods)) - deployment.Replicas; excess > 0 {
+		// 需要删除多余的Pod
+		fmt.Printf("Deployment %s 需要删除 %d 个Pod\n", deployment.Name, excess)
+		co.scaleDown(newPods, excess)
 	}
 
-	fmt.Printf("挂载OverlayFS层: %s -> %s\n", id, mountPoint)
-	return nil
+	co.updateDeploymentStatus(deployment, hash)
 }
 
-func (od *OverlayFSDriver) UnmountLayer(id string) error {
-	layerDir := filepath.Join(od.layersDir, id)
-	mergedDir := filepath.Join(layerDir, "merged")
+// 滚动更新参数的默认值：先多创建一个新Pod，旧Pod在新Pod就绪后再删除
+const (
+	podTemplateHashLabel  = "pod-template-hash"
+	defaultMaxSurge       = 1
+	defaultMaxUnavailable = 0
+)
 
-	err := windowsUnmount(mergedDir, 0)
+// templateHash 计算Pod模板的修订版本哈希，写入Pod标签用于区分新旧Pod
+func templateHash(template *PodTemplate) string {
+	data, err := json.Marshal(template)
 	if err != nil {
-		return fmt.Errorf("failed to unmount layer: %v", err)
+		return ""
 	}
-
-	fmt.Printf("卸载OverlayFS层: %s\n", id)
-	return nil
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:10]
 }
 
-func (od *OverlayFSDriver) GetLayer(id string) (*Layer, error) {
-	layerDir := filepath.Join(od.layersDir, id)
-	if _, err := os.Stat(layerDir); os.IsNotExist(err) {
-		return nil, fmt.Errorf("layer not found: %s", id)
+// rollingUpdateBounds 返回滚动更新的maxSurge和maxUnavailable，两者都为0时无法推进，使用默认值
+func (ds DeploymentStrategy) rollingUpdateBounds() (int32, int32) {
+	maxSurge, maxUnavailable := ds.MaxSurge, ds.MaxUnavailable
+	if maxSurge < 0 {
+		maxSurge = 0
 	}
-
-	return &Layer{
-		ID:       id,
-		Metadata: make(map[string]interface{}),
-	}, nil
+	if maxUnavailable < 0 {
+		maxUnavailable = 0
+	}
+	if maxSurge == 0 && maxUnavailable == 0 {
+		return defaultMaxSurge, defaultMaxUnavailable
+	}
+	return maxSurge, maxUnavailable
 }
 
-func (od *OverlayFSDriver) GetLayerSize(id string) (int64, error) {
-	layerDir := filepath.Join(od.layersDir, id, "diff")
-	return calculateDirectorySize(layerDir)
-}
+// deploymentPods 返回属于Deployment的Pod，按修订版本分为新旧两组，各自按创建时间排序
+func (co *ContainerOrchestrator) deploymentPods(deployment *Deployment, hash string) ([]*Pod, []*Pod) {
+	co.mutex.RLock()
+	defer co.mutex.RUnlock()
 
-func (od *OverlayFSDriver) RemoveLayer(id string) error {
-	layerDir := filepath.Join(od.layersDir, id)
-	return os.RemoveAll(layerDir)
+	var newPods, oldPods []*Pod
+	for _, pod := range co.pods {
+		if pod.Namespace != deployment.Namespace || !co.labelsMatch(pod.Labels, deployment.Selector) {
+			continue
+		}
+		if pod.Labels[podTemplateHashLabel] == hash {
+			newPods = append(newPods, pod)
+		} else {
+			oldPods = append(oldPods, pod)
+		}
+	}
+	for _, pods := range [][]*Pod{newPods, oldPods} {
+		sort.Slice(pods, func(i, j int) bool {
+			if !pods[i].CreatedAt.Equal(pods[j].CreatedAt) {
+				return pods[i].CreatedAt.Before(pods[j].CreatedAt)
+			}
+			return pods[i].ID < pods[j].ID
+		})
+	}
+	return newPods, oldPods
 }
 
-func (od *OverlayFSDriver) Cleanup() error {
-	fmt.Println("清理OverlayFS驱动")
-	return nil
+// countAvailablePods 统计运行中的Pod数量
+func countAvailablePods(pods []*Pod) int32 {
+	var count int32
+	for _, pod := range pods {
+		if pod.Status == PodRunning {
+			count++
+		}
+	}
+	return count
 }
 
-// ==================
-// 5. 网络管理系统
-// ==================
+// rolloutStep 推进一步滚动更新：先在可用数不低于Replicas-maxUnavailable的前提下删除旧Pod，
+// 再在总数不超过Replicas+maxSurge的前提下创建新Pod
+func (co *ContainerOrchestrator) rolloutStep(deployment *Deployment, template *PodTemplate, hash string, newPods, oldPods []*Pod) {
+	maxSurge, maxUnavailable := deployment.Strategy.rollingUpdateBounds()
+	total := int32(len(newPods) + len(oldPods))
+	available := countAvailablePods(newPods) + countAvailablePods(oldPods)
 
-// NetworkManager 网络管理器
-type NetworkManager struct {
-	networks   map[string]*ContainerNetwork
-	bridges    map[string]*NetworkBridge
-	interfaces map[string]*NetworkInterface
-	ipam       *IPAddressManager
-	drivers    map[string]NetworkDriver
-	config     NetworkConfig
-	mutex      sync.RWMutex
-}
+	// 未就绪的旧Pod不影响可用数，优先删除；就绪的旧Pod按可用数余量删除，先删最早创建的
+	removable := available - (deployment.Replicas - maxUnavailable)
+	for _, pod := range oldPods {
+		ready := pod.Status == PodRunning
+		if ready && removable <= 0 {
+			continue
+		}
+		if err := co.deletePod(pod, "rolling update"); err != nil {
+			fmt.Printf("删除旧Pod失败: %s - %v\n", pod.Name, err)
+			continue
+		}
+		if ready {
+			removable--
+		}
+		total--
+	}
 
-// ContainerNetwork 容器网络
-type ContainerNetwork struct {
-	ID         string
-	Name       string
-	Driver     string
-	Scope      string
-	Internal   bool
-	Attachable bool
-	Ingress    bool
-	IPAM       *NetworkIPAM
-	ConfigFrom *NetworkConfigReference
-	ConfigOnly bool
-	Containers map[string]*EndpointConfig
-	Options    map[string]string
-	Labels     map[string]string
-	Created    time.Time
+	creatable := deployment.Replicas + maxSurge - total
+	if missing := deployment.Replicas - int32(len(newPods)); missing < creatable {
+		creatable = missing
+	}
+	for i := int32(0); i < creatable; i++ {
+		pod, err := co.createDeploymentPod(deployment, template, hash)
+		if err != nil {
+			fmt.Printf("创建副本Pod失败: %v\n", err)
+			return
+		}
+		fmt.Printf("滚动更新创建Pod: %s (修订版本: %s)\n", pod.Name, hash)
+	}
 }
 
-// NetworkIPAM IP地址管理
-type NetworkIPAM struct {
-	Driver  string
-	Options map[string]string
-	Config  []IPAMConfig
+// createDeploymentPod 按模板创建一个带有修订版本标签的副本Pod
+func (co *ContainerOrchestrator) createDeploymentPod(deployment *Deployment, template *PodTemplate, hash string) (*Pod, error) {
+	labels := copyStringMap(deployment.Selector)
+	labels[podTemplateHashLabel] = hash
+	return co.CreatePod(&PodSpec{
+		Name:       fmt.Sprintf("%s-%s-%05d", deployment.Name, hash, secureRandomInt63()%100000),
+		Namespace:  deployment.Namespace,
+		Labels:     labels,
+		Containers: template.Spec.Containers,
+	})
 }
 
-// IPAMConfig IPAM配置
-type IPAMConfig struct {
-	Subnet     string
-	IPRange    string
-	Gateway    string
-	AuxAddress map[string]string
-}
+// scaleDown 删除多余的Pod：优先删除未就绪的Pod，同为就绪或未就绪时删除最新创建的
+func (co *ContainerOrchestrator) scaleDown(pods []*Pod, excess int32) {
+	victims := append([]*Pod(nil), pods...)
+	sort.SliceStable(victims, func(i, j int) bool {
+		readyI, readyJ := victims[i].Status == PodRunning, victims[j].Status == PodRunning
+		if readyI != readyJ {
+			return !readyI
+		}
+		if !victims[i].CreatedAt.Equal(victims[j].CreatedAt) {
+			return victims[i].CreatedAt.After(victims[j].CreatedAt)
+		}
+		return victims[i].ID > victims[j].ID
+	})
+	if int(excess) < len(victims) {
+		victims = victims[:excess]
+	}
 
-// NetworkInterface 网络接口
-type NetworkInterface struct {
-	Name         string
-	Type         string
-	HardwareAddr string
-	MTU          int
-	IPAddresses  []string
-	Gateway      string
-	Bridge       string
-	VethPeer     string
-	Namespace    string
-	Created      time.Time
+	for _, pod := range victims {
+		if err := co.deletePod(pod, "scale down"); err != nil {
+			fmt.Printf("缩容删除Pod失败: %s - %v\n", pod.Name, err)
+		}
+	}
 }
 
-// NetworkBridge 网络桥接
-type NetworkBridge struct {
-	Name       string
-	Interface  string
-	IPAddress  string
-	Subnet     string
-	Gateway    string
-	MTU        int
-	Interfaces []string
-	Created    time.Time
-}
+// ScaleDeployment 修改Deployment的副本数，由reconcileDeployment创建或删除Pod
+func (co *ContainerOrchestrator) ScaleDeployment(deploymentID string, replicas int32) error {
+	if replicas < 0 {
+		return fmt.Errorf("invalid replica count: %d", replicas)
+	}
 
-// NetworkDriver 网络驱动接口
-type NetworkDriver interface {
-	Name() string
-	CreateNetwork(config *NetworkConfig) (*ContainerNetwork, error)
-	DeleteNetwork(networkID string) error
-	CreateEndpoint(networkID, containerID string) (*EndpointConfig, error)
-	DeleteEndpoint(networkID, containerID string) error
-	Join(networkID, containerID string) error
-	Leave(networkID, containerID string) error
+	co.mutex.RLock()
+	deployment, exists := co.deployments[deploymentID]
+	co.mutex.RUnlock()
+	if !exists {
+		return fmt.Errorf("deployment not found: %s", deploymentID)
+	}
+
+	// 与调和串行，避免调和过程中副本数变化
+	deployment.reconcile.Lock()
+	deployment.Replicas = replicas
+	deployment.reconcile.Unlock()
+
+	fmt.Printf("调整Deployment副本数: %s -> %d\n", deployment.Name, replicas)
+	return nil
 }
 
-func NewNetworkManager() *NetworkManager {
-	nm := &NetworkManager{
-		networks:   make(map[string]*ContainerNetwork),
-		bridges:    make(map[string]*NetworkBridge),
-		interfaces: make(map[string]*NetworkInterface),
-		ipam:       NewIPAddressManager(),
-		drivers:    make(map[string]NetworkDriver),
+// deletePod 停止并删除Pod的全部容器，再从编排器中移除
+func (co *ContainerOrchestrator) deletePod(pod *Pod, reason string) error {
+	for _, container := range pod.Containers {
+		if container.IsRunning() {
+			if err := co.runtime.StopContainer(container.ID, 0); err != nil {
+				return fmt.Errorf("failed to stop container %s: %v", container.ID[:12], err)
+			}
+		}
+		if err := co.runtime.RemoveContainer(container.ID, true); err != nil {
+			return fmt.Errorf("failed to remove container %s: %v", container.ID[:12], err)
+		}
 	}
 
-	// 注册网络驱动
-	nm.RegisterDriver(&BridgeDriver{})
-	nm.RegisterDriver(&HostDriver{})
-	nm.RegisterDriver(&OverlayDriver{})
+	co.mutex.Lock()
+	co.unbindPodLocked(pod)
+	delete(co.pods, pod.ID)
+	co.mutex.Unlock()
+
+	fmt.Printf("删除Pod: %s (%s)\n", pod.Name, reason)
+	co.eventBus.Publish(&ContainerEvent{
+		Type:      EventPodStop,
+		Pod:       pod,
+		Message:   reason,
+		Timestamp: time.Now(),
+	})
+	return nil
+}
 
-	return nm
+// updateDeploymentStatus 只有全部Pod都是当前修订版本且可用数达到Replicas时才是Available
+func (co *ContainerOrchestrator) updateDeploymentStatus(deployment *Deployment, hash string) {
+	newPods, oldPods := co.deploymentPods(deployment, hash)
+	status := DeploymentProgressing
+	if len(oldPods) == 0 && countAvailablePods(newPods) >= deployment.Replicas {
+		status = DeploymentAvailable
+	}
+
+	co.mutex.Lock()
+	if deployment.Status != status {
+		deployment.Status = status
+		deployment.UpdatedAt = time.Now()
+	}
+	co.mutex.Unlock()
 }
 
-func (nm *NetworkManager) RegisterDriver(driver NetworkDriver) {
-	nm.mutex.Lock()
-	defer nm.mutex.Unlock()
+func (co *ContainerOrchestrator) countRunningPodsForDeployment(deployment *Deployment) int32 {
+	var count int32
+	for _, pod := range co.pods {
+		if pod.Namespace == deployment.Namespace {
+			// 检查标签选择器匹配
+			if co.labelsMatch(pod.Labels, deployment.Selector) && pod.Status == PodRunning {
+				count++
+			}
+		}
+	}
+	return count
+}
 
-	nm.drivers[driver.Name()] = driver
-	fmt.Printf("注册网络驱动: %s\n", driver.Name())
+func (co *ContainerOrchestrator) labelsMatch(podLabels, selector map[string]string) bool {
+	for key, value := range selector {
+		if podLabels[key] != value {
+			return false
+		}
+	}
+	return true
 }
 
-func (nm *NetworkManager) Initialize() error {
-	// 创建默认网络
-	defaultConfig := &NetworkConfig{
-		Name:   "bridge",
-		Driver: "bridge",
-		IPAM: &NetworkIPAM{
-			Driver: "default",
-			Config: []IPAMConfig{
-				{
-					Subnet:  "172.17.0.0/16",
-					Gateway: "172.17.0.1",
-				},
-			},
-		},
+func (co *ContainerOrchestrator) updateServices() {
+	co.mutex.RLock()
+	defer co.mutex.RUnlock()
+
+	// 更新服务端点
+	for _, service := range co.services {
+		endpoints := co.getServiceEndpoints(service)
+		fmt.Printf("服务 %s 有 %d 个端点\n", service.Name, len(endpoints))
 	}
+}
 
-	_, err := nm.CreateNetwork(defaultConfig)
-	if err != nil {
-		return fmt.Errorf("failed to create default network: %v", err)
+// getServiceEndpoints 返回标签匹配且正在运行的Pod的"IP:端口"端点，按服务端口的TargetPort
+// （未设置时为Port）展开并排序；没有地址的Pod被跳过。调用方需持有co.mutex
+func (co *ContainerOrchestrator) getServiceEndpoints(service *Service) []string {
+	endpoints := make([]string, 0)
+	for _, port := range service.Ports {
+		endpoints = append(endpoints, co.servicePortBackendsLocked(service, port)...)
 	}
 
-	fmt.Println("网络管理器初始化完成")
-	return nil
+	sort.Strings(endpoints)
+	return endpoints
 }
 
-func (nm *NetworkManager) CreateNetwork(config *NetworkConfig) (*ContainerNetwork, error) {
-	nm.mutex.Lock()
-	defer nm.mutex.Unlock()
-
-	driver, exists := nm.drivers[config.Driver]
-	if !exists {
-		return nil, fmt.Errorf("network driver not found: %s", config.Driver)
+// servicePortBackendsLocked 返回单个服务端口的后端"IP:端口"。调用方需持有co.mutex
+func (co *ContainerOrchestrator) servicePortBackendsLocked(service *Service, port ServicePort) []string {
+	target := port.TargetPort
+	if target == 0 {
+		target = port.Port
 	}
 
-	network, err := driver.CreateNetwork(config)
-	if err != nil {
-		return nil, err
+	var backends []string
+	for _, pod := range co.pods {
+		if pod.Namespace == service.Namespace && pod.Status == PodRunning {
+			if co.labelsMatch(pod.Labels, service.Selector) {
+				if ip := podIPAddress(pod); ip != "" {
+					backends = append(backends, net.JoinHostPort(ip, strconv.Itoa(int(target))))
+				}
+			}
+		}
 	}
 
-	nm.networks[network.ID] = network
-	fmt.Printf("创建网络: %s (驱动: %s)\n", network.Name, config.Driver)
+	sort.Strings(backends)
+	return backends
+}
 
-	return network, nil
+// podIPAddress 返回Pod中第一个容器网络接口的IPv4地址
+func podIPAddress(pod *Pod) string {
+	for _, container := range pod.Containers {
+		container.mutex.RLock()
+		for _, iface := range container.Networks {
+			for _, address := range iface.IPAddresses {
+				// 接口地址可能带有前缀长度
+				if slash := strings.Index(address, "/"); slash >= 0 {
+					address = address[:slash]
+				}
+				if ip := net.ParseIP(address); ip != nil && ip.To4() != nil {
+					container.mutex.RUnlock()
+					return ip.String()
+				}
+			}
+		}
+		container.mutex.RUnlock()
+	}
+	return ""
 }
 
 // ==================
-// 5.1 Bridge网络驱动
+// 服务与ClusterIP
 // ==================
 
-// BridgeDriver 桥接网络驱动
-type BridgeDriver struct {
-	bridges map[string]*NetworkBridge
-	mutex   sync.RWMutex
-}
-
-func (bd *BridgeDriver) Name() string {
-	return "bridge"
-}
+// defaultClusterCIDR 未配置ClusterCIDR时的服务地址范围
+const defaultClusterCIDR = "10.96.0.0/16"
 
-func (bd *BridgeDriver) CreateNetwork(config *NetworkConfig) (*ContainerNetwork, error) {
-	if bd.bridges == nil {
-		bd.bridges = make(map[string]*NetworkBridge)
+// CreateService 创建服务并从ClusterCIDR中分配唯一的ClusterIP。地址范围耗尽时返回错误
+func (co *ContainerOrchestrator) CreateService(service *Service) (*Service, error) {
+	if service.Name == "" {
+		return nil, fmt.Errorf("service name is required")
 	}
 
-	networkID := generateNetworkID()
-	bridgeName := fmt.Sprintf("br-%s", networkID[:12])
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
 
-	// 创建网桥
-	bridge := &NetworkBridge{
-		Name:      bridgeName,
-		IPAddress: config.IPAM.Config[0].Gateway,
-		Subnet:    config.IPAM.Config[0].Subnet,
-		Gateway:   config.IPAM.Config[0].Gateway,
-		MTU:       1500,
-		Created:   time.Now(),
+	key := configObjectKey(service.Namespace, service.Name)
+	if _, exists := co.services[key]; exists {
+		return nil, fmt.Errorf("service already exists: %s", key)
 	}
-
-	// 执行系统命令创建网桥
-	if err := bd.createBridge(bridge); err != nil {
+	if err := co.ensureServiceCIDRLocked(); err != nil {
 		return nil, err
 	}
-
-	bd.mutex.Lock()
-	bd.bridges[networkID] = bridge
-	bd.mutex.Unlock()
-
-	network := &ContainerNetwork{
-		ID:         networkID,
-		Name:       config.Name,
-		Driver:     "bridge",
-		IPAM:       config.IPAM,
-		Containers: make(map[string]*EndpointConfig),
-		Options:    make(map[string]string),
-		Labels:     make(map[string]string),
-		Created:    time.Now(),
+	for _, port := range service.Ports {
+		if port.NodePort != 0 && service.Type != ServiceTypeNodePort {
+			return nil, fmt.Errorf("service %s: nodePort may only be set on %s services", key, ServiceTypeNodePort)
+		}
+	}
+	clusterIP, err := co.serviceIPs.AllocateIP(co.serviceCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate cluster IP for service %s: %v", key, err)
+	}
+
+	stored := &Service{
+		ID:          generateShortID(),
+		Name:        service.Name,
+		Namespace:   service.Namespace,
+		Type:        service.Type,
+		Selector:    copyStringMap(service.Selector),
+		Ports:       append([]ServicePort(nil), service.Ports...),
+		ClusterIP:   clusterIP,
+		ExternalIPs: append([]string(nil), service.ExternalIPs...),
+		CreatedAt:   time.Now(),
+	}
+	if stored.Namespace == "" {
+		stored.Namespace = defaultPodNamespace
+	}
+	if stored.Type == "" {
+		stored.Type = ServiceTypeClusterIP
+	}
+	if stored.Type == ServiceTypeNodePort {
+		if err := co.exposeNodePortsLocked(key, stored); err != nil {
+			co.serviceIPs.ReleaseIP(co.serviceCIDR, clusterIP)
+			return nil, fmt.Errorf("service %s: %v", key, err)
+		}
 	}
+	co.services[key] = stored
 
-	fmt.Printf("创建桥接网络: %s (网桥: %s)\n", config.Name, bridgeName)
-	return network, nil
+	fmt.Printf("创建服务: %s (ClusterIP: %s)\n", key, clusterIP)
+	return stored, nil
 }
 
-func (bd *BridgeDriver) createBridge(bridge *NetworkBridge) error {
-	// G204安全修复：验证网络名称
-	if err := validateNetworkName(bridge.Name); err != nil {
-		return fmt.Errorf("无效的网桥名称: %v", err)
+// ensureServiceCIDRLocked 首次使用时按配置登记ClusterIP地址池
+func (co *ContainerOrchestrator) ensureServiceCIDRLocked() error {
+	if co.serviceIPs != nil {
+		return nil
 	}
-
-	// G204安全修复：验证IP地址
-	if err := validateIPAddress(bridge.IPAddress); err != nil {
-		return fmt.Errorf("无效的网桥IP地址: %v", err)
+	cidr := co.config.ClusterCIDR
+	if cidr == "" {
+		cidr = defaultClusterCIDR
 	}
-
-	// 创建网桥接口
-	// #nosec G204 - bridge.Name已通过validateNetworkName验证，固定命令用于网络配置
-	cmd := exec.Command("ip", "link", "add", bridge.Name, "type", "bridge")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create bridge: %v", err)
+	ipam := NewIPAddressManager()
+	if err := ipam.AddPool(cidr, ""); err != nil {
+		return fmt.Errorf("invalid cluster CIDR: %v", err)
 	}
+	co.serviceIPs = ipam
+	co.serviceCIDR = cidr
+	return nil
+}
 
-	// 设置网桥IP地址
-	// #nosec G204 - bridge.IPAddress已通过validateIPAddress验证，固定命令用于网络配置
-	cmd = exec.Command("ip", "addr", "add", bridge.IPAddress+"/24", "dev", bridge.Name)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to set bridge IP: %v", err)
-	}
+// DeleteService 删除服务并归还其ClusterIP
+func (co *ContainerOrchestrator) DeleteService(namespace, name string) error {
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
 
-	// 启用网桥接口
-	// #nosec G204 - bridge.Name已验证，固定命令用于网络配置
-	cmd = exec.Command("ip", "link", "set", bridge.Name, "up")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to enable bridge: %v", err)
+	key := configObjectKey(namespace, name)
+	service, exists := co.services[key]
+	if !exists {
+		return fmt.Errorf("service not found: %s", key)
+	}
+	delete(co.services, key)
+	co.releaseNodePortsLocked(service)
+	if service.ClusterIP != "" && co.serviceIPs != nil {
+		if err := co.serviceIPs.ReleaseIP(co.serviceCIDR, service.ClusterIP); err != nil {
+			log.Printf("Warning: failed to release cluster IP %s: %v", service.ClusterIP, err)
+		}
 	}
 
+	fmt.Printf("删除服务: %s\n", key)
 	return nil
 }
 
-func (bd *BridgeDriver) CreateEndpoint(networkID, containerID string) (*EndpointConfig, error) {
-	bd.mutex.RLock()
-	bridge, exists := bd.bridges[networkID]
-	bd.mutex.RUnlock()
+// ==================
+// NodePort服务暴露
+// ==================
 
-	if !exists {
-		return nil, fmt.Errorf("network not found: %s", networkID)
-	}
+// 默认NodePort分配范围
+const (
+	defaultNodePortMin = 30000
+	defaultNodePortMax = 32767
+)
 
-	// 创建veth对
-	vethHost := fmt.Sprintf("veth%s", containerID[:7])
-	vethContainer := fmt.Sprintf("eth0")
+// nodePortDialTimeout 代理连接后端的超时
+var nodePortDialTimeout = 5 * time.Second
 
-	// 创建veth pair
-	// #nosec G204 - vethHost和vethContainer是内部生成的安全标识符，固定命令用于网络配置
-	cmd := exec.Command("ip", "link", "add", vethHost, "type", "veth", "peer", "name", vethContainer)
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to create veth pair: %v", err)
+// parseNodePortRange 解析"最小值-最大值"形式的端口范围
+func parseNodePortRange(spec string) (int32, int32, error) {
+	if spec == "" {
+		return defaultNodePortMin, defaultNodePortMax, nil
 	}
-
-	// 将host端连接到网桥
-	// #nosec G204 - vethHost和bridge.Name都是内部生成的安全值，固定命令用于网络配置
-	cmd = exec.Command("ip", "link", "set", vethHost, "master", bridge.Name)
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to attach veth to bridge: %v", err)
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid node port range %q: expected min-max", spec)
 	}
-
-	// 启用host端接口
-	// #nosec G204 - vethHost是内部生成的安全标识符，固定命令用于网络配置
-	cmd = exec.Command("ip", "link", "set", vethHost, "up")
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to enable veth host: %v", err)
+	min, errMin := strconv.Atoi(strings.TrimSpace(parts[0]))
+	max, errMax := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if errMin != nil || errMax != nil || min < 1 || max > 65535 || min > max {
+		return 0, 0, fmt.Errorf("invalid node port range %q", spec)
 	}
+	return int32(min), int32(max), nil
+}
 
-	endpoint := &EndpointConfig{
-		NetworkID:   networkID,
-		ContainerID: containerID,
-		Interface:   vethContainer,
-		IPAddress:   "", // 将由IPAM分配
-		Gateway:     bridge.Gateway,
+// exposeNodePortsLocked 为服务的每个端口分配NodePort并启动转发代理。未指定NodePort时
+// 分配范围内第一个空闲端口；任一端口失败时回滚本服务已分配的端口。调用方需持有co.mutex
+func (co *ContainerOrchestrator) exposeNodePortsLocked(key string, service *Service) error {
+	min, max, err := parseNodePortRange(co.config.NodePortRange)
+	if err != nil {
+		return err
+	}
+	if len(service.Ports) == 0 {
+		return fmt.Errorf("%s service requires at least one port", ServiceTypeNodePort)
 	}
 
-	fmt.Printf("创建网络端点: %s -> %s\n", containerID[:12], networkID[:12])
-	return endpoint, nil
-}
-
-func (bd *BridgeDriver) Join(networkID, containerID string) error {
-	// 将容器网络接口移动到容器命名空间
-	vethContainer := "eth0"
+	var allocated []int32
+	success := false
+	defer func() {
+		if !success {
+			for _, nodePort := range allocated {
+				co.releaseNodePortLocked(nodePort)
+			}
+		}
+	}()
 
-	// 这里需要实际的容器PID来设置网络命名空间
-	// 简化实现，实际需要从容器管理器获取PID
-	fmt.Printf("加入网络: 容器 %s 加入网络 %s (接口: %s)\n", containerID[:12], networkID[:12], vethContainer)
+	for i := range service.Ports {
+		port := &service.Ports[i]
+		nodePort := port.NodePort
+		if nodePort != 0 {
+			if nodePort < min || nodePort > max {
+				return fmt.Errorf("node port %d outside range %d-%d", nodePort, min, max)
+			}
+			if _, taken := co.nodePorts[nodePort]; taken {
+				return fmt.Errorf("node port %d already allocated", nodePort)
+			}
+		} else {
+			for candidate := min; candidate <= max && candidate >= min; candidate++ {
+				if _, taken := co.nodePorts[candidate]; !taken {
+					nodePort = candidate
+					break
+				}
+			}
+			if nodePort == 0 {
+				return fmt.Errorf("node port range %d-%d exhausted", min, max)
+			}
+		}
 
-	// 实际操作需要：
-	// 1. 获取容器进程PID
-	// 2. 将veth接口移动到容器网络命名空间
-	// 3. 在容器内配置IP地址和路由
+		servicePort := *port
+		proxy, err := startNodePortProxy(co.config.NodePortAddress, nodePort, func() []string {
+			co.mutex.RLock()
+			defer co.mutex.RUnlock()
+			if current, exists := co.services[key]; exists {
+				return co.servicePortBackendsLocked(current, servicePort)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		co.nodePorts[nodePort] = proxy
+		allocated = append(allocated, nodePort)
+		port.NodePort = nodePort
+		fmt.Printf("暴露NodePort: %s %d -> %d\n", key, nodePort, port.Port)
+	}
 
+	success = true
 	return nil
 }
 
-func (bd *BridgeDriver) Leave(networkID, containerID string) error {
-	fmt.Printf("离开网络: 容器 %s 离开网络 %s\n", containerID[:12], networkID[:12])
-	return nil
+// releaseNodePortsLocked 关闭服务的NodePort代理并归还端口。调用方需持有co.mutex
+func (co *ContainerOrchestrator) releaseNodePortsLocked(service *Service) {
+	if service.Type != ServiceTypeNodePort {
+		return
+	}
+	for _, port := range service.Ports {
+		co.releaseNodePortLocked(port.NodePort)
+	}
 }
 
-func (bd *BridgeDriver) DeleteEndpoint(networkID, containerID string) error {
-	vethHost := fmt.Sprintf("veth%s", containerID[:7])
+func (co *ContainerOrchestrator) releaseNodePortLocked(nodePort int32) {
+	if proxy, exists := co.nodePorts[nodePort]; exists {
+		proxy.Close()
+		delete(co.nodePorts, nodePort)
+	}
+}
 
-	// 删除veth接口
-	// #nosec G204 - vethHost是内部生成的安全标识符，固定命令用于网络清理
-	cmd := exec.Command("ip", "link", "delete", vethHost)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to delete veth: %v", err)
+// nodePortProxy 进程内TCP代理，将主机端口上的连接轮询转发到服务后端
+type nodePortProxy struct {
+	listener net.Listener
+	backends func() []string
+	next     uint64 // 轮询计数，原子访问
+}
+
+func startNodePortProxy(address string, port int32, backends func() []string) (*nodePortProxy, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(int(port))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on node port %d: %v", port, err)
 	}
+	proxy := &nodePortProxy{listener: listener, backends: backends}
+	go proxy.serve()
+	return proxy, nil
+}
 
-	fmt.Printf("删除网络端点: %s\n", containerID[:12])
-	return nil
+func (p *nodePortProxy) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			// 监听器关闭后退出
+			return
+		}
+		go p.forward(conn)
+	}
 }
 
-func (bd *BridgeDriver) DeleteNetwork(networkID string) error {
-	bd.mutex.Lock()
-	defer bd.mutex.Unlock()
+// forward 从轮询位置开始依次尝试后端，连接成功后双向复制数据直到两端都关闭
+func (p *nodePortProxy) forward(client net.Conn) {
+	defer client.Close()
 
-	bridge, exists := bd.bridges[networkID]
-	if !exists {
-		return fmt.Errorf("network not found: %s", networkID)
+	backends := p.backends()
+	if len(backends) == 0 {
+		return
+	}
+	start := atomic.AddUint64(&p.next, 1) - 1
+	var backend net.Conn
+	for i := range backends {
+		address := backends[(start+uint64(i))%uint64(len(backends))]
+		conn, err := net.DialTimeout("tcp", address, nodePortDialTimeout)
+		if err == nil {
+			backend = conn
+			break
+		}
+		log.Printf("Warning: node port backend %s unreachable: %v", address, err)
+	}
+	if backend == nil {
+		return
 	}
+	defer backend.Close()
 
-	// 删除网桥
-	// #nosec G204 - bridge.Name是内部管理的网桥名称，固定命令用于网络清理
-	cmd := exec.Command("ip", "link", "delete", bridge.Name)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to delete bridge: %v", err)
+	done := make(chan struct{})
+	go func() {
+		io.Copy(backend, client)
+		closeWrite(backend)
+		close(done)
+	}()
+	io.Copy(client, backend)
+	closeWrite(client)
+	<-done
+}
+
+// closeWrite 半关闭TCP连接的写方向，使对端读到EOF
+func closeWrite(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+		return
 	}
+	conn.Close()
+}
 
-	delete(bd.bridges, networkID)
-	fmt.Printf("删除桥接网络: %s\n", bridge.Name)
-	return nil
+// Close 停止接受新连接，已建立的连接继续转发直到关闭
+func (p *nodePortProxy) Close() error {
+	return p.listener.Close()
+}
+
+// ServiceEndpoints 返回服务当前的后端端点
+func (co *ContainerOrchestrator) ServiceEndpoints(namespace, name string) ([]string, error) {
+	co.mutex.RLock()
+	defer co.mutex.RUnlock()
+
+	key := configObjectKey(namespace, name)
+	service, exists := co.services[key]
+	if !exists {
+		return nil, fmt.Errorf("service not found: %s", key)
+	}
+	return co.getServiceEndpoints(service), nil
 }
 
 // ==================
-// 6. 安全管理系统
+// 7.1 ConfigMap与Secret
 // ==================
 
-// SecurityContext 安全上下文
-type SecurityContext struct {
-	RunAsUser                *int64
-	RunAsGroup               *int64
-	RunAsNonRoot             *bool
-	ReadOnlyRootFilesystem   *bool
-	AllowPrivilegeEscalation *bool
-	Privileged               *bool
-	Capabilities             *Capabilities
-	SelinuxOptions           *SelinuxOptions
-	WindowsOptions           *WindowsSecurityContextOptions
-	FsGroup                  *int64
-	SupplementalGroups       []int64
-	SeccompProfile           *SeccompProfile
-	AppArmorProfile          *AppArmorProfile
+const defaultPodNamespace = "default"
+
+// ConfigMap 命名空间内的非敏感配置键值对
+type ConfigMap struct {
+	Name      string
+	Namespace string
+	Data      map[string]string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Secret 命名空间内的敏感数据。Data中的值以base64编码保存，
+// 只在注入容器时解码，且只会写入StateDirectory下的临时文件系统
+type Secret struct {
+	Name      string
+	Namespace string
+	Type      string
+	Data      map[string]string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
-// Capabilities 权限能力
-type Capabilities struct {
-	Add  []string
-	Drop []string
+// NewSecret 根据明文数据创建Secret，值在存储前进行base64编码
+func NewSecret(namespace, name string, data map[string][]byte) *Secret {
+	encoded := make(map[string]string, len(data))
+	for key, value := range data {
+		encoded[key] = base64.StdEncoding.EncodeToString(value)
+	}
+	return &Secret{Name: name, Namespace: namespace, Type: "Opaque", Data: encoded}
 }
 
-// SeccompManager Seccomp管理器
-type SeccompManager struct {
-	profiles map[string]*SeccompProfile
-	mutex    sync.RWMutex
+// Decode 返回解码后的明文数据
+func (s *Secret) Decode() (map[string][]byte, error) {
+	decoded := make(map[string][]byte, len(s.Data))
+	for key, value := range s.Data {
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("secret %s/%s key %s is not valid base64: %v", s.Namespace, s.Name, key, err)
+		}
+		decoded[key] = raw
+	}
+	return decoded, nil
 }
 
-// SeccompProfile Seccomp配置文件
-type SeccompProfile struct {
-	Type             string
-	LocalhostProfile *string
-	DefaultAction    string
-	Architectures    []string
-	Syscalls         []SyscallRule
+// EnvFromSource 将ConfigMap或Secret的全部键注入为环境变量
+type EnvFromSource struct {
+	Prefix       string
+	ConfigMapRef string
+	SecretRef    string
 }
 
-// SyscallRule 系统调用规则
-type SyscallRule struct {
-	Names  []string
-	Action string
-	Args   []SyscallArg
+// VolumeMount 将ConfigMap或Secret的每个键作为文件挂载到容器内的MountPath
+type VolumeMount struct {
+	Name      string
+	MountPath string
+	ConfigMap string
+	Secret    string
+	ReadOnly  bool
 }
 
-// SyscallArg 系统调用参数
-type SyscallArg struct {
-	Index    uint
-	Value    uint64
-	ValueTwo uint64
-	Op       string
+// configObjectKey 生成命名空间内对象的存储键
+func configObjectKey(namespace, name string) string {
+	if namespace == "" {
+		namespace = defaultPodNamespace
+	}
+	return namespace + "/" + name
 }
 
-func NewSeccompManager() *SeccompManager {
-	return &SeccompManager{
-		profiles: make(map[string]*SeccompProfile),
+// validateConfigKeys 确保键可以安全地作为文件名使用
+func validateConfigKeys(data map[string]string) error {
+	for key := range data {
+		if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+			return fmt.Errorf("invalid key: %q", key)
+		}
 	}
+	return nil
 }
 
-func (sm *SeccompManager) LoadProfile(name string, profile *SeccompProfile) error {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
+func copyStringMap(src map[string]string) map[string]string {
+	dst := make(map[string]string, len(src))
+	for key, value := range src {
+		dst[key] = value
+	}
+	return dst
+}
 
-	sm.profiles[name] = profile
-	fmt.Printf("加载Seccomp配置文件: %s\n", name)
+func (co *ContainerOrchestrator) CreateConfigMap(configMap *ConfigMap) error {
+	if configMap.Name == "" {
+		return fmt.Errorf("configmap name is required")
+	}
+	if err := validateConfigKeys(configMap.Data); err != nil {
+		return fmt.Errorf("configmap %s: %v", configMap.Name, err)
+	}
+
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
+
+	key := configObjectKey(configMap.Namespace, configMap.Name)
+	if _, exists := co.configMaps[key]; exists {
+		return fmt.Errorf("configmap already exists: %s", key)
+	}
+
+	stored := &ConfigMap{
+		Name:      configMap.Name,
+		Namespace: configMap.Namespace,
+		Data:      copyStringMap(configMap.Data),
+		CreatedAt: time.Now(),
+	}
+	if stored.Namespace == "" {
+		stored.Namespace = defaultPodNamespace
+	}
+	stored.UpdatedAt = stored.CreatedAt
+	co.configMaps[key] = stored
+
+	fmt.Printf("创建ConfigMap: %s (键数: %d)\n", key, len(stored.Data))
 	return nil
 }
 
-func (sm *SeccompManager) ApplyProfile(containerID string, profileName string) error {
-	sm.mutex.RLock()
-	profile, exists := sm.profiles[profileName]
-	sm.mutex.RUnlock()
+// GetConfigMap 返回ConfigMap的副本
+func (co *ContainerOrchestrator) GetConfigMap(namespace, name string) (*ConfigMap, error) {
+	co.mutex.RLock()
+	defer co.mutex.RUnlock()
+	return co.getConfigMapLocked(namespace, name)
+}
 
+func (co *ContainerOrchestrator) getConfigMapLocked(namespace, name string) (*ConfigMap, error) {
+	key := configObjectKey(namespace, name)
+	configMap, exists := co.configMaps[key]
 	if !exists {
-		return fmt.Errorf("seccomp profile not found: %s", profileName)
+		return nil, fmt.Errorf("configmap not found: %s", key)
 	}
+	result := *configMap
+	result.Data = copyStringMap(configMap.Data)
+	return &result, nil
+}
 
-	// 使用profile防止未使用错误
-	if profile == nil {
-		return fmt.Errorf("seccomp profile is nil: %s", profileName)
+func (co *ContainerOrchestrator) UpdateConfigMap(configMap *ConfigMap) error {
+	if err := validateConfigKeys(configMap.Data); err != nil {
+		return fmt.Errorf("configmap %s: %v", configMap.Name, err)
 	}
 
-	// 应用Seccomp规则到容器
-	fmt.Printf("应用Seccomp配置: 容器 %s 使用配置 %s\n", containerID[:12], profileName)
-
-	// 实际实现需要：
-	// 1. 将seccomp规则转换为BPF程序
-	// 2. 通过prctl系统调用应用到进程
-	// 3. 验证规则是否正确应用
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
 
+	key := configObjectKey(configMap.Namespace, configMap.Name)
+	stored, exists := co.configMaps[key]
+	if !exists {
+		return fmt.Errorf("configmap not found: %s", key)
+	}
+	stored.Data = copyStringMap(configMap.Data)
+	stored.UpdatedAt = time.Now()
 	return nil
 }
 
-// ApparmorManager AppArmor管理器
-type ApparmorManager struct {
-	profiles map[string]*AppArmorProfile
-	mutex    sync.RWMutex
-}
+func (co *ContainerOrchestrator) DeleteConfigMap(namespace, name string) error {
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
 
-// AppArmorProfile AppArmor配置文件
-type AppArmorProfile struct {
-	Type             string
-	LocalhostProfile *string
-	Rules            []string
+	key := configObjectKey(namespace, name)
+	if _, exists := co.configMaps[key]; !exists {
+		return fmt.Errorf("configmap not found: %s", key)
+	}
+	delete(co.configMaps, key)
+	return nil
 }
 
-func NewApparmorManager() *ApparmorManager {
-	return &ApparmorManager{
-		profiles: make(map[string]*AppArmorProfile),
+func (co *ContainerOrchestrator) CreateSecret(secret *Secret) error {
+	if secret.Name == "" {
+		return fmt.Errorf("secret name is required")
+	}
+	if err := validateConfigKeys(secret.Data); err != nil {
+		return fmt.Errorf("secret %s: %v", secret.Name, err)
+	}
+	if _, err := secret.Decode(); err != nil {
+		return err
 	}
-}
 
-func (am *ApparmorManager) LoadProfile(name string, profile *AppArmorProfile) error {
-	am.mutex.Lock()
-	defer am.mutex.Unlock()
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
 
-	am.profiles[name] = profile
-	fmt.Printf("加载AppArmor配置文件: %s\n", name)
+	key := configObjectKey(secret.Namespace, secret.Name)
+	if _, exists := co.secrets[key]; exists {
+		return fmt.Errorf("secret already exists: %s", key)
+	}
+
+	stored := &Secret{
+		Name:      secret.Name,
+		Namespace: secret.Namespace,
+		Type:      secret.Type,
+		Data:      copyStringMap(secret.Data),
+		CreatedAt: time.Now(),
+	}
+	if stored.Namespace == "" {
+		stored.Namespace = defaultPodNamespace
+	}
+	stored.UpdatedAt = stored.CreatedAt
+	co.secrets[key] = stored
+
+	// 不输出任何值，只记录键数
+	fmt.Printf("创建Secret: %s (键数: %d)\n", key, len(stored.Data))
 	return nil
 }
 
-func (am *ApparmorManager) ApplyProfile(containerID string, profileName string) error {
-	am.mutex.RLock()
-	profile, exists := am.profiles[profileName]
-	am.mutex.RUnlock()
+// GetSecret 返回Secret的副本，值仍为base64编码
+func (co *ContainerOrchestrator) GetSecret(namespace, name string) (*Secret, error) {
+	co.mutex.RLock()
+	defer co.mutex.RUnlock()
+	return co.getSecretLocked(namespace, name)
+}
 
+func (co *ContainerOrchestrator) getSecretLocked(namespace, name string) (*Secret, error) {
+	key := configObjectKey(namespace, name)
+	secret, exists := co.secrets[key]
 	if !exists {
-		return fmt.Errorf("apparmor profile not found: %s", profileName)
+		return nil, fmt.Errorf("secret not found: %s", key)
 	}
+	result := *secret
+	result.Data = copyStringMap(secret.Data)
+	return &result, nil
+}
 
-	// 使用profile防止未使用错误
-	if profile == nil {
-		return fmt.Errorf("apparmor profile is nil: %s", profileName)
+func (co *ContainerOrchestrator) UpdateSecret(secret *Secret) error {
+	if err := validateConfigKeys(secret.Data); err != nil {
+		return fmt.Errorf("secret %s: %v", secret.Name, err)
+	}
+	if _, err := secret.Decode(); err != nil {
+		return err
 	}
 
-	fmt.Printf("应用AppArmor配置: 容器 %s 使用配置 %s\n", containerID[:12], profileName)
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
+
+	key := configObjectKey(secret.Namespace, secret.Name)
+	stored, exists := co.secrets[key]
+	if !exists {
+		return fmt.Errorf("secret not found: %s", key)
+	}
+	stored.Data = copyStringMap(secret.Data)
+	stored.UpdatedAt = time.Now()
 	return nil
 }
 
-// ==================
-// 7. 容器编排引擎
-// ==================
+func (co *ContainerOrchestrator) DeleteSecret(namespace, name string) error {
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
 
-// ContainerOrchestrator 容器编排器
-type ContainerOrchestrator struct {
-	runtime     *ContainerRuntime
-	scheduler   *ContainerScheduler
-	serviceMgr  *ServiceManager
-	deployments map[string]*Deployment
-	services    map[string]*Service
-	pods        map[string]*Pod
-	nodes       map[string]*Node
-	config      OrchestratorConfig
-	eventBus    *ContainerEventBus
-	monitor     *ClusterMonitor
-	mutex       sync.RWMutex
-	running     bool
+	key := configObjectKey(namespace, name)
+	if _, exists := co.secrets[key]; !exists {
+		return fmt.Errorf("secret not found: %s", key)
+	}
+	delete(co.secrets, key)
+	return nil
 }
 
-// Pod 容器组
-type Pod struct {
-	ID             string
-	Name           string
-	Namespace      string
-	Labels         map[string]string
-	Annotations    map[string]string
-	Containers     []*Container
-	InitContainers []*Container
-	Volumes        []*Volume
-	RestartPolicy  RestartPolicy
-	DNSPolicy      DNSPolicy
-	NodeName       string
-	Status         PodStatus
-	CreatedAt      time.Time
-	StartedAt      time.Time
-}
+// injectPodConfig 在Pod启动前将ContainerSpec引用的ConfigMap和Secret物化到容器中：
+// EnvFrom合并进容器已有的环境变量，VolumeMount写入StateDirectory下的tmpfs目录并绑定挂载到容器根文件系统
+func (co *ContainerOrchestrator) injectPodConfig(pod *Pod) error {
+	if pod.Spec == nil {
+		return nil
+	}
 
-// Service 服务
-type Service struct {
-	ID           string
-	Name         string
-	Namespace    string
-	Type         ServiceType
-	Selector     map[string]string
-	Ports        []ServicePort
-	ClusterIP    string
-	ExternalIPs  []string
-	LoadBalancer *LoadBalancerStatus
-	CreatedAt    time.Time
+	co.mutex.RLock()
+	defer co.mutex.RUnlock()
+
+	for i, container := range pod.Containers {
+		if i >= len(pod.Spec.Containers) {
+			break
+		}
+		spec := pod.Spec.Containers[i]
+
+		env, err := co.resolveEnvFromLocked(pod.Namespace, spec)
+		if err != nil {
+			return fmt.Errorf("container %s: %v", spec.Name, err)
+		}
+
+		mounts := make([]*Mount, 0, 2*len(spec.VolumeMounts))
+		for _, volumeMount := range spec.VolumeMounts {
+			files, err := co.resolveVolumeFilesLocked(pod.Namespace, volumeMount)
+			if err == nil {
+				var volumeMounts []*Mount
+				volumeMounts, err = co.runtime.materializeConfigVolume(container, volumeMount, files)
+				mounts = append(mounts, volumeMounts...)
+			}
+			if err != nil {
+				// 尚未记录到容器上的挂载不会被cleanupContainer卸载，在这里卸载
+				unmountVolumeMounts(mounts)
+				return fmt.Errorf("container %s: %v", spec.Name, err)
+			}
+		}
+
+		container.mutex.Lock()
+		for _, pair := range env {
+			container.Config.Env = setEnv(container.Config.Env, pair)
+		}
+		container.Mounts = append(container.Mounts, mounts...)
+		container.mutex.Unlock()
+	}
+	return nil
 }
 
-// Deployment 部署
-type Deployment struct {
-	ID        string
-	Name      string
-	Namespace string
-	Replicas  int32
-	Selector  map[string]string
-	Template  *PodTemplate
-	Strategy  DeploymentStrategy
-	Status    DeploymentStatus
-	CreatedAt time.Time
-	UpdatedAt time.Time
+// resolveEnvFromLocked 计算容器的最终环境变量。EnvFrom按声明顺序展开，
+// 显式声明的Env排在最后，从而在同名时覆盖来自ConfigMap/Secret的值
+func (co *ContainerOrchestrator) resolveEnvFromLocked(namespace string, spec ContainerSpec) ([]string, error) {
+	env := make([]string, 0, len(spec.Env))
+	for _, source := range spec.EnvFrom {
+		var data map[string][]byte
+		switch {
+		case source.ConfigMapRef != "":
+			configMap, err := co.getConfigMapLocked(namespace, source.ConfigMapRef)
+			if err != nil {
+				return nil, err
+			}
+			data = make(map[string][]byte, len(configMap.Data))
+			for key, value := range configMap.Data {
+				data[key] = []byte(value)
+			}
+		case source.SecretRef != "":
+			secret, err := co.getSecretLocked(namespace, source.SecretRef)
+			if err != nil {
+				return nil, err
+			}
+			if data, err = secret.Decode(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("envFrom requires configMapRef or secretRef")
+		}
+
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			// 无法作为环境变量名的键直接跳过，与Kubernetes行为一致
+			if strings.Contains(key, "=") {
+				continue
+			}
+			env = append(env, source.Prefix+key+"="+string(data[key]))
+		}
+	}
+	return append(env, spec.Env...), nil
 }
 
-// Node 节点
-type Node struct {
-	ID          string
-	Name        string
-	Address     string
-	Status      NodeStatus
-	Capacity    ResourceList
-	Allocatable ResourceList
-	Conditions  []NodeCondition
-	Info        NodeSystemInfo
-	CreatedAt   time.Time
+func (co *ContainerOrchestrator) resolveVolumeFilesLocked(namespace string, volumeMount VolumeMount) (map[string][]byte, error) {
+	switch {
+	case volumeMount.ConfigMap != "":
+		configMap, err := co.getConfigMapLocked(namespace, volumeMount.ConfigMap)
+		if err != nil {
+			return nil, err
+		}
+		files := make(map[string][]byte, len(configMap.Data))
+		for key, value := range configMap.Data {
+			files[key] = []byte(value)
+		}
+		return files, nil
+	case volumeMount.Secret != "":
+		secret, err := co.getSecretLocked(namespace, volumeMount.Secret)
+		if err != nil {
+			return nil, err
+		}
+		return secret.Decode()
+	default:
+		return nil, fmt.Errorf("volume mount %s requires configMap or secret", volumeMount.MountPath)
+	}
 }
 
-// ContainerScheduler 容器调度器
-type ContainerScheduler struct {
-	algorithms map[string]SchedulingAlgorithm
-	policies   []SchedulingPolicy
-	queue      *SchedulingQueue
-	cache      *SchedulerCache
-	mutex      sync.RWMutex
+// containerStateDir 返回容器在StateDirectory下的运行时目录。
+// 该目录位于tmpfs上，容器删除时一并清理，不会进入镜像层
+func (cr *ContainerRuntime) containerStateDir(container *Container) string {
+	return filepath.Join(cr.config.StateDirectory, "containers", container.ID)
 }
 
-// SchedulingAlgorithm 调度算法接口
-type SchedulingAlgorithm interface {
-	Name() string
-	Schedule(pod *Pod, nodes []*Node) (*Node, error)
-	Preempt(pod *Pod, nodes []*Node) ([]*Pod, *Node, error)
+// materializeConfigVolume 将文件写入容器的临时卷目录并绑定挂载到容器根文件系统中的MountPath，
+// 返回卷目录上的tmpfs挂载（如有）和绑定挂载。Secret卷必须落在tmpfs上，无法挂载时返回错误而不是把明文写到StateDirectory中
+func (cr *ContainerRuntime) materializeConfigVolume(container *Container, volumeMount VolumeMount, files map[string][]byte) ([]*Mount, error) {
+	if volumeMount.MountPath == "" {
+		return nil, fmt.Errorf("volume mount path is required")
+	}
+	name := volumeMount.Name
+	if name == "" {
+		name = strings.Trim(strings.ReplaceAll(volumeMount.MountPath, "/", "-"), "-")
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid volume name: %q", name)
+	}
+
+	volumeDir := filepath.Join(cr.containerStateDir(container), "volumes", name)
+	if err := os.MkdirAll(volumeDir, 0700); err != nil {
+		return nil, err
+	}
+	// 单独挂载tmpfs，确保内容只存在于内存中
+	var mounts []*Mount
+	tmpfs := &Mount{Source: "tmpfs", Target: volumeDir, Type: "tmpfs", Options: "nosuid,nodev,noexec,mode=0700,size=1m"}
+	if err := mountTmpfs(tmpfs); err != nil {
+		if volumeMount.Secret != "" {
+			os.RemoveAll(volumeDir)
+			return nil, fmt.Errorf("failed to mount tmpfs for secret volume %s: %v", name, err)
+		}
+		log.Printf("Warning: failed to mount tmpfs at %s: %v", volumeDir, err)
+	} else {
+		mounts = append(mounts, tmpfs)
+	}
+
+	for key, value := range files {
+		if err := os.WriteFile(filepath.Join(volumeDir, key), value, 0400); err != nil {
+			unmountVolumeMounts(mounts)
+			return nil, err
+		}
+	}
+
+	// 挂载点在容器根文件系统下解析，容器内的符号链接不会把挂载引到宿主机的其他位置
+	target, err := resolveContainerPath(cr.containerRootfs(container), volumeMount.MountPath, true)
+	if err != nil {
+		unmountVolumeMounts(mounts)
+		return nil, err
+	}
+	options := "bind"
+	if volumeMount.ReadOnly || volumeMount.Secret != "" {
+		options = "bind,ro"
+	}
+	bind := &Mount{
+		Source:      volumeDir,
+		Target:      target,
+		Type:        "bind",
+		Options:     options,
+		Propagation: "private",
+	}
+	if err := mountBind(bind); err != nil {
+		unmountVolumeMounts(mounts)
+		return nil, fmt.Errorf("failed to bind volume %s at %s: %v", name, volumeMount.MountPath, err)
+	}
+	return append(mounts, bind), nil
 }
 
-func NewContainerOrchestrator(runtime *ContainerRuntime) *ContainerOrchestrator {
-	return &ContainerOrchestrator{
-		runtime:     runtime,
-		scheduler:   NewContainerScheduler(),
-		serviceMgr:  NewServiceManager(),
-		deployments: make(map[string]*Deployment),
-		services:    make(map[string]*Service),
-		pods:        make(map[string]*Pod),
-		nodes:       make(map[string]*Node),
-		eventBus:    NewContainerEventBus(),
-		monitor:     NewClusterMonitor(),
+// unmountVolumeMounts 按相反顺序卸载mounts中的tmpfs和绑定挂载
+func unmountVolumeMounts(mounts []*Mount) {
+	for i := len(mounts) - 1; i >= 0; i-- {
+		unmount := unmountTmpfs
+		switch mounts[i].Type {
+		case "tmpfs":
+		case "bind":
+			unmount = unmountBind
+		default:
+			continue
+		}
+		if err := unmount(mounts[i].Target); err != nil {
+			log.Printf("Warning: failed to unmount %s: %v", mounts[i].Target, err)
+		}
 	}
 }
 
-func (co *ContainerOrchestrator) Start() error {
-	co.mutex.Lock()
-	defer co.mutex.Unlock()
+// ==================
+// 8. 辅助结构和函数
+// ==================
 
-	if co.running {
-		return fmt.Errorf("orchestrator already running")
-	}
+// 事件系统。每个订阅者拥有独立的有界队列和投递goroutine，事件按发布顺序逐个投递；
+// 队列满时按DeliveryPolicy丢弃或阻塞发布者
+type ContainerEventBus struct {
+	subscribers map[SubscriptionID]*eventSubscription
+	sinks       []EventSink
+	config      EventBusConfig
+	nextID      SubscriptionID
+	mutex       sync.RWMutex
+}
 
-	// 启动调度器
-	go co.schedulingLoop()
+// EventDeliveryPolicy 订阅者队列满时的处理策略
+type EventDeliveryPolicy int
 
-	// 启动服务管理
-	go co.serviceLoop()
+const (
+	// DeliveryDrop 丢弃新事件，发布者不受慢订阅者影响
+	DeliveryDrop EventDeliveryPolicy = iota
+	// DeliveryBlock 阻塞发布者直到订阅者队列有空位
+	DeliveryBlock
+)
 
-	// 启动监控
-	go co.monitorLoop()
+const defaultEventQueueSize = 256
 
-	co.running = true
-	fmt.Println("容器编排器已启动")
-	return nil
+// EventBusConfig 事件总线的订阅者队列配置
+type EventBusConfig struct {
+	QueueSize int // 每个订阅者的队列长度，0使用默认值
+	Policy    EventDeliveryPolicy
 }
 
-func (co *ContainerOrchestrator) CreatePod(podSpec *PodSpec) (*Pod, error) {
-	co.mutex.Lock()
-	defer co.mutex.Unlock()
-
-	pod := &Pod{
-		ID:         generatePodID(),
-		Name:       podSpec.Name,
-		Namespace:  podSpec.Namespace,
-		Labels:     podSpec.Labels,
-		Containers: make([]*Container, 0),
-		Status:     PodPending,
-		CreatedAt:  time.Now(),
-	}
+// SubscriptionID 订阅标识，用于Unsubscribe和查询丢弃计数
+type SubscriptionID uint64
 
-	// 创建Pod中的容器
-	for _, containerSpec := range podSpec.Containers {
-		container, err := co.runtime.CreateContainer(&ContainerConfig{
-			Image:      containerSpec.Image,
-			Cmd:        containerSpec.Command,
-			Env:        containerSpec.Env,
-			WorkingDir: containerSpec.WorkingDir,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to create container: %v", err)
-		}
-		pod.Containers = append(pod.Containers, container)
-	}
+// eventSubscription 一个订阅者的队列和投递状态
+type eventSubscription struct {
+	id        SubscriptionID
+	eventType EventType
+	all       bool // 订阅全部事件类型
+	handler   EventHandler
+	queue     chan *ContainerEvent
+	done      chan struct{}
+	once      sync.Once
+	dropped   int64 // 因队列满被丢弃的事件数，原子访问
+}
 
-	co.pods[pod.ID] = pod
-	fmt.Printf("创建Pod: %s (容器数: %d)\n", pod.Name, len(pod.Containers))
+type EventType int
 
-	// 提交给调度器
-	go co.schedulePod(pod)
+const (
+	EventContainerCreate EventType = iota
+	EventContainerStart
+	EventContainerStop
+	EventContainerRemove
+	EventContainerDie
+	EventContainerPause
+	EventContainerUnpause
+	EventContainerUnhealthy
+	EventContainerRestart
+	EventContainerOOM
+	EventPodCreate
+	EventPodSchedule
+	EventPodStart
+	EventPodStop
+)
 
-	return pod, nil
+type ContainerEvent struct {
+	Type          EventType
+	Container     *Container
+	Pod           *Pod
+	ContainerID   string // 从审计日志读取的事件只保留容器标识
+	ContainerName string
+	Message       string
+	Timestamp     time.Time
 }
 
-func (co *ContainerOrchestrator) schedulePod(pod *Pod) {
-	// 获取可用节点
-	nodes := co.getAvailableNodes()
-	if len(nodes) == 0 {
-		fmt.Printf("没有可用节点调度Pod: %s\n", pod.Name)
-		return
+type EventHandler func(*ContainerEvent)
+
+func NewContainerEventBus(config EventBusConfig) *ContainerEventBus {
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultEventQueueSize
+	}
+	return &ContainerEventBus{
+		subscribers: make(map[SubscriptionID]*eventSubscription),
+		config:      config,
 	}
+}
 
-	// 选择调度算法
-	algorithm := co.scheduler.getDefaultAlgorithm()
+// Subscribe 订阅指定类型的事件，返回订阅标识和取消订阅函数
+func (ceb *ContainerEventBus) Subscribe(eventType EventType, handler EventHandler) (SubscriptionID, func()) {
+	return ceb.subscribe(&eventSubscription{eventType: eventType, handler: handler})
+}
 
-	// 执行调度
-	selectedNode, err := algorithm.Schedule(pod, nodes)
-	if err != nil {
-		fmt.Printf("Pod调度失败: %s - %v\n", pod.Name, err)
-		return
-	}
+// SubscribeAll 订阅全部类型的事件
+func (ceb *ContainerEventBus) SubscribeAll(handler EventHandler) (SubscriptionID, func()) {
+	return ceb.subscribe(&eventSubscription{all: true, handler: handler})
+}
 
-	// 绑定到节点
-	pod.NodeName = selectedNode.Name
-	pod.Status = PodScheduled
+func (ceb *ContainerEventBus) subscribe(sub *eventSubscription) (SubscriptionID, func()) {
+	sub.queue = make(chan *ContainerEvent, ceb.config.QueueSize)
+	sub.done = make(chan struct{})
 
-	fmt.Printf("Pod调度成功: %s -> 节点 %s\n", pod.Name, selectedNode.Name)
+	ceb.mutex.Lock()
+	ceb.nextID++
+	sub.id = ceb.nextID
+	ceb.subscribers[sub.id] = sub
+	ceb.mutex.Unlock()
 
-	// 启动Pod中的容器
-	go co.startPodContainers(pod)
+	go sub.deliver()
+
+	id := sub.id
+	return id, func() { ceb.Unsubscribe(id) }
 }
 
-func (co *ContainerOrchestrator) startPodContainers(pod *Pod) {
-	pod.Status = PodRunning
-	pod.StartedAt = time.Now()
+// Unsubscribe 取消订阅并停止投递goroutine。队列中尚未投递的事件被丢弃，
+// 正在执行的处理函数会运行完毕；可重复调用
+func (ceb *ContainerEventBus) Unsubscribe(id SubscriptionID) {
+	ceb.mutex.Lock()
+	sub, exists := ceb.subscribers[id]
+	delete(ceb.subscribers, id)
+	ceb.mutex.Unlock()
 
-	for _, container := range pod.Containers {
-		if err := co.runtime.StartContainer(container.ID); err != nil {
-			fmt.Printf("启动容器失败: %s - %v\n", container.ID[:12], err)
-			pod.Status = PodFailed
-			return
-		}
+	if exists {
+		sub.once.Do(func() { close(sub.done) })
 	}
-
-	fmt.Printf("Pod运行中: %s (节点: %s)\n", pod.Name, pod.NodeName)
 }
 
-func (co *ContainerOrchestrator) CreateDeployment(deploySpec *DeploymentSpec) (*Deployment, error) {
-	co.mutex.Lock()
-	defer co.mutex.Unlock()
+// Dropped 返回订阅者因队列满被丢弃的事件数
+func (ceb *ContainerEventBus) Dropped(id SubscriptionID) int64 {
+	ceb.mutex.RLock()
+	sub, exists := ceb.subscribers[id]
+	ceb.mutex.RUnlock()
 
-	deployment := &Deployment{
-		ID:        generateDeploymentID(),
-		Name:      deploySpec.Name,
-		Namespace: deploySpec.Namespace,
-		Replicas:  deploySpec.Replicas,
-		Selector:  deploySpec.Selector,
-		Template:  deploySpec.Template,
-		Status:    DeploymentProgressing,
-		CreatedAt: time.Now(),
+	if !exists {
+		return 0
 	}
+	return atomic.LoadInt64(&sub.dropped)
+}
 
-	co.deployments[deployment.ID] = deployment
-	fmt.Printf("创建Deployment: %s (副本数: %d)\n", deployment.Name, deployment.Replicas)
-
-	// 创建副本Pod
-	go co.createReplicaPods(deployment)
+// deliver 按入队顺序逐个调用处理函数，取消订阅后立即停止
+func (sub *eventSubscription) deliver() {
+	for {
+		select {
+		case <-sub.done:
+			return
+		case event := <-sub.queue:
+			// 取消订阅与新事件同时就绪时优先退出
+			select {
+			case <-sub.done:
+				return
+			default:
+			}
+			sub.handler(event)
+		}
+	}
+}
 
-	return deployment, nil
+func (sub *eventSubscription) matches(eventType EventType) bool {
+	return sub.all || sub.eventType == eventType
 }
 
-func (co *ContainerOrchestrator) createReplicaPods(deployment *Deployment) {
-	var createdPods int32
+func (ceb *ContainerEventBus) Publish(event *ContainerEvent) {
+	ceb.mutex.RLock()
+	var targets []*eventSubscription
+	for _, sub := range ceb.subscribers {
+		if sub.matches(event.Type) {
+			targets = append(targets, sub)
+		}
+	}
+	sinks := ceb.sinks
+	policy := ceb.config.Policy
+	ceb.mutex.RUnlock()
 
-	for i := int32(0); i < deployment.Replicas; i++ {
-		podSpec := &PodSpec{
-			Name:       fmt.Sprintf("%s-%d", deployment.Name, i),
-			Namespace:  deployment.Namespace,
-			Labels:     deployment.Selector,
-			Containers: deployment.Template.Spec.Containers,
+	// 接收器同步调用，保证持久化顺序与发布顺序一致
+	for _, sink := range sinks {
+		if err := sink.WriteEvent(event); err != nil {
+			log.Printf("Warning: failed to record event %s: %v", event.Type, err)
 		}
+	}
 
-		pod, err := co.CreatePod(podSpec)
-		if err != nil {
-			fmt.Printf("创建副本Pod失败: %v\n", err)
+	for _, sub := range targets {
+		if policy == DeliveryBlock {
+			select {
+			case sub.queue <- event:
+			case <-sub.done:
+			}
 			continue
 		}
-
-		createdPods++
-		fmt.Printf("创建副本Pod: %s (%d/%d)\n", pod.Name, createdPods, deployment.Replicas)
+		select {
+		case sub.queue <- event:
+		case <-sub.done:
+		default:
+			if atomic.AddInt64(&sub.dropped, 1) == 1 {
+				log.Printf("Warning: event subscriber %d is falling behind, dropping %s", sub.id, event.Type)
+			}
+		}
 	}
+}
 
-	deployment.Status = DeploymentAvailable
-	deployment.UpdatedAt = time.Now()
+// EventSink 同步接收总线上的全部事件，按发布顺序调用
+type EventSink interface {
+	WriteEvent(event *ContainerEvent) error
 }
 
-func (co *ContainerOrchestrator) getAvailableNodes() []*Node {
-	co.mutex.RLock()
-	defer co.mutex.RUnlock()
+// AddSink 注册事件接收器
+func (ceb *ContainerEventBus) AddSink(sink EventSink) {
+	ceb.mutex.Lock()
+	defer ceb.mutex.Unlock()
 
-	nodes := make([]*Node, 0)
-	for _, node := range co.nodes {
-		if node.Status == NodeReady {
-			nodes = append(nodes, node)
-		}
-	}
+	ceb.sinks = append(ceb.sinks, sink)
+}
 
-	return nodes
+var eventTypeNames = map[EventType]string{
+	EventContainerCreate:    "container.create",
+	EventContainerStart:     "container.start",
+	EventContainerStop:      "container.stop",
+	EventContainerRemove:    "container.remove",
+	EventContainerDie:       "container.die",
+	EventContainerPause:     "container.pause",
+	EventContainerUnpause:   "container.unpause",
+	EventContainerUnhealthy: "container.unhealthy",
+	EventContainerRestart:   "container.restart",
+	EventContainerOOM:       "container.oom",
+	EventPodCreate:          "pod.create",
+	EventPodSchedule:        "pod.schedule",
+	EventPodStart:           "pod.start",
+	EventPodStop:            "pod.stop",
 }
 
-func (co *ContainerOrchestrator) schedulingLoop() {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+func (et EventType) String() string {
+	if name, exists := eventTypeNames[et]; exists {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(et))
+}
 
-	for co.running {
-		select {
-		case <-ticker.C:
-			co.reconcileState()
+func parseEventType(name string) (EventType, error) {
+	for eventType, eventName := range eventTypeNames {
+		if eventName == name {
+			return eventType, nil
 		}
 	}
+	return 0, fmt.Errorf("unknown event type: %s", name)
 }
 
-func (co *ContainerOrchestrator) serviceLoop() {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
+// ==================
+// 8.1 事件审计日志
+// ==================
 
-	for co.running {
-		select {
-		case <-ticker.C:
-			co.updateServices()
-		}
+const (
+	eventLogFile              = "events.log"
+	defaultEventLogMaxSize    = 10 * 1024 * 1024
+	defaultEventLogMaxAge     = 7 * 24 * time.Hour
+	defaultEventLogMaxBackups = 5
+)
+
+// EventLogConfig 审计日志的容量限制。当前文件超过MaxSize时轮转，
+// 轮转文件最多保留MaxBackups个，且早于MaxAge的轮转文件会被删除
+type EventLogConfig struct {
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+// EventLog 以JSON Lines格式持久化容器事件的审计日志
+type EventLog struct {
+	dir    string
+	config EventLogConfig
+	file   *os.File
+	size   int64
+	closed bool
+	mutex  sync.Mutex
+}
+
+// eventRecord 审计日志中的一条记录
+type eventRecord struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Type          string    `json:"type"`
+	ContainerID   string    `json:"containerId,omitempty"`
+	ContainerName string    `json:"containerName,omitempty"`
+	PodID         string    `json:"podId,omitempty"`
+	PodName       string    `json:"podName,omitempty"`
+	Message       string    `json:"message"`
+}
+
+// EventQuery 审计事件查询条件，零值字段不参与过滤
+type EventQuery struct {
+	Container string // 容器ID或名称
+	Types     []EventType
+	Since     time.Time
+	Until     time.Time
+}
+
+func NewEventLog(dir string, config EventLogConfig) *EventLog {
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaultEventLogMaxSize
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = defaultEventLogMaxAge
 	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = defaultEventLogMaxBackups
+	}
+	return &EventLog{dir: dir, config: config}
 }
 
-func (co *ContainerOrchestrator) monitorLoop() {
-	ticker := time.NewTicker(15 * time.Second)
-	defer ticker.Stop()
+// WriteEvent 追加一条事件记录，文件在首次写入时创建
+func (el *EventLog) WriteEvent(event *ContainerEvent) error {
+	record := newEventRecord(event)
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
 
-	for co.running {
-		select {
-		case <-ticker.C:
-			co.monitor.CollectMetrics()
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
+
+	if el.closed {
+		return fmt.Errorf("event log is closed")
+	}
+	if el.file == nil {
+		if err := el.openLocked(); err != nil {
+			return err
+		}
+	}
+	if el.size > 0 && el.size+int64(len(line)) > el.config.MaxSize {
+		if err := el.rotateLocked(); err != nil {
+			return err
 		}
 	}
+
+	n, err := el.file.Write(line)
+	el.size += int64(n)
+	return err
 }
 
-func (co *ContainerOrchestrator) reconcileState() {
-	// 确保期望状态与实际状态一致
-	for _, deployment := range co.deployments {
-		co.reconcileDeployment(deployment)
+func newEventRecord(event *ContainerEvent) *eventRecord {
+	record := &eventRecord{
+		Timestamp:     event.Timestamp,
+		Type:          event.Type.String(),
+		ContainerID:   event.ContainerID,
+		ContainerName: event.ContainerName,
+		Message:       event.Message,
+	}
+	if event.Container != nil {
+		record.ContainerID = event.Container.ID
+		record.ContainerName = event.Container.Name
+	}
+	if event.Pod != nil {
+		record.PodID = event.Pod.ID
+		record.PodName = event.Pod.Name
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
 	}
+	if record.Message == "" {
+		record.Message = fmt.Sprintf("%s %s", record.Type, record.ContainerID)
+	}
+	return record
 }
 
-func (co *ContainerOrchestrator) reconcileDeployment(deployment *Deployment) {
-	// 统计当前运行的Pod数量
-	runningPods := co.countRunningPodsForDeployment(deployment)
-
-	if runningPods < deployment.Replicas {
-		// 需要创建更多Pod
-		needed := deployment.Replicas - runningPods
-		fmt.Printf("Deployment %s 需要创建 %d 个Pod\n", deployment.Name, needed)
-	} else if runningPods > deployment.Replicas {
-		// 需要删除多余的Pod
-		excess := runningPods - deployment.Replicas
-		fmt.Printf("Deployment %s 需要删除 %d 个Pod\n", deployment.Name, excess)
-	}
+func (el *EventLog) currentPath() string {
+	return filepath.Join(el.dir, eventLogFile)
 }
 
-func (co *ContainerOrchestrator) countRunningPodsForDeployment(deployment *Deployment) int32 {
-	var count int32
-	for _, pod := range co.pods {
-		if pod.Namespace == deployment.Namespace {
-			// 检查标签选择器匹配
-			if co.labelsMatch(pod.Labels, deployment.Selector) && pod.Status == PodRunning {
-				count++
-			}
-		}
+func (el *EventLog) backupPath(index int) string {
+	return fmt.Sprintf("%s.%d", el.currentPath(), index)
+}
+
+func (el *EventLog) openLocked() error {
+	if err := os.MkdirAll(el.dir, 0700); err != nil {
+		return err
 	}
-	return count
+	file, err := os.OpenFile(el.currentPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	el.file = file
+	el.size = info.Size()
+	return nil
 }
 
-func (co *ContainerOrchestrator) labelsMatch(podLabels, selector map[string]string) bool {
-	for key, value := range selector {
-		if podLabels[key] != value {
-			return false
-		}
+// rotateLocked 将当前文件轮转为events.log.1，已有的轮转文件序号依次后移
+func (el *EventLog) rotateLocked() error {
+	if err := el.file.Close(); err != nil {
+		return err
 	}
-	return true
-}
+	el.file = nil
 
-func (co *ContainerOrchestrator) updateServices() {
-	// 更新服务端点
-	for _, service := range co.services {
-		endpoints := co.getServiceEndpoints(service)
-		fmt.Printf("服务 %s 有 %d 个端点\n", service.Name, len(endpoints))
+	if err := os.Remove(el.backupPath(el.config.MaxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := el.config.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(el.backupPath(i), el.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(el.currentPath(), el.backupPath(1)); err != nil {
+		return err
 	}
-}
 
-func (co *ContainerOrchestrator) getServiceEndpoints(service *Service) []string {
-	endpoints := make([]string, 0)
+	el.pruneLocked()
+	return el.openLocked()
+}
 
-	for _, pod := range co.pods {
-		if pod.Namespace == service.Namespace && pod.Status == PodRunning {
-			if co.labelsMatch(pod.Labels, service.Selector) {
-				// 获取Pod IP地址
-				endpoints = append(endpoints, fmt.Sprintf("pod-%s", pod.ID[:12]))
+// pruneLocked 删除超过保留期限的轮转文件
+func (el *EventLog) pruneLocked() {
+	cutoff := time.Now().Add(-el.config.MaxAge)
+	for i := 1; i <= el.config.MaxBackups; i++ {
+		info, err := os.Stat(el.backupPath(i))
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(el.backupPath(i)); err != nil {
+				log.Printf("Warning: failed to remove expired event log: %v", err)
 			}
 		}
 	}
-
-	return endpoints
 }
 
-// ==================
-// 8. 辅助结构和函数
-// ==================
+// Query 按时间顺序读取所有日志文件并返回匹配的事件。
+// 返回的事件只包含持久化的字段，Container和Pod为空
+func (el *EventLog) Query(filter EventQuery) ([]*ContainerEvent, error) {
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
 
-// 事件系统
-type ContainerEventBus struct {
-	subscribers map[EventType][]EventHandler
-	mutex       sync.RWMutex
+	paths := make([]string, 0, el.config.MaxBackups+1)
+	for i := el.config.MaxBackups; i >= 1; i-- {
+		paths = append(paths, el.backupPath(i))
+	}
+	paths = append(paths, el.currentPath())
+
+	var events []*ContainerEvent
+	for _, path := range paths {
+		matched, err := readEventRecords(path, filter)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, matched...)
+	}
+	return events, nil
 }
 
-type EventType int
+func readEventRecords(path string, filter EventQuery) ([]*ContainerEvent, error) {
+	file, err := os.Open(path) // #nosec G304 -- 审计日志路径由运行时生成
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
 
-const (
-	EventContainerCreate EventType = iota
-	EventContainerStart
-	EventContainerStop
-	EventContainerRemove
-	EventContainerDie
-	EventPodCreate
-	EventPodSchedule
-	EventPodStart
-	EventPodStop
-)
+	var events []*ContainerEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record eventRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// 跳过崩溃时写入不完整的行
+			continue
+		}
+		eventType, err := parseEventType(record.Type)
+		if err != nil {
+			continue
+		}
 
-type ContainerEvent struct {
-	Type      EventType
-	Container *Container
-	Pod       *Pod
-	Message   string
-	Timestamp time.Time
+		event := &ContainerEvent{
+			Type:          eventType,
+			ContainerID:   record.ContainerID,
+			ContainerName: record.ContainerName,
+			Message:       record.Message,
+			Timestamp:     record.Timestamp,
+		}
+		if filter.matches(event) {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
 }
 
-type EventHandler func(*ContainerEvent)
-
-func NewContainerEventBus() *ContainerEventBus {
-	return &ContainerEventBus{
-		subscribers: make(map[EventType][]EventHandler),
+func (q EventQuery) matches(event *ContainerEvent) bool {
+	if q.Container != "" && q.Container != event.ContainerID && q.Container != event.ContainerName {
+		return false
+	}
+	if len(q.Types) > 0 {
+		found := false
+		for _, eventType := range q.Types {
+			if eventType == event.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
 	}
+	if !q.Since.IsZero() && event.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && event.Timestamp.After(q.Until) {
+		return false
+	}
+	return true
 }
 
-func (ceb *ContainerEventBus) Subscribe(eventType EventType, handler EventHandler) {
-	ceb.mutex.Lock()
-	defer ceb.mutex.Unlock()
+// Close 将当前日志文件落盘后关闭，之后的写入返回错误
+func (el *EventLog) Close() error {
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
 
-	ceb.subscribers[eventType] = append(ceb.subscribers[eventType], handler)
+	el.closed = true
+	if el.file == nil {
+		return nil
+	}
+	err := el.file.Sync()
+	if closeErr := el.file.Close(); err == nil {
+		err = closeErr
+	}
+	el.file = nil
+	return err
 }
 
-func (ceb *ContainerEventBus) Publish(event *ContainerEvent) {
-	ceb.mutex.RLock()
-	handlers := ceb.subscribers[event.Type]
-	ceb.mutex.RUnlock()
-
-	for _, handler := range handlers {
-		go handler(event)
-	}
+// QueryEvents 查询持久化的容器事件审计记录
+func (cr *ContainerRuntime) QueryEvents(filter EventQuery) ([]*ContainerEvent, error) {
+	return cr.eventLog.Query(filter)
 }
 
 // 监控组件
@@ -2311,20 +9091,29 @@ type ContainerMonitor struct {
 type ClusterMonitor struct {
 	nodeMetrics map[string]*NodeMetrics
 	podMetrics  map[string]*PodMetrics
+	cpuSamples  map[string]cpuSample // 容器上次采样的CPU累计用量，用于计算采样区间内的使用率
 	mutex       sync.RWMutex
 }
 
+// cpuSample 一次CPU累计用量采样
+type cpuSample struct {
+	usageUsec int64
+	at        time.Time
+}
+
+// NodeMetrics 节点上全部Pod指标之和
 type NodeMetrics struct {
-	CPUUsage    float64
-	MemoryUsage float64
+	CPUUsage    float64 // 单核百分比，100表示占满一个CPU
+	MemoryUsage float64 // 字节
 	DiskUsage   float64
 	NetworkIO   NetworkIOMetrics
 	Timestamp   time.Time
 }
 
+// PodMetrics Pod内运行中容器的指标之和
 type PodMetrics struct {
-	CPUUsage    float64
-	MemoryUsage float64
+	CPUUsage    float64 // 单核百分比，100表示占满一个CPU
+	MemoryUsage float64 // 字节
 	NetworkIO   NetworkIOMetrics
 	Timestamp   time.Time
 }
@@ -2346,25 +9135,104 @@ func NewClusterMonitor() *ClusterMonitor {
 	return &ClusterMonitor{
 		nodeMetrics: make(map[string]*NodeMetrics),
 		podMetrics:  make(map[string]*PodMetrics),
+		cpuSamples:  make(map[string]cpuSample),
 	}
 }
 
-func (cm *ClusterMonitor) CollectMetrics() {
-	// 收集节点指标
-	fmt.Println("收集集群指标...")
+// CollectMetrics 从各Pod运行中容器的cgroup采样CPU与内存用量，汇总为Pod指标，
+// 再按Pod所在节点汇总为节点指标。CPU使用率由本次与上次采样的累计用量之差除以
+// 采样间隔得出，容器首次采样时为0
+func (cm *ClusterMonitor) CollectMetrics(pods []*Pod, cgroups *CgroupManager, now time.Time) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
 
-	// 模拟指标收集
-	timestamp := time.Now()
+	podMetrics := make(map[string]*PodMetrics, len(pods))
+	nodeMetrics := make(map[string]*NodeMetrics)
+	samples := make(map[string]cpuSample)
 
-	// 更新节点指标
-	cm.mutex.Lock()
-	cm.nodeMetrics["node-1"] = &NodeMetrics{
-		CPUUsage:    65.5,
-		MemoryUsage: 78.2,
-		DiskUsage:   45.3,
-		Timestamp:   timestamp,
+	for _, pod := range pods {
+		metrics := &PodMetrics{Timestamp: now}
+		for _, container := range pod.Containers {
+			if !container.IsRunning() {
+				continue
+			}
+			cpuPercent, memory := cm.sampleContainerLocked(container, cgroups, now, samples)
+			metrics.CPUUsage += cpuPercent
+			metrics.MemoryUsage += float64(memory)
+		}
+		podMetrics[pod.ID] = metrics
+
+		if pod.NodeName == "" {
+			continue
+		}
+		node, exists := nodeMetrics[pod.NodeName]
+		if !exists {
+			node = &NodeMetrics{Timestamp: now}
+			nodeMetrics[pod.NodeName] = node
+		}
+		node.CPUUsage += metrics.CPUUsage
+		node.MemoryUsage += metrics.MemoryUsage
+	}
+
+	// 只保留本轮仍存在的容器和Pod，已删除的对象不再占用内存
+	cm.podMetrics = podMetrics
+	cm.nodeMetrics = nodeMetrics
+	cm.cpuSamples = samples
+	fmt.Printf("收集集群指标: %d 个Pod, %d 个节点\n", len(podMetrics), len(nodeMetrics))
+}
+
+// sampleContainerLocked 返回容器在采样区间内的CPU使用率和当前内存用量，并将本次采样记入samples
+func (cm *ClusterMonitor) sampleContainerLocked(container *Container, cgroups *CgroupManager, now time.Time, samples map[string]cpuSample) (float64, int64) {
+	var cpuPercent float64
+	if cgroup := container.Cgroups["cpu"]; cgroup != nil {
+		if stats, err := cgroups.GetStats(cgroup); err == nil {
+			if cpuStats, ok := stats["cpu"].(map[string]int64); ok {
+				if usage, exists := cpuStats["usage_usec"]; exists {
+					current := cpuSample{usageUsec: usage, at: now}
+					// 累计用量减小说明cgroup被重建，以本次采样为新的基准
+					if previous, exists := cm.cpuSamples[container.ID]; exists && usage >= previous.usageUsec && now.After(previous.at) {
+						elapsed := now.Sub(previous.at).Microseconds()
+						cpuPercent = float64(usage-previous.usageUsec) / float64(elapsed) * 100
+					}
+					samples[container.ID] = current
+				}
+			}
+		}
+	}
+
+	var memory int64
+	if cgroup := container.Cgroups["memory"]; cgroup != nil {
+		if stats, err := cgroups.GetStats(cgroup); err == nil {
+			if memStats, ok := stats["memory"].(map[string]int64); ok {
+				memory = memStats["usage"]
+			}
+		}
+	}
+	return cpuPercent, memory
+}
+
+// GetPodMetrics 返回Pod最近一次采样的指标副本
+func (cm *ClusterMonitor) GetPodMetrics(podID string) (PodMetrics, bool) {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	metrics, exists := cm.podMetrics[podID]
+	if !exists {
+		return PodMetrics{}, false
+	}
+	return *metrics, true
+}
+
+// GetNodeMetrics 返回节点最近一次采样的指标副本
+func (cm *ClusterMonitor) GetNodeMetrics(nodeName string) (NodeMetrics, bool) {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	metrics, exists := cm.nodeMetrics[nodeName]
+	if !exists {
+		return NodeMetrics{}, false
 	}
-	cm.mutex.Unlock()
+	return *metrics, true
 }
 
 // 调度器组件
@@ -2377,6 +9245,7 @@ func NewContainerScheduler() *ContainerScheduler {
 	// 注册调度算法
 	cs.algorithms["default"] = &DefaultSchedulingAlgorithm{}
 	cs.algorithms["least-allocated"] = &LeastAllocatedAlgorithm{}
+	cs.algorithms["most-allocated"] = &MostAllocatedAlgorithm{}
 
 	return cs
 }
@@ -2397,15 +9266,19 @@ func (dsa *DefaultSchedulingAlgorithm) Schedule(pod *Pod, nodes []*Node) (*Node,
 		return nil, fmt.Errorf("no available nodes")
 	}
 
-	// 简单的轮询调度
-	selectedNode := nodes[0]
-	fmt.Printf("调度算法选择节点: %s\n", selectedNode.Name)
+	// 选择第一个能容纳Pod的节点
+	for _, node := range nodes {
+		if node.fits(pod) {
+			fmt.Printf("调度算法选择节点: %s\n", node.Name)
+			return node, nil
+		}
+	}
 
-	return selectedNode, nil
+	return nil, fmt.Errorf("no node has enough resources for pod %s", pod.Name)
 }
 
 func (dsa *DefaultSchedulingAlgorithm) Preempt(pod *Pod, nodes []*Node) ([]*Pod, *Node, error) {
-	return nil, nil, fmt.Errorf("preemption not implemented")
+	return preemptLowerPriority(pod, nodes)
 }
 
 // 最少分配调度算法
@@ -2420,34 +9293,427 @@ func (laa *LeastAllocatedAlgorithm) Schedule(pod *Pod, nodes []*Node) (*Node, er
 		return nil, fmt.Errorf("no available nodes")
 	}
 
-	// 选择资源使用率最低的节点
+	// 在能容纳Pod的节点中选择资源使用率最低的节点
 	var bestNode *Node
-	var lowestScore float64 = 100.0
+	var lowestScore float64
 
 	for _, node := range nodes {
+		if !node.fits(pod) {
+			continue
+		}
 		score := laa.calculateNodeScore(node)
-		if score < lowestScore {
+		if bestNode == nil || score < lowestScore {
 			lowestScore = score
 			bestNode = node
 		}
 	}
 
-	if bestNode == nil {
-		return nodes[0], nil
+	if bestNode == nil {
+		return nil, fmt.Errorf("no node has enough resources for pod %s", pod.Name)
+	}
+
+	fmt.Printf("最少分配算法选择节点: %s (得分: %.2f)\n", bestNode.Name, lowestScore)
+	return bestNode, nil
+}
+
+// calculateNodeScore 按已绑定Pod的资源请求计算节点CPU与内存使用率的平均值（0-100）
+func (laa *LeastAllocatedAlgorithm) calculateNodeScore(node *Node) float64 {
+	return nodeUtilization(node, resourceAmount{}) * 100
+}
+
+func (laa *LeastAllocatedAlgorithm) Preempt(pod *Pod, nodes []*Node) ([]*Pod, *Node, error) {
+	return preemptLowerPriority(pod, nodes)
+}
+
+// 最多分配调度算法（装箱），优先把Pod放到最满的节点上，减少使用中的节点数量
+type MostAllocatedAlgorithm struct{}
+
+func (maa *MostAllocatedAlgorithm) Name() string {
+	return "most-allocated"
+}
+
+func (maa *MostAllocatedAlgorithm) Schedule(pod *Pod, nodes []*Node) (*Node, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no available nodes")
+	}
+
+	// 在能容纳Pod的节点中选择放置后使用率最高的节点
+	request := podRequests(pod)
+	var bestNode *Node
+	highestScore := -1.0
+	for _, node := range nodes {
+		if !node.fits(pod) {
+			continue
+		}
+		if score := nodeUtilization(node, request); score > highestScore {
+			highestScore = score
+			bestNode = node
+		}
+	}
+
+	if bestNode == nil {
+		return nil, fmt.Errorf("no node has enough resources for pod %s", pod.Name)
+	}
+
+	fmt.Printf("最多分配算法选择节点: %s (得分: %.2f)\n", bestNode.Name, highestScore*100)
+	return bestNode, nil
+}
+
+func (maa *MostAllocatedAlgorithm) Preempt(pod *Pod, nodes []*Node) ([]*Pod, *Node, error) {
+	return preemptLowerPriority(pod, nodes)
+}
+
+// ==================
+// 8.2 资源核算与抢占
+// ==================
+
+// resourceAmount 解析后的资源数量，CPU以毫核为单位，内存以字节为单位
+type resourceAmount struct {
+	MilliCPU int64
+	Memory   int64
+}
+
+func (r resourceAmount) add(other resourceAmount) resourceAmount {
+	return resourceAmount{MilliCPU: r.MilliCPU + other.MilliCPU, Memory: r.Memory + other.Memory}
+}
+
+func (r resourceAmount) sub(other resourceAmount) resourceAmount {
+	return resourceAmount{MilliCPU: r.MilliCPU - other.MilliCPU, Memory: r.Memory - other.Memory}
+}
+
+// resourceList 转换为ResourceList表示，CPU使用毫核、内存使用字节
+func (r resourceAmount) resourceList() ResourceList {
+	return ResourceList{
+		"cpu":    fmt.Sprintf("%dm", r.MilliCPU),
+		"memory": strconv.FormatInt(r.Memory, 10),
+	}
+}
+
+// unlimitedResource 节点未声明某项资源时视为不受限制
+const unlimitedResource = math.MaxInt64 / 2
+
+// memoryUnits 内存数量的单位后缀
+var memoryUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"K", 1000}, {"M", 1000 * 1000}, {"G", 1000 * 1000 * 1000}, {"T", 1000 * 1000 * 1000 * 1000},
+}
+
+// parseResourceList 解析cpu和memory两项资源，未出现的资源记为0
+func parseResourceList(list ResourceList) (resourceAmount, error) {
+	var amount resourceAmount
+	for name, value := range list {
+		var err error
+		switch name {
+		case "cpu":
+			amount.MilliCPU, err = parseCPUQuantity(value)
+		case "memory":
+			amount.Memory, err = parseMemoryQuantity(value)
+		default:
+			continue
+		}
+		if err != nil {
+			return resourceAmount{}, err
+		}
+	}
+	return amount, nil
+}
+
+// parseCPUQuantity 解析"500m"、"2"、"0.5"形式的CPU数量，返回毫核
+func parseCPUQuantity(value string) (int64, error) {
+	if milli, ok := strings.CutSuffix(value, "m"); ok {
+		n, err := strconv.ParseInt(milli, 10, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid cpu quantity %q", value)
+		}
+		return n, nil
+	}
+	cores, err := strconv.ParseFloat(value, 64)
+	if err != nil || cores < 0 || math.IsInf(cores, 0) || math.IsNaN(cores) {
+		return 0, fmt.Errorf("invalid cpu quantity %q", value)
+	}
+	return int64(math.Round(cores * 1000)), nil
+}
+
+// parseMemoryQuantity 解析"128Mi"、"1G"、"1048576"形式的内存数量，返回字节
+func parseMemoryQuantity(value string) (int64, error) {
+	multiplier := int64(1)
+	number := value
+	for _, unit := range memoryUnits {
+		if trimmed, ok := strings.CutSuffix(value, unit.suffix); ok {
+			number, multiplier = trimmed, unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid memory quantity %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// podRequests 返回Pod的资源请求。CreatePod已汇总到ResourceRequests，
+// 直接构造的Pod则汇总Spec中全部容器的请求
+func podRequests(pod *Pod) resourceAmount {
+	var total resourceAmount
+	if pod.ResourceRequests != nil {
+		total, _ = parseResourceList(pod.ResourceRequests)
+		return total
+	}
+	if pod.Spec == nil {
+		return total
+	}
+	for _, container := range pod.Spec.Containers {
+		amount, _ := parseResourceList(container.ResourceRequests)
+		total = total.add(amount)
+	}
+	return total
+}
+
+// allocatable 返回节点可分配的资源，未设置Allocatable时使用Capacity
+func (n *Node) allocatable() resourceAmount {
+	list := n.Allocatable
+	if len(list) == 0 {
+		list = n.Capacity
+	}
+	amount := resourceAmount{MilliCPU: unlimitedResource, Memory: unlimitedResource}
+	if value, ok := list["cpu"]; ok {
+		if cpu, err := parseCPUQuantity(value); err == nil {
+			amount.MilliCPU = cpu
+		}
+	}
+	if value, ok := list["memory"]; ok {
+		if memory, err := parseMemoryQuantity(value); err == nil {
+			amount.Memory = memory
+		}
+	}
+	return amount
+}
+
+// requested 返回节点上已绑定Pod的资源请求总和
+func (n *Node) requested() resourceAmount {
+	var total resourceAmount
+	for _, pod := range n.pods {
+		total = total.add(podRequests(pod))
+	}
+	return total
+}
+
+// fits 判断节点剩余资源能否容纳Pod
+func (n *Node) fits(pod *Pod) bool {
+	return fitsWithin(n.allocatable().sub(n.requested()), podRequests(pod))
+}
+
+func fitsWithin(free, request resourceAmount) bool {
+	return request.MilliCPU <= free.MilliCPU && request.Memory <= free.Memory
+}
+
+// nodeUtilization 返回放置extra之后节点CPU与内存使用率的平均值，未声明的资源不参与计算
+func nodeUtilization(node *Node, extra resourceAmount) float64 {
+	allocatable := node.allocatable()
+	used := node.requested().add(extra)
+
+	var total float64
+	var count int
+	if allocatable.MilliCPU != unlimitedResource && allocatable.MilliCPU > 0 {
+		total += float64(used.MilliCPU) / float64(allocatable.MilliCPU)
+		count++
+	}
+	if allocatable.Memory != unlimitedResource && allocatable.Memory > 0 {
+		total += float64(used.Memory) / float64(allocatable.Memory)
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// bindPod 在节点上为Pod预留资源
+func (n *Node) bindPod(pod *Pod) {
+	if n.pods == nil {
+		n.pods = make(map[string]*Pod)
+	}
+	n.pods[pod.ID] = pod
+	n.Allocated = n.requested().resourceList()
+}
+
+// preemptLowerPriority 为无法调度的Pod寻找抢占方案：在每个节点上按优先级从低到高、
+// 同优先级先新后旧的顺序选出严格低于该Pod优先级的牺牲者，直到腾出足够资源。
+// 多个节点可行时选择最高牺牲者优先级最低、其次牺牲者最少的节点
+func preemptLowerPriority(pod *Pod, nodes []*Node) ([]*Pod, *Node, error) {
+	request := podRequests(pod)
+
+	var bestNode *Node
+	var bestVictims []*Pod
+	for _, node := range nodes {
+		candidates := make([]*Pod, 0, len(node.pods))
+		for _, bound := range node.pods {
+			if bound.Priority < pod.Priority {
+				candidates = append(candidates, bound)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			if candidates[i].Priority != candidates[j].Priority {
+				return candidates[i].Priority < candidates[j].Priority
+			}
+			if !candidates[i].CreatedAt.Equal(candidates[j].CreatedAt) {
+				return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+			}
+			return candidates[i].ID < candidates[j].ID
+		})
+
+		free := node.allocatable().sub(node.requested())
+		var victims []*Pod
+		for _, candidate := range candidates {
+			if fitsWithin(free, request) {
+				break
+			}
+			free = free.add(podRequests(candidate))
+			victims = append(victims, candidate)
+		}
+		if !fitsWithin(free, request) || len(victims) == 0 {
+			continue
+		}
+
+		if bestNode == nil || betterVictims(victims, bestVictims) {
+			bestNode, bestVictims = node, victims
+		}
+	}
+
+	if bestNode == nil {
+		return nil, nil, fmt.Errorf("no lower-priority victims can free enough resources for pod %s", pod.Name)
+	}
+	fmt.Printf("抢占调度: Pod %s 抢占节点 %s 上的 %d 个Pod\n", pod.Name, bestNode.Name, len(bestVictims))
+	return bestVictims, bestNode, nil
+}
+
+// betterVictims 比较两组牺牲者，最高优先级更低或数量更少的方案更好
+func betterVictims(a, b []*Pod) bool {
+	maxA, maxB := a[len(a)-1].Priority, b[len(b)-1].Priority
+	if maxA != maxB {
+		return maxA < maxB
+	}
+	return len(a) < len(b)
+}
+
+// ==================
+// 8.3 节点亲和性
+// ==================
+
+// LabelOperator 标签规则的比较方式
+type LabelOperator string
+
+const (
+	LabelOpIn           LabelOperator = "In"
+	LabelOpNotIn        LabelOperator = "NotIn"
+	LabelOpExists       LabelOperator = "Exists"
+	LabelOpDoesNotExist LabelOperator = "DoesNotExist"
+)
+
+// LabelRule 针对单个标签键的匹配规则
+type LabelRule struct {
+	Key      string
+	Operator LabelOperator
+	Values   []string
+}
+
+// matches 判断标签集合是否满足规则
+func (r LabelRule) matches(labels map[string]string) bool {
+	value, exists := labels[r.Key]
+	switch r.Operator {
+	case LabelOpIn:
+		return exists && containsString(r.Values, value)
+	case LabelOpNotIn:
+		return !exists || !containsString(r.Values, value)
+	case LabelOpExists:
+		return exists
+	case LabelOpDoesNotExist:
+		return !exists
+	}
+	return false
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+func validateLabelRules(rules []LabelRule) error {
+	for _, rule := range rules {
+		if rule.Key == "" {
+			return fmt.Errorf("label rule key is required")
+		}
+		switch rule.Operator {
+		case LabelOpIn, LabelOpNotIn:
+			if len(rule.Values) == 0 {
+				return fmt.Errorf("operator %s on %q requires values", rule.Operator, rule.Key)
+			}
+		case LabelOpExists, LabelOpDoesNotExist:
+			if len(rule.Values) != 0 {
+				return fmt.Errorf("operator %s on %q does not take values", rule.Operator, rule.Key)
+			}
+		default:
+			return fmt.Errorf("unknown label operator %q", rule.Operator)
+		}
 	}
+	return nil
+}
 
-	fmt.Printf("最少分配算法选择节点: %s (得分: %.2f)\n", bestNode.Name, lowestScore)
-	return bestNode, nil
+// matchAllRules 空规则列表视为不匹配，避免空的反亲和性排除全部节点
+func matchAllRules(rules []LabelRule, labels map[string]string) bool {
+	if len(rules) == 0 {
+		return false
+	}
+	for _, rule := range rules {
+		if !rule.matches(labels) {
+			return false
+		}
+	}
+	return true
 }
 
-func (laa *LeastAllocatedAlgorithm) calculateNodeScore(node *Node) float64 {
-	// 简化的评分计算
-	// 实际应该基于CPU和内存使用率
-	return 50.0 // 模拟评分
+// satisfiesAffinity 判断节点是否满足Pod的节点选择器、亲和性和反亲和性，调用方需持有co.mutex
+func satisfiesAffinity(pod *Pod, node *Node) bool {
+	spec := pod.Spec
+	if spec == nil {
+		return true
+	}
+	for key, value := range spec.NodeSelector {
+		if node.Labels[key] != value {
+			return false
+		}
+	}
+	for _, rule := range spec.Affinity {
+		if !rule.matches(node.Labels) {
+			return false
+		}
+	}
+	if len(spec.AntiAffinity) > 0 {
+		for _, other := range node.pods {
+			if other.ID != pod.ID && other.Namespace == pod.Namespace && matchAllRules(spec.AntiAffinity, other.Labels) {
+				return false
+			}
+		}
+	}
+	return true
 }
 
-func (laa *LeastAllocatedAlgorithm) Preempt(pod *Pod, nodes []*Node) ([]*Pod, *Node, error) {
-	return nil, nil, fmt.Errorf("preemption not implemented")
+// filterNodesByAffinity 返回满足Pod亲和性约束的节点，保持原有顺序
+func filterNodesByAffinity(pod *Pod, nodes []*Node) []*Node {
+	filtered := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		if satisfiesAffinity(pod, node) {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered
 }
 
 // 各种枚举和结构定义
@@ -2486,19 +9752,27 @@ const (
 
 // 各种规格和配置结构
 type PodSpec struct {
-	Name       string
-	Namespace  string
-	Labels     map[string]string
-	Containers []ContainerSpec
+	Name         string
+	Namespace    string
+	Labels       map[string]string
+	Containers   []ContainerSpec
+	Priority     int
+	NodeSelector map[string]string // 节点必须具有全部标签
+	Affinity     []LabelRule       // 节点标签必须满足全部规则
+	AntiAffinity []LabelRule       // 避开已运行满足全部规则的同命名空间Pod的节点
 }
 
 type ContainerSpec struct {
-	Name       string
-	Image      string
-	Command    []string
-	Args       []string
-	Env        []string
-	WorkingDir string
+	Name             string
+	Image            string
+	Command          []string
+	Args             []string
+	Env              []string
+	EnvFrom          []EnvFromSource
+	VolumeMounts     []VolumeMount
+	WorkingDir       string
+	SecurityContext  *SecurityContext
+	ResourceRequests ResourceList // 如{"cpu": "500m", "memory": "128Mi"}
 }
 
 type DeploymentSpec struct {
@@ -2507,6 +9781,7 @@ type DeploymentSpec struct {
 	Replicas  int32
 	Selector  map[string]string
 	Template  *PodTemplate
+	Strategy  DeploymentStrategy
 }
 
 type PodTemplate struct {
@@ -2518,7 +9793,9 @@ type PodTemplateSpec struct {
 }
 
 type DeploymentStrategy struct {
-	Type string
+	Type           string
+	MaxSurge       int32 // 滚动更新期间允许超出Replicas的Pod数量
+	MaxUnavailable int32 // 滚动更新期间允许不可用的Pod数量
 }
 
 // 各种资源和配置
@@ -2566,9 +9843,10 @@ type EndpointConfig struct {
 }
 
 type NetworkConfig struct {
-	Name   string
-	Driver string
-	IPAM   *NetworkIPAM
+	Name    string
+	Driver  string
+	IPAM    *NetworkIPAM
+	Options map[string]string // 驱动相关选项，如覆盖网络的vxlan.id
 }
 
 type ContainerVolume struct {
@@ -2614,6 +9892,9 @@ type (
 		MaxNodes          int
 		SchedulerPolicy   string
 		MonitoringEnabled bool
+		ClusterCIDR       string // 服务ClusterIP的分配范围，为空时使用defaultClusterCIDR
+		NodePortRange     string // NodePort分配范围，形如"30000-32767"，为空时使用默认范围
+		NodePortAddress   string // NodePort代理监听的主机地址，为空时监听全部地址
 	}
 	NetworkConfigReference struct {
 		Network string
@@ -2702,6 +9983,110 @@ func NewIPAddressManager() *IPAddressManager {
 	}
 }
 
+// AddPool 登记子网地址池，gateway不会被分配给容器
+func (ipam *IPAddressManager) AddPool(subnet, gateway string) error {
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return fmt.Errorf("invalid subnet %q: %v", subnet, err)
+	}
+	if network.IP.To4() == nil {
+		return fmt.Errorf("only IPv4 subnets are supported: %s", subnet)
+	}
+
+	ipam.mutex.Lock()
+	defer ipam.mutex.Unlock()
+
+	if _, exists := ipam.pools[subnet]; exists {
+		return fmt.Errorf("address pool already exists: %s", subnet)
+	}
+	ipam.pools[subnet] = &IPPool{
+		Subnet:    subnet,
+		Gateway:   gateway,
+		Allocated: make(map[string]bool),
+	}
+	return nil
+}
+
+// RemovePool 删除子网地址池
+func (ipam *IPAddressManager) RemovePool(subnet string) {
+	ipam.mutex.Lock()
+	defer ipam.mutex.Unlock()
+
+	delete(ipam.pools, subnet)
+}
+
+// AllocateIP 从子网中分配下一个空闲地址，跳过网络地址、广播地址和网关
+func (ipam *IPAddressManager) AllocateIP(subnet string) (string, error) {
+	ipam.mutex.Lock()
+	defer ipam.mutex.Unlock()
+
+	pool, exists := ipam.pools[subnet]
+	if !exists {
+		return "", fmt.Errorf("address pool not found: %s", subnet)
+	}
+	_, network, err := net.ParseCIDR(pool.Subnet)
+	if err != nil {
+		return "", err
+	}
+
+	// 已释放的地址优先复用
+	for len(pool.Available) > 0 {
+		ip := pool.Available[0]
+		pool.Available = pool.Available[1:]
+		if !pool.Allocated[ip] {
+			pool.Allocated[ip] = true
+			return ip, nil
+		}
+	}
+
+	first, last := ipv4HostRange(network)
+	for candidate := first; candidate <= last && candidate >= first; candidate++ {
+		ip := uint32ToIPv4(candidate).String()
+		if ip == pool.Gateway || pool.Allocated[ip] {
+			continue
+		}
+		pool.Allocated[ip] = true
+		return ip, nil
+	}
+
+	return "", fmt.Errorf("address pool %s exhausted: all %d addresses allocated", subnet, len(pool.Allocated))
+}
+
+// ReleaseIP 归还地址，之后可被再次分配
+func (ipam *IPAddressManager) ReleaseIP(subnet, ip string) error {
+	ipam.mutex.Lock()
+	defer ipam.mutex.Unlock()
+
+	pool, exists := ipam.pools[subnet]
+	if !exists {
+		return fmt.Errorf("address pool not found: %s", subnet)
+	}
+	if !pool.Allocated[ip] {
+		return fmt.Errorf("address %s is not allocated in pool %s", ip, subnet)
+	}
+
+	delete(pool.Allocated, ip)
+	pool.Available = append(pool.Available, ip)
+	return nil
+}
+
+// ipv4HostRange 返回子网中可分配主机地址的范围；/31和/32没有网络地址和广播地址
+func ipv4HostRange(network *net.IPNet) (uint32, uint32) {
+	ones, bits := network.Mask.Size()
+	base := binary.BigEndian.Uint32(network.IP.To4())
+	size := uint32(1) << uint(bits-ones)
+	if size <= 2 {
+		return base, base + size - 1
+	}
+	return base + 1, base + size - 2
+}
+
+func uint32ToIPv4(value uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, value)
+	return ip
+}
+
 // ==================
 // Host网络驱动实现
 // ==================
@@ -2732,7 +10117,7 @@ func (hd *HostDriver) DeleteNetwork(networkID string) error {
 	return nil
 }
 
-func (hd *HostDriver) CreateEndpoint(networkID, containerID string) (*EndpointConfig, error) {
+func (hd *HostDriver) CreateEndpoint(networkID, containerID, ifName string) (*EndpointConfig, error) {
 	endpoint := &EndpointConfig{
 		NetworkID:   networkID,
 		ContainerID: containerID,
@@ -2761,22 +10146,209 @@ func (hd *HostDriver) Leave(networkID, containerID string) error {
 // Overlay网络驱动实现
 // ==================
 
-// OverlayDriver 覆盖网络驱动
+// OverlayDriver 基于VXLAN的覆盖网络驱动。每个网络在主机上对应一个网桥和一个挂在网桥上的
+// VXLAN接口，对端主机通过网络选项中的vxlan.peers静态写入FDB
 type OverlayDriver struct {
-	networks map[string]*ContainerNetwork
+	vethRegistry
+	networks map[string]*overlayNetwork
+	ipam     *IPAddressManager
+	runtime  RuntimeLookup // 查询容器PID，用于将veth对端移入容器网络命名空间
 	mutex    sync.RWMutex
 }
 
+// overlayNetwork 覆盖网络在主机上的数据通路
+type overlayNetwork struct {
+	bridge  string
+	vxlan   string
+	subnet  string
+	options overlayOptions
+}
+
+// 覆盖网络选项键
+const (
+	overlayOptionVNI    = "vxlan.id"
+	overlayOptionPort   = "vxlan.port"
+	overlayOptionLocal  = "vxlan.local"
+	overlayOptionDevice = "vxlan.device"
+	overlayOptionPeers  = "vxlan.peers"
+)
+
+const (
+	defaultVXLANPort    = 4789 // IANA分配的VXLAN端口
+	maxVXLANID          = 1<<24 - 1
+	overlayBridgePrefix = "ov-"
+	overlayVXLANPrefix  = "vx-"
+	overlayFloodMAC     = "00:00:00:00:00:00" // 全零MAC的FDB条目用于BUM流量的头端复制
+)
+
+// overlayPeer 对端VTEP，MAC为空时写入全零泛洪条目
+type overlayPeer struct {
+	MAC     string
+	Address string
+}
+
+// overlayOptions 解析后的覆盖网络选项
+type overlayOptions struct {
+	VNI    int
+	Port   int
+	Local  string
+	Device string
+	Peers  []overlayPeer
+}
+
+// runOverlayCommands 执行覆盖网络的ip/bridge命令，测试中可替换
+var runOverlayCommands = runNetworkCommands
+
+// parseOverlayOptions 解析网络选项。vxlan.id必填；vxlan.peers为逗号分隔的"IP"或"MAC@IP"列表
+func parseOverlayOptions(options map[string]string) (overlayOptions, error) {
+	opts := overlayOptions{Port: defaultVXLANPort}
+
+	rawVNI, ok := options[overlayOptionVNI]
+	if !ok {
+		return opts, fmt.Errorf("overlay network requires option %s", overlayOptionVNI)
+	}
+	vni, err := strconv.Atoi(strings.TrimSpace(rawVNI))
+	if err != nil || vni < 1 || vni > maxVXLANID {
+		return opts, fmt.Errorf("invalid %s %q: must be between 1 and %d", overlayOptionVNI, rawVNI, maxVXLANID)
+	}
+	opts.VNI = vni
+
+	if raw, ok := options[overlayOptionPort]; ok {
+		port, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || port < 1 || port > 65535 {
+			return opts, fmt.Errorf("invalid %s %q: must be between 1 and 65535", overlayOptionPort, raw)
+		}
+		opts.Port = port
+	}
+
+	if raw := strings.TrimSpace(options[overlayOptionLocal]); raw != "" {
+		if net.ParseIP(raw) == nil {
+			return opts, fmt.Errorf("invalid %s %q: not an IP address", overlayOptionLocal, raw)
+		}
+		opts.Local = raw
+	}
+
+	if raw := strings.TrimSpace(options[overlayOptionDevice]); raw != "" {
+		if err := validateInterfaceName(raw); err != nil {
+			return opts, fmt.Errorf("invalid %s: %v", overlayOptionDevice, err)
+		}
+		opts.Device = raw
+	}
+
+	for _, entry := range strings.Split(options[overlayOptionPeers], ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		peer := overlayPeer{Address: entry}
+		if at := strings.Index(entry, "@"); at >= 0 {
+			mac, err := net.ParseMAC(entry[:at])
+			if err != nil {
+				return opts, fmt.Errorf("invalid peer MAC in %q: %v", entry, err)
+			}
+			peer.MAC = mac.String()
+			peer.Address = entry[at+1:]
+		}
+		if net.ParseIP(peer.Address) == nil {
+			return opts, fmt.Errorf("invalid peer address in %q", entry)
+		}
+		opts.Peers = append(opts.Peers, peer)
+	}
+
+	return opts, nil
+}
+
+// overlayInterfaceNames 由网络ID哈希得出网桥和VXLAN接口名，保证不超过IFNAMSIZ限制
+func overlayInterfaceNames(networkID string) (bridge, vxlan string) {
+	hash := sha256.Sum256([]byte(networkID))
+	suffix := hex.EncodeToString(hash[:])
+	return overlayBridgePrefix + suffix[:maxInterfaceNameLength-len(overlayBridgePrefix)],
+		overlayVXLANPrefix + suffix[:maxInterfaceNameLength-len(overlayVXLANPrefix)]
+}
+
+// overlayDataPathCommands 构造创建网桥、VXLAN接口并将其挂到网桥上的命令
+func overlayDataPathCommands(bridge, vxlan string, opts overlayOptions) [][]string {
+	addVXLAN := []string{"ip", "link", "add", vxlan, "type", "vxlan",
+		"id", strconv.Itoa(opts.VNI), "dstport", strconv.Itoa(opts.Port)}
+	if opts.Local != "" {
+		addVXLAN = append(addVXLAN, "local", opts.Local)
+	}
+	if opts.Device != "" {
+		addVXLAN = append(addVXLAN, "dev", opts.Device)
+	}
+
+	return [][]string{
+		{"ip", "link", "add", bridge, "type", "bridge"},
+		addVXLAN,
+		{"ip", "link", "set", vxlan, "master", bridge},
+		{"ip", "link", "set", vxlan, "up"},
+		{"ip", "link", "set", bridge, "up"},
+	}
+}
+
+// overlayFDBCommands 构造对端VTEP的FDB条目命令
+func overlayFDBCommands(vxlan string, peers []overlayPeer) [][]string {
+	commands := make([][]string, 0, len(peers))
+	for _, peer := range peers {
+		mac := peer.MAC
+		if mac == "" {
+			mac = overlayFloodMAC
+		}
+		commands = append(commands, []string{"bridge", "fdb", "append", mac, "dev", vxlan, "dst", peer.Address})
+	}
+	return commands
+}
+
+// overlayEndpointCommands 构造创建veth对并将主机端挂到覆盖网络网桥上的命令
+func overlayEndpointCommands(bridge string, endpoint *bridgeEndpoint) [][]string {
+	return [][]string{
+		{"ip", "link", "add", endpoint.hostVeth, "type", "veth", "peer", "name", endpoint.peerVeth},
+		{"ip", "link", "set", endpoint.hostVeth, "master", bridge},
+		{"ip", "link", "set", endpoint.hostVeth, "up"},
+	}
+}
+
 func (od *OverlayDriver) Name() string {
 	return "overlay"
 }
 
 func (od *OverlayDriver) CreateNetwork(config *NetworkConfig) (*ContainerNetwork, error) {
-	if od.networks == nil {
-		od.networks = make(map[string]*ContainerNetwork)
+	opts, err := parseOverlayOptions(config.Options)
+	if err != nil {
+		return nil, err
+	}
+	if config.IPAM == nil || len(config.IPAM.Config) == 0 || config.IPAM.Config[0].Subnet == "" {
+		return nil, fmt.Errorf("overlay network %s requires an IPAM subnet", config.Name)
 	}
+	subnet := config.IPAM.Config[0].Subnet
 
 	networkID := generateNetworkID()
+	bridge, vxlan := overlayInterfaceNames(networkID)
+
+	if od.ipam != nil {
+		if err := od.ipam.AddPool(subnet, config.IPAM.Config[0].Gateway); err != nil {
+			return nil, err
+		}
+	}
+
+	commands := append(overlayDataPathCommands(bridge, vxlan, opts), overlayFDBCommands(vxlan, opts.Peers)...)
+	if err := runOverlayCommands(commands); err != nil {
+		// 部分创建的接口一并清理，删除网桥前先删除挂在其上的VXLAN接口
+		runOverlayCommands([][]string{{"ip", "link", "delete", vxlan}})
+		runOverlayCommands([][]string{{"ip", "link", "delete", bridge}})
+		if od.ipam != nil {
+			od.ipam.RemovePool(subnet)
+		}
+		return nil, fmt.Errorf("failed to create overlay network %s: %v", config.Name, err)
+	}
+
+	od.mutex.Lock()
+	if od.networks == nil {
+		od.networks = make(map[string]*overlayNetwork)
+	}
+	od.networks[networkID] = &overlayNetwork{bridge: bridge, vxlan: vxlan, subnet: subnet, options: opts}
+	od.mutex.Unlock()
+
 	network := &ContainerNetwork{
 		ID:         networkID,
 		Name:       config.Name,
@@ -2787,12 +10359,11 @@ func (od *OverlayDriver) CreateNetwork(config *NetworkConfig) (*ContainerNetwork
 		Labels:     make(map[string]string),
 		Created:    time.Now(),
 	}
+	for key, value := range config.Options {
+		network.Options[key] = value
+	}
 
-	od.mutex.Lock()
-	od.networks[networkID] = network
-	od.mutex.Unlock()
-
-	fmt.Printf("创建覆盖网络: %s\n", config.Name)
+	fmt.Printf("创建覆盖网络: %s (VNI: %d, 网桥: %s)\n", config.Name, opts.VNI, bridge)
 	return network, nil
 }
 
@@ -2800,32 +10371,135 @@ func (od *OverlayDriver) DeleteNetwork(networkID string) error {
 	od.mutex.Lock()
 	defer od.mutex.Unlock()
 
-	if _, exists := od.networks[networkID]; !exists {
+	network, exists := od.networks[networkID]
+	if !exists {
 		return fmt.Errorf("overlay network not found: %s", networkID)
 	}
 
+	if err := runOverlayCommands([][]string{
+		{"ip", "link", "delete", network.vxlan},
+		{"ip", "link", "delete", network.bridge},
+	}); err != nil {
+		return fmt.Errorf("failed to delete overlay network %s: %v", networkID, err)
+	}
+
 	delete(od.networks, networkID)
-	fmt.Printf("删除覆盖网络: %s\n", networkID)
+	if od.ipam != nil {
+		od.ipam.RemovePool(network.subnet)
+	}
+	fmt.Printf("删除覆盖网络: %s\n", network.bridge)
 	return nil
 }
 
-func (od *OverlayDriver) CreateEndpoint(networkID, containerID string) (*EndpointConfig, error) {
-	endpoint := &EndpointConfig{
+func (od *OverlayDriver) CreateEndpoint(networkID, containerID, ifName string) (*EndpointConfig, error) {
+	od.mutex.Lock()
+	network, exists := od.networks[networkID]
+	if !exists {
+		od.mutex.Unlock()
+		return nil, fmt.Errorf("overlay network not found: %s", networkID)
+	}
+	names, err := od.allocateLocked(networkID, containerID, ifName)
+	od.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var ipAddress string
+	if od.ipam != nil {
+		if ipAddress, err = od.ipam.AllocateIP(network.subnet); err != nil {
+			od.releaseEndpoint(networkID, containerID, network.subnet)
+			return nil, err
+		}
+		od.mutex.Lock()
+		names.ipAddress = ipAddress
+		od.mutex.Unlock()
+	}
+
+	if err := runOverlayCommands(overlayEndpointCommands(network.bridge, names)); err != nil {
+		runOverlayCommands([][]string{{"ip", "link", "delete", names.hostVeth}})
+		od.releaseEndpoint(networkID, containerID, network.subnet)
+		return nil, fmt.Errorf("failed to create overlay endpoint: %v", err)
+	}
+
+	fmt.Printf("创建覆盖网络端点: %s -> %s\n", containerID[:12], network.bridge)
+	return &EndpointConfig{
 		NetworkID:   networkID,
 		ContainerID: containerID,
-		Interface:   "eth0",
-	}
-	fmt.Printf("创建覆盖网络端点: %s\n", containerID[:12])
-	return endpoint, nil
+		Interface:   names.containerVeth,
+		IPAddress:   ipAddress,
+	}, nil
 }
 
 func (od *OverlayDriver) DeleteEndpoint(networkID, containerID string) error {
+	od.mutex.RLock()
+	network, exists := od.networks[networkID]
+	od.mutex.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("overlay network not found: %s", networkID)
+	}
+
+	names := od.releaseEndpoint(networkID, containerID, network.subnet)
+	if names == nil {
+		return fmt.Errorf("endpoint not found: container %s in network %s", containerID, networkID)
+	}
+	if err := runOverlayCommands([][]string{{"ip", "link", "delete", names.hostVeth}}); err != nil && hostInterfaceExists(names.hostVeth) {
+		return fmt.Errorf("failed to delete veth: %v", err)
+	}
+
 	fmt.Printf("删除覆盖网络端点: %s\n", containerID[:12])
 	return nil
 }
 
+// releaseEndpoint 释放端点占用的接口名和IP地址
+func (od *OverlayDriver) releaseEndpoint(networkID, containerID, subnet string) *bridgeEndpoint {
+	od.mutex.Lock()
+	names := od.releaseLocked(networkID, containerID)
+	od.mutex.Unlock()
+
+	if names != nil && names.ipAddress != "" && od.ipam != nil {
+		if err := od.ipam.ReleaseIP(subnet, names.ipAddress); err != nil {
+			log.Printf("Warning: failed to release IP address %s: %v", names.ipAddress, err)
+		}
+	}
+	return names
+}
+
+// Join 将veth对端移入容器网络命名空间并配置覆盖网络地址。覆盖网络为纯二层网络，不设置默认路由
 func (od *OverlayDriver) Join(networkID, containerID string) error {
-	fmt.Printf("加入覆盖网络: %s\n", containerID[:12])
+	od.mutex.RLock()
+	names, exists := od.endpoints[endpointKey(networkID, containerID)]
+	network := od.networks[networkID]
+	lookup := od.runtime
+	od.mutex.RUnlock()
+
+	if !exists || network == nil {
+		return fmt.Errorf("endpoint not found: container %s in network %s", containerID, networkID)
+	}
+	if lookup == nil {
+		return fmt.Errorf("overlay driver has no runtime lookup to resolve container %s", containerID)
+	}
+
+	pid, err := lookup.ContainerPid(containerID)
+	if err != nil {
+		return err
+	}
+
+	var address string
+	if names.ipAddress != "" {
+		_, subnet, err := net.ParseCIDR(network.subnet)
+		if err != nil {
+			return fmt.Errorf("invalid overlay subnet %s: %v", network.subnet, err)
+		}
+		ones, _ := subnet.Mask.Size()
+		address = fmt.Sprintf("%s/%d", names.ipAddress, ones)
+	}
+
+	if err := moveVethToNamespace(pid, names.hostVeth, names.peerVeth, names.containerVeth, address, ""); err != nil {
+		return fmt.Errorf("failed to join container %s to overlay network %s: %w", containerID, networkID, err)
+	}
+
+	fmt.Printf("加入覆盖网络: 容器 %s (VNI: %d, 接口: %s)\n", containerID[:12], network.options.VNI, names.containerVeth)
 	return nil
 }
 
@@ -2915,6 +10589,10 @@ func (ad *AufsDriver) GetLayerSize(id string) (int64, error) {
 	return calculateDirectorySize(layerDir)
 }
 
+func (ad *AufsDriver) DiffPath(id string) (string, error) {
+	return filepath.Join(ad.diffsDir, id), nil
+}
+
 func (ad *AufsDriver) RemoveLayer(id string) error {
 	layerDir := filepath.Join(ad.layersDir, id)
 	return os.RemoveAll(layerDir)
@@ -2955,6 +10633,11 @@ func (dmd *DeviceMapperDriver) Initialize(root string) error {
 }
 
 func (dmd *DeviceMapperDriver) CreateLayer(id string, parent string) (*Layer, error) {
+	// #nosec G301 -- 模拟thin设备的挂载目录，需要0755权限支持文件系统访问
+	if err := os.MkdirAll(filepath.Join(dmd.deviceRoot, "mnt", id), 0755); err != nil {
+		return nil, err
+	}
+
 	layer := &Layer{
 		ID:        id,
 		Parent:    parent,
@@ -2983,8 +10666,87 @@ func (dmd *DeviceMapperDriver) GetLayer(id string) (*Layer, error) {
 	}, nil
 }
 
+// GetLayerSize 返回层的实际占用大小。
+// 优先根据deviceRoot/metadata中的thin设备元数据查询设备已映射的块，
+// 设备状态不可用时退化为统计挂载目录中的文件大小
 func (dmd *DeviceMapperDriver) GetLayerSize(id string) (int64, error) {
-	return 0, nil
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return 0, fmt.Errorf("invalid layer id: %q", id)
+	}
+
+	metadata, err := dmd.loadDeviceMetadata(id)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read devicemapper metadata for layer %s: %v", id, err)
+	}
+	if metadata != nil {
+		if size, err := dmd.thinDeviceUsage(id); err == nil {
+			return size, nil
+		}
+	}
+
+	mountDir := filepath.Join(dmd.deviceRoot, "mnt", id)
+	if _, err := os.Stat(mountDir); err != nil {
+		if os.IsNotExist(err) {
+			if metadata != nil {
+				return 0, fmt.Errorf("devicemapper layer %s has no usable device stats or mount directory", id)
+			}
+			return 0, fmt.Errorf("layer not found: %s", id)
+		}
+		return 0, err
+	}
+	return calculateDirectorySize(mountDir)
+}
+
+// dmDeviceMetadata thin设备元数据，对应deviceRoot/metadata/<id>中的JSON
+type dmDeviceMetadata struct {
+	DeviceID      int    `json:"device_id"`
+	Size          uint64 `json:"size"`
+	TransactionID uint64 `json:"transaction_id"`
+	Initialized   bool   `json:"initialized"`
+}
+
+// loadDeviceMetadata 读取层对应的thin设备元数据，不存在时返回os.IsNotExist错误
+func (dmd *DeviceMapperDriver) loadDeviceMetadata(id string) (*dmDeviceMetadata, error) {
+	data, err := os.ReadFile(filepath.Join(dmd.deviceRoot, "metadata", id))
+	if err != nil {
+		return nil, err
+	}
+	var metadata dmDeviceMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+// thinDeviceUsage 通过dmsetup status查询thin设备已映射的字节数
+func (dmd *DeviceMapperDriver) thinDeviceUsage(id string) (int64, error) {
+	// #nosec G204 - 设备名由固定的池名和已校验的层ID组成，固定命令用于查询设备状态
+	output, err := exec.Command("dmsetup", "status", dmd.poolName+"-"+id).Output()
+	if err != nil {
+		return 0, err
+	}
+	return parseThinStatus(string(output))
+}
+
+// parseThinStatus 解析thin目标的状态行：
+// "<start> <length> thin <mapped sectors> <highest mapped sector>"
+func parseThinStatus(status string) (int64, error) {
+	fields := strings.Fields(status)
+	if len(fields) < 4 || fields[2] != "thin" {
+		return 0, fmt.Errorf("unexpected thin device status: %q", strings.TrimSpace(status))
+	}
+	if fields[3] == "Fail" {
+		return 0, fmt.Errorf("thin device has failed")
+	}
+	mappedSectors, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mapped sector count %q: %v", fields[3], err)
+	}
+	return mappedSectors * 512, nil
+}
+
+func (dmd *DeviceMapperDriver) DiffPath(id string) (string, error) {
+	return filepath.Join(dmd.deviceRoot, "mnt", id), nil
 }
 
 func (dmd *DeviceMapperDriver) RemoveLayer(id string) error {
@@ -3024,6 +10786,14 @@ func generateDeploymentID() string {
 	return fmt.Sprintf("deployment_%d_%d", time.Now().UnixNano(), secureRandomInt63())
 }
 
+func generateImageID() string {
+	return fmt.Sprintf("image_%d_%d", time.Now().UnixNano(), secureRandomInt63())
+}
+
+func generateLayerID() string {
+	return fmt.Sprintf("layer_%s", generateShortID())
+}
+
 func generateShortID() string {
 	bytes := make([]byte, 16)
 	if _, err := rand.Read(bytes); err != nil {
@@ -3077,17 +10847,21 @@ func demonstrateVirtualizationContainers() {
 		fmt.Printf("启动运行时失败: %v\n", err)
 		return
 	}
+	defer func() {
+		if err := runtime.Stop(); err != nil {
+			log.Printf("Warning: failed to stop runtime: %v", err)
+		}
+	}()
 
 	// 2. 镜像管理演示
 	fmt.Println("\n2. 容器镜像管理")
 
 	// 创建示例镜像
 	image := &ContainerImage{
-		ID:       "image_123456",
-		RepoTags: []string{"demo:latest"},
-		Created:  time.Now(),
-		Size:     100 * 1024 * 1024, // 100MB
-		Layers:   []string{"layer_001", "layer_002", "layer_003"},
+		ID:      "image_123456",
+		Created: time.Now(),
+		Size:    100 * 1024 * 1024, // 100MB
+		Layers:  []string{"layer_001", "layer_002", "layer_003"},
 		Config: &ImageConfig{
 			Cmd:        []string{"/bin/sh"},
 			Env:        []string{"PATH=/usr/bin:/bin"},
@@ -3095,7 +10869,8 @@ func demonstrateVirtualizationContainers() {
 		},
 	}
 
-	runtime.images[image.ID] = image
+	// 通过registerImage登记，使镜像持有其各层的引用
+	runtime.registerImage(image, "demo:latest")
 	fmt.Printf("加载镜像: %s (大小: %d MB)\n", image.RepoTags[0], image.Size/1024/1024)
 
 	// 3. 容器生命周期演示
@@ -3122,7 +10897,8 @@ func demonstrateVirtualizationContainers() {
 		return
 	}
 
-	fmt.Printf("容器状态: %s (PID: %d)\n", container.State.Status, container.State.Pid)
+	state := container.Snapshot()
+	fmt.Printf("容器状态: %s (PID: %d)\n", state.Status, state.Pid)
 
 	// 4. 网络管理演示
 	fmt.Println("\n4. 容器网络管理")
@@ -3187,8 +10963,11 @@ func demonstrateVirtualizationContainers() {
 	if err := runtime.seccomp.LoadProfile("demo-profile", seccompProfile); err != nil {
 		log.Printf("Warning: failed to load seccomp profile: %v", err)
 	}
-	if err := runtime.seccomp.ApplyProfile(container.ID, "demo-profile"); err != nil {
-		log.Printf("Warning: failed to apply seccomp profile: %v", err)
+	// ApplyProfile在启动容器进程时才安装过滤器，演示中只编译并展示BPF程序
+	if program, err := Compile(seccompProfile); err != nil {
+		log.Printf("Warning: failed to compile seccomp profile: %v", err)
+	} else {
+		fmt.Printf("Seccomp BPF程序: %d 条指令\n", len(program))
 	}
 
 	// AppArmor配置
@@ -3232,6 +11011,18 @@ func demonstrateVirtualizationContainers() {
 	orchestrator.nodes[node.ID] = node
 	fmt.Printf("添加节点: %s (CPU: %s, 内存: %s)\n", node.Name, node.Capacity["cpu"], node.Capacity["memory"])
 
+	// 创建配置和密钥
+	if err := orchestrator.CreateConfigMap(&ConfigMap{
+		Name:      "nginx-config",
+		Namespace: "default",
+		Data:      map[string]string{"WORKER_PROCESSES": "2"},
+	}); err != nil {
+		fmt.Printf("创建ConfigMap失败: %v\n", err)
+	}
+	if err := orchestrator.CreateSecret(NewSecret("default", "tls", map[string][]byte{"tls.key": []byte("demo-key")})); err != nil {
+		fmt.Printf("创建Secret失败: %v\n", err)
+	}
+
 	// 创建Pod
 	podSpec := &PodSpec{
 		Name:      "demo-pod",
@@ -3239,9 +11030,11 @@ func demonstrateVirtualizationContainers() {
 		Labels:    map[string]string{"app": "demo"},
 		Containers: []ContainerSpec{
 			{
-				Name:    "web-server",
-				Image:   "nginx:latest",
-				Command: []string{"nginx", "-g", "daemon off;"},
+				Name:         "web-server",
+				Image:        "nginx:latest",
+				Command:      []string{"nginx", "-g", "daemon off;"},
+				EnvFrom:      []EnvFromSource{{ConfigMapRef: "nginx-config"}},
+				VolumeMounts: []VolumeMount{{Name: "tls", MountPath: "/etc/nginx/tls", Secret: "tls"}},
 			},
 		},
 	}
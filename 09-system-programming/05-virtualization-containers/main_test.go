@@ -0,0 +1,6006 @@
+/*
+=== 虚拟化与容器模块测试 ===
+
+测试容器运行时的关键路径：
+1. 容器生命周期与锁顺序
+2. 容器状态的并发访问
+3. 默认网络子网选择
+4. 容器用户解析
+5. 镜像导入导出与层压缩
+6. ConfigMap与Secret注入
+7. 镜像构建
+8. 事件审计日志
+9. cgroup v2委派与嵌套
+10. veth接口命名
+11. 上下文取消与镜像拉取
+12. 容器暂停与恢复
+13. 停止信号与宽限期
+14. 容器内执行命令
+15. IP地址分配
+16. 容器健康检查
+17. 容器日志
+18. 桥接网络加入容器命名空间
+19. tmpfs挂载
+20. 只读根文件系统
+21. Deployment滚动更新
+22. Deployment缩容
+23. 调度抢占
+24. 装箱调度算法
+25. 最少分配评分
+26. 节点亲和性与反亲和性
+27. Seccomp BPF编译
+28. DeviceMapper层大小
+29. 层内容去重
+30. 容器文件复制
+31. 容器详情
+32. 自动删除与已退出容器回收
+33. 重启策略
+34. OOM检测
+35. cgroup版本检测与接口文件
+36. 块设备IO限制
+37. 进程数限制
+38. VXLAN覆盖网络
+39. 事件总线投递
+40. 服务ClusterIP与端点
+41. NodePort服务暴露
+42. 集群指标采样
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/net/bpf"
+)
+
+// newTestRuntime 创建一个使用临时目录、不依赖宿主机网络和cgroup的运行时
+func newTestRuntime(t *testing.T) *ContainerRuntime {
+	t.Helper()
+	cr := NewContainerRuntime(RuntimeConfig{
+		RootDirectory:  t.TempDir(),
+		StateDirectory: t.TempDir(),
+		StorageDriver:  "overlay2",
+	})
+	t.Cleanup(func() { cr.Stop() })
+	return cr
+}
+
+// addTestContainer 直接注册一个处于created状态的容器，绕过命名空间和cgroup创建
+func addTestContainer(t *testing.T, cr *ContainerRuntime, cmd ...string) *Container {
+	t.Helper()
+	container := &Container{
+		ID:         generateContainerID(),
+		Name:       generateContainerName(),
+		Config:     &ContainerConfig{Cmd: cmd},
+		State:      &ContainerState{Status: StatusCreated},
+		Namespaces: make(map[string]*Namespace),
+		Cgroups:    make(map[string]*Cgroup),
+		CreatedAt:  time.Now(),
+	}
+
+	cr.mutex.Lock()
+	cr.containers[container.ID] = container
+	cr.mutex.Unlock()
+
+	return container
+}
+
+// ==================
+// 1. 容器生命周期与锁顺序
+// ==================
+
+func TestRemoveContainerForceDoesNotDeadlock(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "sleep 30")
+
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cr.RemoveContainer(container.ID, true)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("强制删除容器失败: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("RemoveContainer(force=true) 发生死锁")
+	}
+
+	cr.mutex.RLock()
+	_, exists := cr.containers[container.ID]
+	cr.mutex.RUnlock()
+	if exists {
+		t.Error("容器删除后仍存在于运行时中")
+	}
+}
+
+func TestRemoveRunningContainerWithoutForce(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "sleep 30")
+
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+	defer func() {
+		if err := cr.RemoveContainer(container.ID, true); err != nil {
+			t.Errorf("清理容器失败: %v", err)
+		}
+	}()
+
+	if err := cr.RemoveContainer(container.ID, false); err == nil {
+		t.Error("期望非强制删除运行中的容器返回错误")
+	}
+}
+
+// ==================
+// 2. 容器状态的并发访问
+// ==================
+
+func TestContainerStateConcurrentAccess(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "sleep 30")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					_ = container.Status()
+					_ = container.IsRunning()
+					_ = container.Snapshot()
+					_ = cr.ListContainers()
+				}
+			}
+		}()
+	}
+
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+	if !container.IsRunning() {
+		t.Error("期望容器处于运行状态")
+	}
+	if err := cr.StopContainer(container.ID, 5*time.Second); err != nil {
+		t.Fatalf("停止容器失败: %v", err)
+	}
+
+	close(stop)
+	wg.Wait()
+
+	if status := container.Status(); status != StatusExited {
+		t.Errorf("期望容器状态为exited，实际为%s", status)
+	}
+}
+
+func TestSnapshotReturnsCopy(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "true")
+	container.State.Health = &Health{Status: "healthy", Log: []HealthcheckResult{{ExitCode: 0}}}
+
+	inspect, err := cr.InspectContainer(container.ID)
+	if err != nil {
+		t.Fatalf("检查容器失败: %v", err)
+	}
+	snapshot := inspect.State
+	snapshot.Status = StatusDead
+	snapshot.Health.Status = "unhealthy"
+	snapshot.Health.Log[0].ExitCode = 1
+
+	state := container.Snapshot()
+	if state.Status != StatusCreated {
+		t.Errorf("修改快照不应影响容器状态，实际为%s", state.Status)
+	}
+	if state.Health.Status != "healthy" || state.Health.Log[0].ExitCode != 0 {
+		t.Error("修改快照的健康信息不应影响容器")
+	}
+}
+
+// ==================
+// 3. 默认网络子网选择
+// ==================
+
+func mustParseCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+	result := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("解析CIDR失败: %v", err)
+		}
+		result = append(result, subnet)
+	}
+	return result
+}
+
+func TestSelectDefaultSubnetAvoidsOverlap(t *testing.T) {
+	tests := []struct {
+		name      string
+		preferred string
+		used      []string
+		want      string
+		wantErr   bool
+	}{
+		{name: "无冲突使用默认子网", want: "172.17.0.0/16"},
+		{name: "默认子网冲突时顺序选择", used: []string{"172.16.0.0/16", "172.17.5.0/24", "172.18.0.0/15"}, want: "172.20.0.0/16"},
+		{name: "宽路由覆盖整个地址池", used: []string{"172.16.0.0/12"}, wantErr: true},
+		{name: "显式子网无冲突", preferred: "10.10.0.0/16", used: []string{"172.17.0.0/16"}, want: "10.10.0.0/16"},
+		{name: "显式子网冲突", preferred: "10.10.0.0/16", used: []string{"10.0.0.0/8"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subnet, err := selectDefaultSubnet(tt.preferred, mustParseCIDRs(t, tt.used...))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("期望返回错误，实际选择了%s", subnet)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("选择子网失败: %v", err)
+			}
+			if subnet.String() != tt.want {
+				t.Errorf("期望子网%s，实际为%s", tt.want, subnet)
+			}
+		})
+	}
+}
+
+func TestReadHostRoutesSkipsDefaultRoute(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "route")
+	table := "Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\tMTU\tWindow\tIRTT\n" +
+		"eth0\t00000000\t0101A8C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n" +
+		"docker0\t000011AC\t00000000\t0001\t0\t0\t0\t0000FFFF\t0\t0\t0\n"
+	if err := os.WriteFile(path, []byte(table), 0600); err != nil {
+		t.Fatalf("写入路由表失败: %v", err)
+	}
+
+	routes, err := readHostRoutes(path)
+	if err != nil {
+		t.Fatalf("读取路由表失败: %v", err)
+	}
+	if len(routes) != 1 || routes[0].String() != "172.17.0.0/16" {
+		t.Fatalf("期望只解析出172.17.0.0/16，实际为%v", routes)
+	}
+}
+
+// fakeBridgeDriver 以bridge名称注册的无副作用驱动，避免测试调用ip命令
+type fakeBridgeDriver struct {
+	HostDriver
+}
+
+func (fd *fakeBridgeDriver) Name() string {
+	return "bridge"
+}
+
+func TestNetworkManagerInitializeIdempotent(t *testing.T) {
+	original := hostRouteTable
+	hostRouteTable = filepath.Join(t.TempDir(), "missing-route")
+	defer func() { hostRouteTable = original }()
+
+	nm := NewNetworkManager()
+	nm.RegisterDriver(&fakeBridgeDriver{})
+
+	for i := 0; i < 2; i++ {
+		if err := nm.Initialize(NetworkConfig{}); err != nil {
+			t.Fatalf("第%d次初始化失败: %v", i+1, err)
+		}
+	}
+
+	if len(nm.networks) != 1 {
+		t.Errorf("期望只有一个默认网络，实际为%d", len(nm.networks))
+	}
+}
+
+// ipamBridgeDriver 像真实的桥接驱动一样在网络上记录IPAM配置，但不调用ip命令
+type ipamBridgeDriver struct {
+	fakeBridgeDriver
+}
+
+func (fd *ipamBridgeDriver) CreateNetwork(config *NetworkConfig) (*ContainerNetwork, error) {
+	network, err := fd.fakeBridgeDriver.CreateNetwork(config)
+	if err == nil {
+		network.IPAM = config.IPAM
+	}
+	return network, err
+}
+
+func TestNetworkManagerInitializeConcurrentSubnets(t *testing.T) {
+	original := hostRouteTable
+	hostRouteTable = filepath.Join(t.TempDir(), "missing-route")
+	defer func() { hostRouteTable = original }()
+
+	nm := NewNetworkManager()
+	nm.RegisterDriver(&ipamBridgeDriver{})
+
+	const callers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- nm.Initialize(NetworkConfig{Name: fmt.Sprintf("net%d", i)})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("初始化失败: %v", err)
+		}
+	}
+
+	subnets := make(map[string]bool)
+	for _, network := range nm.networks {
+		subnet := network.IPAM.Config[0].Subnet
+		if subnets[subnet] {
+			t.Errorf("并发初始化的网络选中了同一个子网%s", subnet)
+		}
+		subnets[subnet] = true
+	}
+	if len(subnets) != callers {
+		t.Errorf("期望%d个不同的子网，实际为%v", callers, subnets)
+	}
+}
+
+func TestNetworkManagerInitializeKeepsUserGateway(t *testing.T) {
+	original := hostRouteTable
+	hostRouteTable = filepath.Join(t.TempDir(), "missing-route")
+	defer func() { hostRouteTable = original }()
+
+	tests := []struct {
+		name    string
+		ipam    IPAMConfig
+		want    string
+		wantErr bool
+	}{
+		{name: "指定子网和网关", ipam: IPAMConfig{Subnet: "10.20.0.0/16", Gateway: "10.20.0.254"}, want: "10.20.0.254"},
+		{name: "子网写成主机地址", ipam: IPAMConfig{Subnet: "10.20.0.1/16", Gateway: "10.20.0.254"}, want: "10.20.0.254"},
+		{name: "只指定网关", ipam: IPAMConfig{Gateway: "172.17.0.254"}, want: "172.17.0.254"},
+		{name: "未指定网关", ipam: IPAMConfig{Subnet: "10.20.0.0/16"}, want: "10.20.0.1"},
+		{name: "网关不在子网内", ipam: IPAMConfig{Subnet: "10.20.0.0/16", Gateway: "10.30.0.1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nm := NewNetworkManager()
+			nm.RegisterDriver(&ipamBridgeDriver{})
+			err := nm.Initialize(NetworkConfig{IPAM: &NetworkIPAM{Config: []IPAMConfig{tt.ipam}}})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("网关不在子网内时应返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("初始化失败: %v", err)
+			}
+			for _, network := range nm.networks {
+				if gateway := network.IPAM.Config[0].Gateway; gateway != tt.want {
+					t.Errorf("期望网关%s，实际为%s", tt.want, gateway)
+				}
+			}
+		})
+	}
+}
+
+// ==================
+// 4. 容器用户解析
+// ==================
+
+// writeRootfsFixture 在临时rootfs中写入passwd和group文件
+func writeRootfsFixture(t *testing.T) string {
+	t.Helper()
+	rootfs := t.TempDir()
+	etc := filepath.Join(rootfs, "etc")
+	if err := os.MkdirAll(etc, 0755); err != nil {
+		t.Fatalf("创建etc目录失败: %v", err)
+	}
+
+	passwd := "root:x:0:0:root:/root:/bin/sh\n" +
+		"# 注释行\n" +
+		"nginx:x:101:101:nginx user:/var/cache/nginx:/sbin/nologin\n" +
+		"app:x:1000:1000::/home/app:/bin/sh\n"
+	group := "root:x:0:\n" +
+		"nginx:x:101:\n" +
+		"app:x:1000:\n" +
+		"www-data:x:33:nginx,app\n"
+
+	if err := os.WriteFile(filepath.Join(etc, "passwd"), []byte(passwd), 0644); err != nil {
+		t.Fatalf("写入passwd失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(etc, "group"), []byte(group), 0644); err != nil {
+		t.Fatalf("写入group失败: %v", err)
+	}
+	return rootfs
+}
+
+func TestResolveContainerUser(t *testing.T) {
+	rootfs := writeRootfsFixture(t)
+
+	tests := []struct {
+		name   string
+		spec   string
+		uid    uint32
+		gid    uint32
+		groups []uint32
+	}{
+		{name: "用户名", spec: "nginx", uid: 101, gid: 101, groups: []uint32{33}},
+		{name: "用户名和组名", spec: "app:www-data", uid: 1000, gid: 33},
+		{name: "数字uid和gid", spec: "2000:3000", uid: 2000, gid: 3000},
+		{name: "已知的数字uid", spec: "1000", uid: 1000, gid: 1000, groups: []uint32{33}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := resolveContainerUser(rootfs, tt.spec, nil)
+			if err != nil {
+				t.Fatalf("解析用户失败: %v", err)
+			}
+			if user.Uid != tt.uid || user.Gid != tt.gid {
+				t.Errorf("期望%d:%d，实际为%d:%d", tt.uid, tt.gid, user.Uid, user.Gid)
+			}
+			if len(user.AdditionalGids) != len(tt.groups) {
+				t.Fatalf("期望附加组%v，实际为%v", tt.groups, user.AdditionalGids)
+			}
+			for i, gid := range tt.groups {
+				if user.AdditionalGids[i] != gid {
+					t.Errorf("期望附加组%v，实际为%v", tt.groups, user.AdditionalGids)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveContainerUserErrors(t *testing.T) {
+	rootfs := writeRootfsFixture(t)
+
+	if _, err := resolveContainerUser(rootfs, "missing", nil); err == nil {
+		t.Error("期望不存在的用户返回错误")
+	}
+	if _, err := resolveContainerUser(rootfs, "app:missing", nil); err == nil {
+		t.Error("期望不存在的组返回错误")
+	}
+
+	nonRoot := true
+	if _, err := resolveContainerUser(rootfs, "root", &SecurityContext{RunAsNonRoot: &nonRoot}); err == nil {
+		t.Error("期望RunAsNonRoot拒绝uid 0")
+	}
+
+	user, err := resolveContainerUser(rootfs, "", nil)
+	if err != nil || user != nil {
+		t.Errorf("未指定用户时应返回nil，实际为%v %v", user, err)
+	}
+}
+
+func TestResolveContainerUserSecurityContextOverrides(t *testing.T) {
+	rootfs := writeRootfsFixture(t)
+	runAsUser, runAsGroup := int64(4242), int64(4343)
+
+	user, err := resolveContainerUser(rootfs, "nginx", &SecurityContext{
+		RunAsUser:          &runAsUser,
+		RunAsGroup:         &runAsGroup,
+		SupplementalGroups: []int64{33, 500},
+	})
+	if err != nil {
+		t.Fatalf("解析用户失败: %v", err)
+	}
+	if user.Uid != 4242 || user.Gid != 4343 {
+		t.Errorf("期望SecurityContext覆盖为4242:4343，实际为%d:%d", user.Uid, user.Gid)
+	}
+	if len(user.AdditionalGids) != 2 || user.AdditionalGids[1] != 500 {
+		t.Errorf("期望附加组[33 500]，实际为%v", user.AdditionalGids)
+	}
+}
+
+func TestGroupOnlyUserKeepsImageDefaultUser(t *testing.T) {
+	image := &ContainerImage{Config: &ImageConfig{User: "app:app"}}
+	tests := []struct {
+		user string
+		want string
+	}{
+		{":www-data", "app:www-data"},
+		{"", "app:app"},
+		{"nginx", "nginx"},
+	}
+	for _, tt := range tests {
+		if got := applyImageDefaults(&ContainerConfig{User: tt.user}, image).User; got != tt.want {
+			t.Errorf("User %q期望解析为%q，实际为%q", tt.user, tt.want, got)
+		}
+	}
+
+	user, err := resolveContainerUser(writeRootfsFixture(t), applyImageDefaults(&ContainerConfig{User: ":www-data"}, image).User, nil)
+	if err != nil {
+		t.Fatalf("解析用户失败: %v", err)
+	}
+	if user.Uid != 1000 || user.Gid != 33 {
+		t.Errorf("只指定组时应沿用镜像用户的uid，期望1000:33，实际为%d:%d", user.Uid, user.Gid)
+	}
+}
+
+func TestResolveContainerUserDoesNotFollowSymlinksToHost(t *testing.T) {
+	host := t.TempDir()
+	if err := os.WriteFile(filepath.Join(host, "passwd"), []byte("hostuser:x:4000:4000::/:/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(host, "group"), []byte("hostgroup:x:4001:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// 绝对链接和越过根目录的相对链接都应在容器根下解析
+	if err := os.Symlink(filepath.Join(host, "passwd"), filepath.Join(rootfs, "etc", "passwd")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../../../../../.."+filepath.Join(host, "group"), filepath.Join(rootfs, "etc", "group")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := resolveContainerUser(rootfs, "hostuser", nil); err == nil {
+		t.Error("不应经由符号链接读取宿主机的passwd")
+	}
+	if _, err := resolveContainerUser(rootfs, "0:hostgroup", nil); err == nil {
+		t.Error("不应经由符号链接读取宿主机的group")
+	}
+}
+
+// ==================
+// 5. 镜像导入导出与层压缩
+// ==================
+
+// newImageTestRuntime 创建已初始化存储驱动、并登记了一个单层镜像的运行时
+func newImageTestRuntime(t *testing.T) *ContainerRuntime {
+	t.Helper()
+	cr := newTestRuntime(t)
+	if err := cr.storage.Initialize("overlay2"); err != nil {
+		t.Fatalf("初始化存储驱动失败: %v", err)
+	}
+	return cr
+}
+
+func TestSaveLoadImageRoundTrip(t *testing.T) {
+	source := newImageTestRuntime(t)
+	if _, err := source.storage.activeDriver.CreateLayer("layer_a", ""); err != nil {
+		t.Fatalf("创建层失败: %v", err)
+	}
+	diffPath, err := source.storage.activeDriver.DiffPath("layer_a")
+	if err != nil {
+		t.Fatalf("获取层目录失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(diffPath, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(diffPath, "etc", "hostname"), []byte("demo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source.registerImage(&ContainerImage{ID: "demo", Layers: []string{"layer_a"}}, "demo:latest")
+
+	tests := []struct {
+		name        string
+		compression LayerCompression
+	}{
+		{"gzip", CompressionGzip},
+		{"zstd", CompressionZstd},
+		{"none", CompressionNone},
+	}
+
+	var digest string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var archive bytes.Buffer
+			if err := source.SaveImage("demo", &archive, SaveOptions{Compression: tt.compression}); err != nil {
+				t.Fatalf("导出镜像失败: %v", err)
+			}
+
+			target := newImageTestRuntime(t)
+			image, err := target.LoadImage(&archive)
+			if err != nil {
+				t.Fatalf("导入镜像失败: %v", err)
+			}
+			if len(image.Layers) != 1 || !archiveLayerIDPattern.MatchString(image.Layers[0]) {
+				t.Fatalf("导入的层应以内容摘要命名: %v", image.Layers)
+			}
+			layerID := image.Layers[0]
+
+			loadedPath, _ := target.storage.activeDriver.DiffPath(layerID)
+			data, err := os.ReadFile(filepath.Join(loadedPath, "etc", "hostname"))
+			if err != nil || string(data) != "demo\n" {
+				t.Fatalf("层内容不一致: %q %v", data, err)
+			}
+
+			layer := target.storage.layers[layerID]
+			if "sha256:"+layerID != layer.Digest {
+				t.Errorf("层ID应为内容摘要: %s, %s", layerID, layer.Digest)
+			}
+			if layer.Compression != tt.compression {
+				t.Errorf("期望压缩算法为%s，实际为%s", tt.compression, layer.Compression)
+			}
+			// 摘要基于未压缩内容，与压缩算法无关
+			if digest == "" {
+				digest = layer.Digest
+			} else if layer.Digest != digest {
+				t.Errorf("不同压缩算法的层摘要应一致: %s != %s", layer.Digest, digest)
+			}
+		})
+	}
+}
+
+func TestLoadImageRejectsDigestMismatch(t *testing.T) {
+	source := newImageTestRuntime(t)
+	if _, err := source.storage.activeDriver.CreateLayer("layer_a", ""); err != nil {
+		t.Fatalf("创建层失败: %v", err)
+	}
+	source.registerImage(&ContainerImage{ID: "demo", Layers: []string{"layer_a"}}, "")
+
+	var archive bytes.Buffer
+	if err := source.SaveImage("demo", &archive, SaveOptions{Compression: CompressionZstd}); err != nil {
+		t.Fatalf("导出镜像失败: %v", err)
+	}
+	// 等长篡改manifest中的摘要，保持外层tar结构有效
+	tampered := archive.Bytes()
+	marker := []byte(`"digest": "sha256:`)
+	pos := bytes.Index(tampered, marker) + len(marker)
+	if tampered[pos] == '0' {
+		tampered[pos] = '1'
+	} else {
+		tampered[pos] = '0'
+	}
+
+	_, err := newImageTestRuntime(t).LoadImage(bytes.NewReader(tampered))
+	if err == nil {
+		t.Fatal("摘要不匹配时应拒绝导入")
+	} else if !strings.Contains(err.Error(), "digest mismatch") {
+		t.Fatalf("期望摘要不匹配错误，实际为%v", err)
+	}
+}
+
+func TestLoadImageRemovesCreatedLayersOnFailure(t *testing.T) {
+	source := newImageTestRuntime(t)
+	base, err := source.createImageWithLayer(nil, &ImageConfig{}, populateBaseLayer)
+	if err != nil {
+		t.Fatalf("创建基础层失败: %v", err)
+	}
+	image, err := source.createImageWithLayer(base, &ImageConfig{}, func(diffPath string) error {
+		return os.WriteFile(filepath.Join(diffPath, "app"), []byte("app"), 0644)
+	})
+	if err != nil {
+		t.Fatalf("创建应用层失败: %v", err)
+	}
+	source.registerImage(image, "app:latest")
+
+	var archive bytes.Buffer
+	if err := source.SaveImage(image.ID, &archive, SaveOptions{Compression: CompressionNone}); err != nil {
+		t.Fatalf("导出镜像失败: %v", err)
+	}
+	// 篡改第二层的摘要，第一层已经创建后才会发现
+	tampered := archive.Bytes()
+	marker := []byte(`"digest": "sha256:`)
+	first := bytes.Index(tampered, marker) + len(marker)
+	pos := first + bytes.Index(tampered[first:], marker) + len(marker)
+	if tampered[pos] == '0' {
+		tampered[pos] = '1'
+	} else {
+		tampered[pos] = '0'
+	}
+
+	target := newImageTestRuntime(t)
+	if _, err := target.LoadImage(bytes.NewReader(tampered)); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Fatalf("期望摘要不匹配错误，实际为%v", err)
+	}
+	if n := countOverlayLayers(t, target); n != 0 {
+		t.Errorf("导入失败后不应留下层目录，实际有%d个", n)
+	}
+	if len(target.storage.layers) != 0 {
+		t.Errorf("导入失败后不应留下已登记的层: %v", target.storage.layers)
+	}
+}
+
+func TestLoadImageRejectsInvalidArchives(t *testing.T) {
+	layerManifest := func(id string) []byte {
+		data, _ := json.Marshal(imageArchiveManifest{
+			ID:     "evil",
+			Layers: []imageArchiveLayer{{ID: id, Digest: "sha256:" + strings.Repeat("0", 64), File: "layers/x"}},
+		})
+		return data
+	}
+	tests := []struct {
+		name     string
+		manifest []byte
+		wantErr  string
+	}{
+		{"层ID路径穿越", layerManifest("../../../escape"), "invalid layer id"},
+		{"层ID不是摘要", layerManifest("layer_a"), "invalid layer id"},
+		{"清单超过大小上限", bytes.Repeat([]byte(" "), maxMetadataSize+1), "exceeds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var archive bytes.Buffer
+			tw := tar.NewWriter(&archive)
+			if err := writeTarFile(tw, "layers/x", []byte("x")); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeTarFile(tw, imageManifestFile, tt.manifest); err != nil {
+				t.Fatal(err)
+			}
+			tw.Close()
+
+			target := newImageTestRuntime(t)
+			_, err := target.LoadImage(&archive)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("期望包含%q的错误，实际为%v", tt.wantErr, err)
+			}
+			if n := countOverlayLayers(t, target); n != 0 {
+				t.Errorf("被拒绝的归档不应创建层目录，实际有%d个", n)
+			}
+			if _, err := os.Stat(filepath.Join(target.storage.graphRoot, "escape")); !os.IsNotExist(err) {
+				t.Error("层ID不应逃逸出层存储目录")
+			}
+		})
+	}
+}
+
+func TestUnpackLayerTarConfinesSymlinks(t *testing.T) {
+	host := t.TempDir()
+	passwd := filepath.Join(host, "passwd")
+	if err := os.WriteFile(passwd, []byte("root:x:0:0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	entries := []*tar.Header{
+		{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: host},
+		{Name: "etc/passwd", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		{Name: "shadow", Typeflag: tar.TypeSymlink, Linkname: passwd},
+		{Name: "shadow", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+	}
+	for _, header := range entries {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			tw.Write([]byte("evil"))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	target := t.TempDir()
+	if err := unpackLayerTar(&buf, target); err != nil {
+		t.Fatalf("解包失败: %v", err)
+	}
+	if data, _ := os.ReadFile(passwd); string(data) != "root:x:0:0\n" {
+		t.Fatalf("层内符号链接不应导致写入宿主机文件，实际内容为%q", data)
+	}
+	// 绝对链接按层根解析，etc/passwd落在层内对应的路径下
+	if data, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(host), "passwd")); err != nil || string(data) != "evil" {
+		t.Errorf("经由符号链接的条目应写入层内: %q %v", data, err)
+	}
+	if info, err := os.Lstat(filepath.Join(target, "shadow")); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("覆盖符号链接的普通文件应替换链接本身: %v %v", info, err)
+	}
+
+	var escape bytes.Buffer
+	tw = tar.NewWriter(&escape)
+	tw.WriteHeader(&tar.Header{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0644})
+	tw.Close()
+	if err := unpackLayerTar(&escape, t.TempDir()); err == nil || !strings.Contains(err.Error(), "illegal path") {
+		t.Errorf("越出层根的条目应被拒绝，实际为%v", err)
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	for _, compression := range []LayerCompression{CompressionNone, CompressionGzip, CompressionZstd} {
+		var buf bytes.Buffer
+		w, err := compressWriter(&buf, compression)
+		if err != nil {
+			t.Fatalf("创建%s压缩器失败: %v", compression, err)
+		}
+		w.Write([]byte("layer data"))
+		w.Close()
+
+		if got := detectCompression(buf.Bytes()); got != compression {
+			t.Errorf("期望识别为%s，实际为%s", compression, got)
+		}
+	}
+}
+
+// ==================
+// 6. ConfigMap与Secret注入
+// ==================
+
+// newConfigTestPod 构造一个绕过调度、只包含单个容器的Pod
+func newConfigTestPod(t *testing.T, co *ContainerOrchestrator, spec ContainerSpec) *Pod {
+	t.Helper()
+	container := addTestContainer(t, co.runtime, "/bin/true")
+	container.Config.Env = spec.Env
+	return &Pod{
+		ID:         generatePodID(),
+		Name:       "web",
+		Namespace:  "default",
+		Containers: []*Container{container},
+		Spec:       &PodSpec{Name: "web", Namespace: "default", Containers: []ContainerSpec{spec}},
+	}
+}
+
+func TestPodConsumesConfigMapAsEnv(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	if err := co.CreateConfigMap(&ConfigMap{
+		Name: "app-config",
+		Data: map[string]string{"LOG_LEVEL": "debug", "MODE": "cluster"},
+	}); err != nil {
+		t.Fatalf("创建ConfigMap失败: %v", err)
+	}
+
+	pod := newConfigTestPod(t, co, ContainerSpec{
+		Name:    "app",
+		Env:     []string{"MODE=standalone"},
+		EnvFrom: []EnvFromSource{{ConfigMapRef: "app-config", Prefix: "APP_"}, {ConfigMapRef: "app-config"}},
+	})
+	// 创建容器时已合并的镜像环境变量应保留
+	pod.Containers[0].Config.Env = []string{"PATH=/usr/bin", "MODE=standalone"}
+	if err := co.injectPodConfig(pod); err != nil {
+		t.Fatalf("注入配置失败: %v", err)
+	}
+
+	env := pod.Containers[0].Config.Env
+	want := []string{"PATH=/usr/bin", "MODE=standalone", "APP_LOG_LEVEL=debug", "APP_MODE=cluster", "LOG_LEVEL=debug"}
+	if strings.Join(env, ",") != strings.Join(want, ",") {
+		t.Errorf("期望环境变量为%v，实际为%v", want, env)
+	}
+}
+
+// stubVolumeMounts 将tmpfs和绑定挂载替换为只记录目标路径的桩函数
+func stubVolumeMounts(t *testing.T) (mounted, unmounted *[]string) {
+	t.Helper()
+	mounted, unmounted = &[]string{}, &[]string{}
+	originals := []func(*Mount) error{mountTmpfs, mountBind}
+	originalUnmounts := []func(string) error{unmountTmpfs, unmountBind}
+	record := func(mount *Mount) error {
+		*mounted = append(*mounted, mount.Target)
+		return nil
+	}
+	release := func(target string) error {
+		*unmounted = append(*unmounted, target)
+		return nil
+	}
+	mountTmpfs, mountBind, unmountTmpfs, unmountBind = record, record, release, release
+	t.Cleanup(func() {
+		mountTmpfs, mountBind = originals[0], originals[1]
+		unmountTmpfs, unmountBind = originalUnmounts[0], originalUnmounts[1]
+	})
+	return mounted, unmounted
+}
+
+func TestPodMountsSecretOutsidePersistentLayers(t *testing.T) {
+	mounted, unmounted := stubVolumeMounts(t)
+
+	cr := newTestRuntime(t)
+	co := NewContainerOrchestrator(cr)
+	if err := co.CreateSecret(NewSecret("default", "db", map[string][]byte{"password": []byte("s3cret")})); err != nil {
+		t.Fatalf("创建Secret失败: %v", err)
+	}
+
+	stored, err := co.GetSecret("default", "db")
+	if err != nil {
+		t.Fatalf("获取Secret失败: %v", err)
+	}
+	if stored.Data["password"] == "s3cret" {
+		t.Error("Secret值不应以明文保存")
+	}
+
+	pod := newConfigTestPod(t, co, ContainerSpec{
+		Name:         "app",
+		VolumeMounts: []VolumeMount{{Name: "db", MountPath: "/etc/db", Secret: "db"}},
+	})
+	if err := co.injectPodConfig(pod); err != nil {
+		t.Fatalf("注入配置失败: %v", err)
+	}
+
+	container := pod.Containers[0]
+	mount := container.Mounts[len(container.Mounts)-1]
+	target := filepath.Join(cr.containerRootfs(container), "etc", "db")
+	if mount.Target != target || !strings.Contains(mount.Options, "ro") {
+		t.Fatalf("Secret应绑定挂载到容器根文件系统下的/etc/db: %+v", mount)
+	}
+	if !strings.HasPrefix(mount.Source, cr.config.StateDirectory) {
+		t.Errorf("Secret文件必须位于StateDirectory下，实际为%s", mount.Source)
+	}
+	data, err := os.ReadFile(filepath.Join(mount.Source, "password"))
+	if err != nil || string(data) != "s3cret" {
+		t.Fatalf("Secret文件内容不正确: %q %v", data, err)
+	}
+	if want := []string{mount.Source, target}; !reflect.DeepEqual(*mounted, want) {
+		t.Fatalf("应先在卷目录上挂载tmpfs再绑定到容器中，期望%v，实际为%v", want, *mounted)
+	}
+
+	cr.cleanupContainer(container)
+	if len(*unmounted) < 2 || !reflect.DeepEqual((*unmounted)[:2], []string{target, mount.Source}) {
+		t.Errorf("容器清理时应按相反顺序卸载绑定挂载和tmpfs，实际卸载了%v", *unmounted)
+	}
+	if _, err := os.Stat(mount.Source); !os.IsNotExist(err) {
+		t.Errorf("容器清理后Secret文件应被删除: %v", err)
+	}
+}
+
+func TestSecretVolumeFailsClosedWithoutTmpfs(t *testing.T) {
+	stubVolumeMounts(t)
+	mountTmpfs = func(mount *Mount) error { return errors.New("mount not permitted") }
+
+	cr := newTestRuntime(t)
+	co := NewContainerOrchestrator(cr)
+	if err := co.CreateSecret(NewSecret("default", "db", map[string][]byte{"password": []byte("s3cret")})); err != nil {
+		t.Fatalf("创建Secret失败: %v", err)
+	}
+	if err := co.CreateConfigMap(&ConfigMap{Name: "cfg", Data: map[string]string{"a": "1"}}); err != nil {
+		t.Fatalf("创建ConfigMap失败: %v", err)
+	}
+
+	pod := newConfigTestPod(t, co, ContainerSpec{
+		Name:         "app",
+		VolumeMounts: []VolumeMount{{Name: "db", MountPath: "/etc/db", Secret: "db"}},
+	})
+	if err := co.injectPodConfig(pod); err == nil || !strings.Contains(err.Error(), "tmpfs") {
+		t.Fatalf("无法挂载tmpfs时Secret卷应失败，实际为%v", err)
+	}
+	volumeDir := filepath.Join(cr.containerStateDir(pod.Containers[0]), "volumes", "db")
+	if _, err := os.Stat(filepath.Join(volumeDir, "password")); !os.IsNotExist(err) {
+		t.Errorf("Secret不应以明文写入StateDirectory: %v", err)
+	}
+
+	// ConfigMap卷不含敏感数据，tmpfs不可用时仍写入StateDirectory
+	pod = newConfigTestPod(t, co, ContainerSpec{
+		Name:         "app",
+		VolumeMounts: []VolumeMount{{Name: "cfg", MountPath: "/etc/cfg", ConfigMap: "cfg"}},
+	})
+	if err := co.injectPodConfig(pod); err != nil {
+		t.Errorf("ConfigMap卷不要求tmpfs，实际为%v", err)
+	}
+}
+
+func TestConfigVolumeFailsWhenBindFails(t *testing.T) {
+	_, unmounted := stubVolumeMounts(t)
+	mountBind = func(mount *Mount) error { return errors.New("mount not permitted") }
+
+	cr := newTestRuntime(t)
+	co := NewContainerOrchestrator(cr)
+	if err := co.CreateConfigMap(&ConfigMap{Name: "cfg", Data: map[string]string{"a": "1"}}); err != nil {
+		t.Fatalf("创建ConfigMap失败: %v", err)
+	}
+	pod := newConfigTestPod(t, co, ContainerSpec{
+		Name:         "app",
+		VolumeMounts: []VolumeMount{{Name: "cfg", MountPath: "/etc/cfg", ConfigMap: "cfg"}},
+	})
+	if err := co.injectPodConfig(pod); err == nil || !strings.Contains(err.Error(), "failed to bind volume") {
+		t.Fatalf("无法绑定挂载时应返回错误，实际为%v", err)
+	}
+	volumeDir := filepath.Join(cr.containerStateDir(pod.Containers[0]), "volumes", "cfg")
+	if len(*unmounted) != 1 || (*unmounted)[0] != volumeDir {
+		t.Errorf("绑定失败时应卸载已挂载的tmpfs，实际卸载了%v", *unmounted)
+	}
+}
+
+func TestSecretVolumeIsMountedReadOnly(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("需要Linux和root权限执行真实挂载")
+	}
+	cr := newTestRuntime(t)
+	co := NewContainerOrchestrator(cr)
+	if err := co.CreateSecret(NewSecret("default", "db", map[string][]byte{"password": []byte("s3cret")})); err != nil {
+		t.Fatalf("创建Secret失败: %v", err)
+	}
+	pod := newConfigTestPod(t, co, ContainerSpec{
+		Name:         "app",
+		VolumeMounts: []VolumeMount{{Name: "db", MountPath: "/etc/db", Secret: "db"}},
+	})
+	if err := co.injectPodConfig(pod); err != nil {
+		if errors.Is(err, syscall.EPERM) || strings.Contains(err.Error(), "operation not permitted") {
+			t.Skipf("当前环境不允许挂载: %v", err)
+		}
+		t.Fatalf("注入配置失败: %v", err)
+	}
+	container := pod.Containers[0]
+	cleaned := false
+	defer func() {
+		if !cleaned {
+			cr.cleanupContainer(container)
+		}
+	}()
+
+	target := filepath.Join(cr.containerRootfs(container), "etc", "db")
+	if data, err := os.ReadFile(filepath.Join(target, "password")); err != nil || string(data) != "s3cret" {
+		t.Fatalf("容器根文件系统中应能读到Secret: %q %v", data, err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "injected"), []byte("x"), 0644); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("Secret卷应为只读挂载，写入结果为%v", err)
+	}
+
+	cr.cleanupContainer(container)
+	cleaned = true
+	if _, err := os.Stat(filepath.Join(target, "password")); !os.IsNotExist(err) {
+		t.Errorf("容器清理后绑定挂载应被卸载: %v", err)
+	}
+}
+
+func TestVolumeMountRejectsInvalidNames(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "/bin/true")
+	for _, volumeMount := range []VolumeMount{
+		{Name: "../../x", MountPath: "/etc/x"},
+		{Name: `a\b`, MountPath: "/etc/x"},
+		{Name: "..", MountPath: "/etc/x"},
+		{MountPath: "/.."},
+	} {
+		if _, err := cr.materializeConfigVolume(container, volumeMount, nil); err == nil || !strings.Contains(err.Error(), "invalid volume name") {
+			t.Errorf("卷名%q应被拒绝，实际为%v", volumeMount.Name, err)
+		}
+	}
+}
+
+func TestInjectPodConfigMissingReference(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	pod := newConfigTestPod(t, co, ContainerSpec{Name: "app", EnvFrom: []EnvFromSource{{ConfigMapRef: "missing"}}})
+	if err := co.injectPodConfig(pod); err == nil {
+		t.Fatal("引用不存在的ConfigMap应返回错误")
+	}
+}
+
+func TestConfigMapCRUD(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	if err := co.CreateConfigMap(&ConfigMap{Name: "bad", Data: map[string]string{"../escape": "x"}}); err == nil {
+		t.Error("包含路径分隔符的键应被拒绝")
+	}
+	if err := co.CreateConfigMap(&ConfigMap{Name: "cfg", Data: map[string]string{"a": "1"}}); err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	if err := co.CreateConfigMap(&ConfigMap{Name: "cfg"}); err == nil {
+		t.Error("重复创建应返回错误")
+	}
+	if err := co.UpdateConfigMap(&ConfigMap{Name: "cfg", Data: map[string]string{"a": "2"}}); err != nil {
+		t.Fatalf("更新失败: %v", err)
+	}
+
+	configMap, err := co.GetConfigMap("default", "cfg")
+	if err != nil || configMap.Data["a"] != "2" {
+		t.Fatalf("期望读取到更新后的值，实际为%v %v", configMap, err)
+	}
+	configMap.Data["a"] = "mutated"
+	if again, _ := co.GetConfigMap("", "cfg"); again.Data["a"] != "2" {
+		t.Error("GetConfigMap应返回副本")
+	}
+
+	if err := co.DeleteConfigMap("default", "cfg"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if _, err := co.GetConfigMap("default", "cfg"); err == nil {
+		t.Error("删除后不应再能读取")
+	}
+}
+
+// ==================
+// 7. 镜像构建
+// ==================
+
+// newBuildTestRuntime 创建可以真正运行容器进程的运行时，cgroup目录重定向到临时目录
+func newBuildTestRuntime(t *testing.T) *ContainerRuntime {
+	t.Helper()
+	cr := newImageTestRuntime(t)
+	cr.cgroups.mountPoint = t.TempDir()
+	cr.registerImage(&ContainerImage{
+		ID:     "base",
+		Config: &ImageConfig{Env: []string{"PATH=/usr/bin:/bin"}, WorkingDir: "/"},
+	}, "base:latest")
+	return cr
+}
+
+// registerShellImage 把宿主机的/bin/sh及其依赖的动态库复制进一层，登记为shell:latest，
+// 供chroot中执行的RUN步骤使用。chroot需要root权限，非root或找不到依赖时跳过测试
+func registerShellImage(t *testing.T, cr *ContainerRuntime) {
+	t.Helper()
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("在chroot中执行RUN需要Linux和root权限")
+	}
+	shell, err := filepath.EvalSymlinks("/bin/sh")
+	if err != nil {
+		t.Skipf("找不到/bin/sh: %v", err)
+	}
+
+	files := map[string]bool{}
+	var collect func(file string)
+	collect = func(file string) {
+		if files[file] {
+			return
+		}
+		files[file] = true
+		binary, err := elf.Open(file)
+		if err != nil {
+			t.Skipf("无法解析%s: %v", file, err)
+		}
+		defer binary.Close()
+		for _, prog := range binary.Progs {
+			if prog.Type == elf.PT_INTERP {
+				interp, _ := io.ReadAll(prog.Open())
+				collect(strings.TrimRight(string(interp), "\x00"))
+			}
+		}
+		libs, _ := binary.ImportedLibraries()
+		for _, lib := range libs {
+			dirs, _ := filepath.Glob("/lib/*-linux-gnu")
+			found := false
+			for _, dir := range append(dirs, "/lib64", "/lib", "/usr/lib") {
+				if _, err := os.Stat(filepath.Join(dir, lib)); err == nil {
+					collect(filepath.Join(dir, lib))
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Skipf("找不到%s依赖的%s", file, lib)
+			}
+		}
+	}
+	collect(shell)
+
+	image, err := cr.createImageWithLayer(nil, &ImageConfig{Env: []string{"PATH=/usr/bin:/bin"}, WorkingDir: "/"}, func(diffPath string) error {
+		for file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(diffPath, file)
+			if file == shell {
+				target = filepath.Join(diffPath, "bin", "sh")
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(target, data, 0755); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("创建shell镜像失败: %v", err)
+	}
+	cr.registerImage(image, "shell:latest")
+}
+
+func TestBuildImageFromAndRun(t *testing.T) {
+	cr := newBuildTestRuntime(t)
+	registerShellImage(t, cr)
+	spec := &BuildSpec{
+		Tag: "app:latest",
+		Steps: []BuildStep{
+			{Instruction: BuildFrom, Args: []string{"shell:latest"}},
+			{Instruction: BuildRun, Args: []string{"echo built > artifact.txt"}},
+			{Instruction: BuildCmd, Args: []string{"sh", "-c", "exit 3"}},
+		},
+	}
+
+	image, err := cr.BuildImage(spec)
+	if err != nil {
+		t.Fatalf("构建镜像失败: %v", err)
+	}
+	if len(image.Layers) != 2 {
+		t.Fatalf("期望在shell层之上生成1层，实际为%v", image.Layers)
+	}
+	diffPath, _ := cr.storage.activeDriver.DiffPath(image.Layers[1])
+	data, err := os.ReadFile(filepath.Join(diffPath, "artifact.txt"))
+	if err != nil || string(data) != "built\n" {
+		t.Fatalf("RUN的结果未提交到层中: %q %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(diffPath, "bin", "sh")); err == nil {
+		t.Error("RUN生成的层只应包含改动的文件")
+	}
+	if len(cr.ListContainers()) != 0 {
+		t.Error("构建完成后临时容器应被删除")
+	}
+
+	// 从构建出的镜像运行容器，命令来自镜像的CMD
+	container, err := cr.RunContainer(&ContainerConfig{Image: "app:latest"})
+	if err != nil {
+		t.Fatalf("运行容器失败: %v", err)
+	}
+	exitCode, err := cr.WaitContainer(container.ID)
+	if err != nil {
+		t.Fatalf("等待容器失败: %v", err)
+	}
+	if exitCode != 3 {
+		t.Errorf("期望退出码为3，实际为%d", exitCode)
+	}
+	rootfs := filepath.Join(cr.config.RootDirectory, "containers", container.ID, "layer")
+	if _, err := os.Stat(filepath.Join(rootfs, "artifact.txt")); err != nil {
+		t.Errorf("容器文件系统中应包含构建产物: %v", err)
+	}
+
+	// 未改变的步骤命中缓存，复用同一层
+	rebuilt, err := cr.BuildImage(spec)
+	if err != nil {
+		t.Fatalf("重新构建失败: %v", err)
+	}
+	if rebuilt.Layers[1] != image.Layers[1] {
+		t.Errorf("期望复用缓存层%s，实际为%s", image.Layers[1], rebuilt.Layers[1])
+	}
+
+	spec.NoCache = true
+	uncached, err := cr.BuildImage(spec)
+	if err != nil {
+		t.Fatalf("禁用缓存构建失败: %v", err)
+	}
+	// 禁用缓存时步骤重新执行；产物与原层内容相同时会被去重为同一层
+	if uncached.Layers[1] == image.Layers[1] && cr.storage.DedupStats().SharedLayers == 0 {
+		t.Error("禁用缓存时应重新执行步骤生成层")
+	}
+}
+
+func TestBuildImageCopyAndConfig(t *testing.T) {
+	cr := newBuildTestRuntime(t)
+	contextDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(contextDir, "app.conf"), []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &BuildSpec{
+		ContextDir: contextDir,
+		Steps: []BuildStep{
+			{Instruction: BuildFrom, Args: []string{"base"}},
+			{Instruction: BuildWorkdir, Args: []string{"/srv"}},
+			{Instruction: BuildEnv, Args: []string{"MODE=prod"}},
+			{Instruction: BuildCopy, Args: []string{"app.conf", "conf/"}},
+		},
+	}
+	image, err := cr.BuildImage(spec)
+	if err != nil {
+		t.Fatalf("构建镜像失败: %v", err)
+	}
+
+	diffPath, _ := cr.storage.activeDriver.DiffPath(image.Layers[0])
+	if data, err := os.ReadFile(filepath.Join(diffPath, "srv", "conf", "app.conf")); err != nil || string(data) != "v1" {
+		t.Fatalf("COPY结果不正确: %q %v", data, err)
+	}
+	if image.Config.WorkingDir != "/srv" {
+		t.Errorf("期望工作目录为/srv，实际为%s", image.Config.WorkingDir)
+	}
+	if strings.Join(image.Config.Env, ",") != "PATH=/usr/bin:/bin,MODE=prod" {
+		t.Errorf("环境变量不正确: %v", image.Config.Env)
+	}
+
+	// 源文件内容变化后COPY缓存失效
+	if err := os.WriteFile(filepath.Join(contextDir, "app.conf"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := cr.BuildImage(spec)
+	if err != nil {
+		t.Fatalf("重新构建失败: %v", err)
+	}
+	if rebuilt.Layers[0] == image.Layers[0] {
+		t.Error("源文件变化后不应命中缓存")
+	}
+
+	spec.Steps[3].Args = []string{"../outside", "/"}
+	if _, err := cr.BuildImage(spec); err == nil {
+		t.Error("COPY源路径越出构建上下文时应返回错误")
+	}
+}
+
+func TestBuildImageRunFailure(t *testing.T) {
+	cr := newBuildTestRuntime(t)
+	registerShellImage(t, cr)
+	_, err := cr.BuildImage(&BuildSpec{Steps: []BuildStep{
+		{Instruction: BuildFrom, Args: []string{"shell:latest"}},
+		{Instruction: BuildRun, Args: []string{"echo broken >&2; exit 1"}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("期望RUN失败并包含命令输出，实际为%v", err)
+	}
+}
+
+func TestBuildImageRunIsConfinedToRootfs(t *testing.T) {
+	cr := newBuildTestRuntime(t)
+	registerShellImage(t, cr)
+	host := t.TempDir()
+
+	// 宿主机上的目录在chroot中不存在，写入失败而不是落到宿主机上
+	_, err := cr.BuildImage(&BuildSpec{Steps: []BuildStep{
+		{Instruction: BuildFrom, Args: []string{"shell:latest"}},
+		{Instruction: BuildRun, Args: []string{"echo escaped > " + host + "/marker"}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "exited with code") {
+		t.Errorf("写入根文件系统中不存在的目录时RUN应失败，实际为%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(host, "marker")); !os.IsNotExist(err) {
+		t.Fatal("RUN命令不应写到宿主机文件系统")
+	}
+
+	// 没有shell的镜像中RUN找不到可执行文件，不会改用宿主机的sh
+	_, err = cr.BuildImage(&BuildSpec{Steps: []BuildStep{
+		{Instruction: BuildFrom, Args: []string{"base"}},
+		{Instruction: BuildRun, Args: []string{"true"}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "not found in container root filesystem") {
+		t.Errorf("镜像中没有sh时RUN应失败，实际为%v", err)
+	}
+}
+
+func TestCopyTreeDoesNotFollowLowerLayerSymlinks(t *testing.T) {
+	host := t.TempDir()
+	lower, upper, target := t.TempDir(), t.TempDir(), t.TempDir()
+	// 下层把etc和hosts指向宿主机
+	if err := os.Symlink(host, filepath.Join(lower, "etc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(host, "hosts"), filepath.Join(lower, "hosts")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(upper, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"etc/passwd", "hosts"} {
+		if err := os.WriteFile(filepath.Join(upper, name), []byte("upper"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, layer := range []string{lower, upper} {
+		if err := copyTree(layer, target); err != nil {
+			t.Fatalf("复制层失败: %v", err)
+		}
+	}
+	if entries, _ := os.ReadDir(host); len(entries) != 0 {
+		t.Fatalf("上层文件不应经由下层的符号链接写到宿主机: %v", entries)
+	}
+	for _, name := range []string{"etc/passwd", "hosts"} {
+		info, err := os.Lstat(filepath.Join(target, name))
+		if err != nil || !info.Mode().IsRegular() {
+			t.Errorf("%s应被上层的普通文件替换: %v %v", name, info, err)
+		}
+	}
+}
+
+// ==================
+// 8. 事件审计日志
+// ==================
+
+func TestContainerLifecycleEventsPersisted(t *testing.T) {
+	cr := newBuildTestRuntime(t)
+	cr.images["base"].Config.Cmd = []string{"sh", "-c", "sleep 5"}
+	before := time.Now()
+
+	container, err := cr.CreateContainer(&ContainerConfig{Image: "base"})
+	if err != nil {
+		t.Fatalf("创建容器失败: %v", err)
+	}
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+	if err := cr.StopContainer(container.ID, 5*time.Second); err != nil {
+		t.Fatalf("停止容器失败: %v", err)
+	}
+
+	lifecycle := []EventType{EventContainerCreate, EventContainerStart, EventContainerStop}
+	events, err := cr.QueryEvents(EventQuery{Container: container.ID, Types: lifecycle})
+	if err != nil {
+		t.Fatalf("查询事件失败: %v", err)
+	}
+	if len(events) != len(lifecycle) {
+		t.Fatalf("期望%d条事件记录，实际为%d", len(lifecycle), len(events))
+	}
+	for i, event := range events {
+		if event.Type != lifecycle[i] {
+			t.Errorf("第%d条事件期望为%s，实际为%s", i+1, lifecycle[i], event.Type)
+		}
+		if event.ContainerID != container.ID || event.ContainerName != container.Name {
+			t.Errorf("事件记录的容器标识不正确: %s/%s", event.ContainerID, event.ContainerName)
+		}
+		if event.Timestamp.Before(before) || event.Message == "" {
+			t.Errorf("事件记录缺少时间戳或消息: %+v", event)
+		}
+	}
+
+	// 按容器名称查询同样有效，时间范围之外没有记录
+	if byName, _ := cr.QueryEvents(EventQuery{Container: container.Name, Types: lifecycle}); len(byName) != len(lifecycle) {
+		t.Errorf("按名称查询期望%d条记录，实际为%d", len(lifecycle), len(byName))
+	}
+	if early, _ := cr.QueryEvents(EventQuery{Until: before}); len(early) != 0 {
+		t.Errorf("时间范围之前不应有记录，实际为%d条", len(early))
+	}
+}
+
+func TestEventLogRotation(t *testing.T) {
+	dir := t.TempDir()
+	eventLog := NewEventLog(dir, EventLogConfig{MaxSize: 512, MaxBackups: 2})
+	defer eventLog.Close()
+
+	for i := 0; i < 30; i++ {
+		if err := eventLog.WriteEvent(&ContainerEvent{
+			Type:        EventContainerStart,
+			ContainerID: fmt.Sprintf("container-%02d", i),
+			Timestamp:   time.Now(),
+		}); err != nil {
+			t.Fatalf("写入事件失败: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("期望保留当前文件和2个轮转文件，实际为%d个文件", len(entries))
+	}
+	for _, entry := range entries {
+		info, _ := entry.Info()
+		if info.Size() > 512 {
+			t.Errorf("日志文件%s超过大小限制: %d", entry.Name(), info.Size())
+		}
+	}
+
+	// 最新的记录保留且按时间顺序返回
+	events, err := eventLog.Query(EventQuery{})
+	if err != nil {
+		t.Fatalf("查询事件失败: %v", err)
+	}
+	if len(events) == 0 || events[len(events)-1].ContainerID != "container-29" {
+		t.Fatalf("期望最后一条记录为container-29，实际为%v", events)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].ContainerID < events[i-1].ContainerID {
+			t.Fatalf("事件未按写入顺序返回: %s 在 %s 之后", events[i].ContainerID, events[i-1].ContainerID)
+		}
+	}
+}
+
+func TestRuntimeStopClosesEventLog(t *testing.T) {
+	cr := newTestRuntime(t)
+	cr.eventBus.Publish(&ContainerEvent{Type: EventContainerCreate, ContainerID: "c1", Timestamp: time.Now()})
+	if err := cr.Stop(); err != nil {
+		t.Fatalf("停止运行时失败: %v", err)
+	}
+	if err := cr.Stop(); err != nil {
+		t.Errorf("重复停止应无副作用，实际为%v", err)
+	}
+
+	cr.eventLog.mutex.Lock()
+	file := cr.eventLog.file
+	cr.eventLog.mutex.Unlock()
+	if file != nil {
+		t.Error("停止后事件日志文件应已关闭")
+	}
+	if err := cr.eventLog.WriteEvent(&ContainerEvent{Type: EventContainerStart, ContainerID: "c1"}); err == nil {
+		t.Error("关闭后的事件日志不应重新打开文件")
+	}
+	events, err := cr.eventLog.Query(EventQuery{})
+	if err != nil || len(events) != 1 || events[0].ContainerID != "c1" {
+		t.Errorf("停止前的事件应已落盘，实际为%v %v", events, err)
+	}
+	if err := cr.Start(); err == nil {
+		t.Error("停止后的运行时不应再启动")
+	}
+}
+
+// ==================
+// 9. cgroup v2委派与嵌套
+// ==================
+
+// newFakeCgroupRoot 创建一个模拟cgroup v2挂载点的目录，根cgroup提供给定的控制器
+func newFakeCgroupRoot(t *testing.T, controllers string) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte(controllers), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// watchCgroupMkdir 替换cgroupMkdir，在每个目录创建前记录其父目录的subtree_control内容
+func watchCgroupMkdir(t *testing.T) map[string]string {
+	t.Helper()
+	observed := make(map[string]string)
+	original := cgroupMkdir
+	cgroupMkdir = func(name string, perm os.FileMode) error {
+		data, _ := os.ReadFile(filepath.Join(filepath.Dir(name), "cgroup.subtree_control"))
+		observed[name] = string(data)
+		return original(name, perm)
+	}
+	t.Cleanup(func() { cgroupMkdir = original })
+	return observed
+}
+
+func TestUnifiedCgroupEnablesControllersBeforeChildCreation(t *testing.T) {
+	root := newFakeCgroupRoot(t, "cpuset cpu io memory hugetlb pids")
+	observed := watchCgroupMkdir(t)
+
+	cm := NewCgroupManager()
+	cm.mountPoint = root
+	cm.parent = "runtime.slice/containers"
+
+	cgroup, err := cm.CreateUnifiedCgroup("c1")
+	if err != nil {
+		t.Fatalf("创建cgroup失败: %v", err)
+	}
+
+	want := "+cpu +cpuset +memory +io +pids"
+	for _, dir := range []string{
+		filepath.Join(root, "runtime.slice"),
+		filepath.Join(root, "runtime.slice", "containers"),
+		filepath.Join(root, "runtime.slice", "containers", "c1"),
+	} {
+		control, created := observed[dir]
+		if !created {
+			t.Fatalf("期望创建目录%s", dir)
+		}
+		if control != want {
+			t.Errorf("创建%s之前父级subtree_control应为%q，实际为%q", dir, want, control)
+		}
+	}
+	if cgroup.Path != filepath.Join(root, "runtime.slice", "containers", "c1") {
+		t.Errorf("cgroup路径不正确: %s", cgroup.Path)
+	}
+	if strings.Join(cgroup.Controllers, ",") != "cpu,cpuset,memory,io,pids" {
+		t.Errorf("cgroup控制器不正确: %v", cgroup.Controllers)
+	}
+}
+
+func TestUnifiedCgroupRespectsDelegatedSubtree(t *testing.T) {
+	root := newFakeCgroupRoot(t, "cpuset cpu io memory pids")
+	// 委派的子树已存在，委派方只开放了cpu和memory
+	delegated := filepath.Join(root, "system.slice", "runtime.service")
+	if err := os.MkdirAll(delegated, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(delegated, "cgroup.controllers"), []byte("cpu memory"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	observed := watchCgroupMkdir(t)
+
+	cr := NewContainerRuntime(RuntimeConfig{
+		RootDirectory:  t.TempDir(),
+		StateDirectory: t.TempDir(),
+		CgroupParent:   "/system.slice/runtime.service/",
+		CgroupVersion:  2,
+	})
+	t.Cleanup(func() { cr.Stop() })
+	cr.cgroups.mountPoint = root
+
+	container := addTestContainer(t, cr, "/bin/true")
+	if err := cr.createCgroups(container); err != nil {
+		t.Fatalf("创建cgroup失败: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "cgroup.subtree_control")); !os.IsNotExist(err) {
+		t.Error("不应修改委派子树之外的cgroup")
+	}
+	if control := observed[filepath.Join(delegated, container.ID)]; control != "+cpu +memory" {
+		t.Errorf("期望只启用委派的控制器，实际为%q", control)
+	}
+	if container.Cgroups["memory"] != container.Cgroups["cpu"] {
+		t.Error("cgroup v2下各子系统应共用同一个cgroup")
+	}
+}
+
+// ==================
+// 10. veth接口命名
+// ==================
+
+func TestVethNamesAreShortAndUnique(t *testing.T) {
+	original := hostInterfaceExists
+	t.Cleanup(func() { hostInterfaceExists = original })
+	// 模拟主机上已存在的接口，分配时必须避开
+	existing := make(map[string]bool)
+	hostInterfaceExists = func(name string) bool { return existing[name] }
+
+	bd := &BridgeDriver{}
+	first, err := bd.allocateVethNames("net-a", "probe", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bd.releaseVethNames("net-a", "probe")
+	existing[first.hostVeth] = true
+
+	seen := make(map[string]string)
+	for i := 0; i < 2000; i++ {
+		// 容器ID共享长前缀，旧的veth<前7位>命名方式会全部冲突
+		containerID := fmt.Sprintf("abcdef0%057d", i)
+		networkID := "net-a"
+		if i%2 == 1 {
+			networkID = "net-b"
+		}
+		if i == 0 {
+			containerID = "probe"
+		}
+
+		endpoint, err := bd.allocateVethNames(networkID, containerID, "")
+		if err != nil {
+			t.Fatalf("分配第%d个端点失败: %v", i, err)
+		}
+		if endpoint.containerVeth != "eth0" {
+			t.Errorf("期望默认容器内接口为eth0，实际为%s", endpoint.containerVeth)
+		}
+		for _, name := range []string{endpoint.hostVeth, endpoint.peerVeth} {
+			if len(name) > maxInterfaceNameLength {
+				t.Fatalf("接口名%s超过%d字符", name, maxInterfaceNameLength)
+			}
+			if owner, dup := seen[name]; dup {
+				t.Fatalf("接口名%s被%s和%s重复使用", name, owner, containerID)
+			}
+			if existing[name] {
+				t.Fatalf("接口名%s与主机已有接口冲突", name)
+			}
+			seen[name] = containerID
+		}
+	}
+
+	if _, err := bd.allocateVethNames("net-c", "c1", "an-interface-name-too-long"); err == nil {
+		t.Error("期望拒绝超过15字符的容器内接口名")
+	}
+}
+
+// fakeEndpointDriver 按请求的接口名创建端点的无副作用驱动
+type fakeEndpointDriver struct {
+	HostDriver
+}
+
+func (fd *fakeEndpointDriver) Name() string {
+	return "fake"
+}
+
+func (fd *fakeEndpointDriver) CreateNetwork(config *NetworkConfig) (*ContainerNetwork, error) {
+	network, err := fd.HostDriver.CreateNetwork(config)
+	if err == nil {
+		network.Driver = fd.Name()
+	}
+	return network, err
+}
+
+func (fd *fakeEndpointDriver) CreateEndpoint(networkID, containerID, ifName string) (*EndpointConfig, error) {
+	return &EndpointConfig{NetworkID: networkID, ContainerID: containerID, Interface: ifName}, nil
+}
+
+func TestConnectContainerAssignsInterfacePerNetwork(t *testing.T) {
+	nm := NewNetworkManager()
+	nm.RegisterDriver(&fakeEndpointDriver{})
+	containerID := fmt.Sprintf("%064d", 42)
+
+	var endpoints []*EndpointConfig
+	for _, name := range []string{"front", "back"} {
+		network, err := nm.CreateNetwork(&NetworkConfig{Name: name, Driver: "fake"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		endpoint, err := nm.ConnectContainer(network.ID, containerID, "")
+		if err != nil {
+			t.Fatalf("连接网络%s失败: %v", name, err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if endpoints[0].Interface != "eth0" || endpoints[1].Interface != "eth1" {
+		t.Errorf("期望依次分配eth0、eth1，实际为%s、%s", endpoints[0].Interface, endpoints[1].Interface)
+	}
+
+	network, _ := nm.CreateNetwork(&NetworkConfig{Name: "mgmt", Driver: "fake"})
+	if _, err := nm.ConnectContainer(network.ID, containerID, "eth1"); err == nil {
+		t.Error("期望拒绝同一容器内重复的接口名")
+	}
+	endpoint, err := nm.ConnectContainer(network.ID, containerID, "mgmt0")
+	if err != nil || endpoint.Interface != "mgmt0" {
+		t.Errorf("期望使用指定的接口名mgmt0，实际为%v %v", endpoint, err)
+	}
+}
+
+// ==================
+// 11. 上下文取消与镜像拉取
+// ==================
+
+// gzipLayer 将文件打包为gzip压缩的层tar
+func gzipLayer(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// fakeRegistry 基于httptest的仓库，blobHandlers可覆盖单个blob的响应。
+// token非空时要求Bearer令牌，并在/token上匿名签发该令牌
+type fakeRegistry struct {
+	server        *httptest.Server
+	manifest      []byte
+	blobs         map[string][]byte
+	blobHandlers  map[string]http.HandlerFunc
+	token         string
+	tokenRequests int
+}
+
+func newFakeRegistry(t *testing.T, repository string, config *registryImageConfig, layers ...[]byte) *fakeRegistry {
+	t.Helper()
+	registry := &fakeRegistry{blobs: make(map[string][]byte), blobHandlers: make(map[string]http.HandlerFunc)}
+
+	configData, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := registryManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIManifest,
+		Config:        registryDescriptor{Digest: sha256Digest(configData), Size: int64(len(configData))},
+	}
+	registry.blobs[manifest.Config.Digest] = configData
+	for _, layer := range layers {
+		descriptor := registryDescriptor{MediaType: mediaTypeLayerGzip, Digest: sha256Digest(layer), Size: int64(len(layer))}
+		manifest.Layers = append(manifest.Layers, descriptor)
+		registry.blobs[descriptor.Digest] = layer
+	}
+	if registry.manifest, err = json.Marshal(manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := "/v2/" + repository
+	registry.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			registry.tokenRequests++
+			if r.URL.Query().Get("scope") != "repository:"+repository+":pull" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": registry.token})
+			return
+		}
+		if registry.token != "" && r.Header.Get("Authorization") != "Bearer "+registry.token {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, registry.server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, prefix+"/manifests/"):
+			w.Header().Set("Content-Type", mediaTypeOCIManifest)
+			w.Write(registry.manifest)
+		case strings.HasPrefix(r.URL.Path, prefix+"/blobs/"):
+			digest := strings.TrimPrefix(r.URL.Path, prefix+"/blobs/")
+			if handler := registry.blobHandlers[digest]; handler != nil {
+				handler(w, r)
+				return
+			}
+			data, exists := registry.blobs[digest]
+			if !exists {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(registry.server.Close)
+	return registry
+}
+
+// ref 返回指向该仓库的镜像引用
+func (fr *fakeRegistry) ref(name string) string {
+	return strings.TrimPrefix(fr.server.URL, "http://") + "/" + name
+}
+
+func TestPullImageFromRegistry(t *testing.T) {
+	cr := newImageTestRuntime(t)
+	layer := gzipLayer(t, map[string]string{"etc/os-release": "demo\n"})
+	registry := newFakeRegistry(t, "demo/app", &registryImageConfig{
+		Architecture: "amd64",
+		Os:           "linux",
+		Config:       &ImageConfig{Env: []string{"PATH=/bin"}, Cmd: []string{"sh"}},
+	}, layer)
+
+	image, err := cr.PullImage(registry.ref("demo/app:v1"), PullOptions{Insecure: true})
+	if err != nil {
+		t.Fatalf("拉取镜像失败: %v", err)
+	}
+	if len(image.Layers) != 1 || image.Config.Cmd[0] != "sh" {
+		t.Fatalf("镜像层或配置不正确: %+v", image)
+	}
+	if _, err := cr.CreateContainer(&ContainerConfig{Image: registry.ref("demo/app:v1")}); err != nil {
+		t.Errorf("期望可以按标签使用拉取的镜像，实际为%v", err)
+	}
+
+	diffPath, _ := cr.storage.activeDriver.DiffPath(image.Layers[0])
+	if data, err := os.ReadFile(filepath.Join(diffPath, "etc", "os-release")); err != nil || string(data) != "demo\n" {
+		t.Errorf("层内容未正确解包: %q %v", data, err)
+	}
+}
+
+func TestPullImageWithBearerToken(t *testing.T) {
+	base := gzipLayer(t, map[string]string{"etc/os-release": "demo\n"})
+	app := gzipLayer(t, map[string]string{"app/run.sh": "echo hi\n"})
+	registry := newFakeRegistry(t, "demo/app", &registryImageConfig{Os: "linux"}, base, app)
+	registry.token = "pull-token"
+
+	cr := newImageTestRuntime(t)
+	image, err := cr.PullImage(registry.ref("demo/app:v1"), PullOptions{Insecure: true})
+	if err != nil {
+		t.Fatalf("匿名申请令牌后拉取失败: %v", err)
+	}
+	if registry.tokenRequests != 1 {
+		t.Errorf("整个拉取过程应只申请一次令牌，实际为%d次", registry.tokenRequests)
+	}
+	if len(image.Layers) != 2 || image.Layers[0] != strings.TrimPrefix(sha256Digest(base), "sha256:") {
+		t.Fatalf("镜像层不正确: %v", image.Layers)
+	}
+	for layerID, name := range map[string]string{image.Layers[0]: "etc/os-release", image.Layers[1]: "app/run.sh"} {
+		diffPath, _ := cr.storage.activeDriver.DiffPath(layerID)
+		if _, err := os.Stat(filepath.Join(diffPath, filepath.FromSlash(name))); err != nil {
+			t.Errorf("层%s中缺少%s: %v", layerID, name, err)
+		}
+	}
+
+	preset := newImageTestRuntime(t)
+	if _, err := preset.PullImage(registry.ref("demo/app:v1"), PullOptions{Insecure: true, Token: "pull-token"}); err != nil {
+		t.Fatalf("使用预置令牌拉取失败: %v", err)
+	}
+	if registry.tokenRequests != 1 {
+		t.Errorf("预置令牌时不应再申请令牌，实际共%d次", registry.tokenRequests)
+	}
+	if _, err := newImageTestRuntime(t).PullImage(registry.ref("demo/app:v1"), PullOptions{Insecure: true, Token: "stale"}); err != nil {
+		t.Errorf("预置令牌失效时应重新申请令牌，实际为%v", err)
+	}
+}
+
+// tokenRecorder 记录令牌请求并签发固定令牌
+type tokenRecorder struct {
+	requests []*http.Request
+}
+
+func (tr *tokenRecorder) Do(request *http.Request) (*http.Response, error) {
+	tr.requests = append(tr.requests, request)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       io.NopCloser(strings.NewReader(`{"token":"t"}`)),
+	}, nil
+}
+
+func TestRegistryAuthenticateProtectsCredentials(t *testing.T) {
+	cases := []struct {
+		name      string
+		baseURL   string
+		insecure  bool
+		trusted   []string
+		username  string
+		realm     string
+		wantErr   bool
+		wantBasic bool
+	}{
+		{"同源HTTPS令牌服务", "https://registry.example", false, nil, "user", "https://registry.example/token", false, true},
+		{"拒绝HTTP令牌服务", "https://registry.example", false, nil, "user", "http://registry.example/token", true, false},
+		{"拒绝其他协议", "https://registry.example", true, nil, "user", "ftp://registry.example/token", true, false},
+		{"不可信主机报错而不是匿名申请", "https://registry.example", false, nil, "user", "https://auth.example/token", true, false},
+		{"可信列表中的主机", "https://registry.example", false, []string{"auth.example"}, "user", "https://auth.example/token", false, true},
+		{"匿名时可以使用其他主机", "https://registry.example", false, nil, "", "https://auth.example/token", false, false},
+		{"Insecure时允许HTTP", "http://registry.example", true, nil, "user", "http://registry.example/token", false, true},
+		{"Insecure时拒绝HTTPS降级", "https://registry.example", true, nil, "user", "http://registry.example/token", true, false},
+		{"可信主机同样不能降级", "https://registry.example", true, []string{"auth.example"}, "user", "http://auth.example/token", true, false},
+	}
+	for _, tc := range cases {
+		recorder := &tokenRecorder{}
+		rc := &registryClient{
+			client:        recorder,
+			baseURL:       tc.baseURL,
+			repository:    "demo/app",
+			username:      tc.username,
+			password:      "secret",
+			trustedRealms: tc.trusted,
+			insecure:      tc.insecure,
+		}
+		err := rc.authenticate(context.Background(), fmt.Sprintf(`Bearer realm="%s"`, tc.realm))
+		if tc.wantErr {
+			if err == nil || len(recorder.requests) != 0 {
+				t.Errorf("%s: 应拒绝令牌服务且不发出请求，错误为%v，请求%d次", tc.name, err, len(recorder.requests))
+			}
+			continue
+		}
+		if err != nil || len(recorder.requests) != 1 {
+			t.Fatalf("%s: 申请令牌失败: %v", tc.name, err)
+		}
+		if _, _, ok := recorder.requests[0].BasicAuth(); ok != tc.wantBasic {
+			t.Errorf("%s: 是否发送Basic凭据为%v，期望%v", tc.name, ok, tc.wantBasic)
+		}
+	}
+}
+
+func TestPullImageTrustsDockerHubTokenRealm(t *testing.T) {
+	challenged := &challengeRecorder{realm: "https://auth.docker.io/token"}
+	newImageTestRuntime(t).PullImage("library/alpine:3", PullOptions{Client: challenged, Username: "user", Password: "secret"})
+	if challenged.tokenRequest == nil {
+		t.Fatal("应向auth.docker.io申请令牌")
+	}
+	if user, _, ok := challenged.tokenRequest.BasicAuth(); !ok || user != "user" {
+		t.Error("Docker Hub的令牌服务应收到凭据")
+	}
+}
+
+// challengeRecorder 对仓库请求返回Bearer质询，记录发往令牌服务的请求
+type challengeRecorder struct {
+	realm        string
+	tokenRequest *http.Request
+}
+
+func (cr *challengeRecorder) Do(request *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(request.URL.String(), cr.realm) {
+		cr.tokenRequest = request
+		return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: io.NopCloser(strings.NewReader(`{"token":"t"}`))}, nil
+	}
+	header := http.Header{}
+	header.Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s",service="registry.docker.io"`, cr.realm))
+	return &http.Response{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized", Header: header, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func TestPullImageRejectsOversizedManifest(t *testing.T) {
+	registry := newFakeRegistry(t, "demo/app", &registryImageConfig{Os: "linux"})
+	registry.manifest = bytes.Repeat([]byte(" "), maxMetadataSize+1)
+
+	_, err := newImageTestRuntime(t).PullImage(registry.ref("demo/app:v1"), PullOptions{Insecure: true})
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("超过大小上限的清单应被拒绝，实际为%v", err)
+	}
+}
+
+func TestPullImageRejectsDigestMismatch(t *testing.T) {
+	base := gzipLayer(t, map[string]string{"a.txt": "base"})
+	app := gzipLayer(t, map[string]string{"b.txt": "app"})
+	registry := newFakeRegistry(t, "demo/app", &registryImageConfig{Os: "linux"}, base, app)
+	tampered := gzipLayer(t, map[string]string{"b.txt": "evil"})
+	registry.blobHandlers[sha256Digest(app)] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tampered)
+	}
+
+	cr := newImageTestRuntime(t)
+	if _, err := cr.PullImage(registry.ref("demo/app:v1"), PullOptions{Insecure: true}); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Fatalf("层内容与摘要不符时应拒绝，实际为%v", err)
+	}
+	if len(cr.images) != 0 || len(cr.storage.layers) != 0 {
+		t.Errorf("校验失败后不应登记镜像或层，实际镜像%d个、层%d个", len(cr.images), len(cr.storage.layers))
+	}
+
+	byDigest := registry.ref("demo/app@" + sha256Digest([]byte("other manifest")))
+	if _, err := cr.PullImage(byDigest, PullOptions{Insecure: true}); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("按摘要拉取时清单摘要不符应拒绝，实际为%v", err)
+	}
+}
+
+func TestPullImageCancelCleansUpPartialLayers(t *testing.T) {
+	cr := newImageTestRuntime(t)
+	first := gzipLayer(t, map[string]string{"a.txt": "first"})
+	second := gzipLayer(t, map[string]string{"b.txt": strings.Repeat("x", 64*1024)})
+	registry := newFakeRegistry(t, "demo/app", &registryImageConfig{Os: "linux"}, first, second)
+
+	// 第二层只发送一部分内容，然后挂起直到客户端断开
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry.blobHandlers[sha256Digest(second)] = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(second)))
+		w.Write(second[:len(second)/2])
+		w.(http.Flusher).Flush()
+		cancel()
+		<-r.Context().Done()
+	}
+
+	_, err := cr.PullImageContext(ctx, registry.ref("demo/app:v1"), PullOptions{Insecure: true})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("期望拉取因取消而失败，实际为%v", err)
+	}
+
+	if len(cr.images) != 0 || len(cr.storage.layers) != 0 {
+		t.Errorf("取消后不应登记镜像或层，实际镜像%d个、层%d个", len(cr.images), len(cr.storage.layers))
+	}
+	for _, dir := range []string{"tmp", filepath.Join("overlay2", "l")} {
+		entries, err := os.ReadDir(filepath.Join(cr.storage.graphRoot, dir))
+		if err != nil || len(entries) != 0 {
+			t.Errorf("%s目录应为空，实际为%v %v", dir, entries, err)
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Join(cr.storage.graphRoot, "overlay2"))
+	if len(entries) != 1 {
+		t.Errorf("期望只剩下l目录，实际为%v", entries)
+	}
+}
+
+func TestWaitContainerContextHonorsDeadline(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sleep", "10")
+	container.Process = &ContainerProcess{Exited: make(chan struct{})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := cr.WaitContainerContext(ctx, container.ID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望等待因超时返回，实际为%v", err)
+	}
+
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if _, err := cr.RunContainerContext(canceled, &ContainerConfig{Image: "missing"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("期望已取消的ctx直接返回，实际为%v", err)
+	}
+}
+
+// ==================
+// 12. 容器暂停与恢复
+// ==================
+
+// newPausableContainer 注册一个运行中的容器，其freezer cgroup指向临时目录
+func newPausableContainer(t *testing.T, cr *ContainerRuntime) (*Container, string) {
+	t.Helper()
+	container := addTestContainer(t, cr, "sleep", "10")
+	container.State.Status = StatusRunning
+	container.State.Running = true
+	freezerDir := t.TempDir()
+	container.Cgroups["freezer"] = &Cgroup{Subsystem: "freezer", Path: freezerDir}
+	return container, freezerDir
+}
+
+func TestPauseAndUnpauseContainer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows不支持freezer cgroup")
+	}
+
+	tests := []struct {
+		version      int
+		file         string
+		frozen, thaw string
+	}{
+		{1, "freezer.state", "FROZEN", "THAWED"},
+		{2, "cgroup.freeze", "1", "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("v%d", tt.version), func(t *testing.T) {
+			cr := newTestRuntime(t)
+			cr.cgroups.version = tt.version
+			container, freezerDir := newPausableContainer(t, cr)
+
+			events := make(chan EventType, 2)
+			for _, eventType := range []EventType{EventContainerPause, EventContainerUnpause} {
+				cr.eventBus.Subscribe(eventType, func(event *ContainerEvent) { events <- event.Type })
+			}
+			readFreezer := func() string {
+				data, err := os.ReadFile(filepath.Join(freezerDir, tt.file))
+				if err != nil {
+					t.Fatalf("读取%s失败: %v", tt.file, err)
+				}
+				return string(data)
+			}
+			waitEvent := func(expected EventType) {
+				select {
+				case got := <-events:
+					if got != expected {
+						t.Errorf("期望事件%s，实际为%s", expected, got)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("未收到事件%s", expected)
+				}
+			}
+
+			if err := cr.PauseContainer(container.ID); err != nil {
+				t.Fatalf("暂停失败: %v", err)
+			}
+			if state := container.Snapshot(); state.Status != StatusPaused || !state.Paused {
+				t.Errorf("期望状态为paused，实际为%s", state.Status)
+			}
+			if got := readFreezer(); got != tt.frozen {
+				t.Errorf("期望写入%s，实际为%s", tt.frozen, got)
+			}
+			waitEvent(EventContainerPause)
+
+			if err := cr.PauseContainer(container.ID); err == nil || !strings.Contains(err.Error(), "already paused") {
+				t.Errorf("重复暂停应返回错误，实际为%v", err)
+			}
+
+			if err := cr.UnpauseContainer(container.ID); err != nil {
+				t.Fatalf("恢复失败: %v", err)
+			}
+			if state := container.Snapshot(); state.Status != StatusRunning || state.Paused {
+				t.Errorf("期望状态为running，实际为%s", state.Status)
+			}
+			if got := readFreezer(); got != tt.thaw {
+				t.Errorf("期望写入%s，实际为%s", tt.thaw, got)
+			}
+			waitEvent(EventContainerUnpause)
+		})
+	}
+}
+
+func TestPauseRejectsNonRunningContainer(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sleep", "10")
+
+	if err := cr.PauseContainer(container.ID); err == nil || !strings.Contains(err.Error(), "created") {
+		t.Errorf("暂停未运行的容器应返回错误，实际为%v", err)
+	}
+	if err := cr.UnpauseContainer(container.ID); err == nil {
+		t.Error("恢复未暂停的容器应返回错误")
+	}
+}
+
+// ==================
+// 13. 停止信号与宽限期
+// ==================
+
+// startTrapContainer 启动一个捕获指定信号并以exitCode退出的容器，等待trap安装完成后返回
+func startTrapContainer(t *testing.T, cr *ContainerRuntime, trapSignal string, exitCode int) *Container {
+	t.Helper()
+	script := fmt.Sprintf("trap 'exit %d' %s; echo ready; while true; do sleep 0.05; done", exitCode, trapSignal)
+	container := addTestContainer(t, cr, "sh", "-c", script)
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if process, err := os.FindProcess(container.Process.Pid); err == nil && container.IsRunning() {
+			process.Kill()
+		}
+	})
+
+	// 标准输出由日志缓冲区接管，通过Follow日志等待就绪
+	logs, err := cr.Logs(container.ID, LogOptions{Follow: true})
+	if err != nil {
+		t.Fatalf("读取容器日志失败: %v", err)
+	}
+	defer logs.Close()
+	ready := make([]byte, len("ready\n"))
+	if _, err := io.ReadFull(logs, ready); err != nil {
+		t.Fatalf("等待容器就绪失败: %v", err)
+	}
+	return container
+}
+
+func TestStopContainerUsesConfiguredSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows不支持POSIX信号")
+	}
+
+	tests := []struct {
+		name       string
+		stopSignal string
+		trap       string
+		exitCode   int
+	}{
+		{"custom", "SIGINT", "INT", 42},
+		{"short name", "quit", "QUIT", 43},
+		{"default", "", "TERM", 44},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := newTestRuntime(t)
+			container := startTrapContainer(t, cr, tt.trap, tt.exitCode)
+			container.Config.StopSignal = tt.stopSignal
+			stopTimeout := 5
+			container.Config.StopTimeout = &stopTimeout
+
+			// timeout为0时使用容器配置的5秒宽限期，trap应在SIGKILL之前生效
+			if err := cr.StopContainer(container.ID, 0); err != nil {
+				t.Fatalf("停止容器失败: %v", err)
+			}
+			<-container.Process.Done
+			if container.Process.ExitCode != tt.exitCode {
+				t.Errorf("期望进程收到%s后以%d退出，实际退出码为%d", tt.trap, tt.exitCode, container.Process.ExitCode)
+			}
+		})
+	}
+}
+
+func TestStopContainerRejectsInvalidSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows不支持POSIX信号")
+	}
+
+	cr := newTestRuntime(t)
+	container := startTrapContainer(t, cr, "TERM", 0)
+	container.Config.StopSignal = "SIGBOGUS"
+
+	if err := cr.StopContainer(container.ID, time.Second); err == nil || !strings.Contains(err.Error(), "SIGBOGUS") {
+		t.Fatalf("期望拒绝无效的停止信号，实际为%v", err)
+	}
+	select {
+	case <-container.Process.Done:
+		t.Error("无效信号不应导致进程退出")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if !container.IsRunning() {
+		t.Error("无效信号不应改变容器状态")
+	}
+}
+
+// ==================
+// 14. 容器内执行命令
+// ==================
+
+func TestExecContainerCapturesOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows下没有sh")
+	}
+
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh")
+	container.State.Status = StatusRunning
+	container.State.Running = true
+	container.Config.Env = []string{"PATH=" + os.Getenv("PATH"), "GREETING=hello", "FOO=image"}
+	workDir := t.TempDir()
+
+	result, err := cr.ExecContainer(container.ID, []string{"sh", "-c", `echo "$GREETING $FOO"; pwd; echo oops >&2; exit 3`}, ExecOptions{
+		Env:        []string{"FOO=exec"},
+		WorkingDir: workDir,
+	})
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("期望退出码为3，实际为%d", result.ExitCode)
+	}
+	if expected := "hello exec\n" + workDir + "\n"; result.Stdout != expected {
+		t.Errorf("期望标准输出%q，实际为%q", expected, result.Stdout)
+	}
+	if result.Stderr != "oops\n" {
+		t.Errorf("期望标准错误%q，实际为%q", "oops\n", result.Stderr)
+	}
+
+	// Tty模式下标准错误并入标准输出
+	result, err = cr.ExecContainer(container.ID, []string{"sh", "-c", "echo out; echo err >&2"}, ExecOptions{Tty: true})
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	if result.Stdout != "out\nerr\n" || result.Stderr != "" {
+		t.Errorf("Tty模式输出不正确: stdout=%q stderr=%q", result.Stdout, result.Stderr)
+	}
+}
+
+func TestExecContainerRejectsInvalidRequests(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh")
+
+	if _, err := cr.ExecContainer(container.ID, []string{"sh", "-c", "true"}, ExecOptions{}); err == nil || !strings.Contains(err.Error(), "created") {
+		t.Errorf("期望拒绝在未运行的容器中执行，实际为%v", err)
+	}
+
+	container.State.Status = StatusRunning
+	container.State.Running = true
+	if _, err := cr.ExecContainer(container.ID, []string{"rm", "-rf", "/"}, ExecOptions{}); err == nil {
+		t.Error("期望拒绝不在白名单中的命令")
+	}
+	if _, err := cr.ExecContainer(container.ID, nil, ExecOptions{}); err == nil {
+		t.Error("期望拒绝空命令")
+	}
+}
+
+func TestExecContainerFailsWhenNamespaceCannotBeEntered(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows下没有sh")
+	}
+
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh")
+	container.State.Status = StatusRunning
+	container.State.Running = true
+	container.Config.Env = []string{"PATH=" + os.Getenv("PATH")}
+	container.Namespaces["net"] = &Namespace{Type: "net", Path: filepath.Join(t.TempDir(), "missing")}
+	marker := filepath.Join(t.TempDir(), "marker")
+
+	_, err := cr.ExecContainer(container.ID, []string{"sh", "-c", "touch " + marker}, ExecOptions{})
+	if err == nil || !strings.Contains(err.Error(), "net namespace") {
+		t.Fatalf("期望进入命名空间失败时返回错误，实际为%v", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("进入命名空间失败后命令不应在宿主机上执行")
+	}
+}
+
+func TestExecContainerEntersContainerNetworkNamespace(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("需要Linux下的root权限")
+	}
+	if _, err := exec.LookPath("unshare"); err != nil {
+		t.Skip("缺少unshare")
+	}
+
+	target := exec.Command("unshare", "--net", "sleep", "30")
+	if err := target.Start(); err != nil {
+		t.Fatalf("启动目标进程失败: %v", err)
+	}
+	defer func() {
+		_ = target.Process.Kill()
+		_ = target.Wait()
+	}()
+
+	// 等待unshare完成命名空间切换
+	nsPath := fmt.Sprintf("/proc/%d/ns/net", target.Process.Pid)
+	var expected string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		link, err := os.Readlink(nsPath)
+		host, hostErr := os.Readlink("/proc/self/ns/net")
+		if err == nil && hostErr == nil && link != host {
+			expected = link
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if expected == "" {
+		t.Fatal("目标进程未进入新的网络命名空间")
+	}
+
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh")
+	container.State.Status = StatusRunning
+	container.State.Running = true
+	container.Config.Env = []string{"PATH=" + os.Getenv("PATH")}
+	container.Namespaces["net"] = &Namespace{Type: "net", Path: nsPath}
+
+	result, err := cr.ExecContainer(container.ID, []string{"sh", "-c", "readlink /proc/self/ns/net"}, ExecOptions{})
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	if strings.TrimSpace(result.Stdout) != expected {
+		t.Errorf("期望命令运行在%s中，实际为%q", expected, result.Stdout)
+	}
+}
+
+// ==================
+// 15. IP地址分配
+// ==================
+
+func TestIPAddressManagerAllocateReleaseExhaust(t *testing.T) {
+	ipam := NewIPAddressManager()
+	if err := ipam.AddPool("10.0.0.0/29", "10.0.0.1"); err != nil {
+		t.Fatalf("登记地址池失败: %v", err)
+	}
+
+	// /29共8个地址，去掉网络地址、广播地址和网关后剩5个
+	var allocated []string
+	for i := 0; i < 5; i++ {
+		ip, err := ipam.AllocateIP("10.0.0.0/29")
+		if err != nil {
+			t.Fatalf("第%d次分配失败: %v", i+1, err)
+		}
+		allocated = append(allocated, ip)
+	}
+	expected := []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}
+	if strings.Join(allocated, ",") != strings.Join(expected, ",") {
+		t.Errorf("期望依次分配%v，实际为%v", expected, allocated)
+	}
+
+	if _, err := ipam.AllocateIP("10.0.0.0/29"); err == nil || !strings.Contains(err.Error(), "exhausted") {
+		t.Fatalf("期望地址池耗尽错误，实际为%v", err)
+	}
+
+	if err := ipam.ReleaseIP("10.0.0.0/29", "10.0.0.4"); err != nil {
+		t.Fatalf("释放地址失败: %v", err)
+	}
+	if ip, err := ipam.AllocateIP("10.0.0.0/29"); err != nil || ip != "10.0.0.4" {
+		t.Errorf("期望重新分配释放的10.0.0.4，实际为%s %v", ip, err)
+	}
+
+	if err := ipam.ReleaseIP("10.0.0.0/29", "10.0.0.7"); err == nil {
+		t.Error("释放未分配的地址应返回错误")
+	}
+	if _, err := ipam.AllocateIP("192.168.0.0/24"); err == nil {
+		t.Error("未登记的子网应返回错误")
+	}
+	if err := ipam.AddPool("10.0.0.0/29", ""); err == nil {
+		t.Error("重复登记地址池应返回错误")
+	}
+}
+
+// ==================
+// 16. 容器健康检查
+// ==================
+
+// newHealthcheckContainer 创建一个运行中的容器，其健康检查在前failures次执行时失败
+func newHealthcheckContainer(t *testing.T, cr *ContainerRuntime, failures int, config HealthConfig) *Container {
+	t.Helper()
+	container := addTestContainer(t, cr, "sh")
+	container.State.Status = StatusRunning
+	container.State.Running = true
+	container.State.StartedAt = time.Now()
+	container.State.Health = &Health{Status: HealthStarting}
+	container.Config.Env = []string{"PATH=" + os.Getenv("PATH")}
+
+	counter := filepath.Join(t.TempDir(), "count")
+	config.Test = []string{"CMD-SHELL", fmt.Sprintf(
+		`n=$(cat %q 2>/dev/null || echo 0); n=$((n+1)); echo $n > %q; echo "probe $n"; [ $n -gt %d ]`,
+		counter, counter, failures)}
+	container.Config.Healthcheck = &config
+	return container
+}
+
+func TestHealthcheckFailingStreakAndTransitions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows下没有sh")
+	}
+
+	cr := newTestRuntime(t)
+	container := newHealthcheckContainer(t, cr, 6, HealthConfig{Retries: 3, Timeout: 10 * time.Second})
+
+	// 前6次失败、Retries为3时每次检查后期望的健康状态
+	expected := []struct {
+		status string
+		streak int
+	}{
+		{HealthStarting, 1},
+		{HealthStarting, 2},
+		{HealthUnhealthy, 3},
+		{HealthUnhealthy, 4},
+		{HealthUnhealthy, 5},
+		{HealthUnhealthy, 6},
+		{HealthHealthy, 0},
+	}
+
+	events := make(chan *ContainerEvent, len(expected))
+	cr.eventBus.Subscribe(EventContainerUnhealthy, func(event *ContainerEvent) { events <- event })
+
+	for i, want := range expected {
+		cr.runHealthcheck(container)
+		health := container.Snapshot().Health
+		if health.Status != want.status || health.FailingStreak != want.streak {
+			t.Fatalf("第%d次检查后期望状态%s、连续失败%d次，实际为%s、%d次",
+				i+1, want.status, want.streak, health.Status, health.FailingStreak)
+		}
+	}
+
+	select {
+	case event := <-events:
+		if event.Container != container || event.Message != "probe 3" {
+			t.Errorf("unhealthy事件内容不正确: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("未收到unhealthy事件")
+	}
+	select {
+	case <-events:
+		t.Error("期望只在转为unhealthy时发布一次事件")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	health := container.Snapshot().Health
+	if len(health.Log) != maxHealthLogEntries {
+		t.Fatalf("期望保留最近%d条检查记录，实际为%d条", maxHealthLogEntries, len(health.Log))
+	}
+	last := health.Log[len(health.Log)-1]
+	if last.ExitCode != 0 || last.Output != "probe 7\n" {
+		t.Errorf("最后一条记录不正确: %+v", last)
+	}
+}
+
+func TestHealthcheckIgnoresFailuresDuringStartPeriod(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows下没有sh")
+	}
+
+	cr := newTestRuntime(t)
+	container := newHealthcheckContainer(t, cr, 2, HealthConfig{Retries: 1, StartPeriod: time.Hour})
+
+	// 启动期内的失败不计数
+	for i := 0; i < 2; i++ {
+		cr.runHealthcheck(container)
+		if health := container.Snapshot().Health; health.Status != HealthStarting || health.FailingStreak != 0 {
+			t.Fatalf("启动期内的失败不应计数，实际为%s、%d次", health.Status, health.FailingStreak)
+		}
+	}
+	cr.runHealthcheck(container)
+	if status := container.Snapshot().Health.Status; status != HealthHealthy {
+		t.Fatalf("期望检查成功后为healthy，实际为%s", status)
+	}
+
+	// 一旦健康过，启动期内的失败也要计数
+	cr.recordHealthcheck(container, HealthcheckResult{Start: time.Now(), End: time.Now(), ExitCode: 1})
+	if health := container.Snapshot().Health; health.Status != HealthUnhealthy || health.FailingStreak != 1 {
+		t.Errorf("期望转为unhealthy，实际为%s、%d次", health.Status, health.FailingStreak)
+	}
+}
+
+func TestHealthcheckCommandForms(t *testing.T) {
+	tests := []struct {
+		test     []string
+		expected []string
+	}{
+		{[]string{"CMD", "curl", "-f", "http://localhost"}, []string{"curl", "-f", "http://localhost"}},
+		{[]string{"CMD-SHELL", "exit 0"}, []string{"sh", "-c", "exit 0"}},
+		{[]string{"pg_isready"}, []string{"pg_isready"}},
+	}
+	for _, tt := range tests {
+		cmd, err := healthcheckCommand(tt.test)
+		if err != nil || strings.Join(cmd, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("healthcheckCommand(%q) = %q, %v，期望%q", tt.test, cmd, err, tt.expected)
+		}
+	}
+	if _, err := healthcheckCommand([]string{"CMD"}); err == nil {
+		t.Error("CMD缺少命令时应返回错误")
+	}
+	if healthcheckEnabled(&HealthConfig{Test: []string{"NONE"}}) {
+		t.Error("Test为NONE时应禁用健康检查")
+	}
+}
+
+// ==================
+// 17. 容器日志
+// ==================
+
+func TestLogsTailAndSince(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows下没有sh")
+	}
+
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "for i in 1 2 3 4 5; do echo line$i; done; echo oops >&2")
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+	if _, err := cr.WaitContainer(container.ID); err != nil {
+		t.Fatalf("等待容器失败: %v", err)
+	}
+
+	readLogs := func(opts LogOptions) string {
+		t.Helper()
+		logs, err := cr.Logs(container.ID, opts)
+		if err != nil {
+			t.Fatalf("读取容器日志失败: %v", err)
+		}
+		defer logs.Close()
+		data, err := io.ReadAll(logs)
+		if err != nil {
+			t.Fatalf("读取容器日志失败: %v", err)
+		}
+		return string(data)
+	}
+
+	all := readLogs(LogOptions{})
+	for i := 1; i <= 5; i++ {
+		if !strings.Contains(all, fmt.Sprintf("line%d\n", i)) {
+			t.Errorf("日志中缺少line%d: %q", i, all)
+		}
+	}
+	if !strings.Contains(all, "oops\n") {
+		t.Errorf("日志中缺少标准错误输出: %q", all)
+	}
+	if strings.Count(all, "\n") != 6 {
+		t.Errorf("期望6行日志，实际为%q", all)
+	}
+
+	if tail := readLogs(LogOptions{Tail: 1}); tail != "line5\n" && tail != "oops\n" {
+		t.Errorf("Tail为1时期望只有最后一行，实际为%q", tail)
+	}
+	if tail := readLogs(LogOptions{Tail: 2}); strings.Count(tail, "\n") != 2 || !strings.HasSuffix(all, tail) {
+		t.Errorf("Tail为2时期望最后两行，实际为%q", tail)
+	}
+	if since := readLogs(LogOptions{Since: time.Now()}); since != "" {
+		t.Errorf("Since晚于全部日志时期望为空，实际为%q", since)
+	}
+	if stamped := readLogs(LogOptions{Tail: 1, Timestamps: true}); !strings.Contains(stamped, "Z ") {
+		t.Errorf("期望带时间戳的日志，实际为%q", stamped)
+	}
+
+	// 日志以带时间戳的JSON行持久化在容器根目录下
+	data, err := os.ReadFile(filepath.Join(cr.config.RootDirectory, "containers", container.ID, containerLogFile))
+	if err != nil {
+		t.Fatalf("读取日志文件失败: %v", err)
+	}
+	var entry logEntry
+	if err := json.Unmarshal(bytes.SplitN(data, []byte("\n"), 2)[0], &entry); err != nil {
+		t.Fatalf("解析日志文件失败: %v", err)
+	}
+	if entry.Stream == "" || entry.Time.IsZero() {
+		t.Errorf("日志记录缺少流或时间戳: %+v", entry)
+	}
+
+	if _, err := cr.Logs(container.ID, LogOptions{Tail: -1}); err == nil {
+		t.Error("Tail为负数时应返回错误")
+	}
+	if _, err := cr.Logs("missing", LogOptions{}); err == nil {
+		t.Error("不存在的容器应返回错误")
+	}
+}
+
+func TestLogsFollowEndsWhenContainerExits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows下没有sh")
+	}
+
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "echo first; read line; echo second")
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+
+	logs, err := cr.Logs(container.ID, LogOptions{Follow: true})
+	if err != nil {
+		t.Fatalf("读取容器日志失败: %v", err)
+	}
+	defer logs.Close()
+
+	first := make([]byte, len("first\n"))
+	if _, err := io.ReadFull(logs, first); err != nil || string(first) != "first\n" {
+		t.Fatalf("期望读到first，实际为%q %v", first, err)
+	}
+
+	// 容器继续输出后退出，Follow读取应收到新日志并在容器退出后结束
+	if _, err := io.WriteString(container.Process.Stdin, "go\n"); err != nil {
+		t.Fatalf("写入标准输入失败: %v", err)
+	}
+	rest := make(chan string, 1)
+	go func() {
+		data, _ := io.ReadAll(logs)
+		rest <- string(data)
+	}()
+	select {
+	case data := <-rest:
+		if data != "second\n" {
+			t.Errorf("期望Follow读到second，实际为%q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("容器退出后Follow读取未结束")
+	}
+}
+
+func TestProcessOutputSubscriptions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows下没有sh")
+	}
+
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "read line; echo out; echo err >&2; echo done")
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+	process := container.Process
+
+	// 多个订阅方各自收到完整的输出，且不影响运行时写入日志
+	var readers []io.ReadCloser
+	for _, subscribe := range []func() (io.ReadCloser, error){process.Stdout, process.Stdout, process.Stderr} {
+		reader, err := subscribe()
+		if err != nil {
+			t.Fatalf("订阅进程输出失败: %v", err)
+		}
+		defer reader.Close()
+		readers = append(readers, reader)
+	}
+
+	if _, err := io.WriteString(process.Stdin, "go\n"); err != nil {
+		t.Fatalf("写入标准输入失败: %v", err)
+	}
+	outputs := make(chan []string, 1)
+	go func() {
+		var data []string
+		for _, reader := range readers {
+			content, _ := io.ReadAll(reader)
+			data = append(data, string(content))
+		}
+		outputs <- data
+	}()
+
+	select {
+	case data := <-outputs:
+		if data[0] != "out\ndone\n" || data[1] != data[0] {
+			t.Errorf("期望两个标准输出订阅方都读到out和done，实际为%q", data[:2])
+		}
+		if data[2] != "err\n" {
+			t.Errorf("期望标准错误订阅方读到err，实际为%q", data[2])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("进程退出后订阅未结束")
+	}
+
+	logs, err := cr.Logs(container.ID, LogOptions{})
+	if err != nil {
+		t.Fatalf("读取容器日志失败: %v", err)
+	}
+	defer logs.Close()
+	if data, _ := io.ReadAll(logs); strings.Count(string(data), "\n") != 3 {
+		t.Errorf("期望日志包含全部3行输出，实际为%q", data)
+	}
+
+	// 进程退出后订阅立即结束
+	reader, err := process.Stdout()
+	if err != nil {
+		t.Fatalf("订阅进程输出失败: %v", err)
+	}
+	defer reader.Close()
+	if data, err := io.ReadAll(reader); err != nil || len(data) != 0 {
+		t.Errorf("进程退出后期望订阅为空，实际为%q %v", data, err)
+	}
+}
+
+// ==================
+// 18. 桥接网络加入容器命名空间
+// ==================
+
+// fakeRuntimeLookup 返回固定PID或错误的RuntimeLookup
+type fakeRuntimeLookup struct {
+	pid int
+	err error
+}
+
+func (f *fakeRuntimeLookup) ContainerPid(containerID string) (int, error) {
+	return f.pid, f.err
+}
+
+func TestBridgeJoinResolvesContainerPid(t *testing.T) {
+	bd := &BridgeDriver{bridges: map[string]*NetworkBridge{
+		"net-a": {Name: "br-test", Subnet: "10.9.0.0/24", Gateway: "10.9.0.1"},
+	}}
+	containerID := fmt.Sprintf("%064d", 7)
+
+	if err := bd.Join("net-a", containerID); err == nil || !strings.Contains(err.Error(), "endpoint not found") {
+		t.Errorf("期望端点不存在错误，实际为%v", err)
+	}
+
+	if _, err := bd.allocateVethNames("net-a", containerID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := bd.Join("net-a", containerID); err == nil || !strings.Contains(err.Error(), "runtime lookup") {
+		t.Errorf("期望缺少RuntimeLookup错误，实际为%v", err)
+	}
+
+	lookupErr := errors.New("container is not running")
+	bd.runtime = &fakeRuntimeLookup{err: lookupErr}
+	if err := bd.Join("net-a", containerID); !errors.Is(err, lookupErr) {
+		t.Errorf("期望返回RuntimeLookup的错误，实际为%v", err)
+	}
+
+	// 运行时创建时把自身注册为桥接驱动的RuntimeLookup
+	cr := newTestRuntime(t)
+	bridge := cr.network.drivers["bridge"].(*BridgeDriver)
+	if bridge.runtime != RuntimeLookup(cr) {
+		t.Error("期望桥接驱动使用容器运行时查询PID")
+	}
+	container := addTestContainer(t, cr, "sh")
+	if _, err := cr.ContainerPid(container.ID); err == nil {
+		t.Error("未运行的容器不应返回PID")
+	}
+}
+
+func TestBridgeJoinMovesVethIntoNamespace(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("需要Linux root权限")
+	}
+	for _, tool := range []string{"ip", "nsenter", "unshare"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("缺少%s命令", tool)
+		}
+	}
+
+	// 用独立网络命名空间中的进程模拟容器
+	holder := exec.Command("unshare", "--net", "sleep", "30")
+	if err := holder.Start(); err != nil {
+		t.Skipf("无法创建网络命名空间: %v", err)
+	}
+	defer func() {
+		holder.Process.Kill()
+		holder.Wait()
+	}()
+
+	ipam := NewIPAddressManager()
+	bd := &BridgeDriver{ipam: ipam, runtime: &fakeRuntimeLookup{pid: holder.Process.Pid}}
+	network, err := bd.CreateNetwork(&NetworkConfig{
+		Name: "join-test",
+		IPAM: &NetworkIPAM{Config: []IPAMConfig{{Subnet: "10.213.7.0/24", Gateway: "10.213.7.1"}}},
+	})
+	if err != nil {
+		t.Skipf("无法创建网桥: %v", err)
+	}
+	defer bd.DeleteNetwork(network.ID)
+
+	containerID := fmt.Sprintf("%064d", 8)
+	endpoint, err := bd.CreateEndpoint(network.ID, containerID, "")
+	if err != nil {
+		t.Fatalf("创建端点失败: %v", err)
+	}
+	defer bd.DeleteEndpoint(network.ID, containerID)
+
+	if err := bd.Join(network.ID, containerID); err != nil {
+		t.Fatalf("加入网络失败: %v", err)
+	}
+
+	nsPath := fmt.Sprintf("/proc/%d/ns/net", holder.Process.Pid)
+	output, err := exec.Command("nsenter", "--net="+nsPath, "ip", "addr", "show", "dev", "eth0").CombinedOutput()
+	if err != nil {
+		t.Fatalf("容器命名空间中没有eth0: %v: %s", err, output)
+	}
+	if !strings.Contains(string(output), endpoint.IPAddress+"/24") || !strings.Contains(string(output), "UP") {
+		t.Errorf("eth0未配置地址或未启用: %s", output)
+	}
+	routes, err := exec.Command("nsenter", "--net="+nsPath, "ip", "route").CombinedOutput()
+	if err != nil || !strings.Contains(string(routes), "default via 10.213.7.1") {
+		t.Errorf("期望默认路由经由网关，实际为%s %v", routes, err)
+	}
+}
+
+func TestBridgeJoinRefusesHostNetworkNamespace(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("网络命名空间仅Linux支持")
+	}
+
+	bd := &BridgeDriver{
+		bridges: map[string]*NetworkBridge{"net-a": {Name: "br-test", Subnet: "10.9.0.0/24", Gateway: "10.9.0.1"}},
+		runtime: &fakeRuntimeLookup{pid: os.Getpid()},
+	}
+	containerID := fmt.Sprintf("%064d", 9)
+	if _, err := bd.allocateVethNames("net-a", containerID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// 与主机共享网络命名空间的进程不能被配置，否则地址和默认路由会落到主机上
+	if err := bd.Join("net-a", containerID); err == nil || !strings.Contains(err.Error(), "host network namespace") {
+		t.Errorf("期望拒绝共享主机网络命名空间的容器，实际为%v", err)
+	}
+}
+
+func TestBridgeJoinRemovesVethWhenConfigurationFails(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("需要Linux root权限")
+	}
+	for _, tool := range []string{"ip", "nsenter", "unshare"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("缺少%s命令", tool)
+		}
+	}
+
+	holder := exec.Command("unshare", "--net", "sleep", "30")
+	if err := holder.Start(); err != nil {
+		t.Skipf("无法创建网络命名空间: %v", err)
+	}
+	defer func() {
+		holder.Process.Kill()
+		holder.Wait()
+	}()
+
+	bd := &BridgeDriver{ipam: NewIPAddressManager(), runtime: &fakeRuntimeLookup{pid: holder.Process.Pid}}
+	network, err := bd.CreateNetwork(&NetworkConfig{
+		Name: "rollback-test",
+		IPAM: &NetworkIPAM{Config: []IPAMConfig{{Subnet: "10.213.9.0/24", Gateway: "10.213.9.1"}}},
+	})
+	if err != nil {
+		t.Skipf("无法创建网桥: %v", err)
+	}
+	defer bd.DeleteNetwork(network.ID)
+
+	containerID := fmt.Sprintf("%064d", 10)
+	if _, err := bd.CreateEndpoint(network.ID, containerID, ""); err != nil {
+		t.Fatalf("创建端点失败: %v", err)
+	}
+	bd.mutex.Lock()
+	hostVeth := bd.endpoints[endpointKey(network.ID, containerID)].hostVeth
+	// 网关不在子网内，添加默认路由这一步会失败
+	bd.bridges[network.ID].Gateway = "10.213.10.1"
+	bd.mutex.Unlock()
+
+	if err := bd.Join(network.ID, containerID); err == nil {
+		t.Fatal("期望默认路由配置失败")
+	}
+	if hostInterfaceExists(hostVeth) {
+		t.Errorf("配置失败后期望删除主机端veth %s", hostVeth)
+	}
+	nsPath := fmt.Sprintf("/proc/%d/ns/net", holder.Process.Pid)
+	if output, err := exec.Command("nsenter", "--net="+nsPath, "ip", "link", "show", "dev", "eth0").CombinedOutput(); err == nil {
+		t.Errorf("配置失败后容器命名空间中不应残留eth0: %s", output)
+	}
+	if err := bd.DeleteEndpoint(network.ID, containerID); err != nil {
+		t.Errorf("回滚后删除端点失败: %v", err)
+	}
+}
+
+// ==================
+// 19. tmpfs挂载
+// ==================
+
+func TestParseTmpfsOptions(t *testing.T) {
+	tests := []struct {
+		options  string
+		expected string
+	}{
+		{"", "noexec,nosuid,nodev"},
+		{"size=64m,mode=1777", "noexec,nosuid,nodev,size=64m,mode=1777"},
+		{"exec, size=10%", "exec,nosuid,nodev,size=10%"},
+		{"ro,uid=1000,gid=1000,nr_inodes=4k", "ro,noexec,nosuid,nodev,uid=1000,gid=1000,nr_inodes=4k"},
+	}
+	for _, tt := range tests {
+		options, err := parseTmpfsOptions(tt.options)
+		if err != nil || options != tt.expected {
+			t.Errorf("parseTmpfsOptions(%q) = %q, %v，期望%q", tt.options, options, err, tt.expected)
+		}
+	}
+
+	for _, invalid := range []string{"size=abc", "size=1x", "nr_blocks=5%", "mode=8888", "mode=17777", "uid=-1", "foo", "bar=1", "exec,noexec", "size=1m,size=2m"} {
+		if _, err := parseTmpfsOptions(invalid); err == nil {
+			t.Errorf("期望拒绝非法选项%q", invalid)
+		}
+	}
+}
+
+func TestTmpfsMountsValidateTargets(t *testing.T) {
+	rootfs := t.TempDir()
+	mounts, err := tmpfsMounts(rootfs, map[string]string{"/tmp": "size=64m", "/run/lock/": ""})
+	if err != nil {
+		t.Fatalf("生成tmpfs挂载项失败: %v", err)
+	}
+	if len(mounts) != 2 {
+		t.Fatalf("期望2个挂载项，实际为%d", len(mounts))
+	}
+	expected := []*Mount{
+		{Source: "tmpfs", Target: filepath.Join(rootfs, "run", "lock"), Type: "tmpfs", Options: "noexec,nosuid,nodev", Propagation: "private"},
+		{Source: "tmpfs", Target: filepath.Join(rootfs, "tmp"), Type: "tmpfs", Options: "noexec,nosuid,nodev,size=64m", Propagation: "private"},
+	}
+	for i, mount := range mounts {
+		if *mount != *expected[i] {
+			t.Errorf("第%d个挂载项期望%+v，实际为%+v", i+1, *expected[i], *mount)
+		}
+	}
+
+	for _, target := range []string{"tmp", "/", "/../etc", "/tmp/../../etc", ""} {
+		if _, err := tmpfsMounts(rootfs, map[string]string{target: ""}); err == nil {
+			t.Errorf("期望拒绝非法挂载路径%q", target)
+		}
+	}
+
+	// 镜像中的符号链接按容器根解析，挂载点不会落到宿主机路径上
+	host := t.TempDir()
+	if err := os.Symlink(host, filepath.Join(rootfs, "cache")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../../..", filepath.Join(rootfs, "up")); err != nil {
+		t.Fatal(err)
+	}
+	mounts, err = tmpfsMounts(rootfs, map[string]string{"/cache": "", "/up/data": ""})
+	if err != nil {
+		t.Fatalf("生成tmpfs挂载项失败: %v", err)
+	}
+	want := []string{filepath.Join(rootfs, filepath.FromSlash(host)), filepath.Join(rootfs, "data")}
+	for i, mount := range mounts {
+		if mount.Target != want[i] {
+			t.Errorf("符号链接目标应在容器根内解析为%s，实际为%s", want[i], mount.Target)
+		}
+	}
+}
+
+func TestCreateContainerMountsAndCleansUpTmpfs(t *testing.T) {
+	var mounted, unmounted []string
+	originalMount, originalUnmount := mountTmpfs, unmountTmpfs
+	mountTmpfs = func(mount *Mount) error {
+		mounted = append(mounted, mount.Target)
+		return nil
+	}
+	unmountTmpfs = func(target string) error {
+		unmounted = append(unmounted, target)
+		return nil
+	}
+	defer func() { mountTmpfs, unmountTmpfs = originalMount, originalUnmount }()
+
+	cr := newBuildTestRuntime(t)
+	container, err := cr.CreateContainer(&ContainerConfig{
+		Image: "base",
+		Tmpfs: map[string]string{"/tmp": "size=64m,mode=1777", "/tmp/cache": ""},
+	})
+	if err != nil {
+		t.Fatalf("创建容器失败: %v", err)
+	}
+
+	rootfs := cr.containerRootfs(container)
+	tmpfsTargets := []string{filepath.Join(rootfs, "tmp"), filepath.Join(rootfs, "tmp", "cache")}
+	if strings.Join(mounted, ",") != strings.Join(tmpfsTargets, ",") {
+		t.Errorf("期望先挂载父目录，实际顺序为%v", mounted)
+	}
+	var recorded []string
+	for _, mount := range container.Mounts {
+		if mount.Type == "tmpfs" {
+			recorded = append(recorded, mount.Target)
+		}
+	}
+	if len(recorded) != 2 {
+		t.Errorf("期望容器记录2个tmpfs挂载，实际为%v", recorded)
+	}
+
+	if err := cr.RemoveContainer(container.ID, true); err != nil {
+		t.Fatalf("删除容器失败: %v", err)
+	}
+	if len(unmounted) != 2 || unmounted[0] != tmpfsTargets[1] || unmounted[1] != tmpfsTargets[0] {
+		t.Errorf("期望按相反顺序卸载tmpfs，实际为%v", unmounted)
+	}
+
+	// 挂载失败时卸载已挂载的部分
+	mounted, unmounted = nil, nil
+	mountTmpfs = func(mount *Mount) error {
+		if len(mounted) == 1 {
+			return errors.New("mount failed")
+		}
+		mounted = append(mounted, mount.Target)
+		return nil
+	}
+	if _, err := cr.CreateContainer(&ContainerConfig{
+		Image: "base",
+		Tmpfs: map[string]string{"/a": "", "/b": ""},
+	}); err == nil {
+		t.Fatal("期望挂载失败时创建容器失败")
+	}
+	if len(unmounted) != 1 || unmounted[0] != mounted[0] {
+		t.Errorf("期望卸载已挂载的%v，实际为%v", mounted, unmounted)
+	}
+}
+
+// ==================
+// 20. 只读根文件系统
+// ==================
+
+func TestReadOnlyRootFilesystemMountOptions(t *testing.T) {
+	mounted, _ := stubVolumeMounts(t)
+
+	cr := newBuildTestRuntime(t)
+	cr.images["base"].Config.Cmd = []string{"sh", "-c", "echo started"}
+	readOnly := true
+	container, err := cr.CreateContainer(&ContainerConfig{
+		Image:           "base",
+		Tmpfs:           map[string]string{"/tmp": "size=16m"},
+		SecurityContext: &SecurityContext{ReadOnlyRootFilesystem: &readOnly},
+	})
+	if err != nil {
+		t.Fatalf("创建容器失败: %v", err)
+	}
+	defer cr.RemoveContainer(container.ID, true)
+
+	if len(container.Mounts) != 2 {
+		t.Fatalf("期望根文件系统和tmpfs两个挂载，实际为%d", len(container.Mounts))
+	}
+	rootfs, tmpfs := container.Mounts[0], container.Mounts[1]
+	if rootfs.Type != "bind" || rootfs.Options != "bind,ro" || rootfs.Target != cr.containerRootfs(container) {
+		t.Errorf("期望只读绑定挂载到合并挂载点，实际为%s %q -> %s", rootfs.Type, rootfs.Options, rootfs.Target)
+	}
+	if want := []string{rootfs.Target, tmpfs.Target}; !reflect.DeepEqual(*mounted, want) {
+		t.Errorf("期望先执行只读挂载再挂载tmpfs，期望%v，实际为%v", want, *mounted)
+	}
+	if info, err := os.Stat(filepath.Join(rootfs.Source, "tmp")); err != nil || !info.IsDir() {
+		t.Errorf("只读挂载前应在镜像层副本中创建tmpfs挂载点: %v", err)
+	}
+	if tmpfs.Type != "tmpfs" || strings.Contains(","+tmpfs.Options+",", ",ro,") {
+		t.Errorf("期望/tmp保持可写，实际为%s %q", tmpfs.Type, tmpfs.Options)
+	}
+
+	// 只读由内核在写入时强制，启动阶段不做检查
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动只读容器失败: %v", err)
+	}
+	if _, err := cr.WaitContainer(container.ID); err != nil {
+		t.Fatalf("等待容器失败: %v", err)
+	}
+
+	writable, err := cr.CreateContainer(&ContainerConfig{Image: "base"})
+	if err != nil {
+		t.Fatalf("创建容器失败: %v", err)
+	}
+	defer cr.RemoveContainer(writable.ID, true)
+	if options := writable.Mounts[0].Options; strings.Contains(options, "ro") || !strings.Contains(options, "upperdir=") {
+		t.Errorf("默认应挂载可写的根文件系统，实际为%q", options)
+	}
+}
+
+func TestReadOnlyRootFilesystemFailsClosed(t *testing.T) {
+	stubVolumeMounts(t)
+	mountBind = func(mount *Mount) error { return errors.New("mount not permitted") }
+
+	cr := newBuildTestRuntime(t)
+	readOnly := true
+	_, err := cr.CreateContainer(&ContainerConfig{
+		Image:           "base",
+		Cmd:             []string{"sh", "-c", "true"},
+		SecurityContext: &SecurityContext{ReadOnlyRootFilesystem: &readOnly},
+	})
+	if err == nil || !strings.Contains(err.Error(), "read-only root filesystem") {
+		t.Fatalf("无法只读挂载时应拒绝创建容器，实际为%v", err)
+	}
+	if len(cr.ListContainers()) != 0 {
+		t.Error("创建失败的容器不应被登记")
+	}
+}
+
+func TestReadOnlyRootFilesystemIsEnforced(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("需要Linux和root权限执行真实挂载")
+	}
+	cr := newBuildTestRuntime(t)
+	readOnly := true
+	container, err := cr.CreateContainer(&ContainerConfig{
+		Image:           "base",
+		Cmd:             []string{"sh", "-c", "true"},
+		Tmpfs:           map[string]string{"/tmp": "size=1m"},
+		SecurityContext: &SecurityContext{ReadOnlyRootFilesystem: &readOnly},
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "operation not permitted") {
+			t.Skipf("当前环境不允许挂载: %v", err)
+		}
+		t.Fatalf("创建容器失败: %v", err)
+	}
+	defer cr.RemoveContainer(container.ID, true)
+
+	rootfs := cr.containerRootfs(container)
+	if err := os.WriteFile(filepath.Join(rootfs, "written"), []byte("x"), 0644); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("只读根文件系统应拒绝写入，实际为%v", err)
+	}
+	if err := os.WriteFile(filepath.Join(rootfs, "tmp", "scratch"), []byte("x"), 0644); err != nil {
+		t.Errorf("tmpfs挂载的/tmp应保持可写: %v", err)
+	}
+}
+
+// ==================
+// 21. Deployment滚动更新
+// ==================
+
+// webTemplate 返回以version区分修订版本的Pod模板
+func webTemplate(version string) *PodTemplate {
+	return &PodTemplate{Spec: PodTemplateSpec{Containers: []ContainerSpec{
+		{Name: "web", Image: "base", Command: []string{"sh", "-c", "sleep 30"}, Env: []string{"VERSION=" + version}},
+	}}}
+}
+
+// newTestDeployment 直接登记一个Deployment，由测试同步驱动reconcileDeployment
+func newTestDeployment(t *testing.T, co *ContainerOrchestrator, replicas int32, strategy DeploymentStrategy) *Deployment {
+	t.Helper()
+	deployment := &Deployment{
+		ID:        generateDeploymentID(),
+		Name:      "web",
+		Namespace: "default",
+		Replicas:  replicas,
+		Selector:  map[string]string{"app": "web"},
+		Template:  webTemplate("v1"),
+		Strategy:  strategy,
+		Status:    DeploymentProgressing,
+		CreatedAt: time.Now(),
+	}
+	co.mutex.Lock()
+	co.deployments[deployment.ID] = deployment
+	co.mutex.Unlock()
+	return deployment
+}
+
+// markPodsReady 模拟全部Pod通过就绪检查
+func markPodsReady(co *ContainerOrchestrator) {
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
+	for _, pod := range co.pods {
+		pod.Status = PodRunning
+	}
+}
+
+func TestDeploymentRollingUpdateRespectsSurgeAndUnavailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy DeploymentStrategy
+		// 每一步调和后新旧Pod的数量
+		steps [][2]int
+	}{
+		{"surge1-unavailable1", DeploymentStrategy{Type: "RollingUpdate", MaxSurge: 1, MaxUnavailable: 1}, [][2]int{{2, 2}, {3, 0}}},
+		{"surge1-unavailable0", DeploymentStrategy{Type: "RollingUpdate", MaxSurge: 1}, [][2]int{{1, 3}, {2, 2}, {3, 1}, {3, 0}}},
+		{"surge0-unavailable2", DeploymentStrategy{Type: "RollingUpdate", MaxUnavailable: 2}, [][2]int{{2, 1}, {3, 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			co := NewContainerOrchestrator(newBuildTestRuntime(t))
+			deployment := newTestDeployment(t, co, 3, tt.strategy)
+
+			// 初始创建全部副本
+			co.reconcileDeployment(deployment)
+			markPodsReady(co)
+			co.reconcileDeployment(deployment)
+			if deployment.Status != DeploymentAvailable {
+				t.Fatalf("初始副本就绪后期望为Available，实际为%s", deployment.Status)
+			}
+			oldHash := templateHash(deployment.Template)
+
+			if err := co.UpdateDeployment(deployment.ID, webTemplate("v2")); err != nil {
+				t.Fatalf("更新Deployment失败: %v", err)
+			}
+			if deployment.Status != DeploymentProgressing {
+				t.Errorf("更新模板后期望为Progressing，实际为%s", deployment.Status)
+			}
+			newHash := templateHash(deployment.Template)
+			if newHash == oldHash {
+				t.Fatal("模板变更后修订版本哈希应改变")
+			}
+
+			maxSurge, maxUnavailable := tt.strategy.rollingUpdateBounds()
+			for i, expected := range tt.steps {
+				co.reconcileDeployment(deployment)
+
+				newPods, oldPods := co.deploymentPods(deployment, newHash)
+				if len(newPods) != expected[0] || len(oldPods) != expected[1] {
+					t.Fatalf("第%d步期望新Pod %d个、旧Pod %d个，实际为%d、%d", i+1, expected[0], expected[1], len(newPods), len(oldPods))
+				}
+				if total := int32(len(newPods) + len(oldPods)); total > deployment.Replicas+maxSurge {
+					t.Errorf("第%d步Pod总数%d超过Replicas+maxSurge", i+1, total)
+				}
+				if available := countAvailablePods(newPods) + countAvailablePods(oldPods); available < deployment.Replicas-maxUnavailable {
+					t.Errorf("第%d步可用Pod数%d低于Replicas-maxUnavailable", i+1, available)
+				}
+				for _, pod := range oldPods {
+					if pod.Labels[podTemplateHashLabel] != oldHash {
+						t.Errorf("旧Pod标签的修订版本不正确: %v", pod.Labels)
+					}
+				}
+				if i < len(tt.steps)-1 && deployment.Status != DeploymentProgressing {
+					t.Errorf("第%d步期望为Progressing，实际为%s", i+1, deployment.Status)
+				}
+				markPodsReady(co)
+			}
+
+			co.reconcileDeployment(deployment)
+			if deployment.Status != DeploymentAvailable {
+				t.Errorf("滚动更新完成后期望为Available，实际为%s", deployment.Status)
+			}
+			if len(co.pods) != 3 {
+				t.Errorf("滚动更新完成后期望3个Pod，实际为%d", len(co.pods))
+			}
+		})
+	}
+}
+
+// ==================
+// 22. Deployment缩容
+// ==================
+
+func TestDeploymentScaleDownRemovesNewestPods(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows下没有sh")
+	}
+
+	cr := newBuildTestRuntime(t)
+	co := NewContainerOrchestrator(cr)
+	deployment := newTestDeployment(t, co, 3, DeploymentStrategy{})
+	co.reconcileDeployment(deployment)
+	markPodsReady(co)
+
+	// 固定创建时间，使缩容选择可预测
+	pods, _ := co.deploymentPods(deployment, templateHash(deployment.Template))
+	if len(pods) != 3 {
+		t.Fatalf("期望3个Pod，实际为%d", len(pods))
+	}
+	base := time.Now().Add(-time.Hour)
+	for i, pod := range pods {
+		pod.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+	}
+	// 最新的Pod运行着真实的容器，缩容时需要先停止
+	newest := pods[2]
+	if err := cr.StartContainer(newest.Containers[0].ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+
+	events := make(chan *ContainerEvent, 3)
+	co.eventBus.Subscribe(EventPodStop, func(event *ContainerEvent) { events <- event })
+
+	if err := co.ScaleDeployment(deployment.ID, 1); err != nil {
+		t.Fatalf("缩容失败: %v", err)
+	}
+	co.reconcileDeployment(deployment)
+
+	remaining, _ := co.deploymentPods(deployment, templateHash(deployment.Template))
+	if len(remaining) != 1 || remaining[0] != pods[0] {
+		t.Fatalf("期望只保留最早创建的Pod，实际剩余%d个", len(remaining))
+	}
+	for _, pod := range pods[1:] {
+		if _, err := cr.InspectContainer(pod.Containers[0].ID); err == nil {
+			t.Errorf("Pod %s的容器应已删除", pod.Name)
+		}
+	}
+	if newest.Containers[0].IsRunning() {
+		t.Error("被删除Pod的容器应已停止")
+	}
+	if deployment.Status != DeploymentAvailable {
+		t.Errorf("缩容完成后期望为Available，实际为%s", deployment.Status)
+	}
+
+	stopped := make(map[*Pod]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-events:
+			if event.Message != "scale down" {
+				t.Errorf("事件原因不正确: %q", event.Message)
+			}
+			stopped[event.Pod] = true
+		case <-time.After(time.Second):
+			t.Fatalf("期望2个Pod停止事件，只收到%d个", i)
+		}
+	}
+	if !stopped[pods[1]] || !stopped[pods[2]] {
+		t.Error("停止事件应对应被删除的两个Pod")
+	}
+
+	if err := co.ScaleDeployment(deployment.ID, -1); err == nil {
+		t.Error("负数副本数应返回错误")
+	}
+}
+
+func TestScaleDownPrefersUnreadyPods(t *testing.T) {
+	co := NewContainerOrchestrator(newBuildTestRuntime(t))
+	deployment := newTestDeployment(t, co, 3, DeploymentStrategy{})
+	co.reconcileDeployment(deployment)
+
+	pods, _ := co.deploymentPods(deployment, templateHash(deployment.Template))
+	base := time.Now().Add(-time.Hour)
+	for i, pod := range pods {
+		pod.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		pod.Status = PodRunning
+	}
+	// 最早创建的Pod未就绪，应先于较新的就绪Pod被删除
+	pods[0].Status = PodPending
+
+	co.scaleDown(pods, 2)
+	remaining, _ := co.deploymentPods(deployment, templateHash(deployment.Template))
+	if len(remaining) != 1 || remaining[0] != pods[1] {
+		t.Errorf("期望保留就绪且较早的Pod %s", pods[1].Name)
+	}
+}
+
+// ==================
+// 23. 调度抢占
+// ==================
+
+// newTestNode 返回就绪状态、具有给定可分配资源的节点
+func newTestNode(name, cpu, memory string) *Node {
+	return &Node{
+		ID:          "id-" + name,
+		Name:        name,
+		Status:      NodeReady,
+		Allocatable: ResourceList{"cpu": cpu, "memory": memory},
+	}
+}
+
+// newSchedulingPod 登记一个不含容器的Pod，由测试同步调用bindPod调度
+func newSchedulingPod(co *ContainerOrchestrator, name string, priority int, cpu, memory string) *Pod {
+	pod := &Pod{
+		ID:        generatePodID(),
+		Name:      name,
+		Namespace: "default",
+		Status:    PodPending,
+		Priority:  priority,
+		Spec: &PodSpec{Name: name, Priority: priority, Containers: []ContainerSpec{
+			{Name: "app", ResourceRequests: ResourceList{"cpu": cpu, "memory": memory}},
+		}},
+		CreatedAt: time.Now(),
+	}
+	co.mutex.Lock()
+	co.pods[pod.ID] = pod
+	co.mutex.Unlock()
+	return pod
+}
+
+func TestParseResourceQuantities(t *testing.T) {
+	amount, err := parseResourceList(ResourceList{"cpu": "250m", "memory": "128Mi", "pods": "10"})
+	if err != nil || amount.MilliCPU != 250 || amount.Memory != 128<<20 {
+		t.Errorf("解析资源请求不正确: %+v %v", amount, err)
+	}
+	for value, expected := range map[string]int64{"2": 2000, "0.5": 500, "1500m": 1500} {
+		if cpu, err := parseCPUQuantity(value); err != nil || cpu != expected {
+			t.Errorf("parseCPUQuantity(%q) = %d, %v，期望%d", value, cpu, err, expected)
+		}
+	}
+	for value, expected := range map[string]int64{"1Gi": 1 << 30, "1G": 1e9, "4096": 4096} {
+		if memory, err := parseMemoryQuantity(value); err != nil || memory != expected {
+			t.Errorf("parseMemoryQuantity(%q) = %d, %v，期望%d", value, memory, err, expected)
+		}
+	}
+	for _, invalid := range []ResourceList{{"cpu": "-1"}, {"cpu": "abc"}, {"memory": "1Xi"}, {"memory": "-5Mi"}} {
+		if _, err := parseResourceList(invalid); err == nil {
+			t.Errorf("期望拒绝非法资源数量%v", invalid)
+		}
+	}
+}
+
+func TestPreemptSelectsLowestPriorityVictims(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	nodeA := newTestNode("node-a", "2", "4Gi")
+	nodeB := newTestNode("node-b", "2", "4Gi")
+	co.nodes[nodeA.ID], co.nodes[nodeB.ID] = nodeA, nodeB
+
+	// node-a上是优先级1和5的Pod，node-b上是优先级3的Pod，两个节点都已占满CPU
+	low := newSchedulingPod(co, "low", 1, "1", "1Gi")
+	mid := newSchedulingPod(co, "mid", 5, "1", "1Gi")
+	other := newSchedulingPod(co, "other", 3, "2", "1Gi")
+	for pod, node := range map[*Pod]*Node{low: nodeA, mid: nodeA, other: nodeB} {
+		node.bindPod(pod)
+		pod.node = node
+		pod.NodeName = node.Name
+	}
+
+	urgent := newSchedulingPod(co, "urgent", 10, "1", "1Gi")
+	victims, node, err := (&DefaultSchedulingAlgorithm{}).Preempt(urgent, co.getAvailableNodes())
+	if err != nil {
+		t.Fatalf("期望抢占成功: %v", err)
+	}
+	if node != nodeA || len(victims) != 1 || victims[0] != low {
+		t.Fatalf("期望抢占node-a上优先级最低的Pod，实际为%v %v", node, victims)
+	}
+
+	// 通过编排器绑定：被抢占的Pod先被删除，新Pod再绑定到节点
+	bound, err := co.bindPod(urgent)
+	if err != nil {
+		t.Fatalf("绑定Pod失败: %v", err)
+	}
+	if bound != nodeA || urgent.NodeName != "node-a" || urgent.Status != PodScheduled {
+		t.Errorf("新Pod未绑定到node-a: %s %s", urgent.NodeName, urgent.Status)
+	}
+	if _, exists := co.pods[low.ID]; exists {
+		t.Error("被抢占的Pod应已删除")
+	}
+	if _, exists := nodeA.pods[low.ID]; exists {
+		t.Error("被抢占的Pod应已释放节点资源")
+	}
+	if _, exists := co.pods[mid.ID]; !exists {
+		t.Error("优先级更高的Pod不应被抢占")
+	}
+}
+
+func TestPreemptWithoutFeasibleVictims(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	node := newTestNode("node-a", "2", "4Gi")
+	co.nodes[node.ID] = node
+
+	running := newSchedulingPod(co, "running", 5, "2", "1Gi")
+	if _, err := co.bindPod(running); err != nil {
+		t.Fatalf("绑定Pod失败: %v", err)
+	}
+
+	// 只能抢占严格更低优先级的Pod
+	peer := newSchedulingPod(co, "peer", 5, "1", "1Gi")
+	if _, err := co.bindPod(peer); err == nil || !strings.Contains(err.Error(), "preemption failed") {
+		t.Errorf("同优先级的Pod不应触发抢占，实际为%v", err)
+	}
+
+	// 即使抢占全部Pod也放不下
+	huge := newSchedulingPod(co, "huge", 100, "4", "1Gi")
+	if _, _, err := (&LeastAllocatedAlgorithm{}).Preempt(huge, co.getAvailableNodes()); err == nil {
+		t.Error("资源总量不足时不应找到抢占方案")
+	}
+	if _, exists := co.pods[running.ID]; !exists || running.NodeName != "node-a" {
+		t.Error("抢占失败时不应影响已运行的Pod")
+	}
+}
+
+// ==================
+// 24. 装箱调度算法
+// ==================
+
+func TestMostAllocatedPacksFullestNode(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	empty := newTestNode("node-a", "4", "8Gi")
+	full := newTestNode("node-b", "4", "8Gi")
+	tight := newTestNode("node-c", "2", "4Gi")
+	for _, node := range []*Node{empty, full, tight} {
+		co.nodes[node.ID] = node
+	}
+
+	// 直接绑定到指定节点，构造不同的使用率
+	occupy := func(node *Node, name, cpu, memory string) {
+		pod := newSchedulingPod(co, name, 0, cpu, memory)
+		node.bindPod(pod)
+		pod.node = node
+	}
+	occupy(full, "existing-b", "2", "4Gi")
+	occupy(tight, "existing-c", "1500m", "3Gi")
+
+	pod := newSchedulingPod(co, "incoming", 0, "1", "2Gi")
+	nodes := co.getAvailableNodes()
+
+	// node-c放置后使用率最高但容纳不下，装箱算法应选择node-b
+	packed, err := (&MostAllocatedAlgorithm{}).Schedule(pod, nodes)
+	if err != nil || packed != full {
+		t.Fatalf("装箱算法应选择node-b，实际为%v %v", packed, err)
+	}
+	spread, err := (&LeastAllocatedAlgorithm{}).Schedule(pod, nodes)
+	if err != nil || spread == packed {
+		t.Errorf("最少分配算法不应与装箱算法选择同一节点，实际为%v %v", spread, err)
+	}
+
+	co.scheduler.algorithms["default"] = co.scheduler.algorithms["most-allocated"]
+	if bound, err := co.bindPod(pod); err != nil || bound != full {
+		t.Fatalf("绑定失败: %v %v", bound, err)
+	}
+	if full.Allocated["cpu"] != "3000m" || full.Allocated["memory"] != strconv.FormatInt(6<<30, 10) {
+		t.Errorf("节点已分配资源未更新: %v", full.Allocated)
+	}
+
+	co.mutex.Lock()
+	co.unbindPodLocked(pod)
+	co.mutex.Unlock()
+	if full.Allocated["cpu"] != "2000m" {
+		t.Errorf("解绑后应释放节点资源: %v", full.Allocated)
+	}
+}
+
+func TestMostAllocatedNoFit(t *testing.T) {
+	node := newTestNode("node-a", "1", "1Gi")
+	pod := &Pod{Name: "huge", ResourceRequests: ResourceList{"cpu": "2", "memory": "0"}}
+	if _, err := (&MostAllocatedAlgorithm{}).Schedule(pod, []*Node{node}); err == nil {
+		t.Error("没有节点能容纳时应返回错误")
+	}
+	if _, err := (&MostAllocatedAlgorithm{}).Schedule(pod, nil); err == nil {
+		t.Error("没有节点时应返回错误")
+	}
+}
+
+func TestCreatePodAggregatesResourceRequests(t *testing.T) {
+	co := NewContainerOrchestrator(newBuildTestRuntime(t))
+	pod, err := co.CreatePod(&PodSpec{Name: "agg", Containers: []ContainerSpec{
+		{Name: "a", Image: "base", ResourceRequests: ResourceList{"cpu": "250m", "memory": "64Mi"}},
+		{Name: "b", Image: "base", ResourceRequests: ResourceList{"cpu": "0.5"}},
+	}})
+	if err != nil {
+		t.Fatalf("创建Pod失败: %v", err)
+	}
+	if pod.ResourceRequests["cpu"] != "750m" || pod.ResourceRequests["memory"] != strconv.FormatInt(64<<20, 10) {
+		t.Errorf("Pod资源请求汇总不正确: %v", pod.ResourceRequests)
+	}
+}
+
+// ==================
+// 25. 最少分配评分
+// ==================
+
+func TestLeastAllocatedPrefersEmptiestFeasibleNode(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	full := newTestNode("node-a", "2", "4Gi")
+	busy := newTestNode("node-b", "4", "8Gi")
+	idle := newTestNode("node-c", "4", "8Gi")
+	for _, node := range []*Node{full, busy, idle} {
+		co.nodes[node.ID] = node
+	}
+	occupy := func(node *Node, name, cpu, memory string) {
+		pod := newSchedulingPod(co, name, 0, cpu, memory)
+		node.bindPod(pod)
+		pod.node = node
+	}
+	occupy(full, "existing-a", "2", "4Gi")
+	occupy(busy, "existing-b", "3", "2Gi")
+	occupy(idle, "existing-c", "1", "5Gi")
+
+	algorithm := &LeastAllocatedAlgorithm{}
+	scores := map[*Node]float64{full: 100, busy: 50, idle: 43.75}
+	for node, expected := range scores {
+		if score := algorithm.calculateNodeScore(node); score != expected {
+			t.Errorf("%s得分为%.2f，期望%.2f", node.Name, score, expected)
+		}
+	}
+
+	pod := newSchedulingPod(co, "incoming", 0, "500m", "1Gi")
+	if node, err := algorithm.Schedule(pod, co.getAvailableNodes()); err != nil || node != idle {
+		t.Errorf("应选择使用率最低的node-c，实际为%v %v", node, err)
+	}
+
+	// node-c容纳不下时跳过，而不是回退到第一个节点
+	large := newSchedulingPod(co, "large", 0, "1", "4Gi")
+	if _, err := algorithm.Schedule(large, []*Node{full, idle}); err == nil {
+		t.Error("没有节点能容纳时应返回错误")
+	}
+	if node, err := algorithm.Schedule(large, []*Node{full, busy, idle}); err != nil || node != busy {
+		t.Errorf("应跳过放不下的节点选择node-b，实际为%v %v", node, err)
+	}
+}
+
+// ==================
+// 26. 节点亲和性与反亲和性
+// ==================
+
+// newLabeledNode 返回带标签的测试节点
+func newLabeledNode(name string, labels map[string]string) *Node {
+	node := newTestNode(name, "4", "8Gi")
+	node.Labels = labels
+	return node
+}
+
+func TestNodeSelectorAndAffinity(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	for _, node := range []*Node{
+		newLabeledNode("node-a", map[string]string{"disk": "hdd", "zone": "us-east-1a"}),
+		newLabeledNode("node-b", map[string]string{"disk": "ssd", "zone": "us-east-1a"}),
+		newLabeledNode("node-c", map[string]string{"disk": "ssd", "zone": "us-west-1a", "gpu": "true"}),
+	} {
+		co.nodes[node.ID] = node
+	}
+
+	tests := []struct {
+		name         string
+		nodeSelector map[string]string
+		affinity     []LabelRule
+		expected     string
+	}{
+		{"selector", map[string]string{"disk": "ssd"}, nil, "node-b"},
+		{"in", nil, []LabelRule{{Key: "zone", Operator: LabelOpIn, Values: []string{"us-west-1a"}}}, "node-c"},
+		{"not-in", nil, []LabelRule{{Key: "disk", Operator: LabelOpNotIn, Values: []string{"ssd"}}}, "node-a"},
+		{"exists", nil, []LabelRule{{Key: "gpu", Operator: LabelOpExists}}, "node-c"},
+		{"selector-and-rule", map[string]string{"disk": "ssd"}, []LabelRule{{Key: "gpu", Operator: LabelOpDoesNotExist}}, "node-b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newSchedulingPod(co, tt.name, 0, "100m", "64Mi")
+			pod.Spec.NodeSelector = tt.nodeSelector
+			pod.Spec.Affinity = tt.affinity
+			node, err := co.bindPod(pod)
+			if err != nil || node.Name != tt.expected {
+				t.Errorf("期望调度到%s，实际为%v %v", tt.expected, node, err)
+			}
+		})
+	}
+
+	pod := newSchedulingPod(co, "nowhere", 0, "100m", "64Mi")
+	pod.Spec.NodeSelector = map[string]string{"disk": "nvme"}
+	if _, err := co.bindPod(pod); err == nil || !strings.Contains(err.Error(), "no node satisfies affinity") {
+		t.Errorf("没有节点满足选择器时应返回亲和性错误，实际为%v", err)
+	}
+}
+
+func TestPodAntiAffinitySpreadsReplicas(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	for _, name := range []string{"node-a", "node-b"} {
+		node := newTestNode(name, "4", "8Gi")
+		co.nodes[node.ID] = node
+	}
+
+	antiAffinity := []LabelRule{{Key: "app", Operator: LabelOpIn, Values: []string{"web"}}}
+	var placed []string
+	for i := 0; i < 3; i++ {
+		pod := newSchedulingPod(co, fmt.Sprintf("web-%d", i), 0, "100m", "64Mi")
+		pod.Labels = map[string]string{"app": "web"}
+		pod.Spec.AntiAffinity = antiAffinity
+		node, err := co.bindPod(pod)
+		if i < 2 {
+			if err != nil {
+				t.Fatalf("第%d个副本调度失败: %v", i, err)
+			}
+			placed = append(placed, node.Name)
+			continue
+		}
+		// 两个节点都已运行匹配的Pod
+		if err == nil || !strings.Contains(err.Error(), "no node satisfies affinity") {
+			t.Errorf("第3个副本应无法调度，实际为%v %v", node, err)
+		}
+	}
+	if len(placed) != 2 || placed[0] == placed[1] {
+		t.Errorf("反亲和性应将副本分散到不同节点: %v", placed)
+	}
+
+	// 其他命名空间或标签不匹配的Pod不受影响
+	other := newSchedulingPod(co, "db", 0, "100m", "64Mi")
+	other.Labels = map[string]string{"app": "db"}
+	other.Spec.AntiAffinity = []LabelRule{{Key: "app", Operator: LabelOpIn, Values: []string{"db"}}}
+	if _, err := co.bindPod(other); err != nil {
+		t.Errorf("标签不匹配时不应被反亲和性排除: %v", err)
+	}
+}
+
+func TestCreatePodRejectsInvalidAffinity(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	for _, rules := range [][]LabelRule{
+		{{Key: "zone", Operator: "Near"}},
+		{{Key: "zone", Operator: LabelOpIn}},
+		{{Key: "zone", Operator: LabelOpExists, Values: []string{"a"}}},
+		{{Operator: LabelOpExists}},
+	} {
+		if _, err := co.CreatePod(&PodSpec{Name: "bad", Affinity: rules}); err == nil {
+			t.Errorf("规则%+v应被拒绝", rules)
+		}
+		if _, err := co.CreatePod(&PodSpec{Name: "bad", AntiAffinity: rules}); err == nil {
+			t.Errorf("反亲和性规则%+v应被拒绝", rules)
+		}
+	}
+}
+
+// ==================
+// 27. Seccomp BPF编译
+// ==================
+
+const (
+	auditArchX86_64  = 0xc000003e
+	auditArchAArch64 = 0xc00000b7
+	auditArchI386    = 0x40000003
+)
+
+// runSeccompProgram 在BPF虚拟机中对构造的seccomp_data执行程序并返回动作。
+// 内核按本机小端序读取seccomp_data，而虚拟机按大端序加载，
+// 因此每个32位字段以大端序写入，64位参数的低32位在前
+func runSeccompProgram(t *testing.T, program []bpf.RawInstruction, arch, nr uint32, args ...uint64) uint32 {
+	t.Helper()
+	instructions, ok := bpf.Disassemble(program)
+	if !ok {
+		t.Fatalf("生成的BPF程序无法反汇编")
+	}
+	vm, err := bpf.NewVM(instructions)
+	if err != nil {
+		t.Fatalf("BPF程序无效: %v", err)
+	}
+
+	data := make([]byte, 64)
+	binary.BigEndian.PutUint32(data[0:], nr)
+	binary.BigEndian.PutUint32(data[4:], arch)
+	for i, arg := range args {
+		binary.BigEndian.PutUint32(data[16+8*i:], uint32(arg))
+		binary.BigEndian.PutUint32(data[20+8*i:], uint32(arg>>32))
+	}
+
+	action, err := vm.Run(data)
+	if err != nil {
+		t.Fatalf("BPF程序执行失败: %v", err)
+	}
+	return uint32(action)
+}
+
+func TestCompileSeccompAllowDeny(t *testing.T) {
+	profile := &SeccompProfile{
+		DefaultAction: "SCMP_ACT_ERRNO",
+		Architectures: []string{"SCMP_ARCH_X86_64", "SCMP_ARCH_AARCH64"},
+		Syscalls: []SyscallRule{
+			{Names: []string{"read", "write", "open"}, Action: "SCMP_ACT_ALLOW"},
+			{Names: []string{"reboot"}, Action: "SCMP_ACT_KILL_PROCESS"},
+		},
+	}
+	program, err := Compile(profile)
+	if err != nil {
+		t.Fatalf("编译失败: %v", err)
+	}
+
+	allow, errno, killProcess := seccompActions["SCMP_ACT_ALLOW"], seccompActions["SCMP_ACT_ERRNO"], seccompActions["SCMP_ACT_KILL_PROCESS"]
+	cases := []struct {
+		name string
+		arch uint32
+		nr   uint32
+		want uint32
+	}{
+		{"x86_64 read", auditArchX86_64, 0, allow},
+		{"x86_64 write", auditArchX86_64, 1, allow},
+		{"x86_64 open", auditArchX86_64, 2, allow},
+		{"x86_64 mount", auditArchX86_64, 165, errno},
+		{"x86_64 reboot", auditArchX86_64, 169, killProcess},
+		{"aarch64 read", auditArchAArch64, 63, allow},
+		{"aarch64 reboot", auditArchAArch64, 142, killProcess},
+		// aarch64没有open，号码2是io_submit，应落到默认动作
+		{"aarch64 io_submit", auditArchAArch64, 2, errno},
+		{"未列出的架构", auditArchI386, 3, seccompActions["SCMP_ACT_KILL"]},
+		// x32 ABI的read与x86_64共用AUDIT_ARCH，号码带__X32_SYSCALL_BIT，不能借此绕过规则
+		{"x32 read", auditArchX86_64, seccompX32SyscallBit | 0, seccompActions["SCMP_ACT_KILL"]},
+		{"x32 reboot", auditArchX86_64, seccompX32SyscallBit | 169, seccompActions["SCMP_ACT_KILL"]},
+	}
+	for _, tc := range cases {
+		if got := runSeccompProgram(t, program, tc.arch, tc.nr); got != tc.want {
+			t.Errorf("%s: 动作为%#x，期望%#x", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCompileSeccompArgumentConditions(t *testing.T) {
+	const personality = 135 // x86_64
+	allow, errno := seccompActions["SCMP_ACT_ALLOW"], seccompActions["SCMP_ACT_ERRNO"]
+	big := uint64(1) << 40
+
+	cases := []struct {
+		arg  SyscallArg
+		pass []uint64
+		fail []uint64
+	}{
+		{SyscallArg{Index: 0, Op: "SCMP_CMP_EQ", Value: big + 8}, []uint64{big + 8}, []uint64{8, big, big + 9}},
+		{SyscallArg{Index: 0, Op: "SCMP_CMP_NE", Value: big + 8}, []uint64{8, big, 0}, []uint64{big + 8}},
+		{SyscallArg{Index: 0, Op: "SCMP_CMP_GT", Value: big + 8}, []uint64{big + 9, 2 * big}, []uint64{big + 8, 9, big}},
+		{SyscallArg{Index: 0, Op: "SCMP_CMP_GE", Value: big + 8}, []uint64{big + 8, 2 * big}, []uint64{big + 7, 9}},
+		{SyscallArg{Index: 0, Op: "SCMP_CMP_LT", Value: big + 8}, []uint64{big + 7, 9, 0}, []uint64{big + 8, 2 * big}},
+		{SyscallArg{Index: 0, Op: "SCMP_CMP_LE", Value: big + 8}, []uint64{big + 8, 9}, []uint64{big + 9, 2 * big}},
+		{SyscallArg{Index: 0, Op: "SCMP_CMP_MASKED_EQ", Value: big | 0xff, ValueTwo: 0x08}, []uint64{0x08, 0x1008, 2*big | 0x08}, []uint64{big | 0x08, 0x09}},
+	}
+
+	for _, tc := range cases {
+		program, err := Compile(&SeccompProfile{
+			DefaultAction: "SCMP_ACT_ERRNO",
+			Architectures: []string{"SCMP_ARCH_X86_64"},
+			Syscalls: []SyscallRule{{
+				Names:  []string{"personality"},
+				Action: "SCMP_ACT_ALLOW",
+				Args:   []SyscallArg{tc.arg},
+			}, {
+				// 参数不匹配后应继续匹配后续规则
+				Names:  []string{"read"},
+				Action: "SCMP_ACT_ALLOW",
+			}},
+		})
+		if err != nil {
+			t.Fatalf("%s: 编译失败: %v", tc.arg.Op, err)
+		}
+		for _, v := range tc.pass {
+			if got := runSeccompProgram(t, program, auditArchX86_64, personality, v); got != allow {
+				t.Errorf("%s %#x: 参数%#x应匹配", tc.arg.Op, tc.arg.Value, v)
+			}
+		}
+		for _, v := range tc.fail {
+			if got := runSeccompProgram(t, program, auditArchX86_64, personality, v); got != errno {
+				t.Errorf("%s %#x: 参数%#x不应匹配", tc.arg.Op, tc.arg.Value, v)
+			}
+		}
+		if got := runSeccompProgram(t, program, auditArchX86_64, 0); got != allow {
+			t.Errorf("%s: 后续规则的read应被允许", tc.arg.Op)
+		}
+	}
+
+	// 同一规则内的多个参数条件需全部满足
+	program, err := Compile(&SeccompProfile{
+		DefaultAction: "SCMP_ACT_ERRNO",
+		Architectures: []string{"SCMP_ARCH_X86_64"},
+		Syscalls: []SyscallRule{{
+			Names:  []string{"personality"},
+			Action: "SCMP_ACT_ALLOW",
+			Args: []SyscallArg{
+				{Index: 0, Op: "SCMP_CMP_EQ", Value: 1},
+				{Index: 2, Op: "SCMP_CMP_LT", Value: 10},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("编译失败: %v", err)
+	}
+	if got := runSeccompProgram(t, program, auditArchX86_64, personality, 1, 0, 5); got != allow {
+		t.Errorf("两个条件都满足时应允许")
+	}
+	if got := runSeccompProgram(t, program, auditArchX86_64, personality, 1, 0, 10); got != errno {
+		t.Errorf("第二个条件不满足时应返回默认动作")
+	}
+}
+
+func TestCompileSeccompRejectsInvalidProfiles(t *testing.T) {
+	valid := func() *SeccompProfile {
+		return &SeccompProfile{
+			DefaultAction: "SCMP_ACT_ERRNO",
+			Architectures: []string{"SCMP_ARCH_X86_64"},
+			Syscalls:      []SyscallRule{{Names: []string{"read"}, Action: "SCMP_ACT_ALLOW"}},
+		}
+	}
+	if _, err := Compile(valid()); err != nil {
+		t.Fatalf("合法配置编译失败: %v", err)
+	}
+
+	cases := map[string]func(p *SeccompProfile){
+		"未知默认动作": func(p *SeccompProfile) { p.DefaultAction = "SCMP_ACT_DENY" },
+		"缺少默认动作": func(p *SeccompProfile) { p.DefaultAction = "" },
+		"未知规则动作": func(p *SeccompProfile) { p.Syscalls[0].Action = "ALLOW" },
+		"未知架构":   func(p *SeccompProfile) { p.Architectures = []string{"SCMP_ARCH_SPARC"} },
+		"未知系统调用": func(p *SeccompProfile) { p.Syscalls[0].Names = []string{"not_a_syscall"} },
+		"未知比较操作": func(p *SeccompProfile) {
+			p.Syscalls[0].Args = []SyscallArg{{Index: 0, Op: "SCMP_CMP_ABOUT", Value: 1}}
+		},
+		"参数索引越界": func(p *SeccompProfile) {
+			p.Syscalls[0].Args = []SyscallArg{{Index: 6, Op: "SCMP_CMP_EQ", Value: 1}}
+		},
+	}
+	for name, mutate := range cases {
+		profile := valid()
+		mutate(profile)
+		if _, err := Compile(profile); err == nil {
+			t.Errorf("%s: 应返回错误", name)
+		}
+	}
+}
+
+func TestCompileSeccompLargeSyscallList(t *testing.T) {
+	// 每个架构的规则块都远超条件跳转255条指令的范围
+	names := make(map[string]bool)
+	for _, arch := range []string{"SCMP_ARCH_X86_64", "SCMP_ARCH_AARCH64"} {
+		for name := range seccompSyscallTables[arch] {
+			if name != "reboot" {
+				names[name] = true
+			}
+		}
+	}
+	var allowed []string
+	for name := range names {
+		allowed = append(allowed, name)
+	}
+	sort.Strings(allowed)
+
+	program, err := Compile(&SeccompProfile{
+		DefaultAction: "SCMP_ACT_ERRNO",
+		Architectures: []string{"SCMP_ARCH_X86_64", "SCMP_ARCH_AARCH64"},
+		Syscalls: []SyscallRule{
+			{Names: allowed, Action: "SCMP_ACT_ALLOW"},
+			{Names: []string{"reboot"}, Action: "SCMP_ACT_KILL_PROCESS"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("编译失败: %v", err)
+	}
+	if len(program) < 2*0xff {
+		t.Fatalf("期望生成超过%d条指令的程序，实际为%d条", 2*0xff, len(program))
+	}
+
+	allow, errno, killProcess := seccompActions["SCMP_ACT_ALLOW"], seccompActions["SCMP_ACT_ERRNO"], seccompActions["SCMP_ACT_KILL_PROCESS"]
+	cases := []struct {
+		name string
+		arch uint32
+		nr   uint32
+		want uint32
+	}{
+		{"x86_64 read", auditArchX86_64, 0, allow},
+		{"x86_64 reboot", auditArchX86_64, 169, killProcess},
+		{"x86_64 未知号码", auditArchX86_64, 4000, errno},
+		{"aarch64 read", auditArchAArch64, 63, allow},
+		{"aarch64 reboot", auditArchAArch64, 142, killProcess},
+		{"aarch64 未知号码", auditArchAArch64, 4000, errno},
+		{"未列出的架构", auditArchI386, 3, seccompActions["SCMP_ACT_KILL"]},
+	}
+	for _, tc := range cases {
+		if got := runSeccompProgram(t, program, tc.arch, tc.nr); got != tc.want {
+			t.Errorf("%s: 动作为%#x，期望%#x", tc.name, got, tc.want)
+		}
+	}
+}
+
+// denyMkdirProfile 默认允许、仅拒绝创建目录的配置
+func denyMkdirProfile(profileType string) *SeccompProfile {
+	return &SeccompProfile{
+		Type:          profileType,
+		DefaultAction: "SCMP_ACT_ALLOW",
+		Syscalls:      []SyscallRule{{Names: []string{"mkdir", "mkdirat"}, Action: "SCMP_ACT_ERRNO"}},
+	}
+}
+
+func TestSeccompApplyProfile(t *testing.T) {
+	sm := NewSeccompManager()
+	if err := sm.ApplyProfile("c1", "missing", exec.Command("sh")); err == nil {
+		t.Fatal("未加载的配置应返回错误")
+	}
+	if err := sm.LoadProfile("deny-mkdir", denyMkdirProfile("")); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+
+	if runtime.GOOS != "linux" {
+		if err := sm.ApplyProfile("c1", "deny-mkdir", exec.Command("sh")); err == nil {
+			t.Error("非Linux平台应返回不支持的错误")
+		}
+		return
+	}
+
+	dir := filepath.Join(t.TempDir(), "denied")
+	cmd := exec.Command("sh", "-c", "grep Seccomp: /proc/self/status; mkdir "+dir)
+	if err := sm.ApplyProfile("c1", "deny-mkdir", cmd); err != nil {
+		t.Fatalf("应用配置失败: %v", err)
+	}
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("过滤器生效时mkdir应失败: %s", output)
+	}
+	if !strings.Contains(string(output), "Seccomp:\t2") || !strings.Contains(string(output), "not permitted") {
+		t.Errorf("期望子进程处于seccomp过滤模式且mkdir被拒绝，实际输出%s", output)
+	}
+
+	// 过滤器只安装在子进程中，运行时自身不受影响
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(status), "Seccomp:\t0") {
+		t.Error("运行时进程不应安装seccomp过滤器")
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Errorf("运行时进程的mkdir不应被拒绝: %v", err)
+	}
+}
+
+func TestStartContainerAppliesSeccompProfile(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("seccomp仅Linux支持")
+	}
+
+	cr := newTestRuntime(t)
+	if err := cr.seccomp.LoadProfile("deny-mkdir", denyMkdirProfile("")); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	localhost := "deny-mkdir"
+	profiles := map[string]*SeccompProfile{
+		"内联配置":        denyMkdirProfile("RuntimeDefault"),
+		"Localhost配置": {Type: "Localhost", LocalhostProfile: &localhost},
+	}
+	for name, profile := range profiles {
+		dir := filepath.Join(t.TempDir(), "denied")
+		container := addTestContainer(t, cr, "sh", "-c", "mkdir "+dir)
+		container.SecurityContext = &SecurityContext{SeccompProfile: profile}
+
+		if err := cr.StartContainer(container.ID); err != nil {
+			t.Fatalf("%s: 启动容器失败: %v", name, err)
+		}
+		exitCode, err := cr.WaitContainer(container.ID)
+		if err != nil {
+			t.Fatalf("%s: 等待容器失败: %v", name, err)
+		}
+		logs, err := cr.Logs(container.ID, LogOptions{})
+		if err != nil {
+			t.Fatalf("%s: 读取容器日志失败: %v", name, err)
+		}
+		output, _ := io.ReadAll(logs)
+		logs.Close()
+		if exitCode == 0 || !strings.Contains(string(output), "not permitted") {
+			t.Errorf("%s: 过滤器生效时mkdir应被拒绝，退出码%d，输出%q", name, exitCode, output)
+		}
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s: 容器不应创建目录%s", name, dir)
+		}
+	}
+}
+
+// ==================
+// 28. DeviceMapper层大小
+// ==================
+
+func TestDeviceMapperGetLayerSize(t *testing.T) {
+	driver := &DeviceMapperDriver{}
+	if err := driver.Initialize(t.TempDir()); err != nil {
+		t.Fatalf("初始化驱动失败: %v", err)
+	}
+	if _, err := driver.CreateLayer("layer1", ""); err != nil {
+		t.Fatalf("创建层失败: %v", err)
+	}
+
+	diffPath, _ := driver.DiffPath("layer1")
+	if err := os.MkdirAll(filepath.Join(diffPath, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(diffPath, "etc", "hosts"), make([]byte, 300), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(diffPath, "app"), make([]byte, 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有thin设备元数据时统计挂载目录
+	size, err := driver.GetLayerSize("layer1")
+	if err != nil {
+		t.Fatalf("获取层大小失败: %v", err)
+	}
+	if size != 1324 {
+		t.Errorf("层大小应为1324，实际为%d", size)
+	}
+
+	// 有元数据但设备状态不可用时同样退化为统计目录
+	metadataDir := filepath.Join(driver.deviceRoot, "metadata")
+	if err := os.MkdirAll(metadataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	metadata := `{"device_id":7,"size":10737418240,"transaction_id":3,"initialized":true}`
+	if err := os.WriteFile(filepath.Join(metadataDir, "layer1"), []byte(metadata), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := driver.GetLayerSize("layer1"); err != nil || size != 1324 {
+		t.Errorf("设备状态不可用时应统计目录，实际为%d %v", size, err)
+	}
+
+	_, err = driver.GetLayerSize("missing")
+	if err == nil || !strings.Contains(err.Error(), "layer not found: missing") {
+		t.Errorf("未知层应返回layer not found错误，实际为%v", err)
+	}
+	if _, err := driver.GetLayerSize("../layer1"); err == nil {
+		t.Error("非法层ID应被拒绝")
+	}
+}
+
+func TestParseThinStatus(t *testing.T) {
+	size, err := parseThinStatus("0 20971520 thin 81920 20971519\n")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if size != 81920*512 {
+		t.Errorf("已映射大小应为%d，实际为%d", 81920*512, size)
+	}
+
+	for _, status := range []string{"", "0 20971520 linear", "0 20971520 thin Fail", "0 20971520 thin-pool 1 2/3 4/5"} {
+		if _, err := parseThinStatus(status); err == nil {
+			t.Errorf("状态%q应解析失败", status)
+		}
+	}
+}
+
+// ==================
+// 29. 层内容去重
+// ==================
+
+// populateBaseLayer 写入固定内容和修改时间的基础层，保证两次生成的层内容摘要相同
+func populateBaseLayer(diffPath string) error {
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	files := map[string]string{
+		"etc/os-release": "ID=demo\n",
+		"bin/sh":         strings.Repeat("x", 4096),
+	}
+	for name, content := range files {
+		path := filepath.Join(diffPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			return err
+		}
+	}
+	for _, dir := range []string{"etc", "bin"} {
+		if err := os.Chtimes(filepath.Join(diffPath, dir), modTime, modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countOverlayLayers 统计overlay2驱动目录中的层数
+func countOverlayLayers(t *testing.T, cr *ContainerRuntime) int {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(cr.storage.graphRoot, "overlay2"))
+	if err != nil {
+		t.Fatalf("读取层目录失败: %v", err)
+	}
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != "l" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestSharedBaseLayerCreatedOnce(t *testing.T) {
+	cr := newImageTestRuntime(t)
+
+	buildImage := func(app string) *ContainerImage {
+		t.Helper()
+		base, err := cr.createImageWithLayer(nil, &ImageConfig{}, populateBaseLayer)
+		if err != nil {
+			t.Fatalf("创建基础层失败: %v", err)
+		}
+		image, err := cr.createImageWithLayer(base, &ImageConfig{}, func(diffPath string) error {
+			return os.WriteFile(filepath.Join(diffPath, app), []byte(app), 0644)
+		})
+		if err != nil {
+			t.Fatalf("创建应用层失败: %v", err)
+		}
+		return image
+	}
+
+	first := buildImage("app1")
+	second := buildImage("app2")
+
+	if first.Layers[0] != second.Layers[0] {
+		t.Errorf("两个镜像应共享同一基础层: %s != %s", first.Layers[0], second.Layers[0])
+	}
+	if first.Layers[1] == second.Layers[1] {
+		t.Error("内容不同的应用层不应被共享")
+	}
+	if n := countOverlayLayers(t, cr); n != 3 {
+		t.Errorf("期望磁盘上有3个层，实际为%d", n)
+	}
+
+	baseSize := cr.storage.layers[first.Layers[0]].Size
+	if baseSize != int64(4096+len("ID=demo\n")) {
+		t.Errorf("基础层大小不正确: %d", baseSize)
+	}
+	stats := cr.storage.DedupStats()
+	if stats.SharedLayers != 1 || stats.BytesSaved != baseSize {
+		t.Errorf("去重统计不正确: %+v，期望复用1层、节省%d字节", stats, baseSize)
+	}
+
+	// 复用的层可以正常准备容器文件系统
+	mountPoint := t.TempDir()
+	if err := cr.storage.PrepareLayer(second, mountPoint); err != nil {
+		t.Fatalf("准备容器文件系统失败: %v", err)
+	}
+	for _, name := range []string{"etc/os-release", "app2"} {
+		if _, err := os.Stat(filepath.Join(mountPoint, filepath.FromSlash(name))); err != nil {
+			t.Errorf("容器文件系统中缺少%s: %v", name, err)
+		}
+	}
+}
+
+func TestSharedLayerRemovedAfterLastContainer(t *testing.T) {
+	cr := newImageTestRuntime(t)
+	base, err := cr.createImageWithLayer(nil, &ImageConfig{}, populateBaseLayer)
+	if err != nil {
+		t.Fatalf("创建基础层失败: %v", err)
+	}
+	baseLayer := base.Layers[0]
+
+	newContainer := func() *Container {
+		t.Helper()
+		container := &Container{ID: generateContainerID(), Image: base}
+		mountPoint := filepath.Join(cr.config.RootDirectory, "containers", container.ID, "layer")
+		if err := cr.storage.PrepareLayer(base, mountPoint); err != nil {
+			t.Fatalf("准备容器文件系统失败: %v", err)
+		}
+		return container
+	}
+	first, second := newContainer(), newContainer()
+	if n := cr.storage.LayerRefCount(baseLayer); n != 2 {
+		t.Fatalf("两个容器共享基础层时引用计数应为2，实际为%d", n)
+	}
+
+	cr.cleanupContainer(first)
+	if n := cr.storage.LayerRefCount(baseLayer); n != 1 {
+		t.Errorf("删除第一个容器后引用计数应为1，实际为%d", n)
+	}
+	if n := countOverlayLayers(t, cr); n != 1 || !cr.storage.hasLayer(baseLayer) {
+		t.Fatalf("仍被引用的基础层不应被删除，磁盘上有%d个层", n)
+	}
+
+	cr.cleanupContainer(second)
+	if n := cr.storage.LayerRefCount(baseLayer); n != 0 {
+		t.Errorf("删除第二个容器后引用计数应为0，实际为%d", n)
+	}
+	if n := countOverlayLayers(t, cr); n != 0 || cr.storage.hasLayer(baseLayer) {
+		t.Errorf("不再被引用的基础层应被删除，磁盘上仍有%d个层", n)
+	}
+}
+
+func TestPrepareFilesystemReleasesLayersOnFailure(t *testing.T) {
+	originalMount := mountTmpfs
+	mountTmpfs = func(mount *Mount) error { return errors.New("mount not permitted") }
+	defer func() { mountTmpfs = originalMount }()
+
+	cr := newImageTestRuntime(t)
+	base, err := cr.createImageWithLayer(nil, &ImageConfig{}, populateBaseLayer)
+	if err != nil {
+		t.Fatalf("创建基础层失败: %v", err)
+	}
+
+	container := &Container{
+		ID:     generateContainerID(),
+		Image:  base,
+		Config: &ContainerConfig{Tmpfs: map[string]string{"/tmp": ""}},
+	}
+	if err := cr.prepareFilesystem(container); err == nil {
+		t.Fatal("tmpfs挂载失败时准备文件系统应失败")
+	}
+	if n := cr.storage.LayerRefCount(base.Layers[0]); n != 0 {
+		t.Errorf("准备文件系统失败后应释放层引用，引用计数为%d", n)
+	}
+	if n := countOverlayLayers(t, cr); n != 0 {
+		t.Errorf("不再被引用的层应被删除，磁盘上仍有%d个层", n)
+	}
+}
+
+func TestRegisteredImageKeepsLayers(t *testing.T) {
+	cr := newImageTestRuntime(t)
+	image, err := cr.createImageWithLayer(nil, &ImageConfig{}, populateBaseLayer)
+	if err != nil {
+		t.Fatalf("创建基础层失败: %v", err)
+	}
+	cr.registerImage(image, "base:latest")
+	cr.registerImage(image, "base:v1")
+
+	container := &Container{ID: generateContainerID(), Image: image}
+	if err := cr.storage.PrepareLayer(image, t.TempDir()); err != nil {
+		t.Fatalf("准备容器文件系统失败: %v", err)
+	}
+	if n := cr.storage.LayerRefCount(image.Layers[0]); n != 2 {
+		t.Fatalf("镜像和容器各持有一次引用，实际为%d", n)
+	}
+
+	cr.cleanupContainer(container)
+	if n := cr.storage.LayerRefCount(image.Layers[0]); n != 1 || countOverlayLayers(t, cr) != 1 {
+		t.Errorf("镜像仍引用的层不应随容器删除，引用计数为%d", n)
+	}
+}
+
+func TestLoadImageReusesLayerWithSameContent(t *testing.T) {
+	source := newImageTestRuntime(t)
+	base, err := source.createImageWithLayer(nil, &ImageConfig{}, populateBaseLayer)
+	if err != nil {
+		t.Fatalf("创建基础层失败: %v", err)
+	}
+	image, err := source.createImageWithLayer(base, &ImageConfig{}, func(diffPath string) error {
+		return os.WriteFile(filepath.Join(diffPath, "app"), []byte("app"), 0644)
+	})
+	if err != nil {
+		t.Fatalf("创建应用层失败: %v", err)
+	}
+	source.registerImage(image, "app:latest")
+
+	var archive bytes.Buffer
+	if err := source.SaveImage(image.ID, &archive, SaveOptions{Compression: CompressionGzip}); err != nil {
+		t.Fatalf("导出镜像失败: %v", err)
+	}
+
+	// 目标运行时已有内容相同、ID不同的基础层
+	target := newImageTestRuntime(t)
+	localBase, err := target.createImageWithLayer(nil, &ImageConfig{}, populateBaseLayer)
+	if err != nil {
+		t.Fatalf("创建本地基础层失败: %v", err)
+	}
+	if localBase.Layers[0] == base.Layers[0] {
+		t.Fatal("测试前提：两个运行时的基础层ID应不同")
+	}
+
+	loaded, err := target.LoadImage(&archive)
+	if err != nil {
+		t.Fatalf("导入镜像失败: %v", err)
+	}
+	if loaded.Layers[0] != localBase.Layers[0] {
+		t.Errorf("导入的基础层应引用本地已有层%s，实际为%s", localBase.Layers[0], loaded.Layers[0])
+	}
+	if loaded.Layers[1] != strings.TrimPrefix(source.storage.layers[image.Layers[1]].Digest, "sha256:") {
+		t.Errorf("应用层应按归档中的摘要ID创建，实际为%s", loaded.Layers[1])
+	}
+	if target.storage.hasLayer(base.Layers[0]) {
+		t.Error("内容重复的基础层不应再次创建")
+	}
+	if n := countOverlayLayers(t, target); n != 2 {
+		t.Errorf("期望磁盘上有2个层，实际为%d", n)
+	}
+
+	stats := target.storage.DedupStats()
+	if stats.SharedLayers != 1 || stats.BytesSaved != target.storage.layers[localBase.Layers[0]].Size {
+		t.Errorf("去重统计不正确: %+v", stats)
+	}
+}
+
+// ==================
+// 30. 容器文件复制
+// ==================
+
+// prepareContainerRootfs 为测试容器创建合并后的根文件系统目录
+func prepareContainerRootfs(t *testing.T, cr *ContainerRuntime, container *Container, dirs ...string) string {
+	t.Helper()
+	rootfs := cr.containerRootfs(container)
+	for _, dir := range append([]string{""}, dirs...) {
+		if err := os.MkdirAll(filepath.Join(rootfs, dir), 0755); err != nil {
+			t.Fatalf("创建容器目录失败: %v", err)
+		}
+	}
+	return rootfs
+}
+
+func TestCopyToAndFromContainerRoundTrip(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr)
+	rootfs := prepareContainerRootfs(t, cr, container, "opt", "etc")
+
+	src := filepath.Join(t.TempDir(), "app")
+	files := map[string]struct {
+		mode os.FileMode
+		data string
+	}{
+		"config.yaml":    {0640, "port: 8080\n"},
+		"bin/run.sh":     {0755, "#!/bin/sh\necho ok\n"},
+		"data/empty.txt": {0600, ""},
+	}
+	for name, file := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file.data), file.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, file.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(src, "data"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// 目标为已存在的目录时复制到其下同名位置
+	if err := cr.CopyToContainer(container.ID, src, "/opt"); err != nil {
+		t.Fatalf("复制目录到容器失败: %v", err)
+	}
+	for name, file := range files {
+		path := filepath.Join(rootfs, "opt", "app", filepath.FromSlash(name))
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("容器内缺少文件 %s: %v", name, err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != file.mode {
+			t.Errorf("%s 权限 = %v, 期望 %v", name, info.Mode().Perm(), file.mode)
+		}
+	}
+
+	// 单个文件可以复制为新名称
+	if err := cr.CopyToContainer(container.ID, filepath.Join(src, "config.yaml"), "/etc/app.yaml"); err != nil {
+		t.Fatalf("复制文件到容器失败: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(rootfs, "etc", "app.yaml")); err != nil || string(data) != "port: 8080\n" {
+		t.Errorf("复制的文件内容不正确: %q, %v", data, err)
+	}
+
+	reader, err := cr.CopyFromContainer(container.ID, "/opt/app")
+	if err != nil {
+		t.Fatalf("从容器复制失败: %v", err)
+	}
+	defer reader.Close()
+
+	entries := make(map[string]*tar.Header)
+	contents := make(map[string]string)
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("读取tar流失败: %v", err)
+		}
+		entries[header.Name] = header
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[header.Name] = string(data)
+	}
+
+	for _, dir := range []string{"app", "app/bin", "app/data"} {
+		if header, ok := entries[dir]; !ok || header.Typeflag != tar.TypeDir {
+			t.Errorf("归档中缺少目录 %s", dir)
+		}
+	}
+	if runtime.GOOS != "windows" && entries["app/data"].FileInfo().Mode().Perm() != 0700 {
+		t.Errorf("目录权限 = %v, 期望 0700", entries["app/data"].FileInfo().Mode().Perm())
+	}
+	for name, file := range files {
+		header, ok := entries["app/"+name]
+		if !ok {
+			t.Errorf("归档中缺少文件 %s", name)
+			continue
+		}
+		if runtime.GOOS != "windows" && header.FileInfo().Mode().Perm() != file.mode {
+			t.Errorf("归档中 %s 权限 = %v, 期望 %v", name, header.FileInfo().Mode().Perm(), file.mode)
+		}
+		if contents["app/"+name] != file.data {
+			t.Errorf("归档中 %s 内容 = %q, 期望 %q", name, contents["app/"+name], file.data)
+		}
+	}
+}
+
+func TestCopyToContainerRejectsEscape(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr)
+	rootfs := prepareContainerRootfs(t, cr, container, "opt")
+
+	src := filepath.Join(t.TempDir(), "payload")
+	if err := os.WriteFile(src, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dest := range []string{"../payload", "/opt/../../payload", "opt/../../../tmp/payload"} {
+		if err := cr.CopyToContainer(container.ID, src, dest); err == nil {
+			t.Errorf("目标路径 %q 越出容器根目录，期望返回错误", dest)
+		}
+	}
+	if _, err := cr.CopyFromContainer(container.ID, "/../etc/passwd"); err == nil {
+		t.Error("源路径越出容器根目录，期望返回错误")
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// 容器内指向宿主机路径的绝对符号链接应在容器根内解析
+	hostDir := t.TempDir()
+	if err := os.Symlink(hostDir, filepath.Join(rootfs, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(rootfs, filepath.FromSlash(hostDir)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cr.CopyToContainer(container.ID, src, "/escape/payload"); err != nil {
+		t.Fatalf("经由符号链接复制失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(hostDir, "payload")); !os.IsNotExist(err) {
+		t.Error("文件被写到了容器根目录之外")
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, filepath.FromSlash(hostDir), "payload")); err != nil {
+		t.Errorf("文件应写入容器内的链接目标: %v", err)
+	}
+}
+
+func TestCopyContainerErrors(t *testing.T) {
+	cr := newTestRuntime(t)
+	if err := cr.CopyToContainer("missing", t.TempDir(), "/"); err == nil {
+		t.Error("容器不存在时应返回错误")
+	}
+
+	container := addTestContainer(t, cr)
+	if _, err := cr.CopyFromContainer(container.ID, "/"); err == nil {
+		t.Error("根文件系统未准备时应返回错误")
+	}
+
+	prepareContainerRootfs(t, cr, container)
+	if _, err := cr.CopyFromContainer(container.ID, "/missing"); err == nil {
+		t.Error("源路径不存在时应返回错误")
+	}
+	if err := cr.CopyToContainer(container.ID, t.TempDir(), "/no/such/dir"); err == nil {
+		t.Error("目标父目录不存在时应返回错误")
+	}
+
+	readOnly := true
+	container.SecurityContext = &SecurityContext{ReadOnlyRootFilesystem: &readOnly}
+	if err := cr.CopyToContainer(container.ID, t.TempDir(), "/"); err == nil {
+		t.Error("只读根文件系统应拒绝复制")
+	}
+}
+
+// ==================
+// 31. 容器详情
+// ==================
+
+func TestInspectContainerJSONRoundTrip(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "sleep 30")
+	container.Config.Image = "alpine:3.19"
+	container.Config.Env = []string{"PATH=/usr/bin"}
+	container.Config.Labels = map[string]string{"app": "web"}
+	container.Mounts = []*Mount{{Source: "/data", Target: "/var/lib/data", Type: "bind"}}
+	container.Networks = []*NetworkInterface{{Name: "eth0", IPAddresses: []string{"172.17.0.2/16"}, Gateway: "172.17.0.1"}}
+	container.Resources = &ResourceConstraints{Memory: "128Mi", CPU: "500m"}
+
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+	defer func() {
+		if err := cr.RemoveContainer(container.ID, true); err != nil {
+			t.Errorf("清理容器失败: %v", err)
+		}
+	}()
+
+	inspect, err := cr.InspectContainer(container.ID)
+	if err != nil {
+		t.Fatalf("检查容器失败: %v", err)
+	}
+	if !inspect.State.Running || inspect.State.Status != StatusRunning || inspect.State.Pid <= 0 {
+		t.Errorf("详情应反映运行中的状态: %+v", inspect.State)
+	}
+	if inspect.StartedAt.IsZero() {
+		t.Error("详情缺少启动时间")
+	}
+
+	data, err := json.Marshal(inspect)
+	if err != nil {
+		t.Fatalf("序列化详情失败: %v", err)
+	}
+	if !strings.Contains(string(data), `"Status":"running"`) {
+		t.Errorf("状态应以名称序列化: %s", data)
+	}
+
+	var decoded ContainerInspect
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("反序列化详情失败: %v", err)
+	}
+	if decoded.ID != container.ID || decoded.Image != "alpine:3.19" || decoded.State.Status != StatusRunning ||
+		decoded.State.Pid != inspect.State.Pid {
+		t.Errorf("反序列化结果不一致: %+v", decoded)
+	}
+	if len(decoded.Mounts) != 1 || decoded.Mounts[0].Target != "/var/lib/data" {
+		t.Errorf("挂载信息不一致: %+v", decoded.Mounts)
+	}
+	if len(decoded.Networks) != 1 || decoded.Networks[0].IPAddresses[0] != "172.17.0.2/16" {
+		t.Errorf("网络信息不一致: %+v", decoded.Networks)
+	}
+	if decoded.Resources == nil || decoded.Resources.Memory != "128Mi" || decoded.Config.Labels["app"] != "web" {
+		t.Errorf("资源限制或配置不一致: %+v %+v", decoded.Resources, decoded.Config)
+	}
+	if !decoded.StartedAt.Equal(inspect.StartedAt) {
+		t.Errorf("启动时间不一致: %v != %v", decoded.StartedAt, inspect.StartedAt)
+	}
+}
+
+func TestInspectContainerIsDeepCopy(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "true")
+	container.Config.Labels = map[string]string{"app": "web"}
+	container.Mounts = []*Mount{{Target: "/data"}}
+	container.Networks = []*NetworkInterface{{Name: "eth0", IPAddresses: []string{"10.0.0.2/24"}}}
+
+	inspect, err := cr.InspectContainer(container.ID)
+	if err != nil {
+		t.Fatalf("检查容器失败: %v", err)
+	}
+	inspect.Config.Cmd[0] = "false"
+	inspect.Config.Labels["app"] = "db"
+	inspect.Mounts[0].Target = "/other"
+	inspect.Networks[0].IPAddresses[0] = "10.0.0.3/24"
+
+	if container.Config.Cmd[0] != "true" || container.Config.Labels["app"] != "web" {
+		t.Error("修改详情不应影响容器配置")
+	}
+	if container.Mounts[0].Target != "/data" || container.Networks[0].IPAddresses[0] != "10.0.0.2/24" {
+		t.Error("修改详情不应影响容器挂载和网络")
+	}
+
+	var status ContainerStatus
+	if err := status.UnmarshalText([]byte("bogus")); err == nil {
+		t.Error("未知状态名应返回错误")
+	}
+}
+
+// ==================
+// 32. 自动删除与已退出容器回收
+// ==================
+
+// containerExists 判断容器是否仍注册在运行时中
+func containerExists(cr *ContainerRuntime, id string) bool {
+	cr.mutex.RLock()
+	defer cr.mutex.RUnlock()
+	_, exists := cr.containers[id]
+	return exists
+}
+
+func TestAutoRemoveContainerAfterExit(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "exit 3")
+	container.Config.AutoRemove = true
+
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for containerExists(cr, container.ID) {
+		if time.Now().After(deadline) {
+			t.Fatal("AutoRemove容器退出后未被删除")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// die事件必须先于remove事件记录
+	events, err := cr.eventLog.Query(EventQuery{
+		Container: container.ID,
+		Types:     []EventType{EventContainerDie, EventContainerRemove},
+	})
+	if err != nil {
+		t.Fatalf("查询事件失败: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != EventContainerDie || events[1].Type != EventContainerRemove {
+		t.Errorf("期望依次记录die和remove事件，实际为%v", events)
+	}
+}
+
+func TestAutoRemoveSkipsRestartingContainer(t *testing.T) {
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "true")
+	container.Config.AutoRemove = true
+	container.setState(func(state *ContainerState) {
+		state.Status = StatusExited
+		state.Restarting = true
+	})
+
+	cr.autoRemoveContainer(container)
+	if !containerExists(cr, container.ID) {
+		t.Error("正在重启的容器不应被自动删除")
+	}
+}
+
+func TestReapExitedContainers(t *testing.T) {
+	cr := newTestRuntime(t)
+	now := time.Now()
+	exited := func(finished time.Time) *Container {
+		container := addTestContainer(t, cr, "true")
+		container.setState(func(state *ContainerState) {
+			state.Status = StatusExited
+			state.FinishedAt = finished
+		})
+		return container
+	}
+	old := exited(now.Add(-2 * time.Hour))
+	recent := exited(now.Add(-time.Minute))
+	created := addTestContainer(t, cr, "true")
+
+	// 保留时长为0时不回收
+	cr.reapExitedContainers(now)
+	if !containerExists(cr, old.ID) {
+		t.Fatal("未配置保留时长时不应回收容器")
+	}
+
+	cr.config.ExitedRetention = time.Hour
+	cr.reapExitedContainers(now)
+	if containerExists(cr, old.ID) {
+		t.Error("超过保留时长的已退出容器应被回收")
+	}
+	if !containerExists(cr, recent.ID) || !containerExists(cr, created.ID) {
+		t.Error("未超过保留时长或未退出的容器不应被回收")
+	}
+}
+
+// ==================
+// 33. 重启策略
+// ==================
+
+// setRestartBackoff 在测试期间替换重启退避参数
+func setRestartBackoff(t *testing.T, base, max time.Duration) {
+	t.Helper()
+	oldBase, oldMax := restartBackoffBase, restartBackoffMax
+	restartBackoffBase, restartBackoffMax = base, max
+	t.Cleanup(func() {
+		restartBackoffBase, restartBackoffMax = oldBase, oldMax
+	})
+}
+
+// waitForSettledExit 等待容器退出且不再处于重启等待中
+func waitForSettledExit(t *testing.T, container *Container, timeout time.Duration) *ContainerState {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		state := container.Snapshot()
+		if state.Status == StatusExited && !state.Restarting {
+			return state
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("容器未在%v内停止重启，当前状态为%s", timeout, state.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRestartPolicyOnFailureRetriesWithBackoff(t *testing.T) {
+	setRestartBackoff(t, 50*time.Millisecond, time.Second)
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "exit 2")
+	container.Config.RestartPolicy = RestartPolicyOnFailure
+	container.Config.MaxRetries = 2
+
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+	state := waitForSettledExit(t, container, 5*time.Second)
+	if state.ExitCode != 2 {
+		t.Errorf("期望退出码为2，实际为%d", state.ExitCode)
+	}
+
+	inspect, err := cr.InspectContainer(container.ID)
+	if err != nil {
+		t.Fatalf("检查容器失败: %v", err)
+	}
+	if inspect.RestartCount != 2 {
+		t.Errorf("期望重启2次后放弃，实际重启%d次", inspect.RestartCount)
+	}
+
+	events, err := cr.eventLog.Query(EventQuery{
+		Container: container.ID,
+		Types:     []EventType{EventContainerDie, EventContainerRestart},
+	})
+	if err != nil {
+		t.Fatalf("查询事件失败: %v", err)
+	}
+	expected := []EventType{EventContainerDie, EventContainerRestart, EventContainerDie, EventContainerRestart, EventContainerDie}
+	if len(events) != len(expected) {
+		t.Fatalf("期望%d个事件，实际为%d", len(expected), len(events))
+	}
+	for i, event := range events {
+		if event.Type != expected[i] {
+			t.Fatalf("第%d个事件期望为%s，实际为%s", i, expected[i], event.Type)
+		}
+	}
+
+	// 每次重启前的等待时间翻倍
+	for i, minDelay := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond} {
+		if delay := events[2*i+1].Timestamp.Sub(events[2*i].Timestamp); delay < minDelay {
+			t.Errorf("第%d次重启前只等待了%v，期望至少%v", i+1, delay, minDelay)
+		}
+	}
+}
+
+func TestRestartPolicyNeverDoesNotRestart(t *testing.T) {
+	setRestartBackoff(t, 10*time.Millisecond, time.Second)
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "exit 1")
+	container.Config.RestartPolicy = RestartPolicyNever
+
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+	waitForSettledExit(t, container, 5*time.Second)
+	time.Sleep(100 * time.Millisecond)
+
+	if status := container.Status(); status != StatusExited {
+		t.Errorf("Never策略的容器不应重启，当前状态为%s", status)
+	}
+	events, err := cr.eventLog.Query(EventQuery{Container: container.ID, Types: []EventType{EventContainerRestart}})
+	if err != nil {
+		t.Fatalf("查询事件失败: %v", err)
+	}
+	if len(events) != 0 || container.RestartCount != 0 {
+		t.Errorf("Never策略不应产生重启，事件数%d，重启次数%d", len(events), container.RestartCount)
+	}
+}
+
+func TestRestartPolicyAlwaysStopsOnExplicitStop(t *testing.T) {
+	setRestartBackoff(t, 10*time.Millisecond, 20*time.Millisecond)
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "sh", "-c", "exit 0")
+	container.Config.RestartPolicy = RestartPolicyAlways
+
+	if err := cr.StartContainer(container.ID); err != nil {
+		t.Fatalf("启动容器失败: %v", err)
+	}
+
+	// Always策略即使退出码为0也会重启
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		container.mutex.RLock()
+		count := container.RestartCount
+		container.mutex.RUnlock()
+		if count >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Always策略的容器未重启，重启次数%d", count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 进程可能正在运行，也可能在等待重启，两种情况下停止都应终止重启循环
+	if err := cr.StopContainer(container.ID, time.Second); err != nil {
+		t.Fatalf("停止容器失败: %v", err)
+	}
+	waitForSettledExit(t, container, 5*time.Second)
+
+	container.mutex.RLock()
+	stopped := container.RestartCount
+	container.mutex.RUnlock()
+	time.Sleep(100 * time.Millisecond)
+
+	container.mutex.RLock()
+	defer container.mutex.RUnlock()
+	if container.RestartCount != stopped || container.Status() != StatusExited {
+		t.Errorf("显式停止后不应再重启，重启次数%d -> %d，状态%s", stopped, container.RestartCount, container.Status())
+	}
+}
+
+func TestShouldRestartAndBackoff(t *testing.T) {
+	setRestartBackoff(t, 100*time.Millisecond, time.Second)
+
+	tests := []struct {
+		policy     RestartPolicy
+		maxRetries int
+		failed     bool
+		count      int
+		expected   bool
+	}{
+		{"", 0, true, 0, false},
+		{RestartPolicyNever, 0, true, 0, false},
+		{RestartPolicyAlways, 0, false, 100, true},
+		{RestartPolicyOnFailure, 3, false, 0, false},
+		{RestartPolicyOnFailure, 3, true, 2, true},
+		{RestartPolicyOnFailure, 3, true, 3, false},
+		{RestartPolicyOnFailure, 0, true, defaultRestartMaxRetries, false},
+	}
+	for _, tt := range tests {
+		config := &ContainerConfig{RestartPolicy: tt.policy, MaxRetries: tt.maxRetries}
+		if got := shouldRestart(config, tt.failed, tt.count); got != tt.expected {
+			t.Errorf("shouldRestart(%q, max=%d, failed=%v, count=%d) = %v, 期望 %v",
+				tt.policy, tt.maxRetries, tt.failed, tt.count, got, tt.expected)
+		}
+	}
+
+	for count, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if got := restartBackoff(count); got != expected {
+			t.Errorf("restartBackoff(%d) = %v, 期望 %v", count, got, expected)
+		}
+	}
+}
+
+// ==================
+// 34. OOM检测
+// ==================
+
+func TestMonitorDetectsOOMKill(t *testing.T) {
+	tests := []struct {
+		version int
+		file    string
+		format  string
+	}{
+		{1, "memory.oom_control", "oom_kill_disable 0\nunder_oom 0\noom_kill %d\n"},
+		{2, "memory.events", "low 0\nhigh 0\nmax 12\noom 1\noom_kill %d\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("v%d", tt.version), func(t *testing.T) {
+			cr := newTestRuntime(t)
+			cr.cgroups.version = tt.version
+			container := addTestContainer(t, cr, "sleep", "10")
+			container.State.Status = StatusRunning
+			container.State.Running = true
+			memoryDir := t.TempDir()
+			container.Cgroups["memory"] = &Cgroup{Subsystem: "memory", Path: memoryDir}
+
+			events := make(chan *ContainerEvent, 2)
+			cr.eventBus.Subscribe(EventContainerOOM, func(event *ContainerEvent) { events <- event })
+			writeEvents := func(count int) {
+				if err := os.WriteFile(filepath.Join(memoryDir, tt.file), []byte(fmt.Sprintf(tt.format, count)), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			writeEvents(0)
+			cr.monitorContainers()
+			if container.Snapshot().OOMKilled {
+				t.Fatal("OOM计数为0时不应标记OOMKilled")
+			}
+
+			writeEvents(1)
+			cr.monitorContainers()
+			if !container.Snapshot().OOMKilled {
+				t.Error("OOM计数增加后应标记OOMKilled")
+			}
+			select {
+			case event := <-events:
+				if event.Container != container {
+					t.Errorf("OOM事件的容器不正确: %v", event.ContainerID)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("未收到OOM事件")
+			}
+
+			// 计数不变时不重复发布
+			cr.monitorContainers()
+			select {
+			case <-events:
+				t.Error("OOM计数未变化时不应重复发布事件")
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestOOMKillCountMissingField(t *testing.T) {
+	cm := NewCgroupManager()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "memory.events"), []byte("low 0\nhigh 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.OOMKillCount(&Cgroup{Path: dir}); err == nil {
+		t.Error("缺少oom_kill字段时应返回错误")
+	}
+}
+
+// ==================
+// 35. cgroup版本检测与接口文件
+// ==================
+
+// newFakeCgroupV1Root 创建一个模拟cgroup v1挂载点的目录，每个控制器一个层级
+func newFakeCgroupV1Root(t *testing.T, controllers ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, controller := range controllers {
+		if err := os.MkdirAll(filepath.Join(root, controller), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// readCgroupFile 读取cgroup接口文件内容
+func readCgroupFile(t *testing.T, cgroup *Cgroup, file string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(cgroup.Path, file))
+	if err != nil {
+		t.Fatalf("读取%s失败: %v", file, err)
+	}
+	return string(data)
+}
+
+func TestDetectCgroupVersion(t *testing.T) {
+	if version := detectCgroupVersion(newFakeCgroupRoot(t, "cpu memory")); version != 2 {
+		t.Errorf("存在cgroup.controllers时应识别为v2，实际为v%d", version)
+	}
+	if version := detectCgroupVersion(newFakeCgroupV1Root(t, "memory", "cpu")); version != 1 {
+		t.Errorf("按控制器分层的挂载点应识别为v1，实际为v%d", version)
+	}
+	if version := detectCgroupVersion(filepath.Join(t.TempDir(), "missing")); version != 2 {
+		t.Errorf("挂载点不存在时应默认为v2，实际为v%d", version)
+	}
+}
+
+func TestCgroupV1InterfaceFiles(t *testing.T) {
+	root := newFakeCgroupV1Root(t, "memory", "cpu")
+	cm := newCgroupManager(root)
+	if cm.version != 1 {
+		t.Fatalf("期望检测为v1，实际为v%d", cm.version)
+	}
+
+	memory, err := cm.CreateCgroup("memory", "c1")
+	if err != nil {
+		t.Fatalf("创建memory cgroup失败: %v", err)
+	}
+	cpu, err := cm.CreateCgroup("cpu", "c1")
+	if err != nil {
+		t.Fatalf("创建cpu cgroup失败: %v", err)
+	}
+	if memory.Path != filepath.Join(root, "memory", defaultCgroupParent, "c1") {
+		t.Errorf("v1的cgroup应位于控制器层级下: %s", memory.Path)
+	}
+
+	if err := cm.SetMemoryLimit(memory, 64<<20); err != nil {
+		t.Fatalf("设置内存限制失败: %v", err)
+	}
+	if err := cm.SetCPUQuota(cpu, 50000, 100000); err != nil {
+		t.Fatalf("设置CPU配额失败: %v", err)
+	}
+	if err := cm.AddProcess(memory, 1234); err != nil {
+		t.Fatalf("加入进程失败: %v", err)
+	}
+
+	if got := readCgroupFile(t, memory, "memory.limit_in_bytes"); got != "67108864" {
+		t.Errorf("memory.limit_in_bytes = %q", got)
+	}
+	if got := readCgroupFile(t, cpu, "cpu.cfs_quota_us"); got != "50000" {
+		t.Errorf("cpu.cfs_quota_us = %q", got)
+	}
+	if got := readCgroupFile(t, cpu, "cpu.cfs_period_us"); got != "100000" {
+		t.Errorf("cpu.cfs_period_us = %q", got)
+	}
+	if got := readCgroupFile(t, memory, "tasks"); got != "1234" {
+		t.Errorf("tasks = %q", got)
+	}
+	for _, file := range []string{"memory.max", "cgroup.procs"} {
+		if _, err := os.Stat(filepath.Join(memory.Path, file)); !os.IsNotExist(err) {
+			t.Errorf("v1下不应写入%s", file)
+		}
+	}
+
+	// v1下各控制器的层级相互独立
+	if err := cm.SetMemoryLimit(cpu, 1<<20); err == nil {
+		t.Error("向cpu cgroup设置内存限制应返回错误")
+	}
+}
+
+func TestCgroupV2InterfaceFiles(t *testing.T) {
+	root := newFakeCgroupRoot(t, "cpu memory")
+	cm := newCgroupManager(root)
+	if cm.version != 2 {
+		t.Fatalf("期望检测为v2，实际为v%d", cm.version)
+	}
+	cgroup := &Cgroup{Subsystem: "unified", Path: t.TempDir(), Limits: make(map[string]interface{})}
+
+	if err := cm.SetMemoryLimit(cgroup, 64<<20); err != nil {
+		t.Fatalf("设置内存限制失败: %v", err)
+	}
+	if err := cm.SetCPUQuota(cgroup, -1, 100000); err != nil {
+		t.Fatalf("设置CPU配额失败: %v", err)
+	}
+	if err := cm.AddProcess(cgroup, 1234); err != nil {
+		t.Fatalf("加入进程失败: %v", err)
+	}
+
+	if got := readCgroupFile(t, cgroup, "memory.max"); got != "67108864" {
+		t.Errorf("memory.max = %q", got)
+	}
+	if got := readCgroupFile(t, cgroup, "cpu.max"); got != "max 100000" {
+		t.Errorf("cpu.max = %q", got)
+	}
+	if got := readCgroupFile(t, cgroup, "cgroup.procs"); got != "1234" {
+		t.Errorf("cgroup.procs = %q", got)
+	}
+	if err := cm.SetCPUQuota(cgroup, 50000, 0); err == nil {
+		t.Error("period为0时应返回错误")
+	}
+}
+
+// ==================
+// 36. 块设备IO限制
+// ==================
+
+func TestBlkioLimits(t *testing.T) {
+	tests := []struct {
+		version   int
+		subsystem string
+		files     map[string]string
+		badWeight uint16
+	}{
+		{1, "blkio", map[string]string{
+			"blkio.weight":                    "500",
+			"blkio.throttle.read_bps_device":  "8:0 1048576",
+			"blkio.throttle.write_bps_device": "8:0 0",
+		}, 5},
+		{2, "unified", map[string]string{
+			"io.weight": "default 500",
+			"io.max":    "8:0 rbps=1048576 wbps=max",
+		}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("v%d", tt.version), func(t *testing.T) {
+			cm := NewCgroupManager()
+			cm.version = tt.version
+			cgroup := &Cgroup{Subsystem: tt.subsystem, Path: t.TempDir(), Limits: make(map[string]interface{})}
+
+			if err := cm.SetBlkioWeight(cgroup, 500); err != nil {
+				t.Fatalf("设置IO权重失败: %v", err)
+			}
+			if err := cm.SetIOMax(cgroup, "8:0", 1<<20, 0); err != nil {
+				t.Fatalf("设置IO带宽失败: %v", err)
+			}
+			for file, expected := range tt.files {
+				if got := readCgroupFile(t, cgroup, file); got != expected {
+					t.Errorf("%s = %q, 期望 %q", file, got, expected)
+				}
+			}
+
+			if err := cm.SetBlkioWeight(cgroup, tt.badWeight); err == nil {
+				t.Errorf("权重%d超出范围，期望返回错误", tt.badWeight)
+			}
+
+			stats, err := cm.GetStats(cgroup)
+			if err != nil {
+				t.Fatalf("读取统计失败: %v", err)
+			}
+			blkio, ok := stats["blkio"].(map[string]interface{})
+			if !ok {
+				t.Fatalf("统计中缺少blkio: %v", stats)
+			}
+			if blkio["weight"] != uint16(500) {
+				t.Errorf("统计中的权重不正确: %v", blkio["weight"])
+			}
+			devices, _ := blkio["io_max"].(map[string]IOLimit)
+			if devices["8:0"] != (IOLimit{ReadBps: 1 << 20}) {
+				t.Errorf("统计中的带宽限制不正确: %v", devices)
+			}
+		})
+	}
+}
+
+func TestSetIOMaxRejectsInvalidInput(t *testing.T) {
+	cm := NewCgroupManager()
+	cm.version = 2
+	cgroup := &Cgroup{Path: t.TempDir(), Limits: make(map[string]interface{})}
+	for _, device := range []string{"", "8", "sda", "8:", ":0", "8:0:1", "-1:0"} {
+		if err := cm.SetIOMax(cgroup, device, 1, 1); err == nil {
+			t.Errorf("设备号%q格式错误，期望返回错误", device)
+		}
+	}
+	if err := cm.SetBlkioWeight(cgroup, 10001); err == nil {
+		t.Error("v2权重超过10000应返回错误")
+	}
+
+	cm.version = 1
+	if err := cm.SetBlkioWeight(&Cgroup{Subsystem: "memory", Path: t.TempDir()}, 500); err == nil {
+		t.Error("v1下向非blkio cgroup设置权重应返回错误")
+	}
+}
+
+// ==================
+// 37. 进程数限制
+// ==================
+
+func TestCreateCgroupsAppliesPidsLimit(t *testing.T) {
+	tests := []struct {
+		version   int
+		root      func(t *testing.T) string
+		container int64
+		expected  string
+	}{
+		{1, func(t *testing.T) string { return newFakeCgroupV1Root(t, "pids") }, 0, "100"},
+		{2, func(t *testing.T) string { return newFakeCgroupRoot(t, "cpu memory pids") }, 0, "100"},
+		{2, func(t *testing.T) string { return newFakeCgroupRoot(t, "cpu memory pids") }, 50, "50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("v%d-%d", tt.version, tt.container), func(t *testing.T) {
+			cr := NewContainerRuntime(RuntimeConfig{
+				RootDirectory:  t.TempDir(),
+				StateDirectory: t.TempDir(),
+				CgroupVersion:  tt.version,
+				PidsLimit:      100,
+			})
+			t.Cleanup(func() { cr.Stop() })
+			cr.cgroups.mountPoint = tt.root(t)
+
+			container := addTestContainer(t, cr, "true")
+			container.Config.PidsLimit = tt.container
+			if err := cr.createCgroups(container); err != nil {
+				t.Fatalf("创建cgroup失败: %v", err)
+			}
+
+			pids := container.Cgroups["pids"]
+			if pids == nil {
+				t.Fatal("应创建pids cgroup")
+			}
+			if got := readCgroupFile(t, pids, "pids.max"); got != tt.expected {
+				t.Errorf("pids.max = %q, 期望 %q", got, tt.expected)
+			}
+
+			// 统计中读取当前进程数
+			if err := os.WriteFile(filepath.Join(pids.Path, "pids.current"), []byte("7\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			stats, err := cr.cgroups.GetStats(pids)
+			if err != nil {
+				t.Fatalf("读取统计失败: %v", err)
+			}
+			pidStats, _ := stats["pids"].(map[string]int64)
+			if pidStats["current"] != 7 || strconv.FormatInt(pidStats["limit"], 10) != tt.expected {
+				t.Errorf("pids统计不正确: %v", pidStats)
+			}
+		})
+	}
+}
+
+func TestSetPidsLimitRejectsNonPositive(t *testing.T) {
+	cm := NewCgroupManager()
+	cgroup := &Cgroup{Subsystem: "pids", Path: t.TempDir(), Limits: make(map[string]interface{})}
+	for _, limit := range []int64{0, -1} {
+		if err := cm.SetPidsLimit(cgroup, limit); err == nil {
+			t.Errorf("进程数上限%d应被拒绝", limit)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cgroup.Path, "pids.max")); !os.IsNotExist(err) {
+		t.Error("无效上限不应写入pids.max")
+	}
+
+	cr := newTestRuntime(t)
+	container := addTestContainer(t, cr, "true")
+	container.Config.PidsLimit = -5
+	if err := cr.createCgroups(container); err == nil {
+		t.Error("容器配置负数进程数上限时应返回错误")
+	}
+}
+
+// ==================
+// 38. VXLAN覆盖网络
+// ==================
+
+func TestParseOverlayOptions(t *testing.T) {
+	opts, err := parseOverlayOptions(map[string]string{
+		"vxlan.id":     "42",
+		"vxlan.local":  "192.168.1.10",
+		"vxlan.device": "eth0",
+		"vxlan.peers":  " 192.168.1.11, 02:42:ac:11:00:02@192.168.1.12 ,",
+	})
+	if err != nil {
+		t.Fatalf("解析选项失败: %v", err)
+	}
+	if opts.VNI != 42 || opts.Port != defaultVXLANPort || opts.Local != "192.168.1.10" || opts.Device != "eth0" {
+		t.Errorf("选项解析不正确: %+v", opts)
+	}
+	expectedPeers := []overlayPeer{
+		{Address: "192.168.1.11"},
+		{MAC: "02:42:ac:11:00:02", Address: "192.168.1.12"},
+	}
+	if !reflect.DeepEqual(opts.Peers, expectedPeers) {
+		t.Errorf("对端解析不正确: %+v", opts.Peers)
+	}
+
+	invalid := []map[string]string{
+		{},
+		{"vxlan.id": "0"},
+		{"vxlan.id": "16777216"},
+		{"vxlan.id": "abc"},
+		{"vxlan.id": "1", "vxlan.port": "70000"},
+		{"vxlan.id": "1", "vxlan.local": "not-an-ip"},
+		{"vxlan.id": "1", "vxlan.device": "eth0; reboot"},
+		{"vxlan.id": "1", "vxlan.peers": "10.0.0.1,host.example"},
+		{"vxlan.id": "1", "vxlan.peers": "zz:zz@10.0.0.1"},
+	}
+	for _, options := range invalid {
+		if _, err := parseOverlayOptions(options); err == nil {
+			t.Errorf("期望拒绝选项%v", options)
+		}
+	}
+}
+
+func TestOverlayCommandConstruction(t *testing.T) {
+	opts := overlayOptions{VNI: 100, Port: 8472, Local: "10.0.0.1", Device: "eth1"}
+	commands := overlayDataPathCommands("ov-test", "vx-test", opts)
+	expected := [][]string{
+		{"ip", "link", "add", "ov-test", "type", "bridge"},
+		{"ip", "link", "add", "vx-test", "type", "vxlan", "id", "100", "dstport", "8472", "local", "10.0.0.1", "dev", "eth1"},
+		{"ip", "link", "set", "vx-test", "master", "ov-test"},
+		{"ip", "link", "set", "vx-test", "up"},
+		{"ip", "link", "set", "ov-test", "up"},
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("数据通路命令不正确:\n%v\n期望:\n%v", commands, expected)
+	}
+
+	fdb := overlayFDBCommands("vx-test", []overlayPeer{
+		{Address: "10.0.0.2"},
+		{MAC: "02:42:ac:11:00:02", Address: "10.0.0.3"},
+	})
+	expectedFDB := [][]string{
+		{"bridge", "fdb", "append", "00:00:00:00:00:00", "dev", "vx-test", "dst", "10.0.0.2"},
+		{"bridge", "fdb", "append", "02:42:ac:11:00:02", "dev", "vx-test", "dst", "10.0.0.3"},
+	}
+	if !reflect.DeepEqual(fdb, expectedFDB) {
+		t.Errorf("FDB命令不正确: %v", fdb)
+	}
+
+	bridge, vxlan := overlayInterfaceNames("network_1_2")
+	for _, name := range []string{bridge, vxlan} {
+		if err := validateInterfaceName(name); err != nil {
+			t.Errorf("接口名%s无效: %v", name, err)
+		}
+	}
+	if other, _ := overlayInterfaceNames("network_1_3"); other == bridge {
+		t.Error("不同网络应得到不同的网桥名")
+	}
+}
+
+// stubOverlayCommands 记录覆盖网络命令而不实际执行，failOn匹配命令前缀时返回错误
+func stubOverlayCommands(t *testing.T, failOn string) *[][]string {
+	t.Helper()
+	var executed [][]string
+	original := runOverlayCommands
+	runOverlayCommands = func(commands [][]string) error {
+		for _, args := range commands {
+			if failOn != "" && strings.HasPrefix(strings.Join(args, " "), failOn) {
+				return fmt.Errorf("%s failed", failOn)
+			}
+			executed = append(executed, args)
+		}
+		return nil
+	}
+	t.Cleanup(func() { runOverlayCommands = original })
+	return &executed
+}
+
+func TestOverlayDriverNetworkLifecycle(t *testing.T) {
+	executed := stubOverlayCommands(t, "")
+	ipam := NewIPAddressManager()
+	od := &OverlayDriver{ipam: ipam}
+
+	config := &NetworkConfig{
+		Name:    "ov",
+		Driver:  "overlay",
+		IPAM:    &NetworkIPAM{Config: []IPAMConfig{{Subnet: "10.20.0.0/24"}}},
+		Options: map[string]string{"vxlan.id": "7", "vxlan.peers": "192.168.0.2"},
+	}
+	network, err := od.CreateNetwork(config)
+	if err != nil {
+		t.Fatalf("创建覆盖网络失败: %v", err)
+	}
+	if network.Options["vxlan.id"] != "7" {
+		t.Errorf("网络应保留驱动选项: %v", network.Options)
+	}
+	bridge, vxlan := overlayInterfaceNames(network.ID)
+	last := (*executed)[len(*executed)-1]
+	if !reflect.DeepEqual(last, []string{"bridge", "fdb", "append", overlayFloodMAC, "dev", vxlan, "dst", "192.168.0.2"}) {
+		t.Errorf("最后一条命令应为对端FDB条目，实际为%v", last)
+	}
+
+	containerID := fmt.Sprintf("%064d", 7)
+	endpoint, err := od.CreateEndpoint(network.ID, containerID, "")
+	if err != nil {
+		t.Fatalf("创建端点失败: %v", err)
+	}
+	if endpoint.Interface != "eth0" || endpoint.IPAddress == "" || endpoint.Gateway != "" {
+		t.Errorf("端点配置不正确: %+v", endpoint)
+	}
+	names := od.endpoints[endpointKey(network.ID, containerID)]
+	if !reflect.DeepEqual((*executed)[len(*executed)-2], []string{"ip", "link", "set", names.hostVeth, "master", bridge}) {
+		t.Errorf("veth主机端应挂到覆盖网络网桥%s上", bridge)
+	}
+
+	if err := od.Join(network.ID, containerID); err == nil || !strings.Contains(err.Error(), "runtime lookup") {
+		t.Errorf("未设置RuntimeLookup时加入应失败，实际为%v", err)
+	}
+
+	if err := od.DeleteEndpoint(network.ID, containerID); err != nil {
+		t.Fatalf("删除端点失败: %v", err)
+	}
+	if err := ipam.ReleaseIP("10.20.0.0/24", endpoint.IPAddress); err == nil {
+		t.Error("删除端点后地址应已释放")
+	}
+	if err := od.DeleteNetwork(network.ID); err != nil {
+		t.Fatalf("删除覆盖网络失败: %v", err)
+	}
+	if _, err := ipam.AllocateIP("10.20.0.0/24"); err == nil {
+		t.Error("删除网络后地址池应已移除")
+	}
+}
+
+func TestOverlayDriverCreateNetworkFailureCleansUp(t *testing.T) {
+	stubOverlayCommands(t, "bridge fdb")
+	ipam := NewIPAddressManager()
+	od := &OverlayDriver{ipam: ipam}
+
+	config := &NetworkConfig{
+		Name:    "ov",
+		IPAM:    &NetworkIPAM{Config: []IPAMConfig{{Subnet: "10.21.0.0/24"}}},
+		Options: map[string]string{"vxlan.id": "8", "vxlan.peers": "192.168.0.2"},
+	}
+	if _, err := od.CreateNetwork(config); err == nil {
+		t.Fatal("FDB命令失败时创建网络应返回错误")
+	}
+	if len(od.networks) != 0 {
+		t.Error("失败的网络不应被登记")
+	}
+	// 地址池已回收，同一子网可以再次登记
+	if err := ipam.AddPool("10.21.0.0/24", ""); err != nil {
+		t.Errorf("失败后地址池应已移除: %v", err)
+	}
+
+	if _, err := od.CreateNetwork(&NetworkConfig{Name: "no-ipam", Options: map[string]string{"vxlan.id": "9"}}); err == nil {
+		t.Error("缺少IPAM子网时应返回错误")
+	}
+}
+
+// ==================
+// 39. 事件总线投递
+// ==================
+
+func TestEventBusDeliversInOrder(t *testing.T) {
+	bus := NewContainerEventBus(EventBusConfig{Policy: DeliveryBlock})
+	received := make(chan string, 100)
+	bus.Subscribe(EventContainerStart, func(event *ContainerEvent) { received <- event.Message })
+
+	for i := 0; i < 100; i++ {
+		bus.Publish(&ContainerEvent{Type: EventContainerStart, Message: strconv.Itoa(i)})
+	}
+	for i := 0; i < 100; i++ {
+		select {
+		case message := <-received:
+			if message != strconv.Itoa(i) {
+				t.Fatalf("第%d个事件顺序错误: %s", i, message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("等待第%d个事件超时", i)
+		}
+	}
+}
+
+func TestEventBusSubscribeAllAndUnsubscribe(t *testing.T) {
+	bus := NewContainerEventBus(EventBusConfig{})
+	all := make(chan EventType, 10)
+	allID, _ := bus.SubscribeAll(func(event *ContainerEvent) { all <- event.Type })
+	starts := make(chan EventType, 10)
+	startID, unsubscribe := bus.Subscribe(EventContainerStart, func(event *ContainerEvent) { starts <- event.Type })
+	if allID == startID {
+		t.Fatal("订阅标识应唯一")
+	}
+
+	bus.Publish(&ContainerEvent{Type: EventContainerStart})
+	bus.Publish(&ContainerEvent{Type: EventContainerStop})
+	for _, expected := range []EventType{EventContainerStart, EventContainerStop} {
+		select {
+		case got := <-all:
+			if got != expected {
+				t.Errorf("通配订阅者期望%s，实际为%s", expected, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("通配订阅者未收到事件")
+		}
+	}
+	select {
+	case <-starts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("类型订阅者未收到事件")
+	}
+
+	unsubscribe()
+	unsubscribe() // 重复取消订阅无副作用
+	bus.Publish(&ContainerEvent{Type: EventContainerStart})
+	select {
+	case <-all:
+	case <-time.After(5 * time.Second):
+		t.Fatal("其他订阅者不受取消订阅影响")
+	}
+	select {
+	case <-starts:
+		t.Error("取消订阅后不应再收到事件")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEventBusSlowSubscriberBackpressure(t *testing.T) {
+	t.Run("丢弃", func(t *testing.T) {
+		bus := NewContainerEventBus(EventBusConfig{QueueSize: 1, Policy: DeliveryDrop})
+		release := make(chan struct{})
+		started := make(chan struct{}, 1)
+		id, unsubscribe := bus.Subscribe(EventContainerStart, func(event *ContainerEvent) {
+			started <- struct{}{}
+			<-release
+		})
+		defer unsubscribe()
+
+		// 第一个事件占住处理函数，第二个填满队列，其余被丢弃且不阻塞发布者
+		bus.Publish(&ContainerEvent{Type: EventContainerStart})
+		<-started
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 10; i++ {
+				bus.Publish(&ContainerEvent{Type: EventContainerStart})
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("丢弃策略下发布者不应被慢订阅者阻塞")
+		}
+		if dropped := bus.Dropped(id); dropped != 9 {
+			t.Errorf("期望丢弃9个事件，实际为%d", dropped)
+		}
+		close(release)
+	})
+
+	t.Run("阻塞", func(t *testing.T) {
+		bus := NewContainerEventBus(EventBusConfig{QueueSize: 1, Policy: DeliveryBlock})
+		release := make(chan struct{})
+		started := make(chan struct{}, 1)
+		var delivered int64
+		id, unsubscribe := bus.Subscribe(EventContainerStart, func(event *ContainerEvent) {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+			atomic.AddInt64(&delivered, 1)
+		})
+		defer unsubscribe()
+
+		bus.Publish(&ContainerEvent{Type: EventContainerStart})
+		<-started
+		bus.Publish(&ContainerEvent{Type: EventContainerStart}) // 填满队列
+		done := make(chan struct{})
+		go func() {
+			bus.Publish(&ContainerEvent{Type: EventContainerStart})
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("阻塞策略下队列满时发布者应等待")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		close(release)
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("订阅者消费后发布者应继续")
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt64(&delivered) != 3 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := atomic.LoadInt64(&delivered); got != 3 || bus.Dropped(id) != 0 {
+			t.Errorf("阻塞策略应投递全部3个事件，实际投递%d个，丢弃%d个", got, bus.Dropped(id))
+		}
+	})
+
+	t.Run("取消订阅解除阻塞", func(t *testing.T) {
+		bus := NewContainerEventBus(EventBusConfig{QueueSize: 1, Policy: DeliveryBlock})
+		release := make(chan struct{})
+		defer close(release)
+		started := make(chan struct{}, 1)
+		_, unsubscribe := bus.Subscribe(EventContainerStart, func(event *ContainerEvent) {
+			started <- struct{}{}
+			<-release
+		})
+
+		bus.Publish(&ContainerEvent{Type: EventContainerStart})
+		<-started
+		bus.Publish(&ContainerEvent{Type: EventContainerStart})
+		done := make(chan struct{})
+		go func() {
+			bus.Publish(&ContainerEvent{Type: EventContainerStart})
+			close(done)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		unsubscribe()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("取消订阅后被阻塞的发布者应返回")
+		}
+	})
+}
+
+// ==================
+// 40. 服务ClusterIP与端点
+// ==================
+
+func TestCreateServiceAllocatesUniqueClusterIP(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	co.config.ClusterCIDR = "10.100.0.0/29"
+
+	seen := make(map[string]string)
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("svc-%d", i)
+		service, err := co.CreateService(&Service{Name: name})
+		if err != nil {
+			t.Fatalf("创建服务%s失败: %v", name, err)
+		}
+		if owner, dup := seen[service.ClusterIP]; dup {
+			t.Fatalf("ClusterIP %s 被%s和%s重复使用", service.ClusterIP, owner, name)
+		}
+		if service.Type != ServiceTypeClusterIP || service.Namespace != defaultPodNamespace {
+			t.Errorf("服务默认值不正确: %+v", service)
+		}
+		seen[service.ClusterIP] = name
+	}
+
+	// /29只有6个可用地址
+	if _, err := co.CreateService(&Service{Name: "overflow"}); err == nil || !strings.Contains(err.Error(), "exhausted") {
+		t.Errorf("地址范围耗尽时应返回错误，实际为%v", err)
+	}
+	if _, err := co.CreateService(&Service{Name: "svc-0"}); err == nil {
+		t.Error("同名服务应被拒绝")
+	}
+
+	// 删除后地址可被复用
+	released := co.services[configObjectKey("", "svc-2")].ClusterIP
+	if err := co.DeleteService("", "svc-2"); err != nil {
+		t.Fatalf("删除服务失败: %v", err)
+	}
+	service, err := co.CreateService(&Service{Name: "reuse"})
+	if err != nil {
+		t.Fatalf("释放后创建服务失败: %v", err)
+	}
+	if service.ClusterIP != released {
+		t.Errorf("期望复用ClusterIP %s，实际为%s", released, service.ClusterIP)
+	}
+	if err := co.DeleteService("", "svc-2"); err == nil {
+		t.Error("删除不存在的服务应返回错误")
+	}
+}
+
+func TestCreateServiceRejectsInvalidClusterCIDR(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	co.config.ClusterCIDR = "not-a-cidr"
+	if _, err := co.CreateService(&Service{Name: "web"}); err == nil {
+		t.Error("无效的ClusterCIDR应返回错误")
+	}
+}
+
+// addServiceTestPod 直接登记一个带网络地址的Pod
+func addServiceTestPod(co *ContainerOrchestrator, name string, labels map[string]string, status PodStatus, addresses ...string) {
+	container := &Container{ID: generateContainerID(), State: &ContainerState{}}
+	if len(addresses) > 0 {
+		container.Networks = []*NetworkInterface{{Name: "eth0", IPAddresses: addresses}}
+	}
+	pod := &Pod{
+		ID:         generatePodID(),
+		Name:       name,
+		Namespace:  defaultPodNamespace,
+		Labels:     labels,
+		Containers: []*Container{container},
+		Status:     status,
+	}
+	co.pods[pod.ID] = pod
+}
+
+func TestServiceEndpointsResolvePodAddresses(t *testing.T) {
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	web := map[string]string{"app": "web"}
+	addServiceTestPod(co, "web-1", web, PodRunning, "172.18.0.3/16")
+	addServiceTestPod(co, "web-2", web, PodRunning, "fe80::1", "172.18.0.2")
+	addServiceTestPod(co, "web-pending", web, PodPending, "172.18.0.4")
+	addServiceTestPod(co, "web-no-ip", web, PodRunning)
+	addServiceTestPod(co, "db", map[string]string{"app": "db"}, PodRunning, "172.18.0.9")
+
+	_, err := co.CreateService(&Service{
+		Name:     "web",
+		Selector: web,
+		Ports: []ServicePort{
+			{Name: "http", Port: 80, TargetPort: 8080},
+			{Name: "metrics", Port: 9090},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints, err := co.ServiceEndpoints("", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"172.18.0.2:8080", "172.18.0.2:9090", "172.18.0.3:8080", "172.18.0.3:9090"}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("端点为%v，期望%v", endpoints, expected)
+	}
+
+	if _, err := co.ServiceEndpoints("", "missing"); err == nil {
+		t.Error("查询不存在的服务应返回错误")
+	}
+}
+
+// ==================
+// 41. NodePort服务暴露
+// ==================
+
+// freePortRange 查找n个连续的空闲本地端口，返回"最小值-最大值"形式的范围和最小端口
+func freePortRange(t *testing.T, n int) (string, int32) {
+	t.Helper()
+	for attempt := 0; attempt < 20; attempt++ {
+		probe, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		base := probe.Addr().(*net.TCPAddr).Port
+		probe.Close()
+		if base+n-1 > 65535 {
+			continue
+		}
+
+		var listeners []net.Listener
+		for port := base; port < base+n; port++ {
+			listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+			if err != nil {
+				break
+			}
+			listeners = append(listeners, listener)
+		}
+		for _, listener := range listeners {
+			listener.Close()
+		}
+		if len(listeners) == n {
+			return fmt.Sprintf("%d-%d", base, base+n-1), int32(base)
+		}
+	}
+	t.Fatalf("找不到%d个连续的空闲端口", n)
+	return "", 0
+}
+
+func newNodePortTestOrchestrator(t *testing.T, ports int) (*ContainerOrchestrator, int32) {
+	t.Helper()
+	co := NewContainerOrchestrator(newTestRuntime(t))
+	portRange, min := freePortRange(t, ports)
+	co.config.NodePortRange = portRange
+	co.config.NodePortAddress = "127.0.0.1"
+	t.Cleanup(func() {
+		co.mutex.Lock()
+		defer co.mutex.Unlock()
+		for nodePort := range co.nodePorts {
+			co.releaseNodePortLocked(nodePort)
+		}
+	})
+	return co, min
+}
+
+func TestNodePortAllocationAndRelease(t *testing.T) {
+	co, min := newNodePortTestOrchestrator(t, 2)
+	nodePortService := func(name string, nodePort int32) (*Service, error) {
+		return co.CreateService(&Service{
+			Name:  name,
+			Type:  ServiceTypeNodePort,
+			Ports: []ServicePort{{Port: 80, NodePort: nodePort}},
+		})
+	}
+
+	first, err := nodePortService("first", 0)
+	if err != nil {
+		t.Fatalf("创建NodePort服务失败: %v", err)
+	}
+	if first.Ports[0].NodePort != min {
+		t.Errorf("期望分配%d，实际为%d", min, first.Ports[0].NodePort)
+	}
+	if _, err := nodePortService("dup", min); err == nil || !strings.Contains(err.Error(), "already allocated") {
+		t.Errorf("重复的NodePort应被拒绝，实际为%v", err)
+	}
+	if _, err := nodePortService("outside", min+10); err == nil {
+		t.Error("范围外的NodePort应被拒绝")
+	}
+	second, err := nodePortService("second", 0)
+	if err != nil || second.Ports[0].NodePort != min+1 {
+		t.Fatalf("期望分配%d，实际为%v %v", min+1, second, err)
+	}
+	if _, err := nodePortService("third", 0); err == nil || !strings.Contains(err.Error(), "exhausted") {
+		t.Errorf("范围耗尽时应返回错误，实际为%v", err)
+	}
+	if _, exists := co.services[configObjectKey("", "third")]; exists {
+		t.Error("失败的服务不应被登记")
+	}
+	if _, err := co.CreateService(&Service{Name: "plain", Ports: []ServicePort{{Port: 80, NodePort: min}}}); err == nil {
+		t.Error("ClusterIP服务不应设置NodePort")
+	}
+
+	// 删除后端口归还，可被新服务复用
+	if err := co.DeleteService("", "first"); err != nil {
+		t.Fatal(err)
+	}
+	reused, err := nodePortService("reused", 0)
+	if err != nil || reused.Ports[0].NodePort != min {
+		t.Errorf("期望复用端口%d，实际为%v %v", min, reused, err)
+	}
+}
+
+func TestNodePortForwardsToBackends(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				data, _ := io.ReadAll(conn)
+				conn.Write(append([]byte("echo:"), data...))
+			}(conn)
+		}
+	}()
+	backendPort := int32(backend.Addr().(*net.TCPAddr).Port)
+
+	co, _ := newNodePortTestOrchestrator(t, 1)
+	labels := map[string]string{"app": "echo"}
+	addServiceTestPod(co, "echo-1", labels, PodRunning, "127.0.0.1")
+	service, err := co.CreateService(&Service{
+		Name:     "echo",
+		Type:     ServiceTypeNodePort,
+		Selector: labels,
+		Ports:    []ServicePort{{Port: 80, TargetPort: backendPort}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeAddress := fmt.Sprintf("127.0.0.1:%d", service.Ports[0].NodePort)
+
+	conn, err := net.DialTimeout("tcp", nodeAddress, 5*time.Second)
+	if err != nil {
+		t.Fatalf("连接NodePort失败: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("ping"))
+	conn.(*net.TCPConn).CloseWrite()
+	reply, err := io.ReadAll(conn)
+	conn.Close()
+	if err != nil || string(reply) != "echo:ping" {
+		t.Fatalf("期望经NodePort收到echo:ping，实际为%q %v", reply, err)
+	}
+
+	if err := co.DeleteService("", "echo"); err != nil {
+		t.Fatal(err)
+	}
+	if conn, err := net.DialTimeout("tcp", nodeAddress, time.Second); err == nil {
+		conn.Close()
+		t.Error("删除服务后NodePort应停止监听")
+	}
+}
+
+// ==================
+// 42. 集群指标采样
+// ==================
+
+// writeCgroupStats 向cgroup目录写入一组接口文件，模拟一次内核统计快照
+func writeCgroupStats(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newMetricsTestPod 创建一个容器运行中、cpu与memory共用cgroup目录的Pod
+func newMetricsTestPod(t *testing.T, name, nodeName string) (*Pod, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cgroup := &Cgroup{Path: dir, Limits: make(map[string]interface{})}
+	container := &Container{
+		ID:      generateContainerID(),
+		State:   &ContainerState{Running: true},
+		Cgroups: map[string]*Cgroup{"cpu": cgroup, "memory": cgroup},
+	}
+	return &Pod{ID: generatePodID(), Name: name, NodeName: nodeName, Containers: []*Container{container}}, dir
+}
+
+func TestClusterMonitorComputesCPUAndMemoryFromSnapshots(t *testing.T) {
+	cgroups := newCgroupManager(newFakeCgroupRoot(t, "cpu memory"))
+	monitor := NewClusterMonitor()
+	web, webDir := newMetricsTestPod(t, "web", "node-a")
+	db, dbDir := newMetricsTestPod(t, "db", "node-a")
+	pods := []*Pod{web, db}
+	start := time.Now()
+
+	writeCgroupStats(t, webDir, map[string]string{"cpu.stat": "usage_usec 1000000\nuser_usec 600000\n", "memory.current": "1048576\n"})
+	writeCgroupStats(t, dbDir, map[string]string{"cpu.stat": "usage_usec 5000000\n", "memory.current": "4194304\n"})
+	monitor.CollectMetrics(pods, cgroups, start)
+
+	first, _ := monitor.GetPodMetrics(web.ID)
+	if first.CPUUsage != 0 || first.MemoryUsage != 1048576 {
+		t.Errorf("首次采样CPU应为0、内存为1MiB，实际为%+v", first)
+	}
+
+	// 2秒内web消耗1秒CPU（50%），db消耗3秒CPU（150%）
+	writeCgroupStats(t, webDir, map[string]string{"cpu.stat": "usage_usec 2000000\n", "memory.current": "2097152\n"})
+	writeCgroupStats(t, dbDir, map[string]string{"cpu.stat": "usage_usec 8000000\n", "memory.current": "4194304\n"})
+	now := start.Add(2 * time.Second)
+	monitor.CollectMetrics(pods, cgroups, now)
+
+	webMetrics, ok := monitor.GetPodMetrics(web.ID)
+	if !ok || webMetrics.CPUUsage != 50 || webMetrics.MemoryUsage != 2097152 || !webMetrics.Timestamp.Equal(now) {
+		t.Errorf("web指标不正确: %+v", webMetrics)
+	}
+	dbMetrics, _ := monitor.GetPodMetrics(db.ID)
+	if dbMetrics.CPUUsage != 150 {
+		t.Errorf("db的CPU使用率应为150%%，实际为%v", dbMetrics.CPUUsage)
+	}
+	node, ok := monitor.GetNodeMetrics("node-a")
+	if !ok || node.CPUUsage != 200 || node.MemoryUsage != 2097152+4194304 {
+		t.Errorf("节点指标应为Pod之和，实际为%+v", node)
+	}
+
+	// 累计用量回退时以新值为基准，Pod删除后不再保留指标
+	writeCgroupStats(t, webDir, map[string]string{"cpu.stat": "usage_usec 100\n"})
+	monitor.CollectMetrics([]*Pod{web}, cgroups, now.Add(time.Second))
+	if reset, _ := monitor.GetPodMetrics(web.ID); reset.CPUUsage != 0 {
+		t.Errorf("累计用量回退后CPU应为0，实际为%v", reset.CPUUsage)
+	}
+	if _, exists := monitor.GetPodMetrics(db.ID); exists {
+		t.Error("已删除Pod的指标应被清除")
+	}
+}
+
+func TestClusterMonitorReadsCgroupV1Usage(t *testing.T) {
+	cgroups := newCgroupManager(newFakeCgroupV1Root(t, "cpu", "memory"))
+	if cgroups.version != 1 {
+		t.Fatalf("期望检测为cgroup v1，实际为v%d", cgroups.version)
+	}
+	monitor := NewClusterMonitor()
+	pod, dir := newMetricsTestPod(t, "legacy", "")
+	start := time.Now()
+
+	writeCgroupStats(t, dir, map[string]string{"cpuacct.usage": "1000000000\n", "memory.usage_in_bytes": "8192\n"})
+	monitor.CollectMetrics([]*Pod{pod}, cgroups, start)
+	writeCgroupStats(t, dir, map[string]string{"cpuacct.usage": "1250000000\n"})
+	monitor.CollectMetrics([]*Pod{pod}, cgroups, start.Add(time.Second))
+
+	metrics, _ := monitor.GetPodMetrics(pod.ID)
+	if metrics.CPUUsage != 25 || metrics.MemoryUsage != 8192 {
+		t.Errorf("v1指标不正确: %+v", metrics)
+	}
+	if _, exists := monitor.GetNodeMetrics(""); exists {
+		t.Error("未绑定节点的Pod不应产生节点指标")
+	}
+}
@@ -0,0 +1,91 @@
+//go:build linux
+// +build linux
+
+/*
+Linux 平台的文件系统挂载
+
+将 "nosuid,nodev,size=64m" 形式的选项拆分为挂载标志和文件系统数据后调用 mount(2)，
+以及把目录绑定挂载到容器根文件系统中。
+*/
+package main
+
+import (
+	"os"
+	"strings"
+	"syscall"
+)
+
+// mountFlags 挂载选项到挂载标志的映射，clear为true表示清除该标志
+var mountFlags = map[string]struct {
+	flag  uintptr
+	clear bool
+}{
+	"ro":       {syscall.MS_RDONLY, false},
+	"rw":       {syscall.MS_RDONLY, true},
+	"nosuid":   {syscall.MS_NOSUID, false},
+	"suid":     {syscall.MS_NOSUID, true},
+	"nodev":    {syscall.MS_NODEV, false},
+	"dev":      {syscall.MS_NODEV, true},
+	"noexec":   {syscall.MS_NOEXEC, false},
+	"exec":     {syscall.MS_NOEXEC, true},
+	"noatime":  {syscall.MS_NOATIME, false},
+	"atime":    {syscall.MS_NOATIME, true},
+	"sync":     {syscall.MS_SYNCHRONOUS, false},
+	"async":    {syscall.MS_SYNCHRONOUS, true},
+	"relatime": {syscall.MS_RELATIME, false},
+}
+
+// mountFilesystem 创建挂载点并执行挂载
+func mountFilesystem(mount *Mount) error {
+	// #nosec G301 -- 容器内挂载点，需要0755权限
+	if err := os.MkdirAll(mount.Target, 0755); err != nil {
+		return err
+	}
+
+	var flags uintptr
+	var data []string
+	for _, option := range strings.Split(mount.Options, ",") {
+		if option == "" {
+			continue
+		}
+		if mapping, ok := mountFlags[option]; ok {
+			if mapping.clear {
+				flags &^= mapping.flag
+			} else {
+				flags |= mapping.flag
+			}
+			continue
+		}
+		data = append(data, option)
+	}
+
+	return syscall.Mount(mount.Source, mount.Target, mount.Type, flags, strings.Join(data, ","))
+}
+
+// bindMountFilesystem 将mount.Source绑定挂载到mount.Target。
+// 内核在首次绑定时忽略MS_RDONLY，选项含ro时再以MS_REMOUNT重新挂载为只读
+func bindMountFilesystem(mount *Mount) error {
+	// #nosec G301 -- 容器内挂载点，需要0755权限
+	if err := os.MkdirAll(mount.Target, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount(mount.Source, mount.Target, "", syscall.MS_BIND, ""); err != nil {
+		return err
+	}
+
+	for _, option := range strings.Split(mount.Options, ",") {
+		if option != "ro" {
+			continue
+		}
+		if err := syscall.Mount("", mount.Target, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+			_ = syscall.Unmount(mount.Target, 0)
+			return err
+		}
+	}
+	return nil
+}
+
+// unmountFilesystem 卸载挂载点
+func unmountFilesystem(target string) error {
+	return syscall.Unmount(target, 0)
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+/*
+非 Linux 平台的文件系统挂载
+
+tmpfs 和绑定挂载依赖 Linux 的 mount(2)，其他平台上直接返回不支持。
+*/
+package main
+
+import "errors"
+
+// mountFilesystem 非Linux平台不支持挂载
+func mountFilesystem(mount *Mount) error {
+	return errors.New("mount is not supported on this platform")
+}
+
+// bindMountFilesystem 非Linux平台不支持绑定挂载
+func bindMountFilesystem(mount *Mount) error {
+	return errors.New("bind mount is not supported on this platform")
+}
+
+// unmountFilesystem 非Linux平台不支持卸载
+func unmountFilesystem(target string) error {
+	return errors.New("unmount is not supported on this platform")
+}
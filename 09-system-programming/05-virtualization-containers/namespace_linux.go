@@ -0,0 +1,34 @@
+//go:build linux
+// +build linux
+
+/*
+Linux 平台的命名空间切换
+
+通过 setns(2) 让当前线程加入 /proc/<pid>/ns/<type> 所指的命名空间，
+并按 nsfs 的设备号和 inode 判断两个命名空间是否相同。
+*/
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// setns 让当前线程加入fd所指的命名空间，nstype为0时不校验命名空间类型
+func setns(fd uintptr, nstype int) error {
+	return unix.Setns(int(fd), nstype)
+}
+
+// sameNamespace 判断path所指的命名空间是否就是当前线程所在的nsType命名空间
+func sameNamespace(path, nsType string) (bool, error) {
+	target, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	current, err := os.Stat("/proc/thread-self/ns/" + nsType)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(target, current), nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+/*
+非 Linux 平台的命名空间切换
+
+命名空间是 Linux 特有的机制，其他平台上进入命名空间直接返回不支持，
+调用方据此拒绝执行，而不是在宿主机上运行进程。
+*/
+package main
+
+import "errors"
+
+var errNamespacesUnsupported = errors.New("namespaces are not supported on this platform")
+
+// setns 非Linux平台不支持命名空间
+func setns(fd uintptr, nstype int) error {
+	return errNamespacesUnsupported
+}
+
+// sameNamespace 非Linux平台不支持命名空间
+func sameNamespace(path, nsType string) (bool, error) {
+	return false, errNamespacesUnsupported
+}
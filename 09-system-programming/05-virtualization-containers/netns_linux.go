@@ -0,0 +1,117 @@
+//go:build linux
+// +build linux
+
+/*
+Linux 平台的容器网络命名空间配置
+
+将 veth 对端移入容器进程所在的网络命名空间，改名为容器内接口名后配置地址、默认路由并启用。
+配置在通过 setns 进入容器网络命名空间的专用线程上执行，容器与主机共享网络命名空间时拒绝配置。
+*/
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// moveVethToNamespace 将veth对端移入pid所在的网络命名空间并完成接口配置。
+// address为CIDR形式，为空时只移动并启用接口。任一步骤失败时删除整个veth对，不在网桥上留下端口
+func moveVethToNamespace(pid int, hostVeth, peerVeth, containerVeth, address, gateway string) (err error) {
+	if pid <= 0 {
+		return fmt.Errorf("invalid container pid: %d", pid)
+	}
+	// 持有命名空间文件，之后的移动和配置都针对这一命名空间，不受PID复用影响
+	ns, err := os.Open(fmt.Sprintf("/proc/%d/ns/net", pid))
+	if err != nil {
+		return fmt.Errorf("network namespace of pid %d not found: %v", pid, err)
+	}
+	defer ns.Close()
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		// 删除主机端即删除整个veth对，对端无论是否已移入容器都会一并消失
+		// #nosec G204 - hostVeth是内部生成的安全标识符，固定命令用于网络清理
+		if output, deleteErr := exec.Command("ip", "link", "delete", hostVeth).CombinedOutput(); deleteErr != nil && hostInterfaceExists(hostVeth) {
+			log.Printf("Warning: failed to remove veth %s: %v: %s", hostVeth, deleteErr, strings.TrimSpace(string(output)))
+		}
+	}()
+
+	nsPath := fmt.Sprintf("/proc/self/fd/%d", ns.Fd())
+	shared, err := sameNamespace(nsPath, "net")
+	if err != nil {
+		return fmt.Errorf("failed to inspect network namespace of pid %d: %v", pid, err)
+	}
+	if shared {
+		return fmt.Errorf("container process %d shares the host network namespace", pid)
+	}
+
+	// 命名空间文件作为ip进程的fd 3传入
+	// #nosec G204 - peerVeth是内部生成的安全标识符，固定命令用于网络配置
+	move := exec.Command("ip", "link", "set", peerVeth, "netns", "/proc/self/fd/3")
+	move.ExtraFiles = []*os.File{ns}
+	if output, err := move.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to move veth into container namespace: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	steps := [][]string{
+		{"ip", "link", "set", peerVeth, "name", containerVeth},
+	}
+	if address != "" {
+		steps = append(steps, []string{"ip", "addr", "add", address, "dev", containerVeth})
+	}
+	steps = append(steps,
+		[]string{"ip", "link", "set", "lo", "up"},
+		[]string{"ip", "link", "set", containerVeth, "up"},
+	)
+	if address != "" && gateway != "" {
+		steps = append(steps, []string{"ip", "route", "add", "default", "via", gateway, "dev", containerVeth})
+	}
+
+	if err := inNetworkNamespace(ns, nsPath, func() error { return runNetworkCommands(steps) }); err != nil {
+		return fmt.Errorf("failed to configure container network: %v", err)
+	}
+	return nil
+}
+
+// inNetworkNamespace 在进入ns的专用OS线程上执行fn，fn启动的子进程继承该网络命名空间。
+// 无法切回主机命名空间时不解除线程锁定，由Go运行时随goroutine一起销毁该线程
+func inNetworkNamespace(ns *os.File, nsPath string, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		host, err := os.Open("/proc/thread-self/ns/net")
+		if err != nil {
+			runtime.UnlockOSThread()
+			done <- err
+			return
+		}
+		defer host.Close()
+
+		if err := setns(ns.Fd(), syscall.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			done <- fmt.Errorf("failed to enter network namespace: %v", err)
+			return
+		}
+		if entered, err := sameNamespace(nsPath, "net"); err != nil {
+			done <- err
+			return
+		} else if !entered {
+			done <- fmt.Errorf("thread did not enter the container network namespace")
+			return
+		}
+
+		err = fn()
+		if restoreErr := setns(host.Fd(), syscall.CLONE_NEWNET); restoreErr == nil {
+			runtime.UnlockOSThread()
+		}
+		done <- err
+	}()
+	return <-done
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+/*
+非 Linux 平台的容器网络命名空间配置
+
+网络命名空间是 Linux 特有的机制，其他平台上加入桥接网络直接返回不支持。
+*/
+package main
+
+import "errors"
+
+// moveVethToNamespace 非Linux平台不支持网络命名空间
+func moveVethToNamespace(pid int, hostVeth, peerVeth, containerVeth, address, gateway string) error {
+	return errors.New("bridge network join is not supported on this platform: network namespaces unavailable")
+}
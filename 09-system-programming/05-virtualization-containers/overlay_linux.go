@@ -0,0 +1,26 @@
+//go:build linux
+// +build linux
+
+/*
+Linux 平台的覆盖网络数据通路配置
+
+依次执行 ip/bridge 命令创建网桥、VXLAN 接口和 FDB 条目，任一命令失败即停止并返回其输出。
+*/
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runNetworkCommands 按顺序执行网络配置命令
+func runNetworkCommands(commands [][]string) error {
+	for _, args := range commands {
+		// #nosec G204 - 命令为固定的ip/bridge，参数均为内部生成或已验证的接口名、地址
+		if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
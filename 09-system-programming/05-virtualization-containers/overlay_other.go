@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+/*
+非 Linux 平台的覆盖网络数据通路配置
+
+VXLAN 接口和网桥 FDB 依赖 Linux 内核，其他平台上创建覆盖网络直接返回不支持。
+*/
+package main
+
+import "errors"
+
+// runNetworkCommands 非Linux平台不支持VXLAN覆盖网络
+func runNetworkCommands(commands [][]string) error {
+	return errors.New("overlay networks are not supported on this platform: VXLAN requires Linux")
+}
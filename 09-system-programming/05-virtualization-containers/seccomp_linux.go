@@ -0,0 +1,198 @@
+//go:build linux
+// +build linux
+
+/*
+Linux 平台的 seccomp 过滤器安装
+
+过滤器只能在容器进程中安装：运行时以 /proc/self/exe 重新执行自身作为容器 init，
+init 完成 chroot、切换用户后，先设置 no_new_privs，再通过 prctl(PR_SET_SECCOMP, SECCOMP_MODE_FILTER)
+在当前线程上安装编译好的 BPF 程序，最后在同一线程上 execve 容器命令，过滤器随之带入容器进程。
+*/
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/net/bpf"
+)
+
+// prctl 常量（见 linux/prctl.h 与 linux/seccomp.h）
+const (
+	prSetNoNewPrivs   = 38
+	prSetSeccomp      = 22
+	seccompModeFilter = 2
+)
+
+const (
+	// seccompInitName 容器init的argv[0]，运行时二进制以该名称启动时进入init流程
+	seccompInitName = "container-seccomp-init"
+	// seccompInitEnv 传递init配置的环境变量，init在execve之前将其移除
+	seccompInitEnv = "CONTAINER_SECCOMP_INIT"
+	// seccompInitExitCode init无法启动容器命令时的退出码
+	seccompInitExitCode = 127
+)
+
+// sockFprog 对应内核的 struct sock_fprog
+type sockFprog struct {
+	Len    uint16
+	Filter *bpf.RawInstruction
+}
+
+// seccompInitConfig 运行时传给容器init的启动参数，Filter为按本机字节序排列的sock_filter数组
+type seccompInitConfig struct {
+	Path       string
+	Args       []string
+	Dir        string
+	Chroot     string
+	Credential *syscall.Credential
+	Filter     []byte
+}
+
+func init() {
+	if len(os.Args) == 0 || os.Args[0] != seccompInitName {
+		return
+	}
+	// no_new_privs和过滤器只作用于调用线程，execve也必须在同一线程上执行
+	runtime.LockOSThread()
+	err := runSeccompInit()
+	fmt.Fprintf(os.Stderr, "container init: %v\n", err)
+	os.Exit(seccompInitExitCode)
+}
+
+// attachSeccompFilter 让cmd先启动容器init，由init在execve之前安装program。
+// cmd原本的chroot、工作目录和用户交由init设置，运行时自身不安装任何过滤器
+func attachSeccompFilter(cmd *exec.Cmd, program []bpf.RawInstruction) error {
+	if cmd.Process != nil {
+		return errors.New("process already started")
+	}
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	if len(program) == 0 {
+		return fmt.Errorf("empty seccomp program")
+	}
+
+	attr := cmd.SysProcAttr
+	if attr == nil {
+		attr = &syscall.SysProcAttr{}
+	}
+	filter := make([]byte, 0, len(program)*8)
+	for _, ins := range program {
+		filter = binary.NativeEndian.AppendUint16(filter, ins.Op)
+		filter = append(filter, ins.Jt, ins.Jf)
+		filter = binary.NativeEndian.AppendUint32(filter, ins.K)
+	}
+	config, err := json.Marshal(seccompInitConfig{
+		Path:       cmd.Path,
+		Args:       cmd.Args,
+		Dir:        cmd.Dir,
+		Chroot:     attr.Chroot,
+		Credential: attr.Credential,
+		Filter:     filter,
+	})
+	if err != nil {
+		return err
+	}
+
+	cmd.Env = append(cmd.Environ(), seccompInitEnv+"="+string(config))
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = []string{seccompInitName}
+	cmd.Dir = ""
+	attr.Chroot = ""
+	attr.Credential = nil
+	cmd.SysProcAttr = attr
+	return nil
+}
+
+// runSeccompInit 容器init：按配置进入根目录、切换用户、安装过滤器后执行容器命令，成功时不返回
+func runSeccompInit() error {
+	var config seccompInitConfig
+	if err := json.Unmarshal([]byte(os.Getenv(seccompInitEnv)), &config); err != nil {
+		return fmt.Errorf("invalid init config: %v", err)
+	}
+	if err := os.Unsetenv(seccompInitEnv); err != nil {
+		return err
+	}
+	if len(config.Filter) == 0 || len(config.Filter)%8 != 0 {
+		return fmt.Errorf("invalid seccomp program of %d bytes", len(config.Filter))
+	}
+	program := make([]bpf.RawInstruction, len(config.Filter)/8)
+	for i := range program {
+		raw := config.Filter[i*8:]
+		program[i] = bpf.RawInstruction{
+			Op: binary.NativeEndian.Uint16(raw),
+			Jt: raw[2],
+			Jf: raw[3],
+			K:  binary.NativeEndian.Uint32(raw[4:]),
+		}
+	}
+
+	if config.Chroot != "" {
+		if err := syscall.Chroot(config.Chroot); err != nil {
+			return fmt.Errorf("chroot %s: %v", config.Chroot, err)
+		}
+		if config.Dir == "" {
+			config.Dir = "/"
+		}
+	}
+	if config.Dir != "" {
+		if err := syscall.Chdir(config.Dir); err != nil {
+			return fmt.Errorf("chdir %s: %v", config.Dir, err)
+		}
+	}
+	if credential := config.Credential; credential != nil {
+		if !credential.NoSetGroups {
+			groups := make([]int, len(credential.Groups))
+			for i, gid := range credential.Groups {
+				groups[i] = int(gid)
+			}
+			if err := syscall.Setgroups(groups); err != nil {
+				return fmt.Errorf("setgroups: %v", err)
+			}
+		}
+		if err := syscall.Setgid(int(credential.Gid)); err != nil {
+			return fmt.Errorf("setgid: %v", err)
+		}
+		if err := syscall.Setuid(int(credential.Uid)); err != nil {
+			return fmt.Errorf("setuid: %v", err)
+		}
+	}
+
+	// 安装之后的系统调用都受过滤器约束，环境变量须提前取得
+	env := os.Environ()
+	if err := installSeccompFilter(program); err != nil {
+		return err
+	}
+	return syscall.Exec(config.Path, config.Args, env)
+}
+
+// installSeccompFilter 将BPF程序安装到调用线程
+func installSeccompFilter(program []bpf.RawInstruction) error {
+	if len(program) == 0 {
+		return fmt.Errorf("empty seccomp program")
+	}
+
+	// 非特权进程安装过滤器前必须设置no_new_privs
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS) failed: %v", errno)
+	}
+
+	fprog := sockFprog{
+		Len:    uint16(len(program)),
+		Filter: &program[0],
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&fprog)))
+	runtime.KeepAlive(program)
+	if errno != 0 {
+		return fmt.Errorf("prctl(PR_SET_SECCOMP) failed: %v", errno)
+	}
+	return nil
+}
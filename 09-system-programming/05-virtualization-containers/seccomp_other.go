@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+/*
+非 Linux 平台的 seccomp 过滤器安装
+
+seccomp 是 Linux 特有的机制，其他平台上为进程附加过滤器直接返回不支持。
+*/
+package main
+
+import (
+	"errors"
+	"os/exec"
+
+	"golang.org/x/net/bpf"
+)
+
+// attachSeccompFilter 非Linux平台不支持seccomp
+func attachSeccompFilter(cmd *exec.Cmd, program []bpf.RawInstruction) error {
+	return errors.New("seccomp is not supported on this platform")
+}
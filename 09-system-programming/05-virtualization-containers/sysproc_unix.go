@@ -0,0 +1,40 @@
+//go:build !windows
+// +build !windows
+
+/*
+Unix 平台的容器进程属性设置
+
+本文件负责在 exec 之前把解析得到的容器用户写入 SysProcAttr.Credential，
+设置进程的 chroot 根目录，并提供 Unix 特有的停止信号名称。
+*/
+package main
+
+import "syscall"
+
+// openNoFollow 打开文件时不跟随最后一级符号链接
+const openNoFollow = syscall.O_NOFOLLOW
+
+// applyContainerUser 设置进程以容器用户的uid/gid及附加组运行
+func applyContainerUser(attr *syscall.SysProcAttr, user *ContainerUser) {
+	groups := make([]uint32, len(user.AdditionalGids))
+	copy(groups, user.AdditionalGids)
+
+	attr.Credential = &syscall.Credential{
+		Uid:    user.Uid,
+		Gid:    user.Gid,
+		Groups: groups,
+	}
+}
+
+// applyRootfs 设置进程在exec之前chroot到rootfs
+func applyRootfs(attr *syscall.SysProcAttr, rootfs string) error {
+	attr.Chroot = rootfs
+	return nil
+}
+
+// platformSignals Unix特有的停止信号
+var platformSignals = map[string]syscall.Signal{
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"WINCH": syscall.SIGWINCH,
+}
@@ -0,0 +1,33 @@
+//go:build windows
+// +build windows
+
+/*
+Windows 平台的容器进程属性设置
+
+Windows 没有 uid/gid 模型，容器用户仅做解析校验，不会应用到进程；
+没有 chroot，需要隔离根文件系统的进程直接拒绝启动；
+也没有 Unix 特有的信号，停止信号只支持通用的信号名称。
+*/
+package main
+
+import (
+	"errors"
+	"log"
+	"syscall"
+)
+
+// openNoFollow Windows没有O_NOFOLLOW，os.Root本身拒绝越出根目录的链接
+const openNoFollow = 0
+
+// applyContainerUser Windows下无法切换uid/gid，仅记录警告
+func applyContainerUser(attr *syscall.SysProcAttr, user *ContainerUser) {
+	log.Printf("Warning: container user %d:%d is not supported on Windows", user.Uid, user.Gid)
+}
+
+// applyRootfs Windows不支持chroot，不能让进程退回到宿主机文件系统上运行
+func applyRootfs(attr *syscall.SysProcAttr, rootfs string) error {
+	return errors.New("running a process inside a container root filesystem is not supported on Windows")
+}
+
+// platformSignals Windows没有额外的停止信号
+var platformSignals = map[string]syscall.Signal{}
@@ -328,7 +328,7 @@ func demonstrateConnectionPool() {
 	fmt.Println("【连接池示例】")
 
 	// 创建连接池
-	pool, err := network.NewConnPool(network.PoolConfig{
+	pool, err := network.NewConnPoolWithConfig(network.PoolConfig{
 		Address:     "localhost:6379", // Redis 服务器
 		MaxSize:     10,
 		MinSize:     2,
@@ -20,10 +20,12 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
-	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -179,6 +181,8 @@ type PortResult struct {
 	Port int
 	// Open 是否开放
 	Open bool
+	// State 端口状态（开放/关闭/被过滤）
+	State PortState
 	// Service 服务名称（如果已知）
 	Service string
 	// Banner 服务横幅（如果获取到）
@@ -204,7 +208,7 @@ func (ps *PortScanner) ScanPort(host string, port int) *PortResult {
 		Port: port,
 	}
 
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 	start := time.Now()
 
 	conn, err := net.DialTimeout(ps.Protocol, address, ps.Timeout)
@@ -212,12 +216,14 @@ func (ps *PortScanner) ScanPort(host string, port int) *PortResult {
 
 	if err != nil {
 		result.Open = false
+		result.State = classifyDialError(err)
 		result.Error = err
 		return result
 	}
 	defer conn.Close()
 
 	result.Open = true
+	result.State = PortOpen
 	result.Service = getServiceName(port)
 
 	// 尝试获取 banner
@@ -269,6 +275,143 @@ func (ps *PortScanner) ScanCommonPorts(host string) []*PortResult {
 	return ps.ScanPorts(host, commonPorts)
 }
 
+// PortState 端口状态
+type PortState int
+
+const (
+	// PortFiltered 无响应或被防火墙丢弃（连接超时、主机不可达等）
+	PortFiltered PortState = iota
+	// PortOpen 连接成功
+	PortOpen
+	// PortClosed 对端明确拒绝连接
+	PortClosed
+)
+
+// String 返回端口状态的字符串表示
+func (s PortState) String() string {
+	switch s {
+	case PortOpen:
+		return "open"
+	case PortClosed:
+		return "closed"
+	default:
+		return "filtered"
+	}
+}
+
+// ScanOptions 端口扫描选项
+type ScanOptions struct {
+	// Concurrency 同时进行的连接数上限，默认 100
+	Concurrency int
+	// Timeout 单个端口的连接超时，默认 2 秒
+	Timeout time.Duration
+}
+
+// dialContext 扫描使用的拨号函数，测试中可替换
+var dialContext = (&net.Dialer{}).DialContext
+
+// ScanPorts 对 host 的端口执行并发 TCP connect 扫描
+// 由固定数量的 worker 处理端口，结果按 ports 的顺序返回。
+// ctx 取消时中止正在进行的连接，返回已完成的结果和 ctx.Err()
+func ScanPorts(ctx context.Context, host string, ports []int, opts ScanOptions) ([]PortResult, error) {
+	for _, port := range ports {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("%w: port %d out of range", ErrInvalidAddress, port)
+		}
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 100
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+
+	results := make([]PortResult, len(ports))
+	done := make([]bool, len(ports))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := opts.Concurrency
+	if workers > len(ports) {
+		workers = len(ports)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				result := scanPortContext(ctx, host, ports[idx], opts.Timeout)
+				// 被取消中断的连接不代表端口状态
+				if ctx.Err() != nil {
+					continue
+				}
+				results[idx] = result
+				done[idx] = true
+			}
+		}()
+	}
+
+dispatch:
+	for idx := range ports {
+		select {
+		case jobs <- idx:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		completed := make([]PortResult, 0, len(ports))
+		for idx, ok := range done {
+			if ok {
+				completed = append(completed, results[idx])
+			}
+		}
+		return completed, err
+	}
+	return results, nil
+}
+
+// scanPortContext 在超时限制内连接单个端口并判断状态
+func scanPortContext(ctx context.Context, host string, port int, timeout time.Duration) PortResult {
+	result := PortResult{Port: port}
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := dialContext(dialCtx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.State = classifyDialError(err)
+		result.Error = err
+		return result
+	}
+	conn.Close()
+
+	result.Open = true
+	result.State = PortOpen
+	result.Service = getServiceName(port)
+	return result
+}
+
+// wsaeConnRefused Windows 上连接被拒绝的错误码（WSAECONNREFUSED）
+const wsaeConnRefused = 10061
+
+// classifyDialError 连接被拒绝说明端口关闭，其他失败（超时、不可达）视为被过滤
+func classifyDialError(err error) PortState {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return PortClosed
+	}
+	var errno syscall.Errno
+	if runtime.GOOS == "windows" && errors.As(err, &errno) && errno == wsaeConnRefused {
+		return PortClosed
+	}
+	return PortFiltered
+}
+
 // grabBanner 获取服务横幅
 func (ps *PortScanner) grabBanner(conn net.Conn) string {
 	// 设置读取超时
@@ -325,24 +468,32 @@ func getServiceName(port int) string {
 // ===================
 
 // ConnPool TCP连接池
+// 同时限制空闲连接数和总连接数，取出空闲连接前检查存活性，
+// 超过 MaxIdleTime 的空闲连接会被淘汰
 type ConnPool struct {
 	// 配置
-	address     string
-	maxSize     int
-	minSize     int
-	maxIdleTime time.Duration
-	dialTimeout time.Duration
+	address string
+	opts    PoolOptions
 
 	// 状态
-	pool   chan net.Conn
-	size   int32
-	closed int32
-	mu     sync.Mutex
+	mu      sync.Mutex
+	idle    []idleConn
+	numOpen int
+	closed  bool
+	// available 有空闲连接或空余名额时发出信号，唤醒等待者
+	available chan struct{}
+	done      chan struct{}
 
 	// 统计
 	stats PoolStats
 }
 
+// idleConn 池中的空闲连接
+type idleConn struct {
+	conn  net.Conn
+	since time.Time
+}
+
 // PoolStats 连接池统计
 type PoolStats struct {
 	// TotalConnections 总连接数
@@ -363,13 +514,28 @@ type PoolStats struct {
 	TimeoutCount int64
 }
 
+// PoolOptions 连接池选项
+type PoolOptions struct {
+	// MaxOpen 最大连接数（空闲 + 使用中），默认 10
+	MaxOpen int
+	// MaxIdle 最大空闲连接数，默认等于 MaxOpen
+	MaxIdle int
+	// MaxIdleTime 最大空闲时间，默认 5 分钟
+	MaxIdleTime time.Duration
+	// DialTimeout 连接超时时间，默认 5 秒
+	DialTimeout time.Duration
+	// AliveCheckAfter 空闲超过该时长的连接在复用前做存活检查，默认 0 即每次复用前都检查
+	// 调大后刚归还的连接直接复用，省去探测读取的延迟，但可能拿到已被对端关闭的连接
+	AliveCheckAfter time.Duration
+}
+
 // PoolConfig 连接池配置
 type PoolConfig struct {
 	// Address 服务器地址
 	Address string
 	// MaxSize 最大连接数
 	MaxSize int
-	// MinSize 最小连接数
+	// MinSize 最小连接数（创建时预先建立）
 	MinSize int
 	// MaxIdleTime 最大空闲时间
 	MaxIdleTime time.Duration
@@ -377,129 +543,185 @@ type PoolConfig struct {
 	DialTimeout time.Duration
 }
 
-// NewConnPool 创建连接池
-func NewConnPool(config PoolConfig) (*ConnPool, error) {
-	if config.MaxSize <= 0 {
-		config.MaxSize = 10
-	}
-	if config.MinSize < 0 {
-		config.MinSize = 0
+// NewConnPool 创建到 addr 的连接池，连接在首次 Get 时按需建立
+func NewConnPool(addr string, opts PoolOptions) *ConnPool {
+	if opts.MaxOpen <= 0 {
+		opts.MaxOpen = 10
 	}
-	if config.MinSize > config.MaxSize {
-		config.MinSize = config.MaxSize
+	if opts.MaxIdle <= 0 || opts.MaxIdle > opts.MaxOpen {
+		opts.MaxIdle = opts.MaxOpen
 	}
-	if config.MaxIdleTime <= 0 {
-		config.MaxIdleTime = 5 * time.Minute
+	if opts.MaxIdleTime <= 0 {
+		opts.MaxIdleTime = 5 * time.Minute
 	}
-	if config.DialTimeout <= 0 {
-		config.DialTimeout = 5 * time.Second
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
 	}
 
 	pool := &ConnPool{
-		address:     config.Address,
-		maxSize:     config.MaxSize,
-		minSize:     config.MinSize,
-		maxIdleTime: config.MaxIdleTime,
-		dialTimeout: config.DialTimeout,
-		pool:        make(chan net.Conn, config.MaxSize),
+		address:   addr,
+		opts:      opts,
+		available: make(chan struct{}, 1),
+		done:      make(chan struct{}),
 	}
 
-	// 预创建最小连接数
-	for i := 0; i < config.MinSize; i++ {
-		conn, err := pool.dial()
+	// 启动清理协程
+	go pool.cleaner()
+
+	return pool
+}
+
+// NewConnPoolWithConfig 使用配置创建连接池，并预先建立 MinSize 个连接
+func NewConnPoolWithConfig(config PoolConfig) (*ConnPool, error) {
+	pool := NewConnPool(config.Address, PoolOptions{
+		MaxOpen:     config.MaxSize,
+		MaxIdleTime: config.MaxIdleTime,
+		DialTimeout: config.DialTimeout,
+	})
+
+	minSize := config.MinSize
+	if minSize > pool.opts.MaxOpen {
+		minSize = pool.opts.MaxOpen
+	}
+	for i := 0; i < minSize; i++ {
+		conn, err := pool.dial(context.Background())
 		if err != nil {
 			pool.Close()
 			return nil, fmt.Errorf("failed to create initial connections: %w", err)
 		}
-		pool.pool <- conn
-		atomic.AddInt32(&pool.size, 1)
+		pool.mu.Lock()
+		pool.numOpen++
+		pool.stats.TotalConnections++
+		pool.idle = append(pool.idle, idleConn{conn: conn, since: time.Now()})
+		pool.mu.Unlock()
 	}
 
-	// 启动清理协程
-	go pool.cleaner()
-
 	return pool, nil
 }
 
 // Get 从池中获取连接
+// 优先复用最近归还的存活空闲连接；没有空闲连接且未达到 MaxOpen 时新建连接；
+// 否则等待其他连接归还，直到 ctx 结束。返回的连接 Close 时自动归还
 func (p *ConnPool) Get(ctx context.Context) (net.Conn, error) {
-	if atomic.LoadInt32(&p.closed) == 1 {
-		return nil, ErrPoolClosed
-	}
+	var waitStart time.Time
 
-	atomic.AddInt64(&p.stats.WaitCount, 1)
-	start := time.Now()
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
 
-	// 尝试从池中获取
-	select {
-	case conn := <-p.pool:
-		atomic.AddInt64(&p.stats.HitCount, 1)
-		atomic.AddInt64(&p.stats.ActiveConnections, 1)
-		atomic.AddInt64(&p.stats.IdleConnections, -1)
-		p.stats.WaitDuration += time.Since(start)
-		return &pooledConn{Conn: conn, pool: p}, nil
-	default:
-	}
+		// 复用空闲连接（后进先出）
+		if n := len(p.idle); n > 0 {
+			ic := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.mu.Unlock()
+
+			idleFor := time.Since(ic.since)
+			if idleFor > p.opts.MaxIdleTime || (idleFor >= p.opts.AliveCheckAfter && !connAlive(ic.conn)) {
+				ic.conn.Close()
+				p.release()
+				continue
+			}
 
-	// 池中没有可用连接，尝试创建新连接
-	if atomic.LoadInt32(&p.size) < int32(p.maxSize) {
-		conn, err := p.dial()
-		if err != nil {
-			atomic.AddInt64(&p.stats.MissCount, 1)
-			return nil, err
+			p.mu.Lock()
+			p.stats.HitCount++
+			p.recordWaitLocked(waitStart)
+			p.notifyLocked()
+			p.mu.Unlock()
+			return &pooledConn{Conn: ic.conn, pool: p}, nil
 		}
-		atomic.AddInt32(&p.size, 1)
-		atomic.AddInt64(&p.stats.TotalConnections, 1)
-		atomic.AddInt64(&p.stats.ActiveConnections, 1)
-		atomic.AddInt64(&p.stats.MissCount, 1)
-		p.stats.WaitDuration += time.Since(start)
-		return &pooledConn{Conn: conn, pool: p}, nil
-	}
 
-	// 等待可用连接
-	select {
-	case conn := <-p.pool:
-		atomic.AddInt64(&p.stats.HitCount, 1)
-		atomic.AddInt64(&p.stats.ActiveConnections, 1)
-		atomic.AddInt64(&p.stats.IdleConnections, -1)
-		p.stats.WaitDuration += time.Since(start)
-		return &pooledConn{Conn: conn, pool: p}, nil
-	case <-ctx.Done():
-		atomic.AddInt64(&p.stats.TimeoutCount, 1)
-		return nil, ErrTimeout
+		// 新建连接
+		if p.numOpen < p.opts.MaxOpen {
+			p.numOpen++
+			p.recordWaitLocked(waitStart)
+			p.mu.Unlock()
+
+			conn, err := p.dial(ctx)
+			if err != nil {
+				p.release()
+				return nil, err
+			}
+
+			p.mu.Lock()
+			p.stats.MissCount++
+			p.stats.TotalConnections++
+			p.mu.Unlock()
+			return &pooledConn{Conn: conn, pool: p}, nil
+		}
+
+		// 等待连接归还
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+			p.stats.WaitCount++
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-p.available:
+		case <-p.done:
+			return nil, ErrPoolClosed
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.stats.TimeoutCount++
+			p.recordWaitLocked(waitStart)
+			p.mu.Unlock()
+			return nil, fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+		}
 	}
 }
 
-// Put 将连接放回池中
+// Put 将 Get 返回的连接放回池中
+// 连接池已关闭或空闲连接已满时直接关闭连接；重复归还同一连接无效果
 func (p *ConnPool) Put(conn net.Conn) {
-	if atomic.LoadInt32(&p.closed) == 1 {
+	pc, ok := conn.(*pooledConn)
+	if !ok || pc.pool != p {
+		// 不属于本池的连接
 		conn.Close()
 		return
 	}
 
-	atomic.AddInt64(&p.stats.ActiveConnections, -1)
-
-	select {
-	case p.pool <- conn:
-		atomic.AddInt64(&p.stats.IdleConnections, 1)
-	default:
-		// 池已满，关闭连接
-		conn.Close()
-		atomic.AddInt32(&p.size, -1)
+	pc.mu.Lock()
+	if pc.closed {
+		pc.mu.Unlock()
+		return
 	}
+	pc.closed = true
+	pc.mu.Unlock()
+
+	p.mu.Lock()
+	if p.closed || len(p.idle) >= p.opts.MaxIdle {
+		p.mu.Unlock()
+		pc.Conn.Close()
+		p.release()
+		return
+	}
+	p.idle = append(p.idle, idleConn{conn: pc.Conn, since: time.Now()})
+	p.notifyLocked()
+	p.mu.Unlock()
 }
 
 // Close 关闭连接池
+// 关闭所有空闲连接并唤醒等待者；使用中的连接在归还时关闭
 func (p *ConnPool) Close() error {
-	if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
 		return nil
 	}
+	p.closed = true
+	close(p.done)
 
-	close(p.pool)
+	idle := p.idle
+	p.idle = nil
+	p.numOpen -= len(idle)
+	p.mu.Unlock()
 
-	// 关闭所有连接
-	for conn := range p.pool {
-		conn.Close()
+	// 关闭所有空闲连接
+	for _, ic := range idle {
+		ic.conn.Close()
 	}
 
 	return nil
@@ -507,41 +729,106 @@ func (p *ConnPool) Close() error {
 
 // Stats 获取连接池统计信息
 func (p *ConnPool) Stats() PoolStats {
-	return p.stats
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.IdleConnections = int64(len(p.idle))
+	stats.ActiveConnections = int64(p.numOpen - len(p.idle))
+	return stats
 }
 
 // Size 获取当前连接数
 func (p *ConnPool) Size() int {
-	return int(atomic.LoadInt32(&p.size))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.numOpen
 }
 
 // dial 创建新连接
-func (p *ConnPool) dial() (net.Conn, error) {
-	return net.DialTimeout("tcp", p.address, p.dialTimeout)
+func (p *ConnPool) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: p.opts.DialTimeout}
+	return dialer.DialContext(ctx, "tcp", p.address)
+}
+
+// release 释放一个连接名额并唤醒等待者
+func (p *ConnPool) release() {
+	p.mu.Lock()
+	p.numOpen--
+	p.notifyLocked()
+	p.mu.Unlock()
+}
+
+// notifyLocked 仍有可用连接或名额时唤醒一个等待者，
+// 被唤醒者取走连接后会再次调用，形成链式唤醒
+func (p *ConnPool) notifyLocked() {
+	if len(p.idle) == 0 && p.numOpen >= p.opts.MaxOpen {
+		return
+	}
+	select {
+	case p.available <- struct{}{}:
+	default:
+	}
+}
+
+// recordWaitLocked 累计等待时间
+func (p *ConnPool) recordWaitLocked(waitStart time.Time) {
+	if !waitStart.IsZero() {
+		p.stats.WaitDuration += time.Since(waitStart)
+	}
 }
 
-// cleaner 清理空闲连接
+// cleaner 定期淘汰空闲超过 MaxIdleTime 的连接
 func (p *ConnPool) cleaner() {
-	ticker := time.NewTicker(p.maxIdleTime / 2)
+	ticker := time.NewTicker(p.opts.MaxIdleTime / 2)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if atomic.LoadInt32(&p.closed) == 1 {
+	for {
+		select {
+		case <-p.done:
 			return
+		case <-ticker.C:
+			p.evictExpired(time.Now())
 		}
+	}
+}
 
-		// 清理超过最小连接数的空闲连接
-		for atomic.LoadInt32(&p.size) > int32(p.minSize) {
-			select {
-			case conn := <-p.pool:
-				conn.Close()
-				atomic.AddInt32(&p.size, -1)
-				atomic.AddInt64(&p.stats.IdleConnections, -1)
-			default:
-				return
-			}
+// evictExpired 关闭过期的空闲连接
+func (p *ConnPool) evictExpired(now time.Time) {
+	p.mu.Lock()
+	var expired []net.Conn
+	kept := p.idle[:0]
+	for _, ic := range p.idle {
+		if now.Sub(ic.since) > p.opts.MaxIdleTime {
+			expired = append(expired, ic.conn)
+			continue
 		}
+		kept = append(kept, ic)
+	}
+	p.idle = kept
+	p.numOpen -= len(expired)
+	if len(expired) > 0 {
+		p.notifyLocked()
+	}
+	p.mu.Unlock()
+
+	for _, conn := range expired {
+		conn.Close()
+	}
+}
+
+// connAlive 检查空闲连接是否仍然可用
+// 短暂读取：超时说明连接正常；EOF、错误或收到未预期的数据都视为不可复用
+func connAlive(conn net.Conn) bool {
+	if err := conn.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		return false
 	}
+	var buf [1]byte
+	_, err := conn.Read(buf[:])
+	conn.SetReadDeadline(time.Time{})
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 // pooledConn 池化连接包装器
@@ -554,15 +841,7 @@ type pooledConn struct {
 
 // Close 关闭连接（实际上是放回池中）
 func (c *pooledConn) Close() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.closed {
-		return nil
-	}
-	c.closed = true
-
-	c.pool.Put(c.Conn)
+	c.pool.Put(c)
 	return nil
 }
 
@@ -610,7 +889,7 @@ func TCPPing(address string, port int, timeout time.Duration) *PingResult {
 		Timestamp: time.Now(),
 	}
 
-	target := fmt.Sprintf("%s:%d", address, port)
+	target := net.JoinHostPort(address, strconv.Itoa(port))
 	start := time.Now()
 
 	conn, err := net.DialTimeout("tcp", target, timeout)
@@ -768,7 +1047,7 @@ func ReverseDNS(ip string) ([]string, error) {
 
 // IsPortOpen 检查端口是否开放
 func IsPortOpen(host string, port int, timeout time.Duration) bool {
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 	conn, err := net.DialTimeout("tcp", address, timeout)
 	if err != nil {
 		return false
@@ -13,7 +13,10 @@ package network
 
 import (
 	"context"
+	"errors"
 	"net"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -164,6 +167,116 @@ func TestPortScannerScanPorts(t *testing.T) {
 	}
 }
 
+// TestScanPortsStates 测试并发扫描区分开放与关闭端口
+func TestScanPortsStates(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start test server: %v", err)
+	}
+	defer listener.Close()
+	openPort := listener.Addr().(*net.TCPAddr).Port
+
+	// 监听后立即关闭，得到一个已知关闭的端口
+	closedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve port: %v", err)
+	}
+	closedPort := closedListener.Addr().(*net.TCPAddr).Port
+	closedListener.Close()
+
+	ports := []int{closedPort, openPort}
+	results, err := ScanPorts(context.Background(), "127.0.0.1", ports, ScanOptions{Concurrency: 2, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("ScanPorts failed: %v", err)
+	}
+	if len(results) != len(ports) {
+		t.Fatalf("expected %d results, got %d", len(ports), len(results))
+	}
+
+	if results[0].Port != closedPort || results[0].State != PortClosed {
+		t.Errorf("port %d: expected closed, got %s", results[0].Port, results[0].State)
+	}
+	if results[1].Port != openPort || results[1].State != PortOpen || !results[1].Open {
+		t.Errorf("port %d: expected open, got %s", results[1].Port, results[1].State)
+	}
+}
+
+// TestScanPortsConcurrencyLimit 测试同时进行的连接数不超过 Concurrency
+func TestScanPortsConcurrencyLimit(t *testing.T) {
+	var inFlight, maxInFlight int32
+	original := dialContext
+	defer func() { dialContext = original }()
+	dialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			current := atomic.LoadInt32(&maxInFlight)
+			if n <= current || atomic.CompareAndSwapInt32(&maxInFlight, current, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil, syscall.ECONNREFUSED
+	}
+
+	ports := make([]int, 40)
+	for i := range ports {
+		ports[i] = 20000 + i
+	}
+	results, err := ScanPorts(context.Background(), "127.0.0.1", ports, ScanOptions{Concurrency: 4, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("ScanPorts failed: %v", err)
+	}
+	if len(results) != len(ports) {
+		t.Fatalf("expected %d results, got %d", len(ports), len(results))
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > 4 {
+		t.Errorf("expected at most 4 concurrent dials, got %d", max)
+	}
+	for _, r := range results {
+		if r.State != PortClosed {
+			t.Errorf("port %d: expected closed, got %s", r.Port, r.State)
+		}
+	}
+}
+
+// TestScanPortsTimeoutAndCancel 测试超时判定为被过滤以及取消扫描
+func TestScanPortsTimeoutAndCancel(t *testing.T) {
+	original := dialContext
+	defer func() { dialContext = original }()
+	dialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	results, err := ScanPorts(context.Background(), "127.0.0.1", []int{20000}, ScanOptions{Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("ScanPorts failed: %v", err)
+	}
+	if results[0].State != PortFiltered {
+		t.Errorf("expected filtered, got %s", results[0].State)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ports := make([]int, 100)
+	for i := range ports {
+		ports[i] = 20000 + i
+	}
+	start := time.Now()
+	_, err = ScanPorts(ctx, "127.0.0.1", ports, ScanOptions{Concurrency: 2, Timeout: time.Minute})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancellation took too long: %v", elapsed)
+	}
+
+	if _, err := ScanPorts(context.Background(), "127.0.0.1", []int{0}, ScanOptions{}); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress for port 0, got %v", err)
+	}
+}
+
 // TestGetServiceName 测试获取服务名称
 func TestGetServiceName(t *testing.T) {
 	tests := []struct {
@@ -215,19 +328,12 @@ func TestConnPool(t *testing.T) {
 		}
 	}()
 
-	// 创建连接池（不使用 MinSize 预创建，避免统计问题）
-	config := PoolConfig{
-		Address:     listener.Addr().String(),
-		MaxSize:     5,
-		MinSize:     0, // 不预创建连接
+	// 创建连接池
+	pool := NewConnPool(listener.Addr().String(), PoolOptions{
+		MaxOpen:     5,
 		MaxIdleTime: 1 * time.Minute,
 		DialTimeout: 5 * time.Second,
-	}
-
-	pool, err := NewConnPool(config)
-	if err != nil {
-		t.Fatalf("failed to create pool: %v", err)
-	}
+	})
 	defer pool.Close()
 
 	// 测试获取连接
@@ -280,18 +386,11 @@ func TestConnPoolExhausted(t *testing.T) {
 	}()
 
 	// 创建小容量连接池
-	config := PoolConfig{
-		Address:     listener.Addr().String(),
-		MaxSize:     2,
-		MinSize:     0,
+	pool := NewConnPool(listener.Addr().String(), PoolOptions{
+		MaxOpen:     2,
 		MaxIdleTime: 1 * time.Minute,
 		DialTimeout: 5 * time.Second,
-	}
-
-	pool, err := NewConnPool(config)
-	if err != nil {
-		t.Fatalf("failed to create pool: %v", err)
-	}
+	})
 	defer pool.Close()
 
 	// 获取所有连接
@@ -310,16 +409,237 @@ func TestConnPoolExhausted(t *testing.T) {
 	defer cancel()
 
 	_, err = pool.Get(ctx)
-	if err != ErrTimeout {
+	if !errors.Is(err, ErrTimeout) {
 		t.Errorf("expected ErrTimeout, got %v", err)
 	}
 
+	// 归还一个连接后，阻塞的 Get 应被唤醒并复用它
+	result := make(chan net.Conn, 1)
+	go func() {
+		conn, err := pool.Get(context.Background())
+		if err != nil {
+			t.Errorf("blocked Get failed: %v", err)
+		}
+		result <- conn
+	}()
+	time.Sleep(20 * time.Millisecond)
+	pool.Put(conns[0])
+
+	select {
+	case conn := <-result:
+		if conn != nil && conn.(*pooledConn).Conn != conns[0].(*pooledConn).Conn {
+			t.Error("blocked Get should receive the returned connection")
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("blocked Get was not woken by Put")
+	}
+
+	if size := pool.Size(); size != 2 {
+		t.Errorf("expected 2 open connections, got %d", size)
+	}
+
 	// 释放连接
-	for _, conn := range conns {
+	for _, conn := range conns[1:] {
 		conn.Close()
 	}
 }
 
+// startHoldServer 启动一个保持连接打开的测试服务器
+func startHoldServer(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start test server: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				buf := make([]byte, 1024)
+				for {
+					if _, err := c.Read(buf); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return listener
+}
+
+// TestConnPoolReuse 测试归还的连接被复用
+func TestConnPoolReuse(t *testing.T) {
+	listener := startHoldServer(t)
+	pool := NewConnPool(listener.Addr().String(), PoolOptions{MaxOpen: 2})
+	defer pool.Close()
+
+	first, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	underlying := first.(*pooledConn).Conn
+	pool.Put(first)
+	// 重复归还不应重复入池
+	pool.Put(first)
+
+	if stats := pool.Stats(); stats.IdleConnections != 1 {
+		t.Errorf("expected 1 idle connection, got %d", stats.IdleConnections)
+	}
+
+	second, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer second.Close()
+
+	if second.(*pooledConn).Conn != underlying {
+		t.Error("expected the pooled connection to be reused")
+	}
+	stats := pool.Stats()
+	if stats.HitCount != 1 || stats.MissCount != 1 {
+		t.Errorf("expected 1 hit and 1 miss, got %d hits and %d misses", stats.HitCount, stats.MissCount)
+	}
+	if pool.Size() != 1 {
+		t.Errorf("expected 1 open connection, got %d", pool.Size())
+	}
+}
+
+// TestConnPoolDiscardsDeadConn 测试对端关闭的空闲连接不会被交给调用者
+func TestConnPoolDiscardsDeadConn(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start test server: %v", err)
+	}
+	defer listener.Close()
+
+	// 服务器接受连接后立即关闭
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	tests := []struct {
+		name            string
+		aliveCheckAfter time.Duration
+		reused          bool
+	}{
+		// 默认每次复用前都做存活检查
+		{"default", 0, false},
+		// 空闲时间未达到阈值时不检查，直接复用
+		{"threshold", time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := NewConnPool(listener.Addr().String(), PoolOptions{MaxOpen: 1, AliveCheckAfter: tt.aliveCheckAfter})
+			defer pool.Close()
+
+			first, err := pool.Get(context.Background())
+			if err != nil {
+				t.Fatalf("failed to get connection: %v", err)
+			}
+			underlying := first.(*pooledConn).Conn
+			first.Close()
+			time.Sleep(20 * time.Millisecond)
+
+			second, err := pool.Get(context.Background())
+			if err != nil {
+				t.Fatalf("failed to get connection: %v", err)
+			}
+			defer second.Close()
+
+			if reused := second.(*pooledConn).Conn == underlying; reused != tt.reused {
+				t.Errorf("expected reused=%v, got %v", tt.reused, reused)
+			}
+		})
+	}
+}
+
+// TestConnPoolIdleEviction 测试空闲超时的连接被淘汰
+func TestConnPoolIdleEviction(t *testing.T) {
+	listener := startHoldServer(t)
+	pool := NewConnPool(listener.Addr().String(), PoolOptions{
+		MaxOpen:     2,
+		MaxIdleTime: 50 * time.Millisecond,
+	})
+	defer pool.Close()
+
+	conn, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	underlying := conn.(*pooledConn).Conn
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for pool.Size() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if size := pool.Size(); size != 0 {
+		t.Fatalf("expected idle connection to be evicted, pool size %d", size)
+	}
+
+	conn, err = pool.Get(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer conn.Close()
+	if conn.(*pooledConn).Conn == underlying {
+		t.Error("evicted connection should not be reused")
+	}
+}
+
+// TestConnPoolClose 测试关闭连接池
+func TestConnPoolClose(t *testing.T) {
+	listener := startHoldServer(t)
+	pool := NewConnPool(listener.Addr().String(), PoolOptions{MaxOpen: 1})
+
+	conn, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+
+	// 等待中的 Get 应在关闭时返回
+	waitErr := make(chan error, 1)
+	go func() {
+		_, err := pool.Get(context.Background())
+		waitErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	pool.Close()
+	select {
+	case err := <-waitErr:
+		if !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("expected ErrPoolClosed, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiting Get was not released by Close")
+	}
+
+	// 关闭后归还的连接被直接关闭
+	conn.Close()
+	if size := pool.Size(); size != 0 {
+		t.Errorf("expected 0 open connections after close, got %d", size)
+	}
+	if _, err := pool.Get(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+}
+
 // TestTCPPing 测试TCP Ping
 func TestTCPPing(t *testing.T) {
 	// 启动测试服务器
@@ -635,7 +955,7 @@ func BenchmarkConnPool(b *testing.B) {
 		DialTimeout: 5 * time.Second,
 	}
 
-	pool, err := NewConnPool(config)
+	pool, err := NewConnPoolWithConfig(config)
 	if err != nil {
 		b.Fatalf("failed to create pool: %v", err)
 	}
@@ -20,10 +20,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -361,18 +363,24 @@ func Kill(pid int) error {
 }
 
 // Signal 向进程发送信号
-// 注意：Windows 仅支持 SIGKILL 和 SIGINT
+// 先校验进程存在，不存在时返回 ErrProcessNotFound。
+// Windows 不支持 POSIX 信号：SIGTERM/os.Interrupt 映射为向进程窗口发送 WM_CLOSE 的优雅关闭
+// （进程没有窗口时退化为 TerminateProcess），SIGKILL 映射为 TerminateProcess
 func Signal(pid int, sig os.Signal) error {
 	if pid <= 0 {
 		return ErrInvalidPID
 	}
-
-	proc, err := os.FindProcess(pid)
-	if err != nil {
-		return fmt.Errorf("failed to find process: %w", err)
+	if !Exists(pid) {
+		return fmt.Errorf("%w: pid %d", ErrProcessNotFound, pid)
 	}
 
-	if err := proc.Signal(sig); err != nil {
+	if err := signalProcess(pid, sig); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return ErrProcessExited
+		}
+		if errors.Is(err, os.ErrPermission) {
+			return ErrPermissionDenied
+		}
 		return fmt.Errorf("failed to send signal: %w", err)
 	}
 
@@ -390,11 +398,13 @@ func Exists(pid int) bool {
 		return false
 	}
 
+	defer proc.Release()
+
 	// 在 Unix 上，FindProcess 总是成功的
-	// 需要发送信号 0 来检查进程是否存在
+	// 需要发送信号 0 来检查进程是否存在，EPERM 表示进程存在但无权发送信号
 	if runtime.GOOS != "windows" {
-		err = proc.Signal(nil)
-		return err == nil
+		err = proc.Signal(syscall.Signal(0))
+		return err == nil || errors.Is(err, syscall.EPERM)
 	}
 
 	// Windows 上 FindProcess 会检查进程是否存在
@@ -636,6 +646,79 @@ func (m *Monitor) monitorLoop() {
 	}
 }
 
+// ===================
+// 进程摘要列表
+// ===================
+
+// ProcessInfo 进程摘要信息
+// 只包含枚举时能廉价获取的字段，需要完整信息时使用 Manager.Get
+type ProcessInfo struct {
+	// PID 进程ID
+	PID int
+	// PPID 父进程ID
+	PPID int
+	// Name 进程名称
+	Name string
+	// State 进程状态
+	State ProcessState
+	// RSS 常驻内存大小（字节）
+	RSS uint64
+}
+
+// List 获取系统中所有进程的摘要信息
+// 枚举期间退出的进程会被跳过，不会导致整个调用失败
+func List() ([]ProcessInfo, error) {
+	procs, err := listProcessSummaries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	return procs, nil
+}
+
+// FindByName 按名称查找进程（不区分大小写）
+// 与 Manager.FindByName 的部分匹配不同，这里要求名称完全相同，
+// 但允许省略可执行文件扩展名（如 "notepad" 匹配 "notepad.exe"）
+func FindByName(name string) ([]ProcessInfo, error) {
+	procs, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []ProcessInfo
+	for _, p := range procs {
+		if nameMatches(p.Name, name) {
+			matched = append(matched, p)
+		}
+	}
+	return matched, nil
+}
+
+// linuxCommLen Linux 进程名（comm）保留的最大字节数
+const linuxCommLen = 15
+
+// nameMatches 判断进程名是否与查询名称匹配
+func nameMatches(procName, name string) bool {
+	if strings.EqualFold(procName, name) {
+		return true
+	}
+	if ext := filepath.Ext(procName); ext != "" && strings.EqualFold(strings.TrimSuffix(procName, ext), name) {
+		return true
+	}
+	// Linux 会截断过长的进程名
+	return len(procName) == linuxCommLen && len(name) > linuxCommLen && strings.EqualFold(procName, name[:linuxCommLen])
+}
+
+// summarize 将完整进程信息转换为摘要
+func summarize(info *Info) ProcessInfo {
+	return ProcessInfo{
+		PID:   info.PID,
+		PPID:  info.PPID,
+		Name:  info.Name,
+		State: info.State,
+		RSS:   info.MemoryInfo.RSS,
+	}
+}
+
 // ===================
 // 工具函数
 // ===================
@@ -11,8 +11,11 @@ Package process 的单元测试
 package process
 
 import (
+	"errors"
 	"os"
+	"os/exec"
 	"runtime"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -71,6 +74,106 @@ func TestManagerList(t *testing.T) {
 	}
 }
 
+// TestList 测试获取进程摘要列表
+func TestList(t *testing.T) {
+	procs, err := List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	currentPID := os.Getpid()
+	var self *ProcessInfo
+	for i := range procs {
+		if procs[i].PID == currentPID {
+			self = &procs[i]
+			break
+		}
+	}
+
+	if self == nil {
+		t.Fatal("current process should be in the list")
+	}
+	if self.PPID != os.Getppid() {
+		t.Errorf("PPID should be %d, got %d", os.Getppid(), self.PPID)
+	}
+	if self.Name == "" {
+		t.Error("process name should not be empty")
+	}
+	if self.RSS == 0 {
+		t.Error("RSS of current process should be positive")
+	}
+}
+
+// TestFindByNameAndSignal 测试按名称查找子进程并终止
+func TestFindByNameAndSignal(t *testing.T) {
+	var cmd *exec.Cmd
+	var name string
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("ping", "-n", "30", "127.0.0.1")
+		name = "PING"
+	} else {
+		cmd = exec.Command("sleep", "30")
+		name = "SLEEP"
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("failed to start child process: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	procs, err := FindByName(name)
+	if err != nil {
+		t.Fatalf("FindByName failed: %v", err)
+	}
+	found := false
+	for _, p := range procs {
+		if p.PID == cmd.Process.Pid {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatalf("child process %d should be found by name %q, got %v", cmd.Process.Pid, name, procs)
+	}
+
+	if err := Signal(cmd.Process.Pid, syscall.SIGTERM); err != nil {
+		t.Fatalf("Signal failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("child process should exit after SIGTERM")
+	}
+
+	if err := Signal(cmd.Process.Pid, syscall.SIGTERM); !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("signaling an exited process should return ErrProcessNotFound, got %v", err)
+	}
+}
+
+// TestNameMatches 测试进程名匹配规则
+func TestNameMatches(t *testing.T) {
+	tests := []struct {
+		procName string
+		name     string
+		want     bool
+	}{
+		{"nginx", "NGINX", true},
+		{"notepad.exe", "notepad", true},
+		{"notepad.exe", "Notepad.EXE", true},
+		{"nginx-worker", "nginx", false},
+		{"kube-controller", "kube-controller-manager", true},
+		{"kube-controller", "kube-controllerX", true},
+		{"kube", "kube-controller-manager", false},
+	}
+
+	for _, tt := range tests {
+		if got := nameMatches(tt.procName, tt.name); got != tt.want {
+			t.Errorf("nameMatches(%q, %q) = %v, want %v", tt.procName, tt.name, got, tt.want)
+		}
+	}
+}
+
 // TestManagerListWithFilter 测试使用过滤器获取进程列表
 func TestManagerListWithFilter(t *testing.T) {
 	mgr := NewManager()
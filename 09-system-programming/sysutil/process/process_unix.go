@@ -64,6 +64,91 @@ func listProcessesLinux() ([]*Info, error) {
 	return procs, nil
 }
 
+// listProcessSummaries 获取进程摘要列表（Unix实现）
+// Linux 上每个进程只读取 /proc/[pid]/stat，其他系统基于 ps 的结果转换
+func listProcessSummaries() ([]ProcessInfo, error) {
+	if runtime.GOOS != "linux" {
+		procs, err := listProcessesPS()
+		if err != nil {
+			return nil, err
+		}
+		summaries := make([]ProcessInfo, 0, len(procs))
+		for _, p := range procs {
+			summaries = append(summaries, summarize(p))
+		}
+		return summaries, nil
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc: %w", err)
+	}
+
+	summaries := make([]ProcessInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue // 不是进程目录
+		}
+
+		summary, err := readProcSummary(pid)
+		if err != nil {
+			continue // 进程可能已退出
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+// readProcSummary 从 /proc/[pid]/stat 解析进程摘要
+func readProcSummary(pid int) (ProcessInfo, error) {
+	data, err := readProcFile(pid, "stat")
+	if err != nil {
+		return ProcessInfo{}, err
+	}
+
+	// 进程名可能包含空格和括号，以最后一个右括号为界
+	content := string(data)
+	start := strings.Index(content, "(")
+	end := strings.LastIndex(content, ")")
+	if start == -1 || end == -1 || end+2 > len(content) {
+		return ProcessInfo{}, fmt.Errorf("invalid stat format")
+	}
+
+	// 括号后的字段: 0: state, 1: ppid, ..., 21: rss（页数）
+	fields := strings.Fields(content[end+2:])
+	if len(fields) < 22 {
+		return ProcessInfo{}, fmt.Errorf("insufficient stat fields")
+	}
+
+	ppid, _ := strconv.Atoi(fields[1])
+	rssPages, _ := strconv.ParseUint(fields[21], 10, 64)
+
+	return ProcessInfo{
+		PID:   pid,
+		PPID:  ppid,
+		Name:  content[start+1 : end],
+		State: parseStateProcStat(fields[0]),
+		RSS:   rssPages * uint64(syscall.Getpagesize()),
+	}, nil
+}
+
+// signalProcess 向进程发送 POSIX 信号（Unix实现）
+func signalProcess(pid int, sig os.Signal) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	defer proc.Release()
+	return proc.Signal(sig)
+}
+
 // listProcessesPS 使用 ps 命令获取进程列表（macOS/BSD）
 func listProcessesPS() ([]*Info, error) {
 	output, err := Run("ps", []string{"ax", "-o", "pid,ppid,user,state,comm"}, 10*time.Second)
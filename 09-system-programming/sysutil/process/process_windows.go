@@ -17,9 +17,11 @@ package process
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 	"unsafe"
@@ -33,6 +35,9 @@ const (
 	MAX_PATH                  = 260
 )
 
+// PROCESS_QUERY_LIMITED_INFORMATION 受保护进程也允许的最小查询权限
+const PROCESS_QUERY_LIMITED_INFORMATION = 0x1000
+
 // Windows API 结构体
 type PROCESSENTRY32 struct {
 	Size              uint32
@@ -131,6 +136,135 @@ func listProcesses() ([]*Info, error) {
 	return procs, nil
 }
 
+// listProcessSummaries 获取进程摘要列表（Windows实现）
+// Toolhelp 快照本身是一致的；快照后退出或无权访问的进程仍会列出，只是 RSS 为 0
+func listProcessSummaries() ([]ProcessInfo, error) {
+	handle, _, err := procCreateToolhelp32Snapshot.Call(
+		uintptr(TH32CS_SNAPPROCESS),
+		0,
+	)
+	if handle == uintptr(syscall.InvalidHandle) {
+		return nil, fmt.Errorf("CreateToolhelp32Snapshot failed: %v", err)
+	}
+	defer procCloseHandle.Call(handle)
+
+	var entry PROCESSENTRY32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+
+	ret, _, _ := procProcess32First.Call(handle, uintptr(unsafe.Pointer(&entry)))
+	if ret == 0 {
+		return nil, fmt.Errorf("Process32First failed")
+	}
+
+	var summaries []ProcessInfo
+	for {
+		summaries = append(summaries, ProcessInfo{
+			PID:   int(entry.ProcessID),
+			PPID:  int(entry.ParentProcessID),
+			Name:  syscall.UTF16ToString(entry.ExeFile[:]),
+			State: StateRunning,
+			RSS:   getProcessWorkingSet(int(entry.ProcessID)),
+		})
+
+		ret, _, _ = procProcess32Next.Call(handle, uintptr(unsafe.Pointer(&entry)))
+		if ret == 0 {
+			break
+		}
+	}
+
+	return summaries, nil
+}
+
+// getProcessWorkingSet 获取进程工作集大小，无法打开进程时返回 0
+func getProcessWorkingSet(pid int) uint64 {
+	handle, _, _ := procOpenProcess.Call(
+		uintptr(PROCESS_QUERY_LIMITED_INFORMATION),
+		0,
+		uintptr(pid),
+	)
+	if handle == 0 {
+		return 0
+	}
+	defer procCloseHandle.Call(handle)
+
+	var memCounters PROCESS_MEMORY_COUNTERS
+	memCounters.cb = uint32(unsafe.Sizeof(memCounters))
+	ret, _, _ := procGetProcessMemoryInfo.Call(
+		handle,
+		uintptr(unsafe.Pointer(&memCounters)),
+		uintptr(memCounters.cb),
+	)
+	if ret == 0 {
+		return 0
+	}
+	return uint64(memCounters.WorkingSetSize)
+}
+
+// 窗口枚举相关的 Windows API
+var (
+	user32                       = syscall.NewLazyDLL("user32.dll")
+	procEnumWindows              = user32.NewProc("EnumWindows")
+	procGetWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
+	procPostMessageW             = user32.NewProc("PostMessageW")
+)
+
+// WM_CLOSE 请求窗口关闭的消息
+const WM_CLOSE = 0x0010
+
+// closeWindows 状态：EnumWindows 回调只能创建有限个，因此共用一个回调并串行化调用
+var (
+	closeWindowsMu       sync.Mutex
+	closeWindowsPID      uint32
+	closeWindowsPosted   int
+	closeWindowsCallback = syscall.NewCallback(func(hwnd, lparam uintptr) uintptr {
+		var windowPID uint32
+		procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&windowPID)))
+		if windowPID == closeWindowsPID {
+			if ret, _, _ := procPostMessageW.Call(hwnd, WM_CLOSE, 0, 0); ret != 0 {
+				closeWindowsPosted++
+			}
+		}
+		return 1 // 继续枚举
+	})
+)
+
+// signalProcess 将 POSIX 信号映射为 Windows 上的等价操作
+func signalProcess(pid int, sig os.Signal) error {
+	switch sig {
+	case os.Kill:
+		return terminateProcess(pid)
+	case syscall.SIGTERM, os.Interrupt:
+		if closeProcessWindows(pid) {
+			return nil
+		}
+		// 控制台进程没有窗口可关闭，只能强制终止
+		return terminateProcess(pid)
+	default:
+		return fmt.Errorf("signal %v is not supported on windows", sig)
+	}
+}
+
+// closeProcessWindows 向进程的所有顶层窗口发送 WM_CLOSE，返回是否至少发送了一个
+func closeProcessWindows(pid int) bool {
+	closeWindowsMu.Lock()
+	defer closeWindowsMu.Unlock()
+
+	closeWindowsPID = uint32(pid)
+	closeWindowsPosted = 0
+	procEnumWindows.Call(closeWindowsCallback, 0)
+	return closeWindowsPosted > 0
+}
+
+// terminateProcess 使用 TerminateProcess 强制终止进程
+func terminateProcess(pid int) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	defer proc.Release()
+	return proc.Kill()
+}
+
 // getProcessInfo 获取指定进程的详细信息（Windows实现）
 func getProcessInfo(pid int) (*Info, error) {
 	// 首先从进程列表中获取基本信息
@@ -211,6 +211,17 @@ type FDLimits struct {
 	Current uint64
 }
 
+// FDUsage 当前进程的文件描述符使用情况
+// Windows 上 Open 为进程句柄数
+type FDUsage struct {
+	// Open 当前打开的描述符数
+	Open uint64
+	// SoftLimit 软限制
+	SoftLimit uint64
+	// HardLimit 硬限制
+	HardLimit uint64
+}
+
 // FDTracker 文件描述符追踪器
 type FDTracker struct {
 	// 追踪的文件描述符
@@ -12,6 +12,10 @@ Package resource 的单元测试
 package resource
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
@@ -133,6 +137,88 @@ func TestGetFDLimits(t *testing.T) {
 		limits.SoftLimit, limits.HardLimit, limits.Current)
 }
 
+// TestGetFDUsage 测试打开和关闭文件时描述符计数的变化
+func TestGetFDUsage(t *testing.T) {
+	before, err := GetFDUsage()
+	if err != nil {
+		t.Fatalf("GetFDUsage failed: %v", err)
+	}
+	if before.Open == 0 {
+		t.Error("open count should not be zero")
+	}
+	if before.SoftLimit == 0 || before.SoftLimit > before.HardLimit {
+		t.Errorf("invalid limits: soft=%d hard=%d", before.SoftLimit, before.HardLimit)
+	}
+
+	const n = 8
+	dir := t.TempDir()
+	files := make([]*os.File, 0, n)
+	for i := 0; i < n; i++ {
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("fd-%d", i)))
+		if err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+		files = append(files, f)
+	}
+
+	opened, err := GetFDUsage()
+	if err != nil {
+		t.Fatalf("GetFDUsage failed: %v", err)
+	}
+	if opened.Open < before.Open+n {
+		t.Errorf("expected at least %d open descriptors, got %d", before.Open+n, opened.Open)
+	}
+
+	for _, f := range files {
+		f.Close()
+	}
+
+	closed, err := GetFDUsage()
+	if err != nil {
+		t.Fatalf("GetFDUsage failed: %v", err)
+	}
+	if closed.Open > opened.Open-n {
+		t.Errorf("expected at most %d open descriptors after close, got %d", opened.Open-n, closed.Open)
+	}
+
+	t.Logf("FD usage: before=%d, opened=%d, closed=%d", before.Open, opened.Open, closed.Open)
+}
+
+// TestSetFDSoftLimit 测试设置软限制
+func TestSetFDSoftLimit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file descriptor limits are not supported on Windows")
+	}
+
+	usage, err := GetFDUsage()
+	if err != nil {
+		t.Fatalf("GetFDUsage failed: %v", err)
+	}
+	defer SetFDSoftLimit(usage.SoftLimit)
+
+	target := usage.SoftLimit - 1
+	if err := SetFDSoftLimit(target); err != nil {
+		t.Fatalf("SetFDSoftLimit failed: %v", err)
+	}
+
+	updated, err := GetFDUsage()
+	if err != nil {
+		t.Fatalf("GetFDUsage failed: %v", err)
+	}
+	if updated.SoftLimit != target {
+		t.Errorf("expected soft limit %d, got %d", target, updated.SoftLimit)
+	}
+	if updated.HardLimit != usage.HardLimit {
+		t.Errorf("hard limit changed: %d -> %d", usage.HardLimit, updated.HardLimit)
+	}
+
+	if usage.HardLimit != ^uint64(0) {
+		if err := SetFDSoftLimit(usage.HardLimit + 1); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("expected ErrLimitExceeded, got %v", err)
+		}
+	}
+}
+
 // TestGetResourceLimits 测试获取资源限制
 func TestGetResourceLimits(t *testing.T) {
 	limits, err := GetResourceLimits()
@@ -1,5 +1,5 @@
-//go:build linux || darwin || freebsd || openbsd || netbsd
-// +build linux darwin freebsd openbsd netbsd
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
 
 /*
 Unix/Linux 平台的资源管理实现
@@ -15,6 +15,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -233,7 +234,7 @@ func parseCPUInfo(data string, info *CPUInfo) {
 // CPU 时间记录（用于计算使用率）
 var lastCPUTimes struct {
 	user, nice, system, idle, iowait, irq, softirq, steal uint64
-	timestamp                                              time.Time
+	timestamp                                             time.Time
 }
 
 // GetCPUUsage 获取CPU使用率（Unix实现）
@@ -413,15 +414,16 @@ func GetDiskInfo() ([]DiskInfo, error) {
 				continue
 			}
 
+			// 各系统 Statfs_t 字段的有无符号不同，统一转换为 uint64
 			blockSize := uint64(stat.Bsize)
 			disk := DiskInfo{
 				Path:        mountPoint,
 				Device:      device,
 				FSType:      fsType,
-				Total:       stat.Blocks * blockSize,
-				Free:        stat.Bavail * blockSize,
-				InodesTotal: stat.Files,
-				InodesFree:  stat.Ffree,
+				Total:       uint64(stat.Blocks) * blockSize,
+				Free:        uint64(stat.Bavail) * blockSize,
+				InodesTotal: uint64(stat.Files),
+				InodesFree:  uint64(stat.Ffree),
 			}
 			disk.Used = disk.Total - disk.Free
 			disk.InodesUsed = disk.InodesTotal - disk.InodesFree
@@ -484,28 +486,80 @@ func GetFDLimits() (*FDLimits, error) {
 	}
 
 	limits := &FDLimits{
-		SoftLimit: rlimit.Cur,
-		HardLimit: rlimit.Max,
+		SoftLimit: uint64(rlimit.Cur),
+		HardLimit: uint64(rlimit.Max),
 	}
 
 	// 获取当前使用的文件描述符数
 	if runtime.GOOS == "linux" {
-		fdPath := fmt.Sprintf("/proc/%d/fd", os.Getpid())
-		entries, err := os.ReadDir(fdPath)
-		if err == nil {
-			limits.Current = uint64(len(entries))
+		if open, err := countOpenFDs(); err == nil {
+			limits.Current = open
 		}
 	}
 
 	return limits, nil
 }
 
+// GetFDUsage 获取当前进程打开的描述符数和 RLIMIT_NOFILE 限制（Unix实现）
+// 可用于检测描述符泄漏
+func GetFDUsage() (FDUsage, error) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return FDUsage{}, fmt.Errorf("failed to get rlimit: %w", err)
+	}
+
+	open, err := countOpenFDs()
+	if err != nil {
+		return FDUsage{}, err
+	}
+
+	return FDUsage{
+		Open:      open,
+		SoftLimit: uint64(rlimit.Cur),
+		HardLimit: uint64(rlimit.Max),
+	}, nil
+}
+
+// SetFDSoftLimit 设置 RLIMIT_NOFILE 软限制，硬限制保持不变（Unix实现）
+func SetFDSoftLimit(n uint64) error {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return fmt.Errorf("failed to get rlimit: %w", err)
+	}
+	hard := uint64(rlimit.Max)
+	if n > hard {
+		return fmt.Errorf("%w: soft limit %d above hard limit %d", ErrLimitExceeded, n, hard)
+	}
+
+	rlimit = newRlimit(n, hard)
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return fmt.Errorf("failed to set rlimit: %w", err)
+	}
+
+	return nil
+}
+
+// countOpenFDs 统计当前进程打开的描述符数
+// Linux 读取 /proc/self/fd，其他系统读取 /dev/fd；不计入读取目录本身占用的描述符
+func countOpenFDs() (uint64, error) {
+	fdPath := "/dev/fd"
+	if runtime.GOOS == "linux" {
+		fdPath = "/proc/self/fd"
+	}
+
+	entries, err := os.ReadDir(fdPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read fd directory: %w", err)
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	return uint64(len(entries) - 1), nil
+}
+
 // SetFDLimits 设置文件描述符限制（Unix实现）
 func SetFDLimits(soft, hard uint64) error {
-	rlimit := syscall.Rlimit{
-		Cur: soft,
-		Max: hard,
-	}
+	rlimit := newRlimit(soft, hard)
 
 	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
 		return fmt.Errorf("failed to set rlimit: %w", err)
@@ -562,6 +616,9 @@ func GetProcessFDs() ([]*FDInfo, error) {
 	return fds, nil
 }
 
+// rlimitNPROC Linux 的 RLIMIT_NPROC，syscall 包未导出该常量
+const rlimitNPROC = 6
+
 // GetResourceLimits 获取资源限制（Unix实现）
 func GetResourceLimits() (*ResourceLimits, error) {
 	limits := &ResourceLimits{}
@@ -569,39 +626,39 @@ func GetResourceLimits() (*ResourceLimits, error) {
 	// 文件描述符限制
 	var nofile syscall.Rlimit
 	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &nofile); err == nil {
-		limits.MaxOpenFiles = nofile.Cur
+		limits.MaxOpenFiles = uint64(nofile.Cur)
 	}
 
 	// 进程数限制（仅Linux）
 	if runtime.GOOS == "linux" {
 		var nproc syscall.Rlimit
-		if err := syscall.Getrlimit(syscall.RLIMIT_NPROC, &nproc); err == nil {
-			limits.MaxProcesses = nproc.Cur
+		if err := syscall.Getrlimit(rlimitNPROC, &nproc); err == nil {
+			limits.MaxProcesses = uint64(nproc.Cur)
 		}
 	}
 
 	// 内存限制
 	var as syscall.Rlimit
 	if err := syscall.Getrlimit(syscall.RLIMIT_AS, &as); err == nil {
-		limits.MaxMemory = as.Cur
+		limits.MaxMemory = uint64(as.Cur)
 	}
 
 	// CPU时间限制
 	var cpu syscall.Rlimit
 	if err := syscall.Getrlimit(syscall.RLIMIT_CPU, &cpu); err == nil {
-		limits.MaxCPU = cpu.Cur
+		limits.MaxCPU = uint64(cpu.Cur)
 	}
 
 	// 文件大小限制
 	var fsize syscall.Rlimit
 	if err := syscall.Getrlimit(syscall.RLIMIT_FSIZE, &fsize); err == nil {
-		limits.MaxFileSize = fsize.Cur
+		limits.MaxFileSize = uint64(fsize.Cur)
 	}
 
 	// 栈大小限制
 	var stack syscall.Rlimit
 	if err := syscall.Getrlimit(syscall.RLIMIT_STACK, &stack); err == nil {
-		limits.MaxStack = stack.Cur
+		limits.MaxStack = uint64(stack.Cur)
 	}
 
 	return limits, nil
@@ -661,5 +718,3 @@ func runCommand(name string, args ...string) (string, error) {
 	}
 	return string(output), nil
 }
-
-import "os/exec"
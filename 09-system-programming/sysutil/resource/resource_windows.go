@@ -60,13 +60,14 @@ type SYSTEM_INFO struct {
 
 // Windows API 函数
 var (
-	kernel32                 = syscall.NewLazyDLL("kernel32.dll")
-	psapi                    = syscall.NewLazyDLL("psapi.dll")
-	procGlobalMemoryStatusEx = kernel32.NewProc("GlobalMemoryStatusEx")
-	procGetSystemInfo        = kernel32.NewProc("GetSystemInfo")
-	procGetDiskFreeSpaceExW  = kernel32.NewProc("GetDiskFreeSpaceExW")
-	procGetLogicalDrives     = kernel32.NewProc("GetLogicalDrives")
-	procGetDriveTypeW        = kernel32.NewProc("GetDriveTypeW")
+	kernel32                  = syscall.NewLazyDLL("kernel32.dll")
+	psapi                     = syscall.NewLazyDLL("psapi.dll")
+	procGlobalMemoryStatusEx  = kernel32.NewProc("GlobalMemoryStatusEx")
+	procGetSystemInfo         = kernel32.NewProc("GetSystemInfo")
+	procGetDiskFreeSpaceExW   = kernel32.NewProc("GetDiskFreeSpaceExW")
+	procGetLogicalDrives      = kernel32.NewProc("GetLogicalDrives")
+	procGetDriveTypeW         = kernel32.NewProc("GetDriveTypeW")
+	procGetProcessHandleCount = kernel32.NewProc("GetProcessHandleCount")
 )
 
 // GetMemoryInfo 获取系统内存信息（Windows实现）
@@ -242,6 +243,33 @@ func GetFDLimits() (*FDLimits, error) {
 	}, nil
 }
 
+// GetFDUsage 获取当前进程的句柄数（Windows实现）
+// 限制为 Windows 默认的每进程句柄上限
+func GetFDUsage() (FDUsage, error) {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return FDUsage{}, fmt.Errorf("failed to get current process: %w", err)
+	}
+
+	var count uint32
+	ret, _, callErr := procGetProcessHandleCount.Call(uintptr(process), uintptr(unsafe.Pointer(&count)))
+	if ret == 0 {
+		return FDUsage{}, fmt.Errorf("GetProcessHandleCount failed: %w", callErr)
+	}
+
+	return FDUsage{
+		Open:      uint64(count),
+		SoftLimit: 16777216,
+		HardLimit: 16777216,
+	}, nil
+}
+
+// SetFDSoftLimit 设置文件描述符软限制（Windows实现）
+// Windows 不支持此操作
+func SetFDSoftLimit(n uint64) error {
+	return fmt.Errorf("setting file descriptor limits is not supported on Windows")
+}
+
 // SetFDLimits 设置文件描述符限制（Windows实现）
 // Windows 不支持此操作
 func SetFDLimits(soft, hard uint64) error {
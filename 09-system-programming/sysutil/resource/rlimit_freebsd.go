@@ -0,0 +1,12 @@
+//go:build freebsd
+// +build freebsd
+
+package resource
+
+import "syscall"
+
+// newRlimit 构造 Rlimit，FreeBSD 的字段为 int64
+// RLIM_INFINITY 在 uint64 中表示为全 1，转换后仍是 FreeBSD 的 -1
+func newRlimit(cur, max uint64) syscall.Rlimit {
+	return syscall.Rlimit{Cur: int64(cur), Max: int64(max)}
+}
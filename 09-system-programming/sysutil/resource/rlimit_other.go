@@ -0,0 +1,11 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package resource
+
+import "syscall"
+
+// newRlimit 构造 Rlimit，Linux 与 macOS 的字段为 uint64
+func newRlimit(cur, max uint64) syscall.Rlimit {
+	return syscall.Rlimit{Cur: cur, Max: max}
+}
@@ -1,7 +1,18 @@
 package main
 
 import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -110,7 +121,7 @@ type PassManager struct {
 	statistics   PassManagerStatistics
 	runtime      *PassRuntime
 	validator    PassValidator
-	cache        map[string]*PassResult
+	cache        *OptimizationCache
 	listeners    []PassListener
 	middleware   []PassMiddleware
 	hooks        []PassHook
@@ -127,6 +138,11 @@ type PassManagerConfig struct {
 	FailFast            bool
 	TimeoutPerPass      time.Duration
 	MaxMemoryPerPass    int64
+	MinROI              float64       // 自适应调度的ROI阈值
+	TimeBudget          time.Duration // 自适应调度的总时间预算，0表示不限制
+	MemoryBudget        int64         // 自适应调度的总内存预算，0表示不限制
+	// AllowForwardReferences 允许注册时引用尚未注册的过程，引用关系改由Validate统一检查
+	AllowForwardReferences bool
 }
 
 // PassManagerStatistics 过程管理器统计
@@ -507,6 +523,7 @@ type OptimizationContext struct {
 	diagnostics      *DiagnosticContext
 	debug            *DebugContext
 	profiling        *ProfilingContext
+	profile          *ProfileData
 	mutex            sync.RWMutex
 }
 
@@ -574,6 +591,7 @@ type Function struct {
 	signature    *FunctionSignature
 	basicBlocks  []*BasicBlock
 	instructions []*Instruction
+	params       []*Variable // 形参变量，与OpCall的实参按位置对应
 	cfg          *ControlFlowGraph
 	domTree      *DominatorTree
 	loopInfo     *LoopInfo
@@ -957,16 +975,44 @@ type LivenessAnalyzer struct {
 	iterations  int
 }
 
+// LivenessResult 活跃性分析结果，位集合按variables中的下标编号
+type LivenessResult struct {
+	variables  []*Variable
+	index      map[*Variable]int
+	liveIn     map[*BasicBlock]*BitSet
+	liveOut    map[*BasicBlock]*BitSet
+	iterations int
+}
+
 // ReachingDefinitionsAnalyzer 到达定义分析器
 type ReachingDefinitionsAnalyzer struct {
 	reachingIn  map[*BasicBlock]*BitSet
 	reachingOut map[*BasicBlock]*BitSet
 	gen         map[*BasicBlock]*BitSet
 	kill        map[*BasicBlock]*BitSet
-	definitions map[*Variable]*Definition
+	definitions map[*Variable][]*Definition
 	workList    []*BasicBlock
 }
 
+// Definition 对变量的一次定义
+type Definition struct {
+	index       int // 在到达定义位集合中的编号
+	variable    *Variable
+	instruction *Instruction // 为nil时表示函数入口处的初值（参数或未初始化的值）
+	block       *BasicBlock
+}
+
+// ReachingDefinitionsResult 到达定义分析结果，位集合按definitions中的下标编号
+type ReachingDefinitionsResult struct {
+	definitions []*Definition
+	byVariable  map[*Variable][]*Definition
+	byInst      map[*Instruction]*Definition
+	mayDefs     map[*Instruction][]*Definition // store和call对取过地址的变量的可能定义，不覆盖已有定义
+	reachingIn  map[*BasicBlock]*BitSet
+	reachingOut map[*BasicBlock]*BitSet
+	iterations  int
+}
+
 // AvailableExpressionsAnalyzer 可用表达式分析器
 type AvailableExpressionsAnalyzer struct {
 	availableIn  map[*BasicBlock]*BitSet
@@ -977,6 +1023,25 @@ type AvailableExpressionsAnalyzer struct {
 	workList     []*BasicBlock
 }
 
+// Expression 可用表达式分析中的表达式。同一计算保存在不同变量中视为不同表达式，
+// 这样表达式可用即意味着result在所有路径上都持有该值
+type Expression struct {
+	opcode   Opcode
+	operands []*Operand
+	result   *Variable // 保存表达式值的变量
+	value    string    // 不含结果变量的规范形式，用于识别重复计算
+}
+
+// AvailableExpressionsResult 可用表达式分析结果，位集合按expressions中的下标编号
+type AvailableExpressionsResult struct {
+	expressions  []*Expression
+	availableIn  map[*BasicBlock]*BitSet
+	availableOut map[*BasicBlock]*BitSet
+	instGen      map[*Instruction]int     // 指令生成的表达式下标，-1表示不生成
+	instKill     map[*Instruction]*BitSet // 指令执行后失效的表达式
+	iterations   int
+}
+
 // DefUseChainsAnalyzer 定义-使用链分析器
 type DefUseChainsAnalyzer struct {
 	defUseChains map[*Definition][]*Use
@@ -993,6 +1058,19 @@ type AliasAnalyzer struct {
 	precision AliasPrecision
 }
 
+// PointsToSet 指针可能指向的抽象内存位置集合，每个被取地址的变量是一个位置
+type PointsToSet struct {
+	locations map[*Variable]bool
+}
+
+// AliasResult 别名分析结果
+type AliasResult struct {
+	pointsTo    map[*Variable]*PointsToSet
+	unknown     *Variable                  // 函数外部的内存：形参、调用结果以及逃逸到外部的位置都经由它关联
+	allocations map[*Instruction]*Variable // 每个分配点对应的抽象位置
+	iterations  int
+}
+
 // AliasAlgorithm 别名分析算法
 type AliasAlgorithm int
 
@@ -1105,9 +1183,9 @@ type DeadCodeEliminator struct {
 type MarkingStrategy int
 
 const (
-	MarkingConservative MarkingStrategy = iota
-	MarkingAggressive
-	MarkingAdaptive
+	MarkingConservative MarkingStrategy = iota // 可能产生副作用的指令（如可能陷入的load和除法）一律保留
+	MarkingAggressive                          // 只保留store、call、return和分支
+	MarkingAdaptive                            // 同保守策略，但除数为非零常量的除法视为无副作用
 )
 
 // UnreachableCodeEliminator 不可达代码消除器
@@ -1164,7 +1242,7 @@ const (
 
 // TailCallOptimizer 尾调用优化器
 type TailCallOptimizer struct {
-	tailCalls      []*CallInstruction
+	tailCalls      []*Instruction // 最近一次识别出的自递归尾调用
 	optimization   TailCallOptimization
 	recursionDepth int
 	stackUsage     int64
@@ -1179,6 +1257,14 @@ const (
 	TailCallElimination
 )
 
+// JumpThreading 跳转线程化：前驱到达条件分支时条件已知，则让该前驱直接跳到确定的后继
+type JumpThreading struct {
+	reaching *ReachingDefinitionsAnalyzer
+}
+
+// BlockMerger 基本块合并：把只有唯一前驱、且该前驱只有它一个后继的块并入前驱
+type BlockMerger struct{}
+
 // LoopOptimizer 循环优化器
 type LoopOptimizer struct {
 	loopInvariantMotion *LoopInvariantCodeMotion
@@ -1204,6 +1290,7 @@ type LoopOptimizerConfig struct {
 	MaxUnrollFactor        int
 	VectorizationThreshold int
 	FusionThreshold        int
+	HotLoopThreshold       float64 // 有剖面数据时，头块频率低于该值的循环视为冷循环
 }
 
 // LoopOptimizerStatistics 循环优化器统计
@@ -1621,15 +1708,21 @@ type Instruction struct {
 type Opcode int
 
 const (
-	OpLoad Opcode = iota
-	OpStore
+	OpLoad  Opcode = iota // 读取指针操作数指向的内存；没有操作数时表示来自外部的未知值
+	OpStore               // 第一个操作数为地址，第二个为写入的值
 	OpAdd
 	OpSub
 	OpMul
 	OpDiv
-	OpBranch
-	OpCall
-	OpReturn
+	OpBranch // 有条件操作数且有两个后继时为条件分支：条件非零跳转successors[0]，否则successors[1]
+	OpCall   // 第一个操作数为被调函数名（OperandLabel），其后为实参
+	OpReturn // 可选的操作数为返回值
+	OpConst  // 将常量操作数赋给结果变量
+	OpCopy   // 将变量操作数复制给结果变量
+	OpAddr   // 取变量操作数的地址赋给结果变量
+	OpAlloc  // 分配一块新内存，结果为指向它的指针
+	OpShl    // 第一个操作数左移第二个操作数指定的位数
+	OpNeg    // 对唯一的操作数取负
 )
 
 // Operand 操作数
@@ -1830,6 +1923,65 @@ func (bs *BitSet) Difference(other *BitSet) {
 	}
 }
 
+// Count 已设置位的数量
+func (bs *BitSet) Count() int {
+	count := 0
+	for _, word := range bs.bits {
+		count += bits.OnesCount64(word)
+	}
+	return count
+}
+
+// Clone 复制位集合
+func (bs *BitSet) Clone() *BitSet {
+	clone := &BitSet{bits: make([]uint64, len(bs.bits)), size: bs.size}
+	copy(clone.bits, bs.bits)
+	return clone
+}
+
+// Equal 判断两个位集合是否包含相同的位，较短一方缺少的字视为0
+func (bs *BitSet) Equal(other *BitSet) bool {
+	longest := len(bs.bits)
+	if len(other.bits) > longest {
+		longest = len(other.bits)
+	}
+	for i := 0; i < longest; i++ {
+		if bs.word(i) != other.word(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEmpty 判断是否没有设置任何位
+func (bs *BitSet) IsEmpty() bool {
+	for _, word := range bs.bits {
+		if word != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ToSlice 按升序返回已设置位的下标
+func (bs *BitSet) ToSlice() []int {
+	indices := make([]int, 0, bs.Count())
+	for i, word := range bs.bits {
+		for word != 0 {
+			indices = append(indices, i*64+bits.TrailingZeros64(word))
+			word &= word - 1
+		}
+	}
+	return indices
+}
+
+func (bs *BitSet) word(i int) uint64 {
+	if i < len(bs.bits) {
+		return bs.bits[i]
+	}
+	return 0
+}
+
 // 工厂函数和核心方法实现
 
 // NewOptimizationEngine 创建优化引擎
@@ -1841,6 +1993,11 @@ func NewOptimizationEngine(config OptimizationConfig) *OptimizationEngine {
 	}
 
 	engine.passManager = NewPassManager()
+	engine.passManager.cache = engine.cache
+	engine.passManager.config.EnableCaching = config.CacheResults
+	engine.passManager.config.AdaptiveScheduling = config.PassSelection == PassSelectionAdaptive
+	engine.passManager.config.TimeBudget = config.TimeLimit
+	engine.passManager.config.MemoryBudget = config.MemoryLimit
 	engine.dataFlowAnalyzer = NewDataFlowAnalyzer()
 	engine.controlFlowOptimizer = NewControlFlowOptimizer()
 	engine.loopOptimizer = NewLoopOptimizer()
@@ -1867,15 +2024,50 @@ func (oe *OptimizationEngine) Optimize(context *OptimizationContext) *Optimizati
 		Context:   context,
 	}
 
-	// 执行优化过程管道
-	pipelineResult := oe.passManager.ExecutePipeline(context)
-	result.PassResults = pipelineResult.Results
+	// 反复执行优化过程管道，直到没有过程改变IR、达到最大迭代次数或超出时间限制。
+	// 每个过程保留最近一次改变IR的结果，便于分析整体优化效果
+	maxIterations := oe.config.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = 1
+	}
+	combined := &PipelineResult{Results: make(map[string]*PassResult)}
+	iterations := 0
+	for iterations < maxIterations {
+		pipelineResult := oe.passManager.ExecutePipeline(context)
+		iterations++
+		result.Error = pipelineResult.Error
+
+		changed := false
+		for passID, passResult := range pipelineResult.Results {
+			if passResult.Changed {
+				changed = true
+			}
+			if previous, exists := combined.Results[passID]; !exists || passResult.Changed || !previous.Changed {
+				combined.Results[passID] = passResult
+			}
+		}
+		if result.Error != nil || !changed {
+			break
+		}
+
+		// IR已改变，之前的分析结果不再有效
+		oe.invalidateAnalyses(context)
+
+		if oe.config.TimeLimit > 0 && time.Since(startTime) >= oe.config.TimeLimit {
+			break
+		}
+	}
+	result.PassResults = combined.Results
+	oe.statistics.IterationCount = iterations
+	if lookups := oe.passManager.statistics.CacheHits + oe.passManager.statistics.CacheMisses; lookups > 0 {
+		oe.statistics.CacheHitRate = float64(oe.passManager.statistics.CacheHits) / float64(lookups)
+	}
 
 	// 收集优化统计
 	result.Statistics = oe.collectStatistics()
 
 	// 分析优化效果
-	result.Improvements = oe.analyzeImprovements(context, pipelineResult)
+	result.Improvements = oe.analyzeImprovements(context, combined)
 
 	result.EndTime = time.Now()
 	result.Duration = result.EndTime.Sub(result.StartTime)
@@ -1889,12 +2081,14 @@ func (oe *OptimizationEngine) Optimize(context *OptimizationContext) *Optimizati
 // NewPassManager 创建过程管理器
 func NewPassManager() *PassManager {
 	pm := &PassManager{
-		cache: make(map[string]*PassResult),
+		cache:  NewOptimizationCache(),
+		config: PassManagerConfig{MinROI: defaultMinROI},
 	}
 
 	pm.pipeline = NewPassPipeline()
 	pm.scheduler = NewPassScheduler()
 	pm.dependencies = NewDependencyGraph()
+	pm.scheduler.dependencies = pm.dependencies
 	pm.costModel = NewPassCostModel()
 	pm.runtime = NewPassRuntime()
 	pm.validator = NewPassValidator()
@@ -1903,7 +2097,13 @@ func NewPassManager() *PassManager {
 }
 
 // ExecutePipeline 执行管道
-func (pm *PassManager) ExecutePipeline(context *OptimizationContext) *PipelineResult {
+func (pm *PassManager) ExecutePipeline(optContext *OptimizationContext) *PipelineResult {
+	return pm.ExecutePipelineContext(context.Background(), optContext)
+}
+
+// ExecutePipelineContext 执行管道，ctx取消时不再执行后续过程，并把取消原因记录为管道错误。
+// 每个过程的执行时间受TimeoutPerPass限制，过程超时后管道中止并返回超时错误
+func (pm *PassManager) ExecutePipelineContext(ctx context.Context, context *OptimizationContext) *PipelineResult {
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
 
@@ -1911,21 +2111,45 @@ func (pm *PassManager) ExecutePipeline(context *OptimizationContext) *PipelineRe
 	result := &PipelineResult{
 		StartTime: startTime,
 		Results:   make(map[string]*PassResult),
+		Skipped:   make(map[string]string),
 	}
 
-	// 调度优化过程
-	schedule := pm.scheduler.SchedulePasses(pm.passes, context)
+	// 校验过程注册的完整性
+	if err := pm.validateLocked(); err != nil {
+		result.Error = err
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(result.StartTime)
+		return result
+	}
 
-	// 执行调度的过程
-	for _, pass := range schedule {
-		if pm.shouldExecutePass(pass, context) {
-			passResult := pm.executePass(pass, context)
-			result.Results[pass.id] = passResult
+	// 调度优化过程
+	schedule, err := pm.scheduler.SchedulePasses(pm.passes, context)
+	if err != nil {
+		result.Error = err
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(result.StartTime)
+		return result
+	}
 
-			// 检查是否需要终止
-			if pm.shouldTerminate(passResult, context) {
+	if pm.config.AdaptiveScheduling || pm.scheduler.strategy == StrategyAdaptive {
+		// 自适应调度：按成本模型估算的ROI选择和排序过程
+		pm.executeAdaptive(ctx, schedule, context, result)
+	} else {
+		// 执行调度的过程
+		for _, pass := range schedule {
+			if err := ctx.Err(); err != nil {
+				result.Error = err
 				break
 			}
+			if pm.shouldExecutePass(pass, context) {
+				passResult := pm.executePass(ctx, pass, context)
+				result.Results[pass.id] = passResult
+
+				// 检查是否需要终止
+				if pm.shouldTerminate(passResult, context) {
+					break
+				}
+			}
 		}
 	}
 
@@ -1940,9 +2164,25 @@ func (pm *PassManager) RegisterPass(pass *OptimizationPass) error {
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
 
-	// 验证过程
+	// 验证过程，校验器与引用检查发现的问题汇总为一个错误
+	var problems []string
 	if err := pm.validator.ValidatePass(pass); err != nil {
-		return fmt.Errorf("pass validation failed: %w", err)
+		var validationErr *PassValidationError
+		if !errors.As(err, &validationErr) {
+			return fmt.Errorf("pass validation failed: %w", err)
+		}
+		problems = append(problems, validationErr.Problems...)
+	}
+	if !pm.config.AllowForwardReferences {
+		problems = append(problems, pm.unregisteredReferencesLocked(pass)...)
+	}
+	if len(problems) > 0 {
+		return &PassValidationError{Problems: problems}
+	}
+
+	// 检查重复注册
+	if _, exists := pm.dependencies.nodes[pass.id]; exists {
+		return fmt.Errorf("pass %q already registered", pass.id)
 	}
 
 	// 添加到过程列表
@@ -1957,6 +2197,317 @@ func (pm *PassManager) RegisterPass(pass *OptimizationPass) error {
 	return nil
 }
 
+// PassValidationError 过程注册校验错误，汇总所有发现的问题
+type PassValidationError struct {
+	Problems []string
+}
+
+func (e *PassValidationError) Error() string {
+	return fmt.Sprintf("pass validation failed with %d problem(s): %s", len(e.Problems), strings.Join(e.Problems, "; "))
+}
+
+// Validate 校验已注册过程之间的引用关系：依赖、冲突和前提条件引用的过程必须已注册，
+// 且依赖图不能存在环。所有问题汇总为一个*PassValidationError返回
+func (pm *PassManager) Validate() error {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	return pm.validateLocked()
+}
+
+func (pm *PassManager) validateLocked() error {
+	var problems []string
+
+	for _, pass := range pm.passes {
+		problems = append(problems, pm.unregisteredReferencesLocked(pass)...)
+	}
+
+	for _, cycle := range pm.findDependencyCycles() {
+		problems = append(problems, fmt.Sprintf("dependency cycle: %s", strings.Join(cycle, " -> ")))
+	}
+
+	if len(problems) > 0 {
+		return &PassValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// unregisteredReferencesLocked 列出过程的依赖、冲突和前提条件中引用的未注册过程；
+// 引用自身的情况由过程校验器报告，这里跳过
+func (pm *PassManager) unregisteredReferencesLocked(pass *OptimizationPass) []string {
+	var problems []string
+	registered := func(passID string) bool {
+		_, exists := pm.dependencies.nodes[passID]
+		return exists || passID == pass.id
+	}
+	for _, dep := range pass.dependencies {
+		if !registered(dep) {
+			problems = append(problems, fmt.Sprintf("pass %q depends on unregistered pass %q", pass.id, dep))
+		}
+	}
+	for _, conflict := range pass.conflicts {
+		if !registered(conflict) {
+			problems = append(problems, fmt.Sprintf("pass %q conflicts with unregistered pass %q", pass.id, conflict))
+		}
+	}
+	for _, prereq := range pass.prerequisites {
+		if prereq.passID != "" && !registered(prereq.passID) {
+			problems = append(problems, fmt.Sprintf("pass %q has prerequisite on unregistered pass %q", pass.id, prereq.passID))
+		}
+	}
+	return problems
+}
+
+// findDependencyCycles 按注册顺序深度优先遍历依赖图，返回发现的每个环（首尾为同一过程）
+func (pm *PassManager) findDependencyCycles() [][]string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	state := make(map[string]int, len(pm.passes))
+	var stack []string
+	var cycles [][]string
+
+	var visit func(passID string)
+	visit = func(passID string) {
+		state[passID] = visiting
+		stack = append(stack, passID)
+
+		for _, dep := range pm.dependencies.nodes[passID].pass.dependencies {
+			if _, exists := pm.dependencies.nodes[dep]; !exists {
+				continue
+			}
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				// 从栈中截取环路径
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == dep {
+						cycle := append([]string(nil), stack[i:]...)
+						cycles = append(cycles, append(cycle, dep))
+						break
+					}
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[passID] = done
+	}
+
+	for _, pass := range pm.passes {
+		if state[pass.id] == unvisited {
+			visit(pass.id)
+		}
+	}
+	return cycles
+}
+
+// defaultMinROI 自适应调度的默认ROI阈值，低于该值的过程被跳过
+const defaultMinROI = 1.0
+
+// adaptiveRun 单次管道执行中自适应调度的状态。
+// 按过程类别累计预测收益和实际收益，用二者之比校准后续同类过程的ROI
+type adaptiveRun struct {
+	startTime  time.Time
+	memoryUsed int64
+	predicted  map[PassCategory]float64
+	actual     map[PassCategory]float64
+	executed   map[string]bool
+	skipped    map[string]string
+}
+
+// adaptiveCandidate 一个待评估过程及其估算结果
+type adaptiveCandidate struct {
+	pass    *OptimizationPass
+	cost    *CostEstimate
+	benefit float64 // 未经校准的预测收益
+	roi     float64 // 经校准的ROI
+}
+
+// minCalibration 校准系数的下限。同类过程的实际收益为0时系数不降为0，
+// 否则该类过程此后总被跳过，再也得不到新的测量
+const minCalibration = 0.1
+
+func (ar *adaptiveRun) calibration(category PassCategory) float64 {
+	if ar.predicted[category] <= 0 {
+		return 1.0
+	}
+	return max(ar.actual[category]/ar.predicted[category], minCalibration)
+}
+
+// benefitScore 将收益估算折算为单一分值
+func benefitScore(benefit *BenefitEstimate) float64 {
+	if benefit == nil {
+		return 0
+	}
+	return benefit.SpeedImprovement + benefit.SizeReduction + benefit.MemoryReduction +
+		benefit.EnergyReduction + benefit.QualityImprovement
+}
+
+// actualBenefit 根据过程执行结果估计实际收益：未改变代码时为0，
+// 有改进记录时取改进之和，否则视为与预测一致
+func actualBenefit(result *PassResult, predicted float64) float64 {
+	if !result.Success || !result.Changed {
+		return 0
+	}
+	if result.TransformationResult == nil || len(result.TransformationResult.improvements) == 0 {
+		return predicted
+	}
+	total := 0.0
+	for _, improvement := range result.TransformationResult.improvements {
+		total += improvement.improvement
+	}
+	return total
+}
+
+// passCostModel 返回过程自身的成本模型，未设置时使用管理器的默认模型
+func (pm *PassManager) passCostModel(pass *OptimizationPass) PassCostModel {
+	if pass.costModel != nil {
+		return pass.costModel
+	}
+	return pm.costModel
+}
+
+// executeAdaptive 按ROI自适应地执行过程：每轮只评估依赖已满足的过程，
+// 优先执行校准后ROI最高者；ROI低于阈值或超出时间/内存预算的过程被跳过，
+// 依赖被跳过或执行失败的过程同样跳过
+func (pm *PassManager) executeAdaptive(ctx context.Context, schedule []*OptimizationPass, context *OptimizationContext, result *PipelineResult) {
+	run := &adaptiveRun{
+		startTime: result.StartTime,
+		predicted: make(map[PassCategory]float64),
+		actual:    make(map[PassCategory]float64),
+		executed:  make(map[string]bool),
+		skipped:   result.Skipped,
+	}
+
+	scheduled := make(map[string]bool, len(schedule))
+	var pending []*OptimizationPass
+	for _, pass := range schedule {
+		if pm.shouldExecutePass(pass, context) {
+			pending = append(pending, pass)
+			scheduled[pass.id] = true
+		}
+	}
+
+	for len(pending) > 0 {
+		var ready []*adaptiveCandidate
+		var waiting []*OptimizationPass
+
+		for _, pass := range pending {
+			state, blocker := run.dependencyState(pass, scheduled)
+			switch state {
+			case dependencyBlocked:
+				run.skipped[pass.id] = fmt.Sprintf("dependency %q was not executed", blocker)
+			case dependencyPending:
+				waiting = append(waiting, pass)
+			default:
+				ready = append(ready, pm.evaluateCandidate(pass, context, run))
+			}
+		}
+
+		if len(ready) == 0 {
+			// 没有可执行的过程（依赖图已由Validate保证无环，这里仅作防御）
+			for _, pass := range waiting {
+				run.skipped[pass.id] = "dependencies could not be satisfied"
+			}
+			return
+		}
+
+		sort.SliceStable(ready, func(i, j int) bool {
+			if ready[i].roi != ready[j].roi {
+				return ready[i].roi > ready[j].roi
+			}
+			return ready[i].pass.priority > ready[j].pass.priority
+		})
+
+		best := ready[0]
+		pending = waiting
+		for _, candidate := range ready[1:] {
+			pending = append(pending, candidate.pass)
+		}
+
+		if reason := pm.adaptiveSkipReason(best, run); reason != "" {
+			run.skipped[best.pass.id] = reason
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			result.Error = err
+			return
+		}
+		passResult := pm.executePass(ctx, best.pass, context)
+		result.Results[best.pass.id] = passResult
+
+		run.memoryUsed += best.cost.MemoryCost
+		run.predicted[best.pass.category] += best.benefit
+		run.actual[best.pass.category] += actualBenefit(passResult, best.benefit)
+		if passResult.Success {
+			run.executed[best.pass.id] = true
+		}
+
+		if pm.shouldTerminate(passResult, context) {
+			return
+		}
+	}
+}
+
+// dependencyStatus 依赖满足情况
+type dependencyStatus int
+
+const (
+	dependencySatisfied dependencyStatus = iota
+	dependencyPending
+	dependencyBlocked
+)
+
+// dependencyState 判断过程的依赖是否满足。未进入本次调度的依赖视为已满足
+func (ar *adaptiveRun) dependencyState(pass *OptimizationPass, scheduled map[string]bool) (dependencyStatus, string) {
+	state := dependencySatisfied
+	for _, dep := range pass.dependencies {
+		if !scheduled[dep] || ar.executed[dep] {
+			continue
+		}
+		if _, skipped := ar.skipped[dep]; skipped {
+			return dependencyBlocked, dep
+		}
+		state = dependencyPending
+	}
+	return state, ""
+}
+
+// evaluateCandidate 用成本模型估算过程的成本、收益和经校准的ROI
+func (pm *PassManager) evaluateCandidate(pass *OptimizationPass, context *OptimizationContext, run *adaptiveRun) *adaptiveCandidate {
+	model := pm.passCostModel(pass)
+	cost := model.EstimateCost(context)
+	benefit := model.EstimateBenefit(context)
+
+	calibration := run.calibration(pass.category)
+	return &adaptiveCandidate{
+		pass:    pass,
+		cost:    cost,
+		benefit: benefitScore(benefit),
+		roi:     model.ComputeROI(cost, benefit) * calibration,
+	}
+}
+
+// adaptiveSkipReason 返回跳过候选过程的原因，可以执行时返回空字符串
+func (pm *PassManager) adaptiveSkipReason(candidate *adaptiveCandidate, run *adaptiveRun) string {
+	if candidate.roi < pm.config.MinROI {
+		return fmt.Sprintf("ROI %.2f below threshold %.2f", candidate.roi, pm.config.MinROI)
+	}
+	if pm.config.TimeBudget > 0 && time.Since(run.startTime)+candidate.cost.TimeCost > pm.config.TimeBudget {
+		return fmt.Sprintf("estimated time %v exceeds remaining budget", candidate.cost.TimeCost)
+	}
+	if pm.config.MemoryBudget > 0 && run.memoryUsed+candidate.cost.MemoryCost > pm.config.MemoryBudget {
+		return fmt.Sprintf("estimated memory %d exceeds remaining budget", candidate.cost.MemoryCost)
+	}
+	return ""
+}
+
 // NewDataFlowAnalyzer 创建数据流分析器
 func NewDataFlowAnalyzer() *DataFlowAnalyzer {
 	dfa := &DataFlowAnalyzer{
@@ -1992,15 +2543,23 @@ func (dfa *DataFlowAnalyzer) AnalyzeDataFlow(context *OptimizationContext, kind
 
 	switch kind {
 	case DataFlowLiveness:
-		result.results["liveness"] = dfa.livenessAnalyzer.Analyze(context.function)
+		liveness := dfa.livenessAnalyzer.Analyze(context.function).(*LivenessResult)
+		result.results["liveness"] = liveness
+		result.iterations = liveness.iterations
 	case DataFlowReaching:
-		result.results["reaching"] = dfa.reachingDefinitions.Analyze(context.function)
+		reaching := dfa.reachingDefinitions.Analyze(context.function).(*ReachingDefinitionsResult)
+		result.results["reaching"] = reaching
+		result.iterations = reaching.iterations
 	case DataFlowAvailable:
-		result.results["available"] = dfa.availableExpressions.Analyze(context.function)
+		available := dfa.availableExpressions.Analyze(context.function).(*AvailableExpressionsResult)
+		result.results["available"] = available
+		result.iterations = available.iterations
 	case DataFlowDefUse:
 		result.results["defuse"] = dfa.defUseChains.Analyze(context.function)
 	case DataFlowAlias:
-		result.results["alias"] = dfa.aliasAnalyzer.Analyze(context.function)
+		alias := dfa.aliasAnalyzer.Analyze(context.function).(*AliasResult)
+		result.results["alias"] = alias
+		result.iterations = alias.iterations
 	case DataFlowPointer:
 		result.results["pointer"] = dfa.pointerAnalyzer.Analyze(context.function)
 	}
@@ -2014,11 +2573,22 @@ func (dfa *DataFlowAnalyzer) AnalyzeDataFlow(context *OptimizationContext, kind
 
 	// 更新统计
 	dfa.statistics.AnalysisCount++
+	dfa.statistics.IterationCount += int64(result.iterations)
 	dfa.statistics.ConvergenceTime += analysisTime
 
 	return result
 }
 
+// Invalidate 清除函数的缓存分析结果
+func (dfa *DataFlowAnalyzer) Invalidate(function *Function) {
+	dfa.mutex.Lock()
+	defer dfa.mutex.Unlock()
+
+	for kind := DataFlowLiveness; kind <= DataFlowPointer; kind++ {
+		delete(dfa.cache, fmt.Sprintf("%s_%d", function.name, kind))
+	}
+}
+
 // NewControlFlowOptimizer 创建控制流优化器
 func NewControlFlowOptimizer() *ControlFlowOptimizer {
 	cfo := &ControlFlowOptimizer{
@@ -2076,8 +2646,54 @@ func (cfo *ControlFlowOptimizer) OptimizeControlFlow(context *OptimizationContex
 		}
 	}
 
+	// 尾调用优化，在分支布局之前改写控制流
+	if cfo.config.EnableTailCallOptimization {
+		tailCallResult := cfo.tailCallOptimizer.Optimize(context.function)
+		if tailCallResult.optimizedCalls > 0 {
+			changed = true
+			cfo.statistics.TailCallsOptimized += tailCallResult.optimizedCalls
+			result.improvements = append(result.improvements, ControlFlowImprovement{
+				kind:            OptTailCall,
+				description:     fmt.Sprintf("Converted %d self-recursive tail calls to loops", tailCallResult.optimizedCalls),
+				savingsEstimate: float64(tailCallResult.optimizedCalls * 16), // 假设每次调用省去16字节的栈帧
+			})
+		}
+	}
+
+	// 跳转线程化
+	if cfo.config.EnableJumpThreading {
+		threadingResult := cfo.jumpThreading.Thread(context.function)
+		if threadingResult.threadedEdges > 0 {
+			changed = true
+			cfo.statistics.JumpsThreaded += threadingResult.threadedEdges
+			result.improvements = append(result.improvements, ControlFlowImprovement{
+				kind: OptJumpThread,
+				description: fmt.Sprintf("Threaded %d jumps, removed %d dead blocks",
+					threadingResult.threadedEdges, threadingResult.removedBlocks),
+				savingsEstimate: float64(threadingResult.threadedEdges*4 + threadingResult.removedBlocks*20),
+			})
+		}
+	}
+
+	// 块合并，放在会改写边的变换之后收拾直线控制流
+	if cfo.config.EnableBlockMerging {
+		mergeResult := cfo.blockMerger.Merge(context.function)
+		if mergeResult.mergedBlocks > 0 {
+			changed = true
+			cfo.statistics.BlocksMerged += mergeResult.mergedBlocks
+			result.improvements = append(result.improvements, ControlFlowImprovement{
+				kind:            OptBlockMerge,
+				description:     fmt.Sprintf("Merged %d blocks into their predecessors", mergeResult.mergedBlocks),
+				savingsEstimate: float64(mergeResult.mergedBlocks * 4), // 每次合并省去一条跳转
+			})
+		}
+	}
+
 	// 分支优化
 	if cfo.config.EnableBranchOptimization {
+		if context.profile != nil {
+			cfo.branchOptimizer.profileData = context.profile
+		}
 		branchResult := cfo.branchOptimizer.Optimize(context.function)
 		if branchResult.optimizedBranches > 0 {
 			changed = true
@@ -2121,8 +2737,20 @@ func (lo *LoopOptimizer) OptimizeLoops(context *OptimizationContext) []*LoopOpti
 
 	var results []*LoopOptimizationResult
 
-	// 获取函数中的所有循环
-	loops := context.function.loopInfo.loops
+	// 尚未计算循环信息时从控制流图识别自然循环
+	function := context.function
+	if function.loopInfo == nil && function.cfg != nil {
+		if function.domTree == nil {
+			function.domTree = BuildDominatorTree(function.cfg)
+		}
+		function.loopInfo = DetectLoops(function.cfg, function.domTree)
+	}
+
+	// 获取函数中的所有循环，有剖面数据时只优化热循环并按热度排序
+	loops := function.loopInfo.loops
+	if context.profile != nil {
+		loops = lo.hotLoops(loops)
+	}
 
 	for _, loop := range loops {
 		result := lo.optimizeLoop(loop, context)
@@ -2135,6 +2763,31 @@ func (lo *LoopOptimizer) OptimizeLoops(context *OptimizationContext) []*LoopOpti
 	return results
 }
 
+// hotLoops 按头块频率降序排列循环，并丢弃未执行或低于阈值的冷循环
+func (lo *LoopOptimizer) hotLoops(loops []*Loop) []*Loop {
+	hot := make([]*Loop, 0, len(loops))
+	for _, loop := range loops {
+		frequency := loopFrequency(loop)
+		if frequency <= 0 || frequency < lo.config.HotLoopThreshold {
+			continue
+		}
+		hot = append(hot, loop)
+	}
+
+	sort.SliceStable(hot, func(i, j int) bool {
+		return loopFrequency(hot[i]) > loopFrequency(hot[j])
+	})
+	return hot
+}
+
+// loopFrequency 循环头块的执行频率
+func loopFrequency(loop *Loop) float64 {
+	if loop.header == nil {
+		return 0
+	}
+	return loop.header.frequency
+}
+
 // optimizeLoop 优化单个循环
 func (lo *LoopOptimizer) optimizeLoop(loop *Loop, context *OptimizationContext) *LoopOptimizationResult {
 	result := &LoopOptimizationResult{
@@ -2146,7 +2799,7 @@ func (lo *LoopOptimizer) optimizeLoop(loop *Loop, context *OptimizationContext)
 
 	// 循环不变代码外提
 	if lo.config.EnableInvariantMotion {
-		invariantResult := lo.loopInvariantMotion.Hoist(loop)
+		invariantResult := lo.loopInvariantMotion.Hoist(context.function, loop)
 		if invariantResult.hoistedCount > 0 {
 			result.improved = true
 			result.optimizations = append(result.optimizations, LoopOptimizationApplied{
@@ -2161,7 +2814,7 @@ func (lo *LoopOptimizer) optimizeLoop(loop *Loop, context *OptimizationContext)
 
 	// 循环展开
 	if lo.config.EnableUnrolling {
-		unrollResult := lo.loopUnrolling.Unroll(loop)
+		unrollResult := lo.loopUnrolling.Unroll(context.function, loop)
 		if unrollResult.unrolled {
 			result.improved = true
 			result.optimizations = append(result.optimizations, LoopOptimizationApplied{
@@ -2199,6 +2852,8 @@ func NewOptimizationCache() *OptimizationCache {
 		passResults:     make(map[string]*PassResult),
 		analysisResults: make(map[string]*AnalysisResult),
 		maxSize:         1000,
+		lru:             list.New(),
+		entries:         make(map[string]*list.Element),
 	}
 }
 
@@ -2255,7 +2910,7 @@ func NewReachingDefinitionsAnalyzer() *ReachingDefinitionsAnalyzer {
 		reachingOut: make(map[*BasicBlock]*BitSet),
 		gen:         make(map[*BasicBlock]*BitSet),
 		kill:        make(map[*BasicBlock]*BitSet),
-		definitions: make(map[*Variable]*Definition),
+		definitions: make(map[*Variable][]*Definition),
 	}
 }
 
@@ -2316,14 +2971,27 @@ func NewBranchOptimizer() *BranchOptimizer {
 	}
 }
 
+// NewStaticBranchPredictor 创建静态分支预测器，权重为启发式所偏好的分支被执行的概率
+func NewStaticBranchPredictor() *StaticBranchPredictor {
+	return &StaticBranchPredictor{
+		heuristics: []BranchHeuristic{HeuristicLoop, HeuristicReturn},
+		weights: map[BranchHeuristic]float64{
+			HeuristicLoop:   0.88,
+			HeuristicReturn: 0.72,
+		},
+	}
+}
+
 func NewTailCallOptimizer() *TailCallOptimizer {
 	return &TailCallOptimizer{
-		optimization: TailCallToJump,
+		optimization: TailCallToLoop,
 	}
 }
 
 func NewJumpThreading() *JumpThreading {
-	return &JumpThreading{}
+	return &JumpThreading{
+		reaching: NewReachingDefinitionsAnalyzer(),
+	}
 }
 
 func NewBlockMerger() *BlockMerger {
@@ -2338,12 +3006,19 @@ func NewLoopInvariantCodeMotion() *LoopInvariantCodeMotion {
 
 func NewLoopUnrolling() *LoopUnrolling {
 	return &LoopUnrolling{
+		unrollFactor:      4,
 		strategy:          UnrollPartial,
 		costModel:         NewUnrollingCostModel(),
 		remainderHandling: RemainderSeparate,
 	}
 }
 
+func NewUnrollingCostModel() *UnrollingCostModel {
+	return &UnrollingCostModel{
+		codeSizeThreshold: 64,
+	}
+}
+
 func NewLoopFusion() *LoopFusion {
 	return &LoopFusion{
 		dependenceAnalysis: NewDependenceAnalysis(),
@@ -2392,15 +3067,32 @@ func (dpcm *defaultPassCostModel) ComputeROI(cost *CostEstimate, benefit *Benefi
 
 type defaultPassValidator struct{}
 
+// ValidatePass 检查过程自身的定义，不依赖已注册的过程。所有问题汇总为一个*PassValidationError
 func (dpv *defaultPassValidator) ValidatePass(pass *OptimizationPass) error {
+	var problems []string
 	if pass.id == "" {
-		return fmt.Errorf("pass ID cannot be empty")
+		problems = append(problems, "pass ID cannot be empty")
 	}
 	if pass.name == "" {
-		return fmt.Errorf("pass name cannot be empty")
+		problems = append(problems, fmt.Sprintf("pass %q: name cannot be empty", pass.id))
 	}
 	if pass.transformer == nil && pass.analyzer == nil {
-		return fmt.Errorf("pass must have either transformer or analyzer")
+		problems = append(problems, fmt.Sprintf("pass %q must have either transformer or analyzer", pass.id))
+	}
+	if pass.id != "" {
+		for _, dep := range pass.dependencies {
+			if dep == pass.id {
+				problems = append(problems, fmt.Sprintf("pass %q lists itself as a dependency", pass.id))
+			}
+		}
+		for _, conflict := range pass.conflicts {
+			if conflict == pass.id {
+				problems = append(problems, fmt.Sprintf("pass %q lists itself as a conflict", pass.id))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &PassValidationError{Problems: problems}
 	}
 	return nil
 }
@@ -2476,17 +3168,11 @@ type AlertManager struct{}
 type MonitoringDashboard struct{}
 type StateInspector struct{}
 type EnvironmentConfig struct{}
-type ProfileData struct{}
 type PointsToGraph struct{}
-type Definition struct{}
 type Use struct{}
 type AliasSet struct{}
-type PointsToSet struct{}
-type Expression struct{}
 type BranchInstruction struct{}
 type CallInstruction struct{}
-type JumpThreading struct{}
-type BlockMerger struct{}
 type LoopInterchange struct{}
 type LoopDistribution struct{}
 
@@ -2499,12 +3185,9 @@ func NewMonitoringDashboard() *MonitoringDashboard { return &MonitoringDashboard
 func NewExecutionTracer() *ExecutionTracer         { return &ExecutionTracer{} }
 func NewStateInspector() *StateInspector           { return &StateInspector{} }
 func NewEnvironmentConfig() *EnvironmentConfig     { return &EnvironmentConfig{} }
-func NewProfileData() *ProfileData                 { return &ProfileData{} }
 func NewPointsToGraph() *PointsToGraph             { return &PointsToGraph{} }
 
-func NewStaticBranchPredictor() *StaticBranchPredictor   { return &StaticBranchPredictor{} }
 func NewSafetyAnalysis() *SafetyAnalysis                 { return &SafetyAnalysis{} }
-func NewUnrollingCostModel() *UnrollingCostModel         { return &UnrollingCostModel{} }
 func NewDependenceAnalysis() *DependenceAnalysis         { return &DependenceAnalysis{} }
 func NewFusionProfitability() *FusionProfitability       { return &FusionProfitability{} }
 func NewVectorizationCostModel() *VectorizationCostModel { return &VectorizationCostModel{} }
@@ -2531,52 +3214,122 @@ func (oe *OptimizationEngine) initializePasses() {
 			category:     CategoryOptimization,
 			level:        OptLevelBasic,
 			priority:     90,
+			transformer:  &ConstantFoldingTransformer{},
 			enabled:      true,
 			experimental: false,
 		},
 		{
-			id:           "loop_invariant_motion",
-			name:         "Loop Invariant Code Motion",
-			description:  "Move loop-invariant code out of loops",
+			id:           "peephole",
+			name:         "Peephole Optimization",
+			description:  "Apply local rewrite rules over short instruction windows",
+			category:     CategoryOptimization,
+			level:        OptLevelBasic,
+			priority:     60,
+			transformer:  NewPeepholeTransformer(),
+			enabled:      true,
+			experimental: false,
+		},
+		{
+			id:           "function_inlining",
+			name:         "Function Inlining",
+			description:  "Inline small non-recursive callees at their call sites",
 			category:     CategoryOptimization,
 			level:        OptLevelStandard,
-			priority:     80,
+			priority:     97,
+			transformer:  NewInliningTransformer(InliningConfig{}),
 			enabled:      true,
 			experimental: false,
 		},
 		{
-			id:           "vectorization",
-			name:         "Loop Vectorization",
-			description:  "Vectorize suitable loops",
+			id:           "constant_propagation",
+			name:         "Constant Propagation",
+			description:  "Substitute constants into uses reached only by constant definitions",
 			category:     CategoryOptimization,
-			level:        OptLevelAggressive,
-			priority:     70,
+			level:        OptLevelBasic,
+			priority:     95,
+			transformer:  &ConstantPropagationTransformer{},
 			enabled:      true,
 			experimental: false,
 		},
-	}
-
-	for _, pass := range standardPasses {
-		oe.passManager.RegisterPass(pass)
-	}
-}
-
+		{
+			id:           "common_subexpression_elimination",
+			name:         "Common Subexpression Elimination",
+			description:  "Reuse values of expressions already available on all paths",
+			category:     CategoryOptimization,
+			level:        OptLevelStandard,
+			priority:     85,
+			transformer:  &CommonSubexpressionTransformer{},
+			enabled:      true,
+			experimental: false,
+		},
+		{
+			id:           "escape_analysis",
+			name:         "Escape Analysis",
+			description:  "Mark allocations that do not escape the function as stack-allocatable",
+			category:     CategoryOptimization,
+			level:        OptLevelStandard,
+			priority:     75,
+			transformer:  oe.memoryOptimizer,
+			enabled:      true,
+			experimental: false,
+		},
+		{
+			id:           "loop_invariant_motion",
+			name:         "Loop Invariant Code Motion",
+			description:  "Move loop-invariant code out of loops",
+			category:     CategoryOptimization,
+			level:        OptLevelStandard,
+			priority:     80,
+			enabled:      true,
+			experimental: false,
+		},
+		{
+			id:           "vectorization",
+			name:         "Loop Vectorization",
+			description:  "Vectorize suitable loops",
+			category:     CategoryOptimization,
+			level:        OptLevelAggressive,
+			priority:     70,
+			enabled:      true,
+			experimental: false,
+		},
+	}
+
+	for _, pass := range standardPasses {
+		oe.passManager.RegisterPass(pass)
+	}
+}
+
 func (oe *OptimizationEngine) collectStatistics() *OptimizationStatistics {
 	return &OptimizationStatistics{
 		TotalPasses:      oe.statistics.TotalPasses,
 		SuccessfulPasses: oe.statistics.SuccessfulPasses,
 		FailedPasses:     oe.statistics.FailedPasses,
 		OptimizationTime: oe.statistics.OptimizationTime,
+		IterationCount:   oe.statistics.IterationCount,
 		CacheHitRate:     oe.statistics.CacheHitRate,
 	}
 }
 
+// invalidateAnalyses 丢弃基于旧IR计算的分析结果
+func (oe *OptimizationEngine) invalidateAnalyses(context *OptimizationContext) {
+	context.analysisResults = make(map[AnalysisKind]*AnalysisResult)
+	if context.function != nil {
+		oe.dataFlowAnalyzer.Invalidate(context.function)
+	}
+}
+
 func (oe *OptimizationEngine) analyzeImprovements(context *OptimizationContext, result *PipelineResult) []Improvement {
 	var improvements []Improvement
 
-	// 分析性能改进
-	for passID, passResult := range result.Results {
-		if passResult.Success && passResult.Changed {
+	// 分析性能改进，按过程ID排序使结果与报告稳定
+	passIDs := make([]string, 0, len(result.Results))
+	for passID := range result.Results {
+		passIDs = append(passIDs, passID)
+	}
+	sort.Strings(passIDs)
+	for _, passID := range passIDs {
+		if passResult := result.Results[passID]; passResult.Success && passResult.Changed {
 			improvements = append(improvements, Improvement{
 				kind:        ImprovementSpeed,
 				description: fmt.Sprintf("Pass %s improved performance", passID),
@@ -2621,7 +3374,7 @@ func (pm *PassManager) shouldExecutePass(pass *OptimizationPass, context *Optimi
 	return true
 }
 
-func (pm *PassManager) executePass(pass *OptimizationPass, context *OptimizationContext) *PassResult {
+func (pm *PassManager) executePass(ctx context.Context, pass *OptimizationPass, context *OptimizationContext) *PassResult {
 	startTime := time.Now()
 
 	result := &PassResult{
@@ -2631,6 +3384,19 @@ func (pm *PassManager) executePass(pass *OptimizationPass, context *Optimization
 		Changed:   false,
 	}
 
+	// 相同IR与分析状态下执行过且未改变IR的变换过程直接复用结果；改变IR的结果不能跳过执行。
+	// 分析结果引用产生它的函数的基本块和变量，IR相同的另一个函数不能复用，因此带分析器的过程不缓存
+	var cacheKey string
+	if pm.config.EnableCaching && pm.cache != nil && pass.analyzer == nil {
+		cacheKey = passCacheKey(pass, context)
+		if cached, exists := pm.cache.GetPassResult(cacheKey); exists {
+			pm.statistics.CacheHits++
+			hit := *cached
+			return &hit
+		}
+		pm.statistics.CacheMisses++
+	}
+
 	// 执行pass前钩子
 	for _, hook := range pm.hooks {
 		if err := hook.BeforePass(pass, context); err != nil {
@@ -2640,27 +3406,42 @@ func (pm *PassManager) executePass(pass *OptimizationPass, context *Optimization
 		}
 	}
 
-	// 执行变换
-	if pass.transformer != nil {
-		transformResult, err := pass.transformer.Transform(context)
-		if err != nil {
-			result.Error = err
-		} else {
+	// 在独立goroutine中对函数副本执行变换和分析，超时或ctx取消时放弃等待并记为失败。
+	// 变换器不感知取消，被放弃的goroutine会在后台继续修改副本直到返回，
+	// 调用方的IR只在过程成功后才被替换为副本
+	passCtx, cancel := withPassTimeout(ctx, pm.config.TimeoutPerPass)
+	defer cancel()
+
+	workspace := newPassWorkspace(context)
+	done := make(chan *passOutcome, 1)
+	go func() {
+		done <- runPass(pass, workspace.context)
+	}()
+
+	select {
+	case outcome := <-done:
+		if outcome.transformErr == nil && outcome.analysisErr == nil {
+			workspace.commit()
+		}
+		if outcome.transformErr != nil {
+			result.Error = outcome.transformErr
+		} else if outcome.transform != nil {
 			result.Success = true
-			result.Changed = transformResult.changed
-			result.TransformationResult = transformResult
+			result.Changed = outcome.transform.changed
+			result.TransformationResult = outcome.transform
 		}
-	}
-
-	// 执行分析
-	if pass.analyzer != nil {
-		analysisResult, err := pass.analyzer.Analyze(context)
-		if err != nil {
-			result.Error = err
-		} else {
+		if outcome.analysisErr != nil {
+			result.Error = outcome.analysisErr
+		} else if outcome.analysis != nil {
 			result.Success = true
-			result.AnalysisResult = analysisResult
-			context.analysisResults[pass.analyzer.GetAnalysisKind()] = analysisResult
+			result.AnalysisResult = outcome.analysis
+			context.analysisResults[pass.analyzer.GetAnalysisKind()] = outcome.analysis
+		}
+	case <-passCtx.Done():
+		if ctx.Err() == nil {
+			result.Error = fmt.Errorf("pass %q timed out after %v: %w", pass.id, pm.config.TimeoutPerPass, passCtx.Err())
+		} else {
+			result.Error = fmt.Errorf("pass %q canceled: %w", pass.id, ctx.Err())
 		}
 	}
 
@@ -2687,6 +3468,10 @@ func (pm *PassManager) executePass(pass *OptimizationPass, context *Optimization
 	pass.statistics.TotalTime += result.Duration
 	pass.statistics.LastExecutionTime = result.EndTime
 
+	if cacheKey != "" && result.Success && !result.Changed {
+		pm.cache.PutPassResult(cacheKey, result)
+	}
+
 	return result
 }
 
@@ -2696,11 +3481,6 @@ func (pm *PassManager) shouldTerminate(result *PassResult, context *Optimization
 		return true
 	}
 
-	// 检查时间限制
-	if pm.config.TimeoutPerPass > 0 && result.Duration > pm.config.TimeoutPerPass {
-		return true
-	}
-
 	// 检查内存限制
 	if pm.config.MaxMemoryPerPass > 0 && pm.statistics.MemoryUsage > pm.config.MaxMemoryPerPass {
 		return true
@@ -2709,14 +3489,438 @@ func (pm *PassManager) shouldTerminate(result *PassResult, context *Optimization
 	return false
 }
 
+// passOutcome 过程在后台goroutine中执行的结果
+type passOutcome struct {
+	transform    *TransformationResult
+	transformErr error
+	analysis     *AnalysisResult
+	analysisErr  error
+}
+
+// withPassTimeout 为单个过程派生带超时的ctx，timeout为0表示不限制
+func withPassTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// runPass 依次执行过程的变换器和分析器，分析结果由调用方写回上下文
+func runPass(pass *OptimizationPass, context *OptimizationContext) *passOutcome {
+	outcome := &passOutcome{}
+	if pass.transformer != nil {
+		outcome.transform, outcome.transformErr = pass.transformer.Transform(context)
+	}
+	if pass.analyzer != nil {
+		outcome.analysis, outcome.analysisErr = pass.analyzer.Analyze(context)
+	}
+	return outcome
+}
+
+// passWorkspace 过程执行所用的函数副本。过程只修改副本，成功后由commit替换回调用方的上下文，
+// 超时后仍在运行的过程因此不会再触及调用方的IR
+type passWorkspace struct {
+	original *OptimizationContext
+	context  *OptimizationContext
+	clone    *Function
+	nodes    map[*CallNode]*CallNode // 副本调用图节点到原节点
+	edges    map[*CallEdge]*CallEdge // 副本调用图边到原边
+}
+
+// newPassWorkspace 复制上下文中的函数（基本块、指令、控制流图、支配树、循环信息和调用图），
+// 变量和其他函数在副本间共享
+func newPassWorkspace(original *OptimizationContext) *passWorkspace {
+	ws := &passWorkspace{original: original}
+	ws.context = &OptimizationContext{
+		function:         original.function,
+		module:           original.module,
+		program:          original.program,
+		analysisResults:  make(map[AnalysisKind]*AnalysisResult, len(original.analysisResults)),
+		transformResults: make(map[string]*TransformationResult, len(original.transformResults)),
+		metadata:         original.metadata,
+		environment:      original.environment,
+		constraints:      original.constraints,
+		goals:            original.goals,
+		resources:        original.resources,
+		diagnostics:      original.diagnostics,
+		debug:            original.debug,
+		profiling:        original.profiling,
+		profile:          original.profile,
+	}
+	for kind, analysis := range original.analysisResults {
+		ws.context.analysisResults[kind] = analysis
+	}
+	for id, transform := range original.transformResults {
+		ws.context.transformResults[id] = transform
+	}
+
+	if original.function != nil {
+		ws.clone = ws.cloneFunction(original.function)
+		ws.context.function = ws.clone
+	}
+	return ws
+}
+
+func (ws *passWorkspace) cloneFunction(function *Function) *Function {
+	clone := *function
+	blocks := make(map[*BasicBlock]*BasicBlock, len(function.basicBlocks))
+	mapBlock := func(block *BasicBlock) *BasicBlock {
+		if copied, exists := blocks[block]; exists {
+			return copied
+		}
+		return block
+	}
+	mapBlocks := func(list []*BasicBlock) []*BasicBlock {
+		if list == nil {
+			return nil
+		}
+		mapped := make([]*BasicBlock, len(list))
+		for i, block := range list {
+			mapped[i] = mapBlock(block)
+		}
+		return mapped
+	}
+
+	instructions := make(map[*Instruction]*Instruction)
+	cloneInstruction := func(inst *Instruction, block *BasicBlock) *Instruction {
+		if copied, exists := instructions[inst]; exists {
+			return copied
+		}
+		copied := cloneInstructions([]*Instruction{inst}, block, "")[0]
+		if inst.metadata != nil {
+			copied.metadata = make(map[string]interface{}, len(inst.metadata))
+			for key, value := range inst.metadata {
+				copied.metadata[key] = value
+			}
+		}
+		instructions[inst] = copied
+		return copied
+	}
+
+	clone.basicBlocks = make([]*BasicBlock, len(function.basicBlocks))
+	for i, block := range function.basicBlocks {
+		copied := *block
+		if block.liveIn != nil {
+			copied.liveIn = block.liveIn.Clone()
+		}
+		if block.liveOut != nil {
+			copied.liveOut = block.liveOut.Clone()
+		}
+		blocks[block] = &copied
+		clone.basicBlocks[i] = &copied
+	}
+	for _, block := range clone.basicBlocks {
+		block.predecessors = mapBlocks(block.predecessors)
+		block.successors = mapBlocks(block.successors)
+		original := block.instructions
+		block.instructions = make([]*Instruction, len(original))
+		for i, inst := range original {
+			block.instructions[i] = cloneInstruction(inst, block)
+		}
+	}
+	if function.instructions != nil {
+		clone.instructions = make([]*Instruction, len(function.instructions))
+		for i, inst := range function.instructions {
+			clone.instructions[i] = cloneInstruction(inst, mapBlock(inst.block))
+		}
+	}
+	if function.params != nil {
+		clone.params = append([]*Variable(nil), function.params...)
+	}
+	if function.metadata != nil {
+		metadata := *function.metadata
+		clone.metadata = &metadata
+	}
+
+	if cfg := function.cfg; cfg != nil {
+		clone.cfg = &ControlFlowGraph{entry: mapBlock(cfg.entry), exit: mapBlock(cfg.exit), blocks: mapBlocks(cfg.blocks)}
+		for _, edge := range cfg.edges {
+			copied := *edge
+			copied.source, copied.target = mapBlock(edge.source), mapBlock(edge.target)
+			clone.cfg.edges = append(clone.cfg.edges, &copied)
+		}
+	}
+	if dom := function.domTree; dom != nil {
+		nodes := make(map[*DomNode]*DomNode, len(dom.nodes))
+		for _, node := range dom.nodes {
+			copied := *node
+			copied.block = mapBlock(node.block)
+			nodes[node] = &copied
+		}
+		mapNode := func(node *DomNode) *DomNode {
+			if copied, exists := nodes[node]; exists {
+				return copied
+			}
+			return node
+		}
+		clone.domTree = &DominatorTree{root: mapNode(dom.root), nodes: make(map[*BasicBlock]*DomNode, len(dom.nodes))}
+		for block, node := range dom.nodes {
+			copied := nodes[node]
+			copied.parent = mapNode(node.parent)
+			copied.children = make([]*DomNode, len(node.children))
+			for i, child := range node.children {
+				copied.children[i] = mapNode(child)
+			}
+			clone.domTree.nodes[mapBlock(block)] = copied
+		}
+	}
+	if info := function.loopInfo; info != nil {
+		loops := make(map[*Loop]*Loop, len(info.loops))
+		var copyLoop func(loop *Loop) *Loop
+		copyLoop = func(loop *Loop) *Loop {
+			if loop == nil {
+				return nil
+			}
+			if copied, exists := loops[loop]; exists {
+				return copied
+			}
+			copied := *loop
+			loops[loop] = &copied
+			copied.header = mapBlock(loop.header)
+			copied.blocks = mapBlocks(loop.blocks)
+			copied.exits = mapBlocks(loop.exits)
+			copied.parent = copyLoop(loop.parent)
+			copied.children = make([]*Loop, len(loop.children))
+			for i, child := range loop.children {
+				copied.children[i] = copyLoop(child)
+			}
+			return &copied
+		}
+		clone.loopInfo = &LoopInfo{depth: info.depth, loops: make([]*Loop, len(info.loops))}
+		for i, loop := range info.loops {
+			clone.loopInfo.loops[i] = copyLoop(loop)
+		}
+	}
+
+	if graph := function.callGraph; graph != nil {
+		clone.callGraph = ws.cloneCallGraph(graph, function, &clone, instructions)
+	}
+	return &clone
+}
+
+// cloneCallGraph 复制调用图，原函数的节点指向副本，其调用点换成副本中的指令
+func (ws *passWorkspace) cloneCallGraph(graph *CallGraph, function, clone *Function, instructions map[*Instruction]*Instruction) *CallGraph {
+	copies := make(map[*CallNode]*CallNode, len(graph.nodes))
+	ws.nodes = make(map[*CallNode]*CallNode, len(graph.nodes))
+	ws.edges = make(map[*CallEdge]*CallEdge, len(graph.edges))
+	mapNode := func(node *CallNode) *CallNode {
+		if node == nil {
+			return nil
+		}
+		if copied, exists := copies[node]; exists {
+			return copied
+		}
+		copied := &CallNode{function: node.function}
+		if node.function == function {
+			copied.function = clone
+		}
+		copies[node] = copied
+		ws.nodes[copied] = node
+		return copied
+	}
+
+	cloned := &CallGraph{nodes: make([]*CallNode, len(graph.nodes))}
+	for i, node := range graph.nodes {
+		cloned.nodes[i] = mapNode(node)
+	}
+	for original, copied := range copies {
+		copied.callees = remapCallNodes(original.callees, mapNode)
+		copied.callers = remapCallNodes(original.callers, mapNode)
+	}
+	for _, edge := range graph.edges {
+		copied := &CallEdge{caller: mapNode(edge.caller), callee: mapNode(edge.callee), callSite: edge.callSite}
+		if inst, exists := instructions[edge.callSite]; exists {
+			copied.callSite = inst
+		}
+		ws.edges[copied] = edge
+		cloned.edges = append(cloned.edges, copied)
+	}
+	return cloned
+}
+
+// commit 用副本替换调用方上下文中的函数，函数、调用图节点和未变的边保持原有身份
+func (ws *passWorkspace) commit() {
+	ws.original.analysisResults = ws.context.analysisResults
+	ws.original.transformResults = ws.context.transformResults
+	if ws.clone == nil {
+		return
+	}
+
+	function := ws.original.function
+	graph := function.callGraph
+	cloneGraph := ws.clone.callGraph
+	*function = *ws.clone
+	if graph == nil || cloneGraph == nil {
+		return
+	}
+
+	mapNode := func(node *CallNode) *CallNode {
+		if original, exists := ws.nodes[node]; exists {
+			return original
+		}
+		return node
+	}
+	for copied, original := range ws.nodes {
+		original.function = copied.function
+		if original.function == ws.clone {
+			original.function = function
+		}
+		original.callees = remapCallNodes(copied.callees, mapNode)
+		original.callers = remapCallNodes(copied.callers, mapNode)
+	}
+	graph.nodes = remapCallNodes(cloneGraph.nodes, mapNode)
+	edges := make([]*CallEdge, 0, len(cloneGraph.edges))
+	for _, copied := range cloneGraph.edges {
+		edge, exists := ws.edges[copied]
+		if !exists {
+			edge = &CallEdge{}
+		}
+		edge.caller, edge.callee, edge.callSite = mapNode(copied.caller), mapNode(copied.callee), copied.callSite
+		edges = append(edges, edge)
+	}
+	graph.edges = edges
+	function.callGraph = graph
+}
+
+func remapCallNodes(nodes []*CallNode, mapNode func(*CallNode) *CallNode) []*CallNode {
+	if nodes == nil {
+		return nil
+	}
+	mapped := make([]*CallNode, len(nodes))
+	for i, node := range nodes {
+		mapped[i] = mapNode(node)
+	}
+	return mapped
+}
+
 // 更多占位符类型和方法
 type OptimizationCache struct {
 	passResults     map[string]*PassResult
 	analysisResults map[string]*AnalysisResult
 	maxSize         int
+	lru             *list.List               // 过程结果的键，最近使用的在前
+	entries         map[string]*list.Element // 键到lru元素的索引
 	mutex           sync.RWMutex
 }
 
+// GetPassResult 查找缓存的过程结果，命中时标记为最近使用
+func (oc *OptimizationCache) GetPassResult(key string) (*PassResult, bool) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	result, exists := oc.passResults[key]
+	if exists {
+		oc.lru.MoveToFront(oc.entries[key])
+	}
+	return result, exists
+}
+
+// PutPassResult 缓存过程结果，超过maxSize时淘汰最久未使用的结果
+func (oc *OptimizationCache) PutPassResult(key string, result *PassResult) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	if element, exists := oc.entries[key]; exists {
+		oc.passResults[key] = result
+		oc.lru.MoveToFront(element)
+		return
+	}
+
+	oc.passResults[key] = result
+	oc.entries[key] = oc.lru.PushFront(key)
+	for oc.maxSize > 0 && oc.lru.Len() > oc.maxSize {
+		oldest := oc.lru.Back()
+		oc.lru.Remove(oldest)
+		delete(oc.passResults, oldest.Value.(string))
+		delete(oc.entries, oldest.Value.(string))
+	}
+}
+
+// passCacheKey 由过程ID与IR、剖面数据、调用图、已有分析结果的指纹组成，任一输入变化时键随之变化。
+// 键不区分IR相同的不同函数，只能用于不携带分析结果的变换过程
+func passCacheKey(pass *OptimizationPass, context *OptimizationContext) string {
+	h := fnv.New64a()
+	if function := context.function; function != nil {
+		hashFunctionIR(h, function)
+
+		// 剖面数据影响热度排序和内联、展开的收益估算
+		if context.profile != nil {
+			if profile := context.profile.functions[function.name]; profile != nil {
+				blocks := make([]string, 0, len(profile.blocks))
+				for id, count := range profile.blocks {
+					blocks = append(blocks, fmt.Sprintf("%s=%d", id, count))
+				}
+				sort.Strings(blocks)
+				edges := make([]string, 0, len(profile.edges))
+				for edge, count := range profile.edges {
+					edges = append(edges, fmt.Sprintf("%s->%s=%d", edge.From, edge.To, count))
+				}
+				sort.Strings(edges)
+				fmt.Fprintf(h, "profile %v %v\n", blocks, edges)
+			}
+		}
+
+		// 调用图的边和被调函数的IR决定内联等过程的结果
+		if graph := function.callGraph; graph != nil {
+			for _, edge := range graph.edges {
+				if edge.caller == nil || edge.callee == nil || edge.caller.function == nil || edge.callee.function == nil {
+					continue
+				}
+				site := ""
+				if edge.callSite != nil {
+					site = edge.callSite.id
+				}
+				fmt.Fprintf(h, "call %s -> %s @%s\n", edge.caller.function.name, edge.callee.function.name, site)
+				if edge.caller.function == function && edge.callee.function != function {
+					hashFunctionIR(h, edge.callee.function)
+				}
+			}
+		}
+	}
+
+	kinds := make([]int, 0, len(context.analysisResults))
+	for kind, analysis := range context.analysisResults {
+		if analysis != nil && analysis.valid {
+			kinds = append(kinds, int(kind))
+		}
+	}
+	sort.Ints(kinds)
+	fmt.Fprintf(h, "analyses %v", kinds)
+
+	return fmt.Sprintf("%s:%016x", pass.id, h.Sum64())
+}
+
+// hashFunctionIR 写入函数的基本块、执行频率、后继和指令
+func hashFunctionIR(w io.Writer, function *Function) {
+	fmt.Fprintf(w, "func %s\n", function.name)
+	for _, block := range function.basicBlocks {
+		fmt.Fprintf(w, "block %s freq=%g ->", block.id, block.frequency)
+		for _, successor := range block.successors {
+			fmt.Fprintf(w, " %s", successor.id)
+		}
+		io.WriteString(w, "\n")
+		for _, inst := range block.instructions {
+			fmt.Fprintf(w, "  %d", inst.opcode)
+			if inst.result != nil {
+				fmt.Fprintf(w, " %s=", inst.result.name)
+			}
+			for _, operand := range inst.operands {
+				switch {
+				case operand == nil:
+					io.WriteString(w, " _")
+				case operand.kind == OperandVariable && operand.variable != nil:
+					fmt.Fprintf(w, " v:%s", operand.variable.name)
+				case operand.kind == OperandConstant:
+					fmt.Fprintf(w, " c:%T:%v", operand.constant, operand.constant)
+				default:
+					fmt.Fprintf(w, " l:%s", operand.label)
+				}
+			}
+			io.WriteString(w, "\n")
+		}
+	}
+}
+
 type PassResult struct {
 	PassID               string
 	StartTime            time.Time
@@ -2734,6 +3938,8 @@ type PipelineResult struct {
 	EndTime   time.Time
 	Duration  time.Duration
 	Results   map[string]*PassResult
+	Skipped   map[string]string // 自适应调度跳过的过程及原因
+	Error     error
 }
 
 type OptimizationResult struct {
@@ -2745,6 +3951,313 @@ type OptimizationResult struct {
 	PassResults  map[string]*PassResult
 	Statistics   *OptimizationStatistics
 	Improvements []Improvement
+	Error        error
+}
+
+// reportVersion 优化报告格式版本，字段语义变化时递增
+const reportVersion = 1
+
+// OptimizationReport 优化结果的可序列化形式，用于持久化和比较不同编译运行的结果。
+// 过程按ID排序，时间长度以纳秒记录，保证相同结果生成相同的文档
+type OptimizationReport struct {
+	Version      int                 `json:"version"`
+	StartTime    time.Time           `json:"start_time"`
+	EndTime      time.Time           `json:"end_time"`
+	DurationNS   int64               `json:"duration_ns"`
+	Success      bool                `json:"success"`
+	Error        string              `json:"error,omitempty"`
+	Passes       []PassReport        `json:"passes"`
+	Improvements []ImprovementReport `json:"improvements"`
+	Statistics   *StatisticsReport   `json:"statistics,omitempty"`
+}
+
+// PassReport 单个过程的执行结果
+type PassReport struct {
+	ID           string              `json:"id"`
+	StartTime    time.Time           `json:"start_time"`
+	EndTime      time.Time           `json:"end_time"`
+	DurationNS   int64               `json:"duration_ns"`
+	Success      bool                `json:"success"`
+	Changed      bool                `json:"changed"`
+	Error        string              `json:"error,omitempty"`
+	Improvements []ImprovementReport `json:"improvements,omitempty"`
+	Regressions  []RegressionReport  `json:"regressions,omitempty"`
+}
+
+// ImprovementReport 改进的可序列化形式
+type ImprovementReport struct {
+	Kind        ImprovementKind `json:"kind"`
+	Description string          `json:"description"`
+	Metric      string          `json:"metric,omitempty"`
+	OldValue    float64         `json:"old_value"`
+	NewValue    float64         `json:"new_value"`
+	Improvement float64         `json:"improvement"`
+	Confidence  float64         `json:"confidence"`
+}
+
+// RegressionReport 退化的可序列化形式
+type RegressionReport struct {
+	Kind        RegressionKind `json:"kind"`
+	Description string         `json:"description"`
+	Metric      string         `json:"metric,omitempty"`
+	OldValue    float64        `json:"old_value"`
+	NewValue    float64        `json:"new_value"`
+	Regression  float64        `json:"regression"`
+	Severity    SeverityLevel  `json:"severity"`
+}
+
+// StatisticsReport 汇总统计，逐过程统计按过程ID作为键
+type StatisticsReport struct {
+	TotalPasses       int64                           `json:"total_passes"`
+	SuccessfulPasses  int64                           `json:"successful_passes"`
+	FailedPasses      int64                           `json:"failed_passes"`
+	OptimizationNS    int64                           `json:"optimization_ns"`
+	CodeSizeReduction float64                         `json:"code_size_reduction"`
+	PerformanceGain   float64                         `json:"performance_gain"`
+	MemoryReduction   float64                         `json:"memory_reduction"`
+	EnergyReduction   float64                         `json:"energy_reduction"`
+	IterationCount    int                             `json:"iteration_count"`
+	CacheHitRate      float64                         `json:"cache_hit_rate"`
+	LastOptimization  time.Time                       `json:"last_optimization"`
+	Passes            map[string]PassStatisticsReport `json:"passes,omitempty"`
+}
+
+// PassStatisticsReport 单个过程的累计统计
+type PassStatisticsReport struct {
+	ExecutionCount     int64     `json:"execution_count"`
+	SuccessCount       int64     `json:"success_count"`
+	FailureCount       int64     `json:"failure_count"`
+	TotalNS            int64     `json:"total_ns"`
+	AverageNS          int64     `json:"average_ns"`
+	MinNS              int64     `json:"min_ns"`
+	MaxNS              int64     `json:"max_ns"`
+	MemoryUsage        int64     `json:"memory_usage"`
+	TransformationRate float64   `json:"transformation_rate"`
+	ImprovementRatio   float64   `json:"improvement_ratio"`
+	LastExecution      time.Time `json:"last_execution"`
+}
+
+// MarshalReport 把优化结果序列化为稳定的JSON文档。上下文不参与序列化，
+// 错误只保留消息文本
+func (result *OptimizationResult) MarshalReport() ([]byte, error) {
+	report := OptimizationReport{
+		Version:      reportVersion,
+		StartTime:    result.StartTime,
+		EndTime:      result.EndTime,
+		DurationNS:   int64(result.Duration),
+		Success:      result.Success,
+		Error:        errorMessage(result.Error),
+		Passes:       []PassReport{},
+		Improvements: improvementReports(result.Improvements),
+	}
+
+	passIDs := make([]string, 0, len(result.PassResults))
+	for passID := range result.PassResults {
+		passIDs = append(passIDs, passID)
+	}
+	sort.Strings(passIDs)
+	for _, passID := range passIDs {
+		passResult := result.PassResults[passID]
+		passReport := PassReport{
+			ID:         passID,
+			StartTime:  passResult.StartTime,
+			EndTime:    passResult.EndTime,
+			DurationNS: int64(passResult.Duration),
+			Success:    passResult.Success,
+			Changed:    passResult.Changed,
+			Error:      errorMessage(passResult.Error),
+		}
+		if transform := passResult.TransformationResult; transform != nil {
+			if len(transform.improvements) > 0 {
+				passReport.Improvements = improvementReports(transform.improvements)
+			}
+			for _, regression := range transform.regressions {
+				passReport.Regressions = append(passReport.Regressions, RegressionReport{
+					Kind:        regression.kind,
+					Description: regression.description,
+					Metric:      regression.metric,
+					OldValue:    regression.oldValue,
+					NewValue:    regression.newValue,
+					Regression:  regression.regression,
+					Severity:    regression.severity,
+				})
+			}
+		}
+		report.Passes = append(report.Passes, passReport)
+	}
+
+	if stats := result.Statistics; stats != nil {
+		report.Statistics = &StatisticsReport{
+			TotalPasses:       stats.TotalPasses,
+			SuccessfulPasses:  stats.SuccessfulPasses,
+			FailedPasses:      stats.FailedPasses,
+			OptimizationNS:    int64(stats.OptimizationTime),
+			CodeSizeReduction: stats.CodeSizeReduction,
+			PerformanceGain:   stats.PerformanceGain,
+			MemoryReduction:   stats.MemoryReduction,
+			EnergyReduction:   stats.EnergyReduction,
+			IterationCount:    stats.IterationCount,
+			CacheHitRate:      stats.CacheHitRate,
+			LastOptimization:  stats.LastOptimizationTime,
+		}
+		if len(stats.PassStatistics) > 0 {
+			report.Statistics.Passes = make(map[string]PassStatisticsReport, len(stats.PassStatistics))
+			for passID, passStats := range stats.PassStatistics {
+				report.Statistics.Passes[passID] = PassStatisticsReport{
+					ExecutionCount:     passStats.ExecutionCount,
+					SuccessCount:       passStats.SuccessCount,
+					FailureCount:       passStats.FailureCount,
+					TotalNS:            int64(passStats.TotalTime),
+					AverageNS:          int64(passStats.AverageTime),
+					MinNS:              int64(passStats.MinTime),
+					MaxNS:              int64(passStats.MaxTime),
+					MemoryUsage:        passStats.MemoryUsage,
+					TransformationRate: passStats.TransformationRate,
+					ImprovementRatio:   passStats.ImprovementRatio,
+					LastExecution:      passStats.LastExecutionTime,
+				}
+			}
+		}
+	}
+
+	return json.MarshalIndent(report, "", "  ")
+}
+
+// LoadReport 从MarshalReport生成的文档恢复优化结果。恢复的结果没有上下文，
+// 错误以消息文本重建，再次序列化得到相同的文档
+func LoadReport(data []byte) (*OptimizationResult, error) {
+	var report OptimizationReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("decode optimization report: %w", err)
+	}
+	if report.Version != reportVersion {
+		return nil, fmt.Errorf("unsupported optimization report version %d", report.Version)
+	}
+
+	result := &OptimizationResult{
+		StartTime:    report.StartTime,
+		EndTime:      report.EndTime,
+		Duration:     time.Duration(report.DurationNS),
+		Success:      report.Success,
+		PassResults:  make(map[string]*PassResult, len(report.Passes)),
+		Improvements: improvementsFromReports(report.Improvements),
+		Error:        messageError(report.Error),
+	}
+	for _, passReport := range report.Passes {
+		if _, exists := result.PassResults[passReport.ID]; exists {
+			return nil, fmt.Errorf("duplicate pass %q in optimization report", passReport.ID)
+		}
+		passResult := &PassResult{
+			PassID:    passReport.ID,
+			StartTime: passReport.StartTime,
+			EndTime:   passReport.EndTime,
+			Duration:  time.Duration(passReport.DurationNS),
+			Success:   passReport.Success,
+			Changed:   passReport.Changed,
+			Error:     messageError(passReport.Error),
+		}
+		if len(passReport.Improvements) > 0 || len(passReport.Regressions) > 0 {
+			transform := &TransformationResult{
+				passID:       passReport.ID,
+				success:      passReport.Success,
+				changed:      passReport.Changed,
+				improvements: improvementsFromReports(passReport.Improvements),
+			}
+			for _, regression := range passReport.Regressions {
+				transform.regressions = append(transform.regressions, Regression{
+					kind:        regression.Kind,
+					description: regression.Description,
+					metric:      regression.Metric,
+					oldValue:    regression.OldValue,
+					newValue:    regression.NewValue,
+					regression:  regression.Regression,
+					severity:    regression.Severity,
+				})
+			}
+			passResult.TransformationResult = transform
+		}
+		result.PassResults[passReport.ID] = passResult
+	}
+
+	if stats := report.Statistics; stats != nil {
+		result.Statistics = &OptimizationStatistics{
+			TotalPasses:          stats.TotalPasses,
+			SuccessfulPasses:     stats.SuccessfulPasses,
+			FailedPasses:         stats.FailedPasses,
+			OptimizationTime:     time.Duration(stats.OptimizationNS),
+			CodeSizeReduction:    stats.CodeSizeReduction,
+			PerformanceGain:      stats.PerformanceGain,
+			MemoryReduction:      stats.MemoryReduction,
+			EnergyReduction:      stats.EnergyReduction,
+			PassStatistics:       make(map[string]*PassStatistics, len(stats.Passes)),
+			IterationCount:       stats.IterationCount,
+			CacheHitRate:         stats.CacheHitRate,
+			LastOptimizationTime: stats.LastOptimization,
+		}
+		for passID, passStats := range stats.Passes {
+			result.Statistics.PassStatistics[passID] = &PassStatistics{
+				ExecutionCount:     passStats.ExecutionCount,
+				SuccessCount:       passStats.SuccessCount,
+				FailureCount:       passStats.FailureCount,
+				TotalTime:          time.Duration(passStats.TotalNS),
+				AverageTime:        time.Duration(passStats.AverageNS),
+				MinTime:            time.Duration(passStats.MinNS),
+				MaxTime:            time.Duration(passStats.MaxNS),
+				MemoryUsage:        passStats.MemoryUsage,
+				TransformationRate: passStats.TransformationRate,
+				ImprovementRatio:   passStats.ImprovementRatio,
+				LastExecutionTime:  passStats.LastExecution,
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func improvementReports(improvements []Improvement) []ImprovementReport {
+	reports := make([]ImprovementReport, 0, len(improvements))
+	for _, improvement := range improvements {
+		reports = append(reports, ImprovementReport{
+			Kind:        improvement.kind,
+			Description: improvement.description,
+			Metric:      improvement.metric,
+			OldValue:    improvement.oldValue,
+			NewValue:    improvement.newValue,
+			Improvement: improvement.improvement,
+			Confidence:  improvement.confidence,
+		})
+	}
+	return reports
+}
+
+func improvementsFromReports(reports []ImprovementReport) []Improvement {
+	var improvements []Improvement
+	for _, report := range reports {
+		improvements = append(improvements, Improvement{
+			kind:        report.Kind,
+			description: report.Description,
+			metric:      report.Metric,
+			oldValue:    report.OldValue,
+			newValue:    report.NewValue,
+			improvement: report.Improvement,
+			confidence:  report.Confidence,
+		})
+	}
+	return improvements
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func messageError(message string) error {
+	if message == "" {
+		return nil
+	}
+	return errors.New(message)
 }
 
 // 接口定义
@@ -2781,7 +4294,6 @@ type PassMiddleware interface {
 
 // 更多工厂函数占位符实现
 func NewExpressionOptimizer() *ExpressionOptimizer { return &ExpressionOptimizer{} }
-func NewMemoryOptimizer() *MemoryOptimizer         { return &MemoryOptimizer{} }
 func NewFunctionOptimizer() *FunctionOptimizer     { return &FunctionOptimizer{} }
 func NewParallelOptimizer() *ParallelOptimizer     { return &ParallelOptimizer{} }
 func NewPerformanceProfiler() *PerformanceProfiler { return &PerformanceProfiler{} }
@@ -2789,109 +4301,3895 @@ func NewCodeGenOptimizer() *CodeGenOptimizer       { return &CodeGenOptimizer{}
 
 // 占位符类型
 type ExpressionOptimizer struct{}
-type MemoryOptimizer struct{}
 type FunctionOptimizer struct{}
 type ParallelOptimizer struct{}
 type PerformanceProfiler struct{}
 type CodeGenOptimizer struct{}
 
-// 实现占位符方法
-func (la *LivenessAnalyzer) Analyze(function *Function) interface{} {
-	// 实现活跃性分析算法
-	return nil
-}
+// BuildDominatorTree 使用Cooper-Harvey-Kennedy迭代算法构建支配树，入口不可达的块不在树中
+func BuildDominatorTree(cfg *ControlFlowGraph) *DominatorTree {
+	tree := &DominatorTree{nodes: make(map[*BasicBlock]*DomNode)}
+	entry := cfg.entryBlock()
+	if entry == nil {
+		return tree
+	}
 
-func (rda *ReachingDefinitionsAnalyzer) Analyze(function *Function) interface{} {
-	// 实现到达定义分析算法
-	return nil
-}
+	// 计算逆后序，算法按逆后序处理块，并用后序编号比较位置
+	successors := cfg.successorsOf()
+	postorder := make(map[*BasicBlock]int)
+	var order []*BasicBlock
+	var visit func(block *BasicBlock)
+	visit = func(block *BasicBlock) {
+		postorder[block] = -1
+		for _, successor := range successors(block) {
+			if _, seen := postorder[successor]; !seen {
+				visit(successor)
+			}
+		}
+		postorder[block] = len(order)
+		order = append(order, block)
+	}
+	visit(entry)
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
 
-func (aea *AvailableExpressionsAnalyzer) Analyze(function *Function) interface{} {
-	// 实现可用表达式分析算法
-	return nil
+	predecessors := make(map[*BasicBlock][]*BasicBlock)
+	for _, block := range order {
+		for _, successor := range successors(block) {
+			predecessors[successor] = append(predecessors[successor], block)
+		}
+	}
+
+	idom := map[*BasicBlock]*BasicBlock{entry: entry}
+	intersect := func(a, b *BasicBlock) *BasicBlock {
+		for a != b {
+			for postorder[a] < postorder[b] {
+				a = idom[a]
+			}
+			for postorder[b] < postorder[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, block := range order[1:] {
+			var newIdom *BasicBlock
+			for _, predecessor := range predecessors[block] {
+				if idom[predecessor] == nil {
+					continue
+				}
+				if newIdom == nil {
+					newIdom = predecessor
+				} else {
+					newIdom = intersect(predecessor, newIdom)
+				}
+			}
+			if idom[block] != newIdom {
+				idom[block] = newIdom
+				changed = true
+			}
+		}
+	}
+
+	// 直接支配者在逆后序中总是先出现，因此父节点总是先创建
+	tree.root = &DomNode{block: entry}
+	tree.nodes[entry] = tree.root
+	for _, block := range order[1:] {
+		parent := tree.nodes[idom[block]]
+		node := &DomNode{block: block, parent: parent, depth: parent.depth + 1}
+		parent.children = append(parent.children, node)
+		tree.nodes[block] = node
+	}
+	return tree
 }
 
-func (duca *DefUseChainsAnalyzer) Analyze(function *Function) interface{} {
-	// 实现定义-使用链分析算法
-	return nil
+// Dominates 判断a是否支配b，每个块都支配自身
+func (dt *DominatorTree) Dominates(a, b *BasicBlock) bool {
+	nodeA, nodeB := dt.nodes[a], dt.nodes[b]
+	if nodeA == nil || nodeB == nil {
+		return false
+	}
+	for nodeB != nil && nodeB.depth > nodeA.depth {
+		nodeB = nodeB.parent
+	}
+	return nodeB == nodeA
 }
 
-func (aa *AliasAnalyzer) Analyze(function *Function) interface{} {
-	// 实现别名分析算法
+// ImmediateDominator 返回块的直接支配者，入口块和不可达块返回nil
+func (dt *DominatorTree) ImmediateDominator(block *BasicBlock) *BasicBlock {
+	if node := dt.nodes[block]; node != nil && node.parent != nil {
+		return node.parent.block
+	}
 	return nil
 }
 
-func (pa *PointerAnalyzer) Analyze(function *Function) interface{} {
-	// 实现指针分析算法
+// DetectLoops 通过回边（目标支配源的边）识别自然循环，同一头块的多条回边合并为一个循环。
+// 循环按头块在支配树先序遍历中的顺序排列，外层循环总在内层循环之前
+func DetectLoops(cfg *ControlFlowGraph, dom *DominatorTree) *LoopInfo {
+	info := &LoopInfo{}
+	if dom == nil || dom.root == nil {
+		return info
+	}
+
+	// 支配树先序遍历给出可达块的稳定顺序
+	var order []*BasicBlock
+	position := make(map[*BasicBlock]int)
+	var walk func(node *DomNode)
+	walk = func(node *DomNode) {
+		position[node.block] = len(order)
+		order = append(order, node.block)
+		for _, child := range node.children {
+			walk(child)
+		}
+	}
+	walk(dom.root)
+
+	successors := cfg.successorsOf()
+	predecessors := make(map[*BasicBlock][]*BasicBlock)
+	latches := make(map[*BasicBlock][]*BasicBlock)
+	for _, block := range order {
+		for _, successor := range successors(block) {
+			if _, reachable := position[successor]; !reachable {
+				continue
+			}
+			predecessors[successor] = append(predecessors[successor], block)
+			if dom.Dominates(successor, block) {
+				latches[successor] = append(latches[successor], block)
+			}
+		}
+	}
+
+	members := make(map[*Loop]map[*BasicBlock]bool)
+	for _, header := range order {
+		if len(latches[header]) == 0 {
+			continue
+		}
+
+		// 从回边源出发沿前驱反向搜索，头块截断搜索
+		body := map[*BasicBlock]bool{header: true}
+		worklist := append([]*BasicBlock(nil), latches[header]...)
+		for len(worklist) > 0 {
+			block := worklist[len(worklist)-1]
+			worklist = worklist[:len(worklist)-1]
+			if body[block] {
+				continue
+			}
+			body[block] = true
+			worklist = append(worklist, predecessors[block]...)
+		}
+
+		loop := &Loop{id: "loop_" + header.id, header: header}
+		for _, block := range order {
+			if body[block] {
+				loop.blocks = append(loop.blocks, block)
+			}
+		}
+		seen := make(map[*BasicBlock]bool)
+		for _, block := range loop.blocks {
+			for _, successor := range successors(block) {
+				if !body[successor] && !seen[successor] {
+					seen[successor] = true
+					loop.exits = append(loop.exits, successor)
+				}
+			}
+		}
+		members[loop] = body
+		info.loops = append(info.loops, loop)
+	}
+
+	// 父循环是包含该循环头块的最小其他循环；外层循环先出现，深度可以顺序计算
+	for _, loop := range info.loops {
+		for _, candidate := range info.loops {
+			if candidate == loop || !members[candidate][loop.header] || len(candidate.blocks) <= len(loop.blocks) {
+				continue
+			}
+			if loop.parent == nil || len(candidate.blocks) < len(loop.parent.blocks) {
+				loop.parent = candidate
+			}
+		}
+		loop.depth = 1
+		if loop.parent != nil {
+			loop.depth = loop.parent.depth + 1
+			loop.parent.children = append(loop.parent.children, loop)
+		}
+		if loop.depth > info.depth {
+			info.depth = loop.depth
+		}
+	}
+	return info
+}
+
+// entryBlock 未显式指定入口时使用第一个基本块
+func (cfg *ControlFlowGraph) entryBlock() *BasicBlock {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.entry != nil {
+		return cfg.entry
+	}
+	if len(cfg.blocks) > 0 {
+		return cfg.blocks[0]
+	}
 	return nil
 }
 
-func (dce *DeadCodeEliminator) Eliminate(function *Function) *DeadCodeResult {
-	return &DeadCodeResult{eliminatedCount: 5}
+// successorsOf 有边列表时按边列表计算后继，否则使用基本块自身的后继
+func (cfg *ControlFlowGraph) successorsOf() func(*BasicBlock) []*BasicBlock {
+	if len(cfg.edges) == 0 {
+		return func(block *BasicBlock) []*BasicBlock { return block.successors }
+	}
+	successors := make(map[*BasicBlock][]*BasicBlock)
+	for _, edge := range cfg.edges {
+		successors[edge.source] = append(successors[edge.source], edge.target)
+	}
+	return func(block *BasicBlock) []*BasicBlock { return successors[block] }
 }
 
-func (uce *UnreachableCodeEliminator) Eliminate(function *Function) *UnreachableResult {
-	return &UnreachableResult{eliminatedBlocks: 2}
+// Analyze 反向迭代求解活跃变量：liveOut(B) = ∪ liveIn(S)，liveIn(B) = use(B) ∪ (liveOut(B) - def(B))
+func (la *LivenessAnalyzer) Analyze(function *Function) interface{} {
+	result := &LivenessResult{
+		index:   make(map[*Variable]int),
+		liveIn:  make(map[*BasicBlock]*BitSet),
+		liveOut: make(map[*BasicBlock]*BitSet),
+	}
+	la.liveIn = result.liveIn
+	la.liveOut = result.liveOut
+	la.definitions = make(map[*Instruction]*BitSet)
+	la.uses = make(map[*Instruction]*BitSet)
+	la.iterations = 0
+	if function == nil || len(function.basicBlocks) == 0 {
+		return result
+	}
+
+	// 按出现顺序为变量编号
+	number := func(variable *Variable) {
+		if _, exists := result.index[variable]; !exists {
+			result.index[variable] = len(result.variables)
+			result.variables = append(result.variables, variable)
+		}
+	}
+	for _, block := range function.basicBlocks {
+		for _, inst := range block.instructions {
+			for _, operand := range inst.operands {
+				if operand != nil && operand.kind == OperandVariable && operand.variable != nil {
+					number(operand.variable)
+				}
+			}
+			if inst.result != nil {
+				number(inst.result)
+			}
+		}
+	}
+	size := len(result.variables)
+
+	// 逐条指令计算use/def，再正向合成块级use(B)与def(B)
+	blockUse := make(map[*BasicBlock]*BitSet)
+	blockDef := make(map[*BasicBlock]*BitSet)
+	for _, block := range function.basicBlocks {
+		use, def := NewBitSet(size), NewBitSet(size)
+		for _, inst := range block.instructions {
+			instUse, instDef := NewBitSet(size), NewBitSet(size)
+			for _, operand := range inst.operands {
+				if operand != nil && operand.kind == OperandVariable && operand.variable != nil {
+					i := result.index[operand.variable]
+					instUse.Set(i)
+					// 块内先于定义的使用才属于use(B)
+					if !def.Test(i) {
+						use.Set(i)
+					}
+				}
+			}
+			if inst.result != nil {
+				instDef.Set(result.index[inst.result])
+				def.Set(result.index[inst.result])
+			}
+			la.uses[inst] = instUse
+			la.definitions[inst] = instDef
+		}
+		blockUse[block], blockDef[block] = use, def
+		la.liveIn[block] = NewBitSet(size)
+		la.liveOut[block] = NewBitSet(size)
+	}
+
+	// 逆序遍历基本块收敛更快，一轮内没有变化即到达不动点
+	la.workList = make([]*BasicBlock, 0, len(function.basicBlocks))
+	for i := len(function.basicBlocks) - 1; i >= 0; i-- {
+		la.workList = append(la.workList, function.basicBlocks[i])
+	}
+	for la.changed = true; la.changed; {
+		la.changed = false
+		la.iterations++
+		for _, block := range la.workList {
+			out := NewBitSet(size)
+			for _, successor := range block.successors {
+				if in, exists := la.liveIn[successor]; exists {
+					out.Union(in)
+				}
+			}
+			in := out.Clone()
+			in.Difference(blockDef[block])
+			in.Union(blockUse[block])
+
+			if !in.Equal(la.liveIn[block]) || !out.Equal(la.liveOut[block]) {
+				la.changed = true
+			}
+			la.liveIn[block], la.liveOut[block] = in, out
+		}
+	}
+
+	for _, block := range function.basicBlocks {
+		block.liveIn, block.liveOut = la.liveIn[block], la.liveOut[block]
+	}
+	result.iterations = la.iterations
+	return result
 }
 
-func (bo *BranchOptimizer) Optimize(function *Function) *BranchResult {
-	return &BranchResult{optimizedBranches: 3, performanceGain: 0.15}
+// LiveIn 返回块入口处活跃的变量，按编号顺序
+func (lr *LivenessResult) LiveIn(block *BasicBlock) []*Variable {
+	return lr.variablesIn(lr.liveIn[block])
 }
 
-func (licm *LoopInvariantCodeMotion) Hoist(loop *Loop) *InvariantResult {
-	return &InvariantResult{hoistedCount: 4, speedupEstimate: 0.2}
+// LiveOut 返回块出口处活跃的变量，按编号顺序
+func (lr *LivenessResult) LiveOut(block *BasicBlock) []*Variable {
+	return lr.variablesIn(lr.liveOut[block])
 }
 
-func (lu *LoopUnrolling) Unroll(loop *Loop) *UnrollResult {
-	return &UnrollResult{unrolled: true, factor: 4, speedupEstimate: 0.3}
+// IsLiveIn 判断变量在块入口处是否活跃
+func (lr *LivenessResult) IsLiveIn(block *BasicBlock, variable *Variable) bool {
+	i, exists := lr.index[variable]
+	return exists && lr.liveIn[block] != nil && lr.liveIn[block].Test(i)
 }
 
-func (lv *LoopVectorization) Vectorize(loop *Loop) *VectorResult {
-	return &VectorResult{vectorized: true, width: 4, speedupEstimate: 0.4}
+// IsLiveOut 判断变量在块出口处是否活跃
+func (lr *LivenessResult) IsLiveOut(block *BasicBlock, variable *Variable) bool {
+	i, exists := lr.index[variable]
+	return exists && lr.liveOut[block] != nil && lr.liveOut[block].Test(i)
 }
 
-func (dg *DependencyGraph) AddPass(pass *OptimizationPass) {
-	node := &DependencyNode{
-		passID: pass.id,
-		pass:   pass,
+func (lr *LivenessResult) variablesIn(set *BitSet) []*Variable {
+	var variables []*Variable
+	if set == nil {
+		return variables
 	}
-	dg.nodes[pass.id] = node
+	for _, i := range set.ToSlice() {
+		variables = append(variables, lr.variables[i])
+	}
+	return variables
 }
 
-func (ps *PassScheduler) SchedulePasses(passes []*OptimizationPass, context *OptimizationContext) []*OptimizationPass {
-	// 实现pass调度算法
-	return passes
+// 实现占位符方法
+
+// Analyze 正向迭代求解到达定义：in(B) = ∪ out(P)，out(B) = gen(B) ∪ (in(B) - kill(B))。
+// 每个变量在入口块还有一个隐式定义，表示未经函数内定义就到达的初值。
+// store和call可能经指针写入取过地址的变量，对这些变量各产生一个不覆盖其他定义的可能定义
+func (rda *ReachingDefinitionsAnalyzer) Analyze(function *Function) interface{} {
+	result := &ReachingDefinitionsResult{
+		byVariable:  make(map[*Variable][]*Definition),
+		byInst:      make(map[*Instruction]*Definition),
+		mayDefs:     make(map[*Instruction][]*Definition),
+		reachingIn:  make(map[*BasicBlock]*BitSet),
+		reachingOut: make(map[*BasicBlock]*BitSet),
+	}
+	rda.reachingIn = result.reachingIn
+	rda.reachingOut = result.reachingOut
+	rda.gen = make(map[*BasicBlock]*BitSet)
+	rda.kill = make(map[*BasicBlock]*BitSet)
+	rda.definitions = result.byVariable
+	if function == nil || len(function.basicBlocks) == 0 {
+		return result
+	}
+
+	entry := function.basicBlocks[0]
+	addDefinition := func(variable *Variable, inst *Instruction, block *BasicBlock) *Definition {
+		def := &Definition{index: len(result.definitions), variable: variable, instruction: inst, block: block}
+		result.definitions = append(result.definitions, def)
+		result.byVariable[variable] = append(result.byVariable[variable], def)
+		return def
+	}
+	taken := addressTakenVariables(function)
+	for _, variable := range taken {
+		addDefinition(variable, nil, entry)
+	}
+	for _, block := range function.basicBlocks {
+		for _, inst := range block.instructions {
+			for _, operand := range inst.operands {
+				if operand != nil && operand.kind == OperandVariable && operand.variable != nil && result.byVariable[operand.variable] == nil {
+					addDefinition(operand.variable, nil, entry)
+				}
+			}
+			if inst.result != nil {
+				if result.byVariable[inst.result] == nil {
+					addDefinition(inst.result, nil, entry)
+				}
+				result.byInst[inst] = addDefinition(inst.result, inst, block)
+			}
+			if writesMemory(inst) {
+				for _, variable := range taken {
+					result.mayDefs[inst] = append(result.mayDefs[inst], addDefinition(variable, inst, block))
+				}
+			}
+		}
+	}
+	size := len(result.definitions)
+	initial := NewBitSet(size)
+	for _, def := range result.definitions {
+		if def.instruction == nil {
+			initial.Set(def.index)
+		}
+	}
+
+	// 块内对同一变量的后一次定义覆盖前一次
+	predecessors := make(map[*BasicBlock][]*BasicBlock)
+	for _, block := range function.basicBlocks {
+		gen, kill := NewBitSet(size), NewBitSet(size)
+		for _, inst := range block.instructions {
+			if def := result.byInst[inst]; def != nil {
+				for _, other := range result.byVariable[def.variable] {
+					gen.Clear(other.index)
+					kill.Set(other.index)
+				}
+				gen.Set(def.index)
+			}
+			for _, def := range result.mayDefs[inst] {
+				gen.Set(def.index)
+			}
+		}
+		rda.gen[block], rda.kill[block] = gen, kill
+		rda.reachingIn[block] = NewBitSet(size)
+		rda.reachingOut[block] = NewBitSet(size)
+		for _, successor := range block.successors {
+			predecessors[successor] = append(predecessors[successor], block)
+		}
+	}
+
+	rda.workList = function.basicBlocks
+	for changed := true; changed; {
+		changed = false
+		result.iterations++
+		for _, block := range rda.workList {
+			in := NewBitSet(size)
+			if block == entry {
+				in.Union(initial)
+			}
+			for _, predecessor := range predecessors[block] {
+				in.Union(rda.reachingOut[predecessor])
+			}
+			out := in.Clone()
+			out.Difference(rda.kill[block])
+			out.Union(rda.gen[block])
+
+			if !in.Equal(rda.reachingIn[block]) || !out.Equal(rda.reachingOut[block]) {
+				changed = true
+			}
+			rda.reachingIn[block], rda.reachingOut[block] = in, out
+		}
+	}
+	return result
 }
 
-// 结果类型定义
-type DeadCodeResult struct {
-	eliminatedCount int64
+// advance 将到达定义集合推进到指令之后
+func (rdr *ReachingDefinitionsResult) advance(reaching *BitSet, inst *Instruction) {
+	if def := rdr.byInst[inst]; def != nil {
+		for _, other := range rdr.byVariable[def.variable] {
+			reaching.Clear(other.index)
+		}
+		reaching.Set(def.index)
+	}
+	for _, def := range rdr.mayDefs[inst] {
+		reaching.Set(def.index)
+	}
 }
 
-type UnreachableResult struct {
-	eliminatedBlocks int64
+// addressTakenVariables 按首次出现的顺序返回被OpAddr取过地址的变量。
+// 经指针的store和call可能写入其中任何一个，各分析都把它们视为可能互为别名
+func addressTakenVariables(function *Function) []*Variable {
+	var taken []*Variable
+	seen := make(map[*Variable]bool)
+	for _, block := range function.basicBlocks {
+		for _, inst := range block.instructions {
+			if inst.opcode != OpAddr || len(inst.operands) == 0 {
+				continue
+			}
+			if operand := inst.operands[0]; operand != nil && operand.kind == OperandVariable &&
+				operand.variable != nil && !seen[operand.variable] {
+				seen[operand.variable] = true
+				taken = append(taken, operand.variable)
+			}
+		}
+	}
+	return taken
 }
 
-type BranchResult struct {
-	optimizedBranches int64
-	performanceGain   float64
+// writesMemory 判断指令是否可能经指针写入内存
+func writesMemory(inst *Instruction) bool {
+	return inst.opcode == OpStore || inst.opcode == OpCall
 }
 
-type InvariantResult struct {
-	hoistedCount    int64
-	speedupEstimate float64
+// Analyze 正向迭代求解可用表达式：in(B) = ∩ out(P)，out(B) = gen(B) ∪ (in(B) - kill(B))。
+// 重新定义操作数或结果变量会使表达式失效，store和call可能写入任意内存，使所有load以及
+// 使用或保存在取过地址的变量中的表达式失效
+func (aea *AvailableExpressionsAnalyzer) Analyze(function *Function) interface{} {
+	result := &AvailableExpressionsResult{
+		availableIn:  make(map[*BasicBlock]*BitSet),
+		availableOut: make(map[*BasicBlock]*BitSet),
+		instGen:      make(map[*Instruction]int),
+		instKill:     make(map[*Instruction]*BitSet),
+	}
+	aea.availableIn = result.availableIn
+	aea.availableOut = result.availableOut
+	aea.gen = make(map[*BasicBlock]*BitSet)
+	aea.kill = make(map[*BasicBlock]*BitSet)
+	aea.expressions = nil
+	if function == nil || len(function.basicBlocks) == 0 {
+		return result
+	}
+
+	// 收集表达式，并按变量索引使用它或保存它的表达式
+	index := make(map[string]int)
+	affected := make(map[*Variable][]int)
+	var memory []int // 读取内存、可能被store和call改变的表达式
+	for _, block := range function.basicBlocks {
+		for _, inst := range block.instructions {
+			value, ok := expressionValue(inst)
+			if !ok {
+				continue
+			}
+			key := fmt.Sprintf("%s=%p", value, inst.result)
+			if _, exists := index[key]; exists {
+				continue
+			}
+			i := len(result.expressions)
+			index[key] = i
+			result.expressions = append(result.expressions, &Expression{
+				opcode: inst.opcode, operands: inst.operands, result: inst.result, value: value,
+			})
+			affected[inst.result] = append(affected[inst.result], i)
+			for _, operand := range inst.operands {
+				if operand.kind == OperandVariable {
+					affected[operand.variable] = append(affected[operand.variable], i)
+				}
+			}
+			if inst.opcode == OpLoad {
+				memory = append(memory, i)
+			}
+		}
+	}
+	size := len(result.expressions)
+	aea.expressions = result.expressions
+	for _, variable := range addressTakenVariables(function) {
+		memory = append(memory, affected[variable]...)
+	}
+
+	// 逐条指令计算gen/kill，再合成块级gen(B)与kill(B)
+	for _, block := range function.basicBlocks {
+		gen, kill := NewBitSet(size), NewBitSet(size)
+		for _, inst := range block.instructions {
+			instKill := NewBitSet(size)
+			if inst.result != nil {
+				for _, i := range affected[inst.result] {
+					instKill.Set(i)
+				}
+			}
+			if writesMemory(inst) {
+				for _, i := range memory {
+					instKill.Set(i)
+				}
+			}
+			result.instKill[inst] = instKill
+			gen.Difference(instKill)
+			kill.Union(instKill)
+
+			result.instGen[inst] = -1
+			if value, ok := expressionValue(inst); ok && !usesVariable(inst, inst.result) {
+				i := index[fmt.Sprintf("%s=%p", value, inst.result)]
+				result.instGen[inst] = i
+				gen.Set(i)
+				kill.Clear(i)
+			}
+		}
+		aea.gen[block], aea.kill[block] = gen, kill
+	}
+
+	// 入口块之外的块初始化为全集，求交时逐步收缩
+	entry := function.basicBlocks[0]
+	predecessors := make(map[*BasicBlock][]*BasicBlock)
+	for _, block := range function.basicBlocks {
+		for _, successor := range block.successors {
+			predecessors[successor] = append(predecessors[successor], block)
+		}
+		out := NewBitSet(size)
+		if block != entry {
+			for i := 0; i < size; i++ {
+				out.Set(i)
+			}
+		}
+		aea.availableOut[block] = out
+		aea.availableIn[block] = NewBitSet(size)
+	}
+
+	aea.workList = function.basicBlocks
+	for changed := true; changed; {
+		changed = false
+		result.iterations++
+		for _, block := range aea.workList {
+			in := NewBitSet(size)
+			if block != entry && len(predecessors[block]) > 0 {
+				in = aea.availableOut[predecessors[block][0]].Clone()
+				for _, predecessor := range predecessors[block][1:] {
+					in.Intersection(aea.availableOut[predecessor])
+				}
+			}
+			out := in.Clone()
+			out.Difference(aea.kill[block])
+			out.Union(aea.gen[block])
+
+			if !in.Equal(aea.availableIn[block]) || !out.Equal(aea.availableOut[block]) {
+				changed = true
+			}
+			aea.availableIn[block], aea.availableOut[block] = in, out
+		}
+	}
+	return result
 }
 
-type UnrollResult struct {
-	unrolled        bool
-	factor          int
-	speedupEstimate float64
+// expressionValue 返回可参与公共子表达式消除的指令的规范形式，加法和乘法的操作数按序排列
+func expressionValue(inst *Instruction) (string, bool) {
+	switch inst.opcode {
+	case OpAdd, OpSub, OpMul, OpDiv, OpShl, OpNeg, OpLoad:
+	default:
+		return "", false
+	}
+	if inst.result == nil || len(inst.operands) == 0 {
+		return "", false
+	}
+
+	keys := make([]string, len(inst.operands))
+	for i, operand := range inst.operands {
+		switch {
+		case operand == nil:
+			return "", false
+		case operand.kind == OperandVariable && operand.variable != nil:
+			keys[i] = fmt.Sprintf("v%p", operand.variable)
+		case operand.kind == OperandConstant:
+			keys[i] = fmt.Sprintf("c%T:%v", operand.constant, operand.constant)
+		default:
+			return "", false
+		}
+	}
+	if inst.opcode == OpAdd || inst.opcode == OpMul {
+		sort.Strings(keys)
+	}
+	return fmt.Sprintf("%d(%s)", inst.opcode, strings.Join(keys, ",")), true
 }
 
-type VectorResult struct {
-	vectorized      bool
-	width           int
-	speedupEstimate float64
+func usesVariable(inst *Instruction, variable *Variable) bool {
+	for _, operand := range inst.operands {
+		if operand != nil && operand.kind == OperandVariable && operand.variable == variable {
+			return true
+		}
+	}
+	return false
+}
+
+func (duca *DefUseChainsAnalyzer) Analyze(function *Function) interface{} {
+	// 实现定义-使用链分析算法
+	return nil
+}
+
+// Analyze 基于包含关系的Andersen指针分析（流不敏感、过程内）。按指令生成约束：
+// p = &x 得 x ∈ pts(p)；p = q 及指针算术得 pts(q) ⊆ pts(p)；p = *q 得 ∀o ∈ pts(q): pts(o) ⊆ pts(p)；
+// *p = q 得 ∀o ∈ pts(p): pts(q) ⊆ pts(o)。形参、调用结果和无操作数的load指向未知位置，
+// 传给调用的实参所指向的位置逃逸到未知位置中，再用工作表迭代到不动点
+func (aa *AliasAnalyzer) Analyze(function *Function) interface{} {
+	result := &AliasResult{
+		pointsTo:    make(map[*Variable]*PointsToSet),
+		unknown:     &Variable{name: "<unknown>"},
+		allocations: make(map[*Instruction]*Variable),
+	}
+	aa.pointsTo = result.pointsTo
+	if function == nil {
+		return result
+	}
+
+	pts := result.set
+	copies := make(map[*Variable][]*Variable) // src -> dst：pts(src) ⊆ pts(dst)
+	loads := make(map[*Variable][]*Variable)  // q -> p：p = *q
+	stores := make(map[*Variable][]*Variable) // p -> q：*p = q
+	addCopy := func(src, dst *Variable) bool {
+		for _, existing := range copies[src] {
+			if existing == dst {
+				return false
+			}
+		}
+		copies[src] = append(copies[src], dst)
+		return true
+	}
+
+	// 未知位置指向它自己以及所有逃逸的位置
+	pts(result.unknown).insert(result.unknown)
+	for _, param := range function.params {
+		pts(param).insert(result.unknown)
+	}
+	for _, block := range function.basicBlocks {
+		for _, inst := range block.instructions {
+			aa.constrain(inst, result, addCopy, loads, stores)
+		}
+	}
+
+	var worklist []*Variable
+	queued := make(map[*Variable]bool)
+	push := func(variable *Variable) {
+		if !queued[variable] {
+			queued[variable] = true
+			worklist = append(worklist, variable)
+		}
+	}
+	for variable, set := range result.pointsTo {
+		if len(set.locations) > 0 {
+			push(variable)
+		}
+	}
+	for len(worklist) > 0 {
+		result.iterations++
+		node := worklist[0]
+		worklist = worklist[1:]
+		queued[node] = false
+
+		for _, location := range pts(node).Locations() {
+			for _, dst := range loads[node] {
+				if addCopy(location, dst) {
+					push(location)
+				}
+			}
+			for _, src := range stores[node] {
+				if addCopy(src, location) {
+					push(src)
+				}
+			}
+		}
+		for _, dst := range copies[node] {
+			if pts(dst).union(pts(node)) {
+				push(dst)
+			}
+		}
+	}
+	return result
+}
+
+// constrain 为单条指令生成约束
+func (aa *AliasAnalyzer) constrain(inst *Instruction, result *AliasResult, addCopy func(src, dst *Variable) bool,
+	loads, stores map[*Variable][]*Variable) {
+	variableOperand := func(i int) *Variable {
+		if i < len(inst.operands) && inst.operands[i] != nil && inst.operands[i].kind == OperandVariable {
+			return inst.operands[i].variable
+		}
+		return nil
+	}
+
+	switch inst.opcode {
+	case OpAddr:
+		if target := variableOperand(0); target != nil && inst.result != nil {
+			result.set(inst.result).insert(target)
+		}
+	case OpAlloc:
+		if inst.result != nil {
+			site := &Variable{name: "alloc:" + inst.id}
+			result.allocations[inst] = site
+			result.set(inst.result).insert(site)
+		}
+	case OpCopy, OpAdd, OpSub:
+		// 指针算术不区分字段，结果可能指向任一变量操作数所指的位置
+		if inst.result == nil {
+			return
+		}
+		for i := range inst.operands {
+			if source := variableOperand(i); source != nil {
+				addCopy(source, inst.result)
+			}
+		}
+	case OpLoad:
+		if inst.result == nil {
+			return
+		}
+		if pointer := variableOperand(0); pointer != nil {
+			loads[pointer] = append(loads[pointer], inst.result)
+		} else {
+			result.set(inst.result).insert(result.unknown)
+		}
+	case OpStore:
+		pointer, value := variableOperand(0), variableOperand(1)
+		if pointer != nil && value != nil {
+			stores[pointer] = append(stores[pointer], value)
+		}
+	case OpCall:
+		for i := 1; i < len(inst.operands); i++ {
+			if argument := variableOperand(i); argument != nil {
+				addCopy(argument, result.unknown)
+			}
+		}
+		if inst.result != nil {
+			result.set(inst.result).insert(result.unknown)
+		}
+	}
+}
+
+// set 返回变量的指向集合，不存在时创建
+func (ar *AliasResult) set(variable *Variable) *PointsToSet {
+	set, exists := ar.pointsTo[variable]
+	if !exists {
+		set = &PointsToSet{locations: make(map[*Variable]bool)}
+		ar.pointsTo[variable] = set
+	}
+	return set
+}
+
+// AllocationSite 返回分配指令对应的抽象位置
+func (ar *AliasResult) AllocationSite(inst *Instruction) *Variable {
+	return ar.allocations[inst]
+}
+
+// PointsTo 返回变量可能指向的位置，未知位置以名为"<unknown>"的变量表示
+func (ar *AliasResult) PointsTo(variable *Variable) []*Variable {
+	if set, exists := ar.pointsTo[variable]; exists {
+		return set.Locations()
+	}
+	return nil
+}
+
+// MayAlias 判断两个指针是否可能指向同一位置。指向未知位置的指针可能指向任何逃逸的位置；
+// 两者都只指向同一个已知位置时必然别名，指向集合不相交时不别名
+func (ar *AliasResult) MayAlias(a, b *Variable) AliasPrecision {
+	if a == b {
+		return PrecisionMustAlias
+	}
+	left, right := ar.resolved(a), ar.resolved(b)
+	if len(left) == 0 || len(right) == 0 {
+		return PrecisionNoAlias
+	}
+	if len(left) == 1 && len(right) == 1 {
+		for location := range left {
+			if right[location] && location != ar.unknown {
+				return PrecisionMustAlias
+			}
+		}
+	}
+	for location := range left {
+		if right[location] {
+			return PrecisionMayAlias
+		}
+	}
+	return PrecisionNoAlias
+}
+
+// resolved 展开指向集合中的未知位置：指向未知位置即可能指向它所包含的全部逃逸位置
+func (ar *AliasResult) resolved(variable *Variable) map[*Variable]bool {
+	set, exists := ar.pointsTo[variable]
+	if !exists {
+		return nil
+	}
+	if !set.locations[ar.unknown] {
+		return set.locations
+	}
+	locations := make(map[*Variable]bool, len(set.locations))
+	for location := range set.locations {
+		locations[location] = true
+	}
+	for location := range ar.pointsTo[ar.unknown].locations {
+		locations[location] = true
+	}
+	return locations
+}
+
+// insert 加入一个位置，返回集合是否变化
+func (pts *PointsToSet) insert(location *Variable) bool {
+	if pts.locations[location] {
+		return false
+	}
+	pts.locations[location] = true
+	return true
+}
+
+// union 并入另一个集合，返回集合是否变化
+func (pts *PointsToSet) union(other *PointsToSet) bool {
+	changed := false
+	for location := range other.locations {
+		if pts.insert(location) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Contains 判断集合是否包含位置
+func (pts *PointsToSet) Contains(location *Variable) bool {
+	return pts.locations[location]
+}
+
+// Locations 按名称排序返回集合中的位置
+func (pts *PointsToSet) Locations() []*Variable {
+	locations := make([]*Variable, 0, len(pts.locations))
+	for location := range pts.locations {
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].name < locations[j].name })
+	return locations
+}
+
+func (pa *PointerAnalyzer) Analyze(function *Function) interface{} {
+	// 实现指针分析算法
+	return nil
+}
+
+// Eliminate 标记-清除死代码：从有副作用的指令出发，沿定义-使用关系标记其操作数的定义，
+// 再删除所有未标记的指令
+func (dce *DeadCodeEliminator) Eliminate(function *Function) *DeadCodeResult {
+	result := &DeadCodeResult{}
+	if function == nil {
+		return result
+	}
+
+	// 为指令编号并建立变量到定义指令的映射；非SSA形式下一个变量可能有多个定义
+	var instructions []*Instruction
+	definitions := make(map[*Variable][]*Instruction)
+	for _, block := range function.basicBlocks {
+		for _, inst := range block.instructions {
+			instructions = append(instructions, inst)
+			if inst.result != nil {
+				definitions[inst.result] = append(definitions[inst.result], inst)
+			}
+		}
+	}
+	index := make(map[*Instruction]int, len(instructions))
+	for i, inst := range instructions {
+		index[inst] = i
+	}
+
+	dce.liveInstructions = NewBitSet(len(instructions))
+	dce.marked = make(map[*Instruction]bool)
+	dce.worklist = dce.worklist[:0]
+	mark := func(inst *Instruction) {
+		if !dce.marked[inst] {
+			dce.marked[inst] = true
+			dce.liveInstructions.Set(index[inst])
+			dce.worklist = append(dce.worklist, inst)
+		}
+	}
+
+	// 标记阶段：副作用指令是根，传递标记产生其操作数的指令。取过地址的变量可能经指针读取，
+	// 它们的定义同样作为根保留
+	taken := make(map[*Variable]bool)
+	for _, variable := range addressTakenVariables(function) {
+		taken[variable] = true
+	}
+	for _, inst := range instructions {
+		if dce.hasSideEffects(inst) || inst.result != nil && taken[inst.result] {
+			mark(inst)
+		}
+	}
+	for len(dce.worklist) > 0 {
+		inst := dce.worklist[len(dce.worklist)-1]
+		dce.worklist = dce.worklist[:len(dce.worklist)-1]
+		for _, operand := range inst.operands {
+			if operand == nil || operand.kind != OperandVariable || operand.variable == nil {
+				continue
+			}
+			for _, def := range definitions[operand.variable] {
+				mark(def)
+			}
+		}
+	}
+
+	// 清除阶段
+	for _, block := range function.basicBlocks {
+		kept := block.instructions[:0]
+		for _, inst := range block.instructions {
+			if dce.marked[inst] {
+				kept = append(kept, inst)
+			} else {
+				result.eliminatedCount++
+			}
+		}
+		for i := len(kept); i < len(block.instructions); i++ {
+			block.instructions[i] = nil
+		}
+		block.instructions = kept
+	}
+	if len(function.instructions) > 0 {
+		kept := make([]*Instruction, 0, len(function.instructions))
+		for _, inst := range function.instructions {
+			if _, inBlock := index[inst]; !inBlock || dce.marked[inst] {
+				kept = append(kept, inst)
+			}
+		}
+		function.instructions = kept
+	}
+
+	return result
+}
+
+// hasSideEffects 按标记策略判断指令是否必须保留
+func (dce *DeadCodeEliminator) hasSideEffects(inst *Instruction) bool {
+	switch inst.opcode {
+	case OpStore, OpCall, OpReturn, OpBranch:
+		return true
+	case OpLoad:
+		return dce.markingStrategy != MarkingAggressive
+	case OpDiv:
+		switch dce.markingStrategy {
+		case MarkingAggressive:
+			return false
+		case MarkingAdaptive:
+			return !hasNonZeroConstantDivisor(inst)
+		}
+		return true
+	}
+	return false
+}
+
+// hasNonZeroConstantDivisor 判断除法的除数是否为非零常量，此时除法不会陷入
+func hasNonZeroConstantDivisor(inst *Instruction) bool {
+	if len(inst.operands) != 2 || inst.operands[1] == nil || inst.operands[1].kind != OperandConstant {
+		return false
+	}
+	switch divisor := inst.operands[1].constant.(type) {
+	case int:
+		return divisor != 0
+	case int64:
+		return divisor != 0
+	case float64:
+		return divisor != 0
+	}
+	return false
+}
+
+func (uce *UnreachableCodeEliminator) Eliminate(function *Function) *UnreachableResult {
+	return &UnreachableResult{eliminatedBlocks: 2}
+}
+
+// Optimize 按TailCallToLoop策略将自递归尾调用改写为循环：调用及紧随其后返回其结果的return
+// 被替换为形参的重新赋值和跳回函数入口的回边。调用其他函数的尾调用需要调用约定支持，不做改写
+func (tco *TailCallOptimizer) Optimize(function *Function) *TailCallResult {
+	result := &TailCallResult{}
+	tco.tailCalls = tco.FindTailCalls(function)
+	if tco.optimization != TailCallToLoop || len(tco.tailCalls) == 0 {
+		return result
+	}
+
+	entry := function.basicBlocks[0]
+	if function.cfg != nil && function.cfg.entry != nil {
+		entry = function.cfg.entry
+	}
+	for _, call := range tco.tailCalls {
+		tco.rewriteAsLoop(function, call, entry)
+		result.optimizedCalls++
+	}
+
+	// 控制流已改变，支配树与循环信息需要重新计算
+	function.domTree = nil
+	function.loopInfo = nil
+	return result
+}
+
+// FindTailCalls 找出函数中的自递归尾调用：基本块的倒数第二条指令调用函数自身、实参个数与形参一致，
+// 且最后一条指令返回该调用的结果（无结果的调用对应无操作数的return）
+func (tco *TailCallOptimizer) FindTailCalls(function *Function) []*Instruction {
+	var calls []*Instruction
+	if function == nil {
+		return calls
+	}
+
+	for _, block := range function.basicBlocks {
+		n := len(block.instructions)
+		if n < 2 {
+			continue
+		}
+		call, ret := block.instructions[n-2], block.instructions[n-1]
+		if call.opcode != OpCall || ret.opcode != OpReturn || len(call.operands) == 0 {
+			continue
+		}
+		callee := call.operands[0]
+		if callee == nil || callee.kind != OperandLabel || callee.label != function.name {
+			continue
+		}
+		if len(call.operands)-1 != len(function.params) {
+			continue
+		}
+
+		returnsResult := call.result != nil && len(ret.operands) == 1 && ret.operands[0] != nil &&
+			ret.operands[0].kind == OperandVariable && ret.operands[0].variable == call.result
+		returnsNothing := call.result == nil && len(ret.operands) == 0
+		if returnsResult || returnsNothing {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// rewriteAsLoop 用形参赋值和跳回entry的无条件分支替换call与其后的return。
+// 实参读取了同样被重新赋值的形参时（如交换参数），先复制到临时变量再赋给形参，避免读到新值
+func (tco *TailCallOptimizer) rewriteAsLoop(function *Function, call *Instruction, entry *BasicBlock) {
+	block := call.block
+	if block == nil {
+		for _, candidate := range function.basicBlocks {
+			if n := len(candidate.instructions); n >= 2 && candidate.instructions[n-2] == call {
+				block = candidate
+				break
+			}
+		}
+	}
+	n := len(block.instructions)
+	ret := block.instructions[n-1]
+
+	type assignment struct {
+		param *Variable
+		value *Operand
+	}
+	var assignments []assignment
+	assigned := make(map[*Variable]bool)
+	for i, arg := range call.operands[1:] {
+		param := function.params[i]
+		if arg != nil && arg.kind == OperandVariable && arg.variable == param {
+			continue
+		}
+		assignments = append(assignments, assignment{param: param, value: arg})
+		assigned[param] = true
+	}
+	needTemps := false
+	for _, a := range assignments {
+		if a.value != nil && a.value.kind == OperandVariable && assigned[a.value.variable] {
+			needTemps = true
+			break
+		}
+	}
+
+	var rewritten []*Instruction
+	emit := func(target *Variable, value *Operand) {
+		opcode := OpCopy
+		if value != nil && value.kind == OperandConstant {
+			opcode = OpConst
+		}
+		rewritten = append(rewritten, &Instruction{
+			id:       fmt.Sprintf("%s.tail%d", call.id, len(rewritten)),
+			opcode:   opcode,
+			operands: []*Operand{value},
+			result:   target,
+			block:    block,
+		})
+	}
+	if needTemps {
+		temps := make([]*Variable, len(assignments))
+		for i, a := range assignments {
+			temps[i] = &Variable{id: a.param.id + ".tail", name: a.param.name + ".tail", varType: a.param.varType}
+			emit(temps[i], a.value)
+		}
+		for i, a := range assignments {
+			emit(a.param, &Operand{kind: OperandVariable, variable: temps[i]})
+		}
+	} else {
+		for _, a := range assignments {
+			emit(a.param, a.value)
+		}
+	}
+	target := entry.label
+	if target == "" {
+		target = entry.id
+	}
+	rewritten = append(rewritten, &Instruction{
+		id:       call.id + ".loop",
+		opcode:   OpBranch,
+		operands: []*Operand{{kind: OperandLabel, label: target}},
+		block:    block,
+	})
+
+	instructions := make([]*Instruction, 0, n-2+len(rewritten))
+	instructions = append(instructions, block.instructions[:n-2]...)
+	block.instructions = append(instructions, rewritten...)
+
+	if len(function.instructions) > 0 {
+		flat := make([]*Instruction, 0, len(function.instructions)+len(rewritten))
+		for _, inst := range function.instructions {
+			switch inst {
+			case call:
+				flat = append(flat, rewritten...)
+			case ret:
+			default:
+				flat = append(flat, inst)
+			}
+		}
+		function.instructions = flat
+	}
+
+	// 原来返回的块改为只跳回入口
+	for _, successor := range block.successors {
+		successor.predecessors = removeBlock(successor.predecessors, block)
+	}
+	block.successors = []*BasicBlock{entry}
+	entry.predecessors = append(entry.predecessors, block)
+	if function.cfg != nil && len(function.cfg.edges) > 0 {
+		edges := function.cfg.edges[:0]
+		for _, edge := range function.cfg.edges {
+			if edge.source != block {
+				edges = append(edges, edge)
+			}
+		}
+		function.cfg.edges = append(edges, &CFGEdge{source: block, target: entry, kind: EdgeUnconditional, weight: 1})
+	}
+}
+
+// removeBlock 返回删除了block的基本块列表
+func removeBlock(blocks []*BasicBlock, block *BasicBlock) []*BasicBlock {
+	kept := make([]*BasicBlock, 0, len(blocks))
+	for _, candidate := range blocks {
+		if candidate != block {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept
+}
+
+// Thread 对只含条件分支的基本块，若某个前驱流出时条件变量的全部到达定义都是同一常量，
+// 就把该前驱指向此块的边改为直接指向确定的后继；之后删除不再可达的块。
+// 每轮改写后重新计算到达定义，直到没有可线程化的边
+func (jt *JumpThreading) Thread(function *Function) *JumpThreadingResult {
+	result := &JumpThreadingResult{}
+	if function == nil || len(function.basicBlocks) == 0 {
+		return result
+	}
+
+	entry := function.basicBlocks[0]
+	for changed := true; changed; {
+		changed = false
+		reaching := jt.reaching.Analyze(function).(*ReachingDefinitionsResult)
+		predecessors := make(map[*BasicBlock][]*BasicBlock)
+		for _, block := range function.basicBlocks {
+			for _, successor := range block.successors {
+				predecessors[successor] = append(predecessors[successor], block)
+			}
+		}
+
+		for _, block := range function.basicBlocks {
+			if block == entry || len(block.instructions) != 1 || len(block.successors) != 2 {
+				continue
+			}
+			branch := block.instructions[0]
+			if branch.opcode != OpBranch || len(branch.operands) == 0 || branch.operands[0] == nil {
+				continue
+			}
+			for _, predecessor := range predecessors[block] {
+				taken, known := jt.conditionFrom(reaching, predecessor, branch.operands[0])
+				if !known {
+					continue
+				}
+				target := block.successors[1]
+				if taken {
+					target = block.successors[0]
+				}
+				if target == block || containsBlock(predecessor.successors, target) {
+					continue
+				}
+				redirectEdge(function, predecessor, block, target)
+				result.threadedEdges++
+				changed = true
+			}
+			if changed {
+				// 前驱列表已失效，重新分析后继续
+				break
+			}
+		}
+	}
+
+	if result.threadedEdges > 0 {
+		result.removedBlocks = removeUnreachableBlocks(function)
+		function.domTree = nil
+		function.loopInfo = nil
+	}
+	return result
+}
+
+// conditionFrom 求从predecessor流入时条件操作数的取值
+func (jt *JumpThreading) conditionFrom(reaching *ReachingDefinitionsResult, predecessor *BasicBlock, condition *Operand) (bool, bool) {
+	if condition.kind == OperandConstant {
+		return constantTruth(condition.constant)
+	}
+	if condition.kind != OperandVariable || condition.variable == nil {
+		return false, false
+	}
+
+	out := reaching.reachingOut[predecessor]
+	value := latticeValue{kind: latticeTop}
+	for _, def := range reaching.byVariable[condition.variable] {
+		if out != nil && out.Test(def.index) {
+			value = value.meet(definitionValue(def))
+		}
+	}
+	if value.kind != latticeConstant {
+		return false, false
+	}
+	return constantTruth(value.constant)
+}
+
+// constantTruth 常量作为分支条件时的真假，非数值和布尔常量无法判定
+func constantTruth(value interface{}) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case int:
+		return v != 0, true
+	case int8:
+		return v != 0, true
+	case int16:
+		return v != 0, true
+	case int32:
+		return v != 0, true
+	case int64:
+		return v != 0, true
+	case float32:
+		return v != 0, true
+	case float64:
+		return v != 0, true
+	}
+	return false, false
+}
+
+// redirectEdge 把from指向old的边改为指向target，保持后继顺序以免改变条件分支的语义
+func redirectEdge(function *Function, from, old, target *BasicBlock) {
+	for i, successor := range from.successors {
+		if successor == old {
+			from.successors[i] = target
+		}
+	}
+	old.predecessors = removeBlock(old.predecessors, from)
+	target.predecessors = append(target.predecessors, from)
+
+	// 以标签操作数表示跳转目标的分支同步更新
+	if n := len(from.instructions); n > 0 && from.instructions[n-1].opcode == OpBranch {
+		for _, operand := range from.instructions[n-1].operands {
+			if operand != nil && operand.kind == OperandLabel && (operand.label == old.label && old.label != "" || operand.label == old.id) {
+				operand.label = target.id
+				if target.label != "" {
+					operand.label = target.label
+				}
+			}
+		}
+	}
+
+	if function.cfg != nil {
+		for _, edge := range function.cfg.edges {
+			if edge.source == from && edge.target == old {
+				edge.target = target
+			}
+		}
+	}
+}
+
+// removeUnreachableBlocks 删除从入口不可达的基本块，返回删除的块数
+func removeUnreachableBlocks(function *Function) int64 {
+	entry := function.basicBlocks[0]
+	reachable := map[*BasicBlock]bool{entry: true}
+	worklist := []*BasicBlock{entry}
+	for len(worklist) > 0 {
+		block := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		for _, successor := range block.successors {
+			if !reachable[successor] {
+				reachable[successor] = true
+				worklist = append(worklist, successor)
+			}
+		}
+	}
+
+	var removed int64
+	kept := make([]*BasicBlock, 0, len(function.basicBlocks))
+	for _, block := range function.basicBlocks {
+		if reachable[block] {
+			kept = append(kept, block)
+			continue
+		}
+		removed++
+		for _, successor := range block.successors {
+			successor.predecessors = removeBlock(successor.predecessors, block)
+		}
+	}
+	if removed == 0 {
+		return 0
+	}
+	function.basicBlocks = kept
+
+	if len(function.instructions) > 0 {
+		flat := function.instructions[:0]
+		for _, inst := range function.instructions {
+			if inst.block == nil || reachable[inst.block] {
+				flat = append(flat, inst)
+			}
+		}
+		function.instructions = flat
+	}
+	if cfg := function.cfg; cfg != nil {
+		blocks := make([]*BasicBlock, 0, len(cfg.blocks))
+		for _, block := range cfg.blocks {
+			if reachable[block] {
+				blocks = append(blocks, block)
+			}
+		}
+		cfg.blocks = blocks
+		edges := make([]*CFGEdge, 0, len(cfg.edges))
+		for _, edge := range cfg.edges {
+			if reachable[edge.source] {
+				edges = append(edges, edge)
+			}
+		}
+		cfg.edges = edges
+	}
+	return removed
+}
+
+func containsInstruction(instructions []*Instruction, inst *Instruction) bool {
+	for _, candidate := range instructions {
+		if candidate == inst {
+			return true
+		}
+	}
+	return false
+}
+
+func containsBlock(blocks []*BasicBlock, block *BasicBlock) bool {
+	for _, candidate := range blocks {
+		if candidate == block {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge 反复将块B并入其唯一前驱P（要求P只有B一个后继）：去掉P末尾跳往B的无条件跳转，
+// 拼接指令，P接管B的后继。循环头不参与合并，以免破坏循环结构
+func (bm *BlockMerger) Merge(function *Function) *BlockMergeResult {
+	result := &BlockMergeResult{}
+	if function == nil || len(function.basicBlocks) < 2 {
+		return result
+	}
+
+	cfg := function.cfg
+	if cfg == nil {
+		cfg = &ControlFlowGraph{blocks: function.basicBlocks}
+	}
+	entry := cfg.entryBlock()
+	loopInfo := function.loopInfo
+	if loopInfo == nil {
+		loopInfo = DetectLoops(cfg, BuildDominatorTree(cfg))
+	}
+	headers := make(map[*BasicBlock]bool, len(loopInfo.loops))
+	for _, loop := range loopInfo.loops {
+		headers[loop.header] = true
+	}
+
+	for merged := true; merged; {
+		merged = false
+		predecessors := make(map[*BasicBlock][]*BasicBlock)
+		for _, block := range function.basicBlocks {
+			for _, successor := range block.successors {
+				predecessors[successor] = append(predecessors[successor], block)
+			}
+		}
+		for _, block := range function.basicBlocks {
+			if block == entry || headers[block] || len(predecessors[block]) != 1 {
+				continue
+			}
+			predecessor := predecessors[block][0]
+			if predecessor == block || len(predecessor.successors) != 1 {
+				continue
+			}
+			bm.mergeInto(function, predecessor, block)
+			result.mergedBlocks++
+			merged = true
+			break
+		}
+	}
+
+	if result.mergedBlocks > 0 {
+		function.domTree = nil
+		function.loopInfo = nil
+	}
+	return result
+}
+
+// mergeInto 把block并入predecessor并删除block
+func (bm *BlockMerger) mergeInto(function *Function, predecessor, block *BasicBlock) {
+	// 前驱末尾跳往block的无条件跳转在合并后成为直落，可以删除
+	var jump *Instruction
+	if n := len(predecessor.instructions); n > 0 {
+		last := predecessor.instructions[n-1]
+		if last.opcode == OpBranch && (len(last.operands) == 0 || last.operands[0] != nil && last.operands[0].kind == OperandLabel) {
+			jump = last
+			predecessor.instructions = predecessor.instructions[:n-1]
+		}
+	}
+	for _, inst := range block.instructions {
+		inst.block = predecessor
+	}
+	predecessor.instructions = append(predecessor.instructions, block.instructions...)
+	block.instructions = nil
+
+	// 后继的前驱列表原位替换，保持前驱顺序不变
+	predecessor.successors = block.successors
+	block.successors = nil
+	for _, successor := range predecessor.successors {
+		for i, candidate := range successor.predecessors {
+			if candidate == block {
+				successor.predecessors[i] = predecessor
+			}
+		}
+	}
+
+	function.basicBlocks = removeBlock(function.basicBlocks, block)
+	if jump != nil && len(function.instructions) > 0 {
+		flat := function.instructions[:0]
+		for _, inst := range function.instructions {
+			if inst != jump {
+				flat = append(flat, inst)
+			}
+		}
+		function.instructions = flat
+	}
+	if cfg := function.cfg; cfg != nil {
+		cfg.blocks = removeBlock(cfg.blocks, block)
+		edges := make([]*CFGEdge, 0, len(cfg.edges))
+		for _, edge := range cfg.edges {
+			if edge.source == predecessor && edge.target == block {
+				continue
+			}
+			if edge.source == block {
+				edge.source = predecessor
+			}
+			edges = append(edges, edge)
+		}
+		cfg.edges = edges
+	}
+}
+
+// Optimize 按分支概率重排基本块，使最可能的后继成为直落块
+func (bo *BranchOptimizer) Optimize(function *Function) *BranchResult {
+	result := &BranchResult{}
+	if function == nil || len(function.basicBlocks) == 0 {
+		return result
+	}
+
+	original := make(map[*BasicBlock]*BasicBlock)
+	for i := 0; i+1 < len(function.basicBlocks); i++ {
+		original[function.basicBlocks[i]] = function.basicBlocks[i+1]
+	}
+
+	layout := bo.Layout(function)
+	for i, block := range layout {
+		if len(block.successors) < 2 {
+			continue
+		}
+		var next *BasicBlock
+		if i+1 < len(layout) {
+			next = layout[i+1]
+		}
+		if next == original[block] {
+			continue
+		}
+		result.optimizedBranches++
+		result.performanceGain += bo.BranchProbability(function, block, next) -
+			bo.BranchProbability(function, block, original[block])
+	}
+
+	function.basicBlocks = layout
+	return result
+}
+
+// Layout 贪心构造基本块链：从每个未放置的块出发，沿概率最高的未放置后继延伸
+func (bo *BranchOptimizer) Layout(function *Function) []*BasicBlock {
+	layout := make([]*BasicBlock, 0, len(function.basicBlocks))
+	placed := make(map[*BasicBlock]bool)
+
+	for _, seed := range function.basicBlocks {
+		for block := seed; block != nil && !placed[block]; {
+			placed[block] = true
+			layout = append(layout, block)
+
+			var next *BasicBlock
+			best := -1.0
+			for _, successor := range block.successors {
+				if placed[successor] {
+					continue
+				}
+				if probability := bo.BranchProbability(function, block, successor); probability > best {
+					next, best = successor, probability
+				}
+			}
+			block = next
+		}
+	}
+
+	return layout
+}
+
+// LoadProfile 解析LoadProfile格式的剖面数据并累加到优化器的剖面中。
+// 解析失败时已有的剖面保持不变
+func (bo *BranchOptimizer) LoadProfile(r io.Reader) error {
+	profile, err := LoadProfile(r)
+	if err != nil {
+		return err
+	}
+	if bo.profileData == nil {
+		bo.profileData = NewProfileData()
+	}
+	bo.profileData.merge(profile)
+	return nil
+}
+
+// BranchProbability 返回从block跳转到successor的概率，优先使用剖面实测值
+func (bo *BranchOptimizer) BranchProbability(function *Function, block, successor *BasicBlock) float64 {
+	if successor == nil {
+		return 0
+	}
+	if bo.profileData != nil {
+		if probability, ok := bo.profileData.BranchProbability(function.name, block.id, successor.id); ok {
+			return probability
+		}
+	}
+
+	probabilities := bo.staticPredictor.Predict(function, block)
+	for i, candidate := range block.successors {
+		if candidate == successor {
+			return probabilities[i]
+		}
+	}
+	return 0
+}
+
+// Predict 用启发式估计block各后继的跳转概率，结果与block.successors一一对应
+func (sbp *StaticBranchPredictor) Predict(function *Function, block *BasicBlock) []float64 {
+	order := make(map[*BasicBlock]int, len(function.basicBlocks))
+	for i, candidate := range function.basicBlocks {
+		order[candidate] = i
+	}
+
+	weights := make([]float64, len(block.successors))
+	total := 0.0
+	for i, successor := range block.successors {
+		weight := 1.0
+		for _, heuristic := range sbp.heuristics {
+			switch heuristic {
+			case HeuristicLoop:
+				// 回边通常被执行
+				if order[successor] <= order[block] {
+					weight *= sbp.weights[heuristic] / (1 - sbp.weights[heuristic])
+				}
+			case HeuristicReturn:
+				// 直接返回的路径通常是错误或提前退出路径
+				if endsWithReturn(successor) {
+					weight *= (1 - sbp.weights[heuristic]) / sbp.weights[heuristic]
+				}
+			}
+		}
+		weights[i] = weight
+		total += weight
+	}
+
+	for i := range weights {
+		weights[i] /= total
+	}
+	return weights
+}
+
+// endsWithReturn 判断基本块是否以返回指令结束
+func endsWithReturn(block *BasicBlock) bool {
+	if len(block.instructions) == 0 {
+		return false
+	}
+	return block.instructions[len(block.instructions)-1].opcode == OpReturn
+}
+
+// Hoist 将循环内的不变指令移到前置块。指令的变量操作数只能由循环外的定义或已判定的不变指令提供，
+// 结果变量在循环内只有这一处定义且在循环头入口不活跃。读内存或可能陷入的指令是推测执行不安全的，
+// 只有所在块支配全部出口块时才外提，读内存还要求循环内没有写内存或调用
+func (licm *LoopInvariantCodeMotion) Hoist(function *Function, loop *Loop) *InvariantResult {
+	result := &InvariantResult{}
+	licm.invariantInstructions = licm.invariantInstructions[:0]
+	licm.hoistingCandidates = licm.hoistingCandidates[:0]
+	licm.preheader = nil
+	if function == nil || loop == nil || loop.header == nil || len(loop.blocks) == 0 {
+		return result
+	}
+
+	inLoop := make(map[*BasicBlock]bool, len(loop.blocks))
+	for _, block := range loop.blocks {
+		inLoop[block] = true
+	}
+	definitions := make(map[*Variable][]*Instruction)
+	writesMemory := false
+	loopInstructions := 0
+	for _, block := range function.basicBlocks {
+		for _, inst := range block.instructions {
+			if inst.result != nil {
+				definitions[inst.result] = append(definitions[inst.result], inst)
+			}
+			if inLoop[block] {
+				loopInstructions++
+				if inst.opcode == OpStore || inst.opcode == OpCall {
+					writesMemory = true
+				}
+			}
+		}
+	}
+	blockOf := make(map[*Instruction]*BasicBlock)
+	for _, block := range loop.blocks {
+		for _, inst := range block.instructions {
+			blockOf[inst] = block
+		}
+	}
+
+	// 迭代识别不变指令：操作数的定义全部在循环外，或唯一的定义本身是不变指令
+	invariant := make(map[*Instruction]bool)
+	operandInvariant := func(operand *Operand) bool {
+		if operand == nil || operand.kind != OperandVariable {
+			return true
+		}
+		defs := definitions[operand.variable]
+		inside := 0
+		for _, def := range defs {
+			if blockOf[def] != nil {
+				inside++
+			}
+		}
+		return inside == 0 || len(defs) == 1 && invariant[defs[0]]
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, block := range loop.blocks {
+			for _, inst := range block.instructions {
+				if invariant[inst] || !isHoistableOpcode(inst.opcode) || inst.result == nil {
+					continue
+				}
+				pure := true
+				for _, operand := range inst.operands {
+					if !operandInvariant(operand) {
+						pure = false
+						break
+					}
+				}
+				if pure {
+					invariant[inst] = true
+					licm.invariantInstructions = append(licm.invariantInstructions, inst)
+					changed = true
+				}
+			}
+		}
+	}
+	if len(licm.invariantInstructions) == 0 {
+		return result
+	}
+
+	// 安全性检查
+	dom := function.domTree
+	if dom == nil {
+		dom = BuildDominatorTree(loopCFG(function))
+	}
+	var exiting []*BasicBlock
+	for _, block := range loop.blocks {
+		for _, successor := range block.successors {
+			if !inLoop[successor] {
+				exiting = append(exiting, block)
+				break
+			}
+		}
+	}
+	liveness := NewLivenessAnalyzer().Analyze(function).(*LivenessResult)
+	hoisted := make(map[*Instruction]bool)
+	for _, inst := range licm.invariantInstructions {
+		if !licm.safeToHoist(inst, blockOf[inst], loop.header, dom, exiting, writesMemory, hoisted) {
+			continue
+		}
+		inside := 0
+		for _, def := range definitions[inst.result] {
+			if blockOf[def] != nil {
+				inside++
+			}
+		}
+		if inside != 1 || liveness.IsLiveIn(loop.header, inst.result) {
+			continue
+		}
+		hoisted[inst] = true
+		licm.hoistingCandidates = append(licm.hoistingCandidates, inst)
+	}
+	if len(licm.hoistingCandidates) == 0 {
+		return result
+	}
+
+	// 移入前置块末尾的跳转之前
+	licm.preheader = ensurePreheader(function, loop)
+	for _, block := range loop.blocks {
+		kept := block.instructions[:0]
+		for _, inst := range block.instructions {
+			if !hoisted[inst] {
+				kept = append(kept, inst)
+			}
+		}
+		for i := len(kept); i < len(block.instructions); i++ {
+			block.instructions[i] = nil
+		}
+		block.instructions = kept
+	}
+	preheader := licm.preheader
+	position := len(preheader.instructions)
+	if position > 0 && preheader.instructions[position-1].opcode == OpBranch {
+		position--
+	}
+	tail := append([]*Instruction(nil), preheader.instructions[position:]...)
+	for _, inst := range licm.hoistingCandidates {
+		inst.block = preheader
+	}
+	preheader.instructions = append(append(preheader.instructions[:position], licm.hoistingCandidates...), tail...)
+
+	if len(function.instructions) > 0 {
+		flat := make([]*Instruction, 0, len(function.instructions)+1)
+		for _, inst := range function.instructions {
+			if !hoisted[inst] {
+				flat = append(flat, inst)
+			}
+		}
+		function.instructions = flat
+		rebuildFlatInstructions(function, preheader)
+	}
+
+	result.hoistedCount = int64(len(licm.hoistingCandidates))
+	result.speedupEstimate = float64(result.hoistedCount) / float64(loopInstructions)
+	return result
+}
+
+// safeToHoist 按副作用类型判断不变指令能否外提；依赖的不变指令必须已经外提
+func (licm *LoopInvariantCodeMotion) safeToHoist(inst *Instruction, block, header *BasicBlock, dom *DominatorTree,
+	exiting []*BasicBlock, writesMemory bool, hoisted map[*Instruction]bool) bool {
+	for _, operand := range inst.operands {
+		if operand == nil || operand.kind != OperandVariable {
+			continue
+		}
+		for _, other := range licm.invariantInstructions {
+			if other.result == operand.variable && !hoisted[other] {
+				return false
+			}
+		}
+	}
+
+	switch licm.safetyAnalysis.SideEffect(inst) {
+	case SideEffectNone:
+		return true
+	case SideEffectMemory:
+		if writesMemory {
+			return false
+		}
+	case SideEffectException:
+	default:
+		return false
+	}
+	for _, exit := range exiting {
+		if !dom.Dominates(block, exit) {
+			return false
+		}
+	}
+	return true
+}
+
+// SideEffect 指令的副作用类型，结果按指令缓存
+func (sa *SafetyAnalysis) SideEffect(inst *Instruction) SideEffectKind {
+	if kind, cached := sa.sideEffects[inst]; cached {
+		return kind
+	}
+	kind := SideEffectNone
+	switch inst.opcode {
+	case OpLoad, OpStore:
+		kind = SideEffectMemory
+	case OpDiv:
+		if !hasNonZeroConstantDivisor(inst) {
+			kind = SideEffectException
+		}
+	case OpCall:
+		kind = SideEffectUnknown
+	}
+	if sa.sideEffects == nil {
+		sa.sideEffects = make(map[*Instruction]SideEffectKind)
+	}
+	sa.sideEffects[inst] = kind
+	return kind
+}
+
+// isHoistableOpcode 只有计算值的指令可以外提，控制流、调用和写内存不参与
+func isHoistableOpcode(opcode Opcode) bool {
+	switch opcode {
+	case OpLoad, OpAdd, OpSub, OpMul, OpDiv, OpShl, OpNeg, OpConst, OpCopy:
+		return true
+	}
+	return false
+}
+
+// loopCFG 函数没有控制流图时按基本块列表构造一个
+func loopCFG(function *Function) *ControlFlowGraph {
+	if function.cfg != nil {
+		return function.cfg
+	}
+	return &ControlFlowGraph{blocks: function.basicBlocks}
+}
+
+// ensurePreheader 返回循环的前置块：循环外唯一的头块前驱且只有头块一个后继时直接使用，
+// 否则新建一个前置块，把所有循环外的入边改接到它上面
+func ensurePreheader(function *Function, loop *Loop) *BasicBlock {
+	header := loop.header
+	inLoop := make(map[*BasicBlock]bool, len(loop.blocks))
+	for _, block := range loop.blocks {
+		inLoop[block] = true
+	}
+	var outside []*BasicBlock
+	for _, block := range function.basicBlocks {
+		if !inLoop[block] && containsBlock(block.successors, header) {
+			outside = append(outside, block)
+		}
+	}
+	if len(outside) == 1 && len(outside[0].successors) == 1 {
+		return outside[0]
+	}
+
+	preheader := &BasicBlock{id: header.id + ".preheader", frequency: header.frequency}
+	jump := &Instruction{id: preheader.id + ".jmp", opcode: OpBranch, operands: []*Operand{{kind: OperandLabel, label: blockLabel(header)}}, block: preheader}
+	preheader.instructions = []*Instruction{jump}
+	for _, block := range outside {
+		redirectEdge(function, block, header, preheader)
+	}
+	preheader.successors = []*BasicBlock{header}
+	header.predecessors = append(header.predecessors, preheader)
+
+	insertBlockBefore(function, preheader, header)
+	if cfg := function.cfg; cfg != nil {
+		if len(cfg.edges) > 0 {
+			cfg.edges = append(cfg.edges, &CFGEdge{source: preheader, target: header, kind: EdgeUnconditional})
+		}
+		function.domTree = BuildDominatorTree(cfg)
+	} else {
+		function.domTree = nil
+	}
+
+	// 前置块属于外层循环
+	for parent := loop.parent; parent != nil; parent = parent.parent {
+		parent.blocks = append(parent.blocks, preheader)
+	}
+	return preheader
+}
+
+// insertBlockBefore 把新块插入到before之前；before是入口时新块成为入口
+func insertBlockBefore(function *Function, block, before *BasicBlock) {
+	insert := func(blocks []*BasicBlock) []*BasicBlock {
+		inserted := make([]*BasicBlock, 0, len(blocks)+1)
+		for _, candidate := range blocks {
+			if candidate == before {
+				inserted = append(inserted, block)
+			}
+			inserted = append(inserted, candidate)
+		}
+		return inserted
+	}
+	function.basicBlocks = insert(function.basicBlocks)
+	if cfg := function.cfg; cfg != nil {
+		cfg.blocks = insert(cfg.blocks)
+		if cfg.entry == before {
+			cfg.entry = block
+		}
+	}
+}
+
+// rebuildFlatInstructions 把block中尚未出现在扁平指令列表里的指令补回列表：
+// 块已有指令在列表中时插在其末尾的跳转之前，否则插在首个已在列表中的后继块之前，都找不到时追加到末尾
+func rebuildFlatInstructions(function *Function, block *BasicBlock) {
+	present := make(map[*Instruction]bool, len(function.instructions))
+	for _, inst := range function.instructions {
+		present[inst] = true
+	}
+	var missing []*Instruction
+	for _, inst := range block.instructions {
+		if !present[inst] {
+			missing = append(missing, inst)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	// 按块的指令列表判断归属，不依赖指令的block字段
+	position := -1
+	for i, inst := range function.instructions {
+		if containsInstruction(block.instructions, inst) {
+			position = i + 1
+			if inst.opcode == OpBranch {
+				position = i
+			}
+		}
+	}
+	for _, successor := range block.successors {
+		if position >= 0 {
+			break
+		}
+		if successor == block {
+			continue
+		}
+		for i, inst := range function.instructions {
+			if containsInstruction(successor.instructions, inst) {
+				position = i
+				break
+			}
+		}
+	}
+	if position < 0 {
+		position = len(function.instructions)
+	}
+	flat := make([]*Instruction, 0, len(function.instructions)+len(missing))
+	flat = append(flat, function.instructions[:position]...)
+	flat = append(flat, missing...)
+	function.instructions = append(flat, function.instructions[position:]...)
+}
+
+// countedLoop 可静态确定迭代次数的单块循环：块以"if i 跳转自身，否则exit"结尾，
+// i在循环外初始化为正常量，循环内唯一的定义每次减去固定步长，恰好减到0时退出
+type countedLoop struct {
+	block     *BasicBlock
+	exit      *BasicBlock
+	body      []*Instruction // 不含末尾的条件分支
+	branch    *Instruction
+	tripCount int64
+}
+
+// Unroll 展开迭代次数已知的单块循环。展开后的代码不超过成本模型的代码量阈值时完全展开并消除循环，
+// 否则（策略为UnrollComplete时除外）按unrollFactor部分展开，余下的迭代按remainderHandling处理
+func (lu *LoopUnrolling) Unroll(function *Function, loop *Loop) *UnrollResult {
+	result := &UnrollResult{factor: 1}
+	counted := lu.analyzeCountedLoop(function, loop)
+	if counted == nil {
+		return result
+	}
+
+	// 循环体至少包含归纳变量的更新；以除法比较，避免tripCount*bodySize溢出后通过阈值检查
+	bodySize := int64(len(counted.body))
+	threshold := int64(lu.costModel.codeSizeThreshold)
+	if bodySize == 0 {
+		return result
+	}
+	maxCopies := threshold / bodySize
+	if counted.tripCount <= maxCopies {
+		lu.unrollCompletely(function, counted)
+		result.unrolled = true
+		result.factor = int(counted.tripCount)
+	} else if lu.strategy != UnrollComplete {
+		factor := int64(lu.unrollFactor)
+		for factor > 1 && factor > maxCopies {
+			factor--
+		}
+		remainder := counted.tripCount % factor
+		if factor < 2 || counted.tripCount < factor || remainder != 0 && lu.remainderHandling == RemainderIgnore {
+			return result
+		}
+		lu.unrollPartially(function, loop, counted, factor, remainder)
+		result.unrolled = true
+		result.factor = int(factor)
+	} else {
+		return result
+	}
+
+	// 每次迭代的分支开销按展开因子摊薄
+	result.speedupEstimate = (1 - 1/float64(result.factor)) / float64(bodySize+1)
+	function.domTree = nil
+	function.loopInfo = nil
+	return result
+}
+
+// analyzeCountedLoop 识别计数循环，不符合形式时返回nil
+func (lu *LoopUnrolling) analyzeCountedLoop(function *Function, loop *Loop) *countedLoop {
+	if function == nil || loop == nil || len(loop.blocks) != 1 || loop.blocks[0] != loop.header {
+		return nil
+	}
+	block := loop.header
+	n := len(block.instructions)
+	if n < 2 || len(block.successors) != 2 || block.successors[0] != block || block.successors[1] == block {
+		return nil
+	}
+	branch := block.instructions[n-1]
+	if branch.opcode != OpBranch || len(branch.operands) != 1 || branch.operands[0] == nil ||
+		branch.operands[0].kind != OperandVariable || branch.operands[0].variable == nil {
+		return nil
+	}
+	counter := branch.operands[0].variable
+
+	// 循环内i只有一处定义：i = i - step 或 i = i + (-step)
+	var step int64
+	for _, inst := range block.instructions[:n-1] {
+		if inst.result != counter {
+			continue
+		}
+		if step != 0 || len(inst.operands) != 2 || inst.operands[0] == nil || inst.operands[0].variable != counter ||
+			inst.operands[1] == nil || inst.operands[1].kind != OperandConstant {
+			return nil
+		}
+		value, ok := constantInteger(inst.operands[1].constant)
+		switch {
+		case !ok:
+			return nil
+		case inst.opcode == OpSub:
+			step = value
+		case inst.opcode == OpAdd:
+			step = -value
+		default:
+			return nil
+		}
+		if step <= 0 {
+			return nil
+		}
+	}
+	if step == 0 {
+		return nil
+	}
+
+	// 所有循环外前驱流出时i都是同一个正常量
+	reaching := NewReachingDefinitionsAnalyzer().Analyze(function).(*ReachingDefinitionsResult)
+	initial := latticeValue{kind: latticeTop}
+	entered := false
+	for _, predecessor := range function.basicBlocks {
+		if predecessor == block || !containsBlock(predecessor.successors, block) {
+			continue
+		}
+		entered = true
+		out := reaching.reachingOut[predecessor]
+		for _, def := range reaching.byVariable[counter] {
+			if out != nil && out.Test(def.index) {
+				initial = initial.meet(definitionValue(def))
+			}
+		}
+	}
+	if !entered || initial.kind != latticeConstant {
+		return nil
+	}
+	start, ok := constantInteger(initial.constant)
+	if !ok || start <= 0 || start%step != 0 {
+		return nil
+	}
+
+	return &countedLoop{
+		block:     block,
+		exit:      block.successors[1],
+		body:      block.instructions[:n-1],
+		branch:    branch,
+		tripCount: start / step,
+	}
+}
+
+// unrollCompletely 把循环体复制tripCount份，末尾的条件分支改为跳往出口，循环不复存在
+func (lu *LoopUnrolling) unrollCompletely(function *Function, counted *countedLoop) {
+	block := counted.block
+	instructions := make([]*Instruction, 0, int(counted.tripCount)*len(counted.body)+1)
+	instructions = append(instructions, counted.body...)
+	for n := int64(1); n < counted.tripCount; n++ {
+		instructions = append(instructions, cloneInstructions(counted.body, block, fmt.Sprintf(".u%d", n))...)
+	}
+	jump := &Instruction{id: counted.branch.id, opcode: OpBranch, operands: []*Operand{{kind: OperandLabel, label: blockLabel(counted.exit)}}, block: block}
+	block.instructions = append(instructions, jump)
+
+	// 去掉自环
+	block.successors = []*BasicBlock{counted.exit}
+	block.predecessors = removeBlock(block.predecessors, block)
+	if cfg := function.cfg; cfg != nil && len(cfg.edges) > 0 {
+		edges := make([]*CFGEdge, 0, len(cfg.edges))
+		for _, edge := range cfg.edges {
+			if edge.source != block || edge.target != block {
+				edges = append(edges, edge)
+			}
+		}
+		cfg.edges = edges
+	}
+
+	if len(function.instructions) > 0 {
+		flat := function.instructions[:0]
+		for _, inst := range function.instructions {
+			if inst != counted.branch {
+				flat = append(flat, inst)
+			}
+		}
+		function.instructions = flat
+		rebuildFlatInstructions(function, block)
+	}
+}
+
+// unrollPartially 把循环体复制factor份，只保留末尾的条件分支。
+// 迭代次数除以factor的余数在进入主循环之前执行：RemainderInline直接在前置块中展开，
+// RemainderSeparate生成一个用独立计数器控制的余数循环
+func (lu *LoopUnrolling) unrollPartially(function *Function, loop *Loop, counted *countedLoop, factor, remainder int64) {
+	block := counted.block
+	instructions := make([]*Instruction, 0, int(factor)*len(counted.body)+1)
+	instructions = append(instructions, counted.body...)
+	for n := int64(1); n < factor; n++ {
+		instructions = append(instructions, cloneInstructions(counted.body, block, fmt.Sprintf(".u%d", n))...)
+	}
+	block.instructions = append(instructions, counted.branch)
+
+	touched := []*BasicBlock{block}
+	if remainder > 0 {
+		preheader := ensurePreheader(function, loop)
+		position := len(preheader.instructions)
+		if position > 0 && preheader.instructions[position-1].opcode == OpBranch {
+			position--
+		}
+		tail := append([]*Instruction(nil), preheader.instructions[position:]...)
+		prologue := append([]*Instruction(nil), preheader.instructions[:position]...)
+
+		if lu.remainderHandling == RemainderInline {
+			for n := int64(0); n < remainder; n++ {
+				prologue = append(prologue, cloneInstructions(counted.body, preheader, fmt.Sprintf(".r%d", n))...)
+			}
+		} else {
+			counter := &Variable{name: counted.branch.operands[0].variable.name + ".rem"}
+			prologue = append(prologue, &Instruction{id: block.id + ".rem.init", opcode: OpConst,
+				operands: []*Operand{{kind: OperandConstant, constant: remainder}}, result: counter, block: preheader})
+
+			remainderBlock := &BasicBlock{id: block.id + ".remainder", frequency: block.frequency}
+			remainderBlock.instructions = append(cloneInstructions(counted.body, remainderBlock, ".rem"),
+				&Instruction{id: block.id + ".rem.dec", opcode: OpSub,
+					operands: []*Operand{{kind: OperandVariable, variable: counter}, {kind: OperandConstant, constant: int64(1)}},
+					result:   counter, block: remainderBlock},
+				&Instruction{id: block.id + ".rem.test", opcode: OpBranch,
+					operands: []*Operand{{kind: OperandVariable, variable: counter}}, block: remainderBlock})
+
+			redirectEdge(function, preheader, block, remainderBlock)
+			remainderBlock.successors = []*BasicBlock{remainderBlock, block}
+			remainderBlock.predecessors = []*BasicBlock{preheader, remainderBlock}
+			block.predecessors = append(block.predecessors, remainderBlock)
+			insertBlockBefore(function, remainderBlock, block)
+			if cfg := function.cfg; cfg != nil && len(cfg.edges) > 0 {
+				cfg.edges = append(cfg.edges,
+					&CFGEdge{source: remainderBlock, target: remainderBlock, kind: EdgeConditional},
+					&CFGEdge{source: remainderBlock, target: block, kind: EdgeConditional})
+			}
+			touched = append(touched, remainderBlock)
+		}
+		preheader.instructions = append(prologue, tail...)
+		touched = append(touched, preheader)
+	}
+
+	// 后继块先就位，前面的块才能插到它之前
+	if len(function.instructions) > 0 {
+		for _, touchedBlock := range touched {
+			rebuildFlatInstructions(function, touchedBlock)
+		}
+	}
+}
+
+// cloneInstructions 复制一段指令，副本的id加上suffix，操作数逐个复制以免共享
+func cloneInstructions(instructions []*Instruction, block *BasicBlock, suffix string) []*Instruction {
+	clones := make([]*Instruction, 0, len(instructions))
+	for _, inst := range instructions {
+		clone := &Instruction{id: inst.id + suffix, opcode: inst.opcode, result: inst.result, block: block}
+		for _, operand := range inst.operands {
+			if operand == nil {
+				clone.operands = append(clone.operands, nil)
+				continue
+			}
+			copied := *operand
+			clone.operands = append(clone.operands, &copied)
+		}
+		clones = append(clones, clone)
+	}
+	return clones
+}
+
+// blockLabel 跳转时引用基本块使用的标签，没有标签时使用id
+func blockLabel(block *BasicBlock) string {
+	if block.label != "" {
+		return block.label
+	}
+	return block.id
+}
+
+// constantInteger 整数常量转换为int64
+func constantInteger(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+func (lv *LoopVectorization) Vectorize(loop *Loop) *VectorResult {
+	return &VectorResult{vectorized: true, width: 4, speedupEstimate: 0.4}
+}
+
+// AddPass 添加过程节点，并与已注册的过程连边：依赖边由被依赖过程指向依赖方，
+// 冲突边在两个冲突过程之间只添加一次。引用尚未注册的过程时，边在其注册时补上
+func (dg *DependencyGraph) AddPass(pass *OptimizationPass) {
+	node := &DependencyNode{
+		passID: pass.id,
+		pass:   pass,
+	}
+	dg.nodes[pass.id] = node
+
+	for _, dep := range pass.dependencies {
+		if source, exists := dg.nodes[dep]; exists && source != node {
+			dg.addEdge(source, node, DependencyRequired)
+		}
+	}
+	for _, conflict := range pass.conflicts {
+		if other, exists := dg.nodes[conflict]; exists && other != node && !dg.hasEdge(other, node, DependencyConflict) {
+			dg.addEdge(node, other, DependencyConflict)
+		}
+	}
+
+	for _, other := range dg.nodes {
+		if other == node {
+			continue
+		}
+		for _, dep := range other.pass.dependencies {
+			if dep == pass.id {
+				dg.addEdge(node, other, DependencyRequired)
+			}
+		}
+		for _, conflict := range other.pass.conflicts {
+			if conflict == pass.id && !dg.hasEdge(node, other, DependencyConflict) {
+				dg.addEdge(other, node, DependencyConflict)
+			}
+		}
+	}
+}
+
+func (dg *DependencyGraph) addEdge(source, target *DependencyNode, kind DependencyKind) {
+	edge := &DependencyEdge{source: source, target: target, kind: kind, weight: 1}
+	dg.edges = append(dg.edges, edge)
+	source.outgoing = append(source.outgoing, edge)
+	target.incoming = append(target.incoming, edge)
+}
+
+// hasEdge 判断两个节点间是否已有给定类型的边（不区分方向）
+func (dg *DependencyGraph) hasEdge(a, b *DependencyNode, kind DependencyKind) bool {
+	for _, edge := range a.outgoing {
+		if edge.target == b && edge.kind == kind {
+			return true
+		}
+	}
+	for _, edge := range a.incoming {
+		if edge.source == b && edge.kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// excludes 判断两个过程是否因冲突或互斥不能相邻执行
+func (dg *DependencyGraph) excludes(a, b string) bool {
+	nodeA, nodeB := dg.nodes[a], dg.nodes[b]
+	if nodeA == nil || nodeB == nil {
+		return false
+	}
+	return dg.hasEdge(nodeA, nodeB, DependencyConflict) || dg.hasEdge(nodeA, nodeB, DependencyMutex)
+}
+
+// SchedulePasses 按拓扑顺序调度过程：依赖先于依赖方执行，同时就绪的过程按优先级从高到低，
+// 优先级相同时保持注册顺序，并尽量避免冲突或互斥的过程相邻。其他策略保持原有顺序
+func (ps *PassScheduler) SchedulePasses(passes []*OptimizationPass, context *OptimizationContext) ([]*OptimizationPass, error) {
+	if ps.strategy != StrategyTopological || ps.dependencies == nil {
+		return passes, nil
+	}
+
+	position := make(map[string]int, len(passes))
+	for i, pass := range passes {
+		position[pass.id] = i
+	}
+
+	// 只统计待调度过程之间的依赖边
+	indegree := make(map[string]int, len(passes))
+	for _, pass := range passes {
+		node := ps.dependencies.nodes[pass.id]
+		if node == nil {
+			continue
+		}
+		for _, edge := range node.incoming {
+			if _, scheduled := position[edge.source.passID]; scheduled && edge.kind == DependencyRequired {
+				indegree[pass.id]++
+			}
+		}
+	}
+
+	var ready []*OptimizationPass
+	for _, pass := range passes {
+		if indegree[pass.id] == 0 {
+			ready = append(ready, pass)
+		}
+	}
+
+	schedule := make([]*OptimizationPass, 0, len(passes))
+	for len(ready) > 0 {
+		sort.SliceStable(ready, func(i, j int) bool {
+			if ready[i].priority != ready[j].priority {
+				return ready[i].priority > ready[j].priority
+			}
+			return position[ready[i].id] < position[ready[j].id]
+		})
+
+		// 选择第一个不与上一个过程冲突的就绪过程
+		chosen := -1
+		for i, pass := range ready {
+			if len(schedule) == 0 || !ps.dependencies.excludes(schedule[len(schedule)-1].id, pass.id) {
+				chosen = i
+				break
+			}
+		}
+		if chosen < 0 {
+			return nil, fmt.Errorf("cannot schedule pass %q: it conflicts with preceding pass %q and no other pass is ready",
+				ready[0].id, schedule[len(schedule)-1].id)
+		}
+
+		pass := ready[chosen]
+		ready = append(ready[:chosen], ready[chosen+1:]...)
+		schedule = append(schedule, pass)
+
+		if node := ps.dependencies.nodes[pass.id]; node != nil {
+			for _, edge := range node.outgoing {
+				if edge.kind != DependencyRequired {
+					continue
+				}
+				target := edge.target.passID
+				if _, scheduled := position[target]; !scheduled {
+					continue
+				}
+				indegree[target]--
+				if indegree[target] == 0 {
+					ready = append(ready, passes[position[target]])
+				}
+			}
+		}
+	}
+
+	if len(schedule) < len(passes) {
+		var blocked []string
+		for _, pass := range passes {
+			if indegree[pass.id] > 0 {
+				blocked = append(blocked, pass.id)
+			}
+		}
+		return nil, fmt.Errorf("dependency cycle prevents scheduling passes: %s", strings.Join(blocked, ", "))
+	}
+	return schedule, nil
+}
+
+// 结果类型定义
+type DeadCodeResult struct {
+	eliminatedCount int64
+}
+
+type UnreachableResult struct {
+	eliminatedBlocks int64
+}
+
+type BlockMergeResult struct {
+	mergedBlocks int64
+}
+
+type JumpThreadingResult struct {
+	threadedEdges int64
+	removedBlocks int64
+}
+
+type TailCallResult struct {
+	optimizedCalls int64
+}
+
+type BranchResult struct {
+	optimizedBranches int64
+	performanceGain   float64
+}
+
+type InvariantResult struct {
+	hoistedCount    int64
+	speedupEstimate float64
+}
+
+type UnrollResult struct {
+	unrolled        bool
+	factor          int
+	speedupEstimate float64
+}
+
+type VectorResult struct {
+	vectorized      bool
+	width           int
+	speedupEstimate float64
+}
+
+// 剖面引导优化
+
+// ProfileData 执行剖面数据，按函数汇总基本块与控制流边的执行次数
+type ProfileData struct {
+	functions map[string]*FunctionProfile
+}
+
+// FunctionProfile 单个函数的剖面数据
+type FunctionProfile struct {
+	blocks map[string]uint64
+	edges  map[ProfileEdge]uint64
+}
+
+// ProfileEdge 控制流边
+type ProfileEdge struct {
+	From string
+	To   string
+}
+
+func NewProfileData() *ProfileData {
+	return &ProfileData{functions: make(map[string]*FunctionProfile)}
+}
+
+// LoadProfile 解析文本格式的剖面数据。每行一个样本：
+//
+//	<function> <block> <count>
+//	<function> <from>-><to> <count>
+//
+// 空行和以#开头的行被忽略，重复的样本累加计数。
+func LoadProfile(r io.Reader) (*ProfileData, error) {
+	profile := NewProfileData()
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("profile line %d: expected <function> <block|from->to> <count>, got %q", lineNo, line)
+		}
+		count, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("profile line %d: invalid count %q: %w", lineNo, fields[2], err)
+		}
+
+		if from, to, isEdge := strings.Cut(fields[1], "->"); isEdge {
+			if from == "" || to == "" {
+				return nil, fmt.Errorf("profile line %d: malformed edge %q", lineNo, fields[1])
+			}
+			profile.function(fields[0]).edges[ProfileEdge{From: from, To: to}] += count
+		} else {
+			profile.function(fields[0]).blocks[fields[1]] += count
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read profile: %w", err)
+	}
+
+	return profile, nil
+}
+
+// merge 把other的样本累加到当前剖面
+func (pd *ProfileData) merge(other *ProfileData) {
+	for name, source := range other.functions {
+		target := pd.function(name)
+		for block, count := range source.blocks {
+			target.blocks[block] += count
+		}
+		for edge, count := range source.edges {
+			target.edges[edge] += count
+		}
+	}
+}
+
+// function 获取或创建函数剖面
+func (pd *ProfileData) function(name string) *FunctionProfile {
+	fp, exists := pd.functions[name]
+	if !exists {
+		fp = &FunctionProfile{
+			blocks: make(map[string]uint64),
+			edges:  make(map[ProfileEdge]uint64),
+		}
+		pd.functions[name] = fp
+	}
+	return fp
+}
+
+// BlockCount 返回基本块的执行次数
+func (pd *ProfileData) BlockCount(function, block string) (uint64, bool) {
+	fp, exists := pd.functions[function]
+	if !exists {
+		return 0, false
+	}
+	count, exists := fp.blocks[block]
+	return count, exists
+}
+
+// BranchProbability 返回实测的分支概率：边计数除以源块所有出边计数之和，
+// 缺少出边样本时退化为除以源块执行次数
+func (pd *ProfileData) BranchProbability(function, from, to string) (float64, bool) {
+	fp, exists := pd.functions[function]
+	if !exists {
+		return 0, false
+	}
+
+	var total uint64
+	for edge, count := range fp.edges {
+		if edge.From == from {
+			total += count
+		}
+	}
+	if total == 0 {
+		total = fp.blocks[from]
+	}
+	if total == 0 {
+		return 0, false
+	}
+
+	return float64(fp.edges[ProfileEdge{From: from, To: to}]) / float64(total), true
+}
+
+// Annotate 用剖面数据填充基本块频率，频率为每次函数调用中块的平均执行次数
+func (pd *ProfileData) Annotate(function *Function) bool {
+	fp, exists := pd.functions[function.name]
+	if !exists || len(function.basicBlocks) == 0 {
+		return false
+	}
+
+	entry := fp.blocks[function.basicBlocks[0].id]
+	if entry == 0 {
+		for _, count := range fp.blocks {
+			entry = max(entry, count)
+		}
+	}
+	if entry == 0 {
+		return false
+	}
+
+	for _, block := range function.basicBlocks {
+		block.frequency = float64(fp.blocks[block.id]) / float64(entry)
+	}
+	return true
+}
+
+// AttachProfile 将剖面数据附加到优化上下文，并据此填充上下文中函数的基本块频率
+func (oc *OptimizationContext) AttachProfile(profile *ProfileData) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	oc.profile = profile
+	if oc.function != nil {
+		profile.Annotate(oc.function)
+	}
+	if oc.module != nil {
+		for _, function := range oc.module.functions {
+			if function != oc.function {
+				profile.Annotate(function)
+			}
+		}
+	}
+}
+
+// PrioritizeCallSites 返回内联候选调用点，有剖面数据时按调用点所在块的频率降序排列
+func (fo *FunctionOptimizer) PrioritizeCallSites(context *OptimizationContext) []*CallEdge {
+	if context.function == nil || context.function.callGraph == nil {
+		return nil
+	}
+
+	edges := append([]*CallEdge(nil), context.function.callGraph.edges...)
+	if context.profile != nil {
+		sort.SliceStable(edges, func(i, j int) bool {
+			return callSiteFrequency(edges[i]) > callSiteFrequency(edges[j])
+		})
+	}
+	return edges
+}
+
+// callSiteFrequency 调用点所在基本块的执行频率
+func callSiteFrequency(edge *CallEdge) float64 {
+	if edge.callSite == nil || edge.callSite.block == nil {
+		return 0
+	}
+	return edge.callSite.block.frequency
+}
+
+// 常量折叠
+
+// ConstantFoldingTransformer 在编译期计算操作数全为常量的算术指令，
+// 将其改写为OpConst，并把结果代入同一基本块内后续对该变量的使用
+type ConstantFoldingTransformer struct{}
+
+func (cft *ConstantFoldingTransformer) Transform(context *OptimizationContext) (*TransformationResult, error) {
+	result := &TransformationResult{
+		passID:    "constant_folding",
+		success:   true,
+		metrics:   make(map[string]float64),
+		timestamp: time.Now(),
+	}
+	if context.function == nil {
+		return result, nil
+	}
+
+	folded, substituted := 0, 0
+	for _, block := range context.function.basicBlocks {
+		// 块内已知常量值的变量，变量被重新定义时失效
+		known := make(map[*Variable]interface{})
+		for _, inst := range block.instructions {
+			for i, operand := range inst.operands {
+				if operand == nil || operand.kind != OperandVariable {
+					continue
+				}
+				if value, exists := known[operand.variable]; exists {
+					inst.operands[i] = &Operand{kind: OperandConstant, constant: value}
+					substituted++
+				}
+			}
+
+			if value, ok := foldInstruction(inst); ok {
+				inst.opcode = OpConst
+				inst.operands = []*Operand{{kind: OperandConstant, constant: value}}
+				folded++
+			}
+
+			if inst.result != nil {
+				delete(known, inst.result)
+				if inst.opcode == OpConst && len(inst.operands) == 1 && inst.operands[0].kind == OperandConstant {
+					known[inst.result] = inst.operands[0].constant
+				}
+			}
+		}
+	}
+
+	result.changed = folded > 0 || substituted > 0
+	result.metrics["instructions_folded"] = float64(folded)
+	result.metrics["operands_substituted"] = float64(substituted)
+	return result, nil
+}
+
+func (cft *ConstantFoldingTransformer) CanTransform(context *OptimizationContext) bool {
+	return context.function != nil
+}
+
+func (cft *ConstantFoldingTransformer) EstimateCost(context *OptimizationContext) float64 {
+	if context.function == nil {
+		return 0
+	}
+	count := 0
+	for _, block := range context.function.basicBlocks {
+		count += len(block.instructions)
+	}
+	return float64(count)
+}
+
+// foldInstruction 计算两个同类型常量操作数的加减乘除，除数为0时不折叠
+func foldInstruction(inst *Instruction) (interface{}, bool) {
+	switch inst.opcode {
+	case OpAdd, OpSub, OpMul, OpDiv:
+	default:
+		return nil, false
+	}
+	if inst.result == nil || len(inst.operands) != 2 {
+		return nil, false
+	}
+	for _, operand := range inst.operands {
+		if operand == nil || operand.kind != OperandConstant {
+			return nil, false
+		}
+	}
+
+	left, right := inst.operands[0].constant, inst.operands[1].constant
+	leftType, ok := constantElementType(left)
+	if rightType, rightOK := constantElementType(right); !ok || !rightOK || leftType != rightType {
+		return nil, false
+	}
+
+	switch l := left.(type) {
+	case int8:
+		if r, ok := right.(int8); ok {
+			return foldInteger(inst.opcode, l, r)
+		}
+	case int16:
+		if r, ok := right.(int16); ok {
+			return foldInteger(inst.opcode, l, r)
+		}
+	case int32:
+		if r, ok := right.(int32); ok {
+			return foldInteger(inst.opcode, l, r)
+		}
+	case int:
+		if r, ok := right.(int); ok {
+			return foldInteger(inst.opcode, l, r)
+		}
+		return foldInt64(inst.opcode, left, right)
+	case int64:
+		return foldInt64(inst.opcode, left, right)
+	case float32:
+		if r, ok := right.(float32); ok {
+			return foldFloat(inst.opcode, l, r)
+		}
+	case float64:
+		if r, ok := right.(float64); ok {
+			return foldFloat(inst.opcode, l, r)
+		}
+	}
+	return nil, false
+}
+
+// foldInt64 int与int64混用时统一转换为int64计算，其他类型不折叠
+func foldInt64(opcode Opcode, left, right interface{}) (interface{}, bool) {
+	l, leftOK := constantInteger(left)
+	r, rightOK := constantInteger(right)
+	if !leftOK || !rightOK {
+		return nil, false
+	}
+	return foldInteger(opcode, l, r)
+}
+
+// constantElementType 常量的元素类型，int按64位整数处理
+func constantElementType(value interface{}) (ElementType, bool) {
+	switch value.(type) {
+	case int8:
+		return ElementInt8, true
+	case int16:
+		return ElementInt16, true
+	case int32:
+		return ElementInt32, true
+	case int64, int:
+		return ElementInt64, true
+	case float32:
+		return ElementFloat32, true
+	case float64:
+		return ElementFloat64, true
+	}
+	return 0, false
+}
+
+// foldInteger 按操作数类型的位宽回绕计算
+func foldInteger[T int8 | int16 | int32 | int64 | int](opcode Opcode, left, right T) (interface{}, bool) {
+	switch opcode {
+	case OpAdd:
+		return left + right, true
+	case OpSub:
+		return left - right, true
+	case OpMul:
+		return left * right, true
+	case OpDiv:
+		if right == 0 {
+			return nil, false
+		}
+		return left / right, true
+	}
+	return nil, false
+}
+
+func foldFloat[T float32 | float64](opcode Opcode, left, right T) (interface{}, bool) {
+	switch opcode {
+	case OpAdd:
+		return left + right, true
+	case OpSub:
+		return left - right, true
+	case OpMul:
+		return left * right, true
+	case OpDiv:
+		if right == 0 {
+			return nil, false
+		}
+		return left / right, true
+	}
+	return nil, false
+}
+
+// 常量传播
+
+// latticeKind 常量传播格：⊤表示尚无定义信息，⊥表示不是常量
+type latticeKind int
+
+const (
+	latticeTop latticeKind = iota
+	latticeConstant
+	latticeBottom
+)
+
+// latticeValue 变量在某一程序点的格值
+type latticeValue struct {
+	kind     latticeKind
+	constant interface{}
+}
+
+// meet 格的交运算：⊤与任意值相交得该值，不同常量相交得⊥
+func (lv latticeValue) meet(other latticeValue) latticeValue {
+	switch {
+	case lv.kind == latticeTop:
+		return other
+	case other.kind == latticeTop:
+		return lv
+	case lv.kind == latticeConstant && other.kind == latticeConstant && lv.constant == other.constant:
+		return lv
+	}
+	return latticeValue{kind: latticeBottom}
+}
+
+// ConstantPropagationTransformer 基于到达定义传播常量：变量在使用点的全部到达定义
+// 都赋予同一常量时，用该常量替换变量操作数。常量经OpCopy传递，重复分析直到不动点
+type ConstantPropagationTransformer struct{}
+
+func (cpt *ConstantPropagationTransformer) Transform(context *OptimizationContext) (*TransformationResult, error) {
+	result := &TransformationResult{
+		passID:    "constant_propagation",
+		success:   true,
+		metrics:   make(map[string]float64),
+		timestamp: time.Now(),
+	}
+	if context.function == nil {
+		return result, nil
+	}
+
+	substituted, iterations := 0, 0
+	for changed := true; changed; {
+		changed = false
+		iterations++
+		reaching := NewReachingDefinitionsAnalyzer().Analyze(context.function).(*ReachingDefinitionsResult)
+		for _, block := range context.function.basicBlocks {
+			current := reaching.reachingIn[block].Clone()
+			for _, inst := range block.instructions {
+				for i, operand := range inst.operands {
+					// 取地址的操作数是变量本身而不是它的值
+					if operand == nil || operand.kind != OperandVariable || inst.opcode == OpAddr {
+						continue
+					}
+					value := latticeValue{kind: latticeTop}
+					for _, def := range reaching.byVariable[operand.variable] {
+						if current.Test(def.index) {
+							value = value.meet(definitionValue(def))
+						}
+					}
+					if value.kind == latticeConstant {
+						inst.operands[i] = &Operand{kind: OperandConstant, constant: value.constant}
+						substituted++
+						changed = true
+					}
+				}
+				reaching.advance(current, inst)
+			}
+		}
+	}
+
+	result.changed = substituted > 0
+	result.metrics["operands_substituted"] = float64(substituted)
+	result.metrics["iterations"] = float64(iterations)
+	return result, nil
+}
+
+// definitionValue 定义赋予变量的格值，只有常量赋值和常量复制产生常量，入口初值未知
+func definitionValue(def *Definition) latticeValue {
+	inst := def.instruction
+	if inst != nil && (inst.opcode == OpConst || inst.opcode == OpCopy) && len(inst.operands) == 1 &&
+		inst.operands[0] != nil && inst.operands[0].kind == OperandConstant {
+		return latticeValue{kind: latticeConstant, constant: inst.operands[0].constant}
+	}
+	return latticeValue{kind: latticeBottom}
+}
+
+func (cpt *ConstantPropagationTransformer) CanTransform(context *OptimizationContext) bool {
+	return context.function != nil
+}
+
+func (cpt *ConstantPropagationTransformer) EstimateCost(context *OptimizationContext) float64 {
+	if context.function == nil {
+		return 0
+	}
+	count := 0
+	for _, block := range context.function.basicBlocks {
+		count += len(block.instructions)
+	}
+	return float64(count)
+}
+
+// 公共子表达式消除
+
+// CommonSubexpressionTransformer 基于可用表达式分析消除重复计算：表达式在所有路径上都已由
+// 变量t保存时，把重复计算改写为从t复制；结果变量本身就是t时直接删除重复计算
+type CommonSubexpressionTransformer struct{}
+
+func (cse *CommonSubexpressionTransformer) Transform(context *OptimizationContext) (*TransformationResult, error) {
+	result := &TransformationResult{
+		passID:    "common_subexpression_elimination",
+		success:   true,
+		metrics:   make(map[string]float64),
+		timestamp: time.Now(),
+	}
+	if context.function == nil {
+		return result, nil
+	}
+
+	available := NewAvailableExpressionsAnalyzer().Analyze(context.function).(*AvailableExpressionsResult)
+	byValue := make(map[string][]int)
+	for i, expression := range available.expressions {
+		byValue[expression.value] = append(byValue[expression.value], i)
+	}
+
+	eliminated := 0
+	for _, block := range context.function.basicBlocks {
+		current := available.availableIn[block].Clone()
+		kept := make([]*Instruction, 0, len(block.instructions))
+		for _, inst := range block.instructions {
+			gen, kill := available.instGen[inst], available.instKill[inst]
+			remove := false
+			if value, ok := expressionValue(inst); ok {
+				for _, i := range byValue[value] {
+					if !current.Test(i) {
+						continue
+					}
+					holder := available.expressions[i].result
+					if holder == inst.result {
+						remove = true
+					} else {
+						inst.opcode = OpCopy
+						inst.operands = []*Operand{{kind: OperandVariable, variable: holder}}
+					}
+					eliminated++
+					break
+				}
+			}
+
+			current.Difference(kill)
+			if gen >= 0 {
+				current.Set(gen)
+			}
+			if !remove {
+				kept = append(kept, inst)
+			}
+		}
+		block.instructions = kept
+	}
+
+	result.changed = eliminated > 0
+	result.metrics["expressions_eliminated"] = float64(eliminated)
+	return result, nil
+}
+
+func (cse *CommonSubexpressionTransformer) CanTransform(context *OptimizationContext) bool {
+	return context.function != nil
+}
+
+func (cse *CommonSubexpressionTransformer) EstimateCost(context *OptimizationContext) float64 {
+	if context.function == nil {
+		return 0
+	}
+	count := 0
+	for _, block := range context.function.basicBlocks {
+		count += len(block.instructions)
+	}
+	return float64(count)
+}
+
+// 逃逸分析
+
+// stackAllocatableKey 分配指令元数据中标记能否在栈上分配的键
+const stackAllocatableKey = "stack_allocatable"
+
+// MemoryOptimizer 内存优化器：通过逃逸分析找出指针不会离开函数的分配，标记为可在栈上分配
+type MemoryOptimizer struct {
+	aliasAnalyzer *AliasAnalyzer
+}
+
+func NewMemoryOptimizer() *MemoryOptimizer {
+	return &MemoryOptimizer{
+		aliasAnalyzer: NewAliasAnalyzer(),
+	}
+}
+
+// Transform 在每条OpAlloc的元数据中写入stack_allocatable。分配的位置经由以下途径可达时视为逃逸：
+// 未知内存（传给调用的实参、写入形参所指内存的值）、返回值、模块全局变量；
+// 逃逸位置中保存的指针所指的位置同样逃逸。上下文中已有别名分析结果时直接使用
+func (mo *MemoryOptimizer) Transform(context *OptimizationContext) (*TransformationResult, error) {
+	result := &TransformationResult{
+		passID:    "escape_analysis",
+		success:   true,
+		metrics:   make(map[string]float64),
+		timestamp: time.Now(),
+	}
+	function := context.function
+	if function == nil {
+		return result, nil
+	}
+
+	var allocations []*Instruction
+	var returned []*Variable
+	for _, block := range function.basicBlocks {
+		for _, inst := range block.instructions {
+			switch inst.opcode {
+			case OpAlloc:
+				allocations = append(allocations, inst)
+			case OpReturn:
+				if len(inst.operands) > 0 && inst.operands[0] != nil && inst.operands[0].kind == OperandVariable {
+					returned = append(returned, inst.operands[0].variable)
+				}
+			}
+		}
+	}
+	if len(allocations) == 0 {
+		return result, nil
+	}
+
+	alias := mo.aliasResult(context)
+	for _, inst := range allocations {
+		if alias.AllocationSite(inst) == nil {
+			// 缓存的结果早于当前IR，重新分析
+			alias = mo.aliasAnalyzer.Analyze(function).(*AliasResult)
+			break
+		}
+	}
+	globals := moduleGlobals(context.module)
+
+	// 从逃逸的根出发，沿指向关系求闭包
+	escaped := make(map[*Variable]bool)
+	var worklist []*Variable
+	escape := func(variable *Variable) {
+		for _, location := range alias.PointsTo(variable) {
+			if !escaped[location] {
+				escaped[location] = true
+				worklist = append(worklist, location)
+			}
+		}
+	}
+	escape(alias.unknown)
+	for _, variable := range returned {
+		escape(variable)
+	}
+	for variable := range alias.pointsTo {
+		if globals[variable.name] {
+			escape(variable)
+		}
+	}
+	for len(worklist) > 0 {
+		location := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		escape(location)
+	}
+
+	stack, changed := 0, false
+	for _, inst := range allocations {
+		allocatable := !escaped[alias.AllocationSite(inst)]
+		if allocatable {
+			stack++
+		}
+		if inst.metadata == nil {
+			inst.metadata = make(map[string]interface{})
+		}
+		if previous, exists := inst.metadata[stackAllocatableKey]; !exists || previous != allocatable {
+			inst.metadata[stackAllocatableKey] = allocatable
+			changed = true
+		}
+	}
+
+	result.changed = changed
+	result.metrics["allocations"] = float64(len(allocations))
+	result.metrics["stack_allocated"] = float64(stack)
+	result.metrics["escaped"] = float64(len(allocations) - stack)
+	return result, nil
+}
+
+// aliasResult 优先使用上下文中有效的别名分析结果，否则重新分析
+func (mo *MemoryOptimizer) aliasResult(context *OptimizationContext) *AliasResult {
+	if analysis, exists := context.analysisResults[AnalysisAlias]; exists && analysis != nil && analysis.valid {
+		if alias, ok := analysis.data.(*AliasResult); ok {
+			return alias
+		}
+	}
+	return mo.aliasAnalyzer.Analyze(context.function).(*AliasResult)
+}
+
+func (mo *MemoryOptimizer) CanTransform(context *OptimizationContext) bool {
+	return context.function != nil
+}
+
+func (mo *MemoryOptimizer) EstimateCost(context *OptimizationContext) float64 {
+	if context.function == nil {
+		return 0
+	}
+	return float64(functionSize(context.function))
+}
+
+// 函数内联
+
+// InliningConfig 内联配置，零值字段使用默认值
+type InliningConfig struct {
+	SizeThreshold int     // 被调函数的指令数上限
+	GrowthBudget  int     // 一次变换中调用者允许增加的指令总数
+	MinROI        float64 // 成本模型给出的ROI下限
+}
+
+const (
+	defaultInlineSizeThreshold = 16
+	defaultInlineGrowthBudget  = 64
+	defaultInlineMinROI        = 0.25
+	inlineCallOverhead         = 4 // 一次调用省去的指令数估计：调用、返回以及栈帧的建立和销毁
+)
+
+// InliningTransformer 按调用图把小的非递归被调函数复制到调用点：形参替换为实参，
+// 返回值赋给调用的结果变量，并相应更新调用图
+type InliningTransformer struct {
+	config    InliningConfig
+	costModel PassCostModel
+}
+
+func NewInliningTransformer(config InliningConfig) *InliningTransformer {
+	if config.SizeThreshold <= 0 {
+		config.SizeThreshold = defaultInlineSizeThreshold
+	}
+	if config.GrowthBudget <= 0 {
+		config.GrowthBudget = defaultInlineGrowthBudget
+	}
+	if config.MinROI <= 0 {
+		config.MinROI = defaultInlineMinROI
+	}
+	return &InliningTransformer{
+		config:    config,
+		costModel: NewPassCostModel(),
+	}
+}
+
+func (it *InliningTransformer) Transform(context *OptimizationContext) (*TransformationResult, error) {
+	result := &TransformationResult{
+		passID:    "function_inlining",
+		success:   true,
+		metrics:   make(map[string]float64),
+		timestamp: time.Now(),
+	}
+	function := context.function
+	if function == nil || function.callGraph == nil {
+		return result, nil
+	}
+
+	// 热调用点优先消耗增长预算
+	globals := moduleGlobals(context.module)
+	budget := it.config.GrowthBudget
+	inlined, added := 0, 0
+	for _, edge := range NewFunctionOptimizer().PrioritizeCallSites(context) {
+		if edge.caller == nil || edge.caller.function != function || edge.callee == nil ||
+			edge.callee.function == nil || edge.callSite == nil {
+			continue
+		}
+		callee := edge.callee.function
+		size := functionSize(callee)
+		if callee == function || size > it.config.SizeThreshold || size > budget ||
+			isRecursiveCallee(function.callGraph, edge.callee) || it.roi(edge, size) < it.config.MinROI {
+			continue
+		}
+		if !it.inline(function, edge, globals) {
+			continue
+		}
+		budget -= size
+		added += size
+		inlined++
+	}
+
+	if inlined > 0 {
+		function.domTree = nil
+		function.loopInfo = nil
+	}
+	result.changed = inlined > 0
+	result.metrics["calls_inlined"] = float64(inlined)
+	result.metrics["instructions_added"] = float64(added)
+	return result, nil
+}
+
+func (it *InliningTransformer) CanTransform(context *OptimizationContext) bool {
+	return context.function != nil && context.function.callGraph != nil
+}
+
+func (it *InliningTransformer) EstimateCost(context *OptimizationContext) float64 {
+	if context.function == nil || context.function.callGraph == nil {
+		return 0
+	}
+	return float64(len(context.function.callGraph.edges))
+}
+
+// roi 内联收益按省去的调用开销乘以调用点频率估算，成本按复制的指令数估算
+func (it *InliningTransformer) roi(edge *CallEdge, size int) float64 {
+	frequency := callSiteFrequency(edge)
+	if frequency < 1 {
+		frequency = 1
+	}
+	if size < 1 {
+		size = 1
+	}
+	cost := &CostEstimate{Complexity: float64(size)}
+	benefit := &BenefitEstimate{SpeedImprovement: inlineCallOverhead * frequency}
+	return it.costModel.ComputeROI(cost, benefit)
+}
+
+// moduleGlobals 按名称索引模块的全局变量
+func moduleGlobals(module *Module) map[string]bool {
+	globals := make(map[string]bool)
+	if module != nil {
+		for _, global := range module.globals {
+			globals[global.name] = true
+		}
+	}
+	return globals
+}
+
+// inline 在调用点展开被调函数。单块被调函数直接拼接到调用点；多块时在调用点处拆分基本块，
+// 调用点之后的指令移入续块，被调函数的每个返回改为跳往续块。被调函数的局部变量和形参
+// 换成新变量，全局变量保持原有身份，使写入对调用者可见
+func (it *InliningTransformer) inline(function *Function, edge *CallEdge, globals map[string]bool) bool {
+	call, callee := edge.callSite, edge.callee.function
+	if len(call.operands)-1 != len(callee.params) || len(callee.basicBlocks) == 0 {
+		return false
+	}
+	block, index := findInstruction(function, call)
+	if block == nil {
+		return false
+	}
+
+	// 形参在被调函数中未被重新赋值时直接替换为实参，否则先把实参复制到新变量
+	assigned := make(map[*Variable]bool)
+	for _, calleeBlock := range callee.basicBlocks {
+		for _, inst := range calleeBlock.instructions {
+			if inst.result != nil {
+				assigned[inst.result] = true
+			}
+		}
+	}
+	renamed := make(map[*Variable]*Variable)
+	rename := func(variable *Variable) *Variable {
+		if variable == nil || globals[variable.name] {
+			return variable
+		}
+		if fresh, exists := renamed[variable]; exists {
+			return fresh
+		}
+		fresh := &Variable{name: callee.name + "." + variable.name, varType: variable.varType}
+		renamed[variable] = fresh
+		return fresh
+	}
+	substitutions := make(map[*Variable]*Operand)
+	var prologue []*Instruction
+	for i, param := range callee.params {
+		argument := call.operands[i+1]
+		if !assigned[param] {
+			substitutions[param] = argument
+			continue
+		}
+		prologue = append(prologue, assignmentFrom(call.id+"."+param.name, argument, rename(param)))
+	}
+
+	labels := make(map[string]string)
+	clones := make(map[*BasicBlock]*BasicBlock, len(callee.basicBlocks))
+	for _, calleeBlock := range callee.basicBlocks {
+		clone := &BasicBlock{id: call.id + "." + calleeBlock.id, frequency: block.frequency}
+		clones[calleeBlock] = clone
+		labels[calleeBlock.id] = clone.id
+		if calleeBlock.label != "" {
+			labels[calleeBlock.label] = clone.id
+		}
+	}
+	rewrite := func(operand *Operand) *Operand {
+		if operand == nil {
+			return nil
+		}
+		if argument, exists := substitutions[operand.variable]; exists && operand.kind == OperandVariable {
+			copied := *argument
+			return &copied
+		}
+		copied := *operand
+		switch operand.kind {
+		case OperandVariable:
+			copied.variable = rename(operand.variable)
+		case OperandLabel:
+			if target, exists := labels[operand.label]; exists {
+				copied.label = target
+			}
+		}
+		return &copied
+	}
+
+	singleBlock := len(callee.basicBlocks) == 1 && len(callee.basicBlocks[0].successors) == 0
+	var cont *BasicBlock
+	if !singleBlock {
+		cont = &BasicBlock{id: call.id + ".cont", frequency: block.frequency}
+	}
+	cloned := make(map[*Instruction]*Instruction)
+	for _, calleeBlock := range callee.basicBlocks {
+		target := clones[calleeBlock]
+		for _, inst := range calleeBlock.instructions {
+			if inst.opcode == OpReturn {
+				if call.result != nil && len(inst.operands) > 0 {
+					target.instructions = append(target.instructions, assignmentFrom(call.id+"."+inst.id, rewrite(inst.operands[0]), call.result))
+				}
+				if cont != nil {
+					target.instructions = append(target.instructions, &Instruction{id: call.id + "." + inst.id + ".jmp", opcode: OpBranch,
+						operands: []*Operand{{kind: OperandLabel, label: cont.id}}})
+					target.successors = []*BasicBlock{cont}
+				}
+				break
+			}
+			clone := &Instruction{id: call.id + "." + inst.id, opcode: inst.opcode, result: rename(inst.result), metadata: inst.metadata}
+			for _, operand := range inst.operands {
+				clone.operands = append(clone.operands, rewrite(operand))
+			}
+			cloned[inst] = clone
+			target.instructions = append(target.instructions, clone)
+		}
+		if len(target.successors) == 0 {
+			for _, successor := range calleeBlock.successors {
+				target.successors = append(target.successors, clones[successor])
+			}
+		}
+	}
+
+	var inserted []*Instruction
+	if singleBlock {
+		body := clones[callee.basicBlocks[0]]
+		inserted = append(prologue, body.instructions...)
+		for _, inst := range inserted {
+			inst.block = block
+		}
+		instructions := make([]*Instruction, 0, len(block.instructions)-1+len(inserted))
+		instructions = append(instructions, block.instructions[:index]...)
+		instructions = append(instructions, inserted...)
+		block.instructions = append(instructions, block.instructions[index+1:]...)
+	} else {
+		it.splice(function, block, index, cont, prologue, callee, clones)
+		inserted = append(inserted, block.instructions[index:]...)
+		for _, calleeBlock := range callee.basicBlocks {
+			inserted = append(inserted, clones[calleeBlock].instructions...)
+		}
+	}
+
+	if len(function.instructions) > 0 {
+		flat := make([]*Instruction, 0, len(function.instructions)+len(inserted))
+		for _, inst := range function.instructions {
+			if inst == call {
+				flat = append(flat, inserted...)
+			} else {
+				flat = append(flat, inst)
+			}
+		}
+		function.instructions = flat
+	}
+	updateCallGraphAfterInlining(function.callGraph, edge, cloned)
+	if callee.metadata != nil {
+		callee.metadata.inlined = true
+	}
+	return true
+}
+
+// splice 在index处拆分block：调用点之后的指令和原有后继交给续块cont，block跳往被调函数入口的副本
+func (it *InliningTransformer) splice(function *Function, block *BasicBlock, index int, cont *BasicBlock,
+	prologue []*Instruction, callee *Function, clones map[*BasicBlock]*BasicBlock) {
+	entry := clones[callee.basicBlocks[0]]
+
+	cont.instructions = append([]*Instruction(nil), block.instructions[index+1:]...)
+	cont.successors = block.successors
+	for _, inst := range cont.instructions {
+		inst.block = cont
+	}
+	for _, successor := range cont.successors {
+		for i, predecessor := range successor.predecessors {
+			if predecessor == block {
+				successor.predecessors[i] = cont
+			}
+		}
+	}
+
+	jump := &Instruction{id: entry.id + ".jmp", opcode: OpBranch, operands: []*Operand{{kind: OperandLabel, label: entry.id}}}
+	instructions := append(append(block.instructions[:index:index], prologue...), jump)
+	for _, inst := range instructions[index:] {
+		inst.block = block
+	}
+	block.instructions = instructions
+	block.successors = []*BasicBlock{entry}
+
+	added := []*BasicBlock{}
+	for _, calleeBlock := range callee.basicBlocks {
+		clone := clones[calleeBlock]
+		for _, inst := range clone.instructions {
+			inst.block = clone
+		}
+		added = append(added, clone)
+	}
+	added = append(added, cont)
+	entry.predecessors = append(entry.predecessors, block)
+	for _, clone := range added {
+		for _, successor := range clone.successors {
+			successor.predecessors = append(successor.predecessors, clone)
+		}
+	}
+
+	insertAfter := func(blocks []*BasicBlock) []*BasicBlock {
+		inserted := make([]*BasicBlock, 0, len(blocks)+len(added))
+		for _, candidate := range blocks {
+			inserted = append(inserted, candidate)
+			if candidate == block {
+				inserted = append(inserted, added...)
+			}
+		}
+		return inserted
+	}
+	function.basicBlocks = insertAfter(function.basicBlocks)
+	if cfg := function.cfg; cfg != nil {
+		cfg.blocks = insertAfter(cfg.blocks)
+		if len(cfg.edges) > 0 {
+			for _, edge := range cfg.edges {
+				if edge.source == block {
+					edge.source = cont
+				}
+			}
+			cfg.edges = append(cfg.edges, &CFGEdge{source: block, target: entry, kind: EdgeUnconditional})
+			for _, clone := range added[:len(added)-1] {
+				for _, successor := range clone.successors {
+					cfg.edges = append(cfg.edges, &CFGEdge{source: clone, target: successor, kind: EdgeConditional})
+				}
+			}
+		}
+	}
+}
+
+// assignmentFrom 把操作数赋给变量：常量用OpConst，变量用OpCopy
+func assignmentFrom(id string, operand *Operand, result *Variable) *Instruction {
+	copied := *operand
+	opcode := OpCopy
+	if operand.kind == OperandConstant {
+		opcode = OpConst
+	}
+	return &Instruction{id: id, opcode: opcode, operands: []*Operand{&copied}, result: result}
+}
+
+// findInstruction 返回指令所在的基本块及其下标
+func findInstruction(function *Function, inst *Instruction) (*BasicBlock, int) {
+	for _, block := range function.basicBlocks {
+		for i, candidate := range block.instructions {
+			if candidate == inst {
+				return block, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+// functionSize 函数的指令总数
+func functionSize(function *Function) int {
+	size := 0
+	for _, block := range function.basicBlocks {
+		size += len(block.instructions)
+	}
+	return size
+}
+
+// isRecursiveCallee 被调函数标记为递归，或在调用图中能经由调用边回到自身
+func isRecursiveCallee(graph *CallGraph, node *CallNode) bool {
+	if node.function != nil && node.function.metadata != nil && node.function.metadata.recursive {
+		return true
+	}
+	callees := make(map[*CallNode][]*CallNode)
+	for _, edge := range graph.edges {
+		callees[edge.caller] = append(callees[edge.caller], edge.callee)
+	}
+	visited := make(map[*CallNode]bool)
+	worklist := []*CallNode{node}
+	for len(worklist) > 0 {
+		current := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		for _, callee := range append(append([]*CallNode(nil), current.callees...), callees[current]...) {
+			if callee == node {
+				return true
+			}
+			if !visited[callee] {
+				visited[callee] = true
+				worklist = append(worklist, callee)
+			}
+		}
+	}
+	return false
+}
+
+// updateCallGraphAfterInlining 删除已内联的调用边，被调函数体内的调用点以副本重新挂到调用者上
+func updateCallGraphAfterInlining(graph *CallGraph, inlined *CallEdge, cloned map[*Instruction]*Instruction) {
+	edges := make([]*CallEdge, 0, len(graph.edges))
+	var added []*CallEdge
+	for _, edge := range graph.edges {
+		if edge == inlined {
+			continue
+		}
+		if clone, exists := cloned[edge.callSite]; exists && edge.caller == inlined.callee {
+			added = append(added, &CallEdge{caller: inlined.caller, callee: edge.callee, callSite: clone})
+		}
+		edges = append(edges, edge)
+	}
+	graph.edges = append(edges, added...)
+
+	linked := func(caller, callee *CallNode) bool {
+		for _, edge := range graph.edges {
+			if edge.caller == caller && edge.callee == callee {
+				return true
+			}
+		}
+		return false
+	}
+	for _, edge := range added {
+		if !containsCallNode(edge.caller.callees, edge.callee) {
+			edge.caller.callees = append(edge.caller.callees, edge.callee)
+		}
+		if !containsCallNode(edge.callee.callers, edge.caller) {
+			edge.callee.callers = append(edge.callee.callers, edge.caller)
+		}
+	}
+	if !linked(inlined.caller, inlined.callee) {
+		inlined.caller.callees = removeCallNode(inlined.caller.callees, inlined.callee)
+		inlined.callee.callers = removeCallNode(inlined.callee.callers, inlined.caller)
+	}
+}
+
+func containsCallNode(nodes []*CallNode, node *CallNode) bool {
+	for _, candidate := range nodes {
+		if candidate == node {
+			return true
+		}
+	}
+	return false
+}
+
+func removeCallNode(nodes []*CallNode, node *CallNode) []*CallNode {
+	kept := make([]*CallNode, 0, len(nodes))
+	for _, candidate := range nodes {
+		if candidate != node {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept
+}
+
+// 窥孔优化
+
+// defaultPeepholeWindow 规则默认可以查看的指令数，包括被改写的指令本身
+const defaultPeepholeWindow = 8
+
+// PeepholeRule 窥孔改写规则。Rewrite收到同一基本块内以待改写指令结尾的指令窗口，以及所在函数中
+// 取过地址的变量（对它们的定义可能改变经指针读取的内存）。匹配时返回替换它的指令，
+// 只取其操作码和操作数，结果变量保持不变
+type PeepholeRule struct {
+	Name    string
+	Rewrite func(window []*Instruction, addressTaken map[*Variable]bool) (*Instruction, bool)
+}
+
+// PeepholeTransformer 按注册顺序对每条指令尝试改写规则，直到没有规则匹配
+type PeepholeTransformer struct {
+	rules  []PeepholeRule
+	window int
+}
+
+// NewPeepholeTransformer 创建带有内置规则的窥孔优化器
+func NewPeepholeTransformer() *PeepholeTransformer {
+	return &PeepholeTransformer{
+		rules: []PeepholeRule{
+			{Name: "mul_by_one", Rewrite: rewriteIdentity(OpMul, 1)},
+			{Name: "add_zero", Rewrite: rewriteIdentity(OpAdd, 0)},
+			{Name: "mul_by_two", Rewrite: rewriteMulByTwo},
+			{Name: "double_negation", Rewrite: rewriteDoubleNegation},
+			{Name: "store_to_load_forwarding", Rewrite: rewriteStoreToLoad},
+		},
+		window: defaultPeepholeWindow,
+	}
+}
+
+// RegisterRule 添加自定义规则，排在已有规则之后；同名规则被替换
+func (pt *PeepholeTransformer) RegisterRule(rule PeepholeRule) error {
+	if rule.Name == "" || rule.Rewrite == nil {
+		return fmt.Errorf("peephole rule requires a name and a rewrite function")
+	}
+	for i, existing := range pt.rules {
+		if existing.Name == rule.Name {
+			pt.rules[i] = rule
+			return nil
+		}
+	}
+	pt.rules = append(pt.rules, rule)
+	return nil
+}
+
+// SetWindow 设置规则可以查看的指令数
+func (pt *PeepholeTransformer) SetWindow(size int) {
+	pt.window = max(size, 1)
+}
+
+func (pt *PeepholeTransformer) Transform(context *OptimizationContext) (*TransformationResult, error) {
+	result := &TransformationResult{
+		passID:    "peephole",
+		success:   true,
+		metrics:   make(map[string]float64),
+		timestamp: time.Now(),
+	}
+	if context.function == nil {
+		return result, nil
+	}
+
+	addressTaken := make(map[*Variable]bool)
+	for _, variable := range addressTakenVariables(context.function) {
+		addressTaken[variable] = true
+	}
+	rewrites := 0
+	for _, block := range context.function.basicBlocks {
+		for i, inst := range block.instructions {
+			window := block.instructions[max(0, i+1-pt.window) : i+1]
+			// 改写次数以规则数为上限，避免互为逆变换的自定义规则无限改写
+			for range pt.rules {
+				rule, replacement, ok := pt.match(window, addressTaken)
+				if !ok {
+					break
+				}
+				inst.opcode = replacement.opcode
+				inst.operands = replacement.operands
+				result.metrics["rule:"+rule]++
+				rewrites++
+			}
+		}
+	}
+
+	result.changed = rewrites > 0
+	result.metrics["rewrites"] = float64(rewrites)
+	return result, nil
+}
+
+// match 返回第一条匹配窗口的规则及替换指令
+func (pt *PeepholeTransformer) match(window []*Instruction, addressTaken map[*Variable]bool) (string, *Instruction, bool) {
+	for _, rule := range pt.rules {
+		if replacement, ok := rule.Rewrite(window, addressTaken); ok {
+			return rule.Name, replacement, true
+		}
+	}
+	return "", nil, false
+}
+
+func (pt *PeepholeTransformer) CanTransform(context *OptimizationContext) bool {
+	return context.function != nil
+}
+
+func (pt *PeepholeTransformer) EstimateCost(context *OptimizationContext) float64 {
+	if context.function == nil {
+		return 0
+	}
+	count := 0
+	for _, block := range context.function.basicBlocks {
+		count += len(block.instructions)
+	}
+	return float64(count)
+}
+
+// rewriteIdentity 把与单位元运算的整数指令（x op identity或identity op x）改写为复制另一个操作数
+func rewriteIdentity(opcode Opcode, identity int64) func([]*Instruction, map[*Variable]bool) (*Instruction, bool) {
+	return func(window []*Instruction, _ map[*Variable]bool) (*Instruction, bool) {
+		inst := window[len(window)-1]
+		if inst.opcode != opcode || inst.result == nil || len(inst.operands) != 2 {
+			return nil, false
+		}
+		for i, operand := range inst.operands {
+			other := inst.operands[1-i]
+			if isIntegerConstant(operand, identity) && other != nil && other.kind != OperandLabel {
+				return assignmentFrom(inst.id, other, inst.result), true
+			}
+		}
+		return nil, false
+	}
+}
+
+// rewriteMulByTwo 把整数x*2改写为x<<1，移位量与常量2同类型。结果不是整数类型时不改写，
+// 浮点数不能移位
+func rewriteMulByTwo(window []*Instruction, _ map[*Variable]bool) (*Instruction, bool) {
+	inst := window[len(window)-1]
+	if inst.opcode != OpMul || inst.result == nil || len(inst.operands) != 2 || !isIntegerVariable(inst.result) {
+		return nil, false
+	}
+	for i, operand := range inst.operands {
+		other := inst.operands[1-i]
+		if isIntegerConstant(operand, 2) && other != nil && other.kind == OperandVariable && isIntegerVariable(other.variable) {
+			shift := &Operand{kind: OperandConstant, constant: integerLike(operand.constant, 1)}
+			return &Instruction{opcode: OpShl, operands: []*Operand{other, shift}}, true
+		}
+	}
+	return nil, false
+}
+
+// rewriteDoubleNegation 把z = -y（y = -x在窗口内定义）改写为复制x，x在两次取负之间不能被重新定义
+func rewriteDoubleNegation(window []*Instruction, _ map[*Variable]bool) (*Instruction, bool) {
+	inst := window[len(window)-1]
+	if inst.opcode != OpNeg || inst.result == nil || len(inst.operands) != 1 ||
+		inst.operands[0] == nil || inst.operands[0].kind != OperandVariable {
+		return nil, false
+	}
+	negated := inst.operands[0].variable
+
+	redefined := make(map[*Variable]bool)
+	for i := len(window) - 2; i >= 0; i-- {
+		candidate := window[i]
+		if candidate.result != negated {
+			if candidate.result != nil {
+				redefined[candidate.result] = true
+			}
+			continue
+		}
+		if candidate.opcode != OpNeg || len(candidate.operands) != 1 || candidate.operands[0] == nil {
+			return nil, false
+		}
+		source := candidate.operands[0]
+		if source.kind == OperandLabel || (source.kind == OperandVariable && redefined[source.variable]) {
+			return nil, false
+		}
+		return assignmentFrom(inst.id, source, inst.result), true
+	}
+	return nil, false
+}
+
+// rewriteStoreToLoad 把读取窗口内刚写入地址的OpLoad改写为复制写入的值。中间的调用、
+// 写入其他地址（可能别名）、重新定义地址或值变量、定义取过地址的变量（地址可能指向它）都会阻止转发
+func rewriteStoreToLoad(window []*Instruction, addressTaken map[*Variable]bool) (*Instruction, bool) {
+	inst := window[len(window)-1]
+	if inst.opcode != OpLoad || inst.result == nil || len(inst.operands) != 1 ||
+		inst.operands[0] == nil || inst.operands[0].kind != OperandVariable {
+		return nil, false
+	}
+	address := inst.operands[0].variable
+
+	redefined := make(map[*Variable]bool)
+	for i := len(window) - 2; i >= 0; i-- {
+		candidate := window[i]
+		switch {
+		case candidate.result == address, candidate.opcode == OpCall, addressTaken[candidate.result]:
+			return nil, false
+		case candidate.opcode == OpStore:
+			if len(candidate.operands) != 2 || candidate.operands[0] == nil || candidate.operands[1] == nil ||
+				candidate.operands[0].kind != OperandVariable || candidate.operands[0].variable != address {
+				return nil, false
+			}
+			value := candidate.operands[1]
+			if value.kind == OperandLabel || (value.kind == OperandVariable && redefined[value.variable]) {
+				return nil, false
+			}
+			return assignmentFrom(inst.id, value, inst.result), true
+		}
+		if candidate.result != nil {
+			redefined[candidate.result] = true
+		}
+	}
+	return nil, false
+}
+
+// isIntegerVariable 判断变量是否声明为整数类型，类型未知时视为不是
+func isIntegerVariable(variable *Variable) bool {
+	return variable != nil && variable.varType != nil && variable.varType.kind == TypeInt
+}
+
+// isIntegerConstant 判断操作数是否为等于value的整数常量
+func isIntegerConstant(operand *Operand, value int64) bool {
+	if operand == nil || operand.kind != OperandConstant {
+		return false
+	}
+	n, ok := constantInteger(operand.constant)
+	return ok && n == value
+}
+
+// integerLike 返回与like同类型的整数常量n
+func integerLike(like interface{}, n int64) interface{} {
+	switch like.(type) {
+	case int8:
+		return int8(n)
+	case int16:
+		return int16(n)
+	case int32:
+		return int32(n)
+	case int64:
+		return n
+	}
+	return int(n)
 }
 
 // main函数演示优化引擎的使用
@@ -0,0 +1,3170 @@
+/*
+=== 代码优化模块测试 ===
+
+测试优化过程管理器：
+1. 过程注册校验
+2. 基于ROI的自适应调度
+3. 剖面引导优化
+4. 活跃变量分析
+5. 死代码消除
+6. 位集合操作
+7. 支配树
+8. 自然循环识别
+9. 拓扑过程调度
+10. 迭代至不动点
+11. 过程结果缓存
+12. 过程超时与取消
+13. 常量折叠
+14. 公共子表达式消除
+15. 常量传播
+16. 尾调用优化
+17. 跳转线程化
+18. 基本块合并
+19. 循环不变代码外提
+20. 循环展开
+21. 别名分析
+22. 函数内联
+23. 逃逸分析
+24. 优化报告序列化
+25. 窥孔优化
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubTransformer 不做任何变换的变换器，用于满足过程注册校验
+type stubTransformer struct{}
+
+func (stubTransformer) Transform(context *OptimizationContext) (*TransformationResult, error) {
+	return &TransformationResult{success: true}, nil
+}
+
+func (stubTransformer) CanTransform(context *OptimizationContext) bool { return true }
+
+func (stubTransformer) EstimateCost(context *OptimizationContext) float64 { return 0 }
+
+// newTestPass 创建一个可注册的优化过程
+func newTestPass(id string, dependencies ...string) *OptimizationPass {
+	return &OptimizationPass{
+		id:           id,
+		name:         id,
+		transformer:  stubTransformer{},
+		dependencies: dependencies,
+		enabled:      true,
+	}
+}
+
+// ==================
+// 1. 过程注册校验
+// ==================
+
+func TestRegisterPassRejectsDuplicateID(t *testing.T) {
+	pm := NewPassManager()
+	if err := pm.RegisterPass(newTestPass("dce")); err != nil {
+		t.Fatalf("首次注册失败: %v", err)
+	}
+
+	err := pm.RegisterPass(newTestPass("dce"))
+	if err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Fatalf("期望拒绝重复注册，实际为%v", err)
+	}
+	if len(pm.passes) != 1 || pm.statistics.PassesRegistered != 1 {
+		t.Errorf("重复注册不应改变过程列表，实际为%d个过程", len(pm.passes))
+	}
+}
+
+func TestRegisterPassRejectsInvalidReferences(t *testing.T) {
+	pm := NewPassManager()
+	for _, pass := range []*OptimizationPass{newTestPass("ssa"), newTestPass("loops", "ssa")} {
+		if err := pm.RegisterPass(pass); err != nil {
+			t.Fatalf("引用已注册过程的%s应注册成功: %v", pass.id, err)
+		}
+	}
+
+	pass := newTestPass("licm", "loops", "loop_analysis", "licm")
+	pass.conflicts = []string{"unroll", "licm"}
+	err := pm.RegisterPass(pass)
+	var validationErr *PassValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("期望返回*PassValidationError，实际为%v", err)
+	}
+	expected := []string{
+		`pass "licm" lists itself as a dependency`,
+		`pass "licm" lists itself as a conflict`,
+		`pass "licm" depends on unregistered pass "loop_analysis"`,
+		`pass "licm" conflicts with unregistered pass "unroll"`,
+	}
+	if !reflect.DeepEqual(validationErr.Problems, expected) {
+		t.Errorf("期望汇总%v，实际为%v", expected, validationErr.Problems)
+	}
+	if _, exists := pm.dependencies.nodes["licm"]; exists || len(pm.passes) != 2 {
+		t.Error("校验失败的过程不应注册")
+	}
+
+	// 基本字段问题同样汇总
+	err = pm.RegisterPass(&OptimizationPass{id: "empty"})
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 2 {
+		t.Errorf("期望汇总名称和变换器两个问题，实际为%v", err)
+	}
+}
+
+func TestValidateReportsDanglingReferences(t *testing.T) {
+	pm := NewPassManager()
+	pm.config.AllowForwardReferences = true
+	pass := newTestPass("licm", "loop_analysis")
+	pass.conflicts = []string{"unroll"}
+	pass.prerequisites = []PassPrerequisite{{passID: "ssa_construction", required: true}}
+	if err := pm.RegisterPass(pass); err != nil {
+		t.Fatalf("注册失败: %v", err)
+	}
+
+	err := pm.Validate()
+	var validationErr *PassValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("期望返回*PassValidationError，实际为%v", err)
+	}
+	if len(validationErr.Problems) != 3 {
+		t.Fatalf("期望汇总3个问题，实际为%v", validationErr.Problems)
+	}
+	for _, missing := range []string{"loop_analysis", "unroll", "ssa_construction"} {
+		if !strings.Contains(err.Error(), missing) {
+			t.Errorf("诊断信息应包含%q: %v", missing, err)
+		}
+	}
+
+	// 补齐引用后校验通过
+	for _, id := range []string{"loop_analysis", "unroll", "ssa_construction"} {
+		if err := pm.RegisterPass(newTestPass(id)); err != nil {
+			t.Fatalf("注册%s失败: %v", id, err)
+		}
+	}
+	if err := pm.Validate(); err != nil {
+		t.Errorf("期望校验通过，实际为%v", err)
+	}
+}
+
+func TestValidateDetectsDependencyCycle(t *testing.T) {
+	pm := NewPassManager()
+	pm.config.AllowForwardReferences = true
+	for _, pass := range []*OptimizationPass{
+		newTestPass("a", "b"),
+		newTestPass("b", "c"),
+		newTestPass("c", "a"),
+		newTestPass("d", "a"),
+	} {
+		if err := pm.RegisterPass(pass); err != nil {
+			t.Fatalf("注册失败: %v", err)
+		}
+	}
+
+	err := pm.Validate()
+	if err == nil || !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Fatalf("期望报告依赖环a -> b -> c -> a，实际为%v", err)
+	}
+
+	result := pm.ExecutePipeline(nil)
+	if result.Error == nil || len(result.Results) != 0 {
+		t.Errorf("校验失败时不应执行任何过程，实际为%v %v", result.Error, result.Results)
+	}
+}
+
+// ==================
+// 2. 基于ROI的自适应调度
+// ==================
+
+// stubCostModel 返回固定估算值的成本模型
+type stubCostModel struct {
+	complexity float64
+	speedup    float64
+	timeCost   time.Duration
+}
+
+func (m stubCostModel) EstimateCost(context *OptimizationContext) *CostEstimate {
+	return &CostEstimate{Complexity: m.complexity, TimeCost: m.timeCost}
+}
+
+func (m stubCostModel) EstimateBenefit(context *OptimizationContext) *BenefitEstimate {
+	return &BenefitEstimate{SpeedImprovement: m.speedup}
+}
+
+func (m stubCostModel) ComputeROI(cost *CostEstimate, benefit *BenefitEstimate) float64 {
+	return benefit.SpeedImprovement / cost.Complexity
+}
+
+// recordingTransformer 记录执行顺序，并按配置报告实际改进
+type recordingTransformer struct {
+	id          string
+	order       *[]string
+	improvement float64
+}
+
+func (rt recordingTransformer) Transform(context *OptimizationContext) (*TransformationResult, error) {
+	*rt.order = append(*rt.order, rt.id)
+	return &TransformationResult{
+		success:      true,
+		changed:      true,
+		improvements: []Improvement{{improvement: rt.improvement}},
+	}, nil
+}
+
+func (rt recordingTransformer) CanTransform(context *OptimizationContext) bool { return true }
+
+func (rt recordingTransformer) EstimateCost(context *OptimizationContext) float64 { return 0 }
+
+func newAdaptiveTestPass(id string, order *[]string, model stubCostModel, improvement float64) *OptimizationPass {
+	pass := newTestPass(id)
+	pass.category = CategoryOptimization
+	pass.costModel = model
+	pass.transformer = recordingTransformer{id: id, order: order, improvement: improvement}
+	return pass
+}
+
+func newAdaptiveTestContext() *OptimizationContext {
+	return &OptimizationContext{
+		analysisResults: make(map[AnalysisKind]*AnalysisResult),
+		environment: &OptimizationEnvironment{
+			settings: map[string]interface{}{"optimization_level": OptLevelAggressive},
+		},
+	}
+}
+
+func TestAdaptiveSchedulingSkipsLowROIPass(t *testing.T) {
+	var order []string
+	pm := NewPassManager()
+	pm.config.AdaptiveScheduling = true
+	pm.config.MinROI = 1.0
+
+	// 低ROI过程先注册，高ROI过程应被优先执行
+	pm.RegisterPass(newAdaptiveTestPass("expensive", &order, stubCostModel{complexity: 10, speedup: 1}, 1))
+	pm.RegisterPass(newAdaptiveTestPass("cheap", &order, stubCostModel{complexity: 1, speedup: 2}, 2))
+	pm.RegisterPass(newAdaptiveTestPass("medium", &order, stubCostModel{complexity: 1, speedup: 1.5}, 1.5))
+
+	result := pm.ExecutePipeline(newAdaptiveTestContext())
+	if result.Error != nil {
+		t.Fatalf("管道执行失败: %v", result.Error)
+	}
+	if strings.Join(order, ",") != "cheap,medium" {
+		t.Errorf("期望按ROI顺序执行cheap,medium，实际为%v", order)
+	}
+	if _, ran := result.Results["expensive"]; ran {
+		t.Error("低ROI过程不应被执行")
+	}
+	if reason := result.Skipped["expensive"]; !strings.Contains(reason, "below threshold") {
+		t.Errorf("期望记录跳过原因，实际为%q", reason)
+	}
+}
+
+func TestAdaptiveSchedulingCalibratesFromActualBenefit(t *testing.T) {
+	var order []string
+	pm := NewPassManager()
+	pm.config.AdaptiveScheduling = true
+	pm.config.MinROI = 1.0
+
+	// first预测收益为4但实际只有1，同类过程的ROI随之按1/4校准
+	pm.RegisterPass(newAdaptiveTestPass("first", &order, stubCostModel{complexity: 1, speedup: 4}, 1))
+	pm.RegisterPass(newAdaptiveTestPass("second", &order, stubCostModel{complexity: 1, speedup: 3}, 3))
+
+	result := pm.ExecutePipeline(newAdaptiveTestContext())
+	if strings.Join(order, ",") != "first" {
+		t.Errorf("期望只执行first，实际为%v", order)
+	}
+	if reason := result.Skipped["second"]; !strings.Contains(reason, "ROI 0.75") {
+		t.Errorf("期望second按校准后的ROI 0.75被跳过，实际为%q", reason)
+	}
+}
+
+func TestAdaptiveSchedulingKeepsMeasuringZeroBenefitCategory(t *testing.T) {
+	var order []string
+	pm := NewPassManager()
+	pm.config.AdaptiveScheduling = true
+	pm.config.MinROI = 1.0
+
+	// first没有带来实际收益，校准系数取下限而不是0，预测收益足够高的同类过程仍会执行
+	pm.RegisterPass(newAdaptiveTestPass("first", &order, stubCostModel{complexity: 1, speedup: 30}, 0))
+	pm.RegisterPass(newAdaptiveTestPass("second", &order, stubCostModel{complexity: 1, speedup: 20}, 20))
+	pm.RegisterPass(newAdaptiveTestPass("third", &order, stubCostModel{complexity: 1, speedup: 5}, 5))
+
+	result := pm.ExecutePipeline(newAdaptiveTestContext())
+	if strings.Join(order, ",") != "first,second,third" {
+		t.Errorf("期望三个过程都被执行，实际为%v", order)
+	}
+	if len(result.Skipped) != 0 {
+		t.Errorf("不应跳过任何过程，实际为%v", result.Skipped)
+	}
+}
+
+func TestAdaptiveSchedulingRespectsBudgetAndDependencies(t *testing.T) {
+	var order []string
+	pm := NewPassManager()
+	pm.config.AdaptiveScheduling = true
+	pm.config.TimeBudget = time.Second
+
+	slow := newAdaptiveTestPass("slow", &order, stubCostModel{complexity: 1, speedup: 5, timeCost: time.Minute}, 5)
+	dependent := newAdaptiveTestPass("dependent", &order, stubCostModel{complexity: 1, speedup: 5}, 5)
+	dependent.dependencies = []string{"slow"}
+	fast := newAdaptiveTestPass("fast", &order, stubCostModel{complexity: 1, speedup: 2}, 2)
+	for _, pass := range []*OptimizationPass{slow, dependent, fast} {
+		if err := pm.RegisterPass(pass); err != nil {
+			t.Fatalf("注册失败: %v", err)
+		}
+	}
+
+	result := pm.ExecutePipeline(newAdaptiveTestContext())
+	if strings.Join(order, ",") != "fast" {
+		t.Errorf("期望只执行fast，实际为%v", order)
+	}
+	if !strings.Contains(result.Skipped["slow"], "time") {
+		t.Errorf("slow应因时间预算被跳过，实际为%q", result.Skipped["slow"])
+	}
+	if !strings.Contains(result.Skipped["dependent"], "slow") {
+		t.Errorf("dependent应因依赖未执行被跳过，实际为%q", result.Skipped["dependent"])
+	}
+}
+
+// ==================
+// 3. 剖面引导优化
+// ==================
+
+// newBranchTestFunction 构造entry分支到error(直接返回)与work两条路径的函数
+func newBranchTestFunction() *Function {
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{{opcode: OpBranch}}}
+	work := &BasicBlock{id: "work", instructions: []*Instruction{{opcode: OpAdd}}}
+	errorBlock := &BasicBlock{id: "error", instructions: []*Instruction{{opcode: OpReturn}}}
+	exit := &BasicBlock{id: "exit", instructions: []*Instruction{{opcode: OpReturn}}}
+	entry.successors = []*BasicBlock{errorBlock, work}
+	work.successors = []*BasicBlock{exit}
+
+	return &Function{name: "f", basicBlocks: []*BasicBlock{entry, work, errorBlock, exit}}
+}
+
+func blockIDs(blocks []*BasicBlock) []string {
+	ids := make([]string, len(blocks))
+	for i, block := range blocks {
+		ids[i] = block.id
+	}
+	return ids
+}
+
+func TestLoadProfileParsesSamples(t *testing.T) {
+	profile, err := LoadProfile(strings.NewReader(`
+# function block count
+f entry 100
+f entry->error 60
+f entry->error 39
+f entry->work 1
+`))
+	if err != nil {
+		t.Fatalf("解析剖面失败: %v", err)
+	}
+	if count, ok := profile.BlockCount("f", "entry"); !ok || count != 100 {
+		t.Errorf("期望entry执行100次，实际为%d", count)
+	}
+	if probability, ok := profile.BranchProbability("f", "entry", "error"); !ok || probability != 0.99 {
+		t.Errorf("期望重复样本累加后概率为0.99，实际为%v", probability)
+	}
+	if _, ok := profile.BranchProbability("g", "entry", "error"); ok {
+		t.Error("没有剖面的函数不应返回实测概率")
+	}
+
+	for _, input := range []string{"f entry", "f entry many", "f ->work 1"} {
+		if _, err := LoadProfile(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("期望%q报告第1行解析错误，实际为%v", input, err)
+		}
+	}
+}
+
+func TestProfileDrivesBlockLayout(t *testing.T) {
+	// 静态启发式认为直接返回的error路径不太可能执行
+	static := newBranchTestFunction()
+	NewBranchOptimizer().Optimize(static)
+	if got := blockIDs(static.basicBlocks); !reflect.DeepEqual(got, []string{"entry", "work", "exit", "error"}) {
+		t.Errorf("静态布局期望entry,work,exit,error，实际为%v", got)
+	}
+
+	profile, err := LoadProfile(strings.NewReader(`
+f entry 100
+f entry->error 99
+f entry->work 1
+f error 99
+f work 1
+f exit 1
+`))
+	if err != nil {
+		t.Fatalf("解析剖面失败: %v", err)
+	}
+
+	function := newBranchTestFunction()
+	context := &OptimizationContext{function: function}
+	context.AttachProfile(profile)
+	if function.basicBlocks[2].frequency != 0.99 {
+		t.Errorf("期望error块频率为0.99，实际为%v", function.basicBlocks[2].frequency)
+	}
+
+	cfo := NewControlFlowOptimizer()
+	cfo.config.EnableBranchOptimization = true
+	result := cfo.OptimizeControlFlow(context)
+	if got := blockIDs(function.basicBlocks); !reflect.DeepEqual(got, []string{"entry", "error", "work", "exit"}) {
+		t.Errorf("剖面布局期望entry,error,work,exit，实际为%v", got)
+	}
+	if !result.optimized || cfo.statistics.BranchesOptimized != 1 {
+		t.Errorf("期望重排1个分支，实际为%d", cfo.statistics.BranchesOptimized)
+	}
+}
+
+func TestBranchOptimizerLoadProfileMakesHotEdgeFallthrough(t *testing.T) {
+	bo := NewBranchOptimizer()
+	if err := bo.LoadProfile(strings.NewReader("f entry->error 50\n")); err != nil {
+		t.Fatalf("解析剖面失败: %v", err)
+	}
+	// 多次加载的样本累加：error边共80次，work边20次
+	if err := bo.LoadProfile(strings.NewReader("f entry->error 30\nf entry->work 20\n")); err != nil {
+		t.Fatalf("解析剖面失败: %v", err)
+	}
+	if err := bo.LoadProfile(strings.NewReader("f entry->work many\n")); err == nil {
+		t.Fatal("期望格式错误的剖面加载失败")
+	}
+
+	function := newBranchTestFunction()
+	entry, errorBlock := function.basicBlocks[0], function.basicBlocks[2]
+	if probability := bo.BranchProbability(function, entry, errorBlock); probability != 0.8 {
+		t.Errorf("期望实测概率0.8且不受失败加载影响，实际为%v", probability)
+	}
+	bo.Optimize(function)
+	if got := blockIDs(function.basicBlocks); !reflect.DeepEqual(got, []string{"entry", "error", "work", "exit"}) {
+		t.Errorf("热边应成为顺序落空路径，实际布局为%v", got)
+	}
+
+	// 剖面中没有的函数回退到静态启发式
+	other := newBranchTestFunction()
+	other.name = "g"
+	bo.Optimize(other)
+	if got := blockIDs(other.basicBlocks); !reflect.DeepEqual(got, []string{"entry", "work", "exit", "error"}) {
+		t.Errorf("无剖面时应使用静态布局，实际为%v", got)
+	}
+}
+
+func TestProfilePrioritizesHotLoopsAndCallSites(t *testing.T) {
+	function := newBranchTestFunction()
+	entry, work, errorBlock := function.basicBlocks[0], function.basicBlocks[1], function.basicBlocks[2]
+	function.loopInfo = &LoopInfo{loops: []*Loop{
+		{id: "cold", header: work},
+		{id: "never", header: function.basicBlocks[3]},
+		{id: "hot", header: errorBlock},
+	}}
+	function.callGraph = &CallGraph{edges: []*CallEdge{
+		{callSite: &Instruction{id: "call-cold", opcode: OpCall, block: work}},
+		{callSite: &Instruction{id: "call-hot", opcode: OpCall, block: errorBlock}},
+		{callSite: &Instruction{id: "call-entry", opcode: OpCall, block: entry}},
+	}}
+
+	profile, err := LoadProfile(strings.NewReader("f entry 10\nf work 5\nf error 80\n"))
+	if err != nil {
+		t.Fatalf("解析剖面失败: %v", err)
+	}
+	context := &OptimizationContext{function: function}
+	context.AttachProfile(profile)
+
+	lo := NewLoopOptimizer()
+	lo.config.EnableVectorization = true
+	var loops []string
+	for _, result := range lo.OptimizeLoops(context) {
+		loops = append(loops, result.loop.id)
+	}
+	if !reflect.DeepEqual(loops, []string{"hot", "cold"}) {
+		t.Errorf("期望按热度优化hot,cold并跳过未执行循环，实际为%v", loops)
+	}
+
+	var callSites []string
+	for _, edge := range NewFunctionOptimizer().PrioritizeCallSites(context) {
+		callSites = append(callSites, edge.callSite.id)
+	}
+	if !reflect.DeepEqual(callSites, []string{"call-hot", "call-entry", "call-cold"}) {
+		t.Errorf("期望热调用点优先，实际为%v", callSites)
+	}
+}
+
+// ==================
+// 4. 活跃变量分析
+// ==================
+
+func varOperand(variable *Variable) *Operand {
+	return &Operand{kind: OperandVariable, variable: variable}
+}
+
+func constOperand(value interface{}) *Operand {
+	return &Operand{kind: OperandConstant, constant: value}
+}
+
+func variableNames(variables []*Variable) []string {
+	names := make([]string, 0, len(variables))
+	for _, variable := range variables {
+		names = append(names, variable.name)
+	}
+	return names
+}
+
+func TestLivenessAnalysisOnLoop(t *testing.T) {
+	// entry: a = load; b = load
+	// loop:  c = a + b; a = c + 1; 回到loop或进入exit
+	// exit:  return c
+	a, b, c := &Variable{name: "a"}, &Variable{name: "b"}, &Variable{name: "c"}
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{opcode: OpLoad, result: a},
+		{opcode: OpLoad, result: b},
+	}}
+	loop := &BasicBlock{id: "loop", instructions: []*Instruction{
+		{opcode: OpAdd, operands: []*Operand{varOperand(a), varOperand(b)}, result: c},
+		{opcode: OpAdd, operands: []*Operand{varOperand(c), constOperand(1)}, result: a},
+		{opcode: OpBranch},
+	}}
+	exit := &BasicBlock{id: "exit", instructions: []*Instruction{
+		{opcode: OpReturn, operands: []*Operand{varOperand(c)}},
+	}}
+	entry.successors = []*BasicBlock{loop}
+	loop.successors = []*BasicBlock{loop, exit}
+	function := &Function{name: "loop", basicBlocks: []*BasicBlock{entry, loop, exit}}
+
+	dfa := NewDataFlowAnalyzer()
+	result := dfa.AnalyzeDataFlow(&OptimizationContext{function: function}, DataFlowLiveness)
+	liveness, ok := result.results["liveness"].(*LivenessResult)
+	if !ok {
+		t.Fatalf("期望得到*LivenessResult，实际为%T", result.results["liveness"])
+	}
+
+	expected := []struct {
+		block   *BasicBlock
+		liveIn  []string
+		liveOut []string
+	}{
+		{entry, []string{}, []string{"a", "b"}},
+		{loop, []string{"a", "b"}, []string{"a", "b", "c"}},
+		{exit, []string{"c"}, []string{}},
+	}
+	for _, tt := range expected {
+		if got := variableNames(liveness.LiveIn(tt.block)); !reflect.DeepEqual(got, tt.liveIn) {
+			t.Errorf("%s入口活跃变量期望%v，实际为%v", tt.block.id, tt.liveIn, got)
+		}
+		if got := variableNames(liveness.LiveOut(tt.block)); !reflect.DeepEqual(got, tt.liveOut) {
+			t.Errorf("%s出口活跃变量期望%v，实际为%v", tt.block.id, tt.liveOut, got)
+		}
+	}
+	if !liveness.IsLiveOut(loop, c) || liveness.IsLiveOut(entry, c) {
+		t.Error("c应只在loop出口活跃")
+	}
+	if loop.liveIn == nil || !loop.liveIn.Test(0) {
+		t.Error("分析结果应写回基本块")
+	}
+
+	// 逆序遍历：第二轮传播回边，第三轮确认不动点
+	if result.iterations != 3 || dfa.statistics.IterationCount != 3 {
+		t.Errorf("期望迭代3轮，实际为%d", result.iterations)
+	}
+}
+
+// ==================
+// 5. 死代码消除
+// ==================
+
+// newDeadCodeTestFunction 构造包含活跃计算、无用纯计算、load与除法的函数
+func newDeadCodeTestFunction() *Function {
+	p, x, y, unused, loaded, quotient := &Variable{name: "p"}, &Variable{name: "x"}, &Variable{name: "y"},
+		&Variable{name: "unused"}, &Variable{name: "loaded"}, &Variable{name: "quotient"}
+	instructions := map[string]*Instruction{
+		"x":        {id: "x", opcode: OpAdd, operands: []*Operand{constOperand(1), constOperand(2)}, result: x},
+		"y":        {id: "y", opcode: OpMul, operands: []*Operand{varOperand(x), constOperand(3)}, result: y},
+		"unused":   {id: "unused", opcode: OpSub, operands: []*Operand{varOperand(x), constOperand(1)}, result: unused},
+		"chain":    {id: "chain", opcode: OpAdd, operands: []*Operand{varOperand(unused), constOperand(1)}, result: &Variable{name: "chain"}},
+		"load":     {id: "load", opcode: OpLoad, operands: []*Operand{varOperand(p)}, result: loaded},
+		"div":      {id: "div", opcode: OpDiv, operands: []*Operand{varOperand(x), constOperand(2)}, result: quotient},
+		"store":    {id: "store", opcode: OpStore, operands: []*Operand{varOperand(p), varOperand(y)}},
+		"return":   {id: "return", opcode: OpReturn},
+		"argument": {id: "argument", opcode: OpLoad, result: p},
+	}
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{
+		instructions["argument"], instructions["x"], instructions["y"], instructions["unused"], instructions["chain"],
+		instructions["load"], instructions["div"],
+	}}
+	exit := &BasicBlock{id: "exit", instructions: []*Instruction{instructions["store"], instructions["return"]}}
+	entry.successors = []*BasicBlock{exit}
+	return &Function{name: "dce", basicBlocks: []*BasicBlock{entry, exit}}
+}
+
+func instructionIDs(function *Function) []string {
+	var ids []string
+	for _, block := range function.basicBlocks {
+		for _, inst := range block.instructions {
+			ids = append(ids, inst.id)
+		}
+	}
+	return ids
+}
+
+func TestDeadCodeEliminationByStrategy(t *testing.T) {
+	tests := []struct {
+		strategy MarkingStrategy
+		kept     []string
+	}{
+		{MarkingConservative, []string{"argument", "x", "y", "load", "div", "store", "return"}},
+		{MarkingAdaptive, []string{"argument", "x", "y", "load", "store", "return"}},
+		{MarkingAggressive, []string{"argument", "x", "y", "store", "return"}},
+	}
+	for _, tt := range tests {
+		function := newDeadCodeTestFunction()
+		before := len(instructionIDs(function))
+		dce := NewDeadCodeEliminator()
+		dce.markingStrategy = tt.strategy
+
+		result := dce.Eliminate(function)
+		got := instructionIDs(function)
+		if !reflect.DeepEqual(got, tt.kept) {
+			t.Errorf("策略%d期望保留%v，实际为%v", tt.strategy, tt.kept, got)
+		}
+		if result.eliminatedCount != int64(before-len(tt.kept)) {
+			t.Errorf("策略%d期望删除%d条指令，实际为%d", tt.strategy, before-len(tt.kept), result.eliminatedCount)
+		}
+	}
+}
+
+func TestDeadCodeEliminationReportsThroughOptimizer(t *testing.T) {
+	function := newDeadCodeTestFunction()
+	cfo := NewControlFlowOptimizer()
+	cfo.config.EnableDeadCodeElimination = true
+	result := cfo.OptimizeControlFlow(&OptimizationContext{function: function})
+	if !result.optimized || cfo.statistics.DeadInstructionsRemoved != 2 {
+		t.Errorf("期望删除unused与chain两条指令，实际为%d", cfo.statistics.DeadInstructionsRemoved)
+	}
+
+	// 再次运行时已没有死代码
+	if again := NewDeadCodeEliminator().Eliminate(function); again.eliminatedCount != 0 {
+		t.Errorf("第二次消除不应再删除指令，实际为%d", again.eliminatedCount)
+	}
+}
+
+func TestDeadCodeEliminationKeepsAddressTakenDefinitions(t *testing.T) {
+	x, p, out, dead := &Variable{name: "x"}, &Variable{name: "p"}, &Variable{name: "out"}, &Variable{name: "dead"}
+	// p = &x; store out, p; x = 5（经out逃逸后由g读取，保留）; dead = 1（删除）; call g
+	block := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{id: "out", opcode: OpLoad, result: out},
+		{id: "p", opcode: OpAddr, operands: []*Operand{varOperand(x)}, result: p},
+		{id: "escape", opcode: OpStore, operands: []*Operand{varOperand(out), varOperand(p)}},
+		{id: "x", opcode: OpConst, operands: []*Operand{constOperand(int64(5))}, result: x},
+		{id: "dead", opcode: OpConst, operands: []*Operand{constOperand(int64(1))}, result: dead},
+		{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("g")}},
+	}}
+	function := &Function{name: "taken", basicBlocks: []*BasicBlock{block}}
+
+	dce := NewDeadCodeEliminator()
+	dce.markingStrategy = MarkingAggressive
+	dce.Eliminate(function)
+	if got := instructionIDs(function); !reflect.DeepEqual(got, []string{"out", "p", "escape", "x", "call"}) {
+		t.Errorf("取过地址的变量的定义应保留，实际为%v", got)
+	}
+}
+
+// ==================
+// 6. 位集合操作
+// ==================
+
+func newBitSetWith(size int, indices ...int) *BitSet {
+	bs := NewBitSet(size)
+	for _, i := range indices {
+		bs.Set(i)
+	}
+	return bs
+}
+
+func TestBitSetQueries(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     *BitSet
+		indices []int
+	}{
+		{"empty", NewBitSet(0), []int{}},
+		{"unset", NewBitSet(100), []int{}},
+		{"single", newBitSetWith(10, 3), []int{3}},
+		{"word-boundary", newBitSetWith(130, 0, 63, 64, 127, 128), []int{0, 63, 64, 127, 128}},
+		{"out-of-range-ignored", newBitSetWith(64, 5, 64, 200), []int{5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.set.ToSlice(); !reflect.DeepEqual(got, tt.indices) {
+				t.Errorf("ToSlice期望%v，实际为%v", tt.indices, got)
+			}
+			if tt.set.Count() != len(tt.indices) {
+				t.Errorf("Count期望%d，实际为%d", len(tt.indices), tt.set.Count())
+			}
+			if tt.set.IsEmpty() != (len(tt.indices) == 0) {
+				t.Errorf("IsEmpty结果不正确")
+			}
+		})
+	}
+}
+
+func TestBitSetCloneAndEqual(t *testing.T) {
+	original := newBitSetWith(128, 1, 64, 127)
+	clone := original.Clone()
+	if !clone.Equal(original) || clone.size != original.size {
+		t.Fatal("克隆应与原集合相等")
+	}
+	clone.Set(2)
+	if original.Test(2) || clone.Equal(original) {
+		t.Error("修改克隆不应影响原集合")
+	}
+
+	tests := []struct {
+		name  string
+		a, b  *BitSet
+		equal bool
+	}{
+		{"both-empty", NewBitSet(0), NewBitSet(0), true},
+		{"empty-vs-unset", NewBitSet(0), NewBitSet(200), true},
+		{"different-sizes-same-bits", newBitSetWith(10, 3), newBitSetWith(200, 3), true},
+		{"extra-high-bit", newBitSetWith(10, 3), newBitSetWith(200, 3, 150), false},
+		{"different-bits", newBitSetWith(64, 63), newBitSetWith(64, 62), false},
+	}
+	for _, tt := range tests {
+		if tt.a.Equal(tt.b) != tt.equal || tt.b.Equal(tt.a) != tt.equal {
+			t.Errorf("%s: Equal期望%v", tt.name, tt.equal)
+		}
+	}
+}
+
+// ==================
+// 7. 支配树
+// ==================
+
+// newBlocks 按名称创建基本块，并依次连接edges中的"源->目标"对
+func newBlocks(names []string, edges ...[2]string) map[string]*BasicBlock {
+	blocks := make(map[string]*BasicBlock, len(names))
+	for _, name := range names {
+		blocks[name] = &BasicBlock{id: name}
+	}
+	for _, edge := range edges {
+		blocks[edge[0]].successors = append(blocks[edge[0]].successors, blocks[edge[1]])
+	}
+	return blocks
+}
+
+func TestBuildDominatorTree(t *testing.T) {
+	// entry -> header; header -> body | exit; body -> then | else -> join -> header
+	names := []string{"entry", "header", "body", "then", "else", "join", "exit", "dead"}
+	blocks := newBlocks(names,
+		[2]string{"entry", "header"},
+		[2]string{"header", "body"}, [2]string{"header", "exit"},
+		[2]string{"body", "then"}, [2]string{"body", "else"},
+		[2]string{"then", "join"}, [2]string{"else", "join"},
+		[2]string{"join", "header"},
+		[2]string{"dead", "join"},
+	)
+	cfg := &ControlFlowGraph{}
+	for _, name := range names {
+		cfg.blocks = append(cfg.blocks, blocks[name])
+	}
+
+	tree := BuildDominatorTree(cfg)
+	expected := map[string]string{
+		"entry":  "",
+		"header": "entry",
+		"body":   "header",
+		"then":   "body",
+		"else":   "body",
+		"join":   "body",
+		"exit":   "header",
+	}
+	for name, idom := range expected {
+		got := ""
+		if block := tree.ImmediateDominator(blocks[name]); block != nil {
+			got = block.id
+		}
+		if got != idom {
+			t.Errorf("%s的直接支配者期望%q，实际为%q", name, idom, got)
+		}
+	}
+
+	depths := map[string]int{"entry": 0, "header": 1, "body": 2, "exit": 2, "join": 3}
+	for name, depth := range depths {
+		if node := tree.nodes[blocks[name]]; node == nil || node.depth != depth {
+			t.Errorf("%s的深度期望%d", name, depth)
+		}
+	}
+	if _, exists := tree.nodes[blocks["dead"]]; exists {
+		t.Error("不可达块不应出现在支配树中")
+	}
+
+	dominance := []struct {
+		a, b      string
+		dominates bool
+	}{
+		{"entry", "join", true},
+		{"header", "join", true},
+		{"join", "join", true},
+		{"then", "join", false},
+		{"body", "exit", false},
+		{"join", "header", false},
+		{"dead", "join", false},
+	}
+	for _, tt := range dominance {
+		if got := tree.Dominates(blocks[tt.a], blocks[tt.b]); got != tt.dominates {
+			t.Errorf("Dominates(%s, %s)期望%v，实际为%v", tt.a, tt.b, tt.dominates, got)
+		}
+	}
+}
+
+func TestBuildDominatorTreeFromEdges(t *testing.T) {
+	blocks := newBlocks([]string{"a", "b", "c"})
+	cfg := &ControlFlowGraph{
+		entry:  blocks["a"],
+		blocks: []*BasicBlock{blocks["c"], blocks["b"], blocks["a"]},
+		edges: []*CFGEdge{
+			{source: blocks["a"], target: blocks["b"]},
+			{source: blocks["a"], target: blocks["c"]},
+			{source: blocks["b"], target: blocks["c"]},
+		},
+	}
+	tree := BuildDominatorTree(cfg)
+	if tree.root == nil || tree.root.block != blocks["a"] || len(tree.root.children) != 2 {
+		t.Fatalf("显式入口a应直接支配b和c")
+	}
+	if tree.ImmediateDominator(blocks["c"]) != blocks["a"] {
+		t.Error("c有来自a和b的两条边，直接支配者应为a")
+	}
+	if empty := BuildDominatorTree(&ControlFlowGraph{}); empty.root != nil {
+		t.Error("空控制流图不应有根节点")
+	}
+}
+
+// ==================
+// 8. 自然循环识别
+// ==================
+
+func TestDetectNestedAndSiblingLoops(t *testing.T) {
+	// outer包含两个兄弟内层循环inner1与inner2（自环），exit之后还有一个顶层循环after
+	names := []string{"entry", "outer", "inner1", "body1", "mid", "inner2", "latch", "exit", "after", "done"}
+	blocks := newBlocks(names,
+		[2]string{"entry", "outer"},
+		[2]string{"outer", "inner1"}, [2]string{"outer", "exit"},
+		[2]string{"inner1", "body1"}, [2]string{"inner1", "mid"},
+		[2]string{"body1", "inner1"},
+		[2]string{"mid", "inner2"},
+		[2]string{"inner2", "inner2"}, [2]string{"inner2", "latch"},
+		[2]string{"latch", "outer"},
+		[2]string{"exit", "after"},
+		[2]string{"after", "after"}, [2]string{"after", "done"},
+	)
+	cfg := &ControlFlowGraph{}
+	for _, name := range names {
+		cfg.blocks = append(cfg.blocks, blocks[name])
+	}
+
+	info := DetectLoops(cfg, BuildDominatorTree(cfg))
+	loops := make(map[string]*Loop)
+	for _, loop := range info.loops {
+		loops[loop.header.id] = loop
+	}
+
+	expected := []struct {
+		header string
+		blocks []string
+		exits  []string
+		depth  int
+		parent string
+	}{
+		{"outer", []string{"outer", "inner1", "body1", "mid", "inner2", "latch"}, []string{"exit"}, 1, ""},
+		{"inner1", []string{"inner1", "body1"}, []string{"mid"}, 2, "outer"},
+		{"inner2", []string{"inner2"}, []string{"latch"}, 2, "outer"},
+		{"after", []string{"after"}, []string{"done"}, 1, ""},
+	}
+	if len(info.loops) != len(expected) || info.depth != 2 {
+		t.Fatalf("期望识别%d个循环、最大深度2，实际为%d个、深度%d", len(expected), len(info.loops), info.depth)
+	}
+	for _, tt := range expected {
+		loop := loops[tt.header]
+		if loop == nil {
+			t.Errorf("未识别以%s为头的循环", tt.header)
+			continue
+		}
+		if got := blockIDs(loop.blocks); !reflect.DeepEqual(sortedStrings(got), sortedStrings(tt.blocks)) {
+			t.Errorf("%s循环体期望%v，实际为%v", tt.header, tt.blocks, got)
+		}
+		if got := blockIDs(loop.exits); !reflect.DeepEqual(got, tt.exits) {
+			t.Errorf("%s循环出口期望%v，实际为%v", tt.header, tt.exits, got)
+		}
+		if loop.depth != tt.depth {
+			t.Errorf("%s循环深度期望%d，实际为%d", tt.header, tt.depth, loop.depth)
+		}
+		parent := ""
+		if loop.parent != nil {
+			parent = loop.parent.header.id
+		}
+		if parent != tt.parent {
+			t.Errorf("%s的父循环期望%q，实际为%q", tt.header, tt.parent, parent)
+		}
+	}
+	if len(loops["outer"].children) != 2 {
+		t.Errorf("outer应有两个子循环，实际为%d", len(loops["outer"].children))
+	}
+}
+
+func sortedStrings(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func TestOptimizeLoopsDetectsLoopsFromCFG(t *testing.T) {
+	blocks := newBlocks([]string{"entry", "loop", "exit"},
+		[2]string{"entry", "loop"}, [2]string{"loop", "loop"}, [2]string{"loop", "exit"})
+	function := &Function{
+		name:        "f",
+		basicBlocks: []*BasicBlock{blocks["entry"], blocks["loop"], blocks["exit"]},
+		cfg:         &ControlFlowGraph{blocks: []*BasicBlock{blocks["entry"], blocks["loop"], blocks["exit"]}},
+	}
+
+	NewLoopOptimizer().OptimizeLoops(&OptimizationContext{function: function})
+	if function.domTree == nil || function.loopInfo == nil || len(function.loopInfo.loops) != 1 {
+		t.Fatal("OptimizeLoops应从控制流图计算支配树和循环信息")
+	}
+	if loop := function.loopInfo.loops[0]; loop.header != blocks["loop"] {
+		t.Errorf("循环头期望loop，实际为%s", loop.header.id)
+	}
+}
+
+// ==================
+// 9. 拓扑过程调度
+// ==================
+
+func passIDs(passes []*OptimizationPass) []string {
+	ids := make([]string, len(passes))
+	for i, pass := range passes {
+		ids[i] = pass.id
+	}
+	return ids
+}
+
+func TestSchedulePassesTopologically(t *testing.T) {
+	pm := NewPassManager()
+	pm.config.AllowForwardReferences = true
+	// 依赖方先于被依赖方注册，边应在被依赖方注册时补上
+	gvn := newTestPass("gvn", "ssa")
+	gvn.priority = 5
+	licm := newTestPass("licm", "ssa", "loops")
+	licm.priority = 10
+	licm.conflicts = []string{"unroll"}
+	unroll := newTestPass("unroll", "loops")
+	unroll.priority = 10
+	ssa := newTestPass("ssa")
+	ssa.priority = 2
+	loops := newTestPass("loops")
+	loops.priority = 1
+	dce := newTestPass("dce")
+	dce.priority = 1
+	for _, pass := range []*OptimizationPass{gvn, licm, unroll, ssa, loops, dce} {
+		if err := pm.RegisterPass(pass); err != nil {
+			t.Fatalf("注册%s失败: %v", pass.id, err)
+		}
+	}
+
+	schedule, err := pm.scheduler.SchedulePasses(pm.passes, nil)
+	if err != nil {
+		t.Fatalf("调度失败: %v", err)
+	}
+	// licm与unroll优先级最高但互相冲突，中间插入优先级较低的dce
+	expected := []string{"ssa", "gvn", "loops", "licm", "dce", "unroll"}
+	if got := passIDs(schedule); !reflect.DeepEqual(got, expected) {
+		t.Errorf("期望调度顺序%v，实际为%v", expected, got)
+	}
+
+	conflicts := 0
+	for _, edge := range pm.dependencies.edges {
+		if edge.kind == DependencyConflict {
+			conflicts++
+		}
+	}
+	if conflicts != 1 || len(pm.dependencies.edges) != 5 {
+		t.Errorf("期望4条依赖边和1条冲突边，实际共%d条边、%d条冲突边", len(pm.dependencies.edges), conflicts)
+	}
+}
+
+func TestSchedulePassesRejectsUnavoidableConflict(t *testing.T) {
+	pm := NewPassManager()
+	a := newTestPass("a")
+	b := newTestPass("b", "a")
+	b.conflicts = []string{"a"}
+	for _, pass := range []*OptimizationPass{a, b} {
+		if err := pm.RegisterPass(pass); err != nil {
+			t.Fatalf("注册失败: %v", err)
+		}
+	}
+	if _, err := pm.scheduler.SchedulePasses(pm.passes, nil); err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Errorf("冲突过程只能相邻时应返回错误，实际为%v", err)
+	}
+
+	// 互斥边同样不能相邻
+	pm = NewPassManager()
+	for _, pass := range []*OptimizationPass{newTestPass("x"), newTestPass("y", "x"), newTestPass("z")} {
+		if err := pm.RegisterPass(pass); err != nil {
+			t.Fatalf("注册失败: %v", err)
+		}
+	}
+	pm.dependencies.addEdge(pm.dependencies.nodes["x"], pm.dependencies.nodes["y"], DependencyMutex)
+	schedule, err := pm.scheduler.SchedulePasses(pm.passes, nil)
+	if err != nil || !reflect.DeepEqual(passIDs(schedule), []string{"x", "z", "y"}) {
+		t.Errorf("期望x,z,y，实际为%v %v", passIDs(schedule), err)
+	}
+}
+
+func TestSchedulePassesDetectsCycle(t *testing.T) {
+	pm := NewPassManager()
+	pm.config.AllowForwardReferences = true
+	for _, pass := range []*OptimizationPass{newTestPass("a", "c"), newTestPass("b", "a"), newTestPass("c", "b"), newTestPass("d")} {
+		if err := pm.RegisterPass(pass); err != nil {
+			t.Fatalf("注册失败: %v", err)
+		}
+	}
+	_, err := pm.scheduler.SchedulePasses(pm.passes, nil)
+	if err == nil || !strings.Contains(err.Error(), "cycle") || !strings.Contains(err.Error(), "a, b, c") {
+		t.Errorf("期望报告a, b, c上的依赖环，实际为%v", err)
+	}
+}
+
+// ==================
+// 10. 迭代至不动点
+// ==================
+
+// convergingTransformer 前changes次执行报告IR已改变，之后不再改变
+type convergingTransformer struct {
+	changes int
+	calls   int
+}
+
+func (ct *convergingTransformer) Transform(context *OptimizationContext) (*TransformationResult, error) {
+	ct.calls++
+	return &TransformationResult{success: true, changed: ct.calls <= ct.changes}, nil
+}
+
+func (ct *convergingTransformer) CanTransform(context *OptimizationContext) bool { return true }
+
+func (ct *convergingTransformer) EstimateCost(context *OptimizationContext) float64 { return 0 }
+
+func newIterationTestEngine(t *testing.T, maxIterations int, transformer *convergingTransformer) (*OptimizationEngine, *OptimizationContext) {
+	t.Helper()
+	engine := NewOptimizationEngine(OptimizationConfig{MaxIterations: maxIterations})
+	pass := newTestPass("converging")
+	pass.transformer = transformer
+	if err := engine.passManager.RegisterPass(pass); err != nil {
+		t.Fatalf("注册失败: %v", err)
+	}
+	context := &OptimizationContext{
+		function:        &Function{name: "f"},
+		analysisResults: make(map[AnalysisKind]*AnalysisResult),
+		environment: &OptimizationEnvironment{
+			settings: map[string]interface{}{"optimization_level": OptLevelAggressive},
+		},
+	}
+	return engine, context
+}
+
+func TestOptimizeIteratesToFixpoint(t *testing.T) {
+	transformer := &convergingTransformer{changes: 3}
+	engine, context := newIterationTestEngine(t, 10, transformer)
+	context.analysisResults[AnalysisKind(0)] = &AnalysisResult{valid: true}
+	engine.dataFlowAnalyzer.AnalyzeDataFlow(context, DataFlowLiveness)
+
+	result := engine.Optimize(context)
+	// 3次改变之后还需1轮确认不动点
+	if transformer.calls != 4 || result.Statistics.IterationCount != 4 {
+		t.Errorf("期望迭代4轮，实际执行%d次、统计%d轮", transformer.calls, result.Statistics.IterationCount)
+	}
+	if passResult := result.PassResults["converging"]; passResult == nil || !passResult.Changed {
+		t.Error("应保留过程最近一次改变IR的结果")
+	}
+	if len(context.analysisResults) != 0 || len(engine.dataFlowAnalyzer.cache) != 0 {
+		t.Error("IR改变后应清除旧的分析结果")
+	}
+}
+
+func TestOptimizeStopsAtMaxIterations(t *testing.T) {
+	transformer := &convergingTransformer{changes: 100}
+	engine, context := newIterationTestEngine(t, 5, transformer)
+
+	result := engine.Optimize(context)
+	if transformer.calls != 5 || result.Statistics.IterationCount != 5 {
+		t.Errorf("期望在第5轮停止，实际执行%d次", transformer.calls)
+	}
+
+	// 未配置MaxIterations时只执行一轮
+	transformer = &convergingTransformer{changes: 100}
+	engine, context = newIterationTestEngine(t, 0, transformer)
+	engine.Optimize(context)
+	if transformer.calls != 1 {
+		t.Errorf("未配置最大迭代次数时应只执行一轮，实际为%d", transformer.calls)
+	}
+}
+
+func TestOptimizeStopsAtTimeLimit(t *testing.T) {
+	transformer := &convergingTransformer{changes: 100}
+	engine, context := newIterationTestEngine(t, 100, transformer)
+	engine.config.TimeLimit = time.Nanosecond
+
+	engine.Optimize(context)
+	if transformer.calls != 1 {
+		t.Errorf("超出时间限制后应停止迭代，实际执行%d次", transformer.calls)
+	}
+}
+
+// ==================
+// 11. 过程结果缓存
+// ==================
+
+func TestPassResultsServedFromCache(t *testing.T) {
+	pm := NewPassManager()
+	pm.config.EnableCaching = true
+	transformer := &convergingTransformer{}
+	pass := newTestPass("noop")
+	pass.transformer = transformer
+	if err := pm.RegisterPass(pass); err != nil {
+		t.Fatalf("注册失败: %v", err)
+	}
+
+	x := &Variable{name: "x"}
+	block := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{opcode: OpAdd, operands: []*Operand{constOperand(1), constOperand(2)}, result: x},
+	}}
+	context := &OptimizationContext{
+		function:        &Function{name: "f", basicBlocks: []*BasicBlock{block}},
+		analysisResults: make(map[AnalysisKind]*AnalysisResult),
+		environment: &OptimizationEnvironment{
+			settings: map[string]interface{}{"optimization_level": OptLevelAggressive},
+		},
+	}
+
+	pm.ExecutePipeline(context)
+	second := pm.ExecutePipeline(context)
+	if transformer.calls != 1 || pm.statistics.CacheHits != 1 || pm.statistics.CacheMisses != 1 {
+		t.Errorf("第二次执行应命中缓存，实际执行%d次、命中%d、未命中%d",
+			transformer.calls, pm.statistics.CacheHits, pm.statistics.CacheMisses)
+	}
+	if result := second.Results["noop"]; result == nil || !result.Success {
+		t.Error("缓存命中时应返回原有结果")
+	}
+
+	// IR改变后键不同，需要重新执行。过程在副本上执行，成功后函数持有的是副本的基本块
+	block = context.function.basicBlocks[0]
+	block.instructions[0].operands[1] = constOperand(3)
+	pm.ExecutePipeline(context)
+	if transformer.calls != 2 || pm.statistics.CacheMisses != 2 {
+		t.Errorf("IR改变后应重新执行，实际执行%d次", transformer.calls)
+	}
+
+	// 改变IR的结果不缓存
+	changing := &convergingTransformer{changes: 100}
+	pass.transformer = changing
+	block = context.function.basicBlocks[0]
+	block.instructions[0].operands[1] = constOperand(4)
+	pm.ExecutePipeline(context)
+	pm.ExecutePipeline(context)
+	if changing.calls != 2 {
+		t.Errorf("改变IR的过程每次都应执行，实际执行%d次", changing.calls)
+	}
+}
+
+func TestPassCacheKeyCoversProfileAndCallGraph(t *testing.T) {
+	pm := NewPassManager()
+	pm.config.EnableCaching = true
+	transformer := &convergingTransformer{}
+	pass := newTestPass("noop")
+	pass.transformer = transformer
+	if err := pm.RegisterPass(pass); err != nil {
+		t.Fatalf("注册失败: %v", err)
+	}
+
+	x := &Variable{name: "x"}
+	call := &Instruction{id: "call-g", opcode: OpCall, operands: []*Operand{labelOperand("g")}, result: x}
+	function := &Function{name: "f", basicBlocks: []*BasicBlock{{id: "entry", instructions: []*Instruction{call}}}}
+	callee := &Function{name: "g", basicBlocks: []*BasicBlock{{id: "entry", instructions: []*Instruction{
+		{opcode: OpReturn, operands: []*Operand{constOperand(1)}},
+	}}}}
+	context := &OptimizationContext{
+		function:        function,
+		analysisResults: make(map[AnalysisKind]*AnalysisResult),
+		environment: &OptimizationEnvironment{
+			settings: map[string]interface{}{"optimization_level": OptLevelAggressive},
+		},
+	}
+
+	pm.ExecutePipeline(context)
+	pm.ExecutePipeline(context)
+	if transformer.calls != 1 {
+		t.Fatalf("输入不变时应命中缓存，实际执行%d次", transformer.calls)
+	}
+
+	// 剖面数据变化后需要重新执行
+	profile, err := LoadProfile(strings.NewReader("f entry 100\n"))
+	if err != nil {
+		t.Fatalf("解析剖面失败: %v", err)
+	}
+	context.AttachProfile(profile)
+	pm.ExecutePipeline(context)
+	if transformer.calls != 2 {
+		t.Errorf("剖面数据改变后应重新执行，实际执行%d次", transformer.calls)
+	}
+
+	// 调用图新增边后需要重新执行
+	graph, nodes := newCallGraph(function, callee)
+	connect(graph, nodes["f"], nodes["g"], context.function.basicBlocks[0].instructions[0])
+	pm.ExecutePipeline(context)
+	if transformer.calls != 3 {
+		t.Errorf("调用图改变后应重新执行，实际执行%d次", transformer.calls)
+	}
+
+	// 被调函数的IR变化后需要重新执行
+	callee.basicBlocks[0].instructions[0].operands[0] = constOperand(2)
+	pm.ExecutePipeline(context)
+	if transformer.calls != 4 {
+		t.Errorf("被调函数改变后应重新执行，实际执行%d次", transformer.calls)
+	}
+	pm.ExecutePipeline(context)
+	if transformer.calls != 4 {
+		t.Errorf("输入不变时应命中缓存，实际执行%d次", transformer.calls)
+	}
+}
+
+// blockAnalyzer 记录调用次数，分析结果引用所分析函数的入口块
+type blockAnalyzer struct {
+	calls int
+}
+
+func (ba *blockAnalyzer) Analyze(context *OptimizationContext) (*AnalysisResult, error) {
+	ba.calls++
+	return &AnalysisResult{kind: AnalysisLiveness, valid: true, data: context.function.basicBlocks[0]}, nil
+}
+
+func (ba *blockAnalyzer) GetAnalysisKind() AnalysisKind { return AnalysisLiveness }
+
+func (ba *blockAnalyzer) InvalidateAnalysis(context *OptimizationContext) {}
+
+func TestAnalysisResultsNotSharedBetweenFunctions(t *testing.T) {
+	pm := NewPassManager()
+	pm.config.EnableCaching = true
+	analyzer := &blockAnalyzer{}
+	pass := newTestPass("liveness")
+	pass.analyzer = analyzer
+	if err := pm.RegisterPass(pass); err != nil {
+		t.Fatalf("注册失败: %v", err)
+	}
+
+	// 两个同名且IR相同的函数
+	newContext := func() *OptimizationContext {
+		block := &BasicBlock{id: "entry", instructions: []*Instruction{
+			{opcode: OpAdd, operands: []*Operand{constOperand(1), constOperand(2)}, result: &Variable{name: "x"}},
+		}}
+		return &OptimizationContext{
+			function:        &Function{name: "f", basicBlocks: []*BasicBlock{block}},
+			analysisResults: make(map[AnalysisKind]*AnalysisResult),
+			environment: &OptimizationEnvironment{
+				settings: map[string]interface{}{"optimization_level": OptLevelAggressive},
+			},
+		}
+	}
+	first, second := newContext(), newContext()
+	pm.ExecutePipeline(first)
+	pm.ExecutePipeline(second)
+
+	if analyzer.calls != 2 || pm.statistics.CacheHits != 0 {
+		t.Errorf("分析过程不应命中缓存，实际分析%d次、命中%d次", analyzer.calls, pm.statistics.CacheHits)
+	}
+	if result := second.analysisResults[AnalysisLiveness]; result == nil || result.data != second.function.basicBlocks[0] {
+		t.Error("第二个函数的分析结果应引用它自己的基本块")
+	}
+}
+
+func TestOptimizationCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewOptimizationCache()
+	cache.maxSize = 2
+	cache.PutPassResult("a", &PassResult{PassID: "a"})
+	cache.PutPassResult("b", &PassResult{PassID: "b"})
+	if _, ok := cache.GetPassResult("a"); !ok {
+		t.Fatal("a应在缓存中")
+	}
+
+	cache.PutPassResult("c", &PassResult{PassID: "c"})
+	if _, ok := cache.GetPassResult("b"); ok {
+		t.Error("最久未使用的b应被淘汰")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.GetPassResult(key); !ok {
+			t.Errorf("%s不应被淘汰", key)
+		}
+	}
+	if len(cache.passResults) != 2 || cache.lru.Len() != 2 {
+		t.Errorf("缓存大小应为2，实际为%d", len(cache.passResults))
+	}
+}
+
+// ==================
+// 12. 过程超时与取消
+// ==================
+
+// blockingTransformer 阻塞直到release关闭，模拟失控的变换；被放行后清空函数的基本块，
+// 完成时关闭finished
+type blockingTransformer struct {
+	release  chan struct{}
+	finished chan struct{}
+}
+
+func (bt blockingTransformer) Transform(context *OptimizationContext) (*TransformationResult, error) {
+	<-bt.release
+	if context.function != nil {
+		context.function.basicBlocks[0].instructions = nil
+		context.function.basicBlocks = nil
+	}
+	close(bt.finished)
+	return &TransformationResult{success: true, changed: true}, nil
+}
+
+func (bt blockingTransformer) CanTransform(context *OptimizationContext) bool { return true }
+
+func (bt blockingTransformer) EstimateCost(context *OptimizationContext) float64 { return 0 }
+
+// newTimeoutTestManager 注册一个阻塞的slow过程和随后执行的fast过程
+func newTimeoutTestManager(t *testing.T, failFast bool) (*PassManager, *convergingTransformer) {
+	pm, fast, _ := newBlockingTestManager(t, failFast)
+	return pm, fast
+}
+
+// newBlockingTestManager 同newTimeoutTestManager，另外返回slow过程的变换器以便放行
+func newBlockingTestManager(t *testing.T, failFast bool) (*PassManager, *convergingTransformer, blockingTransformer) {
+	t.Helper()
+	blocking := blockingTransformer{release: make(chan struct{}), finished: make(chan struct{})}
+	t.Cleanup(func() {
+		select {
+		case <-blocking.release:
+		default:
+			close(blocking.release)
+		}
+	})
+
+	pm := NewPassManager()
+	pm.config.TimeoutPerPass = 20 * time.Millisecond
+	pm.config.FailFast = failFast
+	slow := newTestPass("slow")
+	slow.priority = 10
+	slow.transformer = blocking
+	fastTransformer := &convergingTransformer{}
+	fast := newTestPass("fast")
+	fast.transformer = fastTransformer
+	for _, pass := range []*OptimizationPass{slow, fast} {
+		if err := pm.RegisterPass(pass); err != nil {
+			t.Fatalf("注册失败: %v", err)
+		}
+	}
+	return pm, fastTransformer, blocking
+}
+
+func TestSlowPassTimesOut(t *testing.T) {
+	for _, failFast := range []bool{false, true} {
+		pm, fast := newTimeoutTestManager(t, failFast)
+
+		start := time.Now()
+		result := pm.ExecutePipeline(newAdaptiveTestContext())
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("超时的过程不应阻塞管道，耗时%v", elapsed)
+		}
+
+		slow := result.Results["slow"]
+		if slow == nil || slow.Success || !errors.Is(slow.Error, context.DeadlineExceeded) {
+			t.Fatalf("slow过程应记为超时失败，实际为%+v", slow)
+		}
+		if pm.statistics.PassFailures != 1 {
+			t.Errorf("期望记录1次失败，实际为%d", pm.statistics.PassFailures)
+		}
+
+		if failFast {
+			if fast.calls != 0 {
+				t.Error("FailFast时超时后应中止管道")
+			}
+		} else if fast.calls != 1 || !result.Results["fast"].Success {
+			t.Error("未开启FailFast时应跳过超时的过程继续执行")
+		}
+	}
+}
+
+func TestTimedOutPassDoesNotTouchCallerIR(t *testing.T) {
+	pm, _, slow := newBlockingTestManager(t, false)
+	x := &Variable{name: "x"}
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{opcode: OpAdd, operands: []*Operand{constOperand(1), constOperand(2)}, result: x},
+	}}
+	context := newAdaptiveTestContext()
+	context.function = &Function{name: "f", basicBlocks: []*BasicBlock{entry}}
+
+	pm.ExecutePipeline(context)
+	close(slow.release)
+	<-slow.finished
+
+	// 超时的过程在返回后才修改它的函数副本，调用方的IR保持不变
+	if len(context.function.basicBlocks) != 1 || len(context.function.basicBlocks[0].instructions) != 1 {
+		t.Errorf("超时过程的修改不应影响调用方的IR，实际为%v", context.function.basicBlocks)
+	}
+	if len(entry.instructions) != 1 {
+		t.Error("超时过程不应修改调用方持有的基本块")
+	}
+}
+
+func TestPipelineStopsOnCallerCancellation(t *testing.T) {
+	pm, fast := newTimeoutTestManager(t, false)
+	pm.config.TimeoutPerPass = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	result := pm.ExecutePipelineContext(ctx, newAdaptiveTestContext())
+
+	if !errors.Is(result.Error, context.Canceled) {
+		t.Errorf("期望管道因取消而停止，实际为%v", result.Error)
+	}
+	if slow := result.Results["slow"]; slow == nil || !errors.Is(slow.Error, context.Canceled) {
+		t.Errorf("正在执行的过程应记为取消，实际为%+v", slow)
+	}
+	if fast.calls != 0 {
+		t.Error("取消后不应执行后续过程")
+	}
+
+	// 已取消的ctx不执行任何过程
+	pm, fast = newTimeoutTestManager(t, false)
+	result = pm.ExecutePipelineContext(ctx, newAdaptiveTestContext())
+	if len(result.Results) != 0 || fast.calls != 0 || !errors.Is(result.Error, context.Canceled) {
+		t.Errorf("ctx已取消时不应执行过程，实际为%v", result.Results)
+	}
+}
+
+// ==================
+// 13. 常量折叠
+// ==================
+
+func TestConstantFoldingNestedExpressions(t *testing.T) {
+	// t1 = 2 * 3; t2 = t1 + 4; t3 = t2 / 0; f = 1.5 + 2.5; m = int32(1) + int64(2); r = t2 - x
+	t1, t2, t3, f, m, x, r := &Variable{name: "t1"}, &Variable{name: "t2"}, &Variable{name: "t3"},
+		&Variable{name: "f"}, &Variable{name: "m"}, &Variable{name: "x"}, &Variable{name: "r"}
+	block := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{id: "t1", opcode: OpMul, operands: []*Operand{constOperand(int64(2)), constOperand(int64(3))}, result: t1},
+		{id: "t2", opcode: OpAdd, operands: []*Operand{varOperand(t1), constOperand(int64(4))}, result: t2},
+		{id: "t3", opcode: OpDiv, operands: []*Operand{varOperand(t2), constOperand(int64(0))}, result: t3},
+		{id: "f", opcode: OpAdd, operands: []*Operand{constOperand(1.5), constOperand(2.5)}, result: f},
+		{id: "m", opcode: OpAdd, operands: []*Operand{constOperand(int32(1)), constOperand(int64(2))}, result: m},
+		{id: "r", opcode: OpSub, operands: []*Operand{varOperand(t2), varOperand(x)}, result: r},
+	}}
+	context := &OptimizationContext{function: &Function{name: "fold", basicBlocks: []*BasicBlock{block}}}
+
+	result, err := (&ConstantFoldingTransformer{}).Transform(context)
+	if err != nil || !result.changed {
+		t.Fatalf("期望折叠成功，实际为%v", err)
+	}
+	if result.metrics["instructions_folded"] != 3 {
+		t.Errorf("期望折叠3条指令，实际为%v", result.metrics["instructions_folded"])
+	}
+
+	folded := map[string]interface{}{"t1": int64(6), "t2": int64(10), "f": 4.0}
+	for _, inst := range block.instructions {
+		value, expected := folded[inst.id]
+		if !expected {
+			if inst.opcode == OpConst {
+				t.Errorf("%s不应被折叠", inst.id)
+			}
+			continue
+		}
+		if inst.opcode != OpConst || len(inst.operands) != 1 || inst.operands[0].constant != value {
+			t.Errorf("%s期望折叠为%v", inst.id, value)
+		}
+	}
+
+	// 除数为0的指令保持不变，但已知常量仍代入其操作数
+	div := block.instructions[2]
+	if div.opcode != OpDiv || div.operands[0].kind != OperandConstant || div.operands[0].constant != int64(10) {
+		t.Errorf("除以0的指令应保持为除法，实际为%v", div.opcode)
+	}
+	if sub := block.instructions[5]; sub.operands[0].constant != int64(10) || sub.operands[1].variable != x {
+		t.Error("应只代入已知常量的变量")
+	}
+}
+
+func TestConstantFoldingRespectsRedefinitionAndWidth(t *testing.T) {
+	a, b := &Variable{name: "a"}, &Variable{name: "b"}
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{opcode: OpAdd, operands: []*Operand{constOperand(int8(127)), constOperand(int8(1))}, result: a},
+		{opcode: OpLoad, result: a},
+		{opcode: OpAdd, operands: []*Operand{varOperand(a), constOperand(int8(1))}, result: b},
+	}}
+	context := &OptimizationContext{function: &Function{name: "width", basicBlocks: []*BasicBlock{entry}}}
+	if _, err := (&ConstantFoldingTransformer{}).Transform(context); err != nil {
+		t.Fatal(err)
+	}
+	if entry.instructions[0].operands[0].constant != int8(-128) {
+		t.Errorf("int8溢出应回绕为-128，实际为%v", entry.instructions[0].operands[0].constant)
+	}
+	if entry.instructions[2].opcode != OpAdd || entry.instructions[2].operands[0].kind != OperandVariable {
+		t.Error("变量被重新定义后不应再代入旧常量")
+	}
+
+	engine := NewOptimizationEngine(OptimizationConfig{})
+	found := false
+	for _, pass := range engine.passManager.passes {
+		if pass.id == "constant_folding" {
+			_, found = pass.transformer.(*ConstantFoldingTransformer)
+		}
+	}
+	if !found {
+		t.Error("constant_folding过程应注册常量折叠变换器")
+	}
+}
+
+func TestConstantFoldingMixedIntWidths(t *testing.T) {
+	sum, product := &Variable{name: "sum"}, &Variable{name: "product"}
+	block := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{opcode: OpAdd, operands: []*Operand{constOperand(2), constOperand(int64(3))}, result: sum},
+		{opcode: OpMul, operands: []*Operand{constOperand(int64(4)), constOperand(5)}, result: product},
+	}}
+	context := &OptimizationContext{function: &Function{name: "mixed", basicBlocks: []*BasicBlock{block}}}
+	if _, err := (&ConstantFoldingTransformer{}).Transform(context); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int64{5, 20} {
+		inst := block.instructions[i]
+		if inst.opcode != OpConst || inst.operands[0].constant != want {
+			t.Errorf("int与int64混用时应按int64折叠为%d，实际为%v", want, inst.operands[0].constant)
+		}
+	}
+}
+
+// ==================
+// 14. 公共子表达式消除
+// ==================
+
+func TestCommonSubexpressionElimination(t *testing.T) {
+	a, b, p, q := &Variable{name: "a"}, &Variable{name: "b"}, &Variable{name: "p"}, &Variable{name: "q"}
+	tmp, x, y, z := &Variable{name: "t"}, &Variable{name: "x"}, &Variable{name: "y"}, &Variable{name: "z"}
+	w1, w2, w3 := &Variable{name: "w1"}, &Variable{name: "w2"}, &Variable{name: "w3"}
+	add := func(id string, left, right, result *Variable) *Instruction {
+		return &Instruction{id: id, opcode: OpAdd, operands: []*Operand{varOperand(left), varOperand(right)}, result: result}
+	}
+	load := func(id string, address, result *Variable) *Instruction {
+		return &Instruction{id: id, opcode: OpLoad, operands: []*Operand{varOperand(address)}, result: result}
+	}
+
+	// entry: t = a + b
+	// left:  x = b + a（可消除）; b = load p; y = a + b（b已重新定义，不可消除）
+	// right: t = a + b（重复计算到同一变量，删除）; w1 = load q; w2 = load q（可消除）; store q; w3 = load q（store后不可消除）
+	// join:  z = a + b（left路径上已失效，不可消除）
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{add("t", a, b, tmp)}}
+	left := &BasicBlock{id: "left", instructions: []*Instruction{
+		add("x", b, a, x), load("b", p, b), add("y", a, b, y),
+	}}
+	right := &BasicBlock{id: "right", instructions: []*Instruction{
+		add("t-again", a, b, tmp), load("w1", q, w1), load("w2", q, w2),
+		{id: "store", opcode: OpStore, operands: []*Operand{varOperand(q), varOperand(w2)}},
+		load("w3", q, w3),
+	}}
+	join := &BasicBlock{id: "join", instructions: []*Instruction{add("z", a, b, z)}}
+	entry.successors = []*BasicBlock{left, right}
+	left.successors = []*BasicBlock{join}
+	right.successors = []*BasicBlock{join}
+	function := &Function{name: "cse", basicBlocks: []*BasicBlock{entry, left, right, join}}
+
+	available := NewDataFlowAnalyzer().AnalyzeDataFlow(&OptimizationContext{function: function}, DataFlowAvailable)
+	analysis, ok := available.results["available"].(*AvailableExpressionsResult)
+	if !ok || available.iterations == 0 {
+		t.Fatalf("期望得到*AvailableExpressionsResult，实际为%T", available.results["available"])
+	}
+	if analysis.availableIn[left].Count() != 1 || analysis.availableIn[join].Count() != 0 {
+		t.Errorf("left入口应只有a+b可用，join入口没有可用表达式")
+	}
+
+	result, err := (&CommonSubexpressionTransformer{}).Transform(&OptimizationContext{function: function})
+	if err != nil || !result.changed || result.metrics["expressions_eliminated"] != 3 {
+		t.Fatalf("期望消除3次重复计算，实际为%v %v", result.metrics["expressions_eliminated"], err)
+	}
+
+	copies := map[string]*Variable{"x": tmp, "w2": w1}
+	for _, block := range function.basicBlocks {
+		for _, inst := range block.instructions {
+			if holder, expected := copies[inst.id]; expected {
+				if inst.opcode != OpCopy || inst.operands[0].variable != holder {
+					t.Errorf("%s应改写为从%s复制", inst.id, holder.name)
+				}
+			} else if inst.opcode == OpCopy {
+				t.Errorf("%s不应被消除", inst.id)
+			}
+		}
+	}
+	if got := instructionIDs(&Function{basicBlocks: []*BasicBlock{right}}); !reflect.DeepEqual(got, []string{"w1", "w2", "store", "w3"}) {
+		t.Errorf("重复计算到同一变量应被删除，实际为%v", got)
+	}
+}
+
+func TestCommonSubexpressionInvalidatedByStoreThroughPointer(t *testing.T) {
+	x, p, v, a, b := &Variable{name: "x"}, &Variable{name: "p"}, &Variable{name: "v"}, &Variable{name: "a"}, &Variable{name: "b"}
+	// a = x + 1; p = &x; store p, v（经p写入x）; b = x + 1（不可消除）
+	block := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{id: "a", opcode: OpAdd, operands: []*Operand{varOperand(x), constOperand(int64(1))}, result: a},
+		{id: "p", opcode: OpAddr, operands: []*Operand{varOperand(x)}, result: p},
+		{id: "store", opcode: OpStore, operands: []*Operand{varOperand(p), varOperand(v)}},
+		{id: "b", opcode: OpAdd, operands: []*Operand{varOperand(x), constOperand(int64(1))}, result: b},
+	}}
+	function := &Function{name: "alias", basicBlocks: []*BasicBlock{block}}
+
+	result, err := (&CommonSubexpressionTransformer{}).Transform(&OptimizationContext{function: function})
+	if err != nil || result.changed {
+		t.Fatalf("经指针写入x后x + 1不再可用，实际消除了%v处", result.metrics["expressions_eliminated"])
+	}
+	if block.instructions[3].opcode != OpAdd {
+		t.Error("b应保持为加法")
+	}
+}
+
+// ==================
+// 15. 常量传播
+// ==================
+
+func TestConstantPropagationAcrossBlocks(t *testing.T) {
+	c, v, u, p, x, y, z, w := &Variable{name: "c"}, &Variable{name: "v"}, &Variable{name: "u"}, &Variable{name: "p"},
+		&Variable{name: "x"}, &Variable{name: "y"}, &Variable{name: "z"}, &Variable{name: "w"}
+	use := func(id string, operand, result *Variable) *Instruction {
+		return &Instruction{id: id, opcode: OpAdd, operands: []*Operand{varOperand(operand), constOperand(int64(1))}, result: result}
+	}
+
+	// entry: c = 5; u = 3
+	// left:  v = 1; p = 7
+	// right: v = 2; u = 3
+	// join:  x = c + 1（代入5）; y = v + 1（两条路径常量不同，不代入）; z = u + 1（两条路径都是3，代入）; w = p + 1（right路径上p未定义，不代入）
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{id: "c", opcode: OpConst, operands: []*Operand{constOperand(int64(5))}, result: c},
+		{id: "u", opcode: OpConst, operands: []*Operand{constOperand(int64(3))}, result: u},
+	}}
+	left := &BasicBlock{id: "left", instructions: []*Instruction{
+		{id: "v1", opcode: OpConst, operands: []*Operand{constOperand(int64(1))}, result: v},
+		{id: "p", opcode: OpConst, operands: []*Operand{constOperand(int64(7))}, result: p},
+	}}
+	right := &BasicBlock{id: "right", instructions: []*Instruction{
+		{id: "v2", opcode: OpConst, operands: []*Operand{constOperand(int64(2))}, result: v},
+		{id: "u2", opcode: OpConst, operands: []*Operand{constOperand(int64(3))}, result: u},
+	}}
+	join := &BasicBlock{id: "join", instructions: []*Instruction{use("x", c, x), use("y", v, y), use("z", u, z), use("w", p, w)}}
+	entry.successors = []*BasicBlock{left, right}
+	left.successors = []*BasicBlock{join}
+	right.successors = []*BasicBlock{join}
+	function := &Function{name: "propagate", basicBlocks: []*BasicBlock{entry, left, right, join}}
+
+	reaching := NewDataFlowAnalyzer().AnalyzeDataFlow(&OptimizationContext{function: function}, DataFlowReaching)
+	analysis, ok := reaching.results["reaching"].(*ReachingDefinitionsResult)
+	if !ok || reaching.iterations == 0 {
+		t.Fatalf("期望得到*ReachingDefinitionsResult，实际为%T", reaching.results["reaching"])
+	}
+	var vDefs []string
+	for _, def := range analysis.byVariable[v] {
+		if def.instruction != nil && analysis.reachingIn[join].Test(def.index) {
+			vDefs = append(vDefs, def.instruction.id)
+		}
+	}
+	if !reflect.DeepEqual(vDefs, []string{"v1", "v2"}) {
+		t.Errorf("join入口v的到达定义应为[v1 v2]，实际为%v", vDefs)
+	}
+
+	result, err := (&ConstantPropagationTransformer{}).Transform(&OptimizationContext{function: function})
+	if err != nil || !result.changed || result.metrics["operands_substituted"] != 2 {
+		t.Fatalf("期望代入2个操作数，实际为%v %v", result.metrics["operands_substituted"], err)
+	}
+	expected := map[string]interface{}{"x": int64(5), "z": int64(3)}
+	for _, inst := range join.instructions {
+		operand := inst.operands[0]
+		if constant, ok := expected[inst.id]; ok {
+			if operand.kind != OperandConstant || operand.constant != constant {
+				t.Errorf("%s的操作数应代入常量%v", inst.id, constant)
+			}
+		} else if operand.kind != OperandVariable {
+			t.Errorf("%s的操作数不应被代入常量", inst.id)
+		}
+	}
+}
+
+func TestConstantPropagationThroughCopies(t *testing.T) {
+	a, b, c, d := &Variable{name: "a"}, &Variable{name: "b"}, &Variable{name: "c"}, &Variable{name: "d"}
+	copyOf := func(id string, source, result *Variable) *Instruction {
+		return &Instruction{id: id, opcode: OpCopy, operands: []*Operand{varOperand(source)}, result: result}
+	}
+
+	// entry: a = 4; b = a; c = b
+	// exit:  d = c * 2
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{id: "a", opcode: OpConst, operands: []*Operand{constOperand(int64(4))}, result: a},
+		copyOf("b", a, b), copyOf("c", b, c),
+	}}
+	exit := &BasicBlock{id: "exit", instructions: []*Instruction{
+		{id: "d", opcode: OpMul, operands: []*Operand{varOperand(c), constOperand(int64(2))}, result: d},
+	}}
+	entry.successors = []*BasicBlock{exit}
+	context := &OptimizationContext{function: &Function{name: "copies", basicBlocks: []*BasicBlock{entry, exit}}}
+
+	result, err := (&ConstantPropagationTransformer{}).Transform(context)
+	if err != nil || result.metrics["operands_substituted"] != 3 {
+		t.Fatalf("期望沿复制链代入3个操作数，实际为%v %v", result.metrics["operands_substituted"], err)
+	}
+	if result.metrics["iterations"] < 2 {
+		t.Errorf("复制链应需要多轮迭代，实际为%v", result.metrics["iterations"])
+	}
+
+	folded, err := (&ConstantFoldingTransformer{}).Transform(context)
+	if err != nil || !folded.changed {
+		t.Fatalf("传播后的表达式应可折叠，实际为%v", err)
+	}
+	final := exit.instructions[0]
+	if final.opcode != OpConst || final.operands[0].constant != int64(8) {
+		t.Errorf("d应折叠为常量8，实际为%v", final.operands[0].constant)
+	}
+
+	engine := NewOptimizationEngine(OptimizationConfig{})
+	found := false
+	for _, pass := range engine.passManager.passes {
+		if pass.id == "constant_propagation" {
+			_, found = pass.transformer.(*ConstantPropagationTransformer)
+		}
+	}
+	if !found {
+		t.Error("应注册constant_propagation过程")
+	}
+}
+
+func TestConstantPropagationStopsAtStoreThroughPointer(t *testing.T) {
+	x, p, v, a, b, c := &Variable{name: "x"}, &Variable{name: "p"}, &Variable{name: "v"},
+		&Variable{name: "a"}, &Variable{name: "b"}, &Variable{name: "c"}
+	use := func(id string, result *Variable) *Instruction {
+		return &Instruction{id: id, opcode: OpAdd, operands: []*Operand{varOperand(x), constOperand(int64(1))}, result: result}
+	}
+
+	// entry: x = 1; p = &x; a = x + 1（代入1）; store p, v
+	// exit:  b = x + 1（x可能已被改写，不代入）; call g(p); c = x + 1（不代入）
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{id: "x", opcode: OpConst, operands: []*Operand{constOperand(int64(1))}, result: x},
+		{id: "p", opcode: OpAddr, operands: []*Operand{varOperand(x)}, result: p},
+		use("a", a),
+		{id: "store", opcode: OpStore, operands: []*Operand{varOperand(p), varOperand(v)}},
+	}}
+	exit := &BasicBlock{id: "exit", instructions: []*Instruction{
+		use("b", b),
+		{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("g"), varOperand(p)}},
+		use("c", c),
+	}}
+	entry.successors = []*BasicBlock{exit}
+	function := &Function{name: "alias", basicBlocks: []*BasicBlock{entry, exit}}
+
+	result, err := (&ConstantPropagationTransformer{}).Transform(&OptimizationContext{function: function})
+	if err != nil || result.metrics["operands_substituted"] != 1 {
+		t.Fatalf("期望只代入store之前的1个操作数，实际为%v %v", result.metrics["operands_substituted"], err)
+	}
+	if operand := entry.instructions[2].operands[0]; operand.kind != OperandConstant {
+		t.Error("store之前的x应代入常量1")
+	}
+	for _, inst := range []*Instruction{exit.instructions[0], exit.instructions[2]} {
+		if inst.operands[0].kind != OperandVariable {
+			t.Errorf("%s: 经指针写入后x不应代入常量", inst.id)
+		}
+	}
+}
+
+// ==================
+// 16. 尾调用优化
+// ==================
+
+func labelOperand(label string) *Operand {
+	return &Operand{kind: OperandLabel, label: label}
+}
+
+// newFactorialFunction 构造尾递归阶乘：
+// entry:   if n 跳转recurse，否则done
+// done:    return acc
+// recurse: n1 = n - 1; acc1 = acc * n; r = fact(n1, acc1); return r
+func newFactorialFunction() (*Function, map[string]*BasicBlock) {
+	n, acc, n1, acc1, r := &Variable{name: "n"}, &Variable{name: "acc"}, &Variable{name: "n1"}, &Variable{name: "acc1"}, &Variable{name: "r"}
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{id: "test", opcode: OpBranch, operands: []*Operand{varOperand(n)}},
+	}}
+	done := &BasicBlock{id: "done", instructions: []*Instruction{
+		{id: "ret-acc", opcode: OpReturn, operands: []*Operand{varOperand(acc)}},
+	}}
+	recurse := &BasicBlock{id: "recurse", instructions: []*Instruction{
+		{id: "dec", opcode: OpSub, operands: []*Operand{varOperand(n), constOperand(int64(1))}, result: n1},
+		{id: "mul", opcode: OpMul, operands: []*Operand{varOperand(acc), varOperand(n)}, result: acc1},
+		{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("fact"), varOperand(n1), varOperand(acc1)}, result: r},
+		{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(r)}},
+	}}
+	entry.successors = []*BasicBlock{recurse, done}
+	recurse.predecessors = []*BasicBlock{entry}
+	done.predecessors = []*BasicBlock{entry}
+
+	blocks := []*BasicBlock{entry, recurse, done}
+	function := &Function{
+		name:        "fact",
+		params:      []*Variable{n, acc},
+		basicBlocks: blocks,
+		cfg:         &ControlFlowGraph{entry: entry, blocks: blocks},
+	}
+	return function, map[string]*BasicBlock{"entry": entry, "done": done, "recurse": recurse}
+}
+
+func TestTailCallToLoopRewritesFactorial(t *testing.T) {
+	function, blocks := newFactorialFunction()
+	cfo := NewControlFlowOptimizer()
+	cfo.config.EnableTailCallOptimization = true
+
+	result := cfo.OptimizeControlFlow(&OptimizationContext{function: function})
+	if !result.optimized || cfo.statistics.TailCallsOptimized != 1 {
+		t.Fatalf("期望优化1个尾调用，实际为%d", cfo.statistics.TailCallsOptimized)
+	}
+
+	recurse, entry := blocks["recurse"], blocks["entry"]
+	var opcodes []Opcode
+	for _, inst := range recurse.instructions {
+		if inst.opcode == OpCall || inst.opcode == OpReturn {
+			t.Fatalf("尾调用块中不应再有call或return: %s", inst.id)
+		}
+		opcodes = append(opcodes, inst.opcode)
+	}
+	// 实参未读取形参，直接赋值，无需临时变量
+	if !reflect.DeepEqual(opcodes, []Opcode{OpSub, OpMul, OpCopy, OpCopy, OpBranch}) {
+		t.Fatalf("改写后的指令序列不正确: %v", opcodes)
+	}
+	copyN, copyAcc := recurse.instructions[2], recurse.instructions[3]
+	if copyN.result != function.params[0] || copyN.operands[0].variable.name != "n1" ||
+		copyAcc.result != function.params[1] || copyAcc.operands[0].variable.name != "acc1" {
+		t.Error("形参应依次被赋值为n1与acc1")
+	}
+	if back := recurse.instructions[4]; back.operands[0].label != "entry" {
+		t.Errorf("回边应跳转到entry，实际为%s", back.operands[0].label)
+	}
+	if len(recurse.successors) != 1 || recurse.successors[0] != entry {
+		t.Error("尾调用块的唯一后继应为入口")
+	}
+
+	// 改写后的控制流构成以entry为头的自然循环
+	loops := DetectLoops(function.cfg, BuildDominatorTree(function.cfg)).loops
+	if len(loops) != 1 || loops[0].header != entry {
+		t.Fatalf("期望识别出以entry为头的循环，实际为%d个", len(loops))
+	}
+
+	// 再次运行时已没有尾调用
+	cfo.OptimizeControlFlow(&OptimizationContext{function: function})
+	if cfo.statistics.TailCallsOptimized != 1 {
+		t.Errorf("重复优化不应再计数，实际为%d", cfo.statistics.TailCallsOptimized)
+	}
+}
+
+func TestTailCallSwapUsesTemporaries(t *testing.T) {
+	a, b, r := &Variable{name: "a"}, &Variable{name: "b"}, &Variable{name: "r"}
+	block := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("swap"), varOperand(b), varOperand(a)}, result: r},
+		{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(r)}},
+	}}
+	function := &Function{name: "swap", params: []*Variable{a, b}, basicBlocks: []*BasicBlock{block}}
+
+	if result := NewTailCallOptimizer().Optimize(function); result.optimizedCalls != 1 {
+		t.Fatalf("期望优化1个尾调用，实际为%d", result.optimizedCalls)
+	}
+	// a.tail = b; b.tail = a; a = a.tail; b = b.tail; branch entry
+	got := block.instructions
+	if len(got) != 5 || got[0].result.name != "a.tail" || got[0].operands[0].variable != b ||
+		got[2].result != a || got[2].operands[0].variable != got[0].result || got[3].result != b {
+		t.Fatalf("交换参数应先写入临时变量: %v", instructionIDs(function))
+	}
+	if len(block.successors) != 1 || block.successors[0] != block {
+		t.Error("入口块中的尾调用应形成自环")
+	}
+}
+
+func TestTailCallDetectionRejectsNonTailCalls(t *testing.T) {
+	x, r, s := &Variable{name: "x"}, &Variable{name: "r"}, &Variable{name: "s"}
+	tests := map[string][]*Instruction{
+		"结果参与运算": {
+			{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("f"), varOperand(x)}, result: r},
+			{id: "add", opcode: OpAdd, operands: []*Operand{varOperand(r), constOperand(int64(1))}, result: s},
+			{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(s)}},
+		},
+		"调用其他函数": {
+			{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("g"), varOperand(x)}, result: r},
+			{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(r)}},
+		},
+		"返回其他值": {
+			{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("f"), varOperand(x)}, result: r},
+			{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(x)}},
+		},
+		"实参个数不符": {
+			{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("f")}, result: r},
+			{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(r)}},
+		},
+	}
+	for name, instructions := range tests {
+		block := &BasicBlock{id: "entry", instructions: instructions}
+		function := &Function{name: "f", params: []*Variable{x}, basicBlocks: []*BasicBlock{block}}
+		if result := NewTailCallOptimizer().Optimize(function); result.optimizedCalls != 0 || len(block.instructions) != len(instructions) {
+			t.Errorf("%s: 不应改写非尾调用", name)
+		}
+	}
+}
+
+// ==================
+// 17. 跳转线程化
+// ==================
+
+// newThreadingFunction 构造两个前驱汇合到条件分支的函数：
+// entry: if x 跳转left，否则right
+// left:  c = <leftCond>; branch b
+// right: c = <rightCond>; branch b
+// b:     if c 跳转then，否则else
+// then/else -> exit
+func newThreadingFunction(leftCond, rightCond *Instruction) (*Function, map[string]*BasicBlock) {
+	x, c := &Variable{name: "x"}, &Variable{name: "c"}
+	leftCond.result, rightCond.result = c, c
+	names := []string{"entry", "left", "right", "b", "then", "else", "exit"}
+	blocks := newBlocks(names,
+		[2]string{"entry", "left"}, [2]string{"entry", "right"},
+		[2]string{"left", "b"}, [2]string{"right", "b"},
+		[2]string{"b", "then"}, [2]string{"b", "else"},
+		[2]string{"then", "exit"}, [2]string{"else", "exit"},
+	)
+	blocks["entry"].instructions = []*Instruction{{id: "test-x", opcode: OpBranch, operands: []*Operand{varOperand(x)}}}
+	blocks["left"].instructions = []*Instruction{leftCond, {id: "left-jmp", opcode: OpBranch, operands: []*Operand{labelOperand("b")}}}
+	blocks["right"].instructions = []*Instruction{rightCond, {id: "right-jmp", opcode: OpBranch, operands: []*Operand{labelOperand("b")}}}
+	blocks["b"].instructions = []*Instruction{{id: "test-c", opcode: OpBranch, operands: []*Operand{varOperand(c)}}}
+	blocks["exit"].instructions = []*Instruction{{id: "ret", opcode: OpReturn}}
+
+	cfg := &ControlFlowGraph{entry: blocks["entry"]}
+	function := &Function{name: "thread", cfg: cfg}
+	for _, name := range names {
+		block := blocks[name]
+		function.basicBlocks = append(function.basicBlocks, block)
+		for _, successor := range block.successors {
+			successor.predecessors = append(successor.predecessors, block)
+			cfg.edges = append(cfg.edges, &CFGEdge{source: block, target: successor, kind: EdgeConditional})
+		}
+	}
+	cfg.blocks = function.basicBlocks
+	return function, blocks
+}
+
+func TestJumpThreadingRedirectsKnownPredecessor(t *testing.T) {
+	function, blocks := newThreadingFunction(
+		&Instruction{id: "c1", opcode: OpConst, operands: []*Operand{constOperand(int64(1))}},
+		&Instruction{id: "c-load", opcode: OpLoad, operands: []*Operand{constOperand("addr")}},
+	)
+	cfo := NewControlFlowOptimizer()
+	cfo.config.EnableJumpThreading = true
+
+	result := cfo.OptimizeControlFlow(&OptimizationContext{function: function})
+	if !result.optimized || cfo.statistics.JumpsThreaded != 1 {
+		t.Fatalf("期望线程化1条边，实际为%d", cfo.statistics.JumpsThreaded)
+	}
+
+	left, right, b, then := blocks["left"], blocks["right"], blocks["b"], blocks["then"]
+	if len(left.successors) != 1 || left.successors[0] != then {
+		t.Fatal("left的c恒为1，应直接跳转then")
+	}
+	if label := left.instructions[1].operands[0].label; label != "then" {
+		t.Errorf("left的跳转标签应改为then，实际为%s", label)
+	}
+	if len(right.successors) != 1 || right.successors[0] != b {
+		t.Error("right的条件未知，仍应经过b")
+	}
+	if !reflect.DeepEqual(b.predecessors, []*BasicBlock{right}) || !containsBlock(then.predecessors, left) {
+		t.Error("前驱列表应随边的改写更新")
+	}
+	for _, edge := range function.cfg.edges {
+		if edge.source == left && edge.target != then {
+			t.Errorf("CFG边left->%s应改为left->then", edge.target.id)
+		}
+	}
+	if len(function.basicBlocks) != 7 {
+		t.Errorf("没有块变为不可达，实际剩余%d个块", len(function.basicBlocks))
+	}
+}
+
+func TestJumpThreadingRemovesBypassedBlock(t *testing.T) {
+	function, blocks := newThreadingFunction(
+		&Instruction{id: "c1", opcode: OpConst, operands: []*Operand{constOperand(int64(1))}},
+		&Instruction{id: "c0", opcode: OpConst, operands: []*Operand{constOperand(int64(0))}},
+	)
+	result := NewJumpThreading().Thread(function)
+	if result.threadedEdges != 2 || result.removedBlocks != 1 {
+		t.Fatalf("期望线程化2条边并删除1个块，实际为%d/%d", result.threadedEdges, result.removedBlocks)
+	}
+	if blocks["left"].successors[0] != blocks["then"] || blocks["right"].successors[0] != blocks["else"] {
+		t.Error("left应跳转then，right应跳转else")
+	}
+	for _, block := range function.basicBlocks {
+		if block == blocks["b"] {
+			t.Fatal("b已不可达，应被删除")
+		}
+	}
+	for _, edge := range function.cfg.edges {
+		if edge.source == blocks["b"] || edge.target == blocks["b"] {
+			t.Fatal("CFG中不应再有与b相连的边")
+		}
+	}
+	if len(blocks["then"].predecessors) != 1 || len(blocks["else"].predecessors) != 1 {
+		t.Error("then与else应只剩线程化后的前驱")
+	}
+}
+
+// ==================
+// 18. 基本块合并
+// ==================
+
+func TestBlockMergingCollapsesLinearChain(t *testing.T) {
+	// a -> b -> c -> d，每块以跳往下一块的无条件跳转结尾
+	x := &Variable{name: "x"}
+	names := []string{"a", "b", "c", "d"}
+	blocks := newBlocks(names, [2]string{"a", "b"}, [2]string{"b", "c"}, [2]string{"c", "d"})
+	cfg := &ControlFlowGraph{}
+	function := &Function{name: "chain", cfg: cfg}
+	for i, name := range names {
+		block := blocks[name]
+		block.instructions = []*Instruction{{id: name + "-add", opcode: OpAdd, operands: []*Operand{varOperand(x), constOperand(int64(i))}, result: x, block: block}}
+		if i+1 < len(names) {
+			block.instructions = append(block.instructions, &Instruction{id: name + "-jmp", opcode: OpBranch, operands: []*Operand{labelOperand(names[i+1])}, block: block})
+			next := blocks[names[i+1]]
+			next.predecessors = []*BasicBlock{block}
+			cfg.edges = append(cfg.edges, &CFGEdge{source: block, target: next, kind: EdgeUnconditional})
+		} else {
+			block.instructions = append(block.instructions, &Instruction{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(x)}, block: block})
+		}
+		function.basicBlocks = append(function.basicBlocks, block)
+		function.instructions = append(function.instructions, block.instructions...)
+	}
+	cfg.blocks = function.basicBlocks
+
+	cfo := NewControlFlowOptimizer()
+	cfo.config.EnableBlockMerging = true
+	result := cfo.OptimizeControlFlow(&OptimizationContext{function: function})
+	if !result.optimized || cfo.statistics.BlocksMerged != 3 {
+		t.Fatalf("期望合并3个块，实际为%d", cfo.statistics.BlocksMerged)
+	}
+
+	a := blocks["a"]
+	if len(function.basicBlocks) != 1 || function.basicBlocks[0] != a || len(cfg.blocks) != 1 || len(cfg.edges) != 0 {
+		t.Fatalf("链应合并为单个块a，实际剩余%d个块、%d条边", len(function.basicBlocks), len(cfg.edges))
+	}
+	expected := []string{"a-add", "b-add", "c-add", "d-add", "ret"}
+	if got := instructionIDs(function); !reflect.DeepEqual(got, expected) {
+		t.Errorf("合并后的指令应为%v，实际为%v", expected, got)
+	}
+	for _, inst := range a.instructions {
+		if inst.block != a {
+			t.Errorf("%s应归属合并后的块a", inst.id)
+		}
+	}
+	if len(a.successors) != 0 {
+		t.Error("合并后的块应接管d的后继（无）")
+	}
+}
+
+func TestBlockMergingSkipsJoinWithMultiplePredecessors(t *testing.T) {
+	// entry -> left | right -> join
+	blocks := newBlocks([]string{"entry", "left", "right", "join"},
+		[2]string{"entry", "left"}, [2]string{"entry", "right"},
+		[2]string{"left", "join"}, [2]string{"right", "join"},
+	)
+	function := &Function{name: "diamond"}
+	for _, name := range []string{"entry", "left", "right", "join"} {
+		blocks[name].instructions = []*Instruction{{id: name, opcode: OpBranch}}
+		function.basicBlocks = append(function.basicBlocks, blocks[name])
+	}
+
+	if result := NewBlockMerger().Merge(function); result.mergedBlocks != 0 {
+		t.Fatalf("不应合并任何块，实际合并%d个", result.mergedBlocks)
+	}
+	if len(function.basicBlocks) != 4 || len(blocks["left"].successors) != 1 || blocks["left"].successors[0] != blocks["join"] {
+		t.Error("多前驱的join及分支后继应保持原样")
+	}
+}
+
+// ==================
+// 19. 循环不变代码外提
+// ==================
+
+func TestLoopInvariantCodeMotionHoistsPureExpressions(t *testing.T) {
+	a, b, p, i, q, k, m, v := &Variable{name: "a"}, &Variable{name: "b"}, &Variable{name: "p"}, &Variable{name: "i"},
+		&Variable{name: "q"}, &Variable{name: "k"}, &Variable{name: "m"}, &Variable{name: "v"}
+
+	// entry:  i = 0; branch header
+	// header: q = a / b; if i 跳转body，否则exit（header支配出口，可能陷入的除法也能外提）
+	// body:   k = a * b; m = k + 1; if i 跳转then，否则latch
+	// then:   v = load p（条件执行的读内存，不外提）
+	// latch:  i = i + 1; branch header
+	names := []string{"entry", "header", "body", "then", "latch", "exit"}
+	blocks := newBlocks(names,
+		[2]string{"entry", "header"},
+		[2]string{"header", "body"}, [2]string{"header", "exit"},
+		[2]string{"body", "then"}, [2]string{"body", "latch"},
+		[2]string{"then", "latch"}, [2]string{"latch", "header"},
+	)
+	blocks["entry"].instructions = []*Instruction{
+		{id: "i0", opcode: OpConst, operands: []*Operand{constOperand(int64(0))}, result: i},
+		{id: "entry-jmp", opcode: OpBranch, operands: []*Operand{labelOperand("header")}},
+	}
+	blocks["header"].instructions = []*Instruction{
+		{id: "q", opcode: OpDiv, operands: []*Operand{varOperand(a), varOperand(b)}, result: q},
+		{id: "test-i", opcode: OpBranch, operands: []*Operand{varOperand(i)}},
+	}
+	blocks["body"].instructions = []*Instruction{
+		{id: "k", opcode: OpMul, operands: []*Operand{varOperand(a), varOperand(b)}, result: k},
+		{id: "m", opcode: OpAdd, operands: []*Operand{varOperand(k), constOperand(int64(1))}, result: m},
+		{id: "test-body", opcode: OpBranch, operands: []*Operand{varOperand(i)}},
+	}
+	blocks["then"].instructions = []*Instruction{{id: "v", opcode: OpLoad, operands: []*Operand{varOperand(p)}, result: v}}
+	blocks["latch"].instructions = []*Instruction{
+		{id: "inc", opcode: OpAdd, operands: []*Operand{varOperand(i), constOperand(int64(1))}, result: i},
+		{id: "latch-jmp", opcode: OpBranch, operands: []*Operand{labelOperand("header")}},
+	}
+	blocks["exit"].instructions = []*Instruction{{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(q)}}}
+	function := &Function{name: "licm", params: []*Variable{a, b, p}}
+	for _, name := range names {
+		function.basicBlocks = append(function.basicBlocks, blocks[name])
+	}
+	function.cfg = &ControlFlowGraph{blocks: function.basicBlocks}
+
+	lo := NewLoopOptimizer()
+	lo.config.EnableInvariantMotion = true
+	results := lo.OptimizeLoops(&OptimizationContext{function: function})
+	if len(results) != 1 || lo.statistics.InvariantInstructions != 3 {
+		t.Fatalf("期望外提3条指令，实际为%d", lo.statistics.InvariantInstructions)
+	}
+
+	ids := func(block *BasicBlock) []string {
+		var ids []string
+		for _, inst := range block.instructions {
+			ids = append(ids, inst.id)
+		}
+		return ids
+	}
+	// entry唯一后继是循环头，直接作为前置块，外提的指令放在跳转之前并保持依赖顺序
+	if got := ids(blocks["entry"]); !reflect.DeepEqual(got, []string{"i0", "q", "k", "m", "entry-jmp"}) {
+		t.Errorf("前置块指令不正确: %v", got)
+	}
+	if got := ids(blocks["then"]); !reflect.DeepEqual(got, []string{"v"}) {
+		t.Errorf("条件执行的load不应外提: %v", got)
+	}
+	if got := ids(blocks["latch"]); !reflect.DeepEqual(got, []string{"inc", "latch-jmp"}) {
+		t.Errorf("依赖循环变量的指令不应外提: %v", got)
+	}
+	if lo.loopInvariantMotion.preheader != blocks["entry"] {
+		t.Error("前置块应为entry")
+	}
+}
+
+func TestLoopInvariantCodeMotionCreatesPreheader(t *testing.T) {
+	a, b, i, k := &Variable{name: "a"}, &Variable{name: "b"}, &Variable{name: "i"}, &Variable{name: "k"}
+
+	// entry -> left | right，两者都进入自环loop，需要新建前置块
+	names := []string{"entry", "left", "right", "loop", "exit"}
+	blocks := newBlocks(names,
+		[2]string{"entry", "left"}, [2]string{"entry", "right"},
+		[2]string{"left", "loop"}, [2]string{"right", "loop"},
+		[2]string{"loop", "loop"}, [2]string{"loop", "exit"},
+	)
+	blocks["loop"].instructions = []*Instruction{
+		{id: "k", opcode: OpAdd, operands: []*Operand{varOperand(a), varOperand(b)}, result: k},
+		{id: "load", opcode: OpLoad, operands: []*Operand{varOperand(k)}, result: i},
+		{id: "store", opcode: OpStore, operands: []*Operand{varOperand(k), varOperand(i)}},
+		{id: "test", opcode: OpBranch, operands: []*Operand{varOperand(i)}},
+	}
+	function := &Function{name: "preheader", params: []*Variable{a, b}}
+	for _, name := range names {
+		function.basicBlocks = append(function.basicBlocks, blocks[name])
+		function.instructions = append(function.instructions, blocks[name].instructions...)
+	}
+	function.cfg = &ControlFlowGraph{blocks: function.basicBlocks}
+	function.domTree = BuildDominatorTree(function.cfg)
+	function.loopInfo = DetectLoops(function.cfg, function.domTree)
+
+	licm := NewLoopInvariantCodeMotion()
+	result := licm.Hoist(function, function.loopInfo.loops[0])
+	if result.hoistedCount != 1 || result.speedupEstimate <= 0 {
+		t.Fatalf("期望只外提k，实际外提%d条", result.hoistedCount)
+	}
+
+	preheader := licm.preheader
+	if preheader == nil || preheader == blocks["left"] || preheader == blocks["right"] {
+		t.Fatal("循环头有两个循环外前驱时应新建前置块")
+	}
+	if blocks["left"].successors[0] != preheader || blocks["right"].successors[0] != preheader ||
+		len(preheader.successors) != 1 || preheader.successors[0] != blocks["loop"] {
+		t.Error("循环外的入边应改接到前置块")
+	}
+	if len(preheader.instructions) != 2 || preheader.instructions[0].id != "k" || preheader.instructions[1].opcode != OpBranch {
+		t.Errorf("前置块应包含外提的k和跳往循环头的跳转，实际为%d条指令", len(preheader.instructions))
+	}
+	// 循环内有写内存，load不能外提
+	var flat []string
+	for _, inst := range function.instructions {
+		flat = append(flat, inst.id)
+	}
+	if !reflect.DeepEqual(flat, []string{"k", "loop.preheader.jmp", "load", "store", "test"}) {
+		t.Errorf("扁平指令列表应把前置块放在循环头之前: %v", flat)
+	}
+	if !function.domTree.Dominates(preheader, blocks["loop"]) {
+		t.Error("新建前置块后支配树应重新计算")
+	}
+}
+
+// ==================
+// 20. 循环展开
+// ==================
+
+// newCountedLoopFunction 构造求和循环：
+// entry: i = start; s = 0; branch loop
+// loop:  s = s + i; i = i - 1; if i 跳转loop，否则exit
+// exit:  return s
+func newCountedLoopFunction(start int64) (*Function, map[string]*BasicBlock) {
+	i, sum := &Variable{name: "i"}, &Variable{name: "s"}
+	names := []string{"entry", "loop", "exit"}
+	blocks := newBlocks(names, [2]string{"entry", "loop"}, [2]string{"loop", "loop"}, [2]string{"loop", "exit"})
+	blocks["entry"].instructions = []*Instruction{
+		{id: "i0", opcode: OpConst, operands: []*Operand{constOperand(start)}, result: i},
+		{id: "s0", opcode: OpConst, operands: []*Operand{constOperand(int64(0))}, result: sum},
+		{id: "entry-jmp", opcode: OpBranch, operands: []*Operand{labelOperand("loop")}},
+	}
+	blocks["loop"].instructions = []*Instruction{
+		{id: "acc", opcode: OpAdd, operands: []*Operand{varOperand(sum), varOperand(i)}, result: sum},
+		{id: "dec", opcode: OpSub, operands: []*Operand{varOperand(i), constOperand(int64(1))}, result: i},
+		{id: "test", opcode: OpBranch, operands: []*Operand{varOperand(i)}},
+	}
+	blocks["exit"].instructions = []*Instruction{{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(sum)}}}
+	function := &Function{name: "sum"}
+	for _, name := range names {
+		function.basicBlocks = append(function.basicBlocks, blocks[name])
+		function.instructions = append(function.instructions, blocks[name].instructions...)
+	}
+	function.cfg = &ControlFlowGraph{blocks: function.basicBlocks}
+	return function, blocks
+}
+
+// interpret 解释执行只含整数常量、加减和分支的函数，返回return的值
+func interpret(t *testing.T, function *Function) int64 {
+	t.Helper()
+	values := make(map[*Variable]int64)
+	value := func(operand *Operand) int64 {
+		if operand.kind == OperandConstant {
+			return operand.constant.(int64)
+		}
+		return values[operand.variable]
+	}
+	block := function.basicBlocks[0]
+	for steps := 0; steps < 100000; steps++ {
+		next := (*BasicBlock)(nil)
+		for _, inst := range block.instructions {
+			switch inst.opcode {
+			case OpConst, OpCopy:
+				values[inst.result] = value(inst.operands[0])
+			case OpAdd:
+				values[inst.result] = value(inst.operands[0]) + value(inst.operands[1])
+			case OpSub:
+				values[inst.result] = value(inst.operands[0]) - value(inst.operands[1])
+			case OpReturn:
+				return value(inst.operands[0])
+			case OpBranch:
+				next = block.successors[0]
+				if len(block.successors) == 2 && value(inst.operands[0]) == 0 {
+					next = block.successors[1]
+				}
+			}
+		}
+		if next == nil {
+			next = block.successors[0]
+		}
+		block = next
+	}
+	t.Fatal("解释执行超出步数限制")
+	return 0
+}
+
+func TestLoopUnrollingCompletelyUnrollsSmallTripCount(t *testing.T) {
+	function, blocks := newCountedLoopFunction(5)
+	lo := NewLoopOptimizer()
+	lo.config.EnableUnrolling = true
+	results := lo.OptimizeLoops(&OptimizationContext{function: function})
+	if len(results) != 1 || lo.statistics.UnrolledLoops != 1 || results[0].optimizations[0].factor != 5 {
+		t.Fatalf("期望以因子5完全展开，实际为%v", results)
+	}
+
+	loop := blocks["loop"]
+	expected := []string{"acc", "dec", "acc.u1", "dec.u1", "acc.u2", "dec.u2", "acc.u3", "dec.u3", "acc.u4", "dec.u4", "test"}
+	var got []string
+	for _, inst := range loop.instructions {
+		got = append(got, inst.id)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("完全展开后的指令不正确: %v", got)
+	}
+	if jump := loop.instructions[len(loop.instructions)-1]; jump.operands[0].kind != OperandLabel || jump.operands[0].label != "exit" {
+		t.Error("末尾应改为跳往exit的无条件跳转")
+	}
+	if len(loop.successors) != 1 || loop.successors[0] != blocks["exit"] {
+		t.Error("完全展开后不应再有自环")
+	}
+	if loops := DetectLoops(function.cfg, BuildDominatorTree(function.cfg)).loops; len(loops) != 0 {
+		t.Errorf("完全展开后不应再识别出循环，实际为%d个", len(loops))
+	}
+	if !reflect.DeepEqual(instructionIDs(function), idsOf(function.instructions)) {
+		t.Error("扁平指令列表应与基本块保持一致")
+	}
+	if sum := interpret(t, function); sum != 15 {
+		t.Errorf("展开后求和结果应为15，实际为%d", sum)
+	}
+}
+
+func TestLoopUnrollingHugeTripCountDoesNotOverflow(t *testing.T) {
+	// 2^62次迭代乘以2条指令会溢出为负数，不能因此判定为小循环而完全展开
+	function, blocks := newCountedLoopFunction(int64(1) << 62)
+	unrolling := NewLoopUnrolling()
+	loop := DetectLoops(function.cfg, BuildDominatorTree(function.cfg)).loops[0]
+
+	result := unrolling.Unroll(function, loop)
+	if !result.unrolled || result.factor != 4 {
+		t.Fatalf("期望按因子4部分展开，实际unrolled=%v、因子%d", result.unrolled, result.factor)
+	}
+	if len(blocks["loop"].successors) != 2 || len(blocks["loop"].instructions) != 9 {
+		t.Errorf("部分展开后应保留自环且循环体展开4份，实际%d条指令", len(blocks["loop"].instructions))
+	}
+}
+
+func TestLoopUnrollingPartiallyUnrollsLargeTripCount(t *testing.T) {
+	const start = 1003
+	tests := []struct {
+		name      string
+		handling  RemainderHandling
+		unrolled  bool
+		blocks    []string
+		entrySize int
+	}{
+		{"独立余数循环", RemainderSeparate, true, []string{"entry", "loop.remainder", "loop", "exit"}, 4},
+		{"余数内联", RemainderInline, true, []string{"entry", "loop", "exit"}, 9},
+		{"忽略余数", RemainderIgnore, false, []string{"entry", "loop", "exit"}, 3},
+	}
+	for _, test := range tests {
+		function, blocks := newCountedLoopFunction(start)
+		unrolling := NewLoopUnrolling()
+		unrolling.remainderHandling = test.handling
+		loop := DetectLoops(function.cfg, BuildDominatorTree(function.cfg)).loops[0]
+
+		result := unrolling.Unroll(function, loop)
+		if result.unrolled != test.unrolled {
+			t.Fatalf("%s: 期望unrolled=%v", test.name, test.unrolled)
+		}
+		if got := blockIDs(function.basicBlocks); !reflect.DeepEqual(got, test.blocks) {
+			t.Errorf("%s: 基本块应为%v，实际为%v", test.name, test.blocks, got)
+		}
+		if len(blocks["entry"].instructions) != test.entrySize {
+			t.Errorf("%s: 前置块应有%d条指令，实际为%d", test.name, test.entrySize, len(blocks["entry"].instructions))
+		}
+		if !reflect.DeepEqual(instructionIDs(function), idsOf(function.instructions)) {
+			t.Errorf("%s: 扁平指令列表应与基本块保持一致", test.name)
+		}
+		if sum := interpret(t, function); sum != start*(start+1)/2 {
+			t.Errorf("%s: 求和结果应为%d，实际为%d", test.name, start*(start+1)/2, sum)
+		}
+		if !test.unrolled {
+			continue
+		}
+		// 1003次迭代超出代码量阈值，按因子4展开，余下3次迭代在主循环之前执行
+		if result.factor != 4 || len(blocks["loop"].instructions) != 9 {
+			t.Errorf("%s: 期望主循环展开4份，实际因子%d、%d条指令", test.name, result.factor, len(blocks["loop"].instructions))
+		}
+	}
+}
+
+func idsOf(instructions []*Instruction) []string {
+	var ids []string
+	for _, inst := range instructions {
+		ids = append(ids, inst.id)
+	}
+	return ids
+}
+
+// ==================
+// 21. 别名分析
+// ==================
+
+func TestAliasAnalysisAndersen(t *testing.T) {
+	x, y, z, p, q, r, s, pp, loaded, arg, ret, escaped, e :=
+		&Variable{name: "x"}, &Variable{name: "y"}, &Variable{name: "z"}, &Variable{name: "p"}, &Variable{name: "q"},
+		&Variable{name: "r"}, &Variable{name: "s"}, &Variable{name: "pp"}, &Variable{name: "loaded"},
+		&Variable{name: "arg"}, &Variable{name: "ret"}, &Variable{name: "escaped"}, &Variable{name: "e"}
+
+	// p = &x; q = &y; r = p（复制）; s = p + 8（指针算术）
+	// pp = &p; *pp = q（经由pp改写p）; loaded = *pp
+	// e = &z; call f(e)（z逃逸）; ret = call g()
+	// arg为形参，指向函数外部的未知内存
+	block := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{id: "p", opcode: OpAddr, operands: []*Operand{varOperand(x)}, result: p},
+		{id: "q", opcode: OpAddr, operands: []*Operand{varOperand(y)}, result: q},
+		{id: "r", opcode: OpCopy, operands: []*Operand{varOperand(p)}, result: r},
+		{id: "s", opcode: OpAdd, operands: []*Operand{varOperand(p), constOperand(int64(8))}, result: s},
+		{id: "pp", opcode: OpAddr, operands: []*Operand{varOperand(p)}, result: pp},
+		{id: "store", opcode: OpStore, operands: []*Operand{varOperand(pp), varOperand(q)}},
+		{id: "load", opcode: OpLoad, operands: []*Operand{varOperand(pp)}, result: loaded},
+		{id: "e", opcode: OpAddr, operands: []*Operand{varOperand(z)}, result: e},
+		{id: "call-f", opcode: OpCall, operands: []*Operand{labelOperand("f"), varOperand(e)}},
+		{id: "call-g", opcode: OpCall, operands: []*Operand{labelOperand("g")}, result: ret},
+		{id: "escaped", opcode: OpLoad, operands: []*Operand{varOperand(arg)}, result: escaped},
+	}}
+	function := &Function{name: "alias", params: []*Variable{arg}, basicBlocks: []*BasicBlock{block}}
+
+	flow := NewDataFlowAnalyzer().AnalyzeDataFlow(&OptimizationContext{function: function}, DataFlowAlias)
+	result, ok := flow.results["alias"].(*AliasResult)
+	if !ok || flow.iterations == 0 {
+		t.Fatalf("期望得到*AliasResult，实际为%T", flow.results["alias"])
+	}
+
+	names := func(variables []*Variable) []string {
+		var names []string
+		for _, variable := range variables {
+			names = append(names, variable.name)
+		}
+		return names
+	}
+	// 经由*pp = q，p也可能指向y
+	if got := names(result.PointsTo(p)); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("pts(p)应为[x y]，实际为%v", got)
+	}
+	if got := names(result.PointsTo(loaded)); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("pts(loaded)应为[x y]，实际为%v", got)
+	}
+
+	tests := []struct {
+		name string
+		a, b *Variable
+		want AliasPrecision
+	}{
+		{"同一指针", p, p, PrecisionMustAlias},
+		{"非指针变量", q, &Variable{name: "unused"}, PrecisionNoAlias},
+		{"复制的指针", p, r, PrecisionMayAlias},
+		{"指针算术", s, q, PrecisionMayAlias},
+		{"经由存储改写", p, q, PrecisionMayAlias},
+		{"只指向y与只指向z", q, e, PrecisionNoAlias},
+		{"指向x或y与只指向z", p, e, PrecisionNoAlias},
+		{"二级指针与指向x", pp, p, PrecisionNoAlias},
+		{"调用结果可能指向逃逸的z", ret, e, PrecisionMayAlias},
+		{"形参所指内存可能指向逃逸的z", escaped, e, PrecisionMayAlias},
+		{"形参不会指向未逃逸的x", arg, p, PrecisionNoAlias},
+	}
+	for _, test := range tests {
+		if got := result.MayAlias(test.a, test.b); got != test.want {
+			t.Errorf("%s: 期望%v，实际为%v", test.name, test.want, got)
+		}
+	}
+
+	// 两个指针只指向同一个位置时必然别名
+	w := &Variable{name: "w"}
+	block.instructions = append(block.instructions, &Instruction{id: "w", opcode: OpAddr, operands: []*Operand{varOperand(y)}, result: w})
+	if got := NewAliasAnalyzer().Analyze(function).(*AliasResult).MayAlias(q, w); got != PrecisionMustAlias {
+		t.Errorf("q与w都只指向y，期望PrecisionMustAlias，实际为%v", got)
+	}
+}
+
+// ==================
+// 22. 函数内联
+// ==================
+
+// newCallGraph 为函数建立共享的调用图，节点按函数名索引
+func newCallGraph(functions ...*Function) (*CallGraph, map[string]*CallNode) {
+	graph := &CallGraph{}
+	nodes := make(map[string]*CallNode, len(functions))
+	for _, function := range functions {
+		node := &CallNode{function: function}
+		nodes[function.name] = node
+		graph.nodes = append(graph.nodes, node)
+		function.callGraph = graph
+	}
+	return graph, nodes
+}
+
+// connect 在调用图中添加调用边并维护节点的调用关系
+func connect(graph *CallGraph, caller, callee *CallNode, callSite *Instruction) {
+	graph.edges = append(graph.edges, &CallEdge{caller: caller, callee: callee, callSite: callSite})
+	if !containsCallNode(caller.callees, callee) {
+		caller.callees = append(caller.callees, callee)
+		callee.callers = append(callee.callers, caller)
+	}
+}
+
+func TestInliningLeafFunction(t *testing.T) {
+	x, r := &Variable{name: "x"}, &Variable{name: "r"}
+	add1 := &Function{name: "add1", params: []*Variable{x}, metadata: &FunctionMetadata{}, basicBlocks: []*BasicBlock{{id: "entry", instructions: []*Instruction{
+		{id: "r", opcode: OpAdd, operands: []*Operand{varOperand(x), constOperand(int64(1))}, result: r},
+		{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(r)}},
+	}}}}
+
+	a, b := &Variable{name: "a"}, &Variable{name: "b"}
+	call := &Instruction{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("add1"), varOperand(a)}, result: b}
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{id: "a", opcode: OpConst, operands: []*Operand{constOperand(int64(5))}, result: a},
+		call,
+		{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(b)}},
+	}}
+	caller := &Function{name: "main", basicBlocks: []*BasicBlock{entry}, instructions: append([]*Instruction(nil), entry.instructions...)}
+	graph, nodes := newCallGraph(caller, add1)
+	connect(graph, nodes["main"], nodes["add1"], call)
+
+	result, err := NewInliningTransformer(InliningConfig{}).Transform(&OptimizationContext{function: caller})
+	if err != nil || !result.changed || result.metrics["calls_inlined"] != 1 || result.metrics["instructions_added"] != 2 {
+		t.Fatalf("期望内联1个调用点，实际为%v %v", result.metrics, err)
+	}
+
+	// 单块被调函数直接拼接：形参x替换为实参a，返回值复制给b
+	if got := instructionIDs(caller); !reflect.DeepEqual(got, []string{"a", "call.r", "call.ret", "ret"}) {
+		t.Fatalf("内联后的指令不正确: %v", got)
+	}
+	if !reflect.DeepEqual(idsOf(caller.instructions), instructionIDs(caller)) {
+		t.Error("扁平指令列表应与基本块保持一致")
+	}
+	body, assign := entry.instructions[1], entry.instructions[2]
+	if body.operands[0].variable != a || body.result == r || body.block != entry {
+		t.Error("形参应替换为实参，被调函数的局部变量应重命名")
+	}
+	if assign.opcode != OpCopy || assign.result != b || assign.operands[0].variable != body.result {
+		t.Error("返回值应复制给调用的结果变量")
+	}
+	if len(graph.edges) != 0 || len(nodes["main"].callees) != 0 || len(nodes["add1"].callers) != 0 {
+		t.Error("内联后应从调用图中删除调用边")
+	}
+	if !add1.metadata.inlined {
+		t.Error("被调函数应标记为已内联")
+	}
+	if got := interpret(t, caller); got != 6 {
+		t.Errorf("内联后结果应为6，实际为%d", got)
+	}
+}
+
+func TestInliningKeepsGlobalVariables(t *testing.T) {
+	// bump: counter = counter + 1; tmp = counter; return tmp
+	counter, tmp := &Variable{name: "counter"}, &Variable{name: "tmp"}
+	bump := &Function{name: "bump", basicBlocks: []*BasicBlock{{id: "entry", instructions: []*Instruction{
+		{id: "inc", opcode: OpAdd, operands: []*Operand{varOperand(counter), constOperand(int64(1))}, result: counter},
+		{id: "tmp", opcode: OpCopy, operands: []*Operand{varOperand(counter)}, result: tmp},
+		{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(tmp)}},
+	}}}}
+
+	// main: counter = 41; call bump(); r = counter; return r
+	r := &Variable{name: "r"}
+	call := &Instruction{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("bump")}}
+	entry := &BasicBlock{id: "entry", instructions: []*Instruction{
+		{id: "init", opcode: OpConst, operands: []*Operand{constOperand(int64(41))}, result: counter},
+		call,
+		{id: "r", opcode: OpCopy, operands: []*Operand{varOperand(counter)}, result: r},
+		{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(r)}},
+	}}
+	caller := &Function{name: "main", basicBlocks: []*BasicBlock{entry}}
+	graph, nodes := newCallGraph(caller, bump)
+	connect(graph, nodes["main"], nodes["bump"], call)
+	module := &Module{name: "m", functions: []*Function{caller, bump}, globals: []*GlobalVariable{{name: "counter"}}}
+
+	result, err := NewInliningTransformer(InliningConfig{}).Transform(&OptimizationContext{function: caller, module: module})
+	if err != nil || result.metrics["calls_inlined"] != 1 {
+		t.Fatalf("期望内联1个调用点，实际为%v %v", result.metrics, err)
+	}
+	inc, copied := entry.instructions[1], entry.instructions[2]
+	if inc.result != counter || inc.operands[0].variable != counter {
+		t.Error("被调函数写入的全局变量应保持原有身份")
+	}
+	if copied.result == tmp {
+		t.Error("被调函数的局部变量应重命名")
+	}
+	if got := interpret(t, caller); got != 42 {
+		t.Errorf("内联后调用者应看到全局变量的写入，期望42，实际为%d", got)
+	}
+}
+
+func TestInliningThroughPassManagerCommitsCallGraph(t *testing.T) {
+	// main调用wrap，wrap调用log；经过管道内联后调用图中应只剩main到log的边
+	x := &Variable{name: "x"}
+	inner := &Instruction{id: "log", opcode: OpCall, operands: []*Operand{labelOperand("log"), varOperand(x)}}
+	wrap := &Function{name: "wrap", params: []*Variable{x}, basicBlocks: []*BasicBlock{{id: "entry", instructions: []*Instruction{
+		inner, {id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(x)}},
+	}}}}
+	logFunction := &Function{name: "log"}
+
+	a, b := &Variable{name: "a"}, &Variable{name: "b"}
+	call := &Instruction{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("wrap"), varOperand(a)}, result: b}
+	caller := &Function{name: "main", basicBlocks: []*BasicBlock{{id: "entry", instructions: []*Instruction{call}}}}
+	graph, nodes := newCallGraph(caller, wrap, logFunction)
+	connect(graph, nodes["main"], nodes["wrap"], call)
+	connect(graph, nodes["wrap"], nodes["log"], inner)
+
+	pm := NewPassManager()
+	pass := newTestPass("function_inlining")
+	pass.transformer = NewInliningTransformer(InliningConfig{})
+	if err := pm.RegisterPass(pass); err != nil {
+		t.Fatalf("注册失败: %v", err)
+	}
+	context := newAdaptiveTestContext()
+	context.function = caller
+	if result := pm.ExecutePipeline(context); !result.Results["function_inlining"].Changed {
+		t.Fatalf("期望经过管道内联成功，实际为%+v", result.Results["function_inlining"])
+	}
+
+	if context.function != caller || caller.callGraph != graph || nodes["main"].function != caller {
+		t.Fatal("提交后函数、调用图和节点应保持原有身份")
+	}
+	var edge *CallEdge
+	for _, candidate := range graph.edges {
+		if candidate.caller == nodes["main"] {
+			edge = candidate
+		}
+	}
+	if edge == nil || edge.callee != nodes["log"] || edge.callSite.block != caller.basicBlocks[0] {
+		t.Fatalf("main到log的边应指向调用者中的副本调用点，实际为%+v", edge)
+	}
+	if !containsCallNode(nodes["main"].callees, nodes["log"]) || containsCallNode(nodes["main"].callees, nodes["wrap"]) {
+		t.Error("main的被调节点应从wrap换为log")
+	}
+}
+
+func TestInliningMultiBlockCallee(t *testing.T) {
+	// pick(x): entry: if x 跳转pos，否则zero; pos: log(x); return x; zero: return 7
+	x := &Variable{name: "x"}
+	names := []string{"entry", "pos", "zero"}
+	calleeBlocks := newBlocks(names, [2]string{"entry", "pos"}, [2]string{"entry", "zero"})
+	logCall := &Instruction{id: "log", opcode: OpCall, operands: []*Operand{labelOperand("log"), varOperand(x)}}
+	calleeBlocks["entry"].instructions = []*Instruction{{id: "test", opcode: OpBranch, operands: []*Operand{varOperand(x)}}}
+	calleeBlocks["pos"].instructions = []*Instruction{logCall, {id: "ret-x", opcode: OpReturn, operands: []*Operand{varOperand(x)}}}
+	calleeBlocks["zero"].instructions = []*Instruction{{id: "ret-7", opcode: OpReturn, operands: []*Operand{constOperand(int64(7))}}}
+	pick := &Function{name: "pick", params: []*Variable{x}}
+	for _, name := range names {
+		pick.basicBlocks = append(pick.basicBlocks, calleeBlocks[name])
+	}
+
+	// main: a = 0; b = pick(a); c = b + 1; return c
+	a, b, c := &Variable{name: "a"}, &Variable{name: "b"}, &Variable{name: "c"}
+	call := &Instruction{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("pick"), varOperand(a)}, result: b}
+	entry := &BasicBlock{id: "main", instructions: []*Instruction{
+		{id: "a", opcode: OpConst, operands: []*Operand{constOperand(int64(0))}, result: a},
+		call,
+		{id: "c", opcode: OpAdd, operands: []*Operand{varOperand(b), constOperand(int64(1))}, result: c},
+		{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(c)}},
+	}}
+	caller := &Function{name: "main", basicBlocks: []*BasicBlock{entry}}
+	caller.cfg = &ControlFlowGraph{blocks: caller.basicBlocks}
+	log := &Function{name: "log"}
+	graph, nodes := newCallGraph(caller, pick, log)
+	connect(graph, nodes["main"], nodes["pick"], call)
+	connect(graph, nodes["pick"], nodes["log"], logCall)
+
+	result, _ := NewInliningTransformer(InliningConfig{}).Transform(&OptimizationContext{function: caller})
+	if result.metrics["calls_inlined"] != 1 {
+		t.Fatalf("期望内联1个调用点，实际为%v", result.metrics["calls_inlined"])
+	}
+	if got := blockIDs(caller.basicBlocks); !reflect.DeepEqual(got, []string{"main", "call.entry", "call.pos", "call.zero", "call.cont"}) {
+		t.Fatalf("调用点处应拆分出被调函数副本和续块，实际为%v", got)
+	}
+	cont := caller.basicBlocks[4]
+	if len(cont.instructions) != 2 || cont.instructions[0].id != "c" || cont.instructions[0].block != cont {
+		t.Error("调用点之后的指令应移入续块")
+	}
+	if branch := caller.basicBlocks[1].instructions[0]; branch.operands[0].variable != a {
+		t.Error("被调函数中的形参应替换为实参")
+	}
+	for _, returning := range caller.basicBlocks[2:4] {
+		if len(returning.successors) != 1 || returning.successors[0] != cont {
+			t.Errorf("%s的返回应跳往续块", returning.id)
+		}
+	}
+	if len(caller.cfg.blocks) != 5 {
+		t.Error("控制流图的基本块列表应同步更新")
+	}
+
+	// 被调函数体内的调用点以副本挂到调用者上
+	var edges []string
+	for _, edge := range graph.edges {
+		edges = append(edges, edge.caller.function.name+"->"+edge.callee.function.name+"@"+edge.callSite.id)
+	}
+	if !reflect.DeepEqual(edges, []string{"pick->log@log", "main->log@call.log"}) {
+		t.Errorf("调用图的边不正确: %v", edges)
+	}
+	if got := interpret(t, caller); got != 8 {
+		t.Errorf("内联后结果应为8，实际为%d", got)
+	}
+}
+
+func TestInliningRefusesRecursiveAndOversizedCallees(t *testing.T) {
+	n, r := &Variable{name: "n"}, &Variable{name: "r"}
+	leaf := func(name string, size int) *Function {
+		block := &BasicBlock{id: "entry"}
+		for i := 0; i < size-1; i++ {
+			block.instructions = append(block.instructions, &Instruction{id: "i" + strconv.Itoa(i), opcode: OpAdd,
+				operands: []*Operand{varOperand(n), constOperand(int64(i))}, result: r})
+		}
+		block.instructions = append(block.instructions, &Instruction{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(r)}})
+		return &Function{name: name, params: []*Variable{n}, basicBlocks: []*BasicBlock{block}}
+	}
+	fact := leaf("fact", 3)
+	selfCall := &Instruction{id: "self", opcode: OpCall, operands: []*Operand{labelOperand("fact"), varOperand(n)}, result: r}
+	fact.basicBlocks[0].instructions = append([]*Instruction{selfCall}, fact.basicBlocks[0].instructions...)
+	big := leaf("big", 20)
+	medium := leaf("medium", 10)
+
+	a := &Variable{name: "a"}
+	callTo := func(id, callee string) *Instruction {
+		return &Instruction{id: id, opcode: OpCall, operands: []*Operand{labelOperand(callee), varOperand(a)}, result: &Variable{name: id}}
+	}
+	calls := []*Instruction{callTo("call-fact", "fact"), callTo("call-big", "big"), callTo("call-m1", "medium"), callTo("call-m2", "medium")}
+	caller := &Function{name: "main", basicBlocks: []*BasicBlock{{id: "entry", instructions: append([]*Instruction(nil), calls...)}}}
+	graph, nodes := newCallGraph(caller, fact, big, medium)
+	connect(graph, nodes["main"], nodes["fact"], calls[0])
+	connect(graph, nodes["main"], nodes["big"], calls[1])
+	connect(graph, nodes["main"], nodes["medium"], calls[2])
+	connect(graph, nodes["main"], nodes["medium"], calls[3])
+	connect(graph, nodes["fact"], nodes["fact"], selfCall)
+
+	// 增长预算15只够内联一次medium
+	inliner := NewInliningTransformer(InliningConfig{GrowthBudget: 15})
+	result, _ := inliner.Transform(&OptimizationContext{function: caller})
+	if result.metrics["calls_inlined"] != 1 || result.metrics["instructions_added"] != 10 {
+		t.Fatalf("期望只内联1次medium，实际为%v", result.metrics)
+	}
+	var remaining []string
+	for _, inst := range caller.basicBlocks[0].instructions {
+		if inst.opcode == OpCall {
+			remaining = append(remaining, inst.id)
+		}
+	}
+	if !reflect.DeepEqual(remaining, []string{"call-fact", "call-big", "call-m2"}) {
+		t.Errorf("递归、超过阈值和超出预算的调用点应保留，实际为%v", remaining)
+	}
+	if len(nodes["main"].callees) != 3 || len(nodes["medium"].callers) != 1 {
+		t.Error("仍有调用点时main与medium之间的调用关系应保留")
+	}
+}
+
+// ==================
+// 23. 逃逸分析
+// ==================
+
+func TestEscapeAnalysisMarksStackAllocations(t *testing.T) {
+	v := func(name string) *Variable { return &Variable{name: name} }
+	local, field, value, returned, passed, g, gp, stored, inner, outer :=
+		v("local"), v("field"), v("value"), v("returned"), v("passed"), v("g"), v("gp"), v("stored"), v("inner"), v("outer")
+
+	instructions := []*Instruction{
+		// local只在函数内读写，不逃逸
+		{id: "local", opcode: OpAlloc, result: local},
+		{id: "field", opcode: OpAdd, operands: []*Operand{varOperand(local), constOperand(int64(8))}, result: field},
+		{id: "init", opcode: OpStore, operands: []*Operand{varOperand(field), constOperand(int64(1))}},
+		{id: "value", opcode: OpLoad, operands: []*Operand{varOperand(field)}, result: value},
+		// 作为实参传给调用
+		{id: "passed", opcode: OpAlloc, result: passed},
+		{id: "call", opcode: OpCall, operands: []*Operand{labelOperand("consume"), varOperand(passed)}},
+		// 写入全局变量g
+		{id: "stored", opcode: OpAlloc, result: stored},
+		{id: "gp", opcode: OpAddr, operands: []*Operand{varOperand(g)}, result: gp},
+		{id: "publish", opcode: OpStore, operands: []*Operand{varOperand(gp), varOperand(stored)}},
+		// inner保存在返回的outer中，随outer一起逃逸
+		{id: "inner", opcode: OpAlloc, result: inner},
+		{id: "outer", opcode: OpAlloc, result: outer},
+		{id: "link", opcode: OpStore, operands: []*Operand{varOperand(outer), varOperand(inner)}},
+		{id: "returned", opcode: OpCopy, operands: []*Operand{varOperand(outer)}, result: returned},
+		{id: "ret", opcode: OpReturn, operands: []*Operand{varOperand(returned)}},
+	}
+	function := &Function{name: "escape", basicBlocks: []*BasicBlock{{id: "entry", instructions: instructions}}}
+	context := &OptimizationContext{
+		function: function,
+		module:   &Module{name: "m", globals: []*GlobalVariable{{name: "g"}}},
+	}
+
+	optimizer := NewMemoryOptimizer()
+	result, err := optimizer.Transform(context)
+	if err != nil || !result.changed {
+		t.Fatalf("期望标记分配指令，实际为%v %v", result.changed, err)
+	}
+	if result.metrics["allocations"] != 5 || result.metrics["stack_allocated"] != 1 || result.metrics["escaped"] != 4 {
+		t.Errorf("期望5个分配中1个可栈上分配，实际为%v", result.metrics)
+	}
+	expected := map[string]bool{"local": true, "passed": false, "stored": false, "inner": false, "outer": false}
+	for _, inst := range instructions {
+		if want, ok := expected[inst.id]; ok && inst.metadata[stackAllocatableKey] != want {
+			t.Errorf("%s: stack_allocatable期望%v，实际为%v", inst.id, want, inst.metadata[stackAllocatableKey])
+		}
+	}
+
+	if again, _ := optimizer.Transform(context); again.changed {
+		t.Error("标记未变化时不应报告IR改变")
+	}
+	// 没有模块信息时g只是局部变量，写入它不逃逸
+	context.module = nil
+	if again, _ := optimizer.Transform(context); !again.changed || instructions[6].metadata[stackAllocatableKey] != true {
+		t.Error("g不是模块全局变量时stored不应逃逸")
+	}
+
+	engine := NewOptimizationEngine(OptimizationConfig{})
+	found := false
+	for _, pass := range engine.passManager.passes {
+		if pass.id == "escape_analysis" {
+			found = pass.transformer == PassTransformer(engine.memoryOptimizer)
+		}
+	}
+	if !found {
+		t.Error("escape_analysis过程应使用引擎的内存优化器")
+	}
+}
+
+// ==================
+// 24. 优化报告序列化
+// ==================
+
+func TestOptimizationReportRoundTrips(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	result := &OptimizationResult{
+		StartTime: start,
+		EndTime:   start.Add(5 * time.Millisecond),
+		Duration:  5 * time.Millisecond,
+		Success:   true,
+		PassResults: map[string]*PassResult{
+			"licm": {
+				PassID: "licm", StartTime: start, EndTime: start.Add(2 * time.Millisecond),
+				Duration: 2 * time.Millisecond, Success: true, Changed: true,
+				TransformationResult: &TransformationResult{
+					passID: "licm", success: true, changed: true,
+					improvements: []Improvement{{kind: ImprovementSpeed, description: "hoisted", improvement: 0.2, confidence: 0.9}},
+					regressions:  []Regression{{kind: RegressionSize, description: "preheader", metric: "size", oldValue: 10, newValue: 11, regression: 0.1, severity: SeverityWarning}},
+				},
+			},
+			"dce": {
+				PassID: "dce", StartTime: start, EndTime: start.Add(time.Millisecond),
+				Duration: time.Millisecond, Error: errors.New("boom"),
+			},
+		},
+		Statistics: &OptimizationStatistics{
+			TotalPasses: 2, SuccessfulPasses: 1, FailedPasses: 1, OptimizationTime: 5 * time.Millisecond,
+			IterationCount: 2, CacheHitRate: 0.5,
+			PassStatistics: map[string]*PassStatistics{"licm": {ExecutionCount: 2, TotalTime: 3 * time.Millisecond}},
+		},
+		Improvements: []Improvement{{kind: ImprovementSpeed, description: "Pass licm improved performance", improvement: 0.1, confidence: 0.8}},
+	}
+
+	data, err := result.MarshalReport()
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	loaded, err := LoadReport(data)
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	again, err := loaded.MarshalReport()
+	if err != nil {
+		t.Fatalf("再次序列化失败: %v", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("报告往返后不一致:\n%s\n%s", data, again)
+	}
+
+	if loaded.PassResults["dce"].Error == nil || loaded.PassResults["dce"].Error.Error() != "boom" {
+		t.Error("应以消息文本恢复过程错误")
+	}
+	if !reflect.DeepEqual(loaded.PassResults["licm"].TransformationResult.regressions, result.PassResults["licm"].TransformationResult.regressions) {
+		t.Error("应恢复过程的退化记录")
+	}
+	if !reflect.DeepEqual(loaded.Improvements, result.Improvements) || loaded.Statistics.PassStatistics["licm"].TotalTime != 3*time.Millisecond {
+		t.Error("应恢复改进与汇总统计")
+	}
+
+	// 过程按ID排序，并包含各自的耗时
+	var report OptimizationReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("报告不是合法JSON: %v", err)
+	}
+	if len(report.Passes) != 2 || report.Passes[0].ID != "dce" || report.Passes[1].ID != "licm" {
+		t.Fatalf("过程应按ID排序，实际为%+v", report.Passes)
+	}
+	if report.Passes[0].DurationNS != int64(time.Millisecond) || report.Passes[1].DurationNS != int64(2*time.Millisecond) {
+		t.Error("报告应包含每个过程的耗时")
+	}
+}
+
+func TestOptimizationReportFromEngineRun(t *testing.T) {
+	engine, context := newIterationTestEngine(t, 10, &convergingTransformer{changes: 1})
+	result := engine.Optimize(context)
+
+	data, err := result.MarshalReport()
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	var report OptimizationReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("报告不是合法JSON: %v", err)
+	}
+	var converging *PassReport
+	for i := range report.Passes {
+		if i > 0 && report.Passes[i-1].ID >= report.Passes[i].ID {
+			t.Errorf("过程应按ID排序: %s 位于 %s 之后", report.Passes[i].ID, report.Passes[i-1].ID)
+		}
+		if report.Passes[i].ID == "converging" {
+			converging = &report.Passes[i]
+		}
+	}
+	if len(report.Passes) != len(result.PassResults) || converging == nil || !converging.Changed || converging.DurationNS <= 0 {
+		t.Errorf("报告应包含每个执行过的过程及其耗时，实际为%+v", report.Passes)
+	}
+	if report.Statistics == nil || report.Statistics.IterationCount != 2 {
+		t.Errorf("报告应包含汇总统计，实际为%+v", report.Statistics)
+	}
+}
+
+func TestLoadReportRejectsInvalidDocuments(t *testing.T) {
+	for name, data := range map[string]string{
+		"malformed": `{"version":`,
+		"version":   `{"version":99,"passes":[]}`,
+		"duplicate": `{"version":1,"passes":[{"id":"a"},{"id":"a"}]}`,
+	} {
+		if _, err := LoadReport([]byte(data)); err == nil {
+			t.Errorf("%s: 期望加载失败", name)
+		}
+	}
+}
+
+// ==================
+// 25. 窥孔优化
+// ==================
+
+var peepholeOpcodeNames = map[Opcode]string{
+	OpLoad: "load", OpStore: "store", OpAdd: "add", OpSub: "sub", OpMul: "mul", OpDiv: "div",
+	OpCall: "call", OpConst: "const", OpCopy: "copy", OpShl: "shl", OpNeg: "neg", OpAddr: "addr",
+}
+
+// renderInstructions 把指令渲染为"结果 = 操作码 操作数..."形式，常量带%T以区分类型
+func renderInstructions(instructions []*Instruction) []string {
+	rendered := make([]string, len(instructions))
+	for i, inst := range instructions {
+		var parts []string
+		if inst.result != nil {
+			parts = append(parts, inst.result.name, "=")
+		}
+		parts = append(parts, peepholeOpcodeNames[inst.opcode])
+		for _, operand := range inst.operands {
+			switch operand.kind {
+			case OperandVariable:
+				parts = append(parts, operand.variable.name)
+			case OperandConstant:
+				parts = append(parts, fmt.Sprintf("%T(%v)", operand.constant, operand.constant))
+			case OperandLabel:
+				parts = append(parts, "@"+operand.label)
+			}
+		}
+		rendered[i] = strings.Join(parts, " ")
+	}
+	return rendered
+}
+
+// runPeephole 在单个基本块上执行窥孔优化
+func runPeephole(t *testing.T, pt *PeepholeTransformer, instructions []*Instruction) (*BasicBlock, *TransformationResult) {
+	t.Helper()
+	block := &BasicBlock{id: "b", instructions: instructions}
+	result, err := pt.Transform(&OptimizationContext{function: &Function{name: "f", basicBlocks: []*BasicBlock{block}}})
+	if err != nil {
+		t.Fatalf("窥孔优化失败: %v", err)
+	}
+	return block, result
+}
+
+func TestPeepholeBuiltinRules(t *testing.T) {
+	intType, floatType := &Type{name: "int", kind: TypeInt}, &Type{name: "float64", kind: TypeFloat}
+	x, y, z := &Variable{name: "x", varType: intType}, &Variable{name: "y", varType: intType}, &Variable{name: "z", varType: intType}
+	p, q, v := &Variable{name: "p"}, &Variable{name: "q"}, &Variable{name: "v"}
+	f, g := &Variable{name: "f", varType: floatType}, &Variable{name: "g", varType: floatType}
+	inst := func(result *Variable, opcode Opcode, operands ...*Operand) *Instruction {
+		return &Instruction{opcode: opcode, operands: operands, result: result}
+	}
+
+	tests := []struct {
+		name     string
+		input    []*Instruction
+		expected []string
+		rewrites int
+	}{
+		{
+			name:     "乘1",
+			input:    []*Instruction{inst(y, OpMul, varOperand(x), constOperand(1)), inst(z, OpMul, constOperand(int32(1)), varOperand(y))},
+			expected: []string{"y = copy x", "z = copy y"},
+			rewrites: 2,
+		},
+		{
+			name:     "加0",
+			input:    []*Instruction{inst(y, OpAdd, constOperand(0), varOperand(x)), inst(z, OpAdd, varOperand(x), constOperand(int8(0)))},
+			expected: []string{"y = copy x", "z = copy x"},
+			rewrites: 2,
+		},
+		{
+			name:     "加非零常量不改写",
+			input:    []*Instruction{inst(y, OpAdd, varOperand(x), constOperand(3)), inst(z, OpMul, varOperand(x), constOperand(1.0))},
+			expected: []string{"y = add x int(3)", "z = mul x float64(1)"},
+		},
+		{
+			name:     "乘2改为左移",
+			input:    []*Instruction{inst(y, OpMul, varOperand(x), constOperand(int64(2))), inst(z, OpMul, constOperand(2), varOperand(y))},
+			expected: []string{"y = shl x int64(1)", "z = shl y int(1)"},
+			rewrites: 2,
+		},
+		{
+			name:     "浮点数乘2不改写",
+			input:    []*Instruction{inst(g, OpMul, varOperand(f), constOperand(2)), inst(v, OpMul, varOperand(q), constOperand(2))},
+			expected: []string{"g = mul f int(2)", "v = mul q int(2)"},
+		},
+		{
+			name:     "双重取负",
+			input:    []*Instruction{inst(y, OpNeg, varOperand(x)), inst(v, OpAdd, varOperand(y), constOperand(3)), inst(z, OpNeg, varOperand(y))},
+			expected: []string{"y = neg x", "v = add y int(3)", "z = copy x"},
+			rewrites: 1,
+		},
+		{
+			name:     "取负之间重新定义源变量",
+			input:    []*Instruction{inst(y, OpNeg, varOperand(x)), inst(x, OpLoad), inst(z, OpNeg, varOperand(y))},
+			expected: []string{"y = neg x", "x = load", "z = neg y"},
+		},
+		{
+			name:     "写后读转发",
+			input:    []*Instruction{inst(nil, OpStore, varOperand(p), varOperand(v)), inst(y, OpAdd, varOperand(v), constOperand(3)), inst(z, OpLoad, varOperand(p))},
+			expected: []string{"store p v", "y = add v int(3)", "z = copy v"},
+			rewrites: 1,
+		},
+		{
+			name:     "转发常量",
+			input:    []*Instruction{inst(nil, OpStore, varOperand(p), constOperand(7)), inst(z, OpLoad, varOperand(p))},
+			expected: []string{"store p int(7)", "z = const int(7)"},
+			rewrites: 1,
+		},
+		{
+			name:     "写入其他地址阻止转发",
+			input:    []*Instruction{inst(nil, OpStore, varOperand(p), varOperand(v)), inst(nil, OpStore, varOperand(q), varOperand(x)), inst(z, OpLoad, varOperand(p))},
+			expected: []string{"store p v", "store q x", "z = load p"},
+		},
+		{
+			name:     "调用阻止转发",
+			input:    []*Instruction{inst(nil, OpStore, varOperand(p), varOperand(v)), inst(nil, OpCall, labelOperand("g")), inst(z, OpLoad, varOperand(p))},
+			expected: []string{"store p v", "call @g", "z = load p"},
+		},
+		{
+			name:     "写入的值被重新定义",
+			input:    []*Instruction{inst(nil, OpStore, varOperand(p), varOperand(v)), inst(v, OpLoad), inst(z, OpLoad, varOperand(p))},
+			expected: []string{"store p v", "v = load", "z = load p"},
+		},
+		{
+			name: "定义取过地址的变量阻止转发",
+			input: []*Instruction{inst(p, OpAddr, varOperand(x)), inst(nil, OpStore, varOperand(p), varOperand(v)),
+				inst(x, OpLoad), inst(z, OpLoad, varOperand(p))},
+			expected: []string{"p = addr x", "store p v", "x = load", "z = load p"},
+		},
+		{
+			name:     "规则级联",
+			input:    []*Instruction{inst(nil, OpStore, varOperand(p), varOperand(x)), inst(y, OpLoad, varOperand(p)), inst(z, OpMul, varOperand(y), constOperand(1))},
+			expected: []string{"store p x", "y = copy x", "z = copy y"},
+			rewrites: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, result := runPeephole(t, NewPeepholeTransformer(), tt.input)
+			if got := renderInstructions(block.instructions); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("期望%v，实际为%v", tt.expected, got)
+			}
+			if int(result.metrics["rewrites"]) != tt.rewrites || result.changed != (tt.rewrites > 0) {
+				t.Errorf("期望改写%d次，实际为%v", tt.rewrites, result.metrics["rewrites"])
+			}
+		})
+	}
+}
+
+func TestPeepholeWindowLimitsLookback(t *testing.T) {
+	p, v, z := &Variable{name: "p"}, &Variable{name: "v"}, &Variable{name: "z"}
+	build := func() []*Instruction {
+		instructions := []*Instruction{{opcode: OpStore, operands: []*Operand{varOperand(p), varOperand(v)}}}
+		for i := 0; i < 3; i++ {
+			instructions = append(instructions, &Instruction{opcode: OpConst, operands: []*Operand{constOperand(i)}, result: &Variable{name: "t" + strconv.Itoa(i)}})
+		}
+		return append(instructions, &Instruction{opcode: OpLoad, operands: []*Operand{varOperand(p)}, result: z})
+	}
+
+	pt := NewPeepholeTransformer()
+	pt.SetWindow(4)
+	if block, _ := runPeephole(t, pt, build()); block.instructions[4].opcode != OpLoad {
+		t.Error("写入在窗口之外时不应转发")
+	}
+	pt.SetWindow(5)
+	if block, _ := runPeephole(t, pt, build()); block.instructions[4].opcode != OpCopy {
+		t.Error("写入在窗口之内时应转发")
+	}
+}
+
+func TestPeepholeCustomRules(t *testing.T) {
+	x, y := &Variable{name: "x"}, &Variable{name: "y"}
+	pt := NewPeepholeTransformer()
+	if err := pt.RegisterRule(PeepholeRule{Name: "sub_self"}); err == nil {
+		t.Error("缺少改写函数的规则应被拒绝")
+	}
+	// x - x => 0
+	err := pt.RegisterRule(PeepholeRule{Name: "sub_self", Rewrite: func(window []*Instruction, _ map[*Variable]bool) (*Instruction, bool) {
+		inst := window[len(window)-1]
+		if inst.opcode == OpSub && len(inst.operands) == 2 && inst.operands[0].kind == OperandVariable &&
+			inst.operands[1].kind == OperandVariable && inst.operands[0].variable == inst.operands[1].variable {
+			return &Instruction{opcode: OpConst, operands: []*Operand{constOperand(0)}}, true
+		}
+		return nil, false
+	}})
+	if err != nil {
+		t.Fatalf("注册规则失败: %v", err)
+	}
+
+	block, result := runPeephole(t, pt, []*Instruction{{opcode: OpSub, operands: []*Operand{varOperand(x), varOperand(x)}, result: y}})
+	if got := renderInstructions(block.instructions); !reflect.DeepEqual(got, []string{"y = const int(0)"}) {
+		t.Errorf("自定义规则未生效: %v", got)
+	}
+	if block.instructions[0].result != y || result.metrics["rule:sub_self"] != 1 {
+		t.Errorf("应保留结果变量并按规则统计改写次数，实际为%v", result.metrics)
+	}
+
+	// 互为逆变换的规则不会无限改写
+	flip := func(from, to Opcode) PeepholeRule {
+		return PeepholeRule{Name: "flip" + strconv.Itoa(int(from)), Rewrite: func(window []*Instruction, _ map[*Variable]bool) (*Instruction, bool) {
+			inst := window[len(window)-1]
+			if inst.opcode != from {
+				return nil, false
+			}
+			return &Instruction{opcode: to, operands: inst.operands}, true
+		}}
+	}
+	pt = NewPeepholeTransformer()
+	pt.RegisterRule(flip(OpDiv, OpSub))
+	pt.RegisterRule(flip(OpSub, OpDiv))
+	if _, result := runPeephole(t, pt, []*Instruction{{opcode: OpDiv, operands: []*Operand{varOperand(x), varOperand(y)}, result: x}}); result.metrics["rewrites"] > float64(len(pt.rules)) {
+		t.Errorf("改写次数应以规则数为上限，实际为%v", result.metrics["rewrites"])
+	}
+}
+
+func TestPeepholePassRegistered(t *testing.T) {
+	engine := NewOptimizationEngine(OptimizationConfig{})
+	for _, pass := range engine.passManager.passes {
+		if pass.id == "peephole" {
+			if _, ok := pass.transformer.(*PeepholeTransformer); !ok {
+				t.Error("peephole过程应使用PeepholeTransformer")
+			}
+			return
+		}
+	}
+	t.Error("应注册peephole过程")
+}
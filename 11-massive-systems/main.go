@@ -1,8 +1,38 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -107,7 +137,9 @@ type NetworkPolicy struct {
 	Rules []NetworkRule
 }
 
-// NetworkRule 网络规则
+// NetworkRule 网络规则。Source和Destination为选择器：空或"*"匹配任意端点，
+// CIDR或IP按地址匹配，"app=orders,env=prod"形式按标签匹配，其他按端点名称匹配；
+// Protocol为空时匹配任意协议，Port为0时匹配任意端口
 type NetworkRule struct {
 	Source      string
 	Destination string
@@ -116,7 +148,7 @@ type NetworkRule struct {
 	Action      RuleAction
 }
 
-// RuleAction 规则动作
+// RuleAction 规则动作，Log记录连接后放行
 type RuleAction int
 
 const (
@@ -157,6 +189,7 @@ type ProxyConfig struct {
 	UpstreamTimeout time.Duration
 	MaxConnections  int
 	KeepAlive       bool
+	Protocol        string // 代理承载的协议，网络策略按它匹配，为空时为http
 }
 
 // ErrorType 错误类型
@@ -171,10 +204,8 @@ const (
 	ErrorTypeInternal
 )
 
-type TrafficManager struct{}
 type MeshSecurityManager struct{}
 type MeshObservability struct{}
-type StickySessionManager struct{}
 type RateLimiter struct{}
 type TrafficShaper struct{}
 
@@ -188,7 +219,12 @@ type ServiceMesh struct {
 	config          ServiceMeshConfig
 	statistics      ServiceMeshStatistics
 	certificates    map[string]*TLSCertificate
-	accessLogs      []*AccessLog
+	ca              *meshCA
+	accessLog       *AccessLogger
+	policyEngine    *NetworkPolicyEngine
+	successCount    int64
+	totalLatency    time.Duration
+	latency         *LatencyHistogram
 	mutex           sync.RWMutex
 }
 
@@ -209,15 +245,16 @@ type TLSCertificate struct {
 	ExpiresAt   time.Time
 }
 
-// AccessLog 访问日志
+// AccessLog 访问日志，Policy为命中Log网络策略时的策略ID，转发失败时StatusCode为0
 type AccessLog struct {
-	Timestamp    time.Time
-	Source       string
-	Destination  string
-	Method       string
-	Path         string
-	StatusCode   int
-	ResponseTime time.Duration
+	Timestamp    time.Time     `json:"timestamp"`
+	Source       string        `json:"source,omitempty"`
+	Destination  string        `json:"destination"`
+	Method       string        `json:"method,omitempty"`
+	Path         string        `json:"path,omitempty"`
+	StatusCode   int           `json:"status_code,omitempty"`
+	ResponseTime time.Duration `json:"response_time_ns,omitempty"`
+	Policy       string        `json:"policy,omitempty"`
 }
 
 // LoadBalancerConfig 负载均衡器配置
@@ -226,6 +263,9 @@ type LoadBalancerConfig struct {
 	HealthCheckInterval time.Duration
 	HealthCheckTimeout  time.Duration
 	MaxRetries          int
+	SessionAffinity     AffinityStrategy
+	SessionTTL          time.Duration
+	SessionCookie       string
 }
 
 // LoadBalancerStatistics 负载均衡器统计
@@ -274,6 +314,7 @@ type Registration struct {
 type Lease struct {
 	ID        string
 	ServiceID string
+	TTL       time.Duration
 	ExpiresAt time.Time
 	Renewed   time.Time
 }
@@ -296,6 +337,7 @@ const (
 // ServiceMeshConfig 服务网格配置
 type ServiceMeshConfig struct {
 	MutualTLS        bool
+	CertificateTTL   time.Duration // 网格签发的服务证书有效期，为0时为24小时
 	TrafficSplitting bool
 	LoadBalancing    LoadBalancingStrategy
 	RetryPolicy      RetryPolicy
@@ -326,13 +368,37 @@ type ServiceProxy struct {
 	healthChecker     *HealthChecker
 	metrics           *ProxyMetrics
 	config            ProxyConfig
-}
-
-// FailoverManager 故障转移管理器
+	transport         UpstreamTransport
+	breakers          map[string]*CircuitBreaker
+	breakerConfig     CircuitBreakerConfig
+	retryPolicy       RetryPolicy
+	trafficManager    *TrafficManager
+	tracer            *TracingSystem
+	policyEngine      *NetworkPolicyEngine
+	currentWeights    map[string]int
+	errorCount        int64
+	totalLatency      time.Duration
+	latency           *LatencyHistogram
+	startedAt         time.Time
+	mutex             sync.RWMutex
+}
+
+// FailoverManager 故障转移管理器，在主用组和备用组之间切换负载均衡器的流量。
+// Strategies的第一项为使用的策略；Thresholds支持error_rate（默认0.5）和latency_ms，
+// 主用后端不健康或任一指标达到阈值即视为故障。这些字段应在开始评估前配置好
 type FailoverManager struct {
 	Strategies []FailoverStrategy
 	Thresholds map[string]float64
 	Config     FailoverConfig
+
+	primary      []string
+	standby      []string
+	state        FailoverState
+	rolled       int // 滚动切换中已换下的后端数
+	drainStarted time.Time
+	healthySince time.Time
+	history      []FailoverEvent
+	mutex        sync.Mutex
 }
 
 // FailoverStrategy 故障转移策略
@@ -344,11 +410,14 @@ const (
 	FailoverStrategyRolling
 )
 
-// FailoverConfig 故障转移配置
+// FailoverConfig 故障转移配置。Threshold为触发切换的主用后端故障比例，为0时为0.5；
+// FailbackAfter为主用组持续恢复多久后自动切回，为0时不自动切回；DrainTimeout为优雅切换等待连接排空的上限，为0时一直等待
 type FailoverConfig struct {
 	Enabled       bool
 	CheckInterval time.Duration
 	Threshold     float64
+	FailbackAfter time.Duration
+	DrainTimeout  time.Duration
 }
 
 // ServiceDiscoveryConfig 服务发现配置
@@ -373,20 +442,22 @@ type AuthenticationHandler struct {
 	Config    AuthenticationConfig
 }
 
-// AuthorizationHandler 授权处理器
+// AuthorizationHandler 授权处理器，由NewAuthorizationHandler创建以预先解析规则
 type AuthorizationHandler struct {
 	Policies []AuthorizationPolicy
 	Config   AuthorizationConfig
+	rules    []compiledAuthorizationRule
 }
 
-// RequestTransformer 请求转换器
+// RequestTransformer 请求转换器，按顺序应用规则，由NewRequestTransformer创建以校验规则
 type RequestTransformer struct {
 	Rules []TransformationRule
 }
 
-// RequestValidator 请求验证器
+// RequestValidator 请求验证器，由NewRequestValidator创建以预编译规则中的正则表达式
 type RequestValidator struct {
-	Rules []ValidationRule
+	Rules    []ValidationRule
+	patterns []*regexp.Regexp // 与Rules一一对应，没有Pattern的规则为nil
 }
 
 // AuthenticationMethod 认证方法
@@ -399,25 +470,42 @@ const (
 	AuthMethodAPIKey
 )
 
-// AuthorizationRule 授权规则
+// AuthorizationRule 授权规则。Resource为与路由相同语法的路径模式，Action为HTTP方法，
+// Principal形如"role:admin"、"user:alice"，三者为"*"时匹配任意值；Condition为可选的
+// "left == right"或"left != right"表达式。Effect为"deny"时是拒绝规则，否则为允许规则
 type AuthorizationRule struct {
 	ID        string
 	Resource  string
 	Action    string
 	Principal string
 	Condition string
+	Effect    string
 }
 
-// TransformationRule 转换规则
+// TransformationRule 转换规则。Source和Target为请求头名、查询参数名、路径前缀或以"."分隔的
+// JSON字段路径；Transform只用于请求体规则，返回error值表示转换失败。Response为true时作用于响应
 type TransformationRule struct {
 	ID        string
 	Type      TransformationType
+	Action    TransformAction
 	Source    string
 	Target    string
+	Value     string
+	Response  bool
 	Transform func(interface{}) interface{}
 }
 
-// ValidationRule 验证规则
+// TransformAction 请求头、查询参数和请求体字段的转换动作
+type TransformAction int
+
+const (
+	TransformActionSet    TransformAction = iota // 把Target设为Value（请求体为Transform的结果）
+	TransformActionRemove                        // 删除Source
+	TransformActionRename                        // 把Source改名为Target
+)
+
+// ValidationRule 验证规则。Field形如"header:X-Request-ID"、"query:page"或"body:user.email"，
+// 没有前缀时按JSON请求体中以"."分隔的字段路径处理
 type ValidationRule struct {
 	ID        string
 	Field     string
@@ -453,13 +541,19 @@ type AuthorizationPolicy struct {
 	Rules []AuthorizationRule
 }
 
-// AuthenticationConfig 认证配置
+// AuthenticationConfig 认证配置。JWT使用HS256时配置JWTSecret，使用RS256时配置JWTPublicKey；
+// JWTIssuer和JWTAudience非空时要求令牌的iss和aud与之匹配，ClockSkew为校验exp和nbf时容忍的时钟偏差
 type AuthenticationConfig struct {
-	Enabled bool
-	Methods []AuthenticationMethod
+	Enabled      bool
+	Methods      []AuthenticationMethod
+	JWTSecret    []byte
+	JWTPublicKey *rsa.PublicKey
+	JWTIssuer    string
+	JWTAudience  string
+	ClockSkew    time.Duration
 }
 
-// AuthorizationConfig 授权配置
+// AuthorizationConfig 授权配置，Default为没有规则匹配时的决定（"allow"或"deny"，为空时拒绝）
 type AuthorizationConfig struct {
 	Enabled bool
 	Default string
@@ -476,6 +570,8 @@ type LoadBalancer struct {
 	statistics      LoadBalancerStatistics
 	failoverManager *FailoverManager
 	trafficShaping  *TrafficShaper
+	failoverStop    chan struct{}
+	failoverWG      sync.WaitGroup
 	mutex           sync.RWMutex
 }
 
@@ -498,6 +594,7 @@ type Backend struct {
 	errorRate    float64
 	metadata     map[string]interface{}
 	lastChecked  time.Time
+	region       string // 后端所在地区，地理负载均衡按它计算距离
 }
 
 type ServiceResolver struct{}
@@ -535,6 +632,8 @@ type ServiceRegistry struct {
 	watchers      []RegistryWatcher
 	persistence   RegistryPersistence
 	consistency   ConsistencyLevel
+	sweepStop     chan struct{}
+	sweepWG       sync.WaitGroup
 	mutex         sync.RWMutex
 }
 
@@ -568,8 +667,6 @@ const (
 )
 
 type FrameworkConfig struct{}
-type KeyDistributor struct{}
-type ReshardingManager struct{}
 type ConsistencyManager struct{}
 type ServiceContext struct{}
 
@@ -606,14 +703,19 @@ type APIGateway struct {
 	config         GatewayConfig
 	statistics     GatewayStatistics
 	plugins        map[string]GatewayPlugin
+	transport      UpstreamTransport
+	tracer         *TracingSystem
 	mutex          sync.RWMutex
 }
 
-// Route 路由
+// Route 路由，PathPattern支持:param参数段和末尾的*或*name通配段，Method为空或*时匹配任意方法
 type Route struct {
+	Method         string
+	PathPattern    string
+	Backend        *LoadBalancer
+	Middleware     []GatewayMiddleware
+	segments       []string
 	id             string
-	path           string
-	method         string
 	service        string
 	version        string
 	timeout        time.Duration
@@ -624,7 +726,6 @@ type Route struct {
 	authorization  []AuthorizationRule
 	transformation []TransformationRule
 	validation     []ValidationRule
-	middleware     []string
 	metadata       map[string]interface{}
 }
 
@@ -636,10 +737,11 @@ type CircuitMonitor struct {
 
 // CircuitBreakerStatistics 熔断器统计
 type CircuitBreakerStatistics struct {
-	TotalRequests   int64
-	FailedRequests  int64
-	SuccessRequests int64
-	CircuitOpens    int64
+	TotalRequests    int64
+	FailedRequests   int64
+	SuccessRequests  int64
+	RejectedRequests int64
+	CircuitOpens     int64
 }
 
 // CircuitEventListener 熔断器事件监听器
@@ -703,6 +805,8 @@ type CircuitBreaker struct {
 	config           CircuitBreakerConfig
 	statistics       CircuitBreakerStatistics
 	listeners        []CircuitEventListener
+	openedAt         time.Time
+	halfOpenRequests int // 半开状态下尚未结束的试探请求数
 	mutex            sync.RWMutex
 }
 
@@ -723,8 +827,6 @@ type ShardingConfig struct{}
 type ShardingStatistics struct{}
 type ShardRebalancer struct{}
 type ShardMonitor struct{}
-type BrokerConfig struct{}
-type BrokerStatistics struct{}
 type StreamProcessorConfig struct{}
 type StreamProcessorStatistics struct{}
 type ProcessingTopology struct{}
@@ -841,6 +943,13 @@ type MessageBroker struct {
 	clusters           map[string]*BrokerCluster
 	security           *BrokerSecurity
 	monitoring         *BrokerMonitoring
+	subscribers        map[string]*subscriber
+	deadLetters        []Message
+	nextMessageID      uint64
+	nextSubscriberID   uint64
+	closed             bool
+	redeliverStop      chan struct{}
+	redeliverWG        sync.WaitGroup
 	mutex              sync.RWMutex
 }
 
@@ -999,9 +1108,6 @@ type FaultToleranceConfig struct{}
 type FaultToleranceStatistics struct{}
 type FaultTolerancePolicy struct{}
 type Incident struct{}
-type AutoScalerConfig struct{}
-type AutoScalerStatistics struct{}
-type ScalingEvent struct{}
 type HorizontalScalerConfig struct{}
 type HorizontalScalerStatistics struct{}
 type ScalableInstance struct{}
@@ -1090,6 +1196,10 @@ type AutoScaler struct {
 	targets          map[string]*ScalingTarget
 	policies         map[string]*ScalingPolicy
 	history          []*ScalingEvent
+	metricSource     MetricSource
+	replicaScaler    ReplicaScaler
+	listeners        []ScalingEventListener
+	lastScaled       map[string]time.Time
 	mutex            sync.RWMutex
 }
 
@@ -1220,7 +1330,6 @@ type MetricsConfig struct{}
 type MetricsStatistics struct{}
 type TraceCollector struct{}
 type TraceProcessor interface{}
-type TraceExporter interface{}
 type TraceStorage interface{}
 type TraceAnalyzer struct{}
 type TracingConfig struct{}
@@ -1228,7 +1337,6 @@ type TracingStatistics struct{}
 type TraceCorrelator struct{}
 type TraceVisualizer struct{}
 type Tracer struct{}
-type Span struct{}
 type Trace struct{}
 type SamplingStrategy int
 type LoggingConfig struct{}
@@ -1407,6 +1515,7 @@ func NewDistributedSystemArchitect(config ArchitectConfig) *DistributedSystemArc
 	architect.monitoringSystem = NewMonitoringSystem()
 	architect.faultToleranceManager = NewFaultToleranceManager()
 	architect.autoScaler = NewAutoScaler()
+	architect.autoScaler.config.Enabled = config.AutoScalingEnabled
 	architect.securityArchitect = NewSecurityArchitect()
 
 	return architect
@@ -1496,9 +1605,13 @@ func NewServiceMesh() *ServiceMesh {
 	sm := &ServiceMesh{
 		proxies:      make(map[string]*ServiceProxy),
 		certificates: make(map[string]*TLSCertificate),
+		latency:      NewLatencyHistogram(),
 	}
 
 	sm.trafficManager = NewTrafficManager()
+	sm.policyEngine = NewNetworkPolicyEngine()
+	sm.policyEngine.AddListener(sm)
+	sm.accessLog = NewAccessLogger(AccessLogConfig{})
 	sm.securityManager = NewMeshSecurityManager()
 	sm.observability = NewMeshObservability()
 
@@ -1514,6 +1627,7 @@ func NewLoadBalancer() *LoadBalancer {
 	lb.rateLimiter = NewRateLimiter()
 	lb.failoverManager = NewFailoverManager()
 	lb.trafficShaping = NewTrafficShaper()
+	lb.algorithm = NewLoadBalancingAlgorithm(lb.config.Algorithm)
 
 	return lb
 }
@@ -1550,12 +1664,16 @@ func NewMicroserviceFramework() *MicroserviceFramework {
 	mf.metricsCollector = NewMetricsCollector()
 	mf.logAggregator = NewLogAggregator()
 	mf.tracingSystem = NewTracingSystem()
+	mf.apiGateway.SetTracer(mf.tracingSystem)
 
 	return mf
 }
 
 // 工厂函数
-func NewShardingManager() *ShardingManager       { return &ShardingManager{} }
+func NewShardingManager() *ShardingManager {
+	distributor := NewKeyDistributor(0)
+	return &ShardingManager{keyDistributor: distributor, reshardingManager: NewReshardingManager(distributor)}
+}
 func NewReplicationManager() *ReplicationManager { return &ReplicationManager{} }
 func NewPartitionManager() *PartitionManager     { return &PartitionManager{} }
 func NewIndexManager() *IndexManager             { return &IndexManager{} }
@@ -1609,6 +1727,8 @@ func NewMessageBroker() *MessageBroker {
 		producers:     make(map[string]*Producer),
 		consumers:     make(map[string]*Consumer),
 		clusters:      make(map[string]*BrokerCluster),
+		subscribers:   make(map[string]*subscriber),
+		config:        DefaultBrokerConfig(),
 	}
 
 	mb.partitionManager = NewPartitionManager()
@@ -1662,8 +1782,10 @@ func NewFaultToleranceManager() *FaultToleranceManager {
 // NewAutoScaler 创建自动扩缩容
 func NewAutoScaler() *AutoScaler {
 	as := &AutoScaler{
-		targets:  make(map[string]*ScalingTarget),
-		policies: make(map[string]*ScalingPolicy),
+		targets:    make(map[string]*ScalingTarget),
+		policies:   make(map[string]*ScalingPolicy),
+		lastScaled: make(map[string]time.Time),
+		config:     DefaultAutoScalerConfig(),
 	}
 
 	as.horizontalScaler = NewHorizontalScaler()
@@ -1762,27 +1884,23 @@ func generateSystemID() string {
 }
 
 // 更多工厂函数
-func NewTrafficManager() *TrafficManager             { return &TrafficManager{} }
-func NewMeshSecurityManager() *MeshSecurityManager   { return &MeshSecurityManager{} }
-func NewMeshObservability() *MeshObservability       { return &MeshObservability{} }
-func NewStickySessionManager() *StickySessionManager { return &StickySessionManager{} }
-func NewRateLimiter() *RateLimiter                   { return &RateLimiter{} }
-func NewFailoverManager() *FailoverManager           { return &FailoverManager{} }
-func NewTrafficShaper() *TrafficShaper               { return &TrafficShaper{} }
-func NewServiceRegistry() *ServiceRegistry           { return &ServiceRegistry{} }
-func NewServiceResolver() *ServiceResolver           { return &ServiceResolver{} }
-func NewHealthManager() *HealthManager               { return &HealthManager{} }
-func NewServiceWatcher() *ServiceWatcher             { return &ServiceWatcher{} }
-func NewDiscoveryCache() *DiscoveryCache             { return &DiscoveryCache{} }
-func NewAPIGateway() *APIGateway                     { return &APIGateway{} }
-func NewCircuitBreaker() *CircuitBreaker             { return &CircuitBreaker{} }
-func NewConfigManager() *ConfigManager               { return &ConfigManager{} }
-func NewEventBus() *EventBus                         { return &EventBus{} }
-func NewMessageQueue() *MessageQueue                 { return &MessageQueue{} }
-func NewCacheManager() *CacheManager                 { return &CacheManager{} }
-func NewMetricsCollector() *MetricsCollector         { return &MetricsCollector{} }
-func NewLogAggregator() *LogAggregator               { return &LogAggregator{} }
-func NewTracingSystem() *TracingSystem               { return &TracingSystem{} }
+func NewMeshSecurityManager() *MeshSecurityManager { return &MeshSecurityManager{} }
+func NewMeshObservability() *MeshObservability     { return &MeshObservability{} }
+func NewRateLimiter() *RateLimiter                 { return &RateLimiter{} }
+func NewFailoverManager() *FailoverManager         { return &FailoverManager{} }
+func NewTrafficShaper() *TrafficShaper             { return &TrafficShaper{} }
+func NewServiceResolver() *ServiceResolver         { return &ServiceResolver{} }
+func NewHealthManager() *HealthManager             { return &HealthManager{} }
+func NewServiceWatcher() *ServiceWatcher           { return &ServiceWatcher{} }
+func NewDiscoveryCache() *DiscoveryCache           { return &DiscoveryCache{} }
+func NewCircuitBreaker() *CircuitBreaker           { return &CircuitBreaker{} }
+func NewConfigManager() *ConfigManager             { return &ConfigManager{} }
+func NewEventBus() *EventBus                       { return &EventBus{} }
+func NewMessageQueue() *MessageQueue               { return &MessageQueue{} }
+func NewCacheManager() *CacheManager               { return &CacheManager{} }
+func NewMetricsCollector() *MetricsCollector       { return &MetricsCollector{} }
+func NewLogAggregator() *LogAggregator             { return &LogAggregator{} }
+func NewTracingSystem() *TracingSystem             { return &TracingSystem{} }
 
 // 更多占位符类型和接口
 type SystemRequirements struct {
@@ -2007,19 +2125,13 @@ func main() {
 	fmt.Printf("  限流配置: %+v\n", serviceMesh.config.RateLimiting)
 
 	// 创建示例服务代理
-	serviceProxy := &ServiceProxy{
-		serviceID: "user-service",
-		upstreamServices: []*UpstreamService{
-			{ID: "auth-service", Weight: 50},
-			{ID: "profile-service", Weight: 30},
-		},
-		downstreamClients: []*DownstreamClient{
-			{ID: "web-client", Type: "http"},
-			{ID: "mobile-client", Type: "grpc"},
-		},
-	}
+	serviceProxy := NewServiceProxy("user-service", ProxyConfig{UpstreamTimeout: 2 * time.Second}, nil)
+	serviceProxy.AddUpstream(&UpstreamService{ID: "auth-service", Address: "10.0.1.10:8080", Weight: 50})
+	serviceProxy.AddUpstream(&UpstreamService{ID: "profile-service", Address: "10.0.1.11:8080", Weight: 30})
+	serviceProxy.AddDownstreamClient(&DownstreamClient{ID: "web-client", Type: "http"})
+	serviceProxy.AddDownstreamClient(&DownstreamClient{ID: "mobile-client", Type: "grpc"})
 
-	serviceMesh.proxies["user-service"] = serviceProxy
+	serviceMesh.RegisterProxy(serviceProxy)
 	fmt.Printf("\n服务代理示例:\n")
 	fmt.Printf("  服务ID: %s\n", serviceProxy.serviceID)
 	fmt.Printf("  上游服务数: %d\n", len(serviceProxy.upstreamServices))
@@ -2054,6 +2166,14 @@ func main() {
 	}
 	fmt.Printf("  健康服务数: %d\n", healthyCount)
 
+	fmt.Printf("  轮询选择:")
+	for i := 0; i < 4; i++ {
+		if backend := loadBalancer.SelectBackend(&Request{ID: fmt.Sprintf("lb-%d", i)}); backend != nil {
+			fmt.Printf(" %s", backend.id)
+		}
+	}
+	fmt.Println()
+
 	fmt.Println()
 
 	// 演示服务发现
@@ -2096,7 +2216,9 @@ func main() {
 	}
 
 	for _, instance := range instances {
-		serviceDiscovery.registry.services[instance.id] = instance
+		if err := serviceDiscovery.registry.Register(instance, 30*time.Second); err != nil {
+			fmt.Printf("  注册%s失败: %v\n", instance.id, err)
+		}
 	}
 
 	fmt.Printf("服务注册表状态:\n")
@@ -2366,10 +2488,16 @@ func main() {
 // 更多占位符类型定义
 type Request struct {
 	ID      string
+	Source  string // 发起请求的下游客户端ID
 	Method  string
 	URL     string
 	Headers map[string]string
 	Body    []byte
+	Params  map[string]string // 网关路由匹配得到的路径参数
+	// RemoteAddr 发起连接的下游地址（IP或IP:端口），网络策略按它匹配CIDR
+	RemoteAddr string
+
+	Principal *Principal // 网关认证得到的请求主体，供授权使用
 }
 
 type Response struct {
@@ -2379,19 +2507,54 @@ type Response struct {
 }
 
 type UpstreamService struct {
-	ID     string
-	Weight int
+	ID      string
+	Address string
+	Weight  int
+	Subset  string            // 流量分割使用的子集名，如版本号v1、v2
+	Labels  map[string]string // 网络策略标签选择器匹配的标签
 }
 
 type DownstreamClient struct {
-	ID   string
-	Type string
+	ID     string
+	Type   string
+	Labels map[string]string // 网络策略标签选择器匹配的标签
 }
 
 type HealthChecker struct {
-	Interval time.Duration
-	Timeout  time.Duration
-	Retries  int
+	Interval           time.Duration
+	Timeout            time.Duration
+	Retries            int
+	HealthyThreshold   int // 连续成功多少次判定为健康
+	UnhealthyThreshold int // 连续失败多少次判定为不健康
+	status             map[string]HealthStatus
+	targets            map[string]*healthCheckTarget
+	stopCh             chan struct{}
+	wg                 sync.WaitGroup
+	mutex              sync.RWMutex
+}
+
+// ProbeType 健康检查探测方式
+type ProbeType int
+
+const (
+	ProbeTCP ProbeType = iota
+	ProbeHTTP
+)
+
+// HealthProbe 健康检查探测配置，HTTP探测对Address+Path发起GET请求，2xx和3xx视为成功
+type HealthProbe struct {
+	Type    ProbeType
+	Address string
+	Path    string
+}
+
+// healthCheckTarget 一个被探测的目标及其连续成功/失败计数
+type healthCheckTarget struct {
+	id        string
+	probe     HealthProbe
+	onChange  func(HealthStatus)
+	successes int
+	failures  int
 }
 
 type HealthStatus int
@@ -2664,3 +2827,5750 @@ type defaultMetricsStorage struct{}
 
 func (dms *defaultMetricsStorage) Save(data interface{}) error { return nil }
 func (dms *defaultMetricsStorage) Load() (interface{}, error)  { return nil, nil }
+
+// ============================================================================
+// 服务代理请求转发实现
+// ============================================================================
+
+// 代理转发的哨兵错误
+var (
+	ErrNoHealthyUpstream = errors.New("no healthy upstream available")
+	ErrCircuitOpen       = errors.New("circuit breaker is open")
+	ErrUnknownDownstream = errors.New("unknown downstream client")
+)
+
+// maxProxyBodySize 代理读取上游响应体的上限
+const maxProxyBodySize = 10 << 20
+
+// String 返回错误类型名称
+func (et ErrorType) String() string {
+	names := []string{"network", "timeout", "authentication", "authorization", "rate_limit", "internal"}
+	if int(et) < len(names) {
+		return names[et]
+	}
+	return "unknown"
+}
+
+// ProxyError 代理转发错误，携带错误类型供重试判断和统计使用
+type ProxyError struct {
+	Type     ErrorType
+	Upstream string
+	Err      error
+}
+
+func (e *ProxyError) Error() string {
+	if e.Upstream == "" {
+		return fmt.Sprintf("proxy %s error: %v", e.Type, e.Err)
+	}
+	return fmt.Sprintf("proxy %s error (upstream %s): %v", e.Type, e.Upstream, e.Err)
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// UpstreamTransport 上游传输层，负责把请求发送到选中的上游实例
+type UpstreamTransport interface {
+	RoundTrip(ctx context.Context, upstream *UpstreamService, request *Request) (*Response, error)
+}
+
+// HTTPUpstreamTransport 基于net/http的默认传输层
+type HTTPUpstreamTransport struct {
+	Client *http.Client
+}
+
+// RoundTrip 将请求以HTTP方式发送到上游地址
+func (t *HTTPUpstreamTransport) RoundTrip(ctx context.Context, upstream *UpstreamService, request *Request) (*Response, error) {
+	if upstream.Address == "" {
+		return nil, fmt.Errorf("upstream %s has no address", upstream.ID)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, request.Method, "http://"+upstream.Address+request.URL, bytes.NewReader(request.Body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range request.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxProxyBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(httpResp.Header))
+	for key := range httpResp.Header {
+		headers[key] = httpResp.Header.Get(key)
+	}
+
+	return &Response{
+		StatusCode: httpResp.StatusCode,
+		Headers:    headers,
+		Body:       body,
+	}, nil
+}
+
+// NewServiceProxy 创建服务代理，transport为nil时使用HTTP传输层
+func NewServiceProxy(serviceID string, config ProxyConfig, transport UpstreamTransport) *ServiceProxy {
+	if transport == nil {
+		transport = &HTTPUpstreamTransport{Client: &http.Client{}}
+	}
+
+	return &ServiceProxy{
+		serviceID:      serviceID,
+		healthChecker:  NewHealthChecker(10*time.Second, 2*time.Second, 3),
+		metrics:        &ProxyMetrics{},
+		config:         config,
+		transport:      transport,
+		breakers:       make(map[string]*CircuitBreaker),
+		currentWeights: make(map[string]int),
+		retryPolicy:    RetryPolicy{MaxAttempts: 1},
+		trafficManager: NewTrafficManager(),
+		latency:        NewLatencyHistogram(),
+		startedAt:      time.Now(),
+	}
+}
+
+// AddUpstream 添加上游服务
+func (sp *ServiceProxy) AddUpstream(upstream *UpstreamService) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.upstreamServices = append(sp.upstreamServices, upstream)
+}
+
+// AddDownstreamClient 添加允许访问的下游客户端
+func (sp *ServiceProxy) AddDownstreamClient(client *DownstreamClient) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.downstreamClients = append(sp.downstreamClients, client)
+}
+
+// AddTrafficRule 添加流量规则
+func (sp *ServiceProxy) AddTrafficRule(rule *TrafficRule) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.trafficRules = append(sp.trafficRules, rule)
+}
+
+// SetRetryPolicy 设置重试策略，MaxAttempts小于1时按1处理
+func (sp *ServiceProxy) SetRetryPolicy(policy RetryPolicy) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	sp.retryPolicy = policy
+}
+
+// SetCircuitBreakerConfig 设置每个上游熔断器使用的配置
+func (sp *ServiceProxy) SetCircuitBreakerConfig(config CircuitBreakerConfig) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.breakerConfig = config
+	sp.breakers = make(map[string]*CircuitBreaker)
+}
+
+// HealthChecker 返回代理使用的健康检查器
+func (sp *ServiceProxy) HealthChecker() *HealthChecker {
+	return sp.healthChecker
+}
+
+// Metrics 返回代理指标的副本
+func (sp *ServiceProxy) Metrics() ProxyMetrics {
+	sp.mutex.RLock()
+	defer sp.mutex.RUnlock()
+	return *sp.metrics
+}
+
+// Forward 转发请求：校验下游客户端，按流量规则和健康状态筛选上游，
+// 经负载均衡和熔断器选出实例后发送；可重试错误按退避策略等待后换一个上游重试
+func (sp *ServiceProxy) Forward(request *Request) (*Response, error) {
+	start := time.Now()
+
+	sp.mutex.RLock()
+	policy := sp.retryPolicy
+	tracer := sp.tracer
+	sp.mutex.RUnlock()
+
+	span := tracer.startHop(request, "proxy "+sp.serviceID)
+	response, err := sp.forward(request, policy, span)
+	tracer.finishHop(span, response, err)
+	sp.recordMetrics(start, err)
+	return response, err
+}
+
+// forward 执行Forward的校验、选择与重试，有跟踪时把代理span注入发往上游的请求
+func (sp *ServiceProxy) forward(request *Request, policy RetryPolicy, span *Span) (*Response, error) {
+	if err := sp.checkDownstream(request); err != nil {
+		return nil, err
+	}
+	blocked, err := sp.enforceNetworkPolicy(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+
+	// 网络策略拒绝的上游视同已尝试，不参与选择
+	tried := make(map[string]bool, len(blocked))
+	for upstreamID := range blocked {
+		tried[upstreamID] = true
+	}
+	var lastErr error
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			waitBackoff(context.Background(), policy, attempt)
+		}
+		upstream, breaker, err := sp.selectUpstream(request, tried)
+		if err != nil {
+			if lastErr == nil {
+				lastErr = err
+			}
+			break
+		}
+		tried[upstream.ID] = true
+		if span != nil {
+			span.SetTag("upstream", upstream.ID)
+			InjectTraceparent(ContextWithSpan(context.Background(), span), request)
+		}
+
+		response, err := sp.send(upstream, request)
+		if err == nil && response.StatusCode < http.StatusInternalServerError {
+			breaker.RecordSuccess()
+		} else {
+			breaker.RecordFailure()
+		}
+
+		if err == nil {
+			return response, nil
+		}
+
+		lastErr = err
+		if !isRetryable(err, policy) {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
+
+// SetTracer 设置链路跟踪系统，nil表示不跟踪
+func (sp *ServiceProxy) SetTracer(tracer *TracingSystem) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.tracer = tracer
+}
+
+// checkDownstream 配置了下游客户端时，仅允许已登记的来源访问
+func (sp *ServiceProxy) checkDownstream(request *Request) error {
+	sp.mutex.RLock()
+	defer sp.mutex.RUnlock()
+
+	if len(sp.downstreamClients) == 0 {
+		return nil
+	}
+	for _, client := range sp.downstreamClients {
+		if client.ID == request.Source {
+			return nil
+		}
+	}
+	return &ProxyError{Type: ErrorTypeAuthorization, Err: fmt.Errorf("%w: %q", ErrUnknownDownstream, request.Source)}
+}
+
+// upstreamCandidate 参与负载均衡的上游及其有效权重
+type upstreamCandidate struct {
+	upstream *UpstreamService
+	weight   int
+}
+
+// selectUpstream 选择一个健康、未尝试过且熔断器放行的上游
+func (sp *ServiceProxy) selectUpstream(request *Request, tried map[string]bool) (*UpstreamService, *CircuitBreaker, error) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	candidates := make([]upstreamCandidate, 0, len(sp.upstreamServices))
+	for _, candidate := range sp.applyTrafficRulesLocked(request) {
+		if tried[candidate.upstream.ID] || !sp.healthChecker.IsHealthy(candidate.upstream.ID) {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	candidates = sp.applyTrafficSplitLocked(request, candidates)
+
+	rejected := false
+	for len(candidates) > 0 {
+		index := sp.pickWeightedLocked(candidates)
+		upstream := candidates[index].upstream
+		breaker := sp.breakerLocked(upstream.ID)
+		if breaker.Allow() {
+			return upstream, breaker, nil
+		}
+		rejected = true
+		candidates = append(candidates[:index], candidates[index+1:]...)
+	}
+
+	if rejected {
+		return nil, nil, &ProxyError{Type: ErrorTypeNetwork, Err: ErrCircuitOpen}
+	}
+	return nil, nil, &ProxyError{Type: ErrorTypeNetwork, Err: ErrNoHealthyUpstream}
+}
+
+// applyTrafficRulesLocked 返回命中的最高优先级规则所指向的上游；
+// 规则权重为0表示不分配流量。没有规则命中时使用全部上游及其自身权重
+func (sp *ServiceProxy) applyTrafficRulesLocked(request *Request) []upstreamCandidate {
+	matched := make([]*TrafficRule, 0)
+	for _, rule := range sp.trafficRules {
+		if !trafficRuleMatches(rule, request) {
+			continue
+		}
+		if len(matched) > 0 && rule.Priority < matched[0].Priority {
+			continue
+		}
+		if len(matched) > 0 && rule.Priority > matched[0].Priority {
+			matched = matched[:0]
+		}
+		matched = append(matched, rule)
+	}
+
+	candidates := make([]upstreamCandidate, 0, len(sp.upstreamServices))
+	if len(matched) == 0 {
+		for _, upstream := range sp.upstreamServices {
+			weight := upstream.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+			candidates = append(candidates, upstreamCandidate{upstream: upstream, weight: weight})
+		}
+		return candidates
+	}
+
+	for _, rule := range matched {
+		if rule.Weight <= 0 {
+			continue
+		}
+		for _, upstream := range sp.upstreamServices {
+			if upstream.ID == rule.Destination {
+				candidates = append(candidates, upstreamCandidate{upstream: upstream, weight: rule.Weight})
+			}
+		}
+	}
+	return candidates
+}
+
+// applyTrafficSplitLocked 配置了流量分割时只保留选中子集的候选；
+// 选中子集没有可用上游时退回全部候选，避免金丝雀故障导致请求失败
+func (sp *ServiceProxy) applyTrafficSplitLocked(request *Request, candidates []upstreamCandidate) []upstreamCandidate {
+	if sp.trafficManager == nil {
+		return candidates
+	}
+	subset, ok := sp.trafficManager.SelectSubset(sp.serviceID, request)
+	if !ok {
+		return candidates
+	}
+
+	selected := make([]upstreamCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.upstream.Subset == subset {
+			selected = append(selected, candidate)
+		}
+	}
+	if len(selected) == 0 {
+		return candidates
+	}
+	return selected
+}
+
+// SetTrafficSplit 按子集权重分割该代理的流量，policy为nil时取消分割
+func (sp *ServiceProxy) SetTrafficSplit(policy *TrafficSplitPolicy) error {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	if sp.trafficManager == nil {
+		sp.trafficManager = NewTrafficManager()
+	}
+	return sp.trafficManager.SetSplit(sp.serviceID, policy)
+}
+
+// trafficRuleMatches 判断请求是否命中规则。
+// Source为空或"*"匹配任意来源；Condition支持"header:Name=Value"、"method:GET"、"path:/prefix"
+func trafficRuleMatches(rule *TrafficRule, request *Request) bool {
+	if rule.Source != "" && rule.Source != "*" && rule.Source != request.Source {
+		return false
+	}
+
+	kind, expr, found := strings.Cut(rule.Condition, ":")
+	if !found {
+		return rule.Condition == ""
+	}
+
+	switch kind {
+	case "header":
+		name, value, _ := strings.Cut(expr, "=")
+		return request.Headers[name] == value
+	case "method":
+		return strings.EqualFold(request.Method, expr)
+	case "path":
+		return strings.HasPrefix(request.URL, expr)
+	default:
+		return false
+	}
+}
+
+// pickWeightedLocked 平滑加权轮询，返回选中候选的下标
+func (sp *ServiceProxy) pickWeightedLocked(candidates []upstreamCandidate) int {
+	total := 0
+	best := -1
+	for i, candidate := range candidates {
+		id := candidate.upstream.ID
+		sp.currentWeights[id] += candidate.weight
+		total += candidate.weight
+		if best < 0 || sp.currentWeights[id] > sp.currentWeights[candidates[best].upstream.ID] {
+			best = i
+		}
+	}
+	sp.currentWeights[candidates[best].upstream.ID] -= total
+	return best
+}
+
+// breakerLocked 获取上游对应的熔断器，不存在时按代理配置创建
+func (sp *ServiceProxy) breakerLocked(upstreamID string) *CircuitBreaker {
+	breaker, exists := sp.breakers[upstreamID]
+	if !exists {
+		breaker = NewCircuitBreakerWithConfig(sp.breakerConfig)
+		sp.breakers[upstreamID] = breaker
+	}
+	return breaker
+}
+
+// send 在上游超时限制内发送请求，并把底层错误归类为ProxyError
+func (sp *ServiceProxy) send(upstream *UpstreamService, request *Request) (*Response, error) {
+	ctx := context.Background()
+	if sp.config.UpstreamTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sp.config.UpstreamTimeout)
+		defer cancel()
+	}
+
+	response, err := sp.transport.RoundTrip(ctx, upstream, request)
+	if err == nil {
+		return response, nil
+	}
+
+	var proxyErr *ProxyError
+	if errors.As(err, &proxyErr) {
+		if proxyErr.Upstream == "" {
+			proxyErr.Upstream = upstream.ID
+		}
+		return nil, proxyErr
+	}
+	errType := ErrorTypeNetwork
+	if errors.Is(err, context.DeadlineExceeded) {
+		errType = ErrorTypeTimeout
+	}
+	return nil, &ProxyError{Type: errType, Upstream: upstream.ID, Err: err}
+}
+
+// isRetryable 判断错误是否允许重试，策略未指定时网络和超时错误可重试
+func isRetryable(err error, policy RetryPolicy) bool {
+	var proxyErr *ProxyError
+	if !errors.As(err, &proxyErr) {
+		return false
+	}
+
+	retryable := policy.RetryableErrors
+	if len(retryable) == 0 {
+		retryable = []ErrorType{ErrorTypeNetwork, ErrorTypeTimeout}
+	}
+	for _, errType := range retryable {
+		if proxyErr.Type == errType {
+			return true
+		}
+	}
+	return false
+}
+
+// retryJitter 全抖动：在[0, limit]内均匀取值，测试中可替换为确定值
+var retryJitter = func(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit) + 1))
+}
+
+// Retry 按策略执行fn：可重试错误（默认网络和超时）以指数退避加全抖动等待后重试，
+// 其他错误立即返回；等待期间上下文取消时返回包装了ctx.Err()和最后一次错误的结果
+func Retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := waitBackoff(ctx, policy, attempt); err != nil {
+				return fmt.Errorf("retry canceled after %d attempts: %w", attempt, errors.Join(err, lastErr))
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		lastErr = fn()
+		if lastErr == nil || !isRetryable(lastErr, policy) {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+// backoffDelay 第attempt次重试（从1开始）前的退避上限：InitialDelay * BackoffFactor^(attempt-1)，不超过MaxDelay
+func backoffDelay(policy RetryPolicy, attempt int) time.Duration {
+	if policy.InitialDelay <= 0 || attempt < 1 {
+		return 0
+	}
+	factor := policy.BackoffFactor
+	if factor < 1 {
+		factor = 2
+	}
+
+	delay := float64(policy.InitialDelay) * math.Pow(factor, float64(attempt-1))
+	if policy.MaxDelay > 0 && delay > float64(policy.MaxDelay) {
+		return policy.MaxDelay
+	}
+	if delay > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay)
+}
+
+// waitBackoff 按退避上限抖动后等待，上下文取消时提前返回其错误
+func waitBackoff(ctx context.Context, policy RetryPolicy, attempt int) error {
+	delay := retryJitter(backoffDelay(policy, attempt))
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// recordMetrics 更新请求数、平均响应时间、错误率和吞吐量
+func (sp *ServiceProxy) recordMetrics(start time.Time, err error) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	elapsed := time.Since(start)
+	sp.metrics.RequestCount++
+	if err != nil {
+		sp.errorCount++
+	}
+	sp.totalLatency += elapsed
+	sp.latency.Observe(elapsed)
+
+	sp.metrics.ResponseTime = sp.totalLatency / time.Duration(sp.metrics.RequestCount)
+	sp.metrics.ErrorRate = float64(sp.errorCount) / float64(sp.metrics.RequestCount)
+	if elapsed := time.Since(sp.startedAt).Seconds(); elapsed > 0 {
+		sp.metrics.ThroughputRPS = float64(sp.metrics.RequestCount) / elapsed
+	}
+}
+
+// RegisterProxy 在服务网格中登记服务代理
+func (sm *ServiceMesh) RegisterProxy(proxy *ServiceProxy) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.proxies[proxy.serviceID] = proxy
+
+	// 启用流量分割时代理改用网格统一管理的分割策略
+	if sm.config.TrafficSplitting && sm.trafficManager != nil {
+		proxy.mutex.Lock()
+		proxy.trafficManager = sm.trafficManager
+		proxy.mutex.Unlock()
+	}
+	if sm.policyEngine != nil {
+		proxy.SetNetworkPolicyEngine(sm.policyEngine)
+	}
+}
+
+// SetTrafficSplit 设置服务在网格范围内的流量分割策略，需启用TrafficSplitting才会作用于代理
+func (sm *ServiceMesh) SetTrafficSplit(serviceID string, policy *TrafficSplitPolicy) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	if sm.trafficManager == nil {
+		sm.trafficManager = NewTrafficManager()
+	}
+	return sm.trafficManager.SetSplit(serviceID, policy)
+}
+
+// Forward 通过目标服务的代理转发请求并更新网格统计
+func (sm *ServiceMesh) Forward(serviceID string, request *Request) (*Response, error) {
+	sm.mutex.RLock()
+	proxy, exists := sm.proxies[serviceID]
+	sm.mutex.RUnlock()
+
+	if !exists {
+		return nil, &ProxyError{Type: ErrorTypeInternal, Err: fmt.Errorf("no proxy for service %s", serviceID)}
+	}
+
+	start := time.Now()
+	response, err := proxy.Forward(request)
+	elapsed := time.Since(start)
+
+	entry := AccessLog{Timestamp: start, Source: request.Source, Destination: serviceID, Method: request.Method, ResponseTime: elapsed}
+	entry.Path, _, _ = strings.Cut(request.URL, "?")
+	if err == nil {
+		entry.StatusCode = response.StatusCode
+	}
+	sm.AccessLogger().Record(entry)
+
+	sm.mutex.Lock()
+	sm.statistics.TotalRequests++
+	if err == nil && response.StatusCode < http.StatusInternalServerError {
+		sm.successCount++
+	}
+	sm.totalLatency += elapsed
+	sm.statistics.SuccessRate = float64(sm.successCount) / float64(sm.statistics.TotalRequests)
+	sm.statistics.AverageLatency = sm.totalLatency / time.Duration(sm.statistics.TotalRequests)
+	if sm.latency == nil {
+		sm.latency = NewLatencyHistogram()
+	}
+	sm.latency.Observe(elapsed)
+	sm.mutex.Unlock()
+
+	return response, err
+}
+
+// ============================================================================
+// 健康状态与熔断器基础实现
+// ============================================================================
+
+// NewHealthChecker 创建健康检查器，retries作为判定不健康所需的连续失败次数
+func NewHealthChecker(interval, timeout time.Duration, retries int) *HealthChecker {
+	return &HealthChecker{
+		Interval:           interval,
+		Timeout:            timeout,
+		Retries:            retries,
+		HealthyThreshold:   1,
+		UnhealthyThreshold: retries,
+		status:             make(map[string]HealthStatus),
+		targets:            make(map[string]*healthCheckTarget),
+	}
+}
+
+// SetStatus 更新目标的健康状态
+func (hc *HealthChecker) SetStatus(targetID string, status HealthStatus) {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+	if hc.status == nil {
+		hc.status = make(map[string]HealthStatus)
+	}
+	hc.status[targetID] = status
+}
+
+// Status 返回目标的健康状态，未检查过的目标为Unknown
+func (hc *HealthChecker) Status(targetID string) HealthStatus {
+	hc.mutex.RLock()
+	defer hc.mutex.RUnlock()
+	status, exists := hc.status[targetID]
+	if !exists {
+		return HealthStatusUnknown
+	}
+	return status
+}
+
+// IsHealthy 未被判定为不健康的目标都视为可用
+func (hc *HealthChecker) IsHealthy(targetID string) bool {
+	return hc.Status(targetID) != HealthStatusUnhealthy
+}
+
+// AddTarget 登记探测目标，onChange在目标状态翻转时被调用（可为nil）。
+// 检查器已启动时立即为该目标启动探测协程
+func (hc *HealthChecker) AddTarget(targetID string, probe HealthProbe, onChange func(HealthStatus)) {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	if hc.targets == nil {
+		hc.targets = make(map[string]*healthCheckTarget)
+	}
+	target := &healthCheckTarget{id: targetID, probe: probe, onChange: onChange}
+	hc.targets[targetID] = target
+	if hc.stopCh != nil {
+		hc.startTargetLocked(target)
+	}
+}
+
+// Start 为每个目标启动一个探测协程，重复调用无副作用
+func (hc *HealthChecker) Start() {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	if hc.stopCh != nil {
+		return
+	}
+	hc.stopCh = make(chan struct{})
+	for _, target := range hc.targets {
+		hc.startTargetLocked(target)
+	}
+}
+
+// Stop 停止所有探测协程并等待其退出
+func (hc *HealthChecker) Stop() {
+	hc.mutex.Lock()
+	stopCh := hc.stopCh
+	hc.stopCh = nil
+	hc.mutex.Unlock()
+
+	if stopCh != nil {
+		close(stopCh)
+	}
+	hc.wg.Wait()
+}
+
+func (hc *HealthChecker) startTargetLocked(target *healthCheckTarget) {
+	stopCh := hc.stopCh
+	interval := hc.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	hc.wg.Add(1)
+	go func() {
+		defer hc.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			hc.check(target, stopCh)
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// check 执行一次探测，连续成功或失败达到阈值时翻转目标状态
+func (hc *HealthChecker) check(target *healthCheckTarget, stopCh chan struct{}) {
+	timeout := hc.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err := target.probe.run(ctx)
+
+	hc.mutex.Lock()
+	healthyThreshold, unhealthyThreshold := hc.HealthyThreshold, hc.UnhealthyThreshold
+	if healthyThreshold <= 0 {
+		healthyThreshold = 1
+	}
+	if unhealthyThreshold <= 0 {
+		unhealthyThreshold = 3
+	}
+
+	current, exists := hc.status[target.id]
+	if !exists {
+		current = HealthStatusUnknown
+	}
+	next := current
+	if err == nil {
+		target.successes++
+		target.failures = 0
+		if target.successes >= healthyThreshold {
+			next = HealthStatusHealthy
+		}
+	} else {
+		target.failures++
+		target.successes = 0
+		if target.failures >= unhealthyThreshold {
+			next = HealthStatusUnhealthy
+		}
+	}
+	if hc.status == nil {
+		hc.status = make(map[string]HealthStatus)
+	}
+	hc.status[target.id] = next
+	hc.mutex.Unlock()
+
+	if next != current && target.onChange != nil {
+		target.onChange(next)
+	}
+}
+
+// run 执行一次探测，返回nil表示目标可用
+func (probe HealthProbe) run(ctx context.Context) error {
+	switch probe.Type {
+	case ProbeHTTP:
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+probe.Address+probe.Path, nil)
+		if err != nil {
+			return err
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(response.Body, maxProxyBodySize))
+		if response.StatusCode < 200 || response.StatusCode >= 400 {
+			return fmt.Errorf("health check %s returned status %d", probe.Address, response.StatusCode)
+		}
+		return nil
+	default:
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", probe.Address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// NewCircuitBreakerWithConfig 按配置创建熔断器，零值字段使用默认值
+func NewCircuitBreakerWithConfig(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.SuccessThreshold <= 0 {
+		config.SuccessThreshold = 1
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.MaxRequests <= 0 {
+		config.MaxRequests = 1
+	}
+
+	return &CircuitBreaker{
+		state:            CircuitClosed,
+		failureThreshold: config.FailureThreshold,
+		successThreshold: config.SuccessThreshold,
+		timeout:          config.Timeout,
+		config:           config,
+	}
+}
+
+// CircuitOpenError 熔断器拒绝请求时返回的错误，可用errors.Is匹配ErrCircuitOpen
+type CircuitOpenError struct {
+	State      CircuitState
+	RetryAfter time.Duration // 打开状态下距离进入半开状态的剩余时间
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.State == CircuitHalfOpen {
+		return "circuit breaker is half-open: too many trial requests"
+	}
+	return fmt.Sprintf("circuit breaker is open, retry after %v", e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// AddListener 注册状态变化和请求结果监听器
+func (cb *CircuitBreaker) AddListener(listener CircuitEventListener) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.listeners = append(cb.listeners, listener)
+}
+
+// Execute 在熔断器保护下执行fn：被拒绝时不调用fn并返回*CircuitOpenError，
+// 否则按fn的结果记录成功或失败；fn发生panic时记为失败后继续向上传播
+func (cb *CircuitBreaker) Execute(fn func() error) (err error) {
+	if err := cb.acquire(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			cb.RecordFailure()
+			panic(recovered)
+		}
+		if err != nil {
+			cb.RecordFailure()
+		} else {
+			cb.RecordSuccess()
+		}
+	}()
+	return fn()
+}
+
+// Allow 判断熔断器是否放行请求；打开状态超过超时时间后进入半开状态，
+// 半开状态最多同时放行MaxRequests个试探请求。放行后必须调用RecordSuccess或RecordFailure
+func (cb *CircuitBreaker) Allow() bool {
+	return cb.acquire() == nil
+}
+
+// acquire 申请一次调用许可，拒绝时返回*CircuitOpenError
+func (cb *CircuitBreaker) acquire() error {
+	cb.mutex.Lock()
+	previous := cb.state
+	now := time.Now()
+
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.timeout {
+		cb.setStateLocked(CircuitHalfOpen, now)
+	}
+
+	var err error
+	switch cb.state {
+	case CircuitOpen:
+		err = &CircuitOpenError{State: CircuitOpen, RetryAfter: cb.timeout - now.Sub(cb.openedAt)}
+	case CircuitHalfOpen:
+		maxRequests := cb.config.MaxRequests
+		if maxRequests <= 0 {
+			maxRequests = 1
+		}
+		if cb.halfOpenRequests >= maxRequests {
+			err = &CircuitOpenError{State: CircuitHalfOpen}
+		} else {
+			cb.halfOpenRequests++
+		}
+	}
+	if err != nil {
+		cb.statistics.RejectedRequests++
+	}
+	cb.unlockAndNotify(previous, nil)
+	return err
+}
+
+// RecordSuccess 记录一次成功调用，半开状态下连续成功达到阈值时关闭熔断器
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mutex.Lock()
+	previous := cb.state
+	success := true
+
+	cb.requestCount++
+	cb.statistics.TotalRequests++
+	cb.statistics.SuccessRequests++
+	cb.failureCount = 0
+
+	if cb.state == CircuitHalfOpen {
+		cb.finishTrialLocked()
+		cb.successCount++
+		if cb.successCount >= int64(cb.successThreshold) {
+			cb.setStateLocked(CircuitClosed, time.Now())
+		}
+	}
+	cb.unlockAndNotify(previous, &success)
+}
+
+// RecordFailure 记录一次失败调用，连续失败达到阈值或半开状态失败时打开熔断器
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mutex.Lock()
+	previous := cb.state
+	success := false
+
+	cb.requestCount++
+	cb.statistics.TotalRequests++
+	cb.statistics.FailedRequests++
+	cb.failureCount++
+
+	switch cb.state {
+	case CircuitHalfOpen:
+		cb.finishTrialLocked()
+		cb.setStateLocked(CircuitOpen, time.Now())
+	case CircuitClosed:
+		if cb.failureCount >= int64(cb.failureThreshold) {
+			cb.setStateLocked(CircuitOpen, time.Now())
+		}
+	}
+	cb.unlockAndNotify(previous, &success)
+}
+
+// finishTrialLocked 半开状态下一个试探请求结束，释放其占用的名额
+func (cb *CircuitBreaker) finishTrialLocked() {
+	if cb.halfOpenRequests > 0 {
+		cb.halfOpenRequests--
+	}
+}
+
+// setStateLocked 切换状态并重置该状态使用的计数
+func (cb *CircuitBreaker) setStateLocked(state CircuitState, now time.Time) {
+	switch state {
+	case CircuitOpen:
+		cb.statistics.CircuitOpens++
+		cb.openedAt = now
+	case CircuitHalfOpen:
+		cb.successCount = 0
+		cb.halfOpenRequests = 0
+	case CircuitClosed:
+		cb.failureCount = 0
+		cb.successCount = 0
+	}
+	cb.state = state
+}
+
+// unlockAndNotify 释放锁后通知监听器，避免监听器回调熔断器时死锁；success为nil表示不是请求结果
+func (cb *CircuitBreaker) unlockAndNotify(previous CircuitState, success *bool) {
+	state := cb.state
+	listeners := cb.listeners
+	cb.mutex.Unlock()
+
+	for _, listener := range listeners {
+		if success != nil {
+			listener.OnRequest(*success)
+		}
+		if state != previous {
+			listener.OnStateChange(state)
+		}
+	}
+}
+
+// State 返回熔断器当前状态
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return cb.state
+}
+
+// ============================================================================
+// 负载均衡算法实现
+// ============================================================================
+
+// backendErrorRateDecay 每次失败时错误率向1靠近的比例（指数移动平均）
+const backendErrorRateDecay = 0.2
+
+// NewLoadBalancingAlgorithm 按策略创建负载均衡算法，未实现的策略退化为轮询
+func NewLoadBalancingAlgorithm(strategy LoadBalancingStrategy) LoadBalancingAlgorithm {
+	switch strategy {
+	case LoadBalanceLeastConnections:
+		return &LeastConnectionsAlgorithm{}
+	case LoadBalanceWeighted:
+		return &WeightedAlgorithm{}
+	case LoadBalanceIPHash:
+		return &ConsistentHashAlgorithm{}
+	case LoadBalanceGeographic:
+		return &GeographicAlgorithm{}
+	default:
+		return &RoundRobinAlgorithm{}
+	}
+}
+
+// NewLoadBalancerWithConfig 按配置创建负载均衡器并选择对应的算法
+func NewLoadBalancerWithConfig(config LoadBalancerConfig) *LoadBalancer {
+	lb := NewLoadBalancer()
+	lb.config = config
+	lb.algorithm = NewLoadBalancingAlgorithm(config.Algorithm)
+	lb.stickySession.Strategy = config.SessionAffinity
+	lb.stickySession.TTL = config.SessionTTL
+	lb.stickySession.CookieName = config.SessionCookie
+	return lb
+}
+
+// AddBackend 添加后端服务
+func (lb *LoadBalancer) AddBackend(backend *Backend) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	lb.backends = append(lb.backends, backend)
+}
+
+// SelectBackend 使用当前算法为请求选择后端，没有可用后端时返回nil。
+// 算法会修改后端状态，因此选择与失败处理都在负载均衡器的锁内串行执行
+func (lb *LoadBalancer) SelectBackend(request *Request) *Backend {
+	backend, _ := lb.SelectBackendWithSession(request)
+	return backend
+}
+
+// SelectBackendWithSession 与SelectBackend相同，但会话亲和优先选择会话已绑定的健康后端。
+// Cookie亲和下为新会话签发的Cookie值作为第二个返回值，调用方应通过Set-Cookie返回给客户端
+func (lb *LoadBalancer) SelectBackendWithSession(request *Request) (*Backend, string) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if lb.algorithm == nil {
+		lb.algorithm = NewLoadBalancingAlgorithm(lb.config.Algorithm)
+	}
+	lb.statistics.TotalRequests++
+
+	// 故障转移期间只在当前生效的后端中选择，排空中的后端仍可服务已绑定的会话
+	candidates, draining := lb.backends, map[string]bool(nil)
+	if lb.failoverManager != nil {
+		candidates, draining = lb.failoverManager.route(lb.backends)
+	}
+
+	now := time.Now()
+	var key, issued string
+	if lb.stickySession != nil {
+		key, issued = lb.stickySession.sessionKey(request)
+		if backendID := lb.stickySession.lookup(key, now); backendID != "" {
+			for _, backend := range lb.backends {
+				if backend.id == backendID && backend.healthy && (draining[backendID] || containsBackend(candidates, backendID)) {
+					return backend, issued
+				}
+			}
+		}
+	}
+
+	backend := lb.algorithm.SelectBackend(candidates, request)
+	if backend == nil {
+		lb.statistics.FailedRequests++
+		return nil, ""
+	}
+	if key != "" {
+		lb.stickySession.bind(key, backend.id, now)
+	}
+	return backend, issued
+}
+
+// ReportFailure 记录后端调用失败，交由算法更新错误率和健康状态
+func (lb *LoadBalancer) ReportFailure(backend *Backend, err error) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	lb.statistics.FailedRequests++
+	if lb.algorithm != nil {
+		lb.algorithm.HandleFailure(backend, err)
+	}
+}
+
+// MonitorBackend 用健康检查器探测后端，状态翻转时在锁内更新Backend.healthy
+func (lb *LoadBalancer) MonitorBackend(backend *Backend, checker *HealthChecker, probe HealthProbe) {
+	lb.mutex.Lock()
+	if lb.healthCheckers == nil {
+		lb.healthCheckers = make(map[string]*HealthChecker)
+	}
+	lb.healthCheckers[backend.id] = checker
+	lb.mutex.Unlock()
+
+	checker.AddTarget(backend.id, probe, func(status HealthStatus) {
+		lb.mutex.Lock()
+		defer lb.mutex.Unlock()
+		backend.healthy = status == HealthStatusHealthy
+		backend.lastChecked = time.Now()
+	})
+}
+
+// IsBackendHealthy 在锁内读取后端健康状态
+func (lb *LoadBalancer) IsBackendHealthy(backend *Backend) bool {
+	lb.mutex.RLock()
+	defer lb.mutex.RUnlock()
+	return backend.healthy
+}
+
+// AffinityStrategy 会话亲和的键提取策略
+type AffinityStrategy int
+
+const (
+	AffinityNone AffinityStrategy = iota
+	AffinityCookie
+	AffinitySourceIP
+)
+
+// 会话亲和的默认参数
+const (
+	defaultSessionCookie = "LB_SESSION"
+	defaultSessionTTL    = 30 * time.Minute
+)
+
+// StickySessionManager 会话亲和管理器：记录会话键到后端的绑定，绑定在TTL内未被使用则失效
+type StickySessionManager struct {
+	Strategy   AffinityStrategy
+	CookieName string
+	TTL        time.Duration
+	sessions   map[string]*stickySession
+	mutex      sync.Mutex
+}
+
+// stickySession 会话绑定的后端及过期时间，每次命中顺延
+type stickySession struct {
+	backendID string
+	expiresAt time.Time
+}
+
+// NewStickySessionManager 创建未启用亲和的会话管理器
+func NewStickySessionManager() *StickySessionManager {
+	return &StickySessionManager{sessions: make(map[string]*stickySession)}
+}
+
+// sessionKey 按策略提取会话键；Cookie亲和下请求未携带会话Cookie时签发新的会话ID并一并返回
+func (sm *StickySessionManager) sessionKey(request *Request) (key, issued string) {
+	if request == nil {
+		return "", ""
+	}
+	switch sm.Strategy {
+	case AffinityCookie:
+		name := sm.CookieName
+		if name == "" {
+			name = defaultSessionCookie
+		}
+		header := http.Header{"Cookie": {request.Headers["Cookie"]}}
+		if cookie, err := (&http.Request{Header: header}).Cookie(name); err == nil && cookie.Value != "" {
+			return "cookie:" + cookie.Value, ""
+		}
+		session := fmt.Sprintf("%016x", rand.Uint64())
+		return "cookie:" + session, (&http.Cookie{Name: name, Value: session, Path: "/", HttpOnly: true}).String()
+	case AffinitySourceIP:
+		if client := clientAddress(request); client != "" {
+			return "ip:" + client, ""
+		}
+	}
+	return "", ""
+}
+
+// lookup 返回会话绑定的后端ID，绑定已过期时将其删除
+func (sm *StickySessionManager) lookup(key string, now time.Time) string {
+	if key == "" {
+		return ""
+	}
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	session, exists := sm.sessions[key]
+	if !exists {
+		return ""
+	}
+	if now.After(session.expiresAt) {
+		delete(sm.sessions, key)
+		return ""
+	}
+	session.expiresAt = now.Add(sm.ttl())
+	return session.backendID
+}
+
+// bind 将会话绑定到后端，同时清理已过期的绑定
+func (sm *StickySessionManager) bind(key, backendID string, now time.Time) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if sm.sessions == nil {
+		sm.sessions = make(map[string]*stickySession)
+	}
+	for existing, session := range sm.sessions {
+		if now.After(session.expiresAt) {
+			delete(sm.sessions, existing)
+		}
+	}
+	sm.sessions[key] = &stickySession{backendID: backendID, expiresAt: now.Add(sm.ttl())}
+}
+
+func (sm *StickySessionManager) ttl() time.Duration {
+	if sm.TTL <= 0 {
+		return defaultSessionTTL
+	}
+	return sm.TTL
+}
+
+// RoundRobinAlgorithm 轮询算法：原子游标在健康后端之间依次推进
+type RoundRobinAlgorithm struct {
+	// UnhealthyThreshold 错误率达到该值时将后端标记为不健康，0表示不自动摘除
+	UnhealthyThreshold float64
+	cursor             uint64
+}
+
+func (rr *RoundRobinAlgorithm) SelectBackend(backends []*Backend, request *Request) *Backend {
+	healthy := healthyBackends(backends)
+	if len(healthy) == 0 {
+		return nil
+	}
+	next := atomic.AddUint64(&rr.cursor, 1) - 1
+	return healthy[next%uint64(len(healthy))]
+}
+
+func (rr *RoundRobinAlgorithm) UpdateWeights(backends []*Backend, metrics map[string]*BackendMetrics) {
+	applyBackendMetrics(backends, metrics)
+}
+
+func (rr *RoundRobinAlgorithm) HandleFailure(backend *Backend, err error) {
+	recordBackendFailure(backend, rr.UnhealthyThreshold)
+}
+
+// LeastConnectionsAlgorithm 最少连接算法：选择活跃连接数最少的健康后端，连接数相同时取靠前者
+type LeastConnectionsAlgorithm struct {
+	// UnhealthyThreshold 错误率达到该值时将后端标记为不健康，0表示不自动摘除
+	UnhealthyThreshold float64
+}
+
+func (lc *LeastConnectionsAlgorithm) SelectBackend(backends []*Backend, request *Request) *Backend {
+	var selected *Backend
+	for _, backend := range backends {
+		if backend == nil || !backend.healthy {
+			continue
+		}
+		if selected == nil || backend.connections < selected.connections {
+			selected = backend
+		}
+	}
+	return selected
+}
+
+func (lc *LeastConnectionsAlgorithm) UpdateWeights(backends []*Backend, metrics map[string]*BackendMetrics) {
+	applyBackendMetrics(backends, metrics)
+}
+
+func (lc *LeastConnectionsAlgorithm) HandleFailure(backend *Backend, err error) {
+	recordBackendFailure(backend, lc.UnhealthyThreshold)
+}
+
+// WeightedAlgorithm 平滑加权轮询：每轮各后端累加自身权重，选中累计值最大者并减去总权重，
+// 使高权重后端的请求均匀穿插而不是连续集中
+type WeightedAlgorithm struct {
+	// UnhealthyThreshold 错误率达到该值时将后端标记为不健康，0表示不自动摘除
+	UnhealthyThreshold float64
+	currentWeights     map[string]int
+	mutex              sync.Mutex
+}
+
+func (wa *WeightedAlgorithm) SelectBackend(backends []*Backend, request *Request) *Backend {
+	wa.mutex.Lock()
+	defer wa.mutex.Unlock()
+
+	if wa.currentWeights == nil {
+		wa.currentWeights = make(map[string]int)
+	}
+	var selected *Backend
+	total := 0
+	for _, backend := range healthyBackends(backends) {
+		weight := backend.weight
+		if weight <= 0 {
+			weight = 1
+		}
+		wa.currentWeights[backend.id] += weight
+		total += weight
+		if selected == nil || wa.currentWeights[backend.id] > wa.currentWeights[selected.id] {
+			selected = backend
+		}
+	}
+	if selected != nil {
+		wa.currentWeights[selected.id] -= total
+	}
+	return selected
+}
+
+// UpdateWeights 刷新后端指标；权重变化后清空累计值，避免旧权重的累积偏差
+func (wa *WeightedAlgorithm) UpdateWeights(backends []*Backend, metrics map[string]*BackendMetrics) {
+	applyBackendMetrics(backends, metrics)
+
+	wa.mutex.Lock()
+	defer wa.mutex.Unlock()
+	wa.currentWeights = nil
+}
+
+func (wa *WeightedAlgorithm) HandleFailure(backend *Backend, err error) {
+	recordBackendFailure(backend, wa.UnhealthyThreshold)
+}
+
+// defaultHashReplicas 一致性哈希环上每个后端的默认虚拟节点数
+const defaultHashReplicas = 160
+
+// ConsistentHashAlgorithm 一致性哈希：请求键映射到虚拟节点环上顺时针最近的后端，
+// 同一客户端固定落到同一后端，后端增减时只有落在其区间内的键被重新映射
+type ConsistentHashAlgorithm struct {
+	// Replicas 每个后端的虚拟节点数，0使用默认值
+	Replicas int
+	// UnhealthyThreshold 错误率达到该值时将后端标记为不健康，0表示不自动摘除
+	UnhealthyThreshold float64
+	ring               []hashRingNode
+	members            string // 构建当前哈希环的健康后端集合，变化时重建
+	mutex              sync.Mutex
+}
+
+// hashRingNode 哈希环上的虚拟节点
+type hashRingNode struct {
+	hash    uint64
+	backend *Backend
+}
+
+func (ch *ConsistentHashAlgorithm) SelectBackend(backends []*Backend, request *Request) *Backend {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+
+	ch.rebuildLocked(healthyBackends(backends))
+	if len(ch.ring) == 0 {
+		return nil
+	}
+	hash := hashKey(requestHashKey(request))
+	index := sort.Search(len(ch.ring), func(i int) bool { return ch.ring[i].hash >= hash })
+	if index == len(ch.ring) {
+		index = 0
+	}
+	return ch.ring[index].backend
+}
+
+// rebuildLocked 健康后端集合变化时重建哈希环
+func (ch *ConsistentHashAlgorithm) rebuildLocked(healthy []*Backend) {
+	ids := make([]string, len(healthy))
+	for i, backend := range healthy {
+		ids[i] = backend.id
+	}
+	sort.Strings(ids)
+	members := strings.Join(ids, ",")
+	if ch.ring != nil && members == ch.members {
+		return
+	}
+
+	replicas := ch.Replicas
+	if replicas <= 0 {
+		replicas = defaultHashReplicas
+	}
+	ch.ring = make([]hashRingNode, 0, len(healthy)*replicas)
+	for _, backend := range healthy {
+		for i := 0; i < replicas; i++ {
+			ch.ring = append(ch.ring, hashRingNode{hash: hashKey(backend.id + "#" + strconv.Itoa(i)), backend: backend})
+		}
+	}
+	sort.Slice(ch.ring, func(i, j int) bool { return ch.ring[i].hash < ch.ring[j].hash })
+	ch.members = members
+}
+
+func (ch *ConsistentHashAlgorithm) UpdateWeights(backends []*Backend, metrics map[string]*BackendMetrics) {
+	applyBackendMetrics(backends, metrics)
+}
+
+func (ch *ConsistentHashAlgorithm) HandleFailure(backend *Backend, err error) {
+	recordBackendFailure(backend, ch.UnhealthyThreshold)
+}
+
+// clientRegionHeader 未配置Locate时携带请求来源地区的请求头
+const clientRegionHeader = "X-Client-Region"
+
+// GeographicAlgorithm 地理负载均衡：在距离请求来源地区最近且有可用容量的地区内轮询，
+// 本地区没有健康后端时依次退到次近的地区。来源地区未知时在所有健康后端间轮询
+type GeographicAlgorithm struct {
+	// Distances 地区间距离矩阵，只需配置一个方向；同一地区距离为0，未配置的地区对视为最远
+	Distances map[string]map[string]float64
+	// Locate 解析请求的来源地区（如GeoIP查询），为nil时读取X-Client-Region请求头
+	Locate func(request *Request) string
+	// MaxConnections 单个后端的连接上限，达到后不再计入地区容量，0表示不限制
+	MaxConnections int
+	// UnhealthyThreshold 错误率达到该值时将后端标记为不健康，0表示不自动摘除
+	UnhealthyThreshold float64
+	local              RoundRobinAlgorithm
+}
+
+// SetDistance 设置两个地区之间的距离
+func (ga *GeographicAlgorithm) SetDistance(from, to string, distance float64) {
+	if ga.Distances == nil {
+		ga.Distances = make(map[string]map[string]float64)
+	}
+	if ga.Distances[from] == nil {
+		ga.Distances[from] = make(map[string]float64)
+	}
+	ga.Distances[from][to] = distance
+}
+
+// Distance 返回两个地区之间的距离
+func (ga *GeographicAlgorithm) Distance(from, to string) float64 {
+	if from == to {
+		return 0
+	}
+	if distance, ok := ga.Distances[from][to]; ok {
+		return distance
+	}
+	if distance, ok := ga.Distances[to][from]; ok {
+		return distance
+	}
+	return math.Inf(1)
+}
+
+func (ga *GeographicAlgorithm) SelectBackend(backends []*Backend, request *Request) *Backend {
+	available := make([]*Backend, 0, len(backends))
+	for _, backend := range healthyBackends(backends) {
+		if ga.MaxConnections <= 0 || backend.connections < ga.MaxConnections {
+			available = append(available, backend)
+		}
+	}
+	source := ga.sourceRegion(request)
+	if source == "" || len(available) == 0 {
+		return ga.local.SelectBackend(available, request)
+	}
+
+	// 距离相同的地区合并为同一候选集，未配置距离的地区排在最后但仍可承接流量
+	nearest := math.Inf(1)
+	var candidates []*Backend
+	for _, backend := range available {
+		distance := ga.Distance(source, backend.region)
+		switch {
+		case distance < nearest:
+			nearest, candidates = distance, []*Backend{backend}
+		case distance == nearest:
+			candidates = append(candidates, backend)
+		}
+	}
+	return ga.local.SelectBackend(candidates, request)
+}
+
+func (ga *GeographicAlgorithm) sourceRegion(request *Request) string {
+	if request == nil {
+		return ""
+	}
+	if ga.Locate != nil {
+		return ga.Locate(request)
+	}
+	region, _ := lookupHeader(request.Headers, clientRegionHeader)
+	return region
+}
+
+func (ga *GeographicAlgorithm) UpdateWeights(backends []*Backend, metrics map[string]*BackendMetrics) {
+	applyBackendMetrics(backends, metrics)
+}
+
+func (ga *GeographicAlgorithm) HandleFailure(backend *Backend, err error) {
+	recordBackendFailure(backend, ga.UnhealthyThreshold)
+}
+
+// GeographicAlgorithm 以各地区的延迟目标作为距离矩阵（毫秒）创建地理负载均衡算法
+func (dsa *DistributedSystemArchitect) GeographicAlgorithm() *GeographicAlgorithm {
+	dsa.mutex.RLock()
+	defer dsa.mutex.RUnlock()
+
+	algorithm := &GeographicAlgorithm{}
+	for id, region := range dsa.regions {
+		for target, latency := range region.latencyTargets {
+			algorithm.SetDistance(id, target, float64(latency)/float64(time.Millisecond))
+		}
+	}
+	return algorithm
+}
+
+// requestHashKey 提取请求的客户端标识：优先使用客户端IP，其次是请求ID
+func requestHashKey(request *Request) string {
+	if request == nil {
+		return ""
+	}
+	if client := clientAddress(request); client != "" {
+		return client
+	}
+	return request.ID
+}
+
+// clientAddress 提取请求的客户端地址：转发链中的第一个IP、X-Real-IP，最后是下游来源
+func clientAddress(request *Request) string {
+	if forwarded := request.Headers["X-Forwarded-For"]; forwarded != "" {
+		client, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(client)
+	}
+	if realIP := request.Headers["X-Real-IP"]; realIP != "" {
+		return realIP
+	}
+	return request.Source
+}
+
+// hashKey FNV-1a之后再做一次64位混淆（MurmurHash3的fmix64），
+// 否则只有末尾字符不同的键会聚集在环上相邻的位置
+func hashKey(key string) uint64 {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(key))
+	hash := hasher.Sum64()
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+	return hash
+}
+
+// healthyBackends 过滤出健康的后端，保持原有顺序
+func healthyBackends(backends []*Backend) []*Backend {
+	healthy := make([]*Backend, 0, len(backends))
+	for _, backend := range backends {
+		if backend != nil && backend.healthy {
+			healthy = append(healthy, backend)
+		}
+	}
+	return healthy
+}
+
+// applyBackendMetrics 用采集到的指标刷新后端的连接数、响应时间和错误率
+func applyBackendMetrics(backends []*Backend, metrics map[string]*BackendMetrics) {
+	for _, backend := range backends {
+		metric, exists := metrics[backend.id]
+		if !exists || metric == nil {
+			continue
+		}
+		backend.connections = metric.ActiveConnections
+		backend.responseTime = metric.AverageLatency
+		if metric.RequestCount > 0 {
+			backend.errorRate = float64(metric.ErrorCount) / float64(metric.RequestCount)
+		}
+		backend.lastChecked = time.Now()
+	}
+}
+
+// recordBackendFailure 提高后端错误率，超过阈值时摘除该后端
+func recordBackendFailure(backend *Backend, threshold float64) {
+	if backend == nil {
+		return
+	}
+	backend.errorRate += (1 - backend.errorRate) * backendErrorRateDecay
+	if threshold > 0 && backend.errorRate >= threshold {
+		backend.healthy = false
+	}
+}
+
+// ============================================================================
+// 服务注册表租约实现
+// ============================================================================
+
+// 服务注册表的哨兵错误
+var (
+	ErrInstanceNotFound = errors.New("service instance not found")
+	ErrInvalidInstance  = errors.New("invalid service instance")
+)
+
+// defaultLeaseTTL 注册时未指定TTL使用的租约时长
+const defaultLeaseTTL = 30 * time.Second
+
+// NewServiceRegistry 创建服务注册表
+func NewServiceRegistry() *ServiceRegistry {
+	return &ServiceRegistry{
+		services:     make(map[string]*ServiceInstance),
+		endpoints:    make(map[string][]*Endpoint),
+		metadata:     make(map[string]*ServiceMetadata),
+		healthStatus: make(map[string]HealthStatus),
+		leases:       make(map[string]*Lease),
+	}
+}
+
+// AddWatcher 注册监听器，实例注册、更新、注销和健康状态变化时收到通知
+func (sr *ServiceRegistry) AddWatcher(watcher RegistryWatcher) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	sr.watchers = append(sr.watchers, watcher)
+}
+
+// Register 注册实例并授予ttl时长的租约，实例需在租约到期前调用Renew续约。
+// 已存在的实例会被替换并通知OnServiceUpdated
+func (sr *ServiceRegistry) Register(instance *ServiceInstance, ttl time.Duration) error {
+	if instance == nil || instance.id == "" {
+		return ErrInvalidInstance
+	}
+	if ttl <= 0 {
+		ttl = defaultLeaseTTL
+	}
+
+	now := time.Now()
+	sr.mutex.Lock()
+	sr.ensureMapsLocked()
+	_, existed := sr.services[instance.id]
+
+	instance.registeredAt = now
+	instance.lastHeartbeat = now
+	instance.status = StatusHealthy
+	sr.services[instance.id] = instance
+	sr.healthStatus[instance.id] = HealthStatusHealthy
+	sr.leases[instance.id] = &Lease{
+		ID:        "lease-" + instance.id,
+		ServiceID: instance.id,
+		TTL:       ttl,
+		ExpiresAt: now.Add(ttl),
+		Renewed:   now,
+	}
+	sr.registrations = append(sr.registrations, &Registration{
+		ID:           fmt.Sprintf("reg-%s-%d", instance.id, now.UnixNano()),
+		ServiceID:    instance.id,
+		RegisteredAt: now,
+		TTL:          ttl,
+	})
+	watchers := sr.watchers
+	sr.mutex.Unlock()
+
+	for _, watcher := range watchers {
+		if existed {
+			watcher.OnServiceUpdated(instance)
+		} else {
+			watcher.OnServiceRegistered(instance)
+		}
+	}
+	return nil
+}
+
+// Renew 续约实例的租约；已被标记为不健康但尚未移除的实例恢复为健康
+func (sr *ServiceRegistry) Renew(instanceID string) error {
+	now := time.Now()
+	sr.mutex.Lock()
+	instance, exists := sr.services[instanceID]
+	lease := sr.leases[instanceID]
+	if !exists || lease == nil {
+		sr.mutex.Unlock()
+		return fmt.Errorf("%w: %s", ErrInstanceNotFound, instanceID)
+	}
+
+	instance.lastHeartbeat = now
+	lease.Renewed = now
+	lease.ExpiresAt = now.Add(lease.TTL)
+	recovered := instance.status == StatusUnhealthy
+	if recovered {
+		instance.status = StatusHealthy
+		sr.healthStatus[instanceID] = HealthStatusHealthy
+	}
+	watchers := sr.watchers
+	sr.mutex.Unlock()
+
+	if recovered {
+		for _, watcher := range watchers {
+			watcher.OnHealthStatusChanged(instanceID, HealthStatusHealthy)
+		}
+	}
+	return nil
+}
+
+// Deregister 注销实例并释放其租约
+func (sr *ServiceRegistry) Deregister(instanceID string) error {
+	sr.mutex.Lock()
+	if _, exists := sr.services[instanceID]; !exists {
+		sr.mutex.Unlock()
+		return fmt.Errorf("%w: %s", ErrInstanceNotFound, instanceID)
+	}
+	sr.removeLocked(instanceID)
+	watchers := sr.watchers
+	sr.mutex.Unlock()
+
+	for _, watcher := range watchers {
+		watcher.OnServiceDeregistered(instanceID)
+	}
+	return nil
+}
+
+// Instance 返回实例，不存在时返回nil
+func (sr *ServiceRegistry) Instance(instanceID string) *ServiceInstance {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+	return sr.services[instanceID]
+}
+
+// Instances 返回服务的全部健康实例，按实例ID排序
+func (sr *ServiceRegistry) Instances(serviceName string) []*ServiceInstance {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+
+	var instances []*ServiceInstance
+	for _, instance := range sr.services {
+		if instance.serviceName == serviceName && instance.status == StatusHealthy {
+			instances = append(instances, instance)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].id < instances[j].id })
+	return instances
+}
+
+// StartSweeper 启动后台清扫协程，每隔interval移除租约过期的实例，重复调用无副作用
+func (sr *ServiceRegistry) StartSweeper(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	if sr.sweepStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	sr.sweepStop = stop
+
+	sr.sweepWG.Add(1)
+	go func() {
+		defer sr.sweepWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				sr.sweep(now)
+			}
+		}
+	}()
+}
+
+// StopSweeper 停止清扫协程并等待其退出
+func (sr *ServiceRegistry) StopSweeper() {
+	sr.mutex.Lock()
+	stop := sr.sweepStop
+	sr.sweepStop = nil
+	sr.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	sr.sweepWG.Wait()
+}
+
+// sweep 心跳超过租约TTL的实例先标记为不健康再从注册表移除，返回被移除的实例ID
+func (sr *ServiceRegistry) sweep(now time.Time) []string {
+	sr.mutex.Lock()
+	var expired []string
+	for id, instance := range sr.services {
+		lease := sr.leases[id]
+		if lease == nil || now.Sub(instance.lastHeartbeat) <= lease.TTL {
+			continue
+		}
+		instance.status = StatusUnhealthy
+		expired = append(expired, id)
+	}
+	sort.Strings(expired)
+	for _, id := range expired {
+		sr.removeLocked(id)
+	}
+	watchers := sr.watchers
+	sr.mutex.Unlock()
+
+	for _, id := range expired {
+		for _, watcher := range watchers {
+			watcher.OnHealthStatusChanged(id, HealthStatusUnhealthy)
+			watcher.OnServiceDeregistered(id)
+		}
+	}
+	return expired
+}
+
+func (sr *ServiceRegistry) removeLocked(instanceID string) {
+	delete(sr.services, instanceID)
+	delete(sr.leases, instanceID)
+	delete(sr.healthStatus, instanceID)
+	delete(sr.endpoints, instanceID)
+
+	registrations := sr.registrations[:0]
+	for _, registration := range sr.registrations {
+		if registration.ServiceID != instanceID {
+			registrations = append(registrations, registration)
+		}
+	}
+	sr.registrations = registrations
+}
+
+// ensureMapsLocked 兼容零值构造的注册表
+func (sr *ServiceRegistry) ensureMapsLocked() {
+	if sr.services == nil {
+		sr.services = make(map[string]*ServiceInstance)
+	}
+	if sr.healthStatus == nil {
+		sr.healthStatus = make(map[string]HealthStatus)
+	}
+	if sr.leases == nil {
+		sr.leases = make(map[string]*Lease)
+	}
+}
+
+// ============================================================================
+// API网关路由实现
+// ============================================================================
+
+// NewAPIGateway 创建使用HTTP传输层的API网关
+func NewAPIGateway() *APIGateway {
+	return NewAPIGatewayWithTransport(nil)
+}
+
+// NewAPIGatewayWithTransport 创建API网关，transport为nil时使用HTTP传输层
+func NewAPIGatewayWithTransport(transport UpstreamTransport) *APIGateway {
+	if transport == nil {
+		transport = &HTTPUpstreamTransport{Client: &http.Client{}}
+	}
+	return &APIGateway{
+		plugins:   make(map[string]GatewayPlugin),
+		transport: transport,
+	}
+}
+
+// SetTracer 设置链路跟踪系统，nil表示不跟踪
+func (gw *APIGateway) SetTracer(tracer *TracingSystem) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+	gw.tracer = tracer
+}
+
+// Use 添加作用于所有路由的网关中间件
+func (gw *APIGateway) Use(middleware GatewayMiddleware) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+	gw.middleware = append(gw.middleware, middleware)
+}
+
+// AddRoute 校验路径模式并登记路由
+func (gw *APIGateway) AddRoute(route *Route) error {
+	if route == nil || route.Backend == nil {
+		return fmt.Errorf("route %v has no backend", route)
+	}
+	segments, err := parsePathPattern(route.PathPattern)
+	if err != nil {
+		return err
+	}
+	route.segments = segments
+
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+	gw.routes = append(gw.routes, route)
+	return nil
+}
+
+// parsePathPattern 将路径模式拆分为段，通配段只能位于末尾
+func parsePathPattern(pattern string) ([]string, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("path pattern %q must start with /", pattern)
+	}
+	segments := splitPath(pattern)
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "*") && i != len(segments)-1 {
+			return nil, fmt.Errorf("path pattern %q: wildcard must be the last segment", pattern)
+		}
+		if segment == ":" {
+			return nil, fmt.Errorf("path pattern %q: parameter needs a name", pattern)
+		}
+	}
+	return segments, nil
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// matchPath 匹配请求路径，返回路径参数和匹配的具体程度：静态段计2分、参数段计1分、通配段不计分
+func (route *Route) matchPath(segments []string) (map[string]string, int, bool) {
+	params := make(map[string]string)
+	specificity := 0
+	for i, pattern := range route.segments {
+		if strings.HasPrefix(pattern, "*") {
+			name := strings.TrimPrefix(pattern, "*")
+			if name == "" {
+				name = "*"
+			}
+			params[name] = strings.Join(segments[min(i, len(segments)):], "/")
+			return params, specificity, true
+		}
+		if i >= len(segments) {
+			return nil, 0, false
+		}
+		switch {
+		case strings.HasPrefix(pattern, ":"):
+			params[pattern[1:]] = segments[i]
+			specificity++
+		case pattern == segments[i]:
+			specificity += 2
+		default:
+			return nil, 0, false
+		}
+	}
+	if len(segments) != len(route.segments) {
+		return nil, 0, false
+	}
+	return params, specificity, true
+}
+
+func (route *Route) allowsMethod(method string) bool {
+	return route.Method == "" || route.Method == "*" || strings.EqualFold(route.Method, method)
+}
+
+// Handle 路由并转发请求：路径不匹配返回404，路径匹配但方法不符返回405并带Allow头；
+// 匹配成功后依次执行网关和路由中间件，最后经路由后端的负载均衡器选出实例转发
+func (gw *APIGateway) Handle(request *Request) (*Response, error) {
+	gw.mutex.RLock()
+	tracer := gw.tracer
+	gw.mutex.RUnlock()
+
+	span := tracer.startHop(request, "gateway "+request.Method)
+	response, err := gw.handle(request, span)
+	tracer.finishHop(span, response, err)
+	return response, err
+}
+
+// handle 执行Handle的路由与转发，有跟踪时把网关span注入转发给后端的请求
+func (gw *APIGateway) handle(request *Request, span *Span) (*Response, error) {
+	path, _, _ := strings.Cut(request.URL, "?")
+	segments := splitPath(path)
+
+	gw.mutex.RLock()
+	var matched *Route
+	var params map[string]string
+	best := -1
+	var allowed []string
+	for _, route := range gw.routes {
+		routeParams, specificity, ok := route.matchPath(segments)
+		if !ok {
+			continue
+		}
+		if !route.allowsMethod(request.Method) {
+			allowed = append(allowed, strings.ToUpper(route.Method))
+			continue
+		}
+		if specificity > best {
+			matched, params, best = route, routeParams, specificity
+		}
+	}
+	middleware := append([]GatewayMiddleware(nil), gw.middleware...)
+	transport := gw.transport
+	gw.mutex.RUnlock()
+
+	if matched == nil {
+		if len(allowed) > 0 {
+			sort.Strings(allowed)
+			return &Response{
+				StatusCode: http.StatusMethodNotAllowed,
+				Headers:    map[string]string{"Allow": strings.Join(allowed, ", ")},
+			}, nil
+		}
+		return &Response{StatusCode: http.StatusNotFound}, nil
+	}
+
+	request.Params = params
+	if span != nil {
+		span.SetTag("route", matched.PathPattern)
+	}
+	middleware = append(middleware, matched.Middleware...)
+	sort.SliceStable(middleware, func(i, j int) bool { return middleware[i].Priority() > middleware[j].Priority() })
+
+	response := &Response{}
+	var forwardErr error
+	var next func(index int)
+	next = func(index int) {
+		if index < len(middleware) {
+			middleware[index].Process(request, response, func() { next(index + 1) })
+			return
+		}
+		if span != nil {
+			InjectTraceparent(ContextWithSpan(context.Background(), span), request)
+		}
+		result, err := forwardToBackend(transport, matched.Backend, request)
+		if err != nil {
+			forwardErr = err
+			return
+		}
+		*response = *result
+	}
+	next(0)
+
+	if forwardErr != nil {
+		return nil, forwardErr
+	}
+	return response, nil
+}
+
+// forwardToBackend 由负载均衡器选出后端并发送请求，失败时反馈给负载均衡器
+func forwardToBackend(transport UpstreamTransport, lb *LoadBalancer, request *Request) (*Response, error) {
+	backend, cookie := lb.SelectBackendWithSession(request)
+	if backend == nil {
+		return nil, &ProxyError{Type: ErrorTypeNetwork, Err: ErrNoHealthyUpstream}
+	}
+
+	upstream := &UpstreamService{ID: backend.id, Address: backend.address, Weight: backend.weight}
+	if backend.port > 0 {
+		upstream.Address = net.JoinHostPort(backend.address, strconv.Itoa(backend.port))
+	}
+	response, err := transport.RoundTrip(context.Background(), upstream, request)
+	if err != nil {
+		lb.ReportFailure(backend, err)
+		return nil, &ProxyError{Type: ErrorTypeNetwork, Upstream: backend.id, Err: err}
+	}
+	if cookie != "" {
+		headers := make(map[string]string, len(response.Headers)+1)
+		for key, value := range response.Headers {
+			headers[key] = value
+		}
+		headers["Set-Cookie"] = cookie
+		response = &Response{StatusCode: response.StatusCode, Headers: headers, Body: response.Body}
+	}
+	return response, nil
+}
+
+// ============================================================================
+// 加权流量分割实现
+// ============================================================================
+
+// TrafficSplit 流量子集及其相对权重
+type TrafficSplit struct {
+	Subset string
+	Weight float64
+}
+
+// TrafficSplitPolicy 服务的流量分割策略。Sticky为true时按客户端标识哈希选择子集，
+// 同一客户端始终落在同一子集（金丝雀成员固定），否则每个请求独立随机选择
+type TrafficSplitPolicy struct {
+	Splits []TrafficSplit
+	Sticky bool
+}
+
+// TrafficManager 按服务管理流量分割策略
+type TrafficManager struct {
+	policies map[string]*normalizedSplit
+	mutex    sync.RWMutex
+}
+
+// normalizedSplit 归一化后的累积权重，cumulative[i]为前i+1个子集的权重和，最后一项为1
+type normalizedSplit struct {
+	subsets    []string
+	cumulative []float64
+	sticky     bool
+}
+
+// NewTrafficManager 创建流量管理器
+func NewTrafficManager() *TrafficManager {
+	return &TrafficManager{policies: make(map[string]*normalizedSplit)}
+}
+
+// SetSplit 校验并归一化服务的分割权重：权重不能为负、子集不能重复，且总权重必须大于0
+func (tm *TrafficManager) SetSplit(serviceID string, policy *TrafficSplitPolicy) error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if tm.policies == nil {
+		tm.policies = make(map[string]*normalizedSplit)
+	}
+	if policy == nil {
+		delete(tm.policies, serviceID)
+		return nil
+	}
+
+	total := 0.0
+	seen := make(map[string]bool, len(policy.Splits))
+	for _, split := range policy.Splits {
+		if split.Subset == "" {
+			return fmt.Errorf("traffic split for %s: subset name is required", serviceID)
+		}
+		if seen[split.Subset] {
+			return fmt.Errorf("traffic split for %s: duplicate subset %q", serviceID, split.Subset)
+		}
+		seen[split.Subset] = true
+		if split.Weight < 0 || math.IsNaN(split.Weight) || math.IsInf(split.Weight, 0) {
+			return fmt.Errorf("traffic split for %s: invalid weight %v for subset %q", serviceID, split.Weight, split.Subset)
+		}
+		total += split.Weight
+	}
+	if total <= 0 {
+		return fmt.Errorf("traffic split for %s: total weight must be positive", serviceID)
+	}
+
+	normalized := &normalizedSplit{sticky: policy.Sticky}
+	sum := 0.0
+	for _, split := range policy.Splits {
+		if split.Weight == 0 {
+			continue
+		}
+		sum += split.Weight / total
+		normalized.subsets = append(normalized.subsets, split.Subset)
+		normalized.cumulative = append(normalized.cumulative, sum)
+	}
+	normalized.cumulative[len(normalized.cumulative)-1] = 1
+	tm.policies[serviceID] = normalized
+	return nil
+}
+
+// Weights 返回服务归一化后的子集权重，未配置分割时返回nil
+func (tm *TrafficManager) Weights(serviceID string) map[string]float64 {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	policy, exists := tm.policies[serviceID]
+	if !exists {
+		return nil
+	}
+	weights := make(map[string]float64, len(policy.subsets))
+	previous := 0.0
+	for i, subset := range policy.subsets {
+		weights[subset] = policy.cumulative[i] - previous
+		previous = policy.cumulative[i]
+	}
+	return weights
+}
+
+// SelectSubset 按权重为请求选择子集，服务未配置分割时返回false
+func (tm *TrafficManager) SelectSubset(serviceID string, request *Request) (string, bool) {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	policy, exists := tm.policies[serviceID]
+	if !exists {
+		return "", false
+	}
+
+	var point float64
+	if key := requestHashKey(request); policy.sticky && key != "" {
+		// 取哈希高53位映射到[0,1)，保证同一客户端得到同一位置
+		point = float64(hashKey(serviceID+"/"+key)>>11) / (1 << 53)
+	} else {
+		point = rand.Float64()
+	}
+	index := sort.Search(len(policy.cumulative), func(i int) bool { return point < policy.cumulative[i] })
+	if index == len(policy.subsets) {
+		index = len(policy.subsets) - 1
+	}
+	return policy.subsets[index], true
+}
+
+// ============================================================================
+// 链路跟踪实现
+// ============================================================================
+
+// TraceparentHeader W3C Trace Context的请求头，格式为version-traceid-parentid-flags
+const TraceparentHeader = "Traceparent"
+
+// traceFlagSampled traceparent标志位中的采样位
+const traceFlagSampled = 0x01
+
+// Span 一次操作的跟踪记录。ParentID为空表示根span；远端span只携带从请求头解析出的标识
+type Span struct {
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Tags     map[string]string
+	flags    byte
+	remote   bool
+	mutex    sync.Mutex
+}
+
+// SetTag 设置span标签
+func (span *Span) SetTag(key, value string) {
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	if span.Tags == nil {
+		span.Tags = make(map[string]string)
+	}
+	span.Tags[key] = value
+}
+
+// Sampled 判断span是否被采样，未采样的span照常传播但不导出
+func (span *Span) Sampled() bool {
+	return span.flags&traceFlagSampled != 0
+}
+
+// TraceExporter 跟踪导出器，接收已结束的span
+type TraceExporter interface {
+	Export(span *Span) error
+}
+
+// InMemoryTraceExporter 把span保存在内存中的导出器，用于测试和调试
+type InMemoryTraceExporter struct {
+	spans []*Span
+	mutex sync.Mutex
+}
+
+// NewInMemoryTraceExporter 创建内存导出器
+func NewInMemoryTraceExporter() *InMemoryTraceExporter {
+	return &InMemoryTraceExporter{}
+}
+
+// Export 保存span
+func (e *InMemoryTraceExporter) Export(span *Span) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+// Spans 按结束顺序返回已导出的span
+func (e *InMemoryTraceExporter) Spans() []*Span {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset 清空已导出的span
+func (e *InMemoryTraceExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan 返回携带span的上下文，之后在其上开始的span以它为父span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext 返回上下文中的当前span，没有时返回nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// AddExporter 添加跟踪导出器
+func (ts *TracingSystem) AddExporter(exporter TraceExporter) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.exporters = append(ts.exporters, exporter)
+}
+
+// StartSpan 开始一个span：上下文中有span时继承其跟踪ID和采样标志并以它为父span，
+// 否则开始一个新的被采样的跟踪。返回的上下文携带新span
+func (ts *TracingSystem) StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	span := &Span{
+		SpanID: newTraceID(8),
+		Name:   name,
+		Start:  time.Now(),
+		flags:  traceFlagSampled,
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+		span.flags = parent.flags
+	} else {
+		span.TraceID = newTraceID(16)
+	}
+
+	ts.mutex.Lock()
+	if ts.spans == nil {
+		ts.spans = make(map[string]*Span)
+	}
+	ts.spans[span.SpanID] = span
+	ts.mutex.Unlock()
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// Finish 结束span并交给所有导出器，未采样或已结束的span不再导出
+func (ts *TracingSystem) Finish(span *Span) error {
+	if span == nil || span.remote {
+		return nil
+	}
+	span.mutex.Lock()
+	finished := !span.End.IsZero()
+	if !finished {
+		span.End = time.Now()
+	}
+	span.mutex.Unlock()
+	if finished {
+		return nil
+	}
+
+	ts.mutex.Lock()
+	delete(ts.spans, span.SpanID)
+	exporters := append([]TraceExporter(nil), ts.exporters...)
+	ts.mutex.Unlock()
+
+	if !span.Sampled() {
+		return nil
+	}
+	var errs []error
+	for _, exporter := range exporters {
+		if err := exporter.Export(span); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ActiveSpans 返回已开始但尚未结束的span数量
+func (ts *TracingSystem) ActiveSpans() int {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	return len(ts.spans)
+}
+
+// startHop 以请求头中的traceparent为父span开始一个服务端span，ts为nil时不跟踪。
+// 请求头格式错误时按W3C规范忽略它并开始新的跟踪
+func (ts *TracingSystem) startHop(request *Request, name string) *Span {
+	if ts == nil {
+		return nil
+	}
+	ctx, err := ExtractTraceparent(context.Background(), request)
+	if err != nil {
+		ctx = context.Background()
+	}
+	_, span := ts.StartSpan(ctx, name)
+	return span
+}
+
+// finishHop 记录转发结果并结束span
+func (ts *TracingSystem) finishHop(span *Span, response *Response, err error) {
+	if ts == nil || span == nil {
+		return
+	}
+	if err != nil {
+		span.SetTag("error", err.Error())
+	} else if response != nil {
+		span.SetTag("status", strconv.Itoa(response.StatusCode))
+	}
+	ts.Finish(span)
+}
+
+// InjectTraceparent 把上下文中的当前span写入请求的traceparent头，上下文中没有span时不做修改
+func InjectTraceparent(ctx context.Context, request *Request) {
+	span := SpanFromContext(ctx)
+	if span == nil || request == nil {
+		return
+	}
+	if request.Headers == nil {
+		request.Headers = make(map[string]string)
+	}
+	request.Headers[TraceparentHeader] = FormatTraceparent(span)
+}
+
+// ExtractTraceparent 解析请求的traceparent头，返回携带远端父span的上下文；
+// 请求没有该头时原样返回ctx，格式错误时返回错误
+func ExtractTraceparent(ctx context.Context, request *Request) (context.Context, error) {
+	if request == nil {
+		return ctx, nil
+	}
+	header, exists := request.Headers[TraceparentHeader]
+	if !exists {
+		return ctx, nil
+	}
+	span, err := ParseTraceparent(header)
+	if err != nil {
+		return ctx, err
+	}
+	return ContextWithSpan(ctx, span), nil
+}
+
+// FormatTraceparent 按W3C版本00格式化span的traceparent值
+func FormatTraceparent(span *Span) string {
+	return fmt.Sprintf("00-%s-%s-%02x", span.TraceID, span.SpanID, span.flags)
+}
+
+// ParseTraceparent 解析traceparent值为远端span。跟踪ID为32位、span ID为16位小写十六进制且不能全为0；
+// 版本ff非法，未来版本允许在标志后附加字段
+func ParseTraceparent(value string) (*Span, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return nil, fmt.Errorf("traceparent %q: expected version-traceid-parentid-flags", value)
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return nil, fmt.Errorf("traceparent %q: unsupported version %q", value, version)
+	}
+	if !isLowerHex(traceID, 32) || strings.Trim(traceID, "0") == "" {
+		return nil, fmt.Errorf("traceparent %q: invalid trace ID", value)
+	}
+	if !isLowerHex(spanID, 16) || strings.Trim(spanID, "0") == "" {
+		return nil, fmt.Errorf("traceparent %q: invalid parent ID", value)
+	}
+	if !isLowerHex(flags, 2) {
+		return nil, fmt.Errorf("traceparent %q: invalid flags", value)
+	}
+	flagBits, _ := hex.DecodeString(flags)
+
+	return &Span{TraceID: traceID, SpanID: spanID, flags: flagBits[0], remote: true}, nil
+}
+
+func isLowerHex(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+	for _, c := range value {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// newTraceID 生成n字节的非零随机标识，以小写十六进制表示
+func newTraceID(n int) string {
+	id := make([]byte, n)
+	for {
+		for i := range id {
+			id[i] = byte(rand.Intn(256))
+		}
+		for _, b := range id {
+			if b != 0 {
+				return hex.EncodeToString(id)
+			}
+		}
+	}
+}
+
+// ============================================================================
+// Prometheus指标导出实现
+// ============================================================================
+
+// defaultLatencyBuckets 延迟直方图的默认桶上界，与Prometheus客户端的默认桶一致
+var defaultLatencyBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// LatencyHistogram 固定桶的延迟直方图，并发安全
+type LatencyHistogram struct {
+	bounds []time.Duration
+	counts []uint64 // counts[i]为落入(bounds[i-1], bounds[i]]的观测数，最后一项为超出所有上界的观测数
+	count  uint64
+	sum    time.Duration
+	mutex  sync.Mutex
+}
+
+// HistogramSnapshot 直方图快照，Cumulative[i]为不超过Bounds[i]的观测数
+type HistogramSnapshot struct {
+	Bounds     []time.Duration
+	Cumulative []uint64
+	Count      uint64
+	Sum        time.Duration
+}
+
+// NewLatencyHistogram 创建直方图，未指定上界时使用默认桶；上界会被排序去重
+func NewLatencyHistogram(bounds ...time.Duration) *LatencyHistogram {
+	if len(bounds) == 0 {
+		bounds = defaultLatencyBuckets
+	}
+	sorted := append([]time.Duration(nil), bounds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	unique := sorted[:0]
+	for i, bound := range sorted {
+		if i == 0 || bound != sorted[i-1] {
+			unique = append(unique, bound)
+		}
+	}
+	return &LatencyHistogram{bounds: unique, counts: make([]uint64, len(unique)+1)}
+}
+
+// Observe 记录一次观测
+func (h *LatencyHistogram) Observe(latency time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	index := sort.Search(len(h.bounds), func(i int) bool { return latency <= h.bounds[i] })
+	h.counts[index]++
+	h.count++
+	h.sum += latency
+}
+
+// Snapshot 返回累积计数形式的快照
+func (h *LatencyHistogram) Snapshot() HistogramSnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	snapshot := HistogramSnapshot{
+		Bounds:     append([]time.Duration(nil), h.bounds...),
+		Cumulative: make([]uint64, len(h.bounds)),
+		Count:      h.count,
+		Sum:        h.sum,
+	}
+	var running uint64
+	for i := range h.bounds {
+		running += h.counts[i]
+		snapshot.Cumulative[i] = running
+	}
+	return snapshot
+}
+
+// Exposition 以Prometheus文本格式导出服务网格、代理和负载均衡器的指标。
+// 标签只使用服务ID、负载均衡器名和后端ID，序列数随服务和后端数量线性增长
+type Exposition struct {
+	mesh          *ServiceMesh
+	loadBalancers map[string]*LoadBalancer
+	mutex         sync.RWMutex
+}
+
+// NewExposition 创建指标导出端点，mesh可以为nil
+func NewExposition(mesh *ServiceMesh) *Exposition {
+	return &Exposition{mesh: mesh, loadBalancers: make(map[string]*LoadBalancer)}
+}
+
+// AddLoadBalancer 以name为lb标签登记负载均衡器
+func (e *Exposition) AddLoadBalancer(name string, lb *LoadBalancer) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.loadBalancers[name] = lb
+}
+
+// ServeHTTP 返回当前指标
+func (e *Exposition) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if r.Method == http.MethodGet {
+		e.WriteTo(w)
+	}
+}
+
+// WriteTo 写出所有指标，服务、负载均衡器和后端按名称排序
+func (e *Exposition) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	if e.mesh != nil {
+		e.writeMesh(&buf)
+	}
+	e.writeLoadBalancers(&buf)
+	return buf.WriteTo(w)
+}
+
+func (e *Exposition) writeMesh(buf *bytes.Buffer) {
+	sm := e.mesh
+	sm.mutex.RLock()
+	stats := sm.statistics
+	var latency HistogramSnapshot
+	if sm.latency != nil {
+		latency = sm.latency.Snapshot()
+	}
+	proxies := make([]*ServiceProxy, 0, len(sm.proxies))
+	for _, proxy := range sm.proxies {
+		proxies = append(proxies, proxy)
+	}
+	sm.mutex.RUnlock()
+	sort.Slice(proxies, func(i, j int) bool { return proxies[i].serviceID < proxies[j].serviceID })
+
+	writeMetricHeader(buf, "mesh_requests_total", "counter", "Requests forwarded through the service mesh.")
+	writeSample(buf, "mesh_requests_total", nil, float64(stats.TotalRequests))
+	writeMetricHeader(buf, "mesh_request_success_ratio", "gauge", "Fraction of mesh requests that completed without error or 5xx.")
+	writeSample(buf, "mesh_request_success_ratio", nil, stats.SuccessRate)
+	writeMetricHeader(buf, "mesh_request_duration_seconds", "histogram", "Latency of requests forwarded through the service mesh.")
+	writeHistogram(buf, "mesh_request_duration_seconds", nil, latency)
+
+	type proxySnapshot struct {
+		service string
+		metrics ProxyMetrics
+		errors  int64
+		latency HistogramSnapshot
+	}
+	snapshots := make([]proxySnapshot, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy.mutex.RLock()
+		snapshot := proxySnapshot{service: proxy.serviceID, metrics: *proxy.metrics, errors: proxy.errorCount}
+		if proxy.latency != nil {
+			snapshot.latency = proxy.latency.Snapshot()
+		}
+		proxy.mutex.RUnlock()
+		snapshots = append(snapshots, snapshot)
+	}
+
+	writeMetricHeader(buf, "proxy_requests_total", "counter", "Requests handled by each service proxy.")
+	for _, snapshot := range snapshots {
+		writeSample(buf, "proxy_requests_total", []string{"service", snapshot.service}, float64(snapshot.metrics.RequestCount))
+	}
+	writeMetricHeader(buf, "proxy_errors_total", "counter", "Requests that failed in each service proxy.")
+	for _, snapshot := range snapshots {
+		writeSample(buf, "proxy_errors_total", []string{"service", snapshot.service}, float64(snapshot.errors))
+	}
+	writeMetricHeader(buf, "proxy_request_duration_seconds", "histogram", "Latency of requests handled by each service proxy.")
+	for _, snapshot := range snapshots {
+		writeHistogram(buf, "proxy_request_duration_seconds", []string{"service", snapshot.service}, snapshot.latency)
+	}
+}
+
+func (e *Exposition) writeLoadBalancers(buf *bytes.Buffer) {
+	e.mutex.RLock()
+	names := make([]string, 0, len(e.loadBalancers))
+	for name := range e.loadBalancers {
+		names = append(names, name)
+	}
+	balancers := make(map[string]*LoadBalancer, len(e.loadBalancers))
+	for name, lb := range e.loadBalancers {
+		balancers[name] = lb
+	}
+	e.mutex.RUnlock()
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+
+	type backendSnapshot struct {
+		id          string
+		healthy     bool
+		connections int
+		errorRate   float64
+	}
+	type balancerSnapshot struct {
+		name     string
+		stats    LoadBalancerStatistics
+		backends []backendSnapshot
+	}
+	snapshots := make([]balancerSnapshot, 0, len(names))
+	for _, name := range names {
+		lb := balancers[name]
+		lb.mutex.RLock()
+		snapshot := balancerSnapshot{name: name, stats: lb.statistics}
+		snapshot.stats.ActiveConnections = 0
+		for _, backend := range lb.backends {
+			snapshot.stats.ActiveConnections += backend.connections
+			snapshot.backends = append(snapshot.backends, backendSnapshot{
+				id:          backend.id,
+				healthy:     backend.healthy,
+				connections: backend.connections,
+				errorRate:   backend.errorRate,
+			})
+		}
+		lb.mutex.RUnlock()
+		sort.Slice(snapshot.backends, func(i, j int) bool { return snapshot.backends[i].id < snapshot.backends[j].id })
+		snapshots = append(snapshots, snapshot)
+	}
+
+	writeMetricHeader(buf, "loadbalancer_requests_total", "counter", "Backend selections requested from each load balancer.")
+	for _, snapshot := range snapshots {
+		writeSample(buf, "loadbalancer_requests_total", []string{"lb", snapshot.name}, float64(snapshot.stats.TotalRequests))
+	}
+	writeMetricHeader(buf, "loadbalancer_failed_requests_total", "counter", "Requests with no available backend or a failed backend call.")
+	for _, snapshot := range snapshots {
+		writeSample(buf, "loadbalancer_failed_requests_total", []string{"lb", snapshot.name}, float64(snapshot.stats.FailedRequests))
+	}
+	writeMetricHeader(buf, "loadbalancer_active_connections", "gauge", "Open connections across all backends of each load balancer.")
+	for _, snapshot := range snapshots {
+		writeSample(buf, "loadbalancer_active_connections", []string{"lb", snapshot.name}, float64(snapshot.stats.ActiveConnections))
+	}
+	writeMetricHeader(buf, "loadbalancer_backend_active_connections", "gauge", "Open connections per backend.")
+	for _, snapshot := range snapshots {
+		for _, backend := range snapshot.backends {
+			writeSample(buf, "loadbalancer_backend_active_connections", []string{"lb", snapshot.name, "backend", backend.id}, float64(backend.connections))
+		}
+	}
+	writeMetricHeader(buf, "loadbalancer_backend_error_rate", "gauge", "Decayed error rate per backend.")
+	for _, snapshot := range snapshots {
+		for _, backend := range snapshot.backends {
+			writeSample(buf, "loadbalancer_backend_error_rate", []string{"lb", snapshot.name, "backend", backend.id}, backend.errorRate)
+		}
+	}
+	writeMetricHeader(buf, "loadbalancer_backend_healthy", "gauge", "Whether each backend is considered healthy (1) or not (0).")
+	for _, snapshot := range snapshots {
+		for _, backend := range snapshot.backends {
+			healthy := 0.0
+			if backend.healthy {
+				healthy = 1
+			}
+			writeSample(buf, "loadbalancer_backend_healthy", []string{"lb", snapshot.name, "backend", backend.id}, healthy)
+		}
+	}
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, metricType, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeSample 写出一个样本，labels按键值对交替排列
+func writeSample(buf *bytes.Buffer, name string, labels []string, value float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 {
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1]))
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatMetricValue(value))
+	buf.WriteByte('\n')
+}
+
+// writeHistogram 写出直方图的累积桶、+Inf桶、_sum（秒）和_count
+func writeHistogram(buf *bytes.Buffer, name string, labels []string, snapshot HistogramSnapshot) {
+	for i, bound := range snapshot.Bounds {
+		writeSample(buf, name+"_bucket", append(labels[:len(labels):len(labels)], "le", formatMetricValue(bound.Seconds())), float64(snapshot.Cumulative[i]))
+	}
+	writeSample(buf, name+"_bucket", append(labels[:len(labels):len(labels)], "le", "+Inf"), float64(snapshot.Count))
+	writeSample(buf, name+"_sum", labels, snapshot.Sum.Seconds())
+	writeSample(buf, name+"_count", labels, float64(snapshot.Count))
+}
+
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escapeLabelValue 按文本格式转义标签值中的反斜杠、双引号和换行
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// ============================================================================
+// 一致性哈希分片实现
+// ============================================================================
+
+// ShardID 分片标识
+type ShardID string
+
+// defaultShardReplicas 每个分片在哈希环上的默认虚拟节点数
+const defaultShardReplicas = 160
+
+// shardRingNode 分片哈希环上的虚拟节点
+type shardRingNode struct {
+	hash  uint64
+	shard ShardID
+}
+
+// KeyDistributor 基于虚拟节点一致性哈希把键映射到分片。键归属于环上顺时针最近的虚拟节点，
+// 增删分片时只有新分片接管或旧分片释放的区间内的键被重新映射
+type KeyDistributor struct {
+	replicas    int
+	ring        []shardRingNode
+	shards      map[ShardID]bool
+	assignments map[ShardID]int64
+	mutex       sync.RWMutex
+}
+
+// ShardLoad 分片的负载：Keys为已分配的键数，Ownership为分片拥有的哈希空间比例
+type ShardLoad struct {
+	Keys      int64
+	Ownership float64
+}
+
+// DistributionStats 各分片的负载分布，Imbalance为分配键数最多的分片与平均值之比
+type DistributionStats struct {
+	Shards    map[ShardID]ShardLoad
+	TotalKeys int64
+	Imbalance float64
+}
+
+// NewKeyDistributor 创建键分配器，replicas为每个分片的虚拟节点数，0使用默认值
+func NewKeyDistributor(replicas int) *KeyDistributor {
+	if replicas <= 0 {
+		replicas = defaultShardReplicas
+	}
+	return &KeyDistributor{
+		replicas:    replicas,
+		shards:      make(map[ShardID]bool),
+		assignments: make(map[ShardID]int64),
+	}
+}
+
+// AddShard 把分片的虚拟节点加入哈希环
+func (kd *KeyDistributor) AddShard(id ShardID) error {
+	kd.mutex.Lock()
+	defer kd.mutex.Unlock()
+	if id == "" {
+		return fmt.Errorf("shard ID is required")
+	}
+	if kd.shards[id] {
+		return fmt.Errorf("shard %s already exists", id)
+	}
+	kd.shards[id] = true
+	for i := 0; i < kd.replicas; i++ {
+		kd.ring = append(kd.ring, shardRingNode{hash: hashKey(string(id) + "#" + strconv.Itoa(i)), shard: id})
+	}
+	// 哈希相同时按分片ID排序，保证环与分片加入顺序无关
+	sort.Slice(kd.ring, func(i, j int) bool {
+		if kd.ring[i].hash != kd.ring[j].hash {
+			return kd.ring[i].hash < kd.ring[j].hash
+		}
+		return kd.ring[i].shard < kd.ring[j].shard
+	})
+	return nil
+}
+
+// RemoveShard 从哈希环上移除分片，其区间由各自顺时针的下一个分片接管
+func (kd *KeyDistributor) RemoveShard(id ShardID) error {
+	kd.mutex.Lock()
+	defer kd.mutex.Unlock()
+	if !kd.shards[id] {
+		return fmt.Errorf("shard %s not found", id)
+	}
+	delete(kd.shards, id)
+	delete(kd.assignments, id)
+	kept := kd.ring[:0]
+	for _, node := range kd.ring {
+		if node.shard != id {
+			kept = append(kept, node)
+		}
+	}
+	kd.ring = kept
+	return nil
+}
+
+// AssignShard 返回键所属的分片并计入负载统计，没有分片时返回空ID
+func (kd *KeyDistributor) AssignShard(key string) ShardID {
+	kd.mutex.Lock()
+	defer kd.mutex.Unlock()
+	shard := ringOwner(kd.ring, hashKey(key))
+	if shard != "" {
+		kd.assignments[shard]++
+	}
+	return shard
+}
+
+// Shards 返回按ID排序的分片列表
+func (kd *KeyDistributor) Shards() []ShardID {
+	kd.mutex.RLock()
+	defer kd.mutex.RUnlock()
+	shards := make([]ShardID, 0, len(kd.shards))
+	for id := range kd.shards {
+		shards = append(shards, id)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i] < shards[j] })
+	return shards
+}
+
+// Stats 返回各分片已分配的键数和拥有的哈希空间比例
+func (kd *KeyDistributor) Stats() DistributionStats {
+	kd.mutex.RLock()
+	defer kd.mutex.RUnlock()
+
+	stats := DistributionStats{Shards: make(map[ShardID]ShardLoad, len(kd.shards))}
+	for id := range kd.shards {
+		stats.Shards[id] = ShardLoad{Keys: kd.assignments[id]}
+	}
+	for i, node := range kd.ring {
+		// 节点拥有(前一个节点, 自身]的区间，第一个节点的区间跨越环的零点
+		previous := kd.ring[(i+len(kd.ring)-1)%len(kd.ring)].hash
+		load := stats.Shards[node.shard]
+		load.Ownership += float64(node.hash-previous) / math.Pow(2, 64)
+		if len(kd.ring) == 1 {
+			load.Ownership = 1
+		}
+		stats.Shards[node.shard] = load
+	}
+
+	var maxKeys int64
+	for _, load := range stats.Shards {
+		stats.TotalKeys += load.Keys
+		maxKeys = max(maxKeys, load.Keys)
+	}
+	if stats.TotalKeys > 0 {
+		stats.Imbalance = float64(maxKeys) / (float64(stats.TotalKeys) / float64(len(stats.Shards)))
+	}
+	return stats
+}
+
+// snapshot 返回当前哈希环的副本
+func (kd *KeyDistributor) snapshot() []shardRingNode {
+	kd.mutex.RLock()
+	defer kd.mutex.RUnlock()
+	return append([]shardRingNode(nil), kd.ring...)
+}
+
+// ringOwner 返回哈希值在环上顺时针最近的虚拟节点所属的分片
+func ringOwner(ring []shardRingNode, hash uint64) ShardID {
+	if len(ring) == 0 {
+		return ""
+	}
+	index := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= hash })
+	if index == len(ring) {
+		index = 0
+	}
+	return ring[index].shard
+}
+
+// KeyRangeMove 归属发生变化的哈希区间(Start, End]。Start不小于End时区间跨越环的零点
+type KeyRangeMove struct {
+	Start uint64
+	End   uint64
+	From  ShardID
+	To    ShardID
+}
+
+// Contains 判断哈希值是否落在区间内
+func (move KeyRangeMove) Contains(hash uint64) bool {
+	if move.Start < move.End {
+		return hash > move.Start && hash <= move.End
+	}
+	return hash > move.Start || hash <= move.End
+}
+
+// ContainsKey 判断键是否落在区间内
+func (move KeyRangeMove) ContainsKey(key string) bool {
+	return move.Contains(hashKey(key))
+}
+
+// ReshardingManager 跟踪键分配器上一次再平衡时的哈希环，计算此后分片变化导致迁移的区间
+type ReshardingManager struct {
+	distributor *KeyDistributor
+	applied     []shardRingNode
+	mutex       sync.Mutex
+}
+
+// NewReshardingManager 以分配器当前的哈希环为基线创建再平衡管理器
+func NewReshardingManager(distributor *KeyDistributor) *ReshardingManager {
+	return &ReshardingManager{distributor: distributor, applied: distributor.snapshot()}
+}
+
+// Rebalance 返回自上次再平衡以来归属发生变化的哈希区间，并以当前哈希环作为新的基线。
+// 相邻且迁移方向相同的区间被合并；从空环开始或变为空环时没有可迁移的数据，返回nil
+func (rm *ReshardingManager) Rebalance() []KeyRangeMove {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	current := rm.distributor.snapshot()
+	before := rm.applied
+	rm.applied = current
+	if len(before) == 0 || len(current) == 0 {
+		return nil
+	}
+
+	// 两个环的虚拟节点把哈希空间切成若干段，每段在两个环上各自只有一个归属
+	boundaries := make([]uint64, 0, len(before)+len(current))
+	for _, node := range before {
+		boundaries = append(boundaries, node.hash)
+	}
+	for _, node := range current {
+		boundaries = append(boundaries, node.hash)
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i] < boundaries[j] })
+	unique := boundaries[:0]
+	for i, boundary := range boundaries {
+		if i == 0 || boundary != boundaries[i-1] {
+			unique = append(unique, boundary)
+		}
+	}
+
+	var moves []KeyRangeMove
+	for i, end := range unique {
+		start := unique[(i+len(unique)-1)%len(unique)]
+		from, to := ringOwner(before, end), ringOwner(current, end)
+		if from == to {
+			continue
+		}
+		if n := len(moves); n > 0 && moves[n-1].End == start && moves[n-1].From == from && moves[n-1].To == to {
+			moves[n-1].End = end
+			continue
+		}
+		moves = append(moves, KeyRangeMove{Start: start, End: end, From: from, To: to})
+	}
+	// 第一段跨越零点，能与最后一段衔接时合并
+	if n := len(moves); n > 1 && moves[0].Start == moves[n-1].End && moves[0].From == moves[n-1].From && moves[0].To == moves[n-1].To {
+		moves[0].Start = moves[n-1].Start
+		moves = moves[:n-1]
+	}
+	return moves
+}
+
+// ============================================================================
+// 目标跟踪自动扩缩容实现
+// ============================================================================
+
+// MetricSource 扩缩容的指标来源，返回目标各副本的平均CPU使用率（百分比）
+type MetricSource interface {
+	CPUPercent(target string) (float64, error)
+}
+
+// ReplicaScaler 执行扩缩容的编排器，签名与容器编排器的ScaleDeployment一致
+type ReplicaScaler interface {
+	ScaleDeployment(deploymentID string, replicas int32) error
+}
+
+// ScalingEventListener 扩缩容事件监听器
+type ScalingEventListener interface {
+	OnScale(event ScalingEvent)
+}
+
+// AutoScalerConfig 自动扩缩容配置。Tolerance为使用率与目标之比偏离1的容忍度，
+// 偏离不超过它时不调整副本数；冷却时间从目标上一次扩缩容算起
+type AutoScalerConfig struct {
+	Enabled           bool
+	Tolerance         float64
+	ScaleUpCooldown   time.Duration
+	ScaleDownCooldown time.Duration
+}
+
+// AutoScalerStatistics 自动扩缩容统计
+type AutoScalerStatistics struct {
+	Evaluations int64
+	ScaleUps    int64
+	ScaleDowns  int64
+	Suppressed  int64 // 因冷却而放弃的调整次数
+}
+
+// ScalingEvent 一次扩缩容
+type ScalingEvent struct {
+	Target       string
+	FromReplicas int
+	ToReplicas   int
+	Utilization  float64
+	Reason       string
+	Timestamp    time.Time
+}
+
+// DefaultAutoScalerConfig 返回默认配置：容忍10%的偏差，扩容冷却1分钟，缩容冷却5分钟
+func DefaultAutoScalerConfig() AutoScalerConfig {
+	return AutoScalerConfig{
+		Enabled:           true,
+		Tolerance:         0.1,
+		ScaleUpCooldown:   time.Minute,
+		ScaleDownCooldown: 5 * time.Minute,
+	}
+}
+
+// SetConfig 替换扩缩容配置
+func (as *AutoScaler) SetConfig(config AutoScalerConfig) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	as.config = config
+}
+
+// SetMetricSource 设置指标来源
+func (as *AutoScaler) SetMetricSource(source MetricSource) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	as.metricSource = source
+}
+
+// SetReplicaScaler 设置执行扩缩容的编排器
+func (as *AutoScaler) SetReplicaScaler(scaler ReplicaScaler) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	as.replicaScaler = scaler
+}
+
+// AddListener 注册扩缩容事件监听器
+func (as *AutoScaler) AddListener(listener ScalingEventListener) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	as.listeners = append(as.listeners, listener)
+}
+
+// AddTarget 校验并登记扩缩容目标，当前副本数被限制在上下限之内
+func (as *AutoScaler) AddTarget(target *ScalingTarget) error {
+	if target == nil || target.Name == "" {
+		return fmt.Errorf("scaling target requires a name")
+	}
+	if target.MinReplicas < 1 || target.MaxReplicas < target.MinReplicas {
+		return fmt.Errorf("scaling target %s: invalid replica bounds [%d, %d]", target.Name, target.MinReplicas, target.MaxReplicas)
+	}
+	if target.TargetCPU <= 0 || target.TargetCPU > 100 {
+		return fmt.Errorf("scaling target %s: target CPU must be in (0, 100], got %v", target.Name, target.TargetCPU)
+	}
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	target.CurrentReplicas = min(max(target.CurrentReplicas, target.MinReplicas), target.MaxReplicas)
+	target.DesiredReplicas = target.CurrentReplicas
+	as.targets[target.Name] = target
+	return nil
+}
+
+// History 返回已执行的扩缩容事件
+func (as *AutoScaler) History() []ScalingEvent {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	events := make([]ScalingEvent, len(as.history))
+	for i, event := range as.history {
+		events[i] = *event
+	}
+	return events
+}
+
+// Statistics 返回扩缩容统计
+func (as *AutoScaler) Statistics() AutoScalerStatistics {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return as.statistics
+}
+
+// Evaluate 对目标执行一次目标跟踪：期望副本数 = ceil(当前副本数 × 使用率 / 目标使用率)，
+// 限制在上下限之内。需要调整且不在冷却期内时调用编排器并返回扩缩容事件，否则返回nil
+func (as *AutoScaler) Evaluate(name string) (*ScalingEvent, error) {
+	return as.evaluate(name, time.Now())
+}
+
+// EvaluateAll 按名称顺序评估所有目标，返回执行的扩缩容事件和遇到的错误
+func (as *AutoScaler) EvaluateAll() ([]ScalingEvent, error) {
+	as.mutex.RLock()
+	names := make([]string, 0, len(as.targets))
+	for name := range as.targets {
+		names = append(names, name)
+	}
+	as.mutex.RUnlock()
+	sort.Strings(names)
+
+	var events []ScalingEvent
+	var errs []error
+	now := time.Now()
+	for _, name := range names {
+		event, err := as.evaluate(name, now)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if event != nil {
+			events = append(events, *event)
+		}
+	}
+	return events, errors.Join(errs...)
+}
+
+// Run 每隔interval评估一次所有目标，直到ctx取消
+func (as *AutoScaler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			as.EvaluateAll()
+		}
+	}
+}
+
+func (as *AutoScaler) evaluate(name string, now time.Time) (*ScalingEvent, error) {
+	as.mutex.RLock()
+	target, exists := as.targets[name]
+	config, source, scaler := as.config, as.metricSource, as.replicaScaler
+	as.mutex.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("scaling target %s not found", name)
+	}
+	if !config.Enabled {
+		return nil, nil
+	}
+	if source == nil || scaler == nil {
+		return nil, fmt.Errorf("autoscaler requires a metric source and a replica scaler")
+	}
+
+	utilization, err := source.CPUPercent(name)
+	if err != nil {
+		return nil, fmt.Errorf("read CPU utilization for %s: %w", name, err)
+	}
+
+	as.mutex.Lock()
+	as.statistics.Evaluations++
+	current := target.CurrentReplicas
+	desired := current
+	if ratio := utilization / target.TargetCPU; math.Abs(ratio-1) > config.Tolerance {
+		desired = int(math.Ceil(float64(current) * ratio))
+	}
+	desired = min(max(desired, target.MinReplicas), target.MaxReplicas)
+	target.DesiredReplicas = desired
+	if desired == current {
+		as.mutex.Unlock()
+		return nil, nil
+	}
+
+	cooldown := config.ScaleDownCooldown
+	if desired > current {
+		cooldown = config.ScaleUpCooldown
+	}
+	if last, scaled := as.lastScaled[name]; scaled && now.Sub(last) < cooldown {
+		as.statistics.Suppressed++
+		as.mutex.Unlock()
+		return nil, nil
+	}
+	as.mutex.Unlock()
+
+	if err := scaler.ScaleDeployment(name, int32(desired)); err != nil {
+		return nil, fmt.Errorf("scale %s to %d replicas: %w", name, desired, err)
+	}
+
+	event := &ScalingEvent{
+		Target:       name,
+		FromReplicas: current,
+		ToReplicas:   desired,
+		Utilization:  utilization,
+		Reason:       fmt.Sprintf("CPU %.1f%% vs target %.1f%%", utilization, target.TargetCPU),
+		Timestamp:    now,
+	}
+	as.mutex.Lock()
+	target.CurrentReplicas = desired
+	as.lastScaled[name] = now
+	if desired > current {
+		as.statistics.ScaleUps++
+	} else {
+		as.statistics.ScaleDowns++
+	}
+	as.history = append(as.history, event)
+	listeners := append([]ScalingEventListener(nil), as.listeners...)
+	as.mutex.Unlock()
+
+	for _, listener := range listeners {
+		listener.OnScale(*event)
+	}
+	return event, nil
+}
+
+// ============================================================================
+// 消息代理发布订阅实现
+// ============================================================================
+
+var (
+	ErrBrokerClosed   = errors.New("message broker is closed")
+	ErrInvalidTopic   = errors.New("invalid topic")
+	ErrSubscriberFull = errors.New("subscriber buffer is full")
+)
+
+// Message 发布订阅消息。消费者处理完成后调用Ack确认；
+// 超过AckTimeout仍未确认的消息会重新投递，直到投递次数达到MaxDeliveries后进入死信
+type Message struct {
+	ID        string
+	Topic     string
+	Payload   []byte
+	Headers   map[string]string
+	Timestamp time.Time
+	Attempt   int // 第几次投递，从1开始
+
+	ack func()
+}
+
+// Ack 确认消息已处理，重复调用无副作用
+func (m Message) Ack() {
+	if m.ack != nil {
+		m.ack()
+	}
+}
+
+// BrokerConfig 发布订阅配置。PublishTimeout为订阅者缓冲已满时发布的最长等待时间，为0时一直等待
+type BrokerConfig struct {
+	SubscriberBuffer int
+	PublishTimeout   time.Duration
+	AckTimeout       time.Duration
+	MaxDeliveries    int
+}
+
+// BrokerStatistics 发布订阅统计
+type BrokerStatistics struct {
+	Published     int64
+	Delivered     int64
+	Redelivered   int64
+	Acked         int64
+	DeadLettered  int64
+	Backpressured int64 // 因订阅者缓冲已满而投递失败的次数
+}
+
+// DefaultBrokerConfig 返回默认配置：每个订阅者缓冲64条，发布最多等待100ms，30秒未确认重投，最多投递5次
+func DefaultBrokerConfig() BrokerConfig {
+	return BrokerConfig{
+		SubscriberBuffer: 64,
+		PublishTimeout:   100 * time.Millisecond,
+		AckTimeout:       30 * time.Second,
+		MaxDeliveries:    5,
+	}
+}
+
+// subscriber 一个订阅者。发送方持有sendMu读锁向ch发送；
+// 关闭时先关闭done让阻塞的发送方退出，再取写锁关闭ch，避免向已关闭的通道发送
+type subscriber struct {
+	id        string
+	pattern   string
+	ch        chan Message
+	done      chan struct{}
+	sendMu    sync.RWMutex
+	closeOnce sync.Once
+	unacked   map[string]*pendingDelivery // 由MessageBroker.mutex保护
+}
+
+// pendingDelivery 已投递但尚未确认的消息
+type pendingDelivery struct {
+	message  Message
+	deadline time.Time
+}
+
+func (s *subscriber) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.sendMu.Lock()
+		close(s.ch)
+		s.sendMu.Unlock()
+	})
+}
+
+// SetConfig 替换发布订阅配置，缓冲大小只对之后的订阅生效
+func (mb *MessageBroker) SetConfig(config BrokerConfig) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+	mb.config = config
+}
+
+// Statistics 返回发布订阅统计快照
+func (mb *MessageBroker) Statistics() BrokerStatistics {
+	mb.mutex.RLock()
+	defer mb.mutex.RUnlock()
+	return mb.statistics
+}
+
+// DeadLetters 返回超过最大投递次数仍未确认的消息
+func (mb *MessageBroker) DeadLetters() []Message {
+	mb.mutex.RLock()
+	defer mb.mutex.RUnlock()
+	return append([]Message(nil), mb.deadLetters...)
+}
+
+// Publish 把消息投递给所有匹配topic的订阅者。订阅者缓冲已满时最多等待PublishTimeout，
+// 超时的订阅者返回ErrSubscriberFull，其余订阅者照常投递
+func (mb *MessageBroker) Publish(topic string, msg Message) error {
+	if !validTopic(topic, false) {
+		return fmt.Errorf("%w: %q", ErrInvalidTopic, topic)
+	}
+
+	mb.mutex.Lock()
+	if mb.closed {
+		mb.mutex.Unlock()
+		return ErrBrokerClosed
+	}
+	mb.nextMessageID++
+	if msg.ID == "" {
+		msg.ID = fmt.Sprintf("msg-%d", mb.nextMessageID)
+	}
+	msg.Topic = topic
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	msg.Attempt = 0
+
+	var targets []*subscriber
+	for _, sub := range mb.subscribers {
+		if topicMatches(sub.pattern, topic) {
+			targets = append(targets, sub)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].id < targets[j].id })
+	mb.statistics.Published++
+	wait := mb.config.PublishTimeout
+	mb.mutex.Unlock()
+
+	var errs []error
+	for _, sub := range targets {
+		if err := mb.deliver(sub, msg, nil, wait, time.Now()); err != nil {
+			errs = append(errs, fmt.Errorf("subscriber %s: %w", sub.id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribe 订阅topic，topic按"."分段，"*"匹配恰好一段（如"orders.*"匹配"orders.created"）。
+// 返回的通道在取消订阅或代理关闭后被关闭；topic非法或代理已关闭时返回已关闭的通道
+func (mb *MessageBroker) Subscribe(topic string) (<-chan Message, func()) {
+	mb.mutex.Lock()
+	if mb.closed || !validTopic(topic, true) {
+		mb.mutex.Unlock()
+		ch := make(chan Message)
+		close(ch)
+		return ch, func() {}
+	}
+
+	mb.nextSubscriberID++
+	id := fmt.Sprintf("sub-%d", mb.nextSubscriberID)
+	buffer := mb.config.SubscriberBuffer
+	if buffer < 0 {
+		buffer = 0
+	}
+	sub := &subscriber{
+		id:      id,
+		pattern: topic,
+		ch:      make(chan Message, buffer),
+		done:    make(chan struct{}),
+		unacked: make(map[string]*pendingDelivery),
+	}
+	mb.subscribers[id] = sub
+	mb.subscriptions[id] = &Subscription{ID: id, TopicName: topic}
+	mb.startRedeliveryLocked()
+	mb.mutex.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() { mb.unsubscribe(id) })
+	}
+}
+
+// Close 停止接受新消息，等待已投递的消息全部确认或ctx结束，然后停止重投并关闭所有订阅通道。
+// 通道关闭后消费者仍可读出缓冲中剩余的消息
+func (mb *MessageBroker) Close(ctx context.Context) error {
+	mb.mutex.Lock()
+	if mb.closed {
+		mb.mutex.Unlock()
+		return nil
+	}
+	mb.closed = true
+	mb.mutex.Unlock()
+
+	err := mb.drain(ctx)
+
+	mb.mutex.Lock()
+	stop := mb.redeliverStop
+	mb.redeliverStop = nil
+	subs := make([]*subscriber, 0, len(mb.subscribers))
+	for id, sub := range mb.subscribers {
+		subs = append(subs, sub)
+		delete(mb.subscribers, id)
+		delete(mb.subscriptions, id)
+	}
+	mb.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	mb.redeliverWG.Wait()
+	for _, sub := range subs {
+		sub.close()
+	}
+	return err
+}
+
+// drain 轮询直到没有未确认的消息
+func (mb *MessageBroker) drain(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if mb.unackedCount() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("drain broker: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (mb *MessageBroker) unackedCount() int {
+	mb.mutex.RLock()
+	defer mb.mutex.RUnlock()
+	count := 0
+	for _, sub := range mb.subscribers {
+		count += len(sub.unacked)
+	}
+	return count
+}
+
+func (mb *MessageBroker) unsubscribe(id string) {
+	mb.mutex.Lock()
+	sub, ok := mb.subscribers[id]
+	delete(mb.subscribers, id)
+	delete(mb.subscriptions, id)
+	mb.mutex.Unlock()
+
+	if ok {
+		sub.close()
+	}
+}
+
+// deliver 向订阅者投递一次消息。投递前先登记为未确认，避免消费者先于登记确认；
+// previous为重投前的登记，若它已被确认或替换则放弃本次投递。
+// wait<0时不等待，为0时一直等待到缓冲有空位
+func (mb *MessageBroker) deliver(sub *subscriber, msg Message, previous *pendingDelivery, wait time.Duration, now time.Time) error {
+	mb.mutex.Lock()
+	if sub.unacked[msg.ID] != previous {
+		mb.mutex.Unlock()
+		return nil
+	}
+	msg.Attempt++
+	id := msg.ID
+	msg.ack = func() { mb.ack(sub, id) }
+	current := &pendingDelivery{message: msg, deadline: now.Add(mb.config.AckTimeout)}
+	sub.unacked[id] = current
+	mb.mutex.Unlock()
+
+	sub.sendMu.RLock()
+	defer sub.sendMu.RUnlock()
+
+	select {
+	case <-sub.done:
+		return nil
+	default:
+	}
+
+	sent := false
+	select {
+	case sub.ch <- msg:
+		sent = true
+	default:
+	}
+	if !sent && wait >= 0 {
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case sub.ch <- msg:
+			sent = true
+		case <-sub.done:
+			return nil
+		case <-timeout:
+		}
+	}
+
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+	if sent {
+		mb.statistics.Delivered++
+		if msg.Attempt > 1 {
+			mb.statistics.Redelivered++
+		}
+		return nil
+	}
+	if sub.unacked[id] == current {
+		if previous == nil {
+			delete(sub.unacked, id)
+		} else {
+			sub.unacked[id] = previous
+		}
+	}
+	mb.statistics.Backpressured++
+	return ErrSubscriberFull
+}
+
+func (mb *MessageBroker) ack(sub *subscriber, id string) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+	if _, ok := sub.unacked[id]; ok {
+		delete(sub.unacked, id)
+		mb.statistics.Acked++
+	}
+}
+
+// startRedeliveryLocked 在第一次订阅时启动重投协程，每隔AckTimeout的一半检查一次
+func (mb *MessageBroker) startRedeliveryLocked() {
+	if mb.redeliverStop != nil {
+		return
+	}
+	interval := mb.config.AckTimeout / 2
+	if interval <= 0 {
+		interval = time.Second
+	}
+	stop := make(chan struct{})
+	mb.redeliverStop = stop
+
+	mb.redeliverWG.Add(1)
+	go func() {
+		defer mb.redeliverWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				mb.redeliverExpired(now)
+			}
+		}
+	}()
+}
+
+// redeliverExpired 重投确认超时的消息，已达到最大投递次数的移入死信；
+// 缓冲已满的订阅者不等待，留到下一轮再投，返回本轮重投成功的消息数
+func (mb *MessageBroker) redeliverExpired(now time.Time) int {
+	type redelivery struct {
+		sub     *subscriber
+		pending *pendingDelivery
+	}
+
+	mb.mutex.Lock()
+	var due []redelivery
+	for _, sub := range mb.subscribers {
+		for id, pending := range sub.unacked {
+			if now.Before(pending.deadline) {
+				continue
+			}
+			if mb.config.MaxDeliveries > 0 && pending.message.Attempt >= mb.config.MaxDeliveries {
+				delete(sub.unacked, id)
+				dead := pending.message
+				dead.ack = nil
+				mb.deadLetters = append(mb.deadLetters, dead)
+				mb.statistics.DeadLettered++
+				continue
+			}
+			due = append(due, redelivery{sub: sub, pending: pending})
+		}
+	}
+	mb.mutex.Unlock()
+
+	redelivered := 0
+	for _, r := range due {
+		if err := mb.deliver(r.sub, r.pending.message, r.pending, -1, now); err == nil {
+			redelivered++
+		}
+	}
+	return redelivered
+}
+
+// validTopic topic按"."分段且不能有空段；allowWildcard时整段为"*"的通配段合法
+func validTopic(topic string, allowWildcard bool) bool {
+	if topic == "" {
+		return false
+	}
+	for _, segment := range strings.Split(topic, ".") {
+		if segment == "" {
+			return false
+		}
+		if strings.Contains(segment, "*") && (!allowWildcard || segment != "*") {
+			return false
+		}
+	}
+	return true
+}
+
+// topicMatches 判断topic是否匹配订阅模式，"*"匹配恰好一段
+func topicMatches(pattern, topic string) bool {
+	patternSegments := strings.Split(pattern, ".")
+	topicSegments := strings.Split(topic, ".")
+	if len(patternSegments) != len(topicSegments) {
+		return false
+	}
+	for i, segment := range patternSegments {
+		if segment != "*" && segment != topicSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ============================================================================
+// 请求验证实现
+// ============================================================================
+
+// ValidationError 一个未通过验证的字段
+type ValidationError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// validationFailure 验证失败时返回给客户端的400响应体
+type validationFailure struct {
+	Error  string            `json:"error"`
+	Fields []ValidationError `json:"fields"`
+}
+
+// NewRequestValidator 创建请求验证器并预编译规则中的正则表达式，字段或正则非法时返回错误
+func NewRequestValidator(rules ...ValidationRule) (*RequestValidator, error) {
+	validator := &RequestValidator{
+		Rules:    rules,
+		patterns: make([]*regexp.Regexp, len(rules)),
+	}
+	for i, rule := range rules {
+		if _, name := splitValidationField(rule.Field); name == "" {
+			return nil, fmt.Errorf("validation rule %q: empty field", rule.ID)
+		}
+		if rule.Type == ValidateTypeRegex && rule.Pattern == "" {
+			return nil, fmt.Errorf("validation rule %q: regex type needs a pattern", rule.ID)
+		}
+		if rule.Pattern == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("validation rule %q: %w", rule.ID, err)
+		}
+		validator.patterns[i] = pattern
+	}
+	return validator, nil
+}
+
+// Process 实现GatewayMiddleware，有字段未通过验证时返回400并列出所有失败字段，不再转发
+func (rv *RequestValidator) Process(request *Request, response *Response, next func()) {
+	failures := rv.Validate(request)
+	if len(failures) == 0 {
+		next()
+		return
+	}
+
+	body, _ := json.Marshal(validationFailure{Error: "request validation failed", Fields: failures})
+	response.StatusCode = http.StatusBadRequest
+	response.Headers = map[string]string{"Content-Type": "application/json"}
+	response.Body = body
+}
+
+// Priority 验证先于其他中间件执行
+func (rv *RequestValidator) Priority() int { return 1000 }
+
+func (rv *RequestValidator) Name() string { return "request-validator" }
+
+// Validate 按顺序检查所有规则，返回全部失败字段，通过时返回nil
+func (rv *RequestValidator) Validate(request *Request) []ValidationError {
+	var failures []ValidationError
+	var query url.Values
+	var body interface{}
+	bodyParsed := false
+
+	for i, rule := range rv.Rules {
+		source, name := splitValidationField(rule.Field)
+
+		var value interface{}
+		present := false
+		switch source {
+		case "header":
+			value, present = lookupHeader(request.Headers, name)
+		case "query":
+			if query == nil {
+				_, rawQuery, _ := strings.Cut(request.URL, "?")
+				query, _ = url.ParseQuery(rawQuery)
+			}
+			if values, ok := query[name]; ok && len(values) > 0 {
+				value, present = values[0], true
+			}
+		default:
+			if !bodyParsed {
+				bodyParsed = true
+				if len(bytes.TrimSpace(request.Body)) > 0 {
+					if err := json.Unmarshal(request.Body, &body); err != nil {
+						failures = append(failures, ValidationError{Field: "body", Message: "request body is not valid JSON"})
+					}
+				}
+			}
+			value, present = lookupJSONPath(body, name)
+		}
+
+		if !present {
+			if rule.Required {
+				failures = append(failures, ValidationError{Field: rule.Field, Rule: rule.ID, Message: "field is required"})
+			}
+			continue
+		}
+		if message := checkValidationType(rule, value, source != "body", rv.pattern(i)); message != "" {
+			failures = append(failures, ValidationError{Field: rule.Field, Rule: rule.ID, Message: message})
+			continue
+		}
+		if rule.Validator != nil {
+			if err := rule.Validator(value); err != nil {
+				failures = append(failures, ValidationError{Field: rule.Field, Rule: rule.ID, Message: err.Error()})
+			}
+		}
+	}
+	return failures
+}
+
+func (rv *RequestValidator) pattern(index int) *regexp.Regexp {
+	if index < len(rv.patterns) {
+		return rv.patterns[index]
+	}
+	return nil
+}
+
+// splitValidationField 拆分字段来源和名称，没有可识别前缀时来源为body
+func splitValidationField(field string) (string, string) {
+	if source, name, ok := strings.Cut(field, ":"); ok && (source == "header" || source == "query" || source == "body") {
+		return source, name
+	}
+	return "body", field
+}
+
+// lookupHeader 按名称不区分大小写地查找请求头
+func lookupHeader(headers map[string]string, name string) (string, bool) {
+	if value, ok := headers[http.CanonicalHeaderKey(name)]; ok {
+		return value, true
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// lookupJSONPath 按"."分隔的路径在解码后的JSON对象中查找字段，null视为不存在
+func lookupJSONPath(document interface{}, path string) (interface{}, bool) {
+	current := document
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, current != nil
+}
+
+// checkValidationType 检查字段类型和正则。请求头和查询参数（textual）只有文本，
+// 数字和布尔类型按文本能否解析判断；请求体字段要求JSON值本身的类型一致。通过时返回空字符串
+func checkValidationType(rule ValidationRule, value interface{}, textual bool, pattern *regexp.Regexp) string {
+	text, isString := value.(string)
+	switch rule.Type {
+	case ValidateTypeString, ValidateTypeRegex:
+		if !isString {
+			return "must be a string"
+		}
+	case ValidateTypeNumber:
+		_, isNumber := value.(float64)
+		if textual {
+			_, err := strconv.ParseFloat(text, 64)
+			isNumber = err == nil
+		}
+		if !isNumber {
+			return "must be a number"
+		}
+	case ValidateTypeBoolean:
+		_, isBool := value.(bool)
+		if textual {
+			_, err := strconv.ParseBool(text)
+			isBool = err == nil
+		}
+		if !isBool {
+			return "must be a boolean"
+		}
+	}
+
+	if pattern != nil {
+		if !isString {
+			text = fmt.Sprint(value)
+		}
+		if !pattern.MatchString(text) {
+			return fmt.Sprintf("must match pattern %s", pattern)
+		}
+	}
+	return ""
+}
+
+// ============================================================================
+// 请求响应转换实现
+// ============================================================================
+
+// TransformError 转换规则执行失败，失败时请求或响应保持原样
+type TransformError struct {
+	RuleID string
+	Err    error
+}
+
+func (e *TransformError) Error() string {
+	return fmt.Sprintf("transform rule %q: %v", e.RuleID, e.Err)
+}
+
+func (e *TransformError) Unwrap() error { return e.Err }
+
+// NewRequestTransformer 创建转换器并校验每条规则的配置
+func NewRequestTransformer(rules ...TransformationRule) (*RequestTransformer, error) {
+	for _, rule := range rules {
+		if err := validateTransformationRule(rule); err != nil {
+			return nil, &TransformError{RuleID: rule.ID, Err: err}
+		}
+	}
+	return &RequestTransformer{Rules: rules}, nil
+}
+
+func validateTransformationRule(rule TransformationRule) error {
+	if rule.Response && rule.Type != TransformTypeHeader && rule.Type != TransformTypeBody {
+		return errors.New("response rules only support headers and body")
+	}
+	switch rule.Type {
+	case TransformTypeHeader, TransformTypeQuery:
+		switch {
+		case rule.Action == TransformActionSet && rule.Target == "":
+			return errors.New("set needs a target")
+		case rule.Action == TransformActionRemove && rule.Source == "":
+			return errors.New("remove needs a source")
+		case rule.Action == TransformActionRename && (rule.Source == "" || rule.Target == ""):
+			return errors.New("rename needs a source and a target")
+		}
+	case TransformTypePath:
+		if !strings.HasPrefix(rule.Source, "/") || !strings.HasPrefix(rule.Target, "/") {
+			return errors.New("path rules need a source and a target starting with /")
+		}
+	case TransformTypeBody:
+		switch {
+		case rule.Action == TransformActionSet && rule.Transform == nil:
+			return errors.New("body set needs a transform")
+		case rule.Action == TransformActionRemove && rule.Source == "":
+			return errors.New("remove needs a source")
+		case rule.Action == TransformActionRename && (rule.Source == "" || rule.Target == ""):
+			return errors.New("rename needs a source and a target")
+		}
+	default:
+		return fmt.Errorf("unknown transformation type %d", rule.Type)
+	}
+	return nil
+}
+
+// Process 实现GatewayMiddleware：转发前应用请求规则，失败时返回400；
+// 上游响应后应用响应规则，失败时返回502
+func (rt *RequestTransformer) Process(request *Request, response *Response, next func()) {
+	if err := rt.TransformRequest(request); err != nil {
+		*response = transformFailureResponse(http.StatusBadRequest, err)
+		return
+	}
+	next()
+	if response.StatusCode == 0 {
+		return
+	}
+	if err := rt.TransformResponse(response); err != nil {
+		*response = transformFailureResponse(http.StatusBadGateway, err)
+	}
+}
+
+// Priority 转换在验证之后、其他中间件之前执行
+func (rt *RequestTransformer) Priority() int { return 900 }
+
+func (rt *RequestTransformer) Name() string { return "request-transformer" }
+
+func transformFailureResponse(status int, err error) Response {
+	body, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return Response{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       body,
+	}
+}
+
+// transformState 转换过程中的工作副本，全部规则成功后才写回
+type transformState struct {
+	headers  map[string]string
+	path     string
+	query    url.Values
+	body     []byte
+	document interface{}
+	decoded  bool
+	params   map[string]string
+}
+
+// TransformRequest 按顺序应用请求规则，任一规则失败时返回*TransformError且请求不变
+func (rt *RequestTransformer) TransformRequest(request *Request) error {
+	path, rawQuery, _ := strings.Cut(request.URL, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return &TransformError{Err: fmt.Errorf("parse query: %w", err)}
+	}
+	state := &transformState{
+		headers: cloneHeaders(request.Headers),
+		path:    path,
+		query:   query,
+		body:    request.Body,
+		params:  request.Params,
+	}
+	if err := rt.apply(state, false); err != nil {
+		return err
+	}
+
+	request.Headers = state.headers
+	request.URL = state.path
+	if encoded := state.query.Encode(); encoded != "" {
+		request.URL += "?" + encoded
+	}
+	request.Body = state.body
+	return nil
+}
+
+// TransformResponse 按顺序应用响应规则，任一规则失败时返回*TransformError且响应不变
+func (rt *RequestTransformer) TransformResponse(response *Response) error {
+	state := &transformState{headers: cloneHeaders(response.Headers), body: response.Body}
+	if err := rt.apply(state, true); err != nil {
+		return err
+	}
+	response.Headers = state.headers
+	response.Body = state.body
+	return nil
+}
+
+func (rt *RequestTransformer) apply(state *transformState, responseSide bool) error {
+	for _, rule := range rt.Rules {
+		if rule.Response != responseSide {
+			continue
+		}
+		var err error
+		switch rule.Type {
+		case TransformTypeHeader:
+			transformHeader(state.headers, rule)
+		case TransformTypeQuery:
+			transformQuery(state.query, rule)
+		case TransformTypePath:
+			state.path = remapPath(state.path, rule, state.params)
+		case TransformTypeBody:
+			err = state.transformBody(rule)
+		}
+		if err != nil {
+			return &TransformError{RuleID: rule.ID, Err: err}
+		}
+	}
+	if state.decoded {
+		body, err := json.Marshal(state.document)
+		if err != nil {
+			return &TransformError{Err: fmt.Errorf("encode body: %w", err)}
+		}
+		state.body = body
+	}
+	return nil
+}
+
+func cloneHeaders(headers map[string]string) map[string]string {
+	cloned := make(map[string]string, len(headers))
+	for key, value := range headers {
+		cloned[key] = value
+	}
+	return cloned
+}
+
+func transformHeader(headers map[string]string, rule TransformationRule) {
+	switch rule.Action {
+	case TransformActionSet:
+		deleteHeader(headers, rule.Target)
+		headers[http.CanonicalHeaderKey(rule.Target)] = rule.Value
+	case TransformActionRemove:
+		deleteHeader(headers, rule.Source)
+	case TransformActionRename:
+		if value, ok := lookupHeader(headers, rule.Source); ok {
+			deleteHeader(headers, rule.Source)
+			deleteHeader(headers, rule.Target)
+			headers[http.CanonicalHeaderKey(rule.Target)] = value
+		}
+	}
+}
+
+// deleteHeader 不区分大小写地删除请求头
+func deleteHeader(headers map[string]string, name string) {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			delete(headers, key)
+		}
+	}
+}
+
+func transformQuery(query url.Values, rule TransformationRule) {
+	switch rule.Action {
+	case TransformActionSet:
+		query.Set(rule.Target, rule.Value)
+	case TransformActionRemove:
+		query.Del(rule.Source)
+	case TransformActionRename:
+		if values, ok := query[rule.Source]; ok {
+			query.Del(rule.Source)
+			query[rule.Target] = values
+		}
+	}
+}
+
+// remapPath 把按段匹配Source前缀的路径替换为Target，Target中的:param取自路由匹配的路径参数
+func remapPath(path string, rule TransformationRule, params map[string]string) string {
+	prefix := splitPath(rule.Source)
+	segments := splitPath(path)
+	if len(segments) < len(prefix) {
+		return path
+	}
+	for i, segment := range prefix {
+		if segment != segments[i] {
+			return path
+		}
+	}
+
+	target := splitPath(rule.Target)
+	for i, segment := range target {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			if value, found := params[name]; found {
+				target[i] = value
+			}
+		}
+	}
+	return "/" + strings.Join(append(target, segments[len(prefix):]...), "/")
+}
+
+// transformBody 对JSON请求体应用一条规则，Source为空时Transform作用于整个请求体
+func (state *transformState) transformBody(rule TransformationRule) error {
+	if !state.decoded {
+		if len(bytes.TrimSpace(state.body)) > 0 {
+			if err := json.Unmarshal(state.body, &state.document); err != nil {
+				return fmt.Errorf("body is not valid JSON: %w", err)
+			}
+		}
+		state.decoded = true
+	}
+
+	switch rule.Action {
+	case TransformActionRemove:
+		return deleteJSONPath(state.document, rule.Source)
+	case TransformActionRename:
+		value, ok := lookupJSONPath(state.document, rule.Source)
+		if !ok {
+			return nil
+		}
+		if rule.Transform != nil {
+			var err error
+			if value, err = invokeTransform(rule.Transform, value); err != nil {
+				return err
+			}
+		}
+		if err := deleteJSONPath(state.document, rule.Source); err != nil {
+			return err
+		}
+		return setJSONPath(&state.document, rule.Target, value)
+	default:
+		var value interface{}
+		if rule.Source == "" {
+			value = state.document
+		} else {
+			value, _ = lookupJSONPath(state.document, rule.Source)
+		}
+		value, err := invokeTransform(rule.Transform, value)
+		if err != nil {
+			return err
+		}
+		target := rule.Target
+		if target == "" {
+			target = rule.Source
+		}
+		return setJSONPath(&state.document, target, value)
+	}
+}
+
+// invokeTransform 调用转换钩子，钩子返回error值或panic都视为失败
+func invokeTransform(transform func(interface{}) interface{}, value interface{}) (result interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("transform panicked: %v", recovered)
+		}
+	}()
+	result = transform(value)
+	if failure, ok := result.(error); ok {
+		return nil, failure
+	}
+	return result, nil
+}
+
+// setJSONPath 设置字段值并按需创建中间对象，path为空时替换整个文档
+func setJSONPath(document *interface{}, path string, value interface{}) error {
+	if path == "" {
+		*document = value
+		return nil
+	}
+	if *document == nil {
+		*document = make(map[string]interface{})
+	}
+	keys := strings.Split(path, ".")
+	current, ok := (*document).(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("body is not a JSON object")
+	}
+	for _, key := range keys[:len(keys)-1] {
+		next, exists := current[key]
+		if !exists || next == nil {
+			next = make(map[string]interface{})
+			current[key] = next
+		}
+		object, isObject := next.(map[string]interface{})
+		if !isObject {
+			return fmt.Errorf("field %q is not a JSON object", key)
+		}
+		current = object
+	}
+	current[keys[len(keys)-1]] = value
+	return nil
+}
+
+// deleteJSONPath 删除字段，字段不存在时无副作用
+func deleteJSONPath(document interface{}, path string) error {
+	keys := strings.Split(path, ".")
+	parent, ok := lookupJSONPath(document, strings.Join(keys[:len(keys)-1], "."))
+	if len(keys) == 1 {
+		parent, ok = document, document != nil
+	}
+	if !ok {
+		return nil
+	}
+	object, isObject := parent.(map[string]interface{})
+	if !isObject {
+		return fmt.Errorf("field %q is not in a JSON object", path)
+	}
+	delete(object, keys[len(keys)-1])
+	return nil
+}
+
+// ============================================================================
+// JWT认证实现
+// ============================================================================
+
+var (
+	ErrMissingCredentials = errors.New("missing bearer token")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrTokenExpired       = errors.New("token expired")
+)
+
+// jwtHeader JWT头部
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+// NewAuthenticationHandler 创建网关认证处理器。启用JWT认证时必须配置HS256密钥或RS256公钥
+func NewAuthenticationHandler(config AuthenticationConfig) (*AuthenticationHandler, error) {
+	handler := &AuthenticationHandler{Config: config}
+	if handler.jwtEnabled() && len(config.JWTSecret) == 0 && config.JWTPublicKey == nil {
+		return nil, errors.New("JWT authentication needs a secret or a public key")
+	}
+	return handler, nil
+}
+
+func (ah *AuthenticationHandler) jwtEnabled() bool {
+	for _, method := range ah.Config.Methods {
+		if method == AuthMethodJWT {
+			return true
+		}
+	}
+	return false
+}
+
+// Process 实现GatewayMiddleware，认证失败时返回401并带WWW-Authenticate头，认证成功后把主体写入请求
+func (ah *AuthenticationHandler) Process(request *Request, response *Response, next func()) {
+	principal, err := ah.Authenticate(request)
+	if err != nil {
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		*response = Response{
+			StatusCode: http.StatusUnauthorized,
+			Headers: map[string]string{
+				"Content-Type":     "application/json",
+				"Www-Authenticate": `Bearer error="invalid_token"`,
+			},
+			Body: body,
+		}
+		return
+	}
+	request.Principal = principal
+	next()
+}
+
+// Priority 认证最先执行
+func (ah *AuthenticationHandler) Priority() int { return 1100 }
+
+func (ah *AuthenticationHandler) Name() string { return "authentication" }
+
+// Authenticate 校验请求的Authorization: Bearer令牌，失败时返回ErrorTypeAuthentication类型的*ProxyError。
+// 未启用认证或未启用JWT方法时返回nil主体
+func (ah *AuthenticationHandler) Authenticate(request *Request) (*Principal, error) {
+	return ah.authenticate(request, time.Now())
+}
+
+func (ah *AuthenticationHandler) authenticate(request *Request, now time.Time) (*Principal, error) {
+	if !ah.Config.Enabled || !ah.jwtEnabled() {
+		return nil, nil
+	}
+
+	authorization, _ := lookupHeader(request.Headers, "Authorization")
+	scheme, raw, found := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(raw) == "" {
+		return nil, &ProxyError{Type: ErrorTypeAuthentication, Err: ErrMissingCredentials}
+	}
+
+	token, err := ah.verifyJWT(strings.TrimSpace(raw), now)
+	if err != nil {
+		return nil, &ProxyError{Type: ErrorTypeAuthentication, Err: err}
+	}
+	return principalFromClaims(token.Claims), nil
+}
+
+// verifyJWT 校验签名后再检查exp、nbf、iss和aud。签名算法由配置的密钥决定，
+// 令牌头部声明的算法必须与之一致，以防alg为none或HS256/RS256混淆
+func (ah *AuthenticationHandler) verifyJWT(raw string, now time.Time) (*Token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature encoding: %v", ErrInvalidToken, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	config := ah.Config
+	switch {
+	case header.Algorithm == "HS256" && len(config.JWTSecret) > 0:
+		mac := hmac.New(sha256.New, config.JWTSecret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	case header.Algorithm == "RS256" && config.JWTPublicKey != nil:
+		if err := rsa.VerifyPKCS1v15(config.JWTPublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Algorithm)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+
+	token := &Token{Value: raw, Type: "Bearer", Claims: claims}
+	if exp, ok := claims["exp"]; ok {
+		seconds, isNumber := exp.(float64)
+		if !isNumber {
+			return nil, fmt.Errorf("%w: exp is not a number", ErrInvalidToken)
+		}
+		token.ExpiresAt = time.Unix(int64(seconds), 0)
+		if !now.Before(token.ExpiresAt.Add(config.ClockSkew)) {
+			return nil, ErrTokenExpired
+		}
+	}
+	if nbf, ok := claims["nbf"]; ok {
+		seconds, isNumber := nbf.(float64)
+		if !isNumber {
+			return nil, fmt.Errorf("%w: nbf is not a number", ErrInvalidToken)
+		}
+		if now.Add(config.ClockSkew).Before(time.Unix(int64(seconds), 0)) {
+			return nil, fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+		}
+	}
+	if config.JWTIssuer != "" && claims["iss"] != config.JWTIssuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %v", ErrInvalidToken, claims["iss"])
+	}
+	if config.JWTAudience != "" && !audienceContains(claims["aud"], config.JWTAudience) {
+		return nil, fmt.Errorf("%w: audience does not include %s", ErrInvalidToken, config.JWTAudience)
+	}
+	return token, nil
+}
+
+func decodeJWTSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// audienceContains aud可以是字符串或字符串数组
+func audienceContains(aud interface{}, audience string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, item := range value {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// principalFromClaims 以sub为主体ID，name为名称（缺省为sub），roles为角色列表，全部声明放入Attrs
+func principalFromClaims(claims map[string]interface{}) *Principal {
+	principal := &Principal{Attrs: claims}
+	principal.ID, _ = claims["sub"].(string)
+	principal.Name, _ = claims["name"].(string)
+	if principal.Name == "" {
+		principal.Name = principal.ID
+	}
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if name, isString := role.(string); isString {
+				principal.Roles = append(principal.Roles, name)
+			}
+		}
+	}
+	return principal
+}
+
+// ============================================================================
+// RBAC授权实现
+// ============================================================================
+
+var ErrAccessDenied = errors.New("access denied")
+
+// compiledAuthorizationRule 预先解析路径模式和条件的授权规则
+type compiledAuthorizationRule struct {
+	rule      AuthorizationRule
+	resource  *Route
+	condition *authorizationCondition
+}
+
+// authorizationCondition 形如left == right或left != right的条件
+type authorizationCondition struct {
+	left, right string
+	negate      bool
+}
+
+// AuthorizationDecision 一次授权判定的结果
+type AuthorizationDecision struct {
+	Allowed bool
+	RuleID  string // 做出决定的规则，使用默认决定时为空
+}
+
+// NewAuthorizationHandler 创建授权处理器，解析所有策略的资源模式和条件表达式，非法时返回错误
+func NewAuthorizationHandler(config AuthorizationConfig, policies ...AuthorizationPolicy) (*AuthorizationHandler, error) {
+	if config.Default != "" && config.Default != "allow" && config.Default != "deny" {
+		return nil, fmt.Errorf("authorization default must be allow or deny, got %q", config.Default)
+	}
+	handler := &AuthorizationHandler{Policies: policies, Config: config}
+	for _, policy := range policies {
+		for _, rule := range policy.Rules {
+			compiled, err := compileAuthorizationRule(rule)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s rule %s: %w", policy.ID, rule.ID, err)
+			}
+			handler.rules = append(handler.rules, compiled)
+		}
+	}
+	return handler, nil
+}
+
+func compileAuthorizationRule(rule AuthorizationRule) (compiledAuthorizationRule, error) {
+	compiled := compiledAuthorizationRule{rule: rule}
+	if rule.Effect != "" && rule.Effect != "allow" && rule.Effect != "deny" {
+		return compiled, fmt.Errorf("effect must be allow or deny, got %q", rule.Effect)
+	}
+	if rule.Resource != "" && rule.Resource != "*" {
+		segments, err := parsePathPattern(rule.Resource)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.resource = &Route{PathPattern: rule.Resource, segments: segments}
+	}
+	if rule.Principal != "" && rule.Principal != "*" {
+		kind, name, _ := strings.Cut(rule.Principal, ":")
+		if (kind != "role" && kind != "user") || name == "" {
+			return compiled, fmt.Errorf("principal must be role:<name>, user:<id> or *, got %q", rule.Principal)
+		}
+	}
+	if strings.TrimSpace(rule.Condition) != "" {
+		condition, err := parseAuthorizationCondition(rule.Condition)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.condition = condition
+	}
+	return compiled, nil
+}
+
+func parseAuthorizationCondition(expression string) (*authorizationCondition, error) {
+	for _, operator := range []string{"!=", "=="} {
+		left, right, found := strings.Cut(expression, operator)
+		if !found {
+			continue
+		}
+		condition := &authorizationCondition{
+			left:   strings.TrimSpace(left),
+			right:  strings.TrimSpace(right),
+			negate: operator == "!=",
+		}
+		if condition.left == "" || condition.right == "" {
+			break
+		}
+		return condition, nil
+	}
+	return nil, fmt.Errorf("condition %q must have the form left == right or left != right", expression)
+}
+
+// Process 实现GatewayMiddleware，拒绝时返回403
+func (az *AuthorizationHandler) Process(request *Request, response *Response, next func()) {
+	if err := az.Authorize(request); err != nil {
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		*response = Response{
+			StatusCode: http.StatusForbidden,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+			Body:       body,
+		}
+		return
+	}
+	next()
+}
+
+// Priority 授权在认证之后、请求验证之前执行
+func (az *AuthorizationHandler) Priority() int { return 1050 }
+
+func (az *AuthorizationHandler) Name() string { return "authorization" }
+
+// Authorize 判定请求是否允许访问，拒绝时返回ErrorTypeAuthorization类型的*ProxyError。未启用授权时总是允许
+func (az *AuthorizationHandler) Authorize(request *Request) error {
+	if !az.Config.Enabled {
+		return nil
+	}
+	decision := az.Decide(request)
+	if decision.Allowed {
+		return nil
+	}
+	err := ErrAccessDenied
+	if decision.RuleID != "" {
+		err = fmt.Errorf("%w by rule %s", ErrAccessDenied, decision.RuleID)
+	}
+	return &ProxyError{Type: ErrorTypeAuthorization, Err: err}
+}
+
+// Decide 按请求主体的角色匹配规则：任一拒绝规则匹配即拒绝，否则任一允许规则匹配即允许，
+// 都不匹配时采用配置的默认决定
+func (az *AuthorizationHandler) Decide(request *Request) AuthorizationDecision {
+	// 查询参数由客户端任意构造，不参与授权判定
+	path, _, _ := strings.Cut(request.URL, "?")
+	segments := splitPath(path)
+
+	var allowedBy string
+	for _, compiled := range az.rules {
+		if !compiled.matches(request, segments) {
+			continue
+		}
+		if compiled.rule.Effect == "deny" {
+			return AuthorizationDecision{Allowed: false, RuleID: compiled.rule.ID}
+		}
+		if allowedBy == "" {
+			allowedBy = compiled.rule.ID
+		}
+	}
+	if allowedBy != "" {
+		return AuthorizationDecision{Allowed: true, RuleID: allowedBy}
+	}
+	return AuthorizationDecision{Allowed: az.Config.Default == "allow"}
+}
+
+func (cr compiledAuthorizationRule) matches(request *Request, segments []string) bool {
+	rule := cr.rule
+	if rule.Action != "" && rule.Action != "*" && !strings.EqualFold(rule.Action, request.Method) {
+		return false
+	}
+
+	params := map[string]string{}
+	if cr.resource != nil {
+		matched, _, ok := cr.resource.matchPath(segments)
+		if !ok {
+			return false
+		}
+		params = matched
+	}
+
+	principal := request.Principal
+	if rule.Principal != "" && rule.Principal != "*" {
+		if principal == nil {
+			return false
+		}
+		kind, name, _ := strings.Cut(rule.Principal, ":")
+		switch kind {
+		case "user":
+			if principal.ID != name {
+				return false
+			}
+		case "role":
+			if !containsString(principal.Roles, name) {
+				return false
+			}
+		}
+	} else if rule.Principal == "*" && principal == nil {
+		return false
+	}
+
+	if cr.condition != nil {
+		return cr.condition.evaluate(principal, params)
+	}
+	return true
+}
+
+// evaluate 两侧操作数都能解析时才比较，任一侧缺失时条件不成立
+func (c *authorizationCondition) evaluate(principal *Principal, params map[string]string) bool {
+	left, leftOK := resolveConditionOperand(c.left, principal, params)
+	right, rightOK := resolveConditionOperand(c.right, principal, params)
+	if !leftOK || !rightOK {
+		return false
+	}
+	return (left == right) != c.negate
+}
+
+// resolveConditionOperand 解析条件操作数：principal为主体ID，principal.name为主体名称，
+// principal.<attr>为主体属性；带引号的为字面量；其他标识符只取路径参数，不存在时条件不成立
+func resolveConditionOperand(operand string, principal *Principal, params map[string]string) (string, bool) {
+	if len(operand) >= 2 && (operand[0] == '\'' || operand[0] == '"') && operand[len(operand)-1] == operand[0] {
+		return operand[1 : len(operand)-1], true
+	}
+	if operand == "principal" || strings.HasPrefix(operand, "principal.") {
+		if principal == nil {
+			return "", false
+		}
+		switch attribute := strings.TrimPrefix(strings.TrimPrefix(operand, "principal"), "."); attribute {
+		case "", "id":
+			return principal.ID, principal.ID != ""
+		case "name":
+			return principal.Name, principal.Name != ""
+		default:
+			value, ok := principal.Attrs[attribute]
+			if !ok || value == nil {
+				return "", false
+			}
+			return fmt.Sprint(value), true
+		}
+	}
+	value, ok := params[operand]
+	return value, ok
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================
+// 网络策略实现
+// ============================================================================
+
+var ErrPolicyDenied = errors.New("connection denied by network policy")
+
+// NetworkEndpoint 连接的一端
+type NetworkEndpoint struct {
+	Name   string
+	IP     net.IP
+	Port   int
+	Labels map[string]string
+}
+
+// Connection 一次待判定的连接
+type Connection struct {
+	Source      NetworkEndpoint
+	Destination NetworkEndpoint
+	Protocol    string
+}
+
+// PolicyDecision 网络策略判定结果
+type PolicyDecision struct {
+	Action   RuleAction
+	Allowed  bool
+	PolicyID string // 命中规则所在的策略，使用默认决定时为空
+	Rule     int    // 命中规则在策略中的下标，使用默认决定时为-1
+}
+
+// NetworkPolicyListener 网络策略监听器，命中Log规则的连接会通知它
+type NetworkPolicyListener interface {
+	OnPolicyLog(connection Connection, decision PolicyDecision)
+}
+
+// NetworkPolicyStatistics 网络策略判定统计
+type NetworkPolicyStatistics struct {
+	Allowed int64
+	Denied  int64
+	Logged  int64
+}
+
+// NetworkPolicyEngine 按策略登记顺序和规则顺序判定连接，第一条匹配的规则生效；
+// 没有策略时放行，有策略但没有规则匹配时拒绝
+type NetworkPolicyEngine struct {
+	policies   []compiledNetworkPolicy
+	listeners  []NetworkPolicyListener
+	statistics NetworkPolicyStatistics
+	mutex      sync.RWMutex
+}
+
+type compiledNetworkPolicy struct {
+	policy *NetworkPolicy
+	rules  []compiledNetworkRule
+}
+
+type compiledNetworkRule struct {
+	rule        NetworkRule
+	source      endpointSelector
+	destination endpointSelector
+}
+
+// endpointSelector 解析后的端点选择器，四种匹配方式只有一种生效
+type endpointSelector struct {
+	any     bool
+	network *net.IPNet
+	labels  map[string]string
+	name    string
+}
+
+// NewNetworkPolicyEngine 创建网络策略引擎
+func NewNetworkPolicyEngine() *NetworkPolicyEngine {
+	return &NetworkPolicyEngine{}
+}
+
+// AddPolicy 解析策略中的选择器并登记策略，选择器非法时返回错误且不登记
+func (npe *NetworkPolicyEngine) AddPolicy(policy *NetworkPolicy) error {
+	if policy == nil {
+		return errors.New("nil network policy")
+	}
+	compiled := compiledNetworkPolicy{policy: policy}
+	for i, rule := range policy.Rules {
+		source, err := parseEndpointSelector(rule.Source)
+		if err != nil {
+			return fmt.Errorf("policy %s rule %d source: %w", policy.ID, i, err)
+		}
+		destination, err := parseEndpointSelector(rule.Destination)
+		if err != nil {
+			return fmt.Errorf("policy %s rule %d destination: %w", policy.ID, i, err)
+		}
+		compiled.rules = append(compiled.rules, compiledNetworkRule{rule: rule, source: source, destination: destination})
+	}
+
+	npe.mutex.Lock()
+	defer npe.mutex.Unlock()
+	npe.policies = append(npe.policies, compiled)
+	return nil
+}
+
+// AddListener 添加网络策略监听器
+func (npe *NetworkPolicyEngine) AddListener(listener NetworkPolicyListener) {
+	npe.mutex.Lock()
+	defer npe.mutex.Unlock()
+	npe.listeners = append(npe.listeners, listener)
+}
+
+// Statistics 返回判定统计快照
+func (npe *NetworkPolicyEngine) Statistics() NetworkPolicyStatistics {
+	npe.mutex.RLock()
+	defer npe.mutex.RUnlock()
+	return npe.statistics
+}
+
+// Evaluate 判定连接，命中Log规则时在释放锁后通知监听器
+func (npe *NetworkPolicyEngine) Evaluate(connection Connection) PolicyDecision {
+	npe.mutex.Lock()
+	decision := PolicyDecision{Action: RuleActionAllow, Allowed: true, Rule: -1}
+	if len(npe.policies) > 0 {
+		decision = PolicyDecision{Action: RuleActionDeny, Rule: -1}
+	search:
+		for _, policy := range npe.policies {
+			for i, compiled := range policy.rules {
+				if compiled.matches(connection) {
+					decision = PolicyDecision{
+						Action:   compiled.rule.Action,
+						Allowed:  compiled.rule.Action != RuleActionDeny,
+						PolicyID: policy.policy.ID,
+						Rule:     i,
+					}
+					break search
+				}
+			}
+		}
+	}
+
+	if decision.Allowed {
+		npe.statistics.Allowed++
+	} else {
+		npe.statistics.Denied++
+	}
+	var listeners []NetworkPolicyListener
+	if decision.Action == RuleActionLog {
+		npe.statistics.Logged++
+		listeners = append(listeners, npe.listeners...)
+	}
+	npe.mutex.Unlock()
+
+	for _, listener := range listeners {
+		listener.OnPolicyLog(connection, decision)
+	}
+	return decision
+}
+
+func (cr compiledNetworkRule) matches(connection Connection) bool {
+	if cr.rule.Protocol != "" && cr.rule.Protocol != "*" && !strings.EqualFold(cr.rule.Protocol, connection.Protocol) {
+		return false
+	}
+	if cr.rule.Port != 0 && cr.rule.Port != connection.Destination.Port {
+		return false
+	}
+	return cr.source.matches(connection.Source) && cr.destination.matches(connection.Destination)
+}
+
+// parseEndpointSelector 解析选择器：空或"*"、CIDR、单个IP、k=v标签列表或端点名称
+func parseEndpointSelector(selector string) (endpointSelector, error) {
+	selector = strings.TrimSpace(selector)
+	switch {
+	case selector == "" || selector == "*":
+		return endpointSelector{any: true}, nil
+	case strings.Contains(selector, "/"):
+		_, network, err := net.ParseCIDR(selector)
+		if err != nil {
+			return endpointSelector{}, err
+		}
+		return endpointSelector{network: network}, nil
+	case net.ParseIP(selector) != nil:
+		ip := net.ParseIP(selector)
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return endpointSelector{network: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}}, nil
+	case strings.Contains(selector, "="):
+		labels := make(map[string]string)
+		for _, pair := range strings.Split(selector, ",") {
+			key, value, _ := strings.Cut(pair, "=")
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			if key == "" || value == "" {
+				return endpointSelector{}, fmt.Errorf("invalid label selector %q", selector)
+			}
+			labels[key] = value
+		}
+		return endpointSelector{labels: labels}, nil
+	default:
+		return endpointSelector{name: selector}, nil
+	}
+}
+
+func (es endpointSelector) matches(endpoint NetworkEndpoint) bool {
+	switch {
+	case es.any:
+		return true
+	case es.network != nil:
+		return endpoint.IP != nil && es.network.Contains(endpoint.IP)
+	case es.labels != nil:
+		for key, value := range es.labels {
+			if endpoint.Labels[key] != value {
+				return false
+			}
+		}
+		return true
+	default:
+		return endpoint.Name == es.name
+	}
+}
+
+// parseEndpointAddress 从"host:port"或"host"中解析IP和端口，host不是IP时IP为nil
+func parseEndpointAddress(address string) (net.IP, int) {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return net.ParseIP(address), 0
+	}
+	port, _ := strconv.Atoi(portText)
+	return net.ParseIP(host), port
+}
+
+// SetNetworkPolicyEngine 设置代理使用的网络策略引擎，nil表示不做策略检查
+func (sp *ServiceProxy) SetNetworkPolicyEngine(engine *NetworkPolicyEngine) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.policyEngine = engine
+}
+
+// enforceNetworkPolicy 对请求到每个上游的连接做策略判定，返回被拒绝的上游；
+// 全部上游都被拒绝时返回ErrorTypeAuthorization类型的错误。判定在代理锁外进行，监听器可以安全回调代理
+func (sp *ServiceProxy) enforceNetworkPolicy(request *Request) (map[string]bool, error) {
+	sp.mutex.RLock()
+	engine := sp.policyEngine
+	upstreams := append([]*UpstreamService(nil), sp.upstreamServices...)
+	source := NetworkEndpoint{Name: request.Source}
+	for _, client := range sp.downstreamClients {
+		if client.ID == request.Source {
+			source.Labels = client.Labels
+			break
+		}
+	}
+	protocol := sp.config.Protocol
+	sp.mutex.RUnlock()
+
+	if engine == nil || len(upstreams) == 0 {
+		return nil, nil
+	}
+	source.IP, source.Port = parseEndpointAddress(request.RemoteAddr)
+	if protocol == "" {
+		protocol = "http"
+	}
+
+	blocked := make(map[string]bool)
+	for _, upstream := range upstreams {
+		destination := NetworkEndpoint{Name: upstream.ID, Labels: upstream.Labels}
+		destination.IP, destination.Port = parseEndpointAddress(upstream.Address)
+		decision := engine.Evaluate(Connection{Source: source, Destination: destination, Protocol: protocol})
+		if !decision.Allowed {
+			blocked[upstream.ID] = true
+		}
+	}
+	if len(blocked) == len(upstreams) {
+		return nil, &ProxyError{Type: ErrorTypeAuthorization, Err: fmt.Errorf("%w: %q -> %s", ErrPolicyDenied, request.Source, sp.serviceID)}
+	}
+	return blocked, nil
+}
+
+// AddNetworkPolicy 登记网格范围的网络策略，作用于所有已登记和之后登记的代理
+func (sm *ServiceMesh) AddNetworkPolicy(policy *NetworkPolicy) error {
+	sm.mutex.Lock()
+	if sm.policyEngine == nil {
+		sm.policyEngine = NewNetworkPolicyEngine()
+		sm.policyEngine.AddListener(sm)
+		for _, proxy := range sm.proxies {
+			proxy.SetNetworkPolicyEngine(sm.policyEngine)
+		}
+	}
+	engine := sm.policyEngine
+	sm.mutex.Unlock()
+
+	if err := engine.AddPolicy(policy); err != nil {
+		return err
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.policies = append(sm.policies, policy)
+	return nil
+}
+
+// OnPolicyLog 把命中Log规则的连接记入网格访问日志
+func (sm *ServiceMesh) OnPolicyLog(connection Connection, decision PolicyDecision) {
+	sm.AccessLogger().Record(AccessLog{
+		Timestamp:   time.Now(),
+		Source:      connection.Source.Name,
+		Destination: connection.Destination.Name,
+		Policy:      decision.PolicyID,
+	})
+}
+
+// AccessLogs 返回内存中保留的最近访问日志，按时间先后排列
+func (sm *ServiceMesh) AccessLogs() []AccessLog {
+	return sm.AccessLogger().Entries()
+}
+
+// ============================================================================
+// 网格双向TLS证书实现
+// ============================================================================
+
+const (
+	meshCAID              = "mesh-ca"
+	meshTrustDomain       = "mesh.local"
+	defaultCertificateTTL = 24 * time.Hour
+	meshCAValidity        = 10 * 365 * 24 * time.Hour
+)
+
+// meshCA 网格内部CA，签发各服务的短期证书
+type meshCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pool        *x509.CertPool
+}
+
+// InitCertificateAuthority 创建网格内部CA并以mesh-ca为ID存入证书表，已创建时无副作用
+func (sm *ServiceMesh) InitCertificateAuthority() error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	return sm.ensureCALocked(time.Now())
+}
+
+func (sm *ServiceMesh) ensureCALocked(now time.Time) error {
+	if sm.ca != nil {
+		return nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate CA key: %w", err)
+	}
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: meshTrustDomain + " root CA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(meshCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("create CA certificate: %w", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	stored, err := newTLSCertificate(meshCAID, template.Subject.CommonName, der, key, certificate.NotAfter)
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+	sm.ca = &meshCA{certificate: certificate, key: key, pool: pool}
+	if sm.certificates == nil {
+		sm.certificates = make(map[string]*TLSCertificate)
+	}
+	sm.certificates[meshCAID] = stored
+	return nil
+}
+
+// IssueCertificate 为服务签发短期证书并替换证书表中的旧证书，CA不存在时先创建CA。
+// 证书同时可用于服务端和客户端认证，SAN包含服务ID、服务ID.mesh.local和SPIFFE URI
+func (sm *ServiceMesh) IssueCertificate(serviceID string) (*TLSCertificate, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	return sm.issueLocked(serviceID, time.Now())
+}
+
+func (sm *ServiceMesh) issueLocked(serviceID string, now time.Time) (*TLSCertificate, error) {
+	if serviceID == "" || serviceID == meshCAID {
+		return nil, fmt.Errorf("invalid service ID %q for certificate", serviceID)
+	}
+	if err := sm.ensureCALocked(now); err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate key for %s: %w", serviceID, err)
+	}
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	ttl := sm.config.CertificateTTL
+	if ttl <= 0 {
+		ttl = defaultCertificateTTL
+	}
+	spiffeID := &url.URL{Scheme: "spiffe", Host: meshTrustDomain, Path: "/" + serviceID}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: serviceID},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(ttl),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{serviceID, serviceID + "." + meshTrustDomain},
+		URIs:         []*url.URL{spiffeID},
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, template, sm.ca.certificate, &key.PublicKey, sm.ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("issue certificate for %s: %w", serviceID, err)
+	}
+	certificate, err := newTLSCertificate(serviceID, serviceID+"."+meshTrustDomain, der, key, template.NotAfter)
+	if err != nil {
+		return nil, err
+	}
+	sm.certificates[serviceID] = certificate
+	return certificate, nil
+}
+
+// Certificate 返回证书表中的证书
+func (sm *ServiceMesh) Certificate(id string) (*TLSCertificate, bool) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	certificate, exists := sm.certificates[id]
+	return certificate, exists
+}
+
+// RotateExpiring 重新签发剩余有效期不超过threshold的服务证书，返回被轮换的服务ID。
+// 已建立的连接不受影响，新握手通过TLS配置的回调取到新证书
+func (sm *ServiceMesh) RotateExpiring(threshold time.Duration) ([]string, error) {
+	return sm.rotateExpiring(threshold, time.Now())
+}
+
+func (sm *ServiceMesh) rotateExpiring(threshold time.Duration, now time.Time) ([]string, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	var expiring []string
+	for id, certificate := range sm.certificates {
+		if id != meshCAID && !now.Add(threshold).Before(certificate.ExpiresAt) {
+			expiring = append(expiring, id)
+		}
+	}
+	sort.Strings(expiring)
+
+	var rotated []string
+	for _, id := range expiring {
+		if _, err := sm.issueLocked(id, now); err != nil {
+			return rotated, fmt.Errorf("rotate %s: %w", id, err)
+		}
+		rotated = append(rotated, id)
+	}
+	return rotated, nil
+}
+
+// ServerTLSConfig 返回服务端TLS配置：出示本服务证书，并要求客户端出示由网格CA签发的证书
+func (sm *ServiceMesh) ServerTLSConfig(serviceID string) (*tls.Config, error) {
+	pool, err := sm.prepareTLS(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return sm.keyPair(serviceID)
+		},
+	}, nil
+}
+
+// ClientTLSConfig 返回连接peerServiceID时的客户端TLS配置：校验对端证书由网格CA签发且
+// 属于peerServiceID，并出示本服务证书
+func (sm *ServiceMesh) ClientTLSConfig(serviceID, peerServiceID string) (*tls.Config, error) {
+	pool, err := sm.prepareTLS(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+		ServerName: peerServiceID,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return sm.keyPair(serviceID)
+		},
+	}, nil
+}
+
+// prepareTLS 确保服务已有证书，返回网格CA的证书池
+func (sm *ServiceMesh) prepareTLS(serviceID string) (*x509.CertPool, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	if _, exists := sm.certificates[serviceID]; !exists {
+		if _, err := sm.issueLocked(serviceID, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return sm.ca.pool, nil
+}
+
+// keyPair 取服务当前的证书，轮换后的新握手会用到新证书
+func (sm *ServiceMesh) keyPair(serviceID string) (*tls.Certificate, error) {
+	certificate, exists := sm.Certificate(serviceID)
+	if !exists {
+		return nil, fmt.Errorf("no certificate for service %s", serviceID)
+	}
+	pair, err := tls.X509KeyPair(certificate.Certificate, certificate.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+// newTLSCertificate 把DER证书和私钥编码为PEM存入TLSCertificate
+func newTLSCertificate(id, domain string, der []byte, key *ecdsa.PrivateKey, expiresAt time.Time) (*TLSCertificate, error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("encode key for %s: %w", id, err)
+	}
+	return &TLSCertificate{
+		ID:          id,
+		Domain:      domain,
+		Certificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		PrivateKey:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+func randomSerialNumber() (*big.Int, error) {
+	serial, err := cryptorand.Int(cryptorand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// ============================================================================
+// 访问日志导出实现
+// ============================================================================
+
+const (
+	defaultAccessLogEntries       = 1024
+	defaultAccessLogFlushInterval = time.Second
+)
+
+// AccessLogSink 访问日志的输出目标，由后台协程按批调用
+type AccessLogSink interface {
+	WriteAccessLogs(entries []AccessLog) error
+}
+
+// JSONLinesSink 把每条访问日志编码为一行JSON写入writer
+type JSONLinesSink struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+// NewJSONLinesSink 创建JSON Lines输出
+func NewJSONLinesSink(writer io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{writer: writer}
+}
+
+// WriteAccessLogs 整批编码后一次写出，避免并发写入时行交错
+func (s *JSONLinesSink) WriteAccessLogs(entries []AccessLog) error {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err := s.writer.Write(buffer.Bytes())
+	return err
+}
+
+// DiscardSink 丢弃所有访问日志
+type DiscardSink struct{}
+
+func (DiscardSink) WriteAccessLogs([]AccessLog) error { return nil }
+
+// AccessLogConfig 访问日志配置
+type AccessLogConfig struct {
+	MaxEntries    int           // 内存环形缓冲保留的最近日志条数，同时是待写出队列的上限，为0时为1024
+	SampleRate    int           // 头部采样，每N条记录1条，小于等于1时全部记录
+	FlushInterval time.Duration // 后台写出间隔，为0时为1秒
+}
+
+// AccessLogStatistics 访问日志统计
+type AccessLogStatistics struct {
+	Recorded   int64 // 通过采样的日志数
+	SampledOut int64 // 被采样丢弃的日志数
+	Flushed    int64 // 已写入输出目标的日志数
+	Dropped    int64 // 待写出队列已满而未能写出的日志数
+	SinkErrors int64
+}
+
+// AccessLogger 环形缓冲的访问日志，按头部采样决定是否记录，并由后台协程异步写出到输出目标
+type AccessLogger struct {
+	config     AccessLogConfig
+	ring       []AccessLog
+	next       int // 环形缓冲下一个写入位置
+	seen       uint64
+	pending    []AccessLog
+	sink       AccessLogSink
+	statistics AccessLogStatistics
+	flushStop  chan struct{}
+	flushWG    sync.WaitGroup
+	flushMutex sync.Mutex // 保证写出按记录顺序进行
+	mutex      sync.Mutex
+}
+
+// NewAccessLogger 创建访问日志，未设置输出目标前只保留在内存中
+func NewAccessLogger(config AccessLogConfig) *AccessLogger {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaultAccessLogEntries
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultAccessLogFlushInterval
+	}
+	return &AccessLogger{config: config, ring: make([]AccessLog, 0, config.MaxEntries)}
+}
+
+// SetSink 设置输出目标并启动后台写出协程，nil表示只保留在内存中
+func (al *AccessLogger) SetSink(sink AccessLogSink) {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	al.sink = sink
+	if sink == nil || al.flushStop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	al.flushStop = stop
+	interval := al.config.FlushInterval
+	al.flushWG.Add(1)
+	go func() {
+		defer al.flushWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				al.Flush()
+			}
+		}
+	}()
+}
+
+// Record 按采样率记录一条日志，返回是否被记录
+func (al *AccessLogger) Record(entry AccessLog) bool {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+
+	al.seen++
+	if al.config.SampleRate > 1 && (al.seen-1)%uint64(al.config.SampleRate) != 0 {
+		al.statistics.SampledOut++
+		return false
+	}
+	al.statistics.Recorded++
+
+	if len(al.ring) < al.config.MaxEntries {
+		al.ring = append(al.ring, entry)
+	} else {
+		al.ring[al.next] = entry
+	}
+	al.next = (al.next + 1) % al.config.MaxEntries
+
+	if al.sink != nil {
+		if len(al.pending) >= al.config.MaxEntries {
+			al.statistics.Dropped++
+		} else {
+			al.pending = append(al.pending, entry)
+		}
+	}
+	return true
+}
+
+// Entries 返回环形缓冲中的日志，按记录先后排列
+func (al *AccessLogger) Entries() []AccessLog {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+
+	entries := make([]AccessLog, 0, len(al.ring))
+	if len(al.ring) < al.config.MaxEntries {
+		return append(entries, al.ring...)
+	}
+	entries = append(entries, al.ring[al.next:]...)
+	return append(entries, al.ring[:al.next]...)
+}
+
+// Statistics 返回访问日志统计快照
+func (al *AccessLogger) Statistics() AccessLogStatistics {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	return al.statistics
+}
+
+// Flush 把待写出的日志同步写到输出目标
+func (al *AccessLogger) Flush() error {
+	al.flushMutex.Lock()
+	defer al.flushMutex.Unlock()
+
+	al.mutex.Lock()
+	batch := al.pending
+	al.pending = nil
+	sink := al.sink
+	al.mutex.Unlock()
+
+	if len(batch) == 0 || sink == nil {
+		return nil
+	}
+	err := sink.WriteAccessLogs(batch)
+
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	if err != nil {
+		al.statistics.SinkErrors++
+		return fmt.Errorf("flush %d access logs: %w", len(batch), err)
+	}
+	al.statistics.Flushed += int64(len(batch))
+	return nil
+}
+
+// Close 停止后台写出协程并写出剩余日志
+func (al *AccessLogger) Close() error {
+	al.mutex.Lock()
+	stop := al.flushStop
+	al.flushStop = nil
+	al.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	al.flushWG.Wait()
+	return al.Flush()
+}
+
+// AccessLogger 返回网格的访问日志，兼容零值构造的网格
+func (sm *ServiceMesh) AccessLogger() *AccessLogger {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	if sm.accessLog == nil {
+		sm.accessLog = NewAccessLogger(AccessLogConfig{})
+	}
+	return sm.accessLog
+}
+
+// SetAccessLogger 替换网格的访问日志，例如使用不同的缓冲大小或采样率
+func (sm *ServiceMesh) SetAccessLogger(logger *AccessLogger) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.accessLog = logger
+}
+
+// ============================================================================
+// 故障转移实现
+// ============================================================================
+
+// FailoverState 故障转移状态
+type FailoverState int
+
+const (
+	FailoverStateNormal      FailoverState = iota // 流量在主用组
+	FailoverStateFailingOver                      // 正在切换到备用组（排空或滚动中）
+	FailoverStateFailedOver                       // 流量全部在备用组
+	FailoverStateFailingBack                      // 正在切回主用组（排空或滚动中）
+)
+
+func (fs FailoverState) String() string {
+	names := []string{"normal", "failing_over", "failed_over", "failing_back"}
+	if int(fs) < len(names) {
+		return names[fs]
+	}
+	return "unknown"
+}
+
+// FailoverEvent 一次故障转移状态变化
+type FailoverEvent struct {
+	From      FailoverState
+	To        FailoverState
+	Reason    string
+	Timestamp time.Time
+}
+
+// SetGroups 设置主用组和备用组的后端ID，不属于任一组的后端始终参与负载均衡
+func (fm *FailoverManager) SetGroups(primary, standby []string) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+	fm.primary = append([]string(nil), primary...)
+	fm.standby = append([]string(nil), standby...)
+	fm.state = FailoverStateNormal
+	fm.rolled = 0
+}
+
+// State 返回当前故障转移状态
+func (fm *FailoverManager) State() FailoverState {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+	return fm.state
+}
+
+// History 返回状态变化记录
+func (fm *FailoverManager) History() []FailoverEvent {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+	return append([]FailoverEvent(nil), fm.history...)
+}
+
+func (fm *FailoverManager) strategy() FailoverStrategy {
+	if len(fm.Strategies) == 0 {
+		return FailoverStrategyImmediate
+	}
+	return fm.Strategies[0]
+}
+
+func (fm *FailoverManager) configuredLocked() bool {
+	return fm.Config.Enabled && len(fm.primary) > 0 && len(fm.standby) > 0
+}
+
+// evaluate 根据后端的健康状态和指标推进状态机，调用方须持有负载均衡器的锁
+func (fm *FailoverManager) evaluate(backends []*Backend, now time.Time) FailoverState {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+	if !fm.configuredLocked() {
+		return fm.state
+	}
+
+	byID := make(map[string]*Backend, len(backends))
+	for _, backend := range backends {
+		byID[backend.id] = backend
+	}
+	failing := 0
+	for _, id := range fm.primary {
+		if fm.backendFailingLocked(byID[id]) {
+			failing++
+		}
+	}
+	threshold := fm.Config.Threshold
+	if threshold <= 0 {
+		threshold = 0.5
+	}
+	primaryFailed := float64(failing)/float64(len(fm.primary)) >= threshold
+	if failing > 0 || fm.healthySince.IsZero() {
+		fm.healthySince = now
+	}
+
+	strategy := fm.strategy()
+	switch fm.state {
+	case FailoverStateNormal:
+		if !primaryFailed {
+			break
+		}
+		reason := fmt.Sprintf("%d of %d primary backends failing", failing, len(fm.primary))
+		switch strategy {
+		case FailoverStrategyImmediate:
+			fm.transitionLocked(FailoverStateFailedOver, reason, now)
+		default:
+			fm.rolled, fm.drainStarted = 1, now
+			fm.transitionLocked(FailoverStateFailingOver, reason, now)
+			fm.advanceLocked(byID, fm.primary, FailoverStateFailedOver, now)
+		}
+	case FailoverStateFailingOver:
+		fm.rolled++
+		fm.advanceLocked(byID, fm.primary, FailoverStateFailedOver, now)
+	case FailoverStateFailedOver:
+		if fm.Config.FailbackAfter <= 0 || failing > 0 || now.Sub(fm.healthySince) < fm.Config.FailbackAfter {
+			break
+		}
+		reason := fmt.Sprintf("primary backends healthy for %v", now.Sub(fm.healthySince))
+		switch strategy {
+		case FailoverStrategyImmediate:
+			fm.transitionLocked(FailoverStateNormal, reason, now)
+		default:
+			fm.rolled, fm.drainStarted = 1, now
+			fm.transitionLocked(FailoverStateFailingBack, reason, now)
+			fm.advanceLocked(byID, fm.standby, FailoverStateNormal, now)
+		}
+	case FailoverStateFailingBack:
+		if primaryFailed {
+			fm.transitionLocked(FailoverStateFailedOver, "primary failed again during failback", now)
+			break
+		}
+		fm.rolled++
+		fm.advanceLocked(byID, fm.standby, FailoverStateNormal, now)
+	}
+	return fm.state
+}
+
+// advanceLocked 判断切换是否完成：优雅策略等待被换下的组连接排空或超时，滚动策略等所有后端都已换下
+func (fm *FailoverManager) advanceLocked(byID map[string]*Backend, leaving []string, done FailoverState, now time.Time) {
+	switch fm.strategy() {
+	case FailoverStrategyRolling:
+		if fm.rolled >= len(leaving) {
+			fm.transitionLocked(done, "rolling switch complete", now)
+		}
+	default:
+		connections := 0
+		for _, id := range leaving {
+			if backend := byID[id]; backend != nil {
+				connections += backend.connections
+			}
+		}
+		if connections == 0 {
+			fm.transitionLocked(done, "connections drained", now)
+		} else if fm.Config.DrainTimeout > 0 && now.Sub(fm.drainStarted) >= fm.Config.DrainTimeout {
+			fm.transitionLocked(done, fmt.Sprintf("drain timeout with %d connections open", connections), now)
+		}
+	}
+}
+
+func (fm *FailoverManager) transitionLocked(to FailoverState, reason string, now time.Time) {
+	if to == FailoverStateNormal || to == FailoverStateFailedOver {
+		fm.rolled = 0
+	}
+	fm.history = append(fm.history, FailoverEvent{From: fm.state, To: to, Reason: reason, Timestamp: now})
+	fm.state = to
+}
+
+// backendFailingLocked 后端缺失、不健康或指标达到阈值时视为故障
+func (fm *FailoverManager) backendFailingLocked(backend *Backend) bool {
+	if backend == nil || !backend.healthy {
+		return true
+	}
+	errorThreshold, ok := fm.Thresholds["error_rate"]
+	if !ok {
+		errorThreshold = 0.5
+	}
+	if backend.errorRate >= errorThreshold {
+		return true
+	}
+	if latency, ok := fm.Thresholds["latency_ms"]; ok && latency > 0 {
+		return float64(backend.responseTime)/float64(time.Millisecond) >= latency
+	}
+	return false
+}
+
+// route 返回当前参与选择的后端和仍在排空、只服务已绑定会话的后端
+func (fm *FailoverManager) route(backends []*Backend) ([]*Backend, map[string]bool) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+	if !fm.configuredLocked() {
+		return backends, nil
+	}
+
+	active := make(map[string]bool)
+	var draining map[string]bool
+	switch fm.state {
+	case FailoverStateNormal:
+		markAll(active, fm.primary)
+	case FailoverStateFailedOver:
+		markAll(active, fm.standby)
+	case FailoverStateFailingOver, FailoverStateFailingBack:
+		leaving, arriving := fm.primary, fm.standby
+		if fm.state == FailoverStateFailingBack {
+			leaving, arriving = fm.standby, fm.primary
+		}
+		if fm.strategy() == FailoverStrategyRolling {
+			// 换下leaving的前rolled个后端，按比例换上arriving
+			rolled := min(fm.rolled, len(leaving))
+			markAll(active, leaving[rolled:])
+			markAll(active, arriving[:max(1, rolled*len(arriving)/len(leaving))])
+		} else {
+			markAll(active, arriving)
+			draining = make(map[string]bool)
+			markAll(draining, leaving)
+		}
+	}
+
+	grouped := make(map[string]bool)
+	markAll(grouped, fm.primary)
+	markAll(grouped, fm.standby)
+	candidates := make([]*Backend, 0, len(backends))
+	for _, backend := range backends {
+		if active[backend.id] || !grouped[backend.id] {
+			candidates = append(candidates, backend)
+		}
+	}
+	return candidates, draining
+}
+
+func markAll(set map[string]bool, ids []string) {
+	for _, id := range ids {
+		set[id] = true
+	}
+}
+
+func containsBackend(backends []*Backend, id string) bool {
+	for _, backend := range backends {
+		if backend.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// FailoverManager 返回负载均衡器的故障转移管理器
+func (lb *LoadBalancer) FailoverManager() *FailoverManager {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	if lb.failoverManager == nil {
+		lb.failoverManager = NewFailoverManager()
+	}
+	return lb.failoverManager
+}
+
+// UpdateMetrics 用采集到的指标刷新后端的连接数、响应时间和错误率
+func (lb *LoadBalancer) UpdateMetrics(metrics map[string]*BackendMetrics) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	if lb.algorithm == nil {
+		lb.algorithm = NewLoadBalancingAlgorithm(lb.config.Algorithm)
+	}
+	lb.algorithm.UpdateWeights(lb.backends, metrics)
+}
+
+// EvaluateFailover 按后端当前状态推进一次故障转移状态机
+func (lb *LoadBalancer) EvaluateFailover() FailoverState {
+	return lb.evaluateFailover(time.Now())
+}
+
+func (lb *LoadBalancer) evaluateFailover(now time.Time) FailoverState {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	if lb.failoverManager == nil {
+		return FailoverStateNormal
+	}
+	return lb.failoverManager.evaluate(lb.backends, now)
+}
+
+// StartFailoverMonitor 按故障转移配置的CheckInterval（默认5秒）定期评估，重复调用无副作用
+func (lb *LoadBalancer) StartFailoverMonitor() {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	if lb.failoverStop != nil {
+		return
+	}
+	interval := 5 * time.Second
+	if lb.failoverManager != nil && lb.failoverManager.Config.CheckInterval > 0 {
+		interval = lb.failoverManager.Config.CheckInterval
+	}
+	stop := make(chan struct{})
+	lb.failoverStop = stop
+
+	lb.failoverWG.Add(1)
+	go func() {
+		defer lb.failoverWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				lb.evaluateFailover(now)
+			}
+		}
+	}()
+}
+
+// StopFailoverMonitor 停止故障转移评估协程并等待其退出
+func (lb *LoadBalancer) StopFailoverMonitor() {
+	lb.mutex.Lock()
+	stop := lb.failoverStop
+	lb.failoverStop = nil
+	lb.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	lb.failoverWG.Wait()
+}
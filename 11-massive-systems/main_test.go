@@ -0,0 +1,3245 @@
+/*
+=== 大规模系统设计模块测试 ===
+
+测试服务网格与流量治理组件：
+1. 服务代理请求转发
+2. 负载均衡算法
+3. 主动健康检查
+4. 熔断器状态机
+5. 服务注册表租约
+6. 指数退避重试
+7. API网关路由
+8. 会话亲和
+9. 加权流量分割
+10. 分布式链路跟踪
+11. Prometheus指标导出
+12. 一致性哈希分片
+13. 自动扩缩容
+14. 消息代理发布订阅
+15. 网关请求验证
+16. 网关请求响应转换
+17. JWT认证
+18. RBAC授权
+19. 网络策略
+20. 网格双向TLS
+21. 访问日志导出
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeTransport 记录请求并按上游返回预设结果的传输层
+type fakeTransport struct {
+	mutex     sync.Mutex
+	calls     map[string]int
+	failures  map[string]error
+	responses map[string]*Response
+}
+
+func newFakeTransport() *fakeTransport {
+	return &fakeTransport{
+		calls:     make(map[string]int),
+		failures:  make(map[string]error),
+		responses: make(map[string]*Response),
+	}
+}
+
+func (ft *fakeTransport) RoundTrip(ctx context.Context, upstream *UpstreamService, request *Request) (*Response, error) {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+
+	ft.calls[upstream.ID]++
+	if err := ft.failures[upstream.ID]; err != nil {
+		return nil, err
+	}
+	if response := ft.responses[upstream.ID]; response != nil {
+		return response, nil
+	}
+	return &Response{StatusCode: 200, Body: []byte(upstream.ID)}, nil
+}
+
+func (ft *fakeTransport) callCount(upstreamID string) int {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	return ft.calls[upstreamID]
+}
+
+// ==================
+// 1. 服务代理请求转发
+// ==================
+
+func TestServiceProxyForwardRecordsMetrics(t *testing.T) {
+	transport := newFakeTransport()
+	proxy := NewServiceProxy("user-service", ProxyConfig{}, transport)
+	proxy.AddUpstream(&UpstreamService{ID: "user-v1", Weight: 1})
+
+	response, err := proxy.Forward(&Request{ID: "req-1", Method: "GET", URL: "/users/1"})
+	if err != nil {
+		t.Fatalf("转发失败: %v", err)
+	}
+	if string(response.Body) != "user-v1" {
+		t.Errorf("期望由user-v1响应，实际为%s", response.Body)
+	}
+	if transport.callCount("user-v1") != 1 {
+		t.Errorf("期望上游被调用1次，实际为%d", transport.callCount("user-v1"))
+	}
+
+	metrics := proxy.Metrics()
+	if metrics.RequestCount != 1 {
+		t.Errorf("期望请求数为1，实际为%d", metrics.RequestCount)
+	}
+	if metrics.ErrorRate != 0 {
+		t.Errorf("期望错误率为0，实际为%.2f", metrics.ErrorRate)
+	}
+}
+
+func TestServiceProxySkipsUnhealthyUpstream(t *testing.T) {
+	transport := newFakeTransport()
+	proxy := NewServiceProxy("user-service", ProxyConfig{}, transport)
+	proxy.AddUpstream(&UpstreamService{ID: "healthy", Weight: 1})
+	proxy.AddUpstream(&UpstreamService{ID: "sick", Weight: 100})
+	proxy.HealthChecker().SetStatus("sick", HealthStatusUnhealthy)
+
+	for i := 0; i < 10; i++ {
+		if _, err := proxy.Forward(&Request{Method: "GET", URL: "/"}); err != nil {
+			t.Fatalf("转发失败: %v", err)
+		}
+	}
+
+	if transport.callCount("sick") != 0 {
+		t.Errorf("不健康的上游不应被调用，实际调用%d次", transport.callCount("sick"))
+	}
+	if transport.callCount("healthy") != 10 {
+		t.Errorf("期望健康上游处理全部10个请求，实际为%d", transport.callCount("healthy"))
+	}
+}
+
+func TestServiceProxyNoHealthyUpstream(t *testing.T) {
+	proxy := NewServiceProxy("user-service", ProxyConfig{}, newFakeTransport())
+	proxy.AddUpstream(&UpstreamService{ID: "sick"})
+	proxy.HealthChecker().SetStatus("sick", HealthStatusUnhealthy)
+
+	_, err := proxy.Forward(&Request{Method: "GET", URL: "/"})
+	if !errors.Is(err, ErrNoHealthyUpstream) {
+		t.Fatalf("期望ErrNoHealthyUpstream，实际为%v", err)
+	}
+
+	var proxyErr *ProxyError
+	if !errors.As(err, &proxyErr) {
+		t.Fatalf("期望返回*ProxyError，实际为%T", err)
+	}
+	if proxy.Metrics().ErrorRate != 1 {
+		t.Errorf("期望错误率为1，实际为%.2f", proxy.Metrics().ErrorRate)
+	}
+}
+
+func TestServiceProxyRetriesOnAnotherUpstream(t *testing.T) {
+	transport := newFakeTransport()
+	transport.failures["broken"] = errors.New("connection refused")
+
+	proxy := NewServiceProxy("user-service", ProxyConfig{}, transport)
+	proxy.AddUpstream(&UpstreamService{ID: "broken", Weight: 100})
+	proxy.AddUpstream(&UpstreamService{ID: "backup", Weight: 1})
+	proxy.SetRetryPolicy(RetryPolicy{MaxAttempts: 2})
+
+	response, err := proxy.Forward(&Request{Method: "GET", URL: "/"})
+	if err != nil {
+		t.Fatalf("期望重试后成功，实际为%v", err)
+	}
+	if string(response.Body) != "backup" {
+		t.Errorf("期望由backup响应，实际为%s", response.Body)
+	}
+}
+
+func TestServiceProxyTrafficRulesAndDownstream(t *testing.T) {
+	transport := newFakeTransport()
+	proxy := NewServiceProxy("user-service", ProxyConfig{}, transport)
+	proxy.AddUpstream(&UpstreamService{ID: "stable"})
+	proxy.AddUpstream(&UpstreamService{ID: "canary"})
+	proxy.AddDownstreamClient(&DownstreamClient{ID: "web-client", Type: "http"})
+	proxy.AddTrafficRule(&TrafficRule{ID: "beta", Destination: "canary", Weight: 1, Priority: 10, Condition: "header:X-Beta=true"})
+	proxy.AddTrafficRule(&TrafficRule{ID: "default", Destination: "stable", Weight: 1})
+
+	response, err := proxy.Forward(&Request{Source: "web-client", Method: "GET", URL: "/", Headers: map[string]string{"X-Beta": "true"}})
+	if err != nil || string(response.Body) != "canary" {
+		t.Fatalf("期望beta请求路由到canary，实际为%v %v", response, err)
+	}
+
+	response, err = proxy.Forward(&Request{Source: "web-client", Method: "GET", URL: "/"})
+	if err != nil || string(response.Body) != "stable" {
+		t.Fatalf("期望普通请求路由到stable，实际为%v %v", response, err)
+	}
+
+	_, err = proxy.Forward(&Request{Source: "unknown", Method: "GET", URL: "/"})
+	if !errors.Is(err, ErrUnknownDownstream) {
+		t.Fatalf("期望拒绝未登记的下游客户端，实际为%v", err)
+	}
+}
+
+// ==================
+// 2. 负载均衡算法
+// ==================
+
+func newTestBackends(ids ...string) []*Backend {
+	backends := make([]*Backend, len(ids))
+	for i, id := range ids {
+		backends[i] = &Backend{id: id, weight: 1, healthy: true}
+	}
+	return backends
+}
+
+func TestRoundRobinAlgorithmDistribution(t *testing.T) {
+	backends := newTestBackends("a", "b", "c")
+	backends[1].healthy = false
+	algorithm := &RoundRobinAlgorithm{}
+
+	counts := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		counts[algorithm.SelectBackend(backends, &Request{}).id]++
+	}
+	if counts["b"] != 0 || counts["a"] != 5 || counts["c"] != 5 {
+		t.Errorf("期望在健康后端间平均分配且跳过b，实际为%v", counts)
+	}
+
+	backends[0].healthy, backends[2].healthy = false, false
+	if backend := algorithm.SelectBackend(backends, &Request{}); backend != nil {
+		t.Errorf("没有健康后端时应返回nil，实际为%s", backend.id)
+	}
+}
+
+func TestRoundRobinAlgorithmConcurrentCursor(t *testing.T) {
+	backends := newTestBackends("a", "b")
+	algorithm := &RoundRobinAlgorithm{}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			backend := algorithm.SelectBackend(backends, &Request{})
+			mutex.Lock()
+			counts[backend.id]++
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if counts["a"] != 50 || counts["b"] != 50 {
+		t.Errorf("并发轮询应精确均分，实际为%v", counts)
+	}
+}
+
+func TestLeastConnectionsAlgorithm(t *testing.T) {
+	backends := newTestBackends("a", "b", "c")
+	backends[0].connections, backends[1].connections, backends[2].connections = 5, 2, 0
+	backends[2].healthy = false
+	algorithm := &LeastConnectionsAlgorithm{}
+
+	if backend := algorithm.SelectBackend(backends, &Request{}); backend.id != "b" {
+		t.Errorf("期望选择连接数最少的健康后端b，实际为%s", backend.id)
+	}
+
+	algorithm.UpdateWeights(backends, map[string]*BackendMetrics{
+		"a": {ActiveConnections: 1, RequestCount: 10, ErrorCount: 2},
+	})
+	if backend := algorithm.SelectBackend(backends, &Request{}); backend.id != "a" {
+		t.Errorf("指标更新后应选择a，实际为%s", backend.id)
+	}
+	if backends[0].errorRate != 0.2 {
+		t.Errorf("期望错误率按指标更新为0.2，实际为%.2f", backends[0].errorRate)
+	}
+
+	backends[0].healthy, backends[1].healthy = false, false
+	if backend := algorithm.SelectBackend(backends, &Request{}); backend != nil {
+		t.Errorf("没有健康后端时应返回nil，实际为%s", backend.id)
+	}
+}
+
+func TestLoadBalancerFailover(t *testing.T) {
+	lb := NewLoadBalancerWithConfig(LoadBalancerConfig{Algorithm: LoadBalanceLeastConnections})
+	lb.algorithm.(*LeastConnectionsAlgorithm).UnhealthyThreshold = 0.5
+	for _, backend := range newTestBackends("primary", "secondary") {
+		lb.AddBackend(backend)
+	}
+	lb.backends[1].connections = 3
+
+	primary := lb.SelectBackend(&Request{})
+	if primary.id != "primary" {
+		t.Fatalf("期望先选择primary，实际为%s", primary.id)
+	}
+
+	for i := 0; i < 3; i++ {
+		lb.ReportFailure(primary, errors.New("connection reset"))
+	}
+	if primary.errorRate < 0.48 || primary.errorRate > 0.49 || !primary.healthy {
+		t.Fatalf("3次失败后错误率应约为0.488且仍健康，实际为%.3f %v", primary.errorRate, primary.healthy)
+	}
+	lb.ReportFailure(primary, errors.New("connection reset"))
+	if primary.healthy {
+		t.Fatal("错误率超过阈值后应摘除primary")
+	}
+
+	if backend := lb.SelectBackend(&Request{}); backend == nil || backend.id != "secondary" {
+		t.Fatalf("期望故障转移到secondary，实际为%v", backend)
+	}
+	lb.ReportFailure(lb.backends[1], errors.New("timeout"))
+	if !lb.backends[1].healthy {
+		t.Error("单次失败不应摘除secondary")
+	}
+	if lb.statistics.TotalRequests != 2 || lb.statistics.FailedRequests != 5 {
+		t.Errorf("统计不符合预期: %+v", lb.statistics)
+	}
+}
+
+func TestWeightedAlgorithmProportional(t *testing.T) {
+	backends := newTestBackends("a", "b", "c", "d")
+	backends[0].weight, backends[1].weight, backends[2].weight, backends[3].weight = 5, 1, 1, 9
+	backends[3].healthy = false
+	algorithm := &WeightedAlgorithm{}
+
+	var sequence []string
+	for i := 0; i < 7; i++ {
+		sequence = append(sequence, algorithm.SelectBackend(backends, &Request{}).id)
+	}
+	if expected := []string{"a", "a", "b", "a", "c", "a", "a"}; !reflect.DeepEqual(sequence, expected) {
+		t.Errorf("平滑加权轮询序列应为%v，实际为%v", expected, sequence)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 700; i++ {
+		counts[algorithm.SelectBackend(backends, &Request{}).id]++
+	}
+	if counts["a"] != 500 || counts["b"] != 100 || counts["c"] != 100 || counts["d"] != 0 {
+		t.Errorf("分配比例应为5:1:1且跳过不健康的d，实际为%v", counts)
+	}
+}
+
+func TestConsistentHashAlgorithmMinimalRemap(t *testing.T) {
+	backends := newTestBackends("a", "b", "c")
+	algorithm := NewLoadBalancingAlgorithm(LoadBalanceIPHash)
+	request := func(i int) *Request {
+		return &Request{Headers: map[string]string{"X-Forwarded-For": fmt.Sprintf("10.0.%d.%d, 192.168.0.1", i/256, i%256)}}
+	}
+
+	before := make(map[int]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		before[i] = algorithm.SelectBackend(backends, request(i)).id
+		counts[before[i]]++
+	}
+	for _, backend := range backends {
+		if counts[backend.id] < 600 {
+			t.Errorf("虚拟节点应使键分布较均匀，实际为%v", counts)
+			break
+		}
+	}
+	if again := algorithm.SelectBackend(backends, request(42)).id; again != before[42] {
+		t.Errorf("同一客户端应固定落到同一后端，实际为%s和%s", before[42], again)
+	}
+
+	backends[1].healthy = false
+	for i := 0; i < 3000; i++ {
+		after := algorithm.SelectBackend(backends, request(i)).id
+		if after == "b" {
+			t.Fatalf("不健康的后端不应被选中")
+		}
+		if before[i] != "b" && after != before[i] {
+			t.Fatalf("未命中b的键%d不应被重新映射: %s -> %s", i, before[i], after)
+		}
+	}
+
+	for _, backend := range backends {
+		backend.healthy = false
+	}
+	if backend := algorithm.SelectBackend(backends, request(0)); backend != nil {
+		t.Errorf("没有健康后端时应返回nil，实际为%s", backend.id)
+	}
+}
+
+// ==================
+// 3. 主动健康检查
+// ==================
+
+// waitForStatus 等待健康状态翻转通知
+func waitForStatus(t *testing.T, changes <-chan HealthStatus, expected HealthStatus) {
+	t.Helper()
+	select {
+	case status := <-changes:
+		if status != expected {
+			t.Fatalf("期望状态翻转为%v，实际为%v", expected, status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("等待状态翻转为%v超时", expected)
+	}
+}
+
+func TestHealthCheckerHTTPProbeDebounce(t *testing.T) {
+	var failing atomic.Bool
+	var successes, failures atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			failures.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		successes.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	lb := NewLoadBalancer()
+	backend := &Backend{id: "api", weight: 1}
+	lb.AddBackend(backend)
+
+	checker := NewHealthChecker(5*time.Millisecond, time.Second, 3)
+	checker.HealthyThreshold = 2
+	changes := make(chan HealthStatus, 4)
+	lb.MonitorBackend(backend, checker, HealthProbe{Type: ProbeHTTP, Address: server.Listener.Addr().String(), Path: "/healthz"})
+	checker.AddTarget("observer", HealthProbe{Type: ProbeHTTP, Address: server.Listener.Addr().String()}, func(status HealthStatus) {
+		changes <- status
+	})
+	checker.Start()
+	defer checker.Stop()
+
+	waitForStatus(t, changes, HealthStatusHealthy)
+	if successes.Load() < 2 {
+		t.Errorf("至少连续2次成功才应判定健康，实际成功%d次", successes.Load())
+	}
+
+	failing.Store(true)
+	waitForStatus(t, changes, HealthStatusUnhealthy)
+	if failures.Load() < 3 {
+		t.Errorf("至少连续3次失败才应判定不健康，实际失败%d次", failures.Load())
+	}
+
+	checker.Stop()
+	if lb.IsBackendHealthy(backend) {
+		t.Error("后端应被标记为不健康")
+	}
+	if lb.SelectBackend(&Request{}) != nil {
+		t.Error("唯一后端不健康时不应选出后端")
+	}
+	if checker.Status("api") != HealthStatusUnhealthy {
+		t.Errorf("期望检查器记录api为不健康，实际为%v", checker.Status("api"))
+	}
+}
+
+func TestHealthCheckerTCPProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	checker := NewHealthChecker(5*time.Millisecond, time.Second, 2)
+	changes := make(chan HealthStatus, 4)
+	checker.AddTarget("db", HealthProbe{Type: ProbeTCP, Address: listener.Addr().String()}, func(status HealthStatus) {
+		changes <- status
+	})
+	checker.Start()
+	defer checker.Stop()
+
+	waitForStatus(t, changes, HealthStatusHealthy)
+	listener.Close()
+	waitForStatus(t, changes, HealthStatusUnhealthy)
+}
+
+// ==================
+// 4. 熔断器状态机
+// ==================
+
+// recordingListener 记录熔断器状态变化的监听器
+type recordingListener struct {
+	mutex    sync.Mutex
+	states   []CircuitState
+	requests int
+}
+
+func (rl *recordingListener) OnStateChange(state CircuitState) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.states = append(rl.states, state)
+}
+
+func (rl *recordingListener) OnRequest(success bool) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.requests++
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	breaker := NewCircuitBreakerWithConfig(CircuitBreakerConfig{FailureThreshold: 3, SuccessThreshold: 2, Timeout: 20 * time.Millisecond})
+	listener := &recordingListener{}
+	breaker.AddListener(listener)
+	failure := errors.New("upstream failed")
+	fail := func() error { return failure }
+	succeed := func() error { return nil }
+
+	// 中途的成功会重置连续失败计数
+	for _, fn := range []func() error{fail, fail, succeed, fail, fail} {
+		breaker.Execute(fn)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("未连续失败3次不应打开，实际为%v", breaker.State())
+	}
+	if err := breaker.Execute(fail); err != failure {
+		t.Fatalf("关闭状态应返回fn的错误，实际为%v", err)
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("连续失败3次后应打开，实际为%v", breaker.State())
+	}
+
+	called := false
+	err := breaker.Execute(func() error { called = true; return nil })
+	var openErr *CircuitOpenError
+	if called || !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) || openErr.State != CircuitOpen || openErr.RetryAfter <= 0 {
+		t.Fatalf("打开状态应直接拒绝，实际为%v called=%v", err, called)
+	}
+
+	// 超时后进入半开，试探失败重新打开
+	time.Sleep(25 * time.Millisecond)
+	if err := breaker.Execute(fail); err != failure || breaker.State() != CircuitOpen {
+		t.Fatalf("半开状态试探失败应重新打开，实际为%v %v", err, breaker.State())
+	}
+
+	// 再次超时后连续2次成功关闭
+	time.Sleep(25 * time.Millisecond)
+	if err := breaker.Execute(succeed); err != nil || breaker.State() != CircuitHalfOpen {
+		t.Fatalf("一次成功后应保持半开，实际为%v %v", err, breaker.State())
+	}
+	if err := breaker.Execute(succeed); err != nil || breaker.State() != CircuitClosed {
+		t.Fatalf("连续2次成功后应关闭，实际为%v %v", err, breaker.State())
+	}
+
+	expected := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+	if !reflect.DeepEqual(listener.states, expected) {
+		t.Errorf("状态变化序列应为%v，实际为%v", expected, listener.states)
+	}
+	if listener.requests != 9 {
+		t.Errorf("期望记录9次请求结果，实际为%d", listener.requests)
+	}
+	if breaker.statistics.RejectedRequests != 1 || breaker.statistics.CircuitOpens != 2 {
+		t.Errorf("统计不符合预期: %+v", breaker.statistics)
+	}
+}
+
+func TestCircuitBreakerHalfOpenLimitsConcurrentTrials(t *testing.T) {
+	breaker := NewCircuitBreakerWithConfig(CircuitBreakerConfig{FailureThreshold: 1, SuccessThreshold: 2, Timeout: 10 * time.Millisecond, MaxRequests: 2})
+	breaker.Execute(func() error { return errors.New("boom") })
+	time.Sleep(15 * time.Millisecond)
+
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(2)
+	var wg sync.WaitGroup
+	var executed, rejected atomic.Int64
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := breaker.Execute(func() error {
+				executed.Add(1)
+				started.Done()
+				<-release
+				return nil
+			})
+			var openErr *CircuitOpenError
+			if errors.As(err, &openErr) && openErr.State == CircuitHalfOpen {
+				rejected.Add(1)
+			}
+		}()
+	}
+	started.Wait()
+	for rejected.Load() < 8 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if executed.Load() != 2 || rejected.Load() != 8 {
+		t.Errorf("半开状态应只放行2个试探请求，实际执行%d个、拒绝%d个", executed.Load(), rejected.Load())
+	}
+	if breaker.State() != CircuitClosed {
+		t.Errorf("2个试探请求成功后应关闭，实际为%v", breaker.State())
+	}
+}
+
+// ==================
+// 5. 服务注册表租约
+// ==================
+
+// recordingWatcher 按顺序记录注册表事件
+type recordingWatcher struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (rw *recordingWatcher) record(event string) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	rw.events = append(rw.events, event)
+}
+
+func (rw *recordingWatcher) snapshot() []string {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	return append([]string(nil), rw.events...)
+}
+
+func (rw *recordingWatcher) OnServiceRegistered(instance *ServiceInstance) {
+	rw.record("registered:" + instance.id)
+}
+
+func (rw *recordingWatcher) OnServiceDeregistered(instanceID string) {
+	rw.record("deregistered:" + instanceID)
+}
+
+func (rw *recordingWatcher) OnServiceUpdated(instance *ServiceInstance) {
+	rw.record("updated:" + instance.id)
+}
+
+func (rw *recordingWatcher) OnHealthStatusChanged(instanceID string, status HealthStatus) {
+	rw.record(fmt.Sprintf("health:%s=%d", instanceID, status))
+}
+
+func TestServiceRegistryLeaseExpiry(t *testing.T) {
+	registry := NewServiceRegistry()
+	watcher := &recordingWatcher{}
+	registry.AddWatcher(watcher)
+
+	for _, id := range []string{"stale", "alive"} {
+		if err := registry.Register(&ServiceInstance{id: id, serviceName: "user-service"}, 50*time.Millisecond); err != nil {
+			t.Fatalf("注册%s失败: %v", id, err)
+		}
+	}
+	registry.StartSweeper(5 * time.Millisecond)
+	defer registry.StopSweeper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for registry.Instance("stale") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("未续约的实例应在租约到期后被移除")
+		}
+		if err := registry.Renew("alive"); err != nil {
+			t.Fatalf("续约失败: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	registry.StopSweeper()
+
+	if instances := registry.Instances("user-service"); len(instances) != 1 || instances[0].id != "alive" {
+		t.Fatalf("期望只剩续约的alive实例，实际为%v", instances)
+	}
+	if err := registry.Renew("stale"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("过期实例续约应返回ErrInstanceNotFound，实际为%v", err)
+	}
+	expected := []string{
+		"registered:stale", "registered:alive",
+		fmt.Sprintf("health:stale=%d", HealthStatusUnhealthy), "deregistered:stale",
+	}
+	if events := watcher.snapshot(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("事件序列应为%v，实际为%v", expected, events)
+	}
+}
+
+func TestServiceRegistryRegisterRenewDeregister(t *testing.T) {
+	registry := NewServiceRegistry()
+	watcher := &recordingWatcher{}
+	registry.AddWatcher(watcher)
+
+	if err := registry.Register(&ServiceInstance{}, time.Second); !errors.Is(err, ErrInvalidInstance) {
+		t.Errorf("缺少ID的实例应被拒绝，实际为%v", err)
+	}
+	instance := &ServiceInstance{id: "api-1", serviceName: "api"}
+	registry.Register(instance, 20*time.Millisecond)
+	registry.Register(instance, 20*time.Millisecond)
+
+	// 清扫只移除心跳超过TTL的实例
+	start := instance.lastHeartbeat
+	if expired := registry.sweep(start.Add(10 * time.Millisecond)); len(expired) != 0 {
+		t.Errorf("租约未到期不应移除，实际移除%v", expired)
+	}
+	if err := registry.Renew("api-1"); err != nil {
+		t.Fatalf("续约失败: %v", err)
+	}
+	if lease := registry.leases["api-1"]; lease.TTL != 20*time.Millisecond || !lease.ExpiresAt.Equal(lease.Renewed.Add(lease.TTL)) {
+		t.Errorf("续约应顺延租约到期时间: %+v", lease)
+	}
+
+	if err := registry.Deregister("api-1"); err != nil {
+		t.Fatalf("注销失败: %v", err)
+	}
+	if err := registry.Deregister("api-1"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("重复注销应返回ErrInstanceNotFound，实际为%v", err)
+	}
+	if len(registry.registrations) != 0 || len(registry.leases) != 0 {
+		t.Errorf("注销后应清理登记和租约")
+	}
+	expected := []string{"registered:api-1", "updated:api-1", "deregistered:api-1"}
+	if events := watcher.snapshot(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("事件序列应为%v，实际为%v", expected, events)
+	}
+}
+
+// ==================
+// 6. 指数退避重试
+// ==================
+
+// recordBackoff 将抖动替换为记录退避上限并立即返回，返回记录结果
+func recordBackoff(t *testing.T) *[]time.Duration {
+	t.Helper()
+	original := retryJitter
+	t.Cleanup(func() { retryJitter = original })
+
+	limits := &[]time.Duration{}
+	retryJitter = func(limit time.Duration) time.Duration {
+		*limits = append(*limits, limit)
+		return 0
+	}
+	return limits
+}
+
+func TestRetryAttemptsAndBackoff(t *testing.T) {
+	limits := recordBackoff(t)
+	policy := RetryPolicy{MaxAttempts: 5, InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, BackoffFactor: 2}
+
+	calls := 0
+	networkErr := &ProxyError{Type: ErrorTypeNetwork, Err: errors.New("connection refused")}
+	err := Retry(context.Background(), policy, func() error {
+		calls++
+		return networkErr
+	})
+	if err != networkErr || calls != 5 {
+		t.Fatalf("期望重试5次后返回最后的错误，实际调用%d次，错误为%v", calls, err)
+	}
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond}
+	if !reflect.DeepEqual(*limits, expected) {
+		t.Errorf("退避上限应按指数增长并受MaxDelay限制，期望%v，实际为%v", expected, *limits)
+	}
+
+	calls = 0
+	err = Retry(context.Background(), policy, func() error {
+		calls++
+		if calls < 3 {
+			return &ProxyError{Type: ErrorTypeTimeout, Err: context.DeadlineExceeded}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("期望第3次成功，实际调用%d次，错误为%v", calls, err)
+	}
+}
+
+func TestRetryStopsOnNonRetryableError(t *testing.T) {
+	recordBackoff(t)
+
+	calls := 0
+	authErr := &ProxyError{Type: ErrorTypeAuthorization, Err: errors.New("forbidden")}
+	err := Retry(context.Background(), RetryPolicy{MaxAttempts: 5}, func() error {
+		calls++
+		return authErr
+	})
+	if err != authErr || calls != 1 {
+		t.Errorf("授权错误不应重试，实际调用%d次", calls)
+	}
+
+	calls = 0
+	Retry(context.Background(), RetryPolicy{MaxAttempts: 5}, func() error {
+		calls++
+		return errors.New("plain error")
+	})
+	if calls != 1 {
+		t.Errorf("无法分类的错误不应重试，实际调用%d次", calls)
+	}
+}
+
+func TestRetryRespectsContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 3, InitialDelay: time.Hour}
+
+	calls := 0
+	networkErr := &ProxyError{Type: ErrorTypeNetwork, Err: errors.New("connection reset")}
+	done := make(chan error, 1)
+	go func() {
+		done <- Retry(ctx, policy, func() error {
+			calls++
+			return networkErr
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) || !errors.Is(err, networkErr) || calls != 1 {
+			t.Errorf("取消后应停止重试并保留最后的错误，实际调用%d次，错误为%v", calls, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("取消上下文后重试应立即返回")
+	}
+
+	for i := 0; i < 100; i++ {
+		if jitter := retryJitter(time.Millisecond); jitter < 0 || jitter > time.Millisecond {
+			t.Fatalf("全抖动应落在[0, 1ms]内，实际为%v", jitter)
+		}
+	}
+}
+
+// ==================
+// 7. API网关路由
+// ==================
+
+// headerMiddleware 给请求添加请求头的网关中间件，block为true时直接返回403
+type headerMiddleware struct {
+	name     string
+	priority int
+	block    bool
+	order    *[]string
+}
+
+func (hm *headerMiddleware) Process(request *Request, response *Response, next func()) {
+	*hm.order = append(*hm.order, hm.name)
+	if hm.block {
+		response.StatusCode = http.StatusForbidden
+		return
+	}
+	if request.Headers == nil {
+		request.Headers = make(map[string]string)
+	}
+	request.Headers["X-"+hm.name] = "1"
+	next()
+}
+
+func (hm *headerMiddleware) Priority() int { return hm.priority }
+func (hm *headerMiddleware) Name() string  { return hm.name }
+
+func newTestGateway(t *testing.T, transport UpstreamTransport, routes ...*Route) *APIGateway {
+	t.Helper()
+	gateway := NewAPIGatewayWithTransport(transport)
+	for _, route := range routes {
+		if err := gateway.AddRoute(route); err != nil {
+			t.Fatalf("添加路由%s失败: %v", route.PathPattern, err)
+		}
+	}
+	return gateway
+}
+
+func newBackendPool(ids ...string) *LoadBalancer {
+	lb := NewLoadBalancer()
+	for _, backend := range newTestBackends(ids...) {
+		lb.AddBackend(backend)
+	}
+	return lb
+}
+
+func TestAPIGatewayRouteMatching(t *testing.T) {
+	transport := newFakeTransport()
+	gateway := newTestGateway(t, transport,
+		&Route{Method: "GET", PathPattern: "/users/:id", Backend: newBackendPool("users")},
+		&Route{Method: "GET", PathPattern: "/users/me", Backend: newBackendPool("profile")},
+		&Route{Method: "GET", PathPattern: "/users/:id/orders/:orderID", Backend: newBackendPool("orders")},
+		&Route{PathPattern: "/static/*filepath", Backend: newBackendPool("assets")},
+		&Route{Method: "POST", PathPattern: "/users", Backend: newBackendPool("users")},
+	)
+
+	cases := []struct {
+		method, url, backend string
+		params               map[string]string
+	}{
+		{"GET", "/users/42", "users", map[string]string{"id": "42"}},
+		{"GET", "/users/me", "profile", map[string]string{}},
+		{"GET", "/users/42/orders/7?expand=true", "orders", map[string]string{"id": "42", "orderID": "7"}},
+		{"DELETE", "/static/css/site.css", "assets", map[string]string{"filepath": "css/site.css"}},
+		{"GET", "/static", "assets", map[string]string{"filepath": ""}},
+		{"post", "/users/", "users", map[string]string{}},
+	}
+	for _, tc := range cases {
+		request := &Request{Method: tc.method, URL: tc.url}
+		response, err := gateway.Handle(request)
+		if err != nil {
+			t.Fatalf("%s %s 转发失败: %v", tc.method, tc.url, err)
+		}
+		if string(response.Body) != tc.backend {
+			t.Errorf("%s %s 应转发到%s，实际为%s", tc.method, tc.url, tc.backend, response.Body)
+		}
+		if !reflect.DeepEqual(request.Params, tc.params) {
+			t.Errorf("%s %s 路径参数应为%v，实际为%v", tc.method, tc.url, tc.params, request.Params)
+		}
+	}
+}
+
+func TestAPIGatewayNotFoundAndMethodNotAllowed(t *testing.T) {
+	gateway := newTestGateway(t, newFakeTransport(),
+		&Route{Method: "GET", PathPattern: "/orders/:id", Backend: newBackendPool("orders")},
+		&Route{Method: "PUT", PathPattern: "/orders/:id", Backend: newBackendPool("orders")},
+	)
+
+	response, err := gateway.Handle(&Request{Method: "GET", URL: "/orders"})
+	if err != nil || response.StatusCode != http.StatusNotFound {
+		t.Errorf("不匹配的路径应返回404，实际为%v %v", response, err)
+	}
+	response, err = gateway.Handle(&Request{Method: "GET", URL: "/orders/1/items"})
+	if err != nil || response.StatusCode != http.StatusNotFound {
+		t.Errorf("多余的路径段应返回404，实际为%v %v", response, err)
+	}
+	response, err = gateway.Handle(&Request{Method: "DELETE", URL: "/orders/1"})
+	if err != nil || response.StatusCode != http.StatusMethodNotAllowed || response.Headers["Allow"] != "GET, PUT" {
+		t.Errorf("路径匹配但方法不符应返回405并列出允许的方法，实际为%+v %v", response, err)
+	}
+
+	if err := gateway.AddRoute(&Route{PathPattern: "/files/*/meta", Backend: newBackendPool("files")}); err == nil {
+		t.Error("通配段不在末尾的模式应被拒绝")
+	}
+	if err := gateway.AddRoute(&Route{PathPattern: "files", Backend: newBackendPool("files")}); err == nil {
+		t.Error("不以/开头的模式应被拒绝")
+	}
+}
+
+func TestAPIGatewayMiddlewareAndBackendFailure(t *testing.T) {
+	transport := newFakeTransport()
+	transport.failures["broken"] = errors.New("connection refused")
+	var order []string
+	pool := newBackendPool("api")
+	gateway := newTestGateway(t, transport,
+		&Route{Method: "GET", PathPattern: "/api/:version", Backend: pool,
+			Middleware: []GatewayMiddleware{&headerMiddleware{name: "Route", priority: 1, order: &order}}},
+		&Route{Method: "GET", PathPattern: "/admin", Backend: pool,
+			Middleware: []GatewayMiddleware{&headerMiddleware{name: "Guard", priority: 1, block: true, order: &order}}},
+		&Route{Method: "GET", PathPattern: "/broken", Backend: newBackendPool("broken")},
+	)
+	gateway.Use(&headerMiddleware{name: "Auth", priority: 10, order: &order})
+
+	request := &Request{Method: "GET", URL: "/api/v1"}
+	response, err := gateway.Handle(request)
+	if err != nil || string(response.Body) != "api" {
+		t.Fatalf("期望转发到api，实际为%v %v", response, err)
+	}
+	if !reflect.DeepEqual(order, []string{"Auth", "Route"}) || request.Headers["X-Route"] != "1" {
+		t.Errorf("中间件应按优先级执行，实际顺序为%v", order)
+	}
+
+	response, err = gateway.Handle(&Request{Method: "GET", URL: "/admin"})
+	if err != nil || response.StatusCode != http.StatusForbidden || transport.callCount("api") != 1 {
+		t.Errorf("中间件未调用next时不应转发，实际为%v %v", response, err)
+	}
+
+	_, err = gateway.Handle(&Request{Method: "GET", URL: "/broken"})
+	var proxyErr *ProxyError
+	if !errors.As(err, &proxyErr) || proxyErr.Upstream != "broken" {
+		t.Errorf("后端失败应返回ProxyError，实际为%v", err)
+	}
+}
+
+// ==================
+// 8. 会话亲和
+// ==================
+
+func TestStickySessionSourceIP(t *testing.T) {
+	lb := NewLoadBalancerWithConfig(LoadBalancerConfig{SessionAffinity: AffinitySourceIP, SessionTTL: time.Minute})
+	for _, backend := range newTestBackends("a", "b", "c") {
+		lb.AddBackend(backend)
+	}
+	client := func(ip string) *Request {
+		return &Request{Headers: map[string]string{"X-Forwarded-For": ip}}
+	}
+
+	first := lb.SelectBackend(client("10.0.0.1"))
+	for i := 0; i < 5; i++ {
+		if backend := lb.SelectBackend(client("10.0.0.1")); backend != first {
+			t.Fatalf("同一来源IP应固定到%s，实际为%s", first.id, backend.id)
+		}
+	}
+	if other := lb.SelectBackend(client("10.0.0.2")); other == first {
+		t.Errorf("新来源应按轮询分配到其他后端，实际仍为%s", other.id)
+	}
+
+	lb.ReportFailure(first, errors.New("down"))
+	lb.mutex.Lock()
+	first.healthy = false
+	lb.mutex.Unlock()
+	rebalanced := lb.SelectBackend(client("10.0.0.1"))
+	if rebalanced == nil || rebalanced == first {
+		t.Fatalf("绑定的后端不健康后应重新选择，实际为%v", rebalanced)
+	}
+	for i := 0; i < 3; i++ {
+		if backend := lb.SelectBackend(client("10.0.0.1")); backend != rebalanced {
+			t.Fatalf("重新选择后应固定到%s，实际为%s", rebalanced.id, backend.id)
+		}
+	}
+
+	lb.mutex.Lock()
+	first.healthy = true
+	lb.mutex.Unlock()
+	if backend := lb.SelectBackend(client("10.0.0.1")); backend != rebalanced {
+		t.Errorf("原后端恢复后会话仍应留在%s，实际为%s", rebalanced.id, backend.id)
+	}
+}
+
+func TestStickySessionCookieAndExpiry(t *testing.T) {
+	lb := NewLoadBalancerWithConfig(LoadBalancerConfig{SessionAffinity: AffinityCookie, SessionCookie: "sid", SessionTTL: 20 * time.Millisecond})
+	for _, backend := range newTestBackends("a", "b") {
+		lb.AddBackend(backend)
+	}
+
+	first, cookie := lb.SelectBackendWithSession(&Request{})
+	if !strings.HasPrefix(cookie, "sid=") {
+		t.Fatalf("新会话应签发sid Cookie，实际为%q", cookie)
+	}
+	session, _, _ := strings.Cut(cookie, ";")
+	withCookie := func() *Request {
+		return &Request{Headers: map[string]string{"Cookie": "theme=dark; " + session}}
+	}
+	for i := 0; i < 3; i++ {
+		backend, issued := lb.SelectBackendWithSession(withCookie())
+		if backend != first || issued != "" {
+			t.Fatalf("携带Cookie的请求应固定到%s且不重新签发，实际为%s %q", first.id, backend.id, issued)
+		}
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if backend := lb.SelectBackend(withCookie()); backend == first {
+		t.Errorf("会话过期后应重新按轮询选择，实际仍为%s", backend.id)
+	}
+
+	gateway := newTestGateway(t, newFakeTransport(), &Route{PathPattern: "/", Backend: lb})
+	response, err := gateway.Handle(&Request{Method: "GET", URL: "/"})
+	if err != nil || !strings.HasPrefix(response.Headers["Set-Cookie"], "sid=") {
+		t.Errorf("网关应把签发的会话Cookie写入响应，实际为%v %v", response, err)
+	}
+}
+
+// ==================
+// 9. 加权流量分割
+// ==================
+
+func TestTrafficManagerValidatesAndNormalizes(t *testing.T) {
+	manager := NewTrafficManager()
+	invalid := []*TrafficSplitPolicy{
+		{Splits: []TrafficSplit{{Subset: "v1", Weight: 90}, {Subset: "v2", Weight: -10}}},
+		{Splits: []TrafficSplit{{Subset: "v1", Weight: 0}, {Subset: "v2", Weight: 0}}},
+		{Splits: []TrafficSplit{{Subset: "v1", Weight: 1}, {Subset: "v1", Weight: 1}}},
+		{Splits: []TrafficSplit{{Weight: 1}}},
+	}
+	for _, policy := range invalid {
+		if err := manager.SetSplit("api", policy); err == nil {
+			t.Errorf("非法的分割%v应被拒绝", policy.Splits)
+		}
+	}
+	if _, ok := manager.SelectSubset("api", &Request{}); ok {
+		t.Error("校验失败时不应登记分割策略")
+	}
+
+	if err := manager.SetSplit("api", &TrafficSplitPolicy{Splits: []TrafficSplit{{Subset: "v1", Weight: 9}, {Subset: "v2", Weight: 1}, {Subset: "v3", Weight: 0}}}); err != nil {
+		t.Fatalf("设置分割失败: %v", err)
+	}
+	weights := manager.Weights("api")
+	if len(weights) != 2 || weights["v1"] < 0.8999 || weights["v1"] > 0.9001 || weights["v2"] < 0.0999 || weights["v2"] > 0.1001 {
+		t.Errorf("权重应归一化为v1:0.9 v2:0.1且忽略零权重子集，实际为%v", weights)
+	}
+}
+
+func TestTrafficManagerEmpiricalSplit(t *testing.T) {
+	manager := NewTrafficManager()
+	manager.SetSplit("random", &TrafficSplitPolicy{Splits: []TrafficSplit{{Subset: "v1", Weight: 90}, {Subset: "v2", Weight: 10}}})
+	manager.SetSplit("sticky", &TrafficSplitPolicy{Splits: []TrafficSplit{{Subset: "v1", Weight: 70}, {Subset: "v2", Weight: 30}}, Sticky: true})
+
+	const requests = 100000
+	counts := make(map[string]int)
+	for i := 0; i < requests; i++ {
+		subset, _ := manager.SelectSubset("random", &Request{})
+		counts[subset]++
+	}
+	if ratio := float64(counts["v2"]) / requests; ratio < 0.09 || ratio > 0.11 {
+		t.Errorf("随机分割中v2占比应接近10%%，实际为%.3f", ratio)
+	}
+
+	counts = make(map[string]int)
+	for i := 0; i < requests; i++ {
+		client := &Request{Source: fmt.Sprintf("client-%d", i)}
+		subset, _ := manager.SelectSubset("sticky", client)
+		counts[subset]++
+		if i%1000 == 0 {
+			if again, _ := manager.SelectSubset("sticky", client); again != subset {
+				t.Fatalf("粘性分割下同一客户端应始终落在%s，实际为%s", subset, again)
+			}
+		}
+	}
+	if ratio := float64(counts["v2"]) / requests; ratio < 0.29 || ratio > 0.31 {
+		t.Errorf("粘性分割中v2占比应接近30%%，实际为%.3f", ratio)
+	}
+}
+
+func TestServiceProxyCanarySplit(t *testing.T) {
+	transport := newFakeTransport()
+	proxy := NewServiceProxy("checkout", ProxyConfig{}, transport)
+	proxy.AddUpstream(&UpstreamService{ID: "stable-a", Subset: "v1"})
+	proxy.AddUpstream(&UpstreamService{ID: "stable-b", Subset: "v1"})
+	proxy.AddUpstream(&UpstreamService{ID: "canary", Subset: "v2"})
+
+	mesh := NewServiceMesh()
+	mesh.config.TrafficSplitting = true
+	mesh.RegisterProxy(proxy)
+	if err := mesh.SetTrafficSplit("checkout", &TrafficSplitPolicy{Splits: []TrafficSplit{{Subset: "v1", Weight: 90}, {Subset: "v2", Weight: 10}}}); err != nil {
+		t.Fatalf("设置分割失败: %v", err)
+	}
+
+	const requests = 20000
+	for i := 0; i < requests; i++ {
+		if _, err := mesh.Forward("checkout", &Request{Method: "GET", URL: "/"}); err != nil {
+			t.Fatalf("转发失败: %v", err)
+		}
+	}
+	if ratio := float64(transport.callCount("canary")) / requests; ratio < 0.085 || ratio > 0.115 {
+		t.Errorf("金丝雀流量占比应接近10%%，实际为%.3f", ratio)
+	}
+	if diff := transport.callCount("stable-a") - transport.callCount("stable-b"); diff < -1 || diff > 1 {
+		t.Errorf("v1子集内应平均分配，实际为%d和%d", transport.callCount("stable-a"), transport.callCount("stable-b"))
+	}
+
+	proxy.HealthChecker().SetStatus("canary", HealthStatusUnhealthy)
+	before := transport.callCount("stable-a") + transport.callCount("stable-b")
+	for i := 0; i < 100; i++ {
+		if _, err := mesh.Forward("checkout", &Request{Method: "GET", URL: "/"}); err != nil {
+			t.Fatalf("金丝雀不可用时应退回其他子集，实际为%v", err)
+		}
+	}
+	if after := transport.callCount("stable-a") + transport.callCount("stable-b"); after-before != 100 {
+		t.Errorf("金丝雀不可用时全部流量应由v1处理，实际为%d", after-before)
+	}
+}
+
+// ==================
+// 10. 分布式链路跟踪
+// ==================
+
+// transportFunc 把函数适配为上游传输层，用于模拟上游服务的处理逻辑
+type transportFunc func(ctx context.Context, upstream *UpstreamService, request *Request) (*Response, error)
+
+func (f transportFunc) RoundTrip(ctx context.Context, upstream *UpstreamService, request *Request) (*Response, error) {
+	return f(ctx, upstream, request)
+}
+
+// exportedSpans 按名称索引导出的span
+func exportedSpans(t *testing.T, exporter *InMemoryTraceExporter) map[string]*Span {
+	t.Helper()
+	spans := make(map[string]*Span)
+	for _, span := range exporter.Spans() {
+		if span.End.Before(span.Start) {
+			t.Errorf("span %s 的结束时间早于开始时间", span.Name)
+		}
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestTracingPropagatesAcrossServiceHops(t *testing.T) {
+	tracer := NewTracingSystem()
+	exporter := NewInMemoryTraceExporter()
+	tracer.AddExporter(exporter)
+
+	// 服务B记录收到的traceparent
+	var receivedByB string
+	proxyB := NewServiceProxy("service-b", ProxyConfig{}, transportFunc(func(ctx context.Context, upstream *UpstreamService, request *Request) (*Response, error) {
+		receivedByB = request.Headers[TraceparentHeader]
+		return &Response{StatusCode: http.StatusOK}, nil
+	}))
+	proxyB.AddUpstream(&UpstreamService{ID: "b-1", Weight: 1})
+	proxyB.SetTracer(tracer)
+
+	// 服务A从请求头恢复上下文，在自己的span内经代理调用服务B
+	serviceA := transportFunc(func(ctx context.Context, upstream *UpstreamService, request *Request) (*Response, error) {
+		ctx, err := ExtractTraceparent(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		ctx, span := tracer.StartSpan(ctx, "service-a")
+		defer tracer.Finish(span)
+
+		downstream := &Request{Method: "GET", URL: "/inventory"}
+		InjectTraceparent(ctx, downstream)
+		return proxyB.Forward(downstream)
+	})
+	gateway := newTestGateway(t, serviceA, &Route{Method: "GET", PathPattern: "/orders/:id", Backend: newBackendPool("a-1")})
+	gateway.SetTracer(tracer)
+
+	client := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	response, err := gateway.Handle(&Request{Method: "GET", URL: "/orders/7", Headers: map[string]string{TraceparentHeader: client}})
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("请求失败: %v %+v", err, response)
+	}
+
+	spans := exportedSpans(t, exporter)
+	gatewaySpan, serviceSpan, proxySpan := spans["gateway GET"], spans["service-a"], spans["proxy service-b"]
+	if gatewaySpan == nil || serviceSpan == nil || proxySpan == nil {
+		t.Fatalf("期望导出网关、服务A和代理三个span，实际为%v", spans)
+	}
+	for _, span := range []*Span{gatewaySpan, serviceSpan, proxySpan} {
+		if span.TraceID != "0af7651916cd43dd8448eb211c80319c" {
+			t.Errorf("span %s 应延续客户端的跟踪，实际跟踪ID为%s", span.Name, span.TraceID)
+		}
+	}
+	if gatewaySpan.ParentID != "b7ad6b7169203331" || serviceSpan.ParentID != gatewaySpan.SpanID || proxySpan.ParentID != serviceSpan.SpanID {
+		t.Errorf("父子关系错误: gateway<-%s service-a<-%s proxy<-%s", gatewaySpan.ParentID, serviceSpan.ParentID, proxySpan.ParentID)
+	}
+	if expected := FormatTraceparent(proxySpan); receivedByB != expected {
+		t.Errorf("服务B应收到代理span的上下文%s，实际为%s", expected, receivedByB)
+	}
+	if gatewaySpan.Tags["route"] != "/orders/:id" || gatewaySpan.Tags["status"] != "200" || proxySpan.Tags["upstream"] != "b-1" {
+		t.Errorf("span标签不完整: %v %v", gatewaySpan.Tags, proxySpan.Tags)
+	}
+	if tracer.ActiveSpans() != 0 {
+		t.Errorf("所有span应已结束，仍有%d个活跃", tracer.ActiveSpans())
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	tracer := NewTracingSystem()
+	ctx, span := tracer.StartSpan(context.Background(), "root")
+	if span.ParentID != "" || len(span.TraceID) != 32 || len(span.SpanID) != 16 || !span.Sampled() {
+		t.Fatalf("根span标识不合法: %+v", span)
+	}
+
+	request := &Request{}
+	InjectTraceparent(ctx, request)
+	extracted, err := ExtractTraceparent(context.Background(), request)
+	if err != nil {
+		t.Fatalf("解析traceparent失败: %v", err)
+	}
+	remote := SpanFromContext(extracted)
+	if remote.TraceID != span.TraceID || remote.SpanID != span.SpanID || !remote.Sampled() {
+		t.Errorf("往返后上下文不一致: %+v", remote)
+	}
+	if header := FormatTraceparent(remote); header != request.Headers[TraceparentHeader] {
+		t.Errorf("再次格式化应得到相同的头，实际为%s", header)
+	}
+
+	// 没有traceparent时上下文保持不变
+	if ctx, err := ExtractTraceparent(context.Background(), &Request{}); err != nil || SpanFromContext(ctx) != nil {
+		t.Errorf("缺少请求头时不应产生父span: %v", err)
+	}
+
+	for _, header := range []string{
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		"00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-xy",
+	} {
+		if _, err := ParseTraceparent(header); err == nil {
+			t.Errorf("期望拒绝%q", header)
+		}
+	}
+	if _, err := ParseTraceparent("01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-future"); err != nil {
+		t.Errorf("未来版本允许附加字段: %v", err)
+	}
+}
+
+func TestTracingUnsampledAndMalformedContext(t *testing.T) {
+	tracer := NewTracingSystem()
+	exporter := NewInMemoryTraceExporter()
+	tracer.AddExporter(exporter)
+
+	var forwarded string
+	gateway := newTestGateway(t, transportFunc(func(ctx context.Context, upstream *UpstreamService, request *Request) (*Response, error) {
+		forwarded = request.Headers[TraceparentHeader]
+		return &Response{StatusCode: http.StatusOK}, nil
+	}), &Route{PathPattern: "/", Backend: newBackendPool("root")})
+	gateway.SetTracer(tracer)
+
+	// 未采样的跟踪照常传播标志，但不导出
+	unsampled := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"
+	if _, err := gateway.Handle(&Request{Method: "GET", URL: "/", Headers: map[string]string{TraceparentHeader: unsampled}}); err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	if !strings.HasPrefix(forwarded, "00-0af7651916cd43dd8448eb211c80319c-") || !strings.HasSuffix(forwarded, "-00") {
+		t.Errorf("应向后端传播未采样的跟踪，实际为%s", forwarded)
+	}
+	if len(exporter.Spans()) != 0 {
+		t.Errorf("未采样的span不应导出，实际导出%d个", len(exporter.Spans()))
+	}
+
+	// 格式错误的请求头被忽略，开始新的跟踪
+	if _, err := gateway.Handle(&Request{Method: "GET", URL: "/", Headers: map[string]string{TraceparentHeader: "garbage"}}); err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	spans := exporter.Spans()
+	if len(spans) != 1 || spans[0].ParentID != "" || forwarded != FormatTraceparent(spans[0]) {
+		t.Errorf("格式错误的上下文应开始新的根span，实际为%+v", spans)
+	}
+
+	// 重复结束不会重复导出
+	tracer.Finish(spans[0])
+	if len(exporter.Spans()) != 1 {
+		t.Error("已结束的span不应再次导出")
+	}
+}
+
+// ==================
+// 11. Prometheus指标导出
+// ==================
+
+// promSample 解析得到的样本
+type promSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+var promSampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(?:\{(.*)\})? (\S+)$`)
+var promLabelPair = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\]|\\.)*)"`)
+
+// parseExposition 按文本格式解析导出结果，要求每个样本前已声明其指标的TYPE
+func parseExposition(t *testing.T, text string) (map[string]string, []promSample) {
+	t.Helper()
+	types := make(map[string]string)
+	var samples []promSample
+	for i, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if fields := strings.Fields(line); len(fields) == 4 && fields[0] == "#" && fields[1] == "TYPE" {
+			types[fields[2]] = fields[3]
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		match := promSampleLine.FindStringSubmatch(line)
+		if match == nil {
+			t.Fatalf("第%d行格式错误: %q", i+1, line)
+		}
+		value, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			t.Fatalf("第%d行的值无法解析: %q", i+1, line)
+		}
+		labels := make(map[string]string)
+		for _, pair := range promLabelPair.FindAllStringSubmatch(match[2], -1) {
+			labels[pair[1]] = pair[2]
+		}
+		family := match[1]
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if base := strings.TrimSuffix(family, suffix); base != family && types[base] == "histogram" {
+				family = base
+			}
+		}
+		if _, declared := types[family]; !declared {
+			t.Fatalf("第%d行的指标%s没有TYPE声明", i+1, match[1])
+		}
+		samples = append(samples, promSample{name: match[1], labels: labels, value: value})
+	}
+	return types, samples
+}
+
+// findSample 返回名称和标签完全匹配的样本
+func findSample(samples []promSample, name string, labels map[string]string) (float64, bool) {
+	for _, sample := range samples {
+		if sample.name == name && reflect.DeepEqual(sample.labels, labels) {
+			return sample.value, true
+		}
+	}
+	return 0, false
+}
+
+func TestExpositionRendersMeshAndLoadBalancerMetrics(t *testing.T) {
+	transport := newFakeTransport()
+	transport.failures["pay-1"] = errors.New("connection refused")
+	mesh := NewServiceMesh()
+	for _, service := range []string{"orders", "payments"} {
+		proxy := NewServiceProxy(service, ProxyConfig{}, transport)
+		proxy.AddUpstream(&UpstreamService{ID: map[string]string{"orders": "orders-1", "payments": "pay-1"}[service], Weight: 1})
+		mesh.RegisterProxy(proxy)
+	}
+	for i := 0; i < 3; i++ {
+		mesh.Forward("orders", &Request{Method: "GET", URL: "/"})
+	}
+	mesh.Forward("payments", &Request{Method: "GET", URL: "/"})
+
+	lb := newBackendPool("b", "a")
+	lb.backends[0].connections, lb.backends[1].connections = 2, 5
+	lb.backends[0].errorRate = 0.25
+	lb.backends[1].healthy = false
+	lb.SelectBackend(&Request{})
+
+	exposition := NewExposition(mesh)
+	exposition.AddLoadBalancer("edge", lb)
+	server := httptest.NewServer(exposition)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("抓取指标失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type应为Prometheus文本格式，实际为%s", contentType)
+	}
+	var body strings.Builder
+	if _, err := io.Copy(&body, resp.Body); err != nil {
+		t.Fatalf("读取响应失败: %v", err)
+	}
+
+	types, samples := parseExposition(t, body.String())
+	expectedTypes := map[string]string{
+		"mesh_requests_total":                     "counter",
+		"mesh_request_success_ratio":              "gauge",
+		"mesh_request_duration_seconds":           "histogram",
+		"proxy_requests_total":                    "counter",
+		"proxy_errors_total":                      "counter",
+		"proxy_request_duration_seconds":          "histogram",
+		"loadbalancer_requests_total":             "counter",
+		"loadbalancer_failed_requests_total":      "counter",
+		"loadbalancer_active_connections":         "gauge",
+		"loadbalancer_backend_active_connections": "gauge",
+		"loadbalancer_backend_error_rate":         "gauge",
+		"loadbalancer_backend_healthy":            "gauge",
+	}
+	if !reflect.DeepEqual(types, expectedTypes) {
+		t.Errorf("指标类型不符:\n期望%v\n实际%v", expectedTypes, types)
+	}
+
+	checks := []struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{"mesh_requests_total", map[string]string{}, 4},
+		{"mesh_request_success_ratio", map[string]string{}, 0.75},
+		{"mesh_request_duration_seconds_count", map[string]string{}, 4},
+		{"mesh_request_duration_seconds_bucket", map[string]string{"le": "+Inf"}, 4},
+		{"proxy_requests_total", map[string]string{"service": "orders"}, 3},
+		{"proxy_errors_total", map[string]string{"service": "payments"}, 1},
+		{"proxy_request_duration_seconds_count", map[string]string{"service": "orders"}, 3},
+		{"proxy_request_duration_seconds_bucket", map[string]string{"service": "payments", "le": "+Inf"}, 1},
+		{"loadbalancer_requests_total", map[string]string{"lb": "edge"}, 1},
+		{"loadbalancer_active_connections", map[string]string{"lb": "edge"}, 7},
+		{"loadbalancer_backend_active_connections", map[string]string{"lb": "edge", "backend": "a"}, 5},
+		{"loadbalancer_backend_error_rate", map[string]string{"lb": "edge", "backend": "b"}, 0.25},
+		{"loadbalancer_backend_healthy", map[string]string{"lb": "edge", "backend": "a"}, 0},
+		{"loadbalancer_backend_healthy", map[string]string{"lb": "edge", "backend": "b"}, 1},
+	}
+	for _, check := range checks {
+		if value, ok := findSample(samples, check.name, check.labels); !ok || value != check.value {
+			t.Errorf("%s%v 期望%v，实际为%v(存在=%v)", check.name, check.labels, check.value, value, ok)
+		}
+	}
+
+	// 直方图桶累积且不减，标签只包含服务、负载均衡器、后端和le
+	previous := map[string]float64{}
+	for _, sample := range samples {
+		for key := range sample.labels {
+			if key != "service" && key != "lb" && key != "backend" && key != "le" {
+				t.Errorf("%s 使用了意外的标签%s", sample.name, key)
+			}
+		}
+		if strings.HasSuffix(sample.name, "_bucket") {
+			series := sample.name + "/" + sample.labels["service"]
+			if sample.value < previous[series] {
+				t.Errorf("%s 的桶计数递减", series)
+			}
+			previous[series] = sample.value
+		}
+	}
+
+	if resp, err := http.Post(server.URL, "text/plain", nil); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("非GET请求应返回405")
+	} else {
+		resp.Body.Close()
+	}
+}
+
+func TestLatencyHistogramBuckets(t *testing.T) {
+	histogram := NewLatencyHistogram(100*time.Millisecond, 10*time.Millisecond, 100*time.Millisecond)
+	for _, latency := range []time.Duration{time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond, time.Second} {
+		histogram.Observe(latency)
+	}
+	snapshot := histogram.Snapshot()
+	if !reflect.DeepEqual(snapshot.Bounds, []time.Duration{10 * time.Millisecond, 100 * time.Millisecond}) {
+		t.Errorf("上界应排序去重，实际为%v", snapshot.Bounds)
+	}
+	if !reflect.DeepEqual(snapshot.Cumulative, []uint64{2, 3}) || snapshot.Count != 4 || snapshot.Sum != 1061*time.Millisecond {
+		t.Errorf("直方图快照错误: %+v", snapshot)
+	}
+
+	var buf strings.Builder
+	NewExposition(nil).WriteTo(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("没有数据源时不应输出指标，实际为%q", buf.String())
+	}
+
+	var escaped bytes.Buffer
+	writeSample(&escaped, "m", []string{"service", "a\"b\\c\nd"}, 1)
+	if escaped.String() != `m{service="a\"b\\c\nd"} 1`+"\n" {
+		t.Errorf("标签值未正确转义: %q", escaped.String())
+	}
+}
+
+// ==================
+// 12. 一致性哈希分片
+// ==================
+
+func newShardedDistributor(t *testing.T, shards ...ShardID) *KeyDistributor {
+	t.Helper()
+	distributor := NewKeyDistributor(0)
+	for _, shard := range shards {
+		if err := distributor.AddShard(shard); err != nil {
+			t.Fatalf("添加分片%s失败: %v", shard, err)
+		}
+	}
+	return distributor
+}
+
+func TestKeyDistributorEvenDistribution(t *testing.T) {
+	distributor := newShardedDistributor(t, "s1", "s2", "s3", "s4")
+	const keys = 40000
+	for i := 0; i < keys; i++ {
+		distributor.AssignShard("user:" + strconv.Itoa(i))
+	}
+
+	stats := distributor.Stats()
+	if stats.TotalKeys != keys || len(stats.Shards) != 4 {
+		t.Fatalf("期望4个分片共%d个键，实际为%+v", keys, stats)
+	}
+	ownership := 0.0
+	for shard, load := range stats.Shards {
+		if share := float64(load.Keys) / keys; share < 0.2 || share > 0.3 {
+			t.Errorf("分片%s分到%.3f的键，期望接近0.25", shard, share)
+		}
+		ownership += load.Ownership
+	}
+	if math.Abs(ownership-1) > 1e-9 {
+		t.Errorf("各分片的哈希空间比例之和应为1，实际为%v", ownership)
+	}
+	if stats.Imbalance < 1 || stats.Imbalance > 1.2 {
+		t.Errorf("负载不均衡度应接近1，实际为%.3f", stats.Imbalance)
+	}
+
+	if err := distributor.AddShard("s1"); err == nil {
+		t.Error("重复添加分片应失败")
+	}
+	if err := distributor.RemoveShard("s9"); err == nil {
+		t.Error("移除不存在的分片应失败")
+	}
+	if shard := NewKeyDistributor(0).AssignShard("k"); shard != "" {
+		t.Errorf("没有分片时应返回空ID，实际为%s", shard)
+	}
+}
+
+func TestKeyDistributorMinimalRemapAndRebalance(t *testing.T) {
+	distributor := newShardedDistributor(t, "s1", "s2", "s3", "s4")
+	resharding := NewReshardingManager(distributor)
+
+	const keys = 20000
+	before := make([]ShardID, keys)
+	for i := range before {
+		before[i] = distributor.AssignShard("key-" + strconv.Itoa(i))
+	}
+
+	if err := distributor.AddShard("s5"); err != nil {
+		t.Fatalf("添加分片失败: %v", err)
+	}
+	moves := resharding.Rebalance()
+	if len(moves) == 0 {
+		t.Fatal("添加分片后应报告迁移区间")
+	}
+	for _, move := range moves {
+		if move.To != "s5" || move.From == "s5" {
+			t.Errorf("添加分片只应把区间迁往新分片，实际为%+v", move)
+		}
+	}
+
+	moved := 0
+	for i, old := range before {
+		key := "key-" + strconv.Itoa(i)
+		current := distributor.AssignShard(key)
+		inMovedRange := false
+		for _, move := range moves {
+			if move.ContainsKey(key) {
+				inMovedRange = true
+				if move.From != old || move.To != current {
+					t.Fatalf("键%s应从%s迁往%s，区间记录为%+v", key, old, current, move)
+				}
+			}
+		}
+		if current != old {
+			moved++
+			if current != "s5" {
+				t.Fatalf("键%s从%s迁往了非新增分片%s", key, old, current)
+			}
+		}
+		if inMovedRange != (current != old) {
+			t.Fatalf("键%s的迁移与区间报告不一致", key)
+		}
+	}
+	if ratio := float64(moved) / keys; ratio < 0.15 || ratio > 0.25 {
+		t.Errorf("新增第5个分片应迁移约1/5的键，实际为%.3f", ratio)
+	}
+
+	// 没有变化时不迁移；移除分片后其区间交还给其余分片
+	if moves := resharding.Rebalance(); len(moves) != 0 {
+		t.Errorf("分片未变化时不应迁移，实际为%v", moves)
+	}
+	if err := distributor.RemoveShard("s5"); err != nil {
+		t.Fatalf("移除分片失败: %v", err)
+	}
+	for _, move := range resharding.Rebalance() {
+		if move.From != "s5" {
+			t.Errorf("移除分片只应迁出其区间，实际为%+v", move)
+		}
+	}
+	for i, old := range before {
+		if current := distributor.AssignShard("key-" + strconv.Itoa(i)); current != old {
+			t.Fatalf("移除新增分片后键应回到原分片%s，实际为%s", old, current)
+		}
+	}
+}
+
+func TestShardingManagerWiresDistributor(t *testing.T) {
+	manager := NewShardingManager()
+	if manager.keyDistributor == nil || manager.reshardingManager == nil || manager.reshardingManager.distributor != manager.keyDistributor {
+		t.Error("分片管理器应使用同一个键分配器进行再平衡")
+	}
+}
+
+// ==================
+// 13. 自动扩缩容
+// ==================
+
+// scriptedMetrics 按顺序返回预设的CPU使用率
+type scriptedMetrics struct {
+	samples []float64
+	err     error
+}
+
+func (sm *scriptedMetrics) CPUPercent(target string) (float64, error) {
+	if sm.err != nil {
+		return 0, sm.err
+	}
+	sample := sm.samples[0]
+	sm.samples = sm.samples[1:]
+	return sample, nil
+}
+
+// recordingScaler 记录编排器收到的副本数
+type recordingScaler struct {
+	calls []int32
+	err   error
+}
+
+func (rs *recordingScaler) ScaleDeployment(deploymentID string, replicas int32) error {
+	if rs.err != nil {
+		return rs.err
+	}
+	rs.calls = append(rs.calls, replicas)
+	return nil
+}
+
+type scaleEventRecorder struct {
+	events []ScalingEvent
+}
+
+func (r *scaleEventRecorder) OnScale(event ScalingEvent) { r.events = append(r.events, event) }
+
+func TestAutoScalerTargetTrackingWithCooldown(t *testing.T) {
+	metrics := &scriptedMetrics{samples: []float64{
+		90,  // 4*90/60=6
+		95,  // 需要扩容，但仍在扩容冷却期内
+		120, // 冷却结束：6*120/60=12，受上限10限制
+		64,  // 偏差在10%容忍度内
+		15,  // 缩容冷却5分钟内
+		15,  // 10*15/60=2.5 -> 3
+		5,   // 3*5/60向上取整为1，受下限2限制
+	}}
+	scaler := &recordingScaler{}
+	recorder := &scaleEventRecorder{}
+	autoScaler := NewAutoScaler()
+	autoScaler.SetMetricSource(metrics)
+	autoScaler.SetReplicaScaler(scaler)
+	autoScaler.AddListener(recorder)
+	if err := autoScaler.AddTarget(&ScalingTarget{Name: "api", MinReplicas: 2, MaxReplicas: 10, TargetCPU: 60, CurrentReplicas: 4}); err != nil {
+		t.Fatalf("添加目标失败: %v", err)
+	}
+
+	start := time.Unix(0, 0)
+	steps := []struct {
+		offset time.Duration
+		want   int // 期望扩缩容后的副本数，0表示不扩缩容
+	}{
+		{0, 6},
+		{30 * time.Second, 0},
+		{2 * time.Minute, 10},
+		{3 * time.Minute, 0},
+		{4 * time.Minute, 0},
+		{8 * time.Minute, 3},
+		{14 * time.Minute, 2},
+	}
+	for i, step := range steps {
+		event, err := autoScaler.evaluate("api", start.Add(step.offset))
+		if err != nil {
+			t.Fatalf("第%d步评估失败: %v", i+1, err)
+		}
+		got := 0
+		if event != nil {
+			got = event.ToReplicas
+		}
+		if got != step.want {
+			t.Errorf("第%d步期望扩缩容到%d，实际为%d", i+1, step.want, got)
+		}
+	}
+
+	if !reflect.DeepEqual(scaler.calls, []int32{6, 10, 3, 2}) {
+		t.Errorf("编排器收到的副本数错误: %v", scaler.calls)
+	}
+	if len(recorder.events) != 4 || recorder.events[0].FromReplicas != 4 || recorder.events[1].Utilization != 120 {
+		t.Errorf("扩缩容事件错误: %+v", recorder.events)
+	}
+	if !reflect.DeepEqual(autoScaler.History(), recorder.events) {
+		t.Error("历史记录应与发出的事件一致")
+	}
+	stats := autoScaler.Statistics()
+	if stats.Evaluations != 7 || stats.ScaleUps != 2 || stats.ScaleDowns != 2 || stats.Suppressed != 2 {
+		t.Errorf("统计错误: %+v", stats)
+	}
+}
+
+func TestAutoScalerErrorsAndDisabled(t *testing.T) {
+	autoScaler := NewAutoScaler()
+	for _, target := range []*ScalingTarget{
+		{Name: "a", MinReplicas: 0, MaxReplicas: 3, TargetCPU: 50},
+		{Name: "a", MinReplicas: 3, MaxReplicas: 2, TargetCPU: 50},
+		{Name: "a", MinReplicas: 1, MaxReplicas: 2, TargetCPU: 0},
+	} {
+		if err := autoScaler.AddTarget(target); err == nil {
+			t.Errorf("期望拒绝非法目标%+v", target)
+		}
+	}
+	if err := autoScaler.AddTarget(&ScalingTarget{Name: "api", MinReplicas: 2, MaxReplicas: 5, TargetCPU: 50, CurrentReplicas: 9}); err != nil {
+		t.Fatalf("添加目标失败: %v", err)
+	}
+	if _, err := autoScaler.Evaluate("api"); err == nil {
+		t.Error("缺少指标来源和编排器时应报错")
+	}
+
+	scaler := &recordingScaler{err: errors.New("deployment not found")}
+	autoScaler.SetMetricSource(&scriptedMetrics{samples: []float64{20}}) // 副本数先被限制为5，再缩容到2
+	autoScaler.SetReplicaScaler(scaler)
+	if _, err := autoScaler.Evaluate("api"); err == nil || !strings.Contains(err.Error(), "deployment not found") {
+		t.Errorf("编排器失败时应返回错误，实际为%v", err)
+	}
+	if history := autoScaler.History(); len(history) != 0 {
+		t.Errorf("扩缩容失败时不应记录事件: %v", history)
+	}
+
+	// 架构师配置关闭自动扩缩容时不做调整
+	architect := NewDistributedSystemArchitect(ArchitectConfig{AutoScalingEnabled: false})
+	architect.autoScaler.SetMetricSource(&scriptedMetrics{samples: []float64{100}})
+	architect.autoScaler.SetReplicaScaler(&recordingScaler{})
+	architect.autoScaler.AddTarget(&ScalingTarget{Name: "api", MinReplicas: 1, MaxReplicas: 5, TargetCPU: 50, CurrentReplicas: 1})
+	if event, err := architect.autoScaler.Evaluate("api"); err != nil || event != nil {
+		t.Errorf("关闭自动扩缩容时不应调整，实际为%v %v", event, err)
+	}
+}
+
+// ==================
+// 14. 消息代理发布订阅
+// ==================
+
+// newTestBroker 创建测试结束时自动关闭的消息代理
+func newTestBroker(t *testing.T, config BrokerConfig) *MessageBroker {
+	t.Helper()
+	broker := NewMessageBroker()
+	broker.SetConfig(config)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		broker.Close(ctx)
+	})
+	return broker
+}
+
+// receive 在超时内从通道读取一条消息
+func receive(t *testing.T, ch <-chan Message) Message {
+	t.Helper()
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			t.Fatal("订阅通道已关闭")
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("等待消息超时")
+	}
+	return Message{}
+}
+
+func assertNoMessage(t *testing.T, ch <-chan Message) {
+	t.Helper()
+	select {
+	case msg, ok := <-ch:
+		if ok {
+			t.Fatalf("不应收到消息，实际收到 %s", msg.Topic)
+		}
+	default:
+	}
+}
+
+func TestMessageBrokerFanOut(t *testing.T) {
+	broker := newTestBroker(t, DefaultBrokerConfig())
+	first, _ := broker.Subscribe("orders.created")
+	second, _ := broker.Subscribe("orders.created")
+	other, _ := broker.Subscribe("orders.cancelled")
+
+	if err := broker.Publish("orders.created", Message{Payload: []byte("o-1")}); err != nil {
+		t.Fatalf("发布失败: %v", err)
+	}
+
+	for i, ch := range []<-chan Message{first, second} {
+		msg := receive(t, ch)
+		if string(msg.Payload) != "o-1" || msg.Topic != "orders.created" || msg.ID == "" || msg.Attempt != 1 {
+			t.Errorf("订阅者%d收到的消息不正确: %+v", i+1, msg)
+		}
+		msg.Ack()
+	}
+	assertNoMessage(t, other)
+
+	stats := broker.Statistics()
+	if stats.Published != 1 || stats.Delivered != 2 || stats.Acked != 2 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+}
+
+func TestMessageBrokerWildcardTopics(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.created.v2", false},
+		{"orders.*", "orders", false},
+		{"*.created", "users.created", true},
+		{"*.*", "a.b", true},
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.cancelled", false},
+	}
+	for _, tt := range tests {
+		if got := topicMatches(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("topicMatches(%q, %q) = %v, 期望 %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+
+	broker := newTestBroker(t, DefaultBrokerConfig())
+	wildcard, _ := broker.Subscribe("orders.*")
+	for _, topic := range []string{"orders.created", "users.created", "orders.paid"} {
+		if err := broker.Publish(topic, Message{}); err != nil {
+			t.Fatalf("发布 %s 失败: %v", topic, err)
+		}
+	}
+	if got := receive(t, wildcard).Topic; got != "orders.created" {
+		t.Errorf("第一条消息主题 = %s, 期望 orders.created", got)
+	}
+	if got := receive(t, wildcard).Topic; got != "orders.paid" {
+		t.Errorf("第二条消息主题 = %s, 期望 orders.paid", got)
+	}
+	assertNoMessage(t, wildcard)
+
+	if err := broker.Publish("orders.*", Message{}); !errors.Is(err, ErrInvalidTopic) {
+		t.Errorf("向通配主题发布应返回ErrInvalidTopic，实际 %v", err)
+	}
+	if ch, _ := broker.Subscribe("orders..created"); !receiveClosed(ch) {
+		t.Error("非法订阅主题应返回已关闭的通道")
+	}
+}
+
+// receiveClosed 判断通道是否已关闭且没有剩余消息
+func receiveClosed(ch <-chan Message) bool {
+	select {
+	case _, ok := <-ch:
+		return !ok
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func TestMessageBrokerUnsubscribe(t *testing.T) {
+	broker := newTestBroker(t, DefaultBrokerConfig())
+	ch, unsubscribe := broker.Subscribe("events.*")
+	kept, _ := broker.Subscribe("events.*")
+
+	unsubscribe()
+	unsubscribe() // 重复取消无副作用
+	if !receiveClosed(ch) {
+		t.Fatal("取消订阅后通道应被关闭")
+	}
+
+	if err := broker.Publish("events.login", Message{}); err != nil {
+		t.Fatalf("发布失败: %v", err)
+	}
+	receive(t, kept).Ack()
+	if stats := broker.Statistics(); stats.Delivered != 1 {
+		t.Errorf("取消订阅后仍有投递: %+v", stats)
+	}
+}
+
+func TestMessageBrokerSlowConsumerBackpressure(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.SubscriberBuffer = 2
+	config.PublishTimeout = 20 * time.Millisecond
+	broker := newTestBroker(t, config)
+	slow, _ := broker.Subscribe("metrics.cpu")
+	fast, _ := broker.Subscribe("metrics.cpu")
+
+	go func() {
+		for msg := range fast {
+			msg.Ack()
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		if err := broker.Publish("metrics.cpu", Message{}); err != nil {
+			t.Fatalf("缓冲未满时发布失败: %v", err)
+		}
+	}
+	start := time.Now()
+	err := broker.Publish("metrics.cpu", Message{})
+	if !errors.Is(err, ErrSubscriberFull) {
+		t.Fatalf("慢消费者缓冲已满时应返回ErrSubscriberFull，实际 %v", err)
+	}
+	if waited := time.Since(start); waited < config.PublishTimeout {
+		t.Errorf("发布应等待PublishTimeout后再放弃，实际等待 %v", waited)
+	}
+
+	// 慢消费者腾出空位后，阻塞中的发布应完成投递
+	done := make(chan error, 1)
+	broker.SetConfig(BrokerConfig{SubscriberBuffer: 2, AckTimeout: time.Minute, MaxDeliveries: 5})
+	go func() { done <- broker.Publish("metrics.cpu", Message{Payload: []byte("late")}) }()
+	receive(t, slow).Ack()
+	if err := <-done; err != nil {
+		t.Fatalf("腾出空位后发布失败: %v", err)
+	}
+
+	stats := broker.Statistics()
+	if stats.Backpressured != 1 || stats.Delivered != 7 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+}
+
+func TestMessageBrokerRedeliversUnacked(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.AckTimeout = time.Minute
+	config.MaxDeliveries = 2
+	broker := newTestBroker(t, config)
+	ch, _ := broker.Subscribe("jobs.run")
+
+	if err := broker.Publish("jobs.run", Message{ID: "job-1"}); err != nil {
+		t.Fatalf("发布失败: %v", err)
+	}
+	first := receive(t, ch)
+
+	now := time.Now()
+	if n := broker.redeliverExpired(now); n != 0 {
+		t.Fatalf("确认超时前不应重投，实际重投 %d 条", n)
+	}
+	if n := broker.redeliverExpired(now.Add(2 * time.Minute)); n != 1 {
+		t.Fatalf("确认超时后应重投1条，实际 %d", n)
+	}
+	second := receive(t, ch)
+	if second.ID != "job-1" || second.Attempt != 2 {
+		t.Fatalf("重投消息不正确: %+v", second)
+	}
+
+	// 达到最大投递次数后进入死信，旧投递的确认不再生效
+	broker.redeliverExpired(now.Add(5 * time.Minute))
+	first.Ack()
+	assertNoMessage(t, ch)
+	dead := broker.DeadLetters()
+	if len(dead) != 1 || dead[0].ID != "job-1" {
+		t.Fatalf("死信不正确: %+v", dead)
+	}
+	if stats := broker.Statistics(); stats.Redelivered != 1 || stats.DeadLettered != 1 || stats.Acked != 0 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+}
+
+func TestMessageBrokerCloseDrainsAndClosesChannels(t *testing.T) {
+	broker := NewMessageBroker()
+	ch, _ := broker.Subscribe("audit.*")
+	for i := 0; i < 3; i++ {
+		if err := broker.Publish("audit.write", Message{Payload: []byte(strconv.Itoa(i))}); err != nil {
+			t.Fatalf("发布失败: %v", err)
+		}
+	}
+
+	consumed := make(chan []string, 1)
+	go func() {
+		var payloads []string
+		for msg := range ch {
+			payloads = append(payloads, string(msg.Payload))
+			msg.Ack()
+		}
+		consumed <- payloads
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := broker.Close(ctx); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if got := <-consumed; strings.Join(got, ",") != "0,1,2" {
+		t.Errorf("关闭前应处理完所有消息，实际 %v", got)
+	}
+	if err := broker.Publish("audit.write", Message{}); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("关闭后发布应返回ErrBrokerClosed，实际 %v", err)
+	}
+
+	// 无人确认时，ctx到期后仍会关闭通道，缓冲中的消息仍可读出
+	stuck := NewMessageBroker()
+	pending, _ := stuck.Subscribe("audit.write")
+	if err := stuck.Publish("audit.write", Message{}); err != nil {
+		t.Fatalf("发布失败: %v", err)
+	}
+	short, cancelShort := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShort()
+	if err := stuck.Close(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("未确认的消息应使关闭超时，实际 %v", err)
+	}
+	receive(t, pending)
+	if !receiveClosed(pending) {
+		t.Error("关闭后通道应被关闭")
+	}
+}
+
+// ==================
+// 15. 网关请求验证
+// ==================
+
+func newValidatedGateway(t *testing.T, transport UpstreamTransport) *APIGateway {
+	t.Helper()
+	validator, err := NewRequestValidator(
+		ValidationRule{ID: "request-id", Field: "header:X-Request-ID", Type: ValidateTypeString, Required: true},
+		ValidationRule{ID: "page", Field: "query:page", Type: ValidateTypeNumber},
+		ValidationRule{ID: "email", Field: "body:user.email", Type: ValidateTypeRegex, Required: true, Pattern: `^[^@\s]+@[^@\s]+$`},
+		ValidationRule{ID: "age", Field: "user.age", Type: ValidateTypeNumber, Validator: func(value interface{}) error {
+			if value.(float64) < 0 {
+				return errors.New("must not be negative")
+			}
+			return nil
+		}},
+	)
+	if err != nil {
+		t.Fatalf("创建验证器失败: %v", err)
+	}
+	gateway := newTestGateway(t, transport, &Route{Method: "POST", PathPattern: "/users", Backend: newBackendPool("users")})
+	gateway.Use(validator)
+	return gateway
+}
+
+// validationFields 解析400响应体，返回失败字段到错误信息的映射
+func validationFields(t *testing.T, response *Response) map[string]string {
+	t.Helper()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("验证失败应返回400，实际为%d", response.StatusCode)
+	}
+	var failure validationFailure
+	if err := json.Unmarshal(response.Body, &failure); err != nil {
+		t.Fatalf("响应体不是合法JSON: %v", err)
+	}
+	fields := make(map[string]string)
+	for _, field := range failure.Fields {
+		fields[field.Field] = field.Message
+	}
+	return fields
+}
+
+func TestRequestValidatorRejectsInvalidRequests(t *testing.T) {
+	cases := []struct {
+		name    string
+		request *Request
+		want    map[string]string
+	}{
+		{
+			name:    "缺少必填字段",
+			request: &Request{Method: "POST", URL: "/users", Body: []byte(`{"user":{}}`)},
+			want:    map[string]string{"header:X-Request-ID": "field is required", "body:user.email": "field is required"},
+		},
+		{
+			name: "类型不匹配",
+			request: &Request{Method: "POST", URL: "/users?page=two", Headers: map[string]string{"x-request-id": "r-1"},
+				Body: []byte(`{"user":{"email":"a@example.com","age":"30"}}`)},
+			want: map[string]string{"query:page": "must be a number", "user.age": "must be a number"},
+		},
+		{
+			name: "正则不匹配与自定义验证",
+			request: &Request{Method: "POST", URL: "/users", Headers: map[string]string{"X-Request-ID": "r-1"},
+				Body: []byte(`{"user":{"email":"not-an-email","age":-1}}`)},
+			want: map[string]string{"body:user.email": "must match pattern ^[^@\\s]+@[^@\\s]+$", "user.age": "must not be negative"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			transport := newFakeTransport()
+			gateway := newValidatedGateway(t, transport)
+			response, err := gateway.Handle(tc.request)
+			if err != nil {
+				t.Fatalf("处理请求失败: %v", err)
+			}
+			if got := validationFields(t, response); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("失败字段应为%v，实际为%v", tc.want, got)
+			}
+			if transport.callCount("users") != 0 {
+				t.Error("验证失败的请求不应转发到上游")
+			}
+		})
+	}
+}
+
+func TestRequestValidatorPassesValidRequest(t *testing.T) {
+	transport := newFakeTransport()
+	gateway := newValidatedGateway(t, transport)
+	response, err := gateway.Handle(&Request{
+		Method:  "POST",
+		URL:     "/users?page=2",
+		Headers: map[string]string{"X-Request-ID": "r-1"},
+		Body:    []byte(`{"user":{"email":"a@example.com","age":30}}`),
+	})
+	if err != nil {
+		t.Fatalf("处理请求失败: %v", err)
+	}
+	if response.StatusCode != http.StatusOK || transport.callCount("users") != 1 {
+		t.Errorf("合法请求应转发到上游，实际状态码%d、调用%d次", response.StatusCode, transport.callCount("users"))
+	}
+}
+
+func TestNewRequestValidatorRejectsBadPattern(t *testing.T) {
+	if _, err := NewRequestValidator(ValidationRule{ID: "bad", Field: "query:q", Pattern: "("}); err == nil {
+		t.Error("非法正则应在配置时报错")
+	}
+	if _, err := NewRequestValidator(ValidationRule{ID: "regex", Field: "query:q", Type: ValidateTypeRegex}); err == nil {
+		t.Error("正则类型规则缺少Pattern应报错")
+	}
+}
+
+// ==================
+// 16. 网关请求响应转换
+// ==================
+
+func newTestTransformer(t *testing.T, rules ...TransformationRule) *RequestTransformer {
+	t.Helper()
+	transformer, err := NewRequestTransformer(rules...)
+	if err != nil {
+		t.Fatalf("创建转换器失败: %v", err)
+	}
+	return transformer
+}
+
+func TestRequestTransformerHeaders(t *testing.T) {
+	transformer := newTestTransformer(t,
+		TransformationRule{ID: "add", Type: TransformTypeHeader, Target: "x-gateway", Value: "edge-1"},
+		TransformationRule{ID: "strip", Type: TransformTypeHeader, Action: TransformActionRemove, Source: "Cookie"},
+		TransformationRule{ID: "rename", Type: TransformTypeHeader, Action: TransformActionRename, Source: "x-user", Target: "X-Forwarded-User"},
+	)
+	request := &Request{URL: "/", Headers: map[string]string{"Cookie": "session=1", "X-User": "alice", "Accept": "*/*"}}
+	if err := transformer.TransformRequest(request); err != nil {
+		t.Fatalf("转换失败: %v", err)
+	}
+	want := map[string]string{"X-Gateway": "edge-1", "X-Forwarded-User": "alice", "Accept": "*/*"}
+	if !reflect.DeepEqual(request.Headers, want) {
+		t.Errorf("请求头应为%v，实际为%v", want, request.Headers)
+	}
+}
+
+func TestRequestTransformerQueryAndPath(t *testing.T) {
+	transformer := newTestTransformer(t,
+		TransformationRule{ID: "inject", Type: TransformTypeQuery, Target: "tenant", Value: "acme"},
+		TransformationRule{ID: "strip", Type: TransformTypeQuery, Action: TransformActionRemove, Source: "debug"},
+		TransformationRule{ID: "rename", Type: TransformTypeQuery, Action: TransformActionRename, Source: "p", Target: "page"},
+		TransformationRule{ID: "remap", Type: TransformTypePath, Source: "/api/v1/users", Target: "/tenants/:tenant/accounts"},
+	)
+	cases := []struct{ url, want string }{
+		{"/api/v1/users/42/orders?p=2&debug=true", "/tenants/t1/accounts/42/orders?page=2&tenant=acme"},
+		{"/api/v1/userslist", "/api/v1/userslist?tenant=acme"},
+		{"/api/v2/users", "/api/v2/users?tenant=acme"},
+	}
+	for _, tc := range cases {
+		request := &Request{URL: tc.url, Params: map[string]string{"tenant": "t1"}}
+		if err := transformer.TransformRequest(request); err != nil {
+			t.Fatalf("转换%s失败: %v", tc.url, err)
+		}
+		if request.URL != tc.want {
+			t.Errorf("%s 应转换为%s，实际为%s", tc.url, tc.want, request.URL)
+		}
+	}
+}
+
+func TestRequestTransformerBody(t *testing.T) {
+	transformer := newTestTransformer(t,
+		TransformationRule{ID: "upper", Type: TransformTypeBody, Source: "user.name", Transform: func(value interface{}) interface{} {
+			return strings.ToUpper(value.(string))
+		}},
+		TransformationRule{ID: "strip", Type: TransformTypeBody, Action: TransformActionRemove, Source: "user.password"},
+		TransformationRule{ID: "move", Type: TransformTypeBody, Action: TransformActionRename, Source: "user.mail", Target: "contact.email"},
+		TransformationRule{ID: "wrap", Type: TransformTypeBody, Transform: func(value interface{}) interface{} {
+			return map[string]interface{}{"data": value}
+		}},
+	)
+	request := &Request{URL: "/", Body: []byte(`{"user":{"name":"alice","password":"secret","mail":"a@example.com"}}`)}
+	if err := transformer.TransformRequest(request); err != nil {
+		t.Fatalf("转换失败: %v", err)
+	}
+	want := `{"data":{"contact":{"email":"a@example.com"},"user":{"name":"ALICE"}}}`
+	if string(request.Body) != want {
+		t.Errorf("请求体应为%s，实际为%s", want, request.Body)
+	}
+}
+
+func TestRequestTransformerRuleOrdering(t *testing.T) {
+	// 先改名再设置：新设置的值覆盖改名结果；顺序相反时改名覆盖设置的值
+	rename := TransformationRule{ID: "rename", Type: TransformTypeHeader, Action: TransformActionRename, Source: "X-Client", Target: "X-Origin"}
+	set := TransformationRule{ID: "set", Type: TransformTypeHeader, Target: "X-Origin", Value: "gateway"}
+
+	for _, tc := range []struct {
+		rules []TransformationRule
+		want  string
+	}{
+		{[]TransformationRule{rename, set}, "gateway"},
+		{[]TransformationRule{set, rename}, "mobile"},
+	} {
+		request := &Request{URL: "/", Headers: map[string]string{"X-Client": "mobile"}}
+		if err := newTestTransformer(t, tc.rules...).TransformRequest(request); err != nil {
+			t.Fatalf("转换失败: %v", err)
+		}
+		if got := request.Headers["X-Origin"]; got != tc.want {
+			t.Errorf("规则顺序%s,%s 的结果应为%s，实际为%s", tc.rules[0].ID, tc.rules[1].ID, tc.want, got)
+		}
+	}
+}
+
+func TestRequestTransformerFailureLeavesRequestIntact(t *testing.T) {
+	transformer := newTestTransformer(t,
+		TransformationRule{ID: "add", Type: TransformTypeHeader, Target: "X-Gateway", Value: "edge-1"},
+		TransformationRule{ID: "reject", Type: TransformTypeBody, Source: "amount", Transform: func(value interface{}) interface{} {
+			return fmt.Errorf("amount %v is not convertible", value)
+		}},
+	)
+	request := &Request{URL: "/pay?x=1", Headers: map[string]string{"Accept": "*/*"}, Body: []byte(`{"amount":"ten"}`)}
+	err := transformer.TransformRequest(request)
+	var transformErr *TransformError
+	if !errors.As(err, &transformErr) || transformErr.RuleID != "reject" {
+		t.Fatalf("应返回reject规则的TransformError，实际为%v", err)
+	}
+	if len(request.Headers) != 1 || request.URL != "/pay?x=1" || string(request.Body) != `{"amount":"ten"}` {
+		t.Errorf("转换失败后请求不应被修改: %+v", request)
+	}
+
+	invalid := &Request{URL: "/", Body: []byte("not json")}
+	if err := transformer.TransformRequest(invalid); err == nil {
+		t.Error("请求体不是JSON时应返回错误")
+	}
+}
+
+func TestRequestTransformerMiddleware(t *testing.T) {
+	transport := newFakeTransport()
+	transport.responses["users"] = &Response{StatusCode: http.StatusOK, Headers: map[string]string{"Server": "users-1"}, Body: []byte(`{"id":1,"secret":"x"}`)}
+	gateway := newTestGateway(t, transport, &Route{Method: "POST", PathPattern: "/users", Backend: newBackendPool("users")})
+	gateway.Use(newTestTransformer(t,
+		TransformationRule{ID: "hide-server", Type: TransformTypeHeader, Action: TransformActionRemove, Source: "Server", Response: true},
+		TransformationRule{ID: "hide-secret", Type: TransformTypeBody, Action: TransformActionRemove, Source: "secret", Response: true},
+		TransformationRule{ID: "reject", Type: TransformTypeBody, Source: "name", Transform: func(value interface{}) interface{} {
+			if value == nil {
+				return errors.New("name is missing")
+			}
+			return value
+		}},
+	))
+
+	response, err := gateway.Handle(&Request{Method: "POST", URL: "/users", Body: []byte(`{"name":"alice"}`)})
+	if err != nil {
+		t.Fatalf("处理请求失败: %v", err)
+	}
+	if len(response.Headers) != 0 || string(response.Body) != `{"id":1}` {
+		t.Errorf("响应转换结果不正确: %v %s", response.Headers, response.Body)
+	}
+	if transport.responses["users"].Headers["Server"] != "users-1" {
+		t.Error("响应转换不应修改上游返回的原始响应")
+	}
+
+	response, err = gateway.Handle(&Request{Method: "POST", URL: "/users", Body: []byte(`{}`)})
+	if err != nil {
+		t.Fatalf("处理请求失败: %v", err)
+	}
+	if response.StatusCode != http.StatusBadRequest || !strings.Contains(string(response.Body), "name is missing") {
+		t.Errorf("请求转换失败应返回400并说明原因，实际为%d %s", response.StatusCode, response.Body)
+	}
+	if transport.callCount("users") != 1 {
+		t.Errorf("转换失败的请求不应转发，上游调用%d次", transport.callCount("users"))
+	}
+}
+
+func TestNewRequestTransformerRejectsInvalidRules(t *testing.T) {
+	invalid := []TransformationRule{
+		{ID: "no-target", Type: TransformTypeHeader},
+		{ID: "rename", Type: TransformTypeQuery, Action: TransformActionRename, Source: "a"},
+		{ID: "path", Type: TransformTypePath, Source: "api", Target: "/v1"},
+		{ID: "body", Type: TransformTypeBody, Source: "a"},
+		{ID: "response-query", Type: TransformTypeQuery, Target: "a", Response: true},
+	}
+	for _, rule := range invalid {
+		if _, err := NewRequestTransformer(rule); err == nil {
+			t.Errorf("规则%s应被拒绝", rule.ID)
+		}
+	}
+}
+
+// ==================
+// 17. JWT认证
+// ==================
+
+var testJWTSecret = []byte("gateway-test-secret")
+
+// signJWT 生成测试令牌，key为[]byte时使用HS256，为*rsa.PrivateKey时使用RS256
+func signJWT(t *testing.T, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	algorithm := "HS256"
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		algorithm = "RS256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("编码声明失败: %v", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("签名失败: %v", err)
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"sub":   "user-1",
+		"name":  "Alice",
+		"roles": []string{"admin", "viewer"},
+		"iss":   "https://auth.example.com",
+		"aud":   []string{"orders-api", "billing-api"},
+		"exp":   now.Add(time.Hour).Unix(),
+		"nbf":   now.Add(-time.Minute).Unix(),
+	}
+}
+
+func newJWTHandler(t *testing.T, config AuthenticationConfig) *AuthenticationHandler {
+	t.Helper()
+	config.Enabled = true
+	config.Methods = []AuthenticationMethod{AuthMethodJWT}
+	config.JWTIssuer = "https://auth.example.com"
+	config.JWTAudience = "orders-api"
+	handler, err := NewAuthenticationHandler(config)
+	if err != nil {
+		t.Fatalf("创建认证处理器失败: %v", err)
+	}
+	return handler
+}
+
+func bearerRequest(token string) *Request {
+	return &Request{Method: "GET", URL: "/orders", Headers: map[string]string{"Authorization": "Bearer " + token}}
+}
+
+func TestJWTAuthenticationAcceptsValidTokens(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成RSA密钥失败: %v", err)
+	}
+	handlers := map[string]struct {
+		handler *AuthenticationHandler
+		key     interface{}
+	}{
+		"HS256": {newJWTHandler(t, AuthenticationConfig{JWTSecret: testJWTSecret}), testJWTSecret},
+		"RS256": {newJWTHandler(t, AuthenticationConfig{JWTPublicKey: &privateKey.PublicKey}), privateKey},
+	}
+	for name, tc := range handlers {
+		principal, err := tc.handler.Authenticate(bearerRequest(signJWT(t, tc.key, validClaims())))
+		if err != nil {
+			t.Fatalf("%s 合法令牌认证失败: %v", name, err)
+		}
+		if principal.ID != "user-1" || principal.Name != "Alice" || !reflect.DeepEqual(principal.Roles, []string{"admin", "viewer"}) {
+			t.Errorf("%s 主体不正确: %+v", name, principal)
+		}
+	}
+}
+
+func TestJWTAuthenticationRejectsInvalidTokens(t *testing.T) {
+	handler := newJWTHandler(t, AuthenticationConfig{JWTSecret: testJWTSecret})
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	notYetValid := validClaims()
+	notYetValid["nbf"] = time.Now().Add(time.Hour).Unix()
+	wrongAudience := validClaims()
+	wrongAudience["aud"] = "billing-api"
+	wrongIssuer := validClaims()
+	wrongIssuer["iss"] = "https://evil.example.com"
+
+	cases := []struct {
+		name    string
+		request *Request
+		want    error
+	}{
+		{"缺少令牌", &Request{Method: "GET", URL: "/orders"}, ErrMissingCredentials},
+		{"已过期", bearerRequest(signJWT(t, testJWTSecret, expired)), ErrTokenExpired},
+		{"尚未生效", bearerRequest(signJWT(t, testJWTSecret, notYetValid)), ErrInvalidToken},
+		{"签名错误", bearerRequest(signJWT(t, []byte("another-secret"), validClaims())), ErrInvalidToken},
+		{"受众不符", bearerRequest(signJWT(t, testJWTSecret, wrongAudience)), ErrInvalidToken},
+		{"签发者不符", bearerRequest(signJWT(t, testJWTSecret, wrongIssuer)), ErrInvalidToken},
+		{"格式错误", bearerRequest("not.a-jwt"), ErrInvalidToken},
+	}
+	for _, tc := range cases {
+		_, err := handler.Authenticate(tc.request)
+		var proxyErr *ProxyError
+		if !errors.As(err, &proxyErr) || proxyErr.Type != ErrorTypeAuthentication {
+			t.Errorf("%s: 应返回认证类型的ProxyError，实际为%v", tc.name, err)
+			continue
+		}
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: 错误应为%v，实际为%v", tc.name, tc.want, err)
+		}
+	}
+
+	// alg为none的令牌不能绕过签名校验
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload, _ := json.Marshal(validClaims())
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+	if _, err := handler.Authenticate(bearerRequest(unsigned)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("alg为none的令牌应被拒绝，实际为%v", err)
+	}
+}
+
+func TestJWTAuthenticationMiddleware(t *testing.T) {
+	transport := newFakeTransport()
+	gateway := newTestGateway(t, transport, &Route{Method: "GET", PathPattern: "/orders", Backend: newBackendPool("orders")})
+	gateway.Use(newJWTHandler(t, AuthenticationConfig{JWTSecret: testJWTSecret}))
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	response, err := gateway.Handle(bearerRequest(signJWT(t, testJWTSecret, expired)))
+	if err != nil {
+		t.Fatalf("处理请求失败: %v", err)
+	}
+	if response.StatusCode != http.StatusUnauthorized || response.Headers["Www-Authenticate"] == "" {
+		t.Errorf("过期令牌应返回401并带WWW-Authenticate头，实际为%d %v", response.StatusCode, response.Headers)
+	}
+	if transport.callCount("orders") != 0 {
+		t.Error("认证失败的请求不应转发")
+	}
+
+	request := bearerRequest(signJWT(t, testJWTSecret, validClaims()))
+	response, err = gateway.Handle(request)
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("合法令牌应转发成功，实际为%v %v", response, err)
+	}
+	if request.Principal == nil || request.Principal.ID != "user-1" {
+		t.Errorf("认证后请求应带有主体，实际为%+v", request.Principal)
+	}
+}
+
+func TestNewAuthenticationHandlerRequiresKey(t *testing.T) {
+	_, err := NewAuthenticationHandler(AuthenticationConfig{Enabled: true, Methods: []AuthenticationMethod{AuthMethodJWT}})
+	if err == nil {
+		t.Error("启用JWT但未配置密钥时应报错")
+	}
+}
+
+// ==================
+// 18. RBAC授权
+// ==================
+
+func newTestAuthorizer(t *testing.T, defaultDecision string) *AuthorizationHandler {
+	t.Helper()
+	handler, err := NewAuthorizationHandler(
+		AuthorizationConfig{Enabled: true, Default: defaultDecision},
+		AuthorizationPolicy{ID: "orders", Rules: []AuthorizationRule{
+			{ID: "admin-all", Resource: "/orders/*", Action: "*", Principal: "role:admin"},
+			{ID: "viewer-read", Resource: "/orders/:id", Action: "GET", Principal: "role:viewer"},
+			{ID: "no-delete", Resource: "/orders/:id", Action: "DELETE", Principal: "user:mallory", Effect: "deny"},
+		}},
+		AuthorizationPolicy{ID: "users", Rules: []AuthorizationRule{
+			{ID: "self-profile", Resource: "/users/:owner/profile", Action: "*", Principal: "*", Condition: "owner == principal"},
+			{ID: "same-tenant", Resource: "/tenants/:tenant/reports", Action: "GET", Principal: "*", Condition: "tenant == principal.tenant"},
+			{ID: "own-documents", Resource: "/documents/*", Action: "GET", Principal: "*", Condition: "owner == principal"},
+		}},
+	)
+	if err != nil {
+		t.Fatalf("创建授权处理器失败: %v", err)
+	}
+	return handler
+}
+
+func TestAuthorizationDecisions(t *testing.T) {
+	admin := &Principal{ID: "alice", Roles: []string{"admin"}}
+	viewer := &Principal{ID: "bob", Roles: []string{"viewer"}, Attrs: map[string]interface{}{"tenant": "acme"}}
+	mallory := &Principal{ID: "mallory", Roles: []string{"admin"}}
+	authorizer := newTestAuthorizer(t, "deny")
+
+	cases := []struct {
+		name      string
+		method    string
+		url       string
+		principal *Principal
+		allowed   bool
+		rule      string
+	}{
+		{"管理员可以修改订单", "PUT", "/orders/7", admin, true, "admin-all"},
+		{"只读角色可以查看订单", "GET", "/orders/7", viewer, true, "viewer-read"},
+		{"只读角色不能删除订单", "DELETE", "/orders/7", viewer, false, ""},
+		{"拒绝规则优先于允许规则", "DELETE", "/orders/7", mallory, false, "no-delete"},
+		{"未认证请求默认拒绝", "GET", "/orders/7", nil, false, ""},
+		{"可以访问自己的资料", "PUT", "/users/bob/profile", viewer, true, "self-profile"},
+		{"不能访问他人的资料", "PUT", "/users/alice/profile", viewer, false, ""},
+		{"同租户可以查看报表", "GET", "/tenants/acme/reports", viewer, true, "same-tenant"},
+		{"没有租户属性时条件不成立", "GET", "/tenants/acme/reports", admin, false, ""},
+		{"查询参数不能满足条件", "GET", "/documents/9?owner=bob", viewer, false, ""},
+		{"查询参数不能覆盖路径参数", "PUT", "/users/alice/profile?owner=bob", viewer, false, ""},
+	}
+	for _, tc := range cases {
+		decision := authorizer.Decide(&Request{Method: tc.method, URL: tc.url, Principal: tc.principal})
+		if decision.Allowed != tc.allowed || decision.RuleID != tc.rule {
+			t.Errorf("%s: 期望allowed=%v rule=%q，实际为%+v", tc.name, tc.allowed, tc.rule, decision)
+		}
+	}
+}
+
+func TestAuthorizationDefaultDecision(t *testing.T) {
+	request := &Request{Method: "GET", URL: "/health", Principal: &Principal{ID: "bob"}}
+
+	if err := newTestAuthorizer(t, "allow").Authorize(request); err != nil {
+		t.Errorf("没有规则匹配且默认允许时应放行，实际为%v", err)
+	}
+	err := newTestAuthorizer(t, "").Authorize(request)
+	var proxyErr *ProxyError
+	if !errors.As(err, &proxyErr) || proxyErr.Type != ErrorTypeAuthorization || !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("默认拒绝时应返回授权类型的ProxyError，实际为%v", err)
+	}
+
+	if _, err := NewAuthorizationHandler(AuthorizationConfig{Default: "maybe"}); err == nil {
+		t.Error("非法的默认决定应报错")
+	}
+	_, err = NewAuthorizationHandler(AuthorizationConfig{}, AuthorizationPolicy{ID: "bad", Rules: []AuthorizationRule{
+		{ID: "condition", Resource: "/a", Condition: "owner principal"},
+	}})
+	if err == nil {
+		t.Error("非法的条件表达式应在配置时报错")
+	}
+}
+
+func TestAuthorizationMiddleware(t *testing.T) {
+	transport := newFakeTransport()
+	gateway := newTestGateway(t, transport, &Route{PathPattern: "/orders/:id", Backend: newBackendPool("orders")})
+	gateway.Use(newJWTHandler(t, AuthenticationConfig{JWTSecret: testJWTSecret}))
+	gateway.Use(newTestAuthorizer(t, "deny"))
+
+	claims := validClaims()
+	claims["roles"] = []string{"viewer"}
+	token := signJWT(t, testJWTSecret, claims)
+
+	request := bearerRequest(token)
+	request.URL = "/orders/7"
+	response, err := gateway.Handle(request)
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("只读角色查看订单应放行，实际为%v %v", response, err)
+	}
+
+	request = bearerRequest(token)
+	request.Method, request.URL = "DELETE", "/orders/7"
+	response, err = gateway.Handle(request)
+	if err != nil {
+		t.Fatalf("处理请求失败: %v", err)
+	}
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("只读角色删除订单应返回403，实际为%d", response.StatusCode)
+	}
+	if transport.callCount("orders") != 1 {
+		t.Errorf("被拒绝的请求不应转发，上游调用%d次", transport.callCount("orders"))
+	}
+}
+
+// ==================
+// 19. 网络策略
+// ==================
+
+type policyLogRecorder struct {
+	mutex   sync.Mutex
+	entries []PolicyDecision
+}
+
+func (r *policyLogRecorder) OnPolicyLog(connection Connection, decision PolicyDecision) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries = append(r.entries, decision)
+}
+
+func TestNetworkPolicyEngineDecisions(t *testing.T) {
+	engine := NewNetworkPolicyEngine()
+	recorder := &policyLogRecorder{}
+	engine.AddListener(recorder)
+	policies := []*NetworkPolicy{
+		{ID: "internal", Rules: []NetworkRule{
+			{Source: "10.1.0.0/16", Destination: "app=billing", Protocol: "http", Port: 8443, Action: RuleActionDeny},
+			{Source: "10.0.0.0/8", Destination: "app=billing", Protocol: "http", Port: 8443, Action: RuleActionAllow},
+		}},
+		{ID: "audit", Rules: []NetworkRule{
+			{Source: "team=partners", Destination: "*", Protocol: "*", Action: RuleActionLog},
+			{Source: "203.0.113.7", Destination: "reports", Action: RuleActionAllow},
+		}},
+	}
+	for _, policy := range policies {
+		if err := engine.AddPolicy(policy); err != nil {
+			t.Fatalf("添加策略失败: %v", err)
+		}
+	}
+
+	billing := NetworkEndpoint{Name: "billing-1", IP: net.ParseIP("10.9.0.5"), Port: 8443, Labels: map[string]string{"app": "billing"}}
+	cases := []struct {
+		name       string
+		connection Connection
+		action     RuleAction
+		allowed    bool
+		policy     string
+		rule       int
+	}{
+		{"内网访问计费服务放行", Connection{Source: NetworkEndpoint{IP: net.ParseIP("10.2.3.4")}, Destination: billing, Protocol: "HTTP"}, RuleActionAllow, true, "internal", 1},
+		{"隔离网段优先命中拒绝规则", Connection{Source: NetworkEndpoint{IP: net.ParseIP("10.1.3.4")}, Destination: billing, Protocol: "http"}, RuleActionDeny, false, "internal", 0},
+		{"合作方连接记录后放行", Connection{Source: NetworkEndpoint{Name: "partner", Labels: map[string]string{"team": "partners"}}, Destination: billing, Protocol: "grpc"}, RuleActionLog, true, "audit", 0},
+		{"单个IP按名称访问报表", Connection{Source: NetworkEndpoint{IP: net.ParseIP("203.0.113.7")}, Destination: NetworkEndpoint{Name: "reports"}, Protocol: "tcp"}, RuleActionAllow, true, "audit", 1},
+		{"端口不符时默认拒绝", Connection{Source: NetworkEndpoint{IP: net.ParseIP("10.2.3.4")}, Destination: NetworkEndpoint{IP: billing.IP, Port: 9090, Labels: billing.Labels}, Protocol: "http"}, RuleActionDeny, false, "", -1},
+		{"没有规则匹配时默认拒绝", Connection{Source: NetworkEndpoint{IP: net.ParseIP("192.168.1.1")}, Destination: billing, Protocol: "http"}, RuleActionDeny, false, "", -1},
+	}
+	for _, tc := range cases {
+		decision := engine.Evaluate(tc.connection)
+		want := PolicyDecision{Action: tc.action, Allowed: tc.allowed, PolicyID: tc.policy, Rule: tc.rule}
+		if decision != want {
+			t.Errorf("%s: 期望%+v，实际为%+v", tc.name, want, decision)
+		}
+	}
+
+	if len(recorder.entries) != 1 || recorder.entries[0].Action != RuleActionLog {
+		t.Errorf("只有Log规则应通知监听器，实际为%+v", recorder.entries)
+	}
+	if stats := engine.Statistics(); stats.Allowed != 3 || stats.Denied != 3 || stats.Logged != 1 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+}
+
+func TestNetworkPolicyEngineWithoutPoliciesAllows(t *testing.T) {
+	decision := NewNetworkPolicyEngine().Evaluate(Connection{Protocol: "http"})
+	if !decision.Allowed || decision.Rule != -1 {
+		t.Errorf("没有策略时应放行，实际为%+v", decision)
+	}
+	if err := NewNetworkPolicyEngine().AddPolicy(&NetworkPolicy{ID: "bad", Rules: []NetworkRule{{Source: "10.0.0.0/33"}}}); err == nil {
+		t.Error("非法CIDR应报错")
+	}
+	if err := NewNetworkPolicyEngine().AddPolicy(&NetworkPolicy{ID: "bad", Rules: []NetworkRule{{Destination: "app=,tier=web"}}}); err == nil {
+		t.Error("非法标签选择器应报错")
+	}
+}
+
+func TestServiceMeshEnforcesNetworkPolicy(t *testing.T) {
+	transport := newFakeTransport()
+	proxy := NewServiceProxy("payments", ProxyConfig{}, transport)
+	proxy.AddUpstream(&UpstreamService{ID: "payments-eu", Address: "10.0.1.10:8080", Labels: map[string]string{"region": "eu"}})
+	proxy.AddUpstream(&UpstreamService{ID: "payments-us", Address: "10.0.2.10:8080", Labels: map[string]string{"region": "us"}})
+	proxy.AddDownstreamClient(&DownstreamClient{ID: "checkout", Labels: map[string]string{"app": "checkout"}})
+	proxy.AddDownstreamClient(&DownstreamClient{ID: "batch", Labels: map[string]string{"app": "batch"}})
+	proxy.AddDownstreamClient(&DownstreamClient{ID: "auditor", Labels: map[string]string{"app": "auditor"}})
+
+	mesh := NewServiceMesh()
+	mesh.RegisterProxy(proxy)
+	err := mesh.AddNetworkPolicy(&NetworkPolicy{ID: "payments", Rules: []NetworkRule{
+		{Source: "app=checkout", Destination: "region=eu", Protocol: "http", Port: 8080, Action: RuleActionAllow},
+		{Source: "app=auditor", Destination: "*", Action: RuleActionLog},
+		{Source: "app=batch", Destination: "*", Action: RuleActionDeny},
+	}})
+	if err != nil {
+		t.Fatalf("添加策略失败: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := mesh.Forward("payments", &Request{Source: "checkout", Method: "POST", URL: "/charge"}); err != nil {
+			t.Fatalf("checkout访问允许的上游失败: %v", err)
+		}
+	}
+	if transport.callCount("payments-eu") != 4 || transport.callCount("payments-us") != 0 {
+		t.Errorf("只应转发到策略允许的上游，实际eu=%d us=%d", transport.callCount("payments-eu"), transport.callCount("payments-us"))
+	}
+
+	_, err = mesh.Forward("payments", &Request{Source: "batch", Method: "POST", URL: "/charge"})
+	var proxyErr *ProxyError
+	if !errors.As(err, &proxyErr) || proxyErr.Type != ErrorTypeAuthorization || !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("被拒绝的来源应返回授权类型的策略错误，实际为%v", err)
+	}
+
+	if _, err := mesh.Forward("payments", &Request{Source: "auditor", Method: "GET", URL: "/ledger"}); err != nil {
+		t.Fatalf("Log规则应放行: %v", err)
+	}
+	var logs []AccessLog
+	for _, entry := range mesh.AccessLogs() {
+		if entry.Policy != "" {
+			logs = append(logs, entry)
+		}
+	}
+	if len(logs) != 2 || logs[0].Source != "auditor" || logs[0].Policy != "payments" {
+		t.Errorf("审计来源到两个上游的连接都应记入访问日志，实际为%+v", logs)
+	}
+	if transport.callCount("payments-eu")+transport.callCount("payments-us") != 5 {
+		t.Error("被拒绝的请求不应转发")
+	}
+}
+
+// ==================
+// 20. 网格双向TLS
+// ==================
+
+func parseTestCertificate(t *testing.T, certificate *TLSCertificate) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(certificate.Certificate)
+	if block == nil {
+		t.Fatalf("证书%s不是PEM格式", certificate.ID)
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("解析证书%s失败: %v", certificate.ID, err)
+	}
+	return parsed
+}
+
+// tlsHandshake 在本地回环连接上完成一次TLS握手，返回客户端和服务端的错误
+func tlsHandshake(t *testing.T, client, server *tls.Config) (error, error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	defer listener.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		tlsServer := tls.Server(conn, server)
+		if err := tlsServer.Handshake(); err != nil {
+			serverErr <- err
+			return
+		}
+		_, err = tlsServer.Read(make([]byte, 1))
+		serverErr <- err
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	tlsClient := tls.Client(conn, client)
+	clientErr := tlsClient.Handshake()
+	if clientErr == nil {
+		tlsClient.Write([]byte{1})
+	}
+	conn.Close()
+	return clientErr, <-serverErr
+}
+
+func TestServiceMeshIssuesCertificates(t *testing.T) {
+	mesh := NewServiceMesh()
+	mesh.config.CertificateTTL = time.Hour
+	issued, err := mesh.IssueCertificate("orders")
+	if err != nil {
+		t.Fatalf("签发证书失败: %v", err)
+	}
+
+	ca, exists := mesh.Certificate(meshCAID)
+	if !exists {
+		t.Fatal("证书表中应有网格CA")
+	}
+	caCert := parseTestCertificate(t, ca)
+	leaf := parseTestCertificate(t, issued)
+	if !caCert.IsCA || leaf.IsCA {
+		t.Error("CA证书和服务证书的IsCA标记不正确")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: "orders", KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("服务证书应由网格CA签发并可用于客户端认证: %v", err)
+	}
+	if len(leaf.URIs) != 1 || leaf.URIs[0].String() != "spiffe://mesh.local/orders" {
+		t.Errorf("服务证书应带SPIFFE ID，实际为%v", leaf.URIs)
+	}
+	if ttl := time.Until(issued.ExpiresAt); ttl > time.Hour || ttl < 59*time.Minute {
+		t.Errorf("证书有效期应为配置的1小时，实际剩余%v", ttl)
+	}
+
+	client, err := mesh.ClientTLSConfig("checkout", "orders")
+	if err != nil {
+		t.Fatalf("创建客户端配置失败: %v", err)
+	}
+	server, err := mesh.ServerTLSConfig("orders")
+	if err != nil {
+		t.Fatalf("创建服务端配置失败: %v", err)
+	}
+	if clientErr, serverErr := tlsHandshake(t, client, server); clientErr != nil || serverErr != nil {
+		t.Errorf("同一网格内的双向TLS握手应成功: client=%v server=%v", clientErr, serverErr)
+	}
+
+	wrongPeer, _ := mesh.ClientTLSConfig("checkout", "payments")
+	if clientErr, _ := tlsHandshake(t, wrongPeer, server); clientErr == nil {
+		t.Error("对端证书不属于期望的服务时客户端应拒绝")
+	}
+}
+
+func TestServiceMeshRotatesExpiringCertificates(t *testing.T) {
+	mesh := NewServiceMesh()
+	mesh.config.CertificateTTL = time.Hour
+	for _, service := range []string{"orders", "payments"} {
+		if _, err := mesh.IssueCertificate(service); err != nil {
+			t.Fatalf("签发证书失败: %v", err)
+		}
+	}
+	original, _ := mesh.Certificate("orders")
+	ca, _ := mesh.Certificate(meshCAID)
+
+	rotated, err := mesh.rotateExpiring(10*time.Minute, time.Now())
+	if err != nil || len(rotated) != 0 {
+		t.Fatalf("证书未临近过期时不应轮换，实际为%v %v", rotated, err)
+	}
+
+	// 55分钟后剩余有效期不足10分钟
+	later := time.Now().Add(55 * time.Minute)
+	rotated, err = mesh.rotateExpiring(10*time.Minute, later)
+	if err != nil {
+		t.Fatalf("轮换失败: %v", err)
+	}
+	if !reflect.DeepEqual(rotated, []string{"orders", "payments"}) {
+		t.Errorf("应轮换全部服务证书，实际为%v", rotated)
+	}
+	renewed, _ := mesh.Certificate("orders")
+	if !renewed.ExpiresAt.After(original.ExpiresAt) || parseTestCertificate(t, renewed).SerialNumber.Cmp(parseTestCertificate(t, original).SerialNumber) == 0 {
+		t.Error("轮换后应为新签发的证书")
+	}
+	if current, _ := mesh.Certificate(meshCAID); current != ca {
+		t.Error("轮换服务证书不应替换CA")
+	}
+
+	// 已有的TLS配置在新握手时使用轮换后的证书
+	server, _ := mesh.ServerTLSConfig("orders")
+	pair, err := server.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("获取服务端证书失败: %v", err)
+	}
+	if served, _ := x509.ParseCertificate(pair.Certificate[0]); served.SerialNumber.Cmp(parseTestCertificate(t, renewed).SerialNumber) != 0 {
+		t.Error("服务端配置应出示轮换后的证书")
+	}
+}
+
+func TestServiceMeshRejectsForeignCA(t *testing.T) {
+	mesh := NewServiceMesh()
+	foreign := NewServiceMesh()
+
+	server, err := mesh.ServerTLSConfig("orders")
+	if err != nil {
+		t.Fatalf("创建服务端配置失败: %v", err)
+	}
+	intruder, err := foreign.ClientTLSConfig("checkout", "orders")
+	if err != nil {
+		t.Fatalf("创建客户端配置失败: %v", err)
+	}
+	// 另一网格的客户端不信任本网格CA，本网格的服务端也不接受其证书
+	intruder.InsecureSkipVerify = true
+	if _, serverErr := tlsHandshake(t, intruder, server); serverErr == nil {
+		t.Error("其他CA签发的客户端证书应被服务端拒绝")
+	}
+
+	client, _ := mesh.ClientTLSConfig("checkout", "orders")
+	foreignServer, _ := foreign.ServerTLSConfig("orders")
+	if clientErr, _ := tlsHandshake(t, client, foreignServer); clientErr == nil {
+		t.Error("其他CA签发的服务端证书应被客户端拒绝")
+	}
+}
+
+// ==================
+// 21. 访问日志导出
+// ==================
+
+// syncBuffer 可并发写入的缓冲区
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	return sb.buffer.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	return sb.buffer.String()
+}
+
+func TestAccessLoggerRingBufferCapsEntries(t *testing.T) {
+	logger := NewAccessLogger(AccessLogConfig{MaxEntries: 3})
+	for i := 0; i < 10; i++ {
+		logger.Record(AccessLog{Destination: "orders", Path: "/" + strconv.Itoa(i)})
+	}
+
+	var paths []string
+	for _, entry := range logger.Entries() {
+		paths = append(paths, entry.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"/7", "/8", "/9"}) {
+		t.Errorf("环形缓冲应只保留最近3条，实际为%v", paths)
+	}
+	if cap(logger.ring) != 3 {
+		t.Errorf("环形缓冲容量应固定为3，实际为%d", cap(logger.ring))
+	}
+}
+
+func TestAccessLoggerSampling(t *testing.T) {
+	logger := NewAccessLogger(AccessLogConfig{MaxEntries: 1000, SampleRate: 4})
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				logger.Record(AccessLog{Destination: "orders"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := logger.Statistics()
+	if stats.Recorded != 200 || stats.SampledOut != 600 {
+		t.Errorf("每4条应记录1条，实际记录%d条、丢弃%d条", stats.Recorded, stats.SampledOut)
+	}
+	if len(logger.Entries()) != 200 {
+		t.Errorf("内存中应有200条日志，实际为%d", len(logger.Entries()))
+	}
+}
+
+func TestAccessLoggerJSONLinesSink(t *testing.T) {
+	output := &syncBuffer{}
+	logger := NewAccessLogger(AccessLogConfig{MaxEntries: 2, FlushInterval: time.Millisecond})
+	logger.SetSink(NewJSONLinesSink(output))
+
+	timestamp := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		logger.Record(AccessLog{Timestamp: timestamp, Source: "web", Destination: "orders", Method: "GET", Path: "/orders/" + strconv.Itoa(i), StatusCode: 200, ResponseTime: 1500 * time.Microsecond})
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	stats := logger.Statistics()
+	if int64(len(lines)) != stats.Flushed || stats.Flushed+stats.Dropped != 3 {
+		t.Fatalf("写出%d行，统计为%+v", len(lines), stats)
+	}
+	for _, line := range lines {
+		var decoded map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+			t.Fatalf("输出不是合法的JSON行 %q: %v", line, err)
+		}
+		if decoded["destination"] != "orders" || decoded["status_code"] != float64(200) || decoded["response_time_ns"] != float64(1500000) {
+			t.Errorf("JSON字段不正确: %v", decoded)
+		}
+		if _, exists := decoded["policy"]; exists {
+			t.Errorf("空字段应省略: %v", decoded)
+		}
+	}
+}
+
+func TestServiceMeshExportsAccessLogs(t *testing.T) {
+	transport := newFakeTransport()
+	proxy := NewServiceProxy("orders", ProxyConfig{}, transport)
+	proxy.AddUpstream(&UpstreamService{ID: "orders-1"})
+	mesh := NewServiceMesh()
+	mesh.RegisterProxy(proxy)
+
+	output := &syncBuffer{}
+	logger := NewAccessLogger(AccessLogConfig{SampleRate: 2})
+	logger.SetSink(NewJSONLinesSink(output))
+	mesh.SetAccessLogger(logger)
+
+	for i := 0; i < 6; i++ {
+		if _, err := mesh.Forward("orders", &Request{Source: "web", Method: "GET", URL: "/orders?page=" + strconv.Itoa(i)}); err != nil {
+			t.Fatalf("转发失败: %v", err)
+		}
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("采样率1/2时应写出3行，实际为%d", len(lines))
+	}
+	var entry AccessLog
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("解析日志失败: %v", err)
+	}
+	if entry.Source != "web" || entry.Destination != "orders" || entry.Path != "/orders" || entry.StatusCode != http.StatusOK {
+		t.Errorf("访问日志内容不正确: %+v", entry)
+	}
+}
+
+// ==================
+// 22. 故障转移
+// ==================
+
+func newFailoverTestLoadBalancer(strategy FailoverStrategy, config FailoverConfig) *LoadBalancer {
+	lb := NewLoadBalancer()
+	for _, backend := range newTestBackends("p1", "p2", "s1", "s2") {
+		lb.AddBackend(backend)
+	}
+	fm := lb.FailoverManager()
+	fm.Strategies = []FailoverStrategy{strategy}
+	fm.Config = config
+	fm.SetGroups([]string{"p1", "p2"}, []string{"s1", "s2"})
+	return lb
+}
+
+func selectedBackendIDs(lb *LoadBalancer, n int) map[string]bool {
+	ids := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		if backend := lb.SelectBackend(&Request{}); backend != nil {
+			ids[backend.id] = true
+		}
+	}
+	return ids
+}
+
+func TestFailoverGracefulDrainsAndFailsBack(t *testing.T) {
+	lb := newFailoverTestLoadBalancer(FailoverStrategyGraceful, FailoverConfig{Enabled: true, FailbackAfter: time.Minute})
+	if ids := selectedBackendIDs(lb, 8); !reflect.DeepEqual(ids, map[string]bool{"p1": true, "p2": true}) {
+		t.Fatalf("正常状态应只使用主用组，实际为%v", ids)
+	}
+
+	start := time.Now()
+	lb.mutex.Lock()
+	lb.backends[0].healthy = false
+	lb.mutex.Unlock()
+	lb.UpdateMetrics(map[string]*BackendMetrics{"p2": {RequestCount: 10, ActiveConnections: 2}})
+	if state := lb.evaluateFailover(start); state != FailoverStateFailingOver {
+		t.Fatalf("主用组一半故障且仍有连接时应进入排空，实际为%v", state)
+	}
+	if ids := selectedBackendIDs(lb, 8); !reflect.DeepEqual(ids, map[string]bool{"s1": true, "s2": true}) {
+		t.Errorf("排空期间新请求应只进入备用组，实际为%v", ids)
+	}
+	if state := lb.evaluateFailover(start.Add(time.Second)); state != FailoverStateFailingOver {
+		t.Errorf("连接未排空前应保持排空状态，实际为%v", state)
+	}
+
+	lb.UpdateMetrics(map[string]*BackendMetrics{"p2": {RequestCount: 10, ActiveConnections: 0}})
+	if state := lb.evaluateFailover(start.Add(2 * time.Second)); state != FailoverStateFailedOver {
+		t.Fatalf("连接排空后应完成切换，实际为%v", state)
+	}
+
+	lb.mutex.Lock()
+	lb.backends[0].healthy = true
+	lb.mutex.Unlock()
+	if state := lb.evaluateFailover(start.Add(30 * time.Second)); state != FailoverStateFailedOver {
+		t.Errorf("主用组恢复不足FailbackAfter时不应切回，实际为%v", state)
+	}
+	if state := lb.evaluateFailover(start.Add(2 * time.Minute)); state != FailoverStateNormal {
+		t.Fatalf("主用组持续恢复后应切回，实际为%v", state)
+	}
+	if ids := selectedBackendIDs(lb, 8); !reflect.DeepEqual(ids, map[string]bool{"p1": true, "p2": true}) {
+		t.Errorf("切回后应只使用主用组，实际为%v", ids)
+	}
+
+	var transitions []FailoverState
+	for _, event := range lb.FailoverManager().History() {
+		transitions = append(transitions, event.To)
+	}
+	want := []FailoverState{FailoverStateFailingOver, FailoverStateFailedOver, FailoverStateFailingBack, FailoverStateNormal}
+	if !reflect.DeepEqual(transitions, want) {
+		t.Errorf("状态变化应为%v，实际为%v", want, transitions)
+	}
+}
+
+func TestFailoverImmediateAndRolling(t *testing.T) {
+	immediate := newFailoverTestLoadBalancer(FailoverStrategyImmediate, FailoverConfig{Enabled: true})
+	immediate.UpdateMetrics(map[string]*BackendMetrics{"p1": {RequestCount: 10, ErrorCount: 8}})
+	if state := immediate.EvaluateFailover(); state != FailoverStateFailedOver {
+		t.Fatalf("错误率超过阈值时立即策略应直接切换，实际为%v", state)
+	}
+	if ids := selectedBackendIDs(immediate, 8); !reflect.DeepEqual(ids, map[string]bool{"s1": true, "s2": true}) {
+		t.Errorf("立即切换后应只使用备用组，实际为%v", ids)
+	}
+
+	rolling := newFailoverTestLoadBalancer(FailoverStrategyRolling, FailoverConfig{Enabled: true})
+	rolling.mutex.Lock()
+	rolling.backends[1].healthy = false
+	rolling.mutex.Unlock()
+	now := time.Now()
+	if state := rolling.evaluateFailover(now); state != FailoverStateFailingOver {
+		t.Fatalf("滚动策略应逐步切换，实际为%v", state)
+	}
+	// 第一步换下p1、换上s1，p2不健康不会被选中
+	if ids := selectedBackendIDs(rolling, 8); !reflect.DeepEqual(ids, map[string]bool{"s1": true}) {
+		t.Errorf("滚动第一步应换下p1并换上s1，实际为%v", ids)
+	}
+	if state := rolling.evaluateFailover(now.Add(time.Second)); state != FailoverStateFailedOver {
+		t.Errorf("主用组全部换下后应完成切换，实际为%v", state)
+	}
+}
+
+// ==================
+// 23. 地理负载均衡
+// ==================
+
+func newGeoTestBackends() []*Backend {
+	backends := newTestBackends("us-1", "us-2", "eu-1", "ap-1")
+	for _, backend := range backends {
+		backend.region, _, _ = strings.Cut(backend.id, "-")
+	}
+	return backends
+}
+
+func TestGeographicAlgorithmPrefersNearestRegion(t *testing.T) {
+	algorithm := NewLoadBalancingAlgorithm(LoadBalanceGeographic).(*GeographicAlgorithm)
+	algorithm.SetDistance("us", "eu", 80)
+	algorithm.SetDistance("us", "ap", 150)
+	algorithm.SetDistance("eu", "ap", 120)
+	backends := newGeoTestBackends()
+
+	fromRegion := func(region string) *Request {
+		return &Request{Headers: map[string]string{"X-Client-Region": region}}
+	}
+	seen := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		seen[algorithm.SelectBackend(backends, fromRegion("us")).id]++
+	}
+	if !reflect.DeepEqual(seen, map[string]int{"us-1": 3, "us-2": 3}) {
+		t.Errorf("us请求应在本地区后端间轮询，实际为%v", seen)
+	}
+	if backend := algorithm.SelectBackend(backends, fromRegion("ap")); backend.id != "ap-1" {
+		t.Errorf("ap请求应选择本地区后端，实际为%s", backend.id)
+	}
+	// 请求头名称不区分大小写
+	lowercase := &Request{Headers: map[string]string{"x-client-region": "ap"}}
+	if backend := algorithm.SelectBackend(backends, lowercase); backend.id != "ap-1" {
+		t.Errorf("小写请求头应同样识别来源地区，实际为%s", backend.id)
+	}
+
+	algorithm.Locate = func(request *Request) string {
+		if strings.HasPrefix(request.RemoteAddr, "10.2.") {
+			return "eu"
+		}
+		return ""
+	}
+	if backend := algorithm.SelectBackend(backends, &Request{RemoteAddr: "10.2.0.7"}); backend.id != "eu-1" {
+		t.Errorf("Locate解析为eu时应选择eu-1，实际为%s", backend.id)
+	}
+}
+
+func TestGeographicAlgorithmFallsBackAcrossRegions(t *testing.T) {
+	algorithm := &GeographicAlgorithm{MaxConnections: 10}
+	algorithm.SetDistance("us", "eu", 80)
+	algorithm.SetDistance("us", "ap", 150)
+	backends := newGeoTestBackends()
+	request := &Request{Headers: map[string]string{"X-Client-Region": "us"}}
+
+	backends[0].healthy = false
+	backends[1].connections = 10
+	if backend := algorithm.SelectBackend(backends, request); backend.id != "eu-1" {
+		t.Errorf("本地区无可用容量时应退到最近的eu，实际为%s", backend.id)
+	}
+
+	backends[2].healthy = false
+	if backend := algorithm.SelectBackend(backends, request); backend.id != "ap-1" {
+		t.Errorf("eu也不可用时应退到ap，实际为%s", backend.id)
+	}
+
+	backends[3].healthy = false
+	if backend := algorithm.SelectBackend(backends, request); backend != nil {
+		t.Errorf("所有地区都不可用时应返回nil，实际为%s", backend.id)
+	}
+
+	backends[1].connections = 0
+	if backend := algorithm.SelectBackend(backends, request); backend.id != "us-2" {
+		t.Errorf("本地区恢复容量后应回到本地区，实际为%s", backend.id)
+	}
+}
+
+func TestArchitectGeographicAlgorithmUsesLatencyTargets(t *testing.T) {
+	architect := NewDistributedSystemArchitect(ArchitectConfig{})
+	architect.regions["us"] = &Region{id: "us", latencyTargets: map[string]time.Duration{"eu": 80 * time.Millisecond}}
+	architect.regions["ap"] = &Region{id: "ap", latencyTargets: map[string]time.Duration{"eu": 120 * time.Millisecond}}
+
+	algorithm := architect.GeographicAlgorithm()
+	if distance := algorithm.Distance("eu", "us"); distance != 80 {
+		t.Errorf("eu到us的距离应为80，实际为%v", distance)
+	}
+	if distance := algorithm.Distance("us", "ap"); !math.IsInf(distance, 1) {
+		t.Errorf("未配置的地区对应视为最远，实际为%v", distance)
+	}
+}